@@ -130,8 +130,9 @@ func generateDirectoryStructure() string {
 
 	// Generate state.json documentation
 	buf.WriteString("## state.json Format\n\n")
-	buf.WriteString("The `state.json` file contains the daemon's persistent state. It is written atomically\n")
-	buf.WriteString("(write to temp file, then rename) to prevent corruption.\n\n")
+	buf.WriteString("The `state.json` file contains the daemon's persistent state. Changes are appended to\n")
+	buf.WriteString("`state.journal` as they happen and folded into `state.json` at most a minute later;\n")
+	buf.WriteString("the snapshot is written atomically (write to temp file, then rename) to prevent corruption.\n\n")
 	buf.WriteString("### Schema\n\n")
 	buf.WriteString("```json\n")
 	buf.WriteString(`{
@@ -179,7 +180,10 @@ func generateDirectoryStructure() string {
   "timestamp": "2025-01-01T00:00:00Z",
   "body": "Please review PR #42",
   "status": "pending",
-  "acked_at": null
+  "acked_at": null,
+  "reply_to": "msg-0f1e2d3c4b5a",
+  "thread_id": "msg-0f1e2d3c4b5a",
+  "priority": "normal"
 }
 `)
 	buf.WriteString("```\n\n")
@@ -216,13 +216,24 @@ func verifyFilePaths() Verification {
 // parseStateStructsFromCode extracts json field names for tracked structs.
 func parseStateStructsFromCode() (map[string][]string, error) {
 	tracked := map[string]struct{}{
-		"State":            {},
-		"Repository":       {},
-		"Agent":            {},
-		"TaskHistoryEntry": {},
-		"MergeQueueConfig": {},
-		"PRShepherdConfig": {},
-		"ForkConfig":       {},
+		"State":                  {},
+		"Repository":             {},
+		"Agent":                  {},
+		"AgentProfile":           {},
+		"TaskHistoryEntry":       {},
+		"TokenUsage":             {},
+		"MergeQueueConfig":       {},
+		"PRShepherdConfig":       {},
+		"ForkConfig":             {},
+		"CIFixConfig":            {},
+		"WorkerResumeConfig":     {},
+		"RefreshConfig":          {},
+		"BudgetConfig":           {},
+		"TokenBudget":            {},
+		"MessageRetentionConfig": {},
+		"PendingTask":            {},
+		"QueuedTask":             {},
+		"PullRequestStatus":      {},
 	}
 
 	fset := token.NewFileSet()
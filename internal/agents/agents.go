@@ -8,6 +8,8 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+
+	"github.com/dlorenc/multiclaude/internal/state"
 )
 
 // Definition represents a parsed agent definition from a markdown file.
@@ -15,9 +17,16 @@ type Definition struct {
 	// Name is the agent name, derived from the filename (without .md extension)
 	Name string
 
-	// Content is the full markdown content of the agent definition
+	// Content is the markdown content of the agent definition, without front matter
 	Content string
 
+	// Profile is the model, tools, and permissions from the front matter
+	Profile state.AgentProfile
+
+	// Runner is how agents of this definition run, RunnerTmux or
+	// RunnerHeadless, from the front matter. Empty means RunnerTmux.
+	Runner string
+
 	// SourcePath is the absolute path to the source file
 	SourcePath string
 
@@ -39,6 +48,16 @@ const (
 	SourceMerged DefinitionSource = "merged"
 )
 
+// Runners an agent definition can pick in its front matter
+const (
+	// RunnerTmux runs the agent interactively in a tmux window (the default)
+	RunnerTmux = "tmux"
+
+	// RunnerHeadless runs the agent as a headless `claude -p` process that
+	// works through its task and exits. Only workers and reviews can use it.
+	RunnerHeadless = "headless"
+)
+
 // Reader reads agent definitions from the filesystem.
 type Reader struct {
 	// localAgentsDir is ~/.multiclaude/repos/<repo>/agents/
@@ -110,9 +129,15 @@ func MergeDefinitions(local, repo []Definition) []Definition {
 	for _, repoDef := range repo {
 		if localDef, exists := merged[repoDef.Name]; exists {
 			// Append repo content to local base template
+			runner := localDef.Runner
+			if repoDef.Runner != "" {
+				runner = repoDef.Runner
+			}
 			merged[repoDef.Name] = Definition{
 				Name:       repoDef.Name,
 				Content:    mergeContent(localDef.Content, repoDef.Content),
+				Profile:    repoDef.Profile.Merge(localDef.Profile),
+				Runner:     runner,
 				SourcePath: localDef.SourcePath, // Keep local path as primary
 				Source:     SourceMerged,
 			}
@@ -191,10 +216,13 @@ func readDefinitionsFromDir(dir string, source DefinitionSource) ([]Definition,
 
 		// Extract name from filename (without .md extension)
 		name := strings.TrimSuffix(entry.Name(), ".md")
+		profile, runner, body := parseFrontMatter(string(content))
 
 		definitions = append(definitions, Definition{
 			Name:       name,
-			Content:    string(content),
+			Content:    body,
+			Profile:    profile,
+			Runner:     runner,
 			SourcePath: filePath,
 			Source:     source,
 		})
@@ -203,6 +231,86 @@ func readDefinitionsFromDir(dir string, source DefinitionSource) ([]Definition,
 	return definitions, nil
 }
 
+// ReadDefinition returns the merged definition with the given name.
+// The bool is false if neither directory defines it.
+func (r *Reader) ReadDefinition(name string) (Definition, bool, error) {
+	definitions, err := r.ReadAllDefinitions()
+	if err != nil {
+		return Definition{}, false, err
+	}
+	for _, def := range definitions {
+		if def.Name == name {
+			return def, true, nil
+		}
+	}
+	return Definition{}, false, nil
+}
+
+// parseFrontMatter splits an optional front matter block off a definition:
+//
+//	---
+//	model: haiku
+//	allowed-tools: Read, Grep, Bash(gh pr:*)
+//	disallowed-tools: WebFetch
+//	permission-mode: acceptEdits
+//	claude-args: --verbose
+//	runner: headless
+//	---
+//
+// Tool lists are comma-separated and claude-args is split on whitespace.
+// Unknown keys are ignored. It returns the profile, the runner, and the body;
+// content without front matter is returned as-is.
+func parseFrontMatter(content string) (state.AgentProfile, string, string) {
+	var profile state.AgentProfile
+	var runner string
+
+	rest, ok := strings.CutPrefix(content, "---\n")
+	if !ok {
+		return profile, runner, content
+	}
+	header, body, ok := strings.Cut(rest, "\n---\n")
+	if !ok {
+		if header, ok = strings.CutSuffix(strings.TrimRight(rest, "\n"), "\n---"); !ok {
+			return profile, runner, content
+		}
+		body = ""
+	}
+
+	for _, line := range strings.Split(header, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "model":
+			profile.Model = value
+		case "allowed-tools":
+			profile.AllowedTools = splitList(value)
+		case "disallowed-tools":
+			profile.DisallowedTools = splitList(value)
+		case "permission-mode":
+			profile.PermissionMode = value
+		case "claude-args":
+			profile.ExtraArgs = strings.Fields(value)
+		case "runner":
+			runner = value
+		}
+	}
+	return profile, runner, strings.TrimLeft(body, "\n")
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // ParseTitle extracts the title from a markdown definition.
 // It looks for the first H1 heading (# Title) in the content.
 // Returns the name as-is if no H1 heading is found.
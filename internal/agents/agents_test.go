@@ -5,6 +5,8 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/dlorenc/multiclaude/internal/state"
 )
 
 func TestReadLocalDefinitions(t *testing.T) {
@@ -213,6 +215,55 @@ func TestMergeDefinitions(t *testing.T) {
 	}
 }
 
+func TestParseFrontMatter(t *testing.T) {
+	content := `---
+model: haiku
+allowed-tools: Read, Grep, Bash(gh pr:*)
+permission-mode: acceptEdits
+claude-args: --verbose --add-dir /tmp/shared
+runner: headless
+name: ignored
+---
+
+# Merge Queue
+
+Merges PRs.
+`
+	profile, runner, body := parseFrontMatter(content)
+	if profile.Model != "haiku" || profile.PermissionMode != "acceptEdits" {
+		t.Errorf("profile = %+v", profile)
+	}
+	if runner != RunnerHeadless {
+		t.Errorf("runner = %q, want %q", runner, RunnerHeadless)
+	}
+	if strings.Join(profile.AllowedTools, "|") != "Read|Grep|Bash(gh pr:*)" {
+		t.Errorf("allowed tools = %q", profile.AllowedTools)
+	}
+	if strings.Join(profile.ExtraArgs, " ") != "--verbose --add-dir /tmp/shared" {
+		t.Errorf("extra args = %q", profile.ExtraArgs)
+	}
+	if body != "# Merge Queue\n\nMerges PRs.\n" {
+		t.Errorf("body = %q", body)
+	}
+
+	// Without front matter the content is untouched
+	plain := "# Worker\n\n---\n\nmodel: opus\n"
+	if profile, runner, body := parseFrontMatter(plain); body != plain || profile.Model != "" || runner != "" {
+		t.Errorf("parseFrontMatter(plain) = %+v, %q, %q", profile, runner, body)
+	}
+
+	// A repo definition overrides the local profile field by field
+	local := []Definition{{Name: "worker", Content: "base", Profile: state.AgentProfile{Model: "sonnet", PermissionMode: "plan"}, Runner: RunnerHeadless}}
+	repo := []Definition{{Name: "worker", Content: "custom", Profile: state.AgentProfile{Model: "opus"}}}
+	merged := MergeDefinitions(local, repo)
+	if merged[0].Profile.Model != "opus" || merged[0].Profile.PermissionMode != "plan" {
+		t.Errorf("merged profile = %+v", merged[0].Profile)
+	}
+	if merged[0].Runner != RunnerHeadless {
+		t.Errorf("merged runner = %q, want the local one", merged[0].Runner)
+	}
+}
+
 func TestMergeDefinitionsContentFormat(t *testing.T) {
 	local := []Definition{
 		{Name: "worker", Content: "Base instructions\n\n## Your Job\n\nDo things.\n", Source: SourceLocal},
@@ -9,6 +9,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -18,12 +19,14 @@ import (
 	"github.com/dlorenc/multiclaude/internal/daemon"
 	"github.com/dlorenc/multiclaude/internal/diagnostics"
 	"github.com/dlorenc/multiclaude/internal/errors"
+	"github.com/dlorenc/multiclaude/internal/events"
 	"github.com/dlorenc/multiclaude/internal/fork"
 	"github.com/dlorenc/multiclaude/internal/format"
-	"github.com/dlorenc/multiclaude/internal/hooks"
 	"github.com/dlorenc/multiclaude/internal/messages"
 	"github.com/dlorenc/multiclaude/internal/names"
+	"github.com/dlorenc/multiclaude/internal/permissions"
 	"github.com/dlorenc/multiclaude/internal/prompts"
+	"github.com/dlorenc/multiclaude/internal/snapshot"
 	"github.com/dlorenc/multiclaude/internal/socket"
 	"github.com/dlorenc/multiclaude/internal/state"
 	"github.com/dlorenc/multiclaude/internal/templates"
@@ -435,6 +438,13 @@ func (c *CLI) registerCommands() {
 		Run:         c.showHistory,
 	}
 
+	repoCmd.Subcommands["prs"] = &Command{
+		Name:        "prs",
+		Description: "Show pull requests tracked by the daemon",
+		Usage:       "multiclaude repo prs [--repo <repo>]",
+		Run:         c.listPRs,
+	}
+
 	repoCmd.Subcommands["hibernate"] = &Command{
 		Name:        "hibernate",
 		Description: "Hibernate a repository, archiving uncommitted changes",
@@ -453,7 +463,7 @@ func (c *CLI) registerCommands() {
 	workerCmd := &Command{
 		Name:        "worker",
 		Description: "Manage worker agents",
-		Usage:       "multiclaude worker [<task>] [--repo <repo>] [--branch <branch>] [--push-to <branch>]",
+		Usage:       "multiclaude worker [<task>] [--repo <repo>] [--branch <branch>] [--push-to <branch>] [--after <worker|#pr>,...] [--force] [--model <model>] [--allowed-tools <tool>,...] [--disallowed-tools <tool>,...] [--permission-mode <mode>] [--claude-args=\"<args>\"]",
 		Subcommands: make(map[string]*Command),
 	}
 
@@ -462,7 +472,7 @@ func (c *CLI) registerCommands() {
 	workerCmd.Subcommands["create"] = &Command{
 		Name:        "create",
 		Description: "Create a new worker agent",
-		Usage:       "multiclaude worker create <task> [--repo <repo>] [--branch <branch>] [--push-to <branch>]",
+		Usage:       "multiclaude worker create <task> [--repo <repo>] [--branch <branch>] [--push-to <branch>] [--after <worker|#pr>,...] [--force] [--model <model>] [--allowed-tools <tool>,...] [--disallowed-tools <tool>,...] [--permission-mode <mode>] [--claude-args=\"<args>\"]",
 		Run:         c.createWorker,
 	}
 
@@ -482,6 +492,36 @@ func (c *CLI) registerCommands() {
 
 	c.rootCmd.Subcommands["worker"] = workerCmd
 
+	// Queue commands
+	queueCmd := &Command{
+		Name:        "queue",
+		Description: "Manage worker tasks waiting for a free slot (see config --max-workers)",
+		Subcommands: make(map[string]*Command),
+	}
+
+	queueCmd.Subcommands["list"] = &Command{
+		Name:        "list",
+		Description: "List queued worker tasks",
+		Usage:       "multiclaude queue list [--repo <repo>]",
+		Run:         c.listQueue,
+	}
+
+	queueCmd.Subcommands["rm"] = &Command{
+		Name:        "rm",
+		Description: "Remove a task from the queue",
+		Usage:       "multiclaude queue rm <name> [--repo <repo>]",
+		Run:         c.removeQueuedTask,
+	}
+
+	queueCmd.Subcommands["promote"] = &Command{
+		Name:        "promote",
+		Description: "Move a task to the front of the queue",
+		Usage:       "multiclaude queue promote <name> [--repo <repo>]",
+		Run:         c.promoteQueuedTask,
+	}
+
+	c.rootCmd.Subcommands["queue"] = queueCmd
+
 	// 'work' is an alias for 'worker' (backward compatibility)
 	c.rootCmd.Subcommands["work"] = workerCmd
 
@@ -537,14 +577,14 @@ func (c *CLI) registerCommands() {
 	agentCmd.Subcommands["send-message"] = &Command{
 		Name:        "send-message",
 		Description: "Send a message to another agent (alias for 'message send')",
-		Usage:       "multiclaude agent send-message <recipient> <message>",
+		Usage:       "multiclaude agent send-message <recipient|@group> <message> [--urgent|--priority <low|normal|urgent>]",
 		Run:         c.sendMessage,
 	}
 
 	agentCmd.Subcommands["list-messages"] = &Command{
 		Name:        "list-messages",
 		Description: "List pending messages (alias for 'message list')",
-		Usage:       "multiclaude agent list-messages",
+		Usage:       "multiclaude agent list-messages [--thread <message-id>]",
 		Run:         c.listMessages,
 	}
 
@@ -576,6 +616,13 @@ func (c *CLI) registerCommands() {
 		Run:         c.restartAgentCmd,
 	}
 
+	agentCmd.Subcommands["prompt"] = &Command{
+		Name:        "prompt",
+		Description: "Show the prompt an agent was started with, or how its definitions changed since",
+		Usage:       "multiclaude agent prompt <name> [--repo <repo>] [--diff]",
+		Run:         c.showAgentPrompt,
+	}
+
 	agentCmd.Subcommands["attach"] = &Command{
 		Name:        "attach",
 		Description: "Attach to an agent's tmux window",
@@ -595,15 +642,36 @@ func (c *CLI) registerCommands() {
 
 	messageCmd.Subcommands["send"] = &Command{
 		Name:        "send",
-		Description: "Send a message to another agent",
-		Usage:       "multiclaude message send <recipient> <message>",
+		Description: "Send a message to another agent or a group (@all, @workers, @type:<type>, @<group>)",
+		Usage:       "multiclaude message send <recipient|@group> <message> [--urgent|--priority <low|normal|urgent>]",
 		Run:         c.sendMessage,
 	}
 
+	messageCmd.Subcommands["reply"] = &Command{
+		Name:        "reply",
+		Description: "Reply to a message in the same thread",
+		Usage:       "multiclaude message reply <message-id> <message> [--urgent|--priority <low|normal|urgent>]",
+		Run:         c.replyMessage,
+	}
+
+	messageCmd.Subcommands["status"] = &Command{
+		Name:        "status",
+		Description: "Show per-recipient delivery status of a broadcast",
+		Usage:       "multiclaude message status <broadcast-id>",
+		Run:         c.messageStatus,
+	}
+
+	messageCmd.Subcommands["gc"] = &Command{
+		Name:        "gc",
+		Description: "Remove old delivered messages and archive mailboxes of finished agents",
+		Usage:       "multiclaude message gc [--repo <repo>] [--dry-run]",
+		Run:         c.gcMessages,
+	}
+
 	messageCmd.Subcommands["list"] = &Command{
 		Name:        "list",
-		Description: "List pending messages",
-		Usage:       "multiclaude message list",
+		Description: "List pending messages, or a whole thread",
+		Usage:       "multiclaude message list [--thread <message-id>]",
 		Run:         c.listMessages,
 	}
 
@@ -637,14 +705,28 @@ func (c *CLI) registerCommands() {
 	c.rootCmd.Subcommands["repair"] = &Command{
 		Name:        "repair",
 		Description: "Repair state after crash",
-		Usage:       "multiclaude repair [--verbose]",
+		Usage:       "multiclaude repair [--verbose] [--check-schema]",
 		Run:         c.repair,
 	}
 
+	c.rootCmd.Subcommands["export"] = &Command{
+		Name:        "export",
+		Description: "Export repositories, agents, messages, and unpushed branches to an archive",
+		Usage:       "multiclaude export <file.tar.gz> [--repo <repo>]",
+		Run:         c.exportInstallation,
+	}
+
+	c.rootCmd.Subcommands["import"] = &Command{
+		Name:        "import",
+		Description: "Rebuild repositories and workers from an export archive",
+		Usage:       "multiclaude import <file.tar.gz>",
+		Run:         c.importInstallation,
+	}
+
 	c.rootCmd.Subcommands["refresh"] = &Command{
 		Name:        "refresh",
 		Description: "Sync agent worktrees with main branch",
-		Usage:       "multiclaude refresh",
+		Usage:       "multiclaude refresh [--all] [--repo <repo>] [--disable <agent>] [--enable <agent>]",
 		Run:         c.refresh,
 	}
 
@@ -705,11 +787,27 @@ func (c *CLI) registerCommands() {
 
 	c.rootCmd.Subcommands["logs"] = logsCmd
 
+	// Events command
+	c.rootCmd.Subcommands["events"] = &Command{
+		Name:        "events",
+		Description: "Show daemon events (agent lifecycle, deliveries, refreshes, task status)",
+		Usage:       "multiclaude events [-f|--follow] [--repo <repo>] [--type <type>[,<type>...]] [--json]",
+		Run:         c.showEvents,
+	}
+
+	// Usage command
+	c.rootCmd.Subcommands["usage"] = &Command{
+		Name:        "usage",
+		Description: "Show token usage and estimated cost per agent, task, or day",
+		Usage:       "multiclaude usage [--since <7d|2006-01-02>] [--repo <repo>] [--by agent|task|day]",
+		Run:         c.showUsage,
+	}
+
 	// Config command
 	c.rootCmd.Subcommands["config"] = &Command{
 		Name:        "config",
 		Description: "View or modify repository configuration",
-		Usage:       "multiclaude config [repo] [--mq-enabled=true|false] [--mq-track=all|author|assigned] [--ps-enabled=true|false] [--ps-track=all|author|assigned]",
+		Usage:       "multiclaude config [repo] [--mq-enabled=true|false] [--mq-track=all|author|assigned] [--ps-enabled=true|false] [--ps-track=all|author|assigned] [--max-workers=<n>] [--ci-fix=true|false] [--ci-fix-attempts=<n>] [--resume-workers=true|false] [--resume-attempts=<n>] [--refresh-resolve=true|false] [--budget=<warn>/<cap>] [--agent-budget=<type>:<warn>/<cap>,...] [--global-budget=<warn>/<cap>] [--message-group=<name>:<member>,...] [--message-max-age=<days>] [--message-max-count=<n>] [--permission-profile=<type>:<profile>,...]",
 		Run:         c.configRepo,
 	}
 
@@ -775,7 +873,7 @@ func (c *CLI) startDaemon(args []string) error {
 }
 
 func (c *CLI) runDaemon(args []string) error {
-	return daemon.Run()
+	return daemon.Run(c.documentation)
 }
 
 func (c *CLI) stopDaemon(args []string) error {
@@ -923,6 +1021,29 @@ func (c *CLI) systemStatus(args []string) error {
 		}
 		fmt.Printf("      Agents: %d core, %d workers\n", coreAgents, workerCount)
 
+		// Activity summary (only states that were detected)
+		if activity, ok := repoMap["activity"].(map[string]interface{}); ok && len(activity) > 0 {
+			var parts []string
+			for _, kind := range []string{"busy", "idle", "waiting_permission", "crashed"} {
+				if n, ok := activity[kind].(float64); ok && n > 0 {
+					cell := formatActivityCell(kind)
+					parts = append(parts, cell.Color.Sprintf("%d %s", int(n), cell.Text))
+				}
+			}
+			if len(parts) > 0 {
+				fmt.Printf("      Activity: %s\n", strings.Join(parts, ", "))
+			}
+		}
+
+		// Workers changing the same files, from the daemon's last overlap check
+		if overlaps, ok := repoMap["overlaps"].([]interface{}); ok {
+			for _, raw := range overlaps {
+				if line := formatOverlap(raw); line != "" {
+					fmt.Printf("      Overlap: %s\n", line)
+				}
+			}
+		}
+
 		// Show fork info if applicable
 		if isFork, _ := repoMap["is_fork"].(bool); isFork {
 			upstreamOwner, _ := repoMap["upstream_owner"].(string)
@@ -938,6 +1059,198 @@ func (c *CLI) systemStatus(args []string) error {
 	return nil
 }
 
+// showEvents prints recent daemon events and, with --follow, streams new ones
+// until interrupted. --json prints one raw JSON event per line for scripting.
+func (c *CLI) showEvents(args []string) error {
+	flags, _ := ParseFlags(args)
+
+	follow := flags["follow"] == "true" || flags["f"] == "true"
+	asJSON := flags["json"] == "true"
+
+	eventArgs := map[string]interface{}{}
+	if repo := flags["repo"]; repo != "" {
+		eventArgs["repo"] = repo
+	}
+	if types := flags["type"]; types != "" {
+		eventArgs["types"] = types
+	}
+
+	resp, err := c.sendDaemonRequest("recent_events", eventArgs)
+	if err != nil {
+		return err
+	}
+
+	recent, _ := resp.Data.([]interface{})
+	for _, item := range recent {
+		raw, err := json.Marshal(item)
+		if err != nil {
+			continue
+		}
+		printEvent(raw, asJSON)
+	}
+
+	if !follow {
+		if len(recent) == 0 && !asJSON {
+			format.Dimmed("No recent events. Stream new ones with: multiclaude events --follow")
+		}
+		return nil
+	}
+
+	client := socket.NewClient(c.paths.DaemonSock)
+	err = client.Subscribe(socket.Request{Command: "subscribe", Args: eventArgs}, func(raw json.RawMessage) error {
+		printEvent(raw, asJSON)
+		return nil
+	})
+	if err != nil {
+		return errors.DaemonCommunicationFailed("subscribe", err)
+	}
+	return nil
+}
+
+// printEvent prints a single daemon event, either raw or as a readable line
+func printEvent(raw json.RawMessage, asJSON bool) {
+	if asJSON {
+		fmt.Println(string(raw))
+		return
+	}
+
+	var event events.Event
+	if err := json.Unmarshal(raw, &event); err != nil {
+		return
+	}
+
+	target := event.Repo
+	if event.Agent != "" {
+		target += "/" + event.Agent
+	}
+
+	keys := make([]string, 0, len(event.Data))
+	for k := range event.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	details := make([]string, 0, len(keys))
+	for _, k := range keys {
+		details = append(details, fmt.Sprintf("%s=%v", k, event.Data[k]))
+	}
+
+	fmt.Printf("%s  %-20s %s  %s\n",
+		format.Dim.Sprint(event.Time.Local().Format("15:04:05")),
+		format.Cyan.Sprint(string(event.Type)),
+		format.Bold.Sprint(target),
+		strings.Join(details, " "))
+}
+
+// showUsage prints token usage and estimated cost read from agent session
+// transcripts, grouped by agent, task, or day
+func (c *CLI) showUsage(args []string) error {
+	flags, _ := ParseFlags(args)
+
+	by := flags["by"]
+	if by == "" {
+		by = "agent"
+	}
+	if by != "agent" && by != "task" && by != "day" {
+		return errors.InvalidUsage(fmt.Sprintf("invalid --by value: %s (valid values: agent, task, day)", by))
+	}
+
+	usageArgs := map[string]interface{}{"by": by}
+	scope := "all repositories"
+	if repo := flags["repo"]; repo != "" {
+		usageArgs["repo"] = repo
+		scope = fmt.Sprintf("'%s'", repo)
+	}
+	if since := flags["since"]; since != "" {
+		t, err := parseSince(since)
+		if err != nil {
+			return errors.InvalidUsage(fmt.Sprintf("invalid --since value: %s (use a duration like 7d or 24h, or a date like 2006-01-02)", since))
+		}
+		usageArgs["since"] = t.Format(time.RFC3339)
+		scope += ", since " + t.Local().Format("2006-01-02 15:04")
+	}
+
+	resp, err := c.sendDaemonRequest("usage", usageArgs)
+	if err != nil {
+		return err
+	}
+
+	rows, _ := resp.Data.([]interface{})
+	if len(rows) == 0 {
+		fmt.Printf("No token usage recorded for %s\n", scope)
+		return nil
+	}
+
+	format.Header("Token usage for %s, by %s:", scope, by)
+	fmt.Println()
+
+	var headers []string
+	switch by {
+	case "agent":
+		headers = []string{"REPO", "AGENT"}
+	case "task":
+		headers = []string{"REPO", "AGENT", "TASK"}
+	case "day":
+		headers = []string{"DAY"}
+	}
+	headers = append(headers, "INPUT", "OUTPUT", "CACHE WRITE", "CACHE READ", "COST")
+	table := format.NewColoredTable(headers...)
+
+	var totalTokens [4]int64
+	var totalCost float64
+	for _, item := range rows {
+		row, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		var cells []format.ColoredCell
+		switch by {
+		case "agent", "task":
+			repo, _ := row["repo"].(string)
+			agent, _ := row["agent"].(string)
+			cells = append(cells, format.Cell(repo), format.Cell(agent))
+			if by == "task" {
+				task, _ := row["task"].(string)
+				cells = append(cells, format.Cell(format.Truncate(task, 40)))
+			}
+		case "day":
+			day, _ := row["day"].(string)
+			cells = append(cells, format.Cell(day))
+		}
+
+		for i, key := range []string{"input_tokens", "output_tokens", "cache_creation_tokens", "cache_read_tokens"} {
+			n, _ := row[key].(float64)
+			totalTokens[i] += int64(n)
+			cells = append(cells, format.Cell(format.Tokens(int64(n))))
+		}
+		cost, _ := row["cost_usd"].(float64)
+		totalCost += cost
+		cells = append(cells, format.ColorCell(format.Cost(cost), format.Yellow))
+
+		table.AddRow(cells...)
+	}
+	table.Print()
+
+	fmt.Println()
+	format.Bold.Printf("Total: %s input, %s output, %s cache write, %s cache read, %s\n",
+		format.Tokens(totalTokens[0]), format.Tokens(totalTokens[1]),
+		format.Tokens(totalTokens[2]), format.Tokens(totalTokens[3]), format.Cost(totalCost))
+	format.Dimmed("Costs are estimates at API list prices.")
+	return nil
+}
+
+// parseSince parses a --since value: a duration back from now (see
+// parseDuration) or a date or RFC3339 time
+func parseSince(s string) (time.Time, error) {
+	if d, err := parseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
 func (c *CLI) daemonLogs(args []string) error {
 	flags, _ := ParseFlags(args)
 
@@ -1187,6 +1500,9 @@ func (c *CLI) initRepo(args []string) error {
 	if repoName == "" {
 		return errors.InvalidUsage("could not determine repository name from URL; please provide a name: multiclaude init <url> <name>")
 	}
+	if err := state.ValidateRepoName(repoName); err != nil {
+		return errors.InvalidUsage(err.Error())
+	}
 
 	// Parse merge queue configuration flags
 	mqEnabled := flags["no-merge-queue"] != "true"
@@ -1306,121 +1622,8 @@ func (c *CLI) initRepo(args []string) error {
 		return fmt.Errorf("failed to copy agent templates: %w", err)
 	}
 
-	// Create tmux session (tmuxSession already defined and validated earlier)
-	fmt.Printf("Creating tmux session: %s\n", tmuxSession)
-
-	// Create session with supervisor window
-	cmd = exec.Command("tmux", "new-session", "-d", "-s", tmuxSession, "-n", "supervisor", "-c", repoPath)
-	if err := cmd.Run(); err != nil {
-		return errors.TmuxOperationFailed("create session", err)
-	}
-
-	// Create merge-queue or pr-shepherd window based on mode
-	if mqEnabled {
-		cmd = exec.Command("tmux", "new-window", "-d", "-t", tmuxSession, "-n", "merge-queue", "-c", repoPath)
-		if err := cmd.Run(); err != nil {
-			return errors.TmuxOperationFailed("create merge-queue window", err)
-		}
-	} else if psEnabled {
-		cmd = exec.Command("tmux", "new-window", "-d", "-t", tmuxSession, "-n", "pr-shepherd", "-c", repoPath)
-		if err := cmd.Run(); err != nil {
-			return errors.TmuxOperationFailed("create pr-shepherd window", err)
-		}
-	}
-
-	// Generate session IDs for agents
-	supervisorSessionID, err := claude.GenerateSessionID()
-	if err != nil {
-		return fmt.Errorf("failed to generate supervisor session ID: %w", err)
-	}
-
-	var mergeQueueSessionID, prShepherdSessionID string
-	if mqEnabled {
-		mergeQueueSessionID, err = claude.GenerateSessionID()
-		if err != nil {
-			return fmt.Errorf("failed to generate merge-queue session ID: %w", err)
-		}
-	} else if psEnabled {
-		prShepherdSessionID, err = claude.GenerateSessionID()
-		if err != nil {
-			return fmt.Errorf("failed to generate pr-shepherd session ID: %w", err)
-		}
-	}
-
-	// Write prompt files
-	supervisorPromptFile, err := c.writePromptFile(repoPath, state.AgentTypeSupervisor, "supervisor")
-	if err != nil {
-		return fmt.Errorf("failed to write supervisor prompt: %w", err)
-	}
-
-	var mergeQueuePromptFile, prShepherdPromptFile string
-	if mqEnabled {
-		mergeQueuePromptFile, err = c.writeMergeQueuePromptFile(repoPath, "merge-queue", mqConfig)
-		if err != nil {
-			return fmt.Errorf("failed to write merge-queue prompt: %w", err)
-		}
-	} else if psEnabled {
-		prShepherdPromptFile, err = c.writePRShepherdPromptFile(repoPath, "pr-shepherd", psConfig, forkConfig)
-		if err != nil {
-			return fmt.Errorf("failed to write pr-shepherd prompt: %w", err)
-		}
-	}
-
-	// Copy hooks configuration if it exists (for supervisor and merge-queue)
-	if err := hooks.CopyConfig(repoPath, repoPath); err != nil {
-		fmt.Printf("Warning: failed to copy hooks config: %v\n", err)
-	}
-
-	// Start Claude in supervisor window (skip in test mode)
-	var supervisorPID, mergeQueuePID, prShepherdPID int
-	if os.Getenv("MULTICLAUDE_TEST_MODE") != "1" {
-		// Resolve claude binary
-		claudeBinary, err := c.getClaudeBinary()
-		if err != nil {
-			return fmt.Errorf("failed to resolve claude binary: %w", err)
-		}
-
-		fmt.Println("Starting Claude Code in supervisor window...")
-		pid, err := c.startClaudeInTmux(claudeBinary, tmuxSession, "supervisor", repoPath, supervisorSessionID, supervisorPromptFile, repoName, "")
-		if err != nil {
-			return fmt.Errorf("failed to start supervisor Claude: %w", err)
-		}
-		supervisorPID = pid
-
-		// Set up output capture for supervisor
-		if err := c.setupOutputCapture(tmuxSession, "supervisor", repoName, "supervisor", "supervisor"); err != nil {
-			fmt.Printf("Warning: failed to setup output capture for supervisor: %v\n", err)
-		}
-
-		// Start Claude in merge-queue window only if enabled
-		if mqEnabled {
-			fmt.Println("Starting Claude Code in merge-queue window...")
-			pid, err = c.startClaudeInTmux(claudeBinary, tmuxSession, "merge-queue", repoPath, mergeQueueSessionID, mergeQueuePromptFile, repoName, "")
-			if err != nil {
-				return fmt.Errorf("failed to start merge-queue Claude: %w", err)
-			}
-			mergeQueuePID = pid
-
-			// Set up output capture for merge-queue
-			if err := c.setupOutputCapture(tmuxSession, "merge-queue", repoName, "merge-queue", "merge-queue"); err != nil {
-				fmt.Printf("Warning: failed to setup output capture for merge-queue: %v\n", err)
-			}
-		} else if psEnabled {
-			fmt.Println("Starting Claude Code in pr-shepherd window...")
-			pid, err = c.startClaudeInTmux(claudeBinary, tmuxSession, "pr-shepherd", repoPath, prShepherdSessionID, prShepherdPromptFile, repoName, "")
-			if err != nil {
-				return fmt.Errorf("failed to start pr-shepherd Claude: %w", err)
-			}
-			prShepherdPID = pid
-
-			// Set up output capture for pr-shepherd
-			if err := c.setupOutputCapture(tmuxSession, "pr-shepherd", repoName, "pr-shepherd", "pr-shepherd"); err != nil {
-				fmt.Printf("Warning: failed to setup output capture for pr-shepherd: %v\n", err)
-			}
-		}
-	}
-
-	// Add repository to daemon state (with merge queue and fork config)
+	// Add repository to daemon state (with merge queue and fork config). This
+	// comes first: the daemon reads the config when writing the agents' prompts.
 	addRepoArgs := map[string]interface{}{
 		"name":          repoName,
 		"github_url":    githubURL,
@@ -1447,76 +1650,9 @@ func (c *CLI) initRepo(args []string) error {
 		return fmt.Errorf("failed to register repository: %s", resp.Error)
 	}
 
-	// Add supervisor agent
-	resp, err = client.Send(socket.Request{
-		Command: "add_agent",
-		Args: map[string]interface{}{
-			"repo":          repoName,
-			"agent":         "supervisor",
-			"type":          "supervisor",
-			"worktree_path": repoPath,
-			"tmux_window":   "supervisor",
-			"session_id":    supervisorSessionID,
-			"pid":           supervisorPID,
-		},
-	})
-	if err != nil {
-		return fmt.Errorf("failed to register supervisor: %w", err)
-	}
-	if !resp.Success {
-		return fmt.Errorf("failed to register supervisor: %s", resp.Error)
-	}
-
-	// Add merge-queue agent only if enabled (non-fork mode)
-	if mqEnabled {
-		resp, err = client.Send(socket.Request{
-			Command: "add_agent",
-			Args: map[string]interface{}{
-				"repo":          repoName,
-				"agent":         "merge-queue",
-				"type":          "merge-queue",
-				"worktree_path": repoPath,
-				"tmux_window":   "merge-queue",
-				"session_id":    mergeQueueSessionID,
-				"pid":           mergeQueuePID,
-			},
-		})
-		if err != nil {
-			return fmt.Errorf("failed to register merge-queue: %w", err)
-		}
-		if !resp.Success {
-			return fmt.Errorf("failed to register merge-queue: %s", resp.Error)
-		}
-	}
-
-	// Add pr-shepherd agent only if enabled (fork mode)
-	if psEnabled {
-		resp, err = client.Send(socket.Request{
-			Command: "add_agent",
-			Args: map[string]interface{}{
-				"repo":          repoName,
-				"agent":         "pr-shepherd",
-				"type":          "pr-shepherd",
-				"worktree_path": repoPath,
-				"tmux_window":   "pr-shepherd",
-				"session_id":    prShepherdSessionID,
-				"pid":           prShepherdPID,
-			},
-		})
-		if err != nil {
-			return fmt.Errorf("failed to register pr-shepherd: %w", err)
-		}
-		if !resp.Success {
-			return fmt.Errorf("failed to register pr-shepherd: %s", resp.Error)
-		}
-	}
-
-	// Create default workspace worktree
-	wt := worktree.NewManager(repoPath)
-	workspacePath := c.paths.AgentWorktree(repoName, "default")
-
 	// Check for and migrate legacy "workspace" branch to "workspace/default"
 	// This allows the new workspace/<name> naming convention to work
+	wt := worktree.NewManager(repoPath)
 	migrated, err := wt.MigrateLegacyWorkspaceBranch()
 	if err != nil {
 		// Check if it's a conflict state that requires manual resolution
@@ -1529,78 +1665,34 @@ func (c *CLI) initRepo(args []string) error {
 	if migrated {
 		fmt.Println("Migrated legacy 'workspace' branch to 'workspace/default'")
 	}
-	workspaceBranch := "workspace/default"
-
-	fmt.Printf("Creating default workspace worktree at: %s\n", workspacePath)
-	if err := wt.CreateNewBranch(workspacePath, workspaceBranch, "HEAD"); err != nil {
-		return fmt.Errorf("failed to create default workspace worktree: %w", err)
-	}
-
-	// Create default workspace tmux window (detached so it doesn't switch focus)
-	cmd = exec.Command("tmux", "new-window", "-d", "-t", tmuxSession, "-n", "default", "-c", workspacePath)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to create workspace window: %w", err)
-	}
-
-	// Generate session ID for workspace
-	workspaceSessionID, err := claude.GenerateSessionID()
-	if err != nil {
-		return fmt.Errorf("failed to generate workspace session ID: %w", err)
-	}
-
-	// Write prompt file for default workspace
-	workspacePromptFile, err := c.writePromptFile(repoPath, state.AgentTypeWorkspace, "default")
-	if err != nil {
-		return fmt.Errorf("failed to write default workspace prompt: %w", err)
-	}
 
-	// Copy hooks configuration if it exists
-	if err := hooks.CopyConfig(repoPath, workspacePath); err != nil {
-		fmt.Printf("Warning: failed to copy hooks config to default workspace: %v\n", err)
+	// The daemon spawns the agents: the first one's window creates the tmux
+	// session, and the default workspace gets its worktree
+	type initAgent struct{ name, agentType string }
+	initAgents := []initAgent{{"supervisor", "supervisor"}}
+	if mqEnabled {
+		initAgents = append(initAgents, initAgent{"merge-queue", "merge-queue"})
+	} else if psEnabled {
+		initAgents = append(initAgents, initAgent{"pr-shepherd", "pr-shepherd"})
 	}
+	initAgents = append(initAgents, initAgent{"default", "workspace"})
 
-	// Start Claude in default workspace window (skip in test mode)
-	var workspacePID int
-	if os.Getenv("MULTICLAUDE_TEST_MODE") != "1" {
-		// Resolve claude binary
-		claudeBinary, err := c.getClaudeBinary()
-		if err != nil {
-			return fmt.Errorf("failed to resolve claude binary: %w", err)
-		}
-
-		fmt.Println("Starting Claude Code in default workspace window...")
-		pid, err := c.startClaudeInTmux(claudeBinary, tmuxSession, "default", workspacePath, workspaceSessionID, workspacePromptFile, repoName, "")
+	fmt.Printf("Creating tmux session: %s\n", tmuxSession)
+	for _, agent := range initAgents {
+		fmt.Printf("Starting Claude Code in %s window...\n", agent.name)
+		created, err := c.createAgent(map[string]interface{}{
+			"repo": repoName,
+			"name": agent.name,
+			"type": agent.agentType,
+		})
 		if err != nil {
-			return fmt.Errorf("failed to start default workspace Claude: %w", err)
+			return err
 		}
-		workspacePID = pid
-
-		// Set up output capture for default workspace
-		if err := c.setupOutputCapture(tmuxSession, "default", repoName, "default", "workspace"); err != nil {
-			fmt.Printf("Warning: failed to setup output capture for default workspace: %v\n", err)
+		if agent.agentType == "workspace" {
+			fmt.Printf("Created default workspace worktree at: %s\n", created.worktreePath)
 		}
 	}
 
-	// Add default workspace agent
-	resp, err = client.Send(socket.Request{
-		Command: "add_agent",
-		Args: map[string]interface{}{
-			"repo":          repoName,
-			"agent":         "default",
-			"type":          "workspace",
-			"worktree_path": workspacePath,
-			"tmux_window":   "default",
-			"session_id":    workspaceSessionID,
-			"pid":           workspacePID,
-		},
-	})
-	if err != nil {
-		return fmt.Errorf("failed to register default workspace: %w", err)
-	}
-	if !resp.Success {
-		return fmt.Errorf("failed to register default workspace: %s", resp.Error)
-	}
-
 	fmt.Println()
 	fmt.Println("✓ Repository initialized successfully!")
 	fmt.Printf("  Tmux session: %s\n", tmuxSession)
@@ -1923,8 +2015,18 @@ func (c *CLI) configRepo(args []string) error {
 	hasMqTrack := flags["mq-track"] != ""
 	hasPsEnabled := flags["ps-enabled"] != ""
 	hasPsTrack := flags["ps-track"] != ""
-
-	if !hasMqEnabled && !hasMqTrack && !hasPsEnabled && !hasPsTrack {
+	hasMaxWorkers := flags["max-workers"] != ""
+	hasCIFix := flags["ci-fix"] != ""
+	hasCIFixAttempts := flags["ci-fix-attempts"] != ""
+	hasResume := flags["resume-workers"] != ""
+	hasResumeAttempts := flags["resume-attempts"] != ""
+	hasRefreshResolve := flags["refresh-resolve"] != ""
+	hasBudget := flags["budget"] != "" || flags["agent-budget"] != "" || flags["global-budget"] != ""
+	hasMessageGroup := flags["message-group"] != ""
+	hasMessageRetention := flags["message-max-age"] != "" || flags["message-max-count"] != ""
+	hasPermissionProfile := flags["permission-profile"] != ""
+
+	if !hasMqEnabled && !hasMqTrack && !hasPsEnabled && !hasPsTrack && !hasMaxWorkers && !hasCIFix && !hasCIFixAttempts && !hasResume && !hasResumeAttempts && !hasRefreshResolve && !hasBudget && !hasMessageGroup && !hasMessageRetention && !hasPermissionProfile {
 		// No flags - just show current config
 		return c.showRepoConfig(repoName)
 	}
@@ -2002,11 +2104,127 @@ func (c *CLI) showRepoConfig(repoName string) error {
 		fmt.Printf("  Enabled: false\n")
 	}
 
+	// Show worker limit
+	fmt.Println("\nWorkers:")
+	maxWorkers := 0
+	if v, ok := configMap["max_workers"].(float64); ok {
+		maxWorkers = int(v)
+	}
+	if maxWorkers > 0 {
+		fmt.Printf("  Max workers: %d\n", maxWorkers)
+	} else {
+		fmt.Printf("  Max workers: unlimited\n")
+	}
+	resumeEnabled := true
+	if enabled, ok := configMap["resume_enabled"].(bool); ok {
+		resumeEnabled = enabled
+	}
+	if resumeEnabled {
+		resumeAttempts := 0
+		if v, ok := configMap["resume_max_attempts"].(float64); ok {
+			resumeAttempts = int(v)
+		}
+		fmt.Printf("  Resume after crash: up to %d times\n", resumeAttempts)
+	} else {
+		fmt.Printf("  Resume after crash: disabled\n")
+	}
+	if resolve, _ := configMap["refresh_resolve_conflicts"].(bool); resolve {
+		fmt.Printf("  Refresh conflicts: left for the worker to resolve\n")
+	} else {
+		fmt.Printf("  Refresh conflicts: rebase aborted, worker notified\n")
+	}
+
+	// Show CI fix-up config
+	fmt.Println("\nCI Fix-up:")
+	ciFixEnabled, _ := configMap["ci_fix_enabled"].(bool)
+	fmt.Printf("  Enabled: %v\n", ciFixEnabled)
+	if ciFixEnabled {
+		if v, ok := configMap["ci_fix_max_attempts"].(float64); ok {
+			fmt.Printf("  Max attempts per PR: %d\n", int(v))
+		}
+	}
+
+	// Show daily token budgets
+	fmt.Println("\nToken Budgets (per day):")
+	budgetUsed, _ := configMap["budget_used_tokens"].(float64)
+	budgetWarn, _ := configMap["budget_warn_tokens"].(float64)
+	budgetCap, _ := configMap["budget_cap_tokens"].(float64)
+	fmt.Printf("  Repository: %s (%s used today)\n", describeTokenBudget(budgetWarn, budgetCap), format.Tokens(int64(budgetUsed)))
+	if typeBudgets, ok := configMap["agent_type_budgets"].(map[string]interface{}); ok {
+		types := make([]string, 0, len(typeBudgets))
+		for agentType := range typeBudgets {
+			types = append(types, agentType)
+		}
+		sort.Strings(types)
+		for _, agentType := range types {
+			limits, _ := typeBudgets[agentType].(map[string]interface{})
+			warn, _ := limits["warn_tokens"].(float64)
+			limit, _ := limits["cap_tokens"].(float64)
+			fmt.Printf("  Each %s: %s\n", agentType, describeTokenBudget(warn, limit))
+		}
+	}
+	globalUsed, _ := configMap["global_budget_used_tokens"].(float64)
+	globalWarn, _ := configMap["global_budget_warn_tokens"].(float64)
+	globalCap, _ := configMap["global_budget_cap_tokens"].(float64)
+	fmt.Printf("  All repositories: %s (%s used today)\n", describeTokenBudget(globalWarn, globalCap), format.Tokens(int64(globalUsed)))
+
+	// Show message retention and named message groups
+	fmt.Println("\nMessages:")
+	maxAgeDays, _ := configMap["message_max_age_days"].(float64)
+	maxPerAgent, _ := configMap["message_max_per_agent"].(float64)
+	fmt.Printf("  Keep delivered: %d days, newest %d per agent\n", int(maxAgeDays), int(maxPerAgent))
+	fmt.Printf("  Groups: @all, @workers, @type:<type> (built in)\n")
+	if groups, ok := configMap["message_groups"].(map[string]interface{}); ok {
+		names := make([]string, 0, len(groups))
+		for name := range groups {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			rawMembers, _ := groups[name].([]interface{})
+			members := make([]string, 0, len(rawMembers))
+			for _, member := range rawMembers {
+				if s, ok := member.(string); ok {
+					members = append(members, s)
+				}
+			}
+			fmt.Printf("  @%s: %s\n", name, strings.Join(members, ", "))
+		}
+	}
+
+	// Show the permission profile of each agent type
+	fmt.Println("\nPermissions:")
+	selected, _ := configMap["permission_profiles"].(map[string]interface{})
+	for _, agentType := range []state.AgentType{state.AgentTypeSupervisor, state.AgentTypeWorker, state.AgentTypeReview, state.AgentTypeMergeQueue, state.AgentTypePRShepherd, state.AgentTypeWorkspace, state.AgentTypeGenericPersistent} {
+		profile, _ := selected[string(agentType)].(string)
+		if profile == "" {
+			profile = permissions.Unrestricted
+		}
+		fmt.Printf("  %s: %s\n", agentType, profile)
+	}
+	fmt.Println("  Profiles:")
+	for _, name := range permissions.Names() {
+		profile, _ := permissions.Get(name)
+		fmt.Printf("    %-18s %s\n", name, profile.Description)
+	}
+
 	fmt.Println("\nTo modify:")
 	fmt.Printf("  multiclaude config %s --mq-enabled=true|false\n", repoName)
 	fmt.Printf("  multiclaude config %s --mq-track=all|author|assigned\n", repoName)
 	fmt.Printf("  multiclaude config %s --ps-enabled=true|false\n", repoName)
 	fmt.Printf("  multiclaude config %s --ps-track=all|author|assigned\n", repoName)
+	fmt.Printf("  multiclaude config %s --max-workers=<n>  (0 = unlimited)\n", repoName)
+	fmt.Printf("  multiclaude config %s --ci-fix=true|false\n", repoName)
+	fmt.Printf("  multiclaude config %s --ci-fix-attempts=<n>\n", repoName)
+	fmt.Printf("  multiclaude config %s --resume-workers=true|false\n", repoName)
+	fmt.Printf("  multiclaude config %s --resume-attempts=<n>\n", repoName)
+	fmt.Printf("  multiclaude config %s --refresh-resolve=true|false\n", repoName)
+	fmt.Printf("  multiclaude config %s --budget=<warn>/<cap>  (e.g. 4M/5M, off)\n", repoName)
+	fmt.Printf("  multiclaude config %s --agent-budget=<type>:<warn>/<cap>,...  (e.g. worker:1M/2M)\n", repoName)
+	fmt.Printf("  multiclaude config %s --global-budget=<warn>/<cap>\n", repoName)
+	fmt.Printf("  multiclaude config %s --message-group=<name>:<member>,...  (empty members removes the group)\n", repoName)
+	fmt.Printf("  multiclaude config %s --message-max-age=<days> --message-max-count=<n>  (0 = default)\n", repoName)
+	fmt.Printf("  multiclaude config %s --permission-profile=<type>:<profile>,...  (e.g. worker:worker,review:reviewer-readonly; empty profile = unrestricted)\n", repoName)
 
 	return nil
 }
@@ -2059,7 +2277,144 @@ func (c *CLI) updateRepoConfig(repoName string, flags map[string]string) error {
 		}
 	}
 
-	client := socket.NewClient(c.paths.DaemonSock)
+	if maxWorkers, ok := flags["max-workers"]; ok {
+		n, err := strconv.Atoi(maxWorkers)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid --max-workers value: %s (must be a number, 0 for unlimited)", maxWorkers)
+		}
+		updateArgs["max_workers"] = n
+	}
+
+	// Parse CI fix-up flags
+	if ciFix, ok := flags["ci-fix"]; ok {
+		switch ciFix {
+		case "true":
+			updateArgs["ci_fix_enabled"] = true
+		case "false":
+			updateArgs["ci_fix_enabled"] = false
+		default:
+			return fmt.Errorf("invalid --ci-fix value: %s (must be 'true' or 'false')", ciFix)
+		}
+	}
+
+	if attempts, ok := flags["ci-fix-attempts"]; ok {
+		n, err := strconv.Atoi(attempts)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid --ci-fix-attempts value: %s (must be a number of at least 1)", attempts)
+		}
+		updateArgs["ci_fix_max_attempts"] = n
+	}
+
+	// Parse crashed-worker resume flags
+	if resume, ok := flags["resume-workers"]; ok {
+		switch resume {
+		case "true":
+			updateArgs["resume_enabled"] = true
+		case "false":
+			updateArgs["resume_enabled"] = false
+		default:
+			return fmt.Errorf("invalid --resume-workers value: %s (must be 'true' or 'false')", resume)
+		}
+	}
+
+	if attempts, ok := flags["resume-attempts"]; ok {
+		n, err := strconv.Atoi(attempts)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid --resume-attempts value: %s (must be a number of at least 1)", attempts)
+		}
+		updateArgs["resume_max_attempts"] = n
+	}
+
+	// Parse worktree refresh flags
+	if resolve, ok := flags["refresh-resolve"]; ok {
+		switch resolve {
+		case "true":
+			updateArgs["refresh_resolve_conflicts"] = true
+		case "false":
+			updateArgs["refresh_resolve_conflicts"] = false
+		default:
+			return fmt.Errorf("invalid --refresh-resolve value: %s (must be 'true' or 'false')", resolve)
+		}
+	}
+
+	// Parse daily token budget flags
+	if budget, ok := flags["budget"]; ok {
+		warn, limit, err := parseTokenBudget(budget)
+		if err != nil {
+			return fmt.Errorf("invalid --budget value: %s (%v)", budget, err)
+		}
+		updateArgs["budget_warn_tokens"] = warn
+		updateArgs["budget_cap_tokens"] = limit
+	}
+
+	if agentBudgets, ok := flags["agent-budget"]; ok {
+		typeBudgets := make(map[string]interface{})
+		for _, item := range strings.Split(agentBudgets, ",") {
+			agentType, budget, found := strings.Cut(strings.TrimSpace(item), ":")
+			if !found || !state.AgentType(agentType).IsValid() {
+				return fmt.Errorf("invalid --agent-budget value: %s (use <type>:<warn>/<cap>, e.g. worker:1M/2M)", item)
+			}
+			warn, limit, err := parseTokenBudget(budget)
+			if err != nil {
+				return fmt.Errorf("invalid --agent-budget value: %s (%v)", item, err)
+			}
+			typeBudgets[agentType] = map[string]interface{}{"warn_tokens": warn, "cap_tokens": limit}
+		}
+		updateArgs["agent_type_budgets"] = typeBudgets
+	}
+
+	if budget, ok := flags["global-budget"]; ok {
+		warn, limit, err := parseTokenBudget(budget)
+		if err != nil {
+			return fmt.Errorf("invalid --global-budget value: %s (%v)", budget, err)
+		}
+		updateArgs["global_budget_warn_tokens"] = warn
+		updateArgs["global_budget_cap_tokens"] = limit
+	}
+
+	// Parse message retention limits
+	if days, ok := flags["message-max-age"]; ok {
+		n, err := strconv.Atoi(strings.TrimSuffix(days, "d"))
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid --message-max-age value: %s (must be a number of days, 0 for the default)", days)
+		}
+		updateArgs["message_max_age_days"] = n
+	}
+
+	if count, ok := flags["message-max-count"]; ok {
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid --message-max-count value: %s (must be a number, 0 for the default)", count)
+		}
+		updateArgs["message_max_per_agent"] = n
+	}
+
+	// Parse named message group; members are agent names or group addresses
+	if group, ok := flags["message-group"]; ok {
+		name, list, found := strings.Cut(group, ":")
+		name = strings.TrimPrefix(strings.TrimSpace(name), "@")
+		if !found || name == "" {
+			return fmt.Errorf("invalid --message-group value: %s (use <name>:<member>,..., e.g. frontend:fox,owl)", group)
+		}
+		members := []string{}
+		for _, member := range strings.Split(list, ",") {
+			if member = strings.TrimSpace(member); member != "" {
+				members = append(members, member)
+			}
+		}
+		updateArgs["message_groups"] = map[string]interface{}{name: members}
+	}
+
+	// Parse permission profiles by agent type; an empty profile runs the type unrestricted
+	if value, ok := flags["permission-profile"]; ok {
+		profiles, err := parsePermissionProfiles(value)
+		if err != nil {
+			return err
+		}
+		updateArgs["permission_profiles"] = profiles
+	}
+
+	client := socket.NewClient(c.paths.DaemonSock)
 	resp, err := client.Send(socket.Request{
 		Command: "update_repo_config",
 		Args:    updateArgs,
@@ -2078,6 +2433,33 @@ func (c *CLI) updateRepoConfig(repoName string, flags map[string]string) error {
 	return c.showRepoConfig(repoName)
 }
 
+// parsePermissionProfiles parses a --permission-profile value of the form
+// <type>:<profile>,... into profile names by agent type
+func parsePermissionProfiles(value string) (map[string]interface{}, error) {
+	profiles := map[string]interface{}{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		agentType, profile, found := strings.Cut(entry, ":")
+		agentType, profile = strings.TrimSpace(agentType), strings.TrimSpace(profile)
+		if !found || !state.AgentType(agentType).IsValid() {
+			return nil, errors.InvalidArgument("--permission-profile", entry, "<type>:<profile> with type one of supervisor, worker, review, merge-queue, pr-shepherd, workspace, generic-persistent")
+		}
+		if profile != "" {
+			if err := permissions.Validate(profile); err != nil {
+				return nil, errors.InvalidUsage(err.Error())
+			}
+		}
+		profiles[agentType] = profile
+	}
+	if len(profiles) == 0 {
+		return nil, errors.InvalidUsage("--permission-profile needs at least one <type>:<profile>")
+	}
+	return profiles, nil
+}
+
 func (c *CLI) createWorker(args []string) error {
 	flags, posArgs := ParseFlags(args)
 
@@ -2099,6 +2481,13 @@ func (c *CLI) createWorker(args []string) error {
 		workerName = name
 	}
 
+	// Model, tools, and permissions for this worker; unset fields come from
+	// the worker agent definition when the worker starts
+	profile, err := parseProfileFlags(flags)
+	if err != nil {
+		return err
+	}
+
 	// Check for --push-to flag (for iterating on existing PRs)
 	pushTo, hasPushTo := flags["push-to"]
 	if hasPushTo {
@@ -2108,214 +2497,110 @@ func (c *CLI) createWorker(args []string) error {
 		}
 	}
 
-	// Get repository path
-	repoPath := c.paths.RepoDir(repoName)
-
-	// Fetch latest from origin before creating worktree
-	// This ensures workers start from the latest code, not stale local refs
-	// Note: We use "git fetch origin main" (not "main:main") because the latter
-	// fails when main is checked out in the bare repo with:
-	// "fatal: refusing to fetch into branch 'refs/heads/main' checked out at ..."
-	fmt.Println("Fetching latest from origin...")
-	fetchCmd := exec.Command("git", "fetch", "origin")
-	fetchCmd.Dir = repoPath
-	if err := fetchCmd.Run(); err != nil {
-		// Best effort - don't fail if offline or fetch fails
-		fmt.Printf("Warning: failed to fetch from origin: %v (continuing with local refs)\n", err)
-	}
-
-	// Determine branch to start from
-	// Prefer origin/main if it exists (updated by fetch), otherwise fall back to HEAD
-	// This handles both normal repos and test repos without remotes
-	startBranch := "HEAD"
-	checkOriginCmd := exec.Command("git", "rev-parse", "--verify", "origin/main")
-	checkOriginCmd.Dir = repoPath
-	if err := checkOriginCmd.Run(); err == nil {
-		startBranch = "origin/main"
-	}
-	if branch, ok := flags["branch"]; ok {
-		startBranch = branch
-		if hasPushTo {
-			fmt.Printf("Creating worker '%s' in repo '%s' to iterate on branch '%s'\n", workerName, repoName, pushTo)
-		} else {
-			fmt.Printf("Creating worker '%s' in repo '%s' from branch '%s'\n", workerName, repoName, branch)
+	// Refuse tasks that look like work already in flight or merged, unless
+	// iterating on an existing PR where that's the point
+	if !hasPushTo && flags["force"] != "true" {
+		if err := c.checkDuplicateTask(repoName, task); err != nil {
+			return err
 		}
-	} else {
-		fmt.Printf("Creating worker '%s' in repo '%s'\n", workerName, repoName)
 	}
-	fmt.Printf("Task: %s\n", task)
-
-	// Create worktree
-	wt := worktree.NewManager(repoPath)
-	wtPath := c.paths.AgentWorktree(repoName, workerName)
-
-	var branchName string
-	if hasPushTo {
-		// When --push-to is specified, we're iterating on an existing PR branch
-		// Create a worktree that checks out the remote branch into a local branch
-		branchName = pushTo
-		fmt.Printf("Creating worktree at: %s (checking out %s)\n", wtPath, startBranch)
-
-		// Check if the local branch already exists
-		branchExists, err := wt.BranchExists(branchName)
-		if err != nil {
-			return errors.WorktreeCreationFailed(err)
-		}
 
-		if branchExists {
-			// Branch exists locally, check it out
-			if err := wt.Create(wtPath, branchName); err != nil {
-				return errors.WorktreeCreationFailed(err)
-			}
-		} else {
-			// Branch doesn't exist, create it from the start point
-			if err := wt.CreateNewBranch(wtPath, branchName, startBranch); err != nil {
-				return errors.WorktreeCreationFailed(err)
-			}
-		}
-	} else {
-		// Normal case: create a new branch for this worker
-		branchName = fmt.Sprintf("work/%s", workerName)
-		fmt.Printf("Creating worktree at: %s\n", wtPath)
-		if err := wt.CreateNewBranch(wtPath, branchName, startBranch); err != nil {
-			return errors.WorktreeCreationFailed(err)
+	// --after defers the worker until its dependencies have merged
+	if after, ok := flags["after"]; ok {
+		if _, hasBranch := flags["branch"]; hasBranch || hasPushTo {
+			return errors.InvalidUsage("--after cannot be combined with --branch or --push-to")
 		}
+		return c.queuePendingWorker(repoName, workerName, task, after, profile)
 	}
 
-	// Get repository info to determine tmux session
-	client := socket.NewClient(c.paths.DaemonSock)
-	resp, err := client.Send(socket.Request{
-		Command: "list_agents",
-		Args: map[string]interface{}{
-			"repo": repoName,
-		},
+	// Claim a worker slot; when the repo is at max_workers the task joins the queue.
+	// Workers started from a specific branch are not queued because the queue
+	// always spawns from the latest main.
+	_, hasBranch := flags["branch"]
+	slotResp, err := c.sendDaemonRequest("reserve_worker_slot", map[string]interface{}{
+		"repo":    repoName,
+		"name":    workerName,
+		"task":    task,
+		"queue":   !hasBranch && !hasPushTo,
+		"profile": profile,
 	})
 	if err != nil {
-		return errors.DaemonCommunicationFailed("getting repo info", err)
-	}
-	if !resp.Success {
-		return errors.Wrap(errors.CategoryRuntime, "failed to get repo info", fmt.Errorf("%s", resp.Error))
-	}
-
-	// Get tmux session name (it's mc-<reponame>)
-	tmuxSession := sanitizeTmuxSessionName(repoName)
-
-	// Ensure tmux session exists before creating window
-	// This handles cases where the session was killed or daemon didn't restore it
-	tmuxClient := tmux.NewClient()
-	hasSession, err := tmuxClient.HasSession(context.Background(), tmuxSession)
-	if err != nil {
-		return errors.TmuxOperationFailed("check session", err)
+		return err
 	}
-	if !hasSession {
-		fmt.Printf("Tmux session '%s' not found, creating it...\n", tmuxSession)
-		if err := tmuxClient.CreateSession(context.Background(), tmuxSession, true); err != nil {
-			return errors.TmuxOperationFailed("create session", err)
+	if slot, ok := slotResp.Data.(map[string]interface{}); ok {
+		if queued, _ := slot["queued"].(bool); queued {
+			position, _ := slot["position"].(float64)
+			if reason, _ := slot["reason"].(string); reason == "budget" {
+				fmt.Printf("Repository '%s' has used up its daily token budget\n", repoName)
+				fmt.Printf("Queued worker '%s' at position %d\n", workerName, int(position))
+				fmt.Printf("Task: %s\n", task)
+				resetsAt, _ := slot["budget_resets_at"].(string)
+				if t, err := time.Parse(time.RFC3339, resetsAt); err == nil {
+					format.Dimmed("\nThe worker starts automatically once the budget resets at %s.", t.Local().Format("2006-01-02 15:04"))
+				} else {
+					format.Dimmed("\nThe worker starts automatically once the budget resets.")
+				}
+				format.Dimmed("Check the budget with: multiclaude config %s", repoName)
+				return nil
+			}
+			maxWorkers, _ := slot["max_workers"].(float64)
+			fmt.Printf("Repository '%s' is at its limit of %d workers\n", repoName, int(maxWorkers))
+			fmt.Printf("Queued worker '%s' at position %d\n", workerName, int(position))
+			fmt.Printf("Task: %s\n", task)
+			format.Dimmed("\nThe worker starts automatically when a slot frees up.")
+			format.Dimmed("Manage the backlog with: multiclaude queue list")
+			return nil
 		}
 	}
 
-	// Create tmux window for worker (detached so it doesn't switch focus)
-	fmt.Printf("Creating tmux window: %s\n", workerName)
-	cmd := exec.Command("tmux", "new-window", "-d", "-t", tmuxSession, "-n", workerName, "-c", wtPath)
-	if err := cmd.Run(); err != nil {
-		return errors.TmuxOperationFailed("create window", err)
-	}
-
-	// Generate session ID for worker
-	workerSessionID, err := claude.GenerateSessionID()
-	if err != nil {
-		return fmt.Errorf("failed to generate worker session ID: %w", err)
-	}
-
-	// Get fork config from daemon to include in worker prompt
-	var forkConfig state.ForkConfig
-	configResp, err := client.Send(socket.Request{
-		Command: "get_repo_config",
-		Args: map[string]interface{}{
-			"name": repoName,
-		},
-	})
-	if err == nil && configResp.Success {
-		if configMap, ok := configResp.Data.(map[string]interface{}); ok {
-			if isFork, ok := configMap["is_fork"].(bool); ok && isFork {
-				forkConfig.IsFork = true
-				forkConfig.UpstreamURL, _ = configMap["upstream_url"].(string)
-				forkConfig.UpstreamOwner, _ = configMap["upstream_owner"].(string)
-				forkConfig.UpstreamRepo, _ = configMap["upstream_repo"].(string)
-			}
+	if branch, ok := flags["branch"]; ok {
+		if hasPushTo {
+			fmt.Printf("Creating worker '%s' in repo '%s' to iterate on branch '%s'\n", workerName, repoName, pushTo)
+		} else {
+			fmt.Printf("Creating worker '%s' in repo '%s' from branch '%s'\n", workerName, repoName, branch)
 		}
+	} else {
+		fmt.Printf("Creating worker '%s' in repo '%s'\n", workerName, repoName)
 	}
+	fmt.Printf("Task: %s\n", task)
 
-	// Write prompt file for worker (with push-to config and fork config if applicable)
-	workerConfig := WorkerConfig{
-		ForkConfig: forkConfig,
-	}
-	if hasPushTo {
-		workerConfig.PushToBranch = pushTo
-	}
-	workerPromptFile, err := c.writeWorkerPromptFile(repoPath, workerName, workerConfig)
-	if err != nil {
-		return fmt.Errorf("failed to write worker prompt: %w", err)
+	// The daemon creates the worktree, prompt, tmux window, and Claude, and
+	// rolls them back if any step fails
+	fmt.Println("Starting worker...")
+	createArgs := map[string]interface{}{
+		"repo":    repoName,
+		"name":    workerName,
+		"type":    "worker",
+		"task":    task,
+		"profile": profile,
 	}
-
-	// Copy hooks configuration if it exists
-	if err := hooks.CopyConfig(repoPath, wtPath); err != nil {
-		fmt.Printf("Warning: failed to copy hooks config: %v\n", err)
+	if branch, ok := flags["branch"]; ok {
+		createArgs["branch"] = branch
 	}
-
-	// Start Claude in worker window with initial task (skip in test mode)
-	var workerPID int
-	if os.Getenv("MULTICLAUDE_TEST_MODE") != "1" {
-		// Resolve claude binary
-		claudeBinary, err := c.getClaudeBinary()
-		if err != nil {
-			return fmt.Errorf("failed to resolve claude binary: %w", err)
-		}
-
-		fmt.Println("Starting Claude Code in worker window...")
-		initialMessage := fmt.Sprintf("Task: %s", task)
-		pid, err := c.startClaudeInTmux(claudeBinary, tmuxSession, workerName, wtPath, workerSessionID, workerPromptFile, repoName, initialMessage)
-		if err != nil {
-			return fmt.Errorf("failed to start worker Claude: %w", err)
-		}
-		workerPID = pid
-
-		// Set up output capture for worker
-		if err := c.setupOutputCapture(tmuxSession, workerName, repoName, workerName, "worker"); err != nil {
-			fmt.Printf("Warning: failed to setup output capture for worker: %v\n", err)
-		}
+	if hasPushTo {
+		createArgs["push_to"] = pushTo
 	}
-
-	// Register worker with daemon
-	resp, err = client.Send(socket.Request{
-		Command: "add_agent",
-		Args: map[string]interface{}{
-			"repo":          repoName,
-			"agent":         workerName,
-			"type":          "worker",
-			"worktree_path": wtPath,
-			"tmux_window":   workerName,
-			"task":          task,
-			"session_id":    workerSessionID,
-			"pid":           workerPID,
-		},
-	})
+	result, err := c.createAgent(createArgs)
 	if err != nil {
-		return fmt.Errorf("failed to register worker: %w", err)
-	}
-	if !resp.Success {
-		return fmt.Errorf("failed to register worker: %s", resp.Error)
+		return err
 	}
 
 	fmt.Println()
 	fmt.Println("✓ Worker created successfully!")
 	fmt.Printf("  Name: %s\n", workerName)
-	fmt.Printf("  Branch: %s\n", branchName)
-	fmt.Printf("  Worktree: %s\n", wtPath)
+	fmt.Printf("  Branch: %s\n", result.branch)
+	fmt.Printf("  Worktree: %s\n", result.worktreePath)
+	if result.model != "" {
+		fmt.Printf("  Model: %s\n", result.model)
+	}
 	if hasPushTo {
 		fmt.Printf("  Mode: Push to existing PR branch (%s)\n", pushTo)
 	}
-	fmt.Printf("\nAttach to worker: tmux select-window -t %s:%s\n", tmuxSession, workerName)
+	if result.headless {
+		fmt.Printf("\nRunning headless; follow its output with: multiclaude logs %s --follow\n", workerName)
+		return nil
+	}
+	fmt.Printf("\nAttach to worker: tmux select-window -t %s:%s\n", result.tmuxSession, workerName)
 	fmt.Printf("Or use: multiclaude attach %s\n", workerName)
 
 	return nil
@@ -2370,18 +2655,21 @@ func (c *CLI) listWorkers(args []string) error {
 
 	if len(workers) == 0 {
 		fmt.Printf("No workers in repository '%s'\n", repoName)
-		format.Dimmed("\nCreate a worker with: multiclaude worker create <task>")
+		if c.printPendingTasks(repoName) == 0 {
+			format.Dimmed("\nCreate a worker with: multiclaude worker create <task>")
+		}
 		return nil
 	}
 
 	format.Header("Workers in '%s' (%d):", repoName, len(workers))
 	fmt.Println()
 
-	table := format.NewColoredTable("NAME", "STATUS", "BRANCH", "MSGS", "TASK")
+	table := format.NewColoredTable("NAME", "STATUS", "ACTIVITY", "BRANCH", "MSGS", "TOKENS", "TASK")
 	for _, worker := range workers {
 		name, _ := worker["name"].(string)
 		task, _ := worker["task"].(string)
 		status, _ := worker["status"].(string)
+		activity, _ := worker["activity"].(string)
 		branch, _ := worker["branch"].(string)
 		msgsTotal := 0
 		if v, ok := worker["messages_total"].(float64); ok {
@@ -2395,12 +2683,6 @@ func (c *CLI) listWorkers(args []string) error {
 		// Format status with color
 		statusCell := formatAgentStatusCell(status)
 
-		// Format branch
-		branchCell := format.ColorCell(branch, format.Cyan)
-		if branch == "" {
-			branchCell = format.ColorCell("-", format.Dim)
-		}
-
 		// Format message count
 		msgStr := format.MessageBadge(msgsPending, msgsTotal)
 
@@ -2410,16 +2692,257 @@ func (c *CLI) listWorkers(args []string) error {
 		table.AddRow(
 			format.Cell(name),
 			statusCell,
-			branchCell,
+			formatActivityCell(activity),
+			formatBranchCell(branch, worker),
 			format.Cell(msgStr),
+			formatUsageCell(worker["usage"]),
 			format.Cell(truncTask),
 		)
 	}
 	table.Print()
 
+	c.printPendingTasks(repoName)
+
+	return nil
+}
+
+func (c *CLI) listQueue(args []string) error {
+	flags, _ := ParseFlags(args)
+
+	repoName, err := c.resolveRepo(flags)
+	if err != nil {
+		return errors.NotInRepo()
+	}
+
+	resp, err := c.sendDaemonRequest("list_worker_queue", map[string]interface{}{
+		"repo": repoName,
+	})
+	if err != nil {
+		return err
+	}
+
+	data, ok := resp.Data.(map[string]interface{})
+	if !ok {
+		return errors.New(errors.CategoryRuntime, "unexpected response format from daemon")
+	}
+
+	maxWorkers := 0
+	if v, ok := data["max_workers"].(float64); ok {
+		maxWorkers = int(v)
+	}
+	activeWorkers := 0
+	if v, ok := data["active_workers"].(float64); ok {
+		activeWorkers = int(v)
+	}
+	limit := "unlimited"
+	if maxWorkers > 0 {
+		limit = strconv.Itoa(maxWorkers)
+	}
+
+	tasks, _ := data["tasks"].([]interface{})
+	if len(tasks) == 0 {
+		fmt.Printf("No queued tasks in repository '%s' (%d workers running, limit: %s)\n", repoName, activeWorkers, limit)
+		if maxWorkers == 0 {
+			format.Dimmed("\nLimit concurrent workers with: multiclaude config %s --max-workers=<n>", repoName)
+		}
+		return nil
+	}
+
+	format.Header("Queued tasks in '%s' (%d):", repoName, len(tasks))
+	format.Dimmed("%d workers running, limit: %s", activeWorkers, limit)
+	fmt.Println()
+
+	table := format.NewColoredTable("#", "NAME", "QUEUED", "TASK")
+	for _, item := range tasks {
+		task, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		position, _ := task["position"].(float64)
+		name, _ := task["name"].(string)
+		description, _ := task["task"].(string)
+		queuedAt, _ := task["queued_at"].(string)
+
+		queuedCell := format.ColorCell("-", format.Dim)
+		if t, err := time.Parse(time.RFC3339, queuedAt); err == nil {
+			queuedCell = format.Cell(format.TimeAgo(t))
+		}
+
+		table.AddRow(
+			format.Cell(strconv.Itoa(int(position))),
+			format.Cell(name),
+			queuedCell,
+			format.Cell(format.Truncate(description, 50)),
+		)
+	}
+	table.Print()
+
 	return nil
 }
 
+func (c *CLI) removeQueuedTask(args []string) error {
+	flags, posArgs := ParseFlags(args)
+	if len(posArgs) < 1 {
+		return errors.InvalidUsage("usage: multiclaude queue rm <name> [--repo <repo>]")
+	}
+
+	repoName, err := c.resolveRepo(flags)
+	if err != nil {
+		return errors.NotInRepo()
+	}
+
+	if _, err := c.sendDaemonRequest("remove_queued_task", map[string]interface{}{
+		"repo": repoName,
+		"name": posArgs[0],
+	}); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Removed '%s' from the queue\n", posArgs[0])
+	return nil
+}
+
+func (c *CLI) promoteQueuedTask(args []string) error {
+	flags, posArgs := ParseFlags(args)
+	if len(posArgs) < 1 {
+		return errors.InvalidUsage("usage: multiclaude queue promote <name> [--repo <repo>]")
+	}
+
+	repoName, err := c.resolveRepo(flags)
+	if err != nil {
+		return errors.NotInRepo()
+	}
+
+	if _, err := c.sendDaemonRequest("promote_queued_task", map[string]interface{}{
+		"repo": repoName,
+		"name": posArgs[0],
+	}); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Moved '%s' to the front of the queue\n", posArgs[0])
+	return nil
+}
+
+// checkDuplicateTask asks the daemon for running, queued, and recently
+// finished tasks that resemble task, and fails listing them if there are any
+func (c *CLI) checkDuplicateTask(repoName, task string) error {
+	resp, err := c.sendDaemonRequest("find_similar_tasks", map[string]interface{}{
+		"repo": repoName,
+		"task": task,
+	})
+	if err != nil {
+		return err
+	}
+	matches, _ := resp.Data.([]interface{})
+	if len(matches) == 0 {
+		return nil
+	}
+
+	fmt.Println(format.Yellow.Sprint("Similar tasks already exist:"))
+	for _, raw := range matches {
+		match, _ := raw.(map[string]interface{})
+		name, _ := match["name"].(string)
+		status, _ := match["status"].(string)
+		score, _ := match["score"].(float64)
+		matchTask, _ := match["task"].(string)
+		fmt.Printf("  %s (%s, %d%% similar): %s\n", name, status, int(score*100), format.Truncate(matchTask, 80))
+	}
+	fmt.Println()
+	return errors.DuplicateTask(repoName)
+}
+
+// queuePendingWorker asks the daemon to spawn a worker once its dependencies have merged
+func (c *CLI) queuePendingWorker(repoName, workerName, task, after string, profile state.AgentProfile) error {
+	var dependsOn []string
+	for _, dep := range strings.Split(after, ",") {
+		if dep = strings.TrimSpace(dep); dep != "" {
+			dependsOn = append(dependsOn, dep)
+		}
+	}
+	if len(dependsOn) == 0 {
+		return errors.InvalidUsage("--after requires at least one worker name or PR number (e.g., --after happy-platypus,#42)")
+	}
+
+	_, err := c.sendDaemonRequest("add_pending_task", map[string]interface{}{
+		"repo":    repoName,
+		"name":    workerName,
+		"task":    task,
+		"after":   dependsOn,
+		"profile": profile,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Queued worker '%s' in repo '%s'\n", workerName, repoName)
+	fmt.Printf("Task: %s\n", task)
+	fmt.Printf("Waiting for: %s\n", strings.Join(dependsOn, ", "))
+	format.Dimmed("\nThe worker starts from the latest main once all dependencies have merged.")
+	format.Dimmed("Check progress with: multiclaude worker list")
+	return nil
+}
+
+// printPendingTasks prints tasks waiting on dependencies and returns how many were shown.
+// Errors are ignored so callers can show pending tasks as a best-effort extra section.
+func (c *CLI) printPendingTasks(repoName string) int {
+	resp, err := c.sendDaemonRequest("list_pending_tasks", map[string]interface{}{
+		"repo": repoName,
+	})
+	if err != nil {
+		return 0
+	}
+
+	tasks, ok := resp.Data.([]interface{})
+	if !ok || len(tasks) == 0 {
+		return 0
+	}
+
+	fmt.Println()
+	format.Header("Pending tasks (%d):", len(tasks))
+	fmt.Println()
+
+	table := format.NewColoredTable("NAME", "STATE", "AFTER", "TASK")
+	for _, item := range tasks {
+		task, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		name, _ := task["name"].(string)
+		description, _ := task["task"].(string)
+		taskState, _ := task["state"].(string)
+
+		stateCell := format.ColorCell(taskState, format.Yellow)
+		if taskState == "blocked" {
+			stateCell = format.ColorCell(taskState, format.Red)
+		}
+
+		var edges []string
+		deps, _ := task["depends_on"].([]interface{})
+		for _, d := range deps {
+			dep, ok := d.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			depName, _ := dep["name"].(string)
+			depState, _ := dep["state"].(string)
+			edges = append(edges, fmt.Sprintf("%s (%s)", depName, depState))
+		}
+
+		table.AddRow(
+			format.Cell(name),
+			stateCell,
+			format.Cell(strings.Join(edges, ", ")),
+			format.Cell(format.Truncate(description, 40)),
+		)
+	}
+	table.Print()
+
+	return len(tasks)
+}
+
 // listAgentDefinitions lists available agent definitions for a repository
 func (c *CLI) listAgentDefinitions(args []string) error {
 	flags, _ := ParseFlags(args)
@@ -2674,10 +3197,12 @@ func (c *CLI) showHistory(args []string) error {
 		name          string
 		summary       string
 		failureReason string
+		dependsOn     []string
+		messages      string
 	}
 	var detailsToShow []entryDetails
 
-	table := format.NewColoredTable("NAME", "STATUS", "PR", "COMPLETED", "TASK")
+	table := format.NewColoredTable("NAME", "STATUS", "PR", "COMPLETED", "TOKENS", "TASK")
 	displayedCount := 0
 	for _, item := range history {
 		// Stop once we've displayed enough
@@ -2698,9 +3223,33 @@ func (c *CLI) showHistory(args []string) error {
 		summary, _ := entry["summary"].(string)
 		failureReason, _ := entry["failure_reason"].(string)
 		storedStatus, _ := entry["status"].(string)
+		messagesArchive := ""
+		if showFull {
+			// Archived mailboxes are only listed in full output
+			messagesArchive, _ = entry["messages"].(string)
+		}
+		var dependsOn []string
+		if deps, ok := entry["depends_on"].([]interface{}); ok {
+			for _, dep := range deps {
+				if depName, ok := dep.(string); ok {
+					dependsOn = append(dependsOn, depName)
+				}
+			}
+		}
 
-		// Try to get PR status from GitHub if we have a branch
-		prStatus, prLink := c.getPRStatusForBranch(repoPath, branch, prURL)
+		// Prefer the status kept current by the daemon's PR tracking, falling
+		// back to asking GitHub for entries it hasn't resolved
+		var prStatus, prLink string
+		prNumber, _ := entry["pr_number"].(float64)
+		switch storedStatus {
+		case "open", "merged", "closed":
+			prStatus = storedStatus
+			if prNumber > 0 {
+				prLink = fmt.Sprintf("#%d", int(prNumber))
+			}
+		default:
+			prStatus, prLink = c.getPRStatusForBranch(repoPath, branch, prURL)
+		}
 
 		// Use stored status if it indicates failure
 		if storedStatus == "failed" {
@@ -2731,11 +3280,13 @@ func (c *CLI) showHistory(args []string) error {
 		displayedCount++
 
 		// Collect entries with summary or failure for detailed display
-		if summary != "" || failureReason != "" {
+		if summary != "" || failureReason != "" || len(dependsOn) > 0 || messagesArchive != "" {
 			detailsToShow = append(detailsToShow, entryDetails{
 				name:          name,
 				summary:       summary,
 				failureReason: failureReason,
+				dependsOn:     dependsOn,
+				messages:      messagesArchive,
 			})
 		}
 
@@ -2780,6 +3331,7 @@ func (c *CLI) showHistory(args []string) error {
 			statusCell,
 			prCell,
 			completedCell,
+			formatUsageCell(entry["usage"]),
 			format.Cell(displayTask),
 		)
 	}
@@ -2806,9 +3358,17 @@ func (c *CLI) showHistory(args []string) error {
 			if d.failureReason != "" {
 				format.Red.Printf("  Failure: %s\n", d.failureReason)
 			}
+			if len(d.dependsOn) > 0 {
+				format.Dimmed("  After: %s", strings.Join(d.dependsOn, ", "))
+			}
+			if d.messages != "" {
+				format.Dimmed("  Messages: %s", d.messages)
+			}
 		}
 	}
 
+	c.printPendingTasks(repoName)
+
 	return nil
 }
 
@@ -2863,6 +3423,72 @@ func (c *CLI) getPRStatusForBranch(repoPath, branch, existingPRURL string) (stat
 	}
 }
 
+// listPRs shows the pull requests the daemon is tracking for a repository
+func (c *CLI) listPRs(args []string) error {
+	flags, _ := ParseFlags(args)
+
+	repoName, err := c.resolveRepo(flags)
+	if err != nil {
+		return errors.NotInRepo()
+	}
+
+	resp, err := c.sendDaemonRequest("list_prs", map[string]interface{}{
+		"repo": repoName,
+	})
+	if err != nil {
+		return err
+	}
+
+	prs, ok := resp.Data.([]interface{})
+	if !ok {
+		return errors.New(errors.CategoryRuntime, "unexpected response format from daemon")
+	}
+
+	if len(prs) == 0 {
+		fmt.Printf("No tracked pull requests in repository '%s'\n", repoName)
+		format.Dimmed("\nPRs opened from worker branches are picked up by the daemon every few minutes")
+		return nil
+	}
+
+	format.Header("Pull requests in '%s' (%d):", repoName, len(prs))
+	fmt.Println()
+
+	table := format.NewColoredTable("PR", "AGENT", "STATE", "CI", "REVIEW", "MERGEABLE", "UPDATED")
+	for _, item := range prs {
+		pr, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		number, _ := pr["number"].(float64)
+		agent, _ := pr["agent"].(string)
+		prState, _ := pr["state"].(string)
+		ciStatus, _ := pr["ci_status"].(string)
+		review, _ := pr["review_decision"].(string)
+		mergeable, _ := pr["mergeable"].(string)
+
+		updated := "-"
+		if v, ok := pr["updated_at"].(string); ok {
+			if t, err := time.Parse(time.RFC3339, v); err == nil && !t.IsZero() {
+				updated = format.TimeAgo(t)
+			}
+		}
+
+		table.AddRow(
+			format.Cell(fmt.Sprintf("#%d", int(number))),
+			format.Cell(agent),
+			formatPRStateCell(prState),
+			formatCIStatusCell(ciStatus),
+			format.Cell(strings.ToLower(strings.ReplaceAll(review, "_", " "))),
+			format.Cell(strings.ToLower(mergeable)),
+			format.ColorCell(updated, format.Dim),
+		)
+	}
+	table.Print()
+
+	return nil
+}
+
 func (c *CLI) removeWorker(args []string) error {
 	flags, remainingArgs := ParseFlags(args)
 
@@ -2924,6 +3550,18 @@ func (c *CLI) removeWorker(args []string) error {
 	}
 
 	if workerInfo == nil {
+		// The name may refer to a task that is still waiting on its dependencies
+		pendingResp, err := client.Send(socket.Request{
+			Command: "remove_pending_task",
+			Args: map[string]interface{}{
+				"repo": repoName,
+				"name": workerName,
+			},
+		})
+		if err == nil && pendingResp.Success {
+			fmt.Println("✓ Pending task removed")
+			return nil
+		}
 		return errors.AgentNotFound("worker", workerName, repoName)
 	}
 
@@ -2952,13 +3590,15 @@ func (c *CLI) removeWorker(args []string) error {
 		return nil
 	}
 
-	// Kill tmux window
+	// Kill tmux window; the daemon stops a headless worker's run when it is unregistered
 	tmuxSession := sanitizeTmuxSessionName(repoName)
 	tmuxWindow := workerInfo["tmux_window"].(string)
-	fmt.Printf("Killing tmux window: %s\n", tmuxWindow)
-	cmd := exec.Command("tmux", "kill-window", "-t", fmt.Sprintf("%s:%s", tmuxSession, tmuxWindow))
-	if err := cmd.Run(); err != nil {
-		fmt.Printf("Warning: failed to kill tmux window: %v\n", err)
+	if tmuxWindow != "" {
+		fmt.Printf("Killing tmux window: %s\n", tmuxWindow)
+		cmd := exec.Command("tmux", "kill-window", "-t", fmt.Sprintf("%s:%s", tmuxSession, tmuxWindow))
+		if err := cmd.Run(); err != nil {
+			fmt.Printf("Warning: failed to kill tmux window: %v\n", err)
+		}
 	}
 
 	// Remove worktree
@@ -3120,33 +3760,12 @@ func (c *CLI) hibernateRepo(args []string) error {
 
 		fmt.Printf("Archiving changes from %s...\n", name)
 
-		// Create patch file with git diff
-		patchPath := filepath.Join(archiveDir, name+".patch")
-		cmd := exec.Command("git", "diff", "HEAD")
-		cmd.Dir = wtPath
-		output, err := cmd.Output()
-		if err != nil {
-			fmt.Printf("Warning: failed to create patch for %s: %v\n", name, err)
+		// Write the patch and the list of untracked files
+		if err := worktree.ArchiveChanges(wtPath, archiveDir, name); err != nil {
+			fmt.Printf("Warning: failed to archive changes for %s: %v\n", name, err)
 			continue
 		}
 
-		// Include untracked files in the patch
-		untrackedCmd := exec.Command("git", "ls-files", "--others", "--exclude-standard")
-		untrackedCmd.Dir = wtPath
-		untrackedOutput, _ := untrackedCmd.Output()
-
-		// Write patch file
-		if err := os.WriteFile(patchPath, output, 0644); err != nil {
-			fmt.Printf("Warning: failed to write patch for %s: %v\n", name, err)
-			continue
-		}
-
-		// Write untracked files list if any
-		if len(untrackedOutput) > 0 {
-			untrackedPath := filepath.Join(archiveDir, name+".untracked")
-			os.WriteFile(untrackedPath, untrackedOutput, 0644)
-		}
-
 		// Write metadata for this agent
 		metaPath := filepath.Join(archiveDir, name+".json")
 		meta := map[string]interface{}{
@@ -3234,184 +3853,67 @@ func (c *CLI) hibernateRepo(args []string) error {
 func (c *CLI) workspaceDefault(args []string) error {
 	// If no args, list workspaces
 	if len(args) == 0 {
-		return c.listWorkspaces(args)
-	}
-
-	// If first arg looks like a workspace name (not a flag), treat as connect
-	if !strings.HasPrefix(args[0], "-") {
-		return c.connectWorkspace(args)
-	}
-
-	// Otherwise list with flags
-	return c.listWorkspaces(args)
-}
-
-// addWorkspace creates a new workspace
-func (c *CLI) addWorkspace(args []string) error {
-	flags, posArgs := ParseFlags(args)
-
-	if len(posArgs) < 1 {
-		return errors.InvalidUsage("usage: multiclaude workspace add <name> [--branch <branch>]")
-	}
-
-	workspaceName := posArgs[0]
-
-	// Validate workspace name (same restrictions as branch names)
-	if err := validateWorkspaceName(workspaceName); err != nil {
-		return err
-	}
-
-	// Determine repository using standard resolution chain
-	repoName, err := c.resolveRepo(flags)
-	if err != nil {
-		return err
-	}
-
-	// Determine branch to start from
-	startBranch := "HEAD" // Default to current branch/HEAD
-	if branch, ok := flags["branch"]; ok {
-		startBranch = branch
-		fmt.Printf("Creating workspace '%s' in repo '%s' from branch '%s'\n", workspaceName, repoName, branch)
-	} else {
-		fmt.Printf("Creating workspace '%s' in repo '%s'\n", workspaceName, repoName)
-	}
-
-	// Check if workspace already exists
-	client := socket.NewClient(c.paths.DaemonSock)
-	resp, err := client.Send(socket.Request{
-		Command: "list_agents",
-		Args: map[string]interface{}{
-			"repo": repoName,
-		},
-	})
-	if err != nil {
-		return errors.DaemonCommunicationFailed("checking existing workspaces", err)
-	}
-	if !resp.Success {
-		return errors.Wrap(errors.CategoryRuntime, "failed to check existing workspaces", fmt.Errorf("%s", resp.Error))
-	}
-
-	agents, _ := resp.Data.([]interface{})
-	for _, agent := range agents {
-		if agentMap, ok := agent.(map[string]interface{}); ok {
-			agentType, _ := agentMap["type"].(string)
-			name, _ := agentMap["name"].(string)
-			if agentType == "workspace" && name == workspaceName {
-				return fmt.Errorf("workspace '%s' already exists in repo '%s'", workspaceName, repoName)
-			}
-		}
-	}
-
-	// Get repository path
-	repoPath := c.paths.RepoDir(repoName)
-
-	// Create worktree
-	wt := worktree.NewManager(repoPath)
-	wtPath := c.paths.AgentWorktree(repoName, workspaceName)
-	branchName := fmt.Sprintf("workspace/%s", workspaceName)
-
-	// Check if worktree path already exists (from previous incomplete workspace add)
-	if _, err := os.Stat(wtPath); err == nil {
-		fmt.Printf("Warning: Worktree path '%s' already exists\n", wtPath)
-		fmt.Printf("This may be from a previous incomplete workspace creation.\n")
-		fmt.Printf("Auto-repairing: removing existing worktree...\n")
-		if err := wt.Remove(wtPath, true); err != nil {
-			return fmt.Errorf("failed to clean up existing worktree: %w\nPlease manually remove it with: git worktree remove %s", err, wtPath)
-		}
-		fmt.Println("✓ Cleaned up stale worktree")
+		return c.listWorkspaces(args)
 	}
 
-	fmt.Printf("Creating worktree at: %s\n", wtPath)
-	if err := wt.CreateNewBranch(wtPath, branchName, startBranch); err != nil {
-		return errors.WorktreeCreationFailed(err)
+	// If first arg looks like a workspace name (not a flag), treat as connect
+	if !strings.HasPrefix(args[0], "-") {
+		return c.connectWorkspace(args)
 	}
 
-	// Get tmux session name
-	tmuxSession := sanitizeTmuxSessionName(repoName)
+	// Otherwise list with flags
+	return c.listWorkspaces(args)
+}
 
-	// Check if tmux window already exists (stale window from previous incomplete workspace add)
-	tmuxClient := tmux.NewClient()
-	if exists, err := tmuxClient.HasWindow(context.Background(), tmuxSession, workspaceName); err == nil && exists {
-		fmt.Printf("Warning: Tmux window '%s' already exists in session '%s'\n", workspaceName, tmuxSession)
-		fmt.Printf("This may be from a previous incomplete workspace creation.\n")
-		fmt.Printf("Auto-repairing: killing existing tmux window...\n")
-		if err := tmuxClient.KillWindow(context.Background(), tmuxSession, workspaceName); err != nil {
-			return fmt.Errorf("failed to clean up existing tmux window: %w\nPlease manually kill it with: tmux kill-window -t %s:%s", err, tmuxSession, workspaceName)
-		}
-		fmt.Println("✓ Cleaned up stale tmux window")
-	}
+// addWorkspace creates a new workspace
+func (c *CLI) addWorkspace(args []string) error {
+	flags, posArgs := ParseFlags(args)
 
-	// Create tmux window for workspace (detached so it doesn't switch focus)
-	fmt.Printf("Creating tmux window: %s\n", workspaceName)
-	cmd := exec.Command("tmux", "new-window", "-d", "-t", tmuxSession, "-n", workspaceName, "-c", wtPath)
-	if err := cmd.Run(); err != nil {
-		return errors.TmuxOperationFailed("create window", err)
+	if len(posArgs) < 1 {
+		return errors.InvalidUsage("usage: multiclaude workspace add <name> [--branch <branch>]")
 	}
 
-	// Generate session ID for workspace
-	workspaceSessionID, err := claude.GenerateSessionID()
-	if err != nil {
-		return fmt.Errorf("failed to generate workspace session ID: %w", err)
+	workspaceName := posArgs[0]
+
+	// Validate workspace name (same restrictions as branch names)
+	if err := validateWorkspaceName(workspaceName); err != nil {
+		return err
 	}
 
-	// Write prompt file for workspace
-	workspacePromptFile, err := c.writePromptFile(repoPath, state.AgentTypeWorkspace, workspaceName)
+	// Determine repository using standard resolution chain
+	repoName, err := c.resolveRepo(flags)
 	if err != nil {
-		return fmt.Errorf("failed to write workspace prompt: %w", err)
+		return err
 	}
 
-	// Copy hooks configuration if it exists
-	if err := hooks.CopyConfig(repoPath, wtPath); err != nil {
-		fmt.Printf("Warning: failed to copy hooks config: %v\n", err)
+	// Announce the branch the workspace starts from (HEAD by default)
+	if branch, ok := flags["branch"]; ok {
+		fmt.Printf("Creating workspace '%s' in repo '%s' from branch '%s'\n", workspaceName, repoName, branch)
+	} else {
+		fmt.Printf("Creating workspace '%s' in repo '%s'\n", workspaceName, repoName)
 	}
 
-	// Start Claude in workspace window (skip in test mode)
-	var workspacePID int
-	if os.Getenv("MULTICLAUDE_TEST_MODE") != "1" {
-		// Resolve claude binary
-		claudeBinary, err := c.getClaudeBinary()
-		if err != nil {
-			return fmt.Errorf("failed to resolve claude binary: %w", err)
-		}
-
-		fmt.Println("Starting Claude Code in workspace window...")
-		pid, err := c.startClaudeInTmux(claudeBinary, tmuxSession, workspaceName, wtPath, workspaceSessionID, workspacePromptFile, repoName, "")
-		if err != nil {
-			return fmt.Errorf("failed to start workspace Claude: %w", err)
-		}
-		workspacePID = pid
-
-		// Set up output capture for workspace
-		if err := c.setupOutputCapture(tmuxSession, workspaceName, repoName, workspaceName, "workspace"); err != nil {
-			fmt.Printf("Warning: failed to setup output capture for workspace: %v\n", err)
-		}
+	// The daemon creates the worktree, prompt, tmux window, and Claude, and
+	// rolls them back if any step fails
+	fmt.Println("Starting workspace...")
+	createArgs := map[string]interface{}{
+		"repo": repoName,
+		"name": workspaceName,
+		"type": "workspace",
 	}
-
-	// Register workspace with daemon
-	resp, err = client.Send(socket.Request{
-		Command: "add_agent",
-		Args: map[string]interface{}{
-			"repo":          repoName,
-			"agent":         workspaceName,
-			"type":          "workspace",
-			"worktree_path": wtPath,
-			"tmux_window":   workspaceName,
-			"session_id":    workspaceSessionID,
-			"pid":           workspacePID,
-		},
-	})
-	if err != nil {
-		return fmt.Errorf("failed to register workspace: %w", err)
+	if branch, ok := flags["branch"]; ok {
+		createArgs["branch"] = branch
 	}
-	if !resp.Success {
-		return fmt.Errorf("failed to register workspace: %s", resp.Error)
+	result, err := c.createAgent(createArgs)
+	if err != nil {
+		return err
 	}
 
 	fmt.Println()
 	fmt.Println("✓ Workspace created successfully!")
 	fmt.Printf("  Name: %s\n", workspaceName)
-	fmt.Printf("  Branch: %s\n", branchName)
-	fmt.Printf("  Worktree: %s\n", wtPath)
+	fmt.Printf("  Branch: %s\n", result.branch)
+	fmt.Printf("  Worktree: %s\n", result.worktreePath)
 	fmt.Printf("\nConnect to workspace: multiclaude workspace connect %s\n", workspaceName)
 	fmt.Printf("Or use: multiclaude attach %s\n", workspaceName)
 
@@ -3607,15 +4109,9 @@ func (c *CLI) listWorkspaces(args []string) error {
 		// Format status with color
 		statusCell := formatAgentStatusCell(status)
 
-		// Format branch
-		branchCell := format.ColorCell(branch, format.Cyan)
-		if branch == "" {
-			branchCell = format.ColorCell("-", format.Dim)
-		}
-
 		table.AddRow(
 			format.Cell(name),
-			branchCell,
+			formatBranchCell(branch, ws),
 			statusCell,
 		)
 	}
@@ -3777,8 +4273,12 @@ func (c *CLI) getReposList() []string {
 }
 
 func (c *CLI) sendMessage(args []string) error {
+	args, priority, err := parseMessagePriority(args)
+	if err != nil {
+		return err
+	}
 	if len(args) < 2 {
-		return errors.InvalidUsage("usage: multiclaude agent send-message <to> <message>")
+		return errors.InvalidUsage("usage: multiclaude agent send-message <to|@group> <message> [--urgent|--priority <low|normal|urgent>]")
 	}
 
 	to := args[0]
@@ -3790,25 +4290,260 @@ func (c *CLI) sendMessage(args []string) error {
 		return err
 	}
 
+	// Group addresses are expanded by the daemon against the running agents
+	if messages.IsGroupAddress(to) {
+		return c.broadcastMessage(repoName, agentName, to, body, priority)
+	}
+
 	// Create message manager
 	msgMgr := messages.NewManager(c.paths.MessagesDir)
 
 	// Send message
-	msg, err := msgMgr.Send(repoName, agentName, to, body)
+	msg, err := msgMgr.SendWithOptions(repoName, agentName, to, body, messages.SendOptions{Priority: priority})
 	if err != nil {
 		return fmt.Errorf("failed to send message: %w", err)
 	}
 
-	// Trigger immediate routing (best-effort, polling is fallback)
-	client := socket.NewClient(c.paths.DaemonSock)
-	_, _ = client.Send(socket.Request{Command: "route_messages"})
-	// Ignore errors - 2-minute polling fallback will catch it
+	c.requestMessageRouting(msg)
 
 	fmt.Printf("Message sent to %s (ID: %s)\n", to, msg.ID)
 	return nil
 }
 
+// broadcastMessage sends a message to a group address through the daemon,
+// which writes one copy per recipient
+func (c *CLI) broadcastMessage(repoName, from, to, body string, priority messages.Priority) error {
+	client := socket.NewClient(c.paths.DaemonSock)
+	resp, err := client.Send(socket.Request{
+		Command: "send_message",
+		Args: map[string]interface{}{
+			"repo":     repoName,
+			"from":     from,
+			"to":       to,
+			"body":     body,
+			"priority": string(priority),
+		},
+	})
+	if err != nil {
+		return errors.DaemonNotRunning()
+	}
+	if !resp.Success {
+		return fmt.Errorf("failed to send message: %s", resp.Error)
+	}
+
+	data, _ := resp.Data.(map[string]interface{})
+	broadcastID, _ := data["broadcast_id"].(string)
+	rawRecipients, _ := data["recipients"].([]interface{})
+	recipients := make([]string, 0, len(rawRecipients))
+	for _, r := range rawRecipients {
+		if name, ok := r.(string); ok {
+			recipients = append(recipients, name)
+		}
+	}
+
+	fmt.Printf("Message sent to %s: %s (broadcast: %s)\n", to, strings.Join(recipients, ", "), broadcastID)
+	fmt.Printf("Track delivery: multiclaude message status %s\n", broadcastID)
+	return nil
+}
+
+// messageStatus shows the delivery status of each copy of a broadcast
+func (c *CLI) messageStatus(args []string) error {
+	if len(args) < 1 {
+		return errors.InvalidUsage("usage: multiclaude message status <broadcast-id>")
+	}
+
+	repoName, _, err := c.inferAgentContext()
+	if err != nil {
+		return err
+	}
+
+	msgMgr := messages.NewManager(c.paths.MessagesDir)
+	copies, err := msgMgr.BroadcastStatus(repoName, args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read broadcast: %w", err)
+	}
+	if len(copies) == 0 {
+		return errors.New(errors.CategoryNotFound, fmt.Sprintf("no broadcast %s in %s", args[0], repoName))
+	}
+
+	counts := make(map[messages.Status]int)
+	fmt.Printf("Broadcast %s to %s from %s (%d recipient(s)):\n", args[0], copies[0].Group, copies[0].From, len(copies))
+	for _, msg := range copies {
+		counts[msg.Status]++
+		status := string(msg.Status)
+		switch {
+		case msg.Status == messages.StatusAcked && msg.AckedAt != nil:
+			status = fmt.Sprintf("acked (%s)", formatTime(*msg.AckedAt))
+		case msg.Status == messages.StatusPending:
+			status = format.Yellow.Sprint(status)
+		}
+		fmt.Printf("  %-20s %-10s [%s]\n", msg.To, status, msg.ID)
+	}
+
+	var summary []string
+	for _, status := range []messages.Status{messages.StatusPending, messages.StatusDelivered, messages.StatusRead, messages.StatusAcked} {
+		if counts[status] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[status], status))
+		}
+	}
+	fmt.Printf("\n%s\n", strings.Join(summary, ", "))
+	return nil
+}
+
+// gcMessages asks the daemon to enforce message retention now. The daemon
+// also does this every hour.
+func (c *CLI) gcMessages(args []string) error {
+	flags, _ := ParseFlags(args)
+	dryRun := flags["dry-run"] == "true"
+
+	reqArgs := map[string]interface{}{"dry_run": dryRun}
+	if repoName, ok := flags["repo"]; ok {
+		reqArgs["repo"] = repoName
+	}
+
+	client := socket.NewClient(c.paths.DaemonSock)
+	resp, err := client.Send(socket.Request{Command: "gc_messages", Args: reqArgs})
+	if err != nil {
+		return errors.DaemonNotRunning()
+	}
+	if !resp.Success {
+		return fmt.Errorf("failed to collect messages: %s", resp.Error)
+	}
+
+	data, _ := resp.Data.(map[string]interface{})
+	repos, _ := data["repos"].([]interface{})
+	removeVerb, archiveVerb := "removed", "archived"
+	if dryRun {
+		removeVerb, archiveVerb = "would remove", "would archive"
+	}
+
+	changed := false
+	for _, raw := range repos {
+		repo, _ := raw.(map[string]interface{})
+		name, _ := repo["repo"].(string)
+		expired := sortedCounts(repo["expired"])
+		archived := sortedCounts(repo["archived"])
+		if len(expired) == 0 && len(archived) == 0 {
+			continue
+		}
+		changed = true
+
+		maxAge, _ := repo["max_age_days"].(float64)
+		maxCount, _ := repo["max_per_agent"].(float64)
+		fmt.Printf("%s (keeping %d days, newest %d per agent):\n", name, int(maxAge), int(maxCount))
+		for _, e := range expired {
+			fmt.Printf("  %s: %s %d delivered message(s)\n", e.name, removeVerb, e.count)
+		}
+		if len(archived) > 0 {
+			archiveDir, _ := repo["archive_dir"].(string)
+			for _, a := range archived {
+				fmt.Printf("  %s: %s mailbox with %d message(s) (agent no longer exists)\n", a.name, archiveVerb, a.count)
+			}
+			fmt.Printf("  Archive: %s\n", archiveDir)
+		}
+	}
+
+	if !changed {
+		fmt.Println("Nothing to collect")
+	} else if dryRun {
+		fmt.Println("\nDry run: nothing was changed. Run without --dry-run to apply.")
+	}
+	return nil
+}
+
+// nameCount is a count attached to an agent name
+type nameCount struct {
+	name  string
+	count int
+}
+
+// sortedCounts converts a decoded JSON object of counts into a list sorted by name
+func sortedCounts(raw interface{}) []nameCount {
+	m, _ := raw.(map[string]interface{})
+	counts := make([]nameCount, 0, len(m))
+	for name, v := range m {
+		if n, ok := v.(float64); ok {
+			counts = append(counts, nameCount{name: name, count: int(n)})
+		}
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		return counts[i].name < counts[j].name
+	})
+	return counts
+}
+
+// replyMessage answers a message in the current agent's mailbox. The reply
+// goes to the original sender in the same thread.
+func (c *CLI) replyMessage(args []string) error {
+	args, priority, err := parseMessagePriority(args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 2 {
+		return errors.InvalidUsage("usage: multiclaude message reply <message-id> <message> [--urgent|--priority <low|normal|urgent>]")
+	}
+
+	repoName, agentName, err := c.inferAgentContext()
+	if err != nil {
+		return err
+	}
+
+	msgMgr := messages.NewManager(c.paths.MessagesDir)
+	msg, err := msgMgr.Reply(repoName, agentName, args[0], strings.Join(args[1:], " "), priority)
+	if err != nil {
+		return fmt.Errorf("failed to reply to message: %w", err)
+	}
+
+	c.requestMessageRouting(msg)
+
+	fmt.Printf("Reply sent to %s (ID: %s, thread: %s)\n", msg.To, msg.ID, msg.ThreadID)
+	return nil
+}
+
+// requestMessageRouting asks the daemon to deliver a message just written.
+// Urgent messages skip the router's debounce. Best-effort: the daemon's
+// fallback poll delivers the message if this fails.
+func (c *CLI) requestMessageRouting(msg *messages.Message) {
+	client := socket.NewClient(c.paths.DaemonSock)
+	_, _ = client.Send(socket.Request{
+		Command: "route_messages",
+		Args:    map[string]interface{}{"urgent": msg.Priority == messages.PriorityUrgent},
+	})
+}
+
+// parseMessagePriority removes --urgent and --priority from message
+// arguments. Other arguments are left alone, since message bodies are free
+// text and may contain dashes.
+func parseMessagePriority(args []string) ([]string, messages.Priority, error) {
+	var rest []string
+	priority := messages.PriorityNormal
+	for i := 0; i < len(args); i++ {
+		value, isPriority := "", false
+		switch {
+		case args[i] == "--urgent":
+			value, isPriority = string(messages.PriorityUrgent), true
+		case args[i] == "--priority" && i+1 < len(args):
+			value, isPriority = args[i+1], true
+			i++
+		case strings.HasPrefix(args[i], "--priority="):
+			value, isPriority = strings.TrimPrefix(args[i], "--priority="), true
+		}
+		if !isPriority {
+			rest = append(rest, args[i])
+			continue
+		}
+		p, err := messages.ParsePriority(value)
+		if err != nil {
+			return nil, "", errors.InvalidArgument("priority", value, "low, normal, or urgent")
+		}
+		priority = p
+	}
+	return rest, priority, nil
+}
+
 func (c *CLI) listMessages(args []string) error {
+	flags, _ := ParseFlags(args)
+
 	// Determine current agent and repo
 	repoName, agentName, err := c.inferAgentContext()
 	if err != nil {
@@ -3817,6 +4552,10 @@ func (c *CLI) listMessages(args []string) error {
 
 	msgMgr := messages.NewManager(c.paths.MessagesDir)
 
+	if threadID, ok := flags["thread"]; ok {
+		return c.listThread(msgMgr, repoName, agentName, threadID)
+	}
+
 	// List messages
 	msgs, err := msgMgr.List(repoName, agentName)
 	if err != nil {
@@ -3834,14 +4573,56 @@ func (c *CLI) listMessages(args []string) error {
 		if msg.Status == messages.StatusAcked && msg.AckedAt != nil {
 			status = messages.Status(fmt.Sprintf("acked (%s)", formatTime(*msg.AckedAt)))
 		}
+		if msg.Priority == messages.PriorityUrgent {
+			status = messages.Status(format.Red.Sprintf("%s, urgent", status))
+		}
+		body := truncateString(msg.Body, 60)
+		if msg.ReplyTo != "" {
+			body = fmt.Sprintf("re %s: %s", msg.ReplyTo, body)
+		} else if msg.Group != "" {
+			body = fmt.Sprintf("to %s: %s", msg.Group, body)
+		}
 		fmt.Printf("  [%s] %s - From: %s - %s - %s\n",
 			msg.ID,
 			formatTime(msg.Timestamp),
 			msg.From,
 			status,
-			truncateString(msg.Body, 60))
+			body)
+	}
+
+	return nil
+}
+
+// listThread shows every message in a thread, across all mailboxes in the
+// repository. The thread can be named by any message in the agent's mailbox.
+func (c *CLI) listThread(msgMgr *messages.Manager, repoName, agentName, id string) error {
+	if id == "" || id == "true" {
+		return errors.InvalidUsage("usage: multiclaude message list --thread <message-id>")
+	}
+	threadID := id
+	if msg, err := msgMgr.Get(repoName, agentName, id); err == nil {
+		threadID = msg.Thread()
+	}
+
+	thread, err := msgMgr.Thread(repoName, threadID)
+	if err != nil {
+		return fmt.Errorf("failed to list thread: %w", err)
+	}
+	if len(thread) == 0 {
+		return errors.New(errors.CategoryNotFound, fmt.Sprintf("no messages in thread %s", threadID))
 	}
 
+	fmt.Printf("Thread %s (%d message(s)):\n", threadID, len(thread))
+	for _, msg := range thread {
+		marker := ""
+		if msg.Priority == messages.PriorityUrgent {
+			marker = format.Red.Sprint(" [urgent]")
+		}
+		fmt.Printf("\n  [%s] %s - %s → %s - %s%s\n", msg.ID, formatTime(msg.Timestamp), msg.From, msg.To, msg.Status, marker)
+		for _, line := range strings.Split(msg.Body, "\n") {
+			fmt.Printf("    %s\n", line)
+		}
+	}
 	return nil
 }
 
@@ -3882,6 +4663,16 @@ func (c *CLI) readMessage(args []string) error {
 	if msg.AckedAt != nil {
 		fmt.Printf("Acked: %s\n", msg.AckedAt.Format(time.RFC3339))
 	}
+	if msg.Priority != "" && msg.Priority != messages.PriorityNormal {
+		fmt.Printf("Priority: %s\n", msg.Priority)
+	}
+	if msg.BroadcastID != "" {
+		fmt.Printf("Broadcast: %s to %s\n", msg.BroadcastID, msg.Group)
+	}
+	if msg.ReplyTo != "" {
+		fmt.Printf("In reply to: %s\n", msg.ReplyTo)
+		fmt.Printf("Thread: %s (multiclaude message list --thread %s)\n", msg.Thread(), msg.Thread())
+	}
 	fmt.Println()
 	fmt.Println(msg.Body)
 
@@ -4300,6 +5091,79 @@ func (c *CLI) restartAgentCmd(args []string) error {
 	return nil
 }
 
+// showAgentPrompt prints the prompt an agent's session was started with. With
+// --diff it prints how the prompt the agent would get now, from the
+// repository's current definitions, differs from it.
+func (c *CLI) showAgentPrompt(args []string) error {
+	flags, remaining := ParseFlags(args)
+	if len(remaining) < 1 {
+		return errors.InvalidUsage("usage: multiclaude agent prompt <name> [--repo <repo>] [--diff]")
+	}
+	agentName := remaining[0]
+
+	repoName := flags["repo"]
+	if repoName == "" {
+		inferred, err := c.inferRepoFromCwd()
+		if err != nil {
+			return errors.InvalidUsage("could not determine repository - use --repo flag or run from within a multiclaude worktree")
+		}
+		repoName = inferred
+	}
+
+	client := socket.NewClient(c.paths.DaemonSock)
+	resp, err := client.Send(socket.Request{
+		Command: "agent_prompt",
+		Args: map[string]interface{}{
+			"repo":  repoName,
+			"agent": agentName,
+		},
+	})
+	if err != nil {
+		return errors.DaemonCommunicationFailed("getting agent prompt", err)
+	}
+	if !resp.Success {
+		return errors.Wrap(errors.CategoryRuntime, "failed to get agent prompt", fmt.Errorf("%s", resp.Error))
+	}
+
+	data, _ := resp.Data.(map[string]interface{})
+	launched, _ := data["prompt"].(string)
+	current, _ := data["current"].(string)
+	currentErr, _ := data["current_error"].(string)
+	changed, _ := data["changed"].(bool)
+	version := 0
+	if v, ok := data["version"].(float64); ok {
+		version = int(v)
+	}
+
+	if flags["diff"] != "true" {
+		fmt.Print(launched)
+		if !strings.HasSuffix(launched, "\n") {
+			fmt.Println()
+		}
+		// Notes go to stderr so the prompt can be piped
+		if changed {
+			fmt.Fprintf(os.Stderr, "\nNote: the definitions of '%s' changed since its session started (prompt v%d).\nSee what changed with: multiclaude agent prompt %s --repo %s --diff\n", agentName, version, agentName, repoName)
+		}
+		return nil
+	}
+
+	if currentErr != "" {
+		return errors.Wrap(errors.CategoryRuntime, "cannot diff the prompt of '"+agentName+"'", fmt.Errorf("%s", currentErr))
+	}
+	if !changed {
+		fmt.Printf("The prompt of '%s' is unchanged since its session started (v%d)\n", agentName, version)
+		return nil
+	}
+
+	diff, err := prompts.Diff(fmt.Sprintf("v%d.md", version), launched, "current.md", current)
+	if err != nil {
+		return errors.Wrap(errors.CategoryRuntime, "failed to diff prompts", err)
+	}
+	fmt.Print(diff)
+	fmt.Printf("\n'%s' keeps prompt v%d across restarts; agents created from now on get the current prompt.\n", agentName, version)
+	return nil
+}
+
 func (c *CLI) reviewPR(args []string) error {
 	if len(args) < 1 {
 		return errors.InvalidUsage("usage: multiclaude review <pr-url>")
@@ -4352,111 +5216,32 @@ func (c *CLI) reviewPR(args []string) error {
 	// Generate review agent name
 	reviewerName := fmt.Sprintf("review-%s", prNumber)
 
-	fmt.Printf("Creating review agent '%s' in repo '%s'\n", reviewerName, repoName)
-
-	// Get repository path
-	repoPath := c.paths.RepoDir(repoName)
-
-	// Fetch the PR using GitHub's PR refs - this works for both same-repo and fork PRs
-	// The refs/pull/<number>/head ref always exists and points to the PR's head commit
-	fmt.Printf("Fetching PR #%s...\n", prNumber)
-	prRef := fmt.Sprintf("refs/pull/%s/head", prNumber)
-	localRef := fmt.Sprintf("refs/multiclaude/pr-%s", prNumber)
-	cmd := exec.Command("git", "fetch", "origin", fmt.Sprintf("%s:%s", prRef, localRef))
-	cmd.Dir = repoPath
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return errors.Wrap(errors.CategoryRuntime, fmt.Sprintf("failed to fetch PR #%s: %s", prNumber, strings.TrimSpace(string(output))), err).
-			WithSuggestion("ensure the PR exists and you have access to the repository")
-	}
-
-	// Create worktree for review
-	wt := worktree.NewManager(repoPath)
-	wtPath := c.paths.AgentWorktree(repoName, reviewerName)
-	reviewBranch := fmt.Sprintf("review/%s", reviewerName)
-
-	fmt.Printf("Creating worktree at: %s\n", wtPath)
-	if err := wt.CreateNewBranch(wtPath, reviewBranch, localRef); err != nil {
-		return fmt.Errorf("failed to create worktree: %w", err)
-	}
-
-	// Get tmux session name
-	tmuxSession := sanitizeTmuxSessionName(repoName)
-
-	// Create tmux window for reviewer (detached so it doesn't switch focus)
-	fmt.Printf("Creating tmux window: %s\n", reviewerName)
-	cmd = exec.Command("tmux", "new-window", "-d", "-t", tmuxSession, "-n", reviewerName, "-c", wtPath)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to create tmux window: %w", err)
-	}
-
-	// Generate session ID for reviewer
-	reviewerSessionID, err := claude.GenerateSessionID()
-	if err != nil {
-		return fmt.Errorf("failed to generate reviewer session ID: %w", err)
-	}
-
-	// Write prompt file for reviewer
-	reviewerPromptFile, err := c.writePromptFile(repoPath, state.AgentTypeReview, reviewerName)
-	if err != nil {
-		return fmt.Errorf("failed to write reviewer prompt: %w", err)
-	}
-
-	// Copy hooks configuration if it exists
-	if err := hooks.CopyConfig(repoPath, wtPath); err != nil {
-		fmt.Printf("Warning: failed to copy hooks config: %v\n", err)
-	}
-
-	// Start Claude in reviewer window with initial task (skip in test mode)
-	var reviewerPID int
-	if os.Getenv("MULTICLAUDE_TEST_MODE") != "1" {
-		// Resolve claude binary
-		claudeBinary, err := c.getClaudeBinary()
-		if err != nil {
-			return fmt.Errorf("failed to resolve claude binary: %w", err)
-		}
-
-		fmt.Println("Starting Claude Code in reviewer window...")
-		initialMessage := fmt.Sprintf("Review PR #%s: https://github.com/%s/%s/pull/%s", prNumber, parts[1], parts[2], prNumber)
-		pid, err := c.startClaudeInTmux(claudeBinary, tmuxSession, reviewerName, wtPath, reviewerSessionID, reviewerPromptFile, repoName, initialMessage)
-		if err != nil {
-			return fmt.Errorf("failed to start reviewer Claude: %w", err)
-		}
-		reviewerPID = pid
-
-		// Set up output capture for reviewer
-		if err := c.setupOutputCapture(tmuxSession, reviewerName, repoName, reviewerName, "review"); err != nil {
-			fmt.Printf("Warning: failed to setup output capture for reviewer: %v\n", err)
-		}
-	}
+	fmt.Printf("Creating review agent '%s' in repo '%s'\n", reviewerName, repoName)
 
-	// Register reviewer with daemon
-	client := socket.NewClient(c.paths.DaemonSock)
-	resp, err := client.Send(socket.Request{
-		Command: "add_agent",
-		Args: map[string]interface{}{
-			"repo":          repoName,
-			"agent":         reviewerName,
-			"type":          "review",
-			"worktree_path": wtPath,
-			"tmux_window":   reviewerName,
-			"task":          fmt.Sprintf("Review PR #%s", prNumber),
-			"session_id":    reviewerSessionID,
-			"pid":           reviewerPID,
-		},
+	// The daemon fetches the PR and creates the worktree, prompt, tmux window,
+	// and Claude, and rolls them back if any step fails
+	fmt.Println("Starting reviewer...")
+	result, err := c.createAgent(map[string]interface{}{
+		"repo":   repoName,
+		"name":   reviewerName,
+		"type":   "review",
+		"pr":     prNumber,
+		"pr_url": fmt.Sprintf("https://github.com/%s/%s/pull/%s", parts[1], parts[2], prNumber),
 	})
 	if err != nil {
-		return fmt.Errorf("failed to register reviewer: %w", err)
-	}
-	if !resp.Success {
-		return fmt.Errorf("failed to register reviewer: %s", resp.Error)
+		return err
 	}
 
 	fmt.Println()
 	fmt.Println("✓ Review agent created successfully!")
 	fmt.Printf("  Name: %s\n", reviewerName)
-	fmt.Printf("  Branch: %s\n", reviewBranch)
-	fmt.Printf("  Worktree: %s\n", wtPath)
-	fmt.Printf("\nAttach to reviewer: tmux select-window -t %s:%s\n", tmuxSession, reviewerName)
+	fmt.Printf("  Branch: %s\n", result.branch)
+	fmt.Printf("  Worktree: %s\n", result.worktreePath)
+	if result.headless {
+		fmt.Printf("\nRunning headless; follow its output with: multiclaude logs %s --follow\n", reviewerName)
+		return nil
+	}
+	fmt.Printf("\nAttach to reviewer: tmux select-window -t %s:%s\n", result.tmuxSession, reviewerName)
 	fmt.Printf("Or use: multiclaude attach %s\n", reviewerName)
 
 	return nil
@@ -4736,6 +5521,64 @@ func parseDuration(s string) (time.Duration, error) {
 	}
 }
 
+// parseTokenCount parses a token count like "500000", "500k", or "2M"
+func parseTokenCount(s string) (int64, error) {
+	multiplier := 1.0
+	switch {
+	case strings.HasSuffix(s, "k") || strings.HasSuffix(s, "K"):
+		multiplier, s = 1e3, s[:len(s)-1]
+	case strings.HasSuffix(s, "m") || strings.HasSuffix(s, "M"):
+		multiplier, s = 1e6, s[:len(s)-1]
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid token count %q", s)
+	}
+	return int64(value * multiplier), nil
+}
+
+// parseTokenBudget parses a daily budget of the form "<warn>/<cap>". A single
+// value sets only the cap, an empty side or 0 disables that limit, and "off"
+// disables both.
+func parseTokenBudget(s string) (warn, limit int64, err error) {
+	if s == "off" {
+		return 0, 0, nil
+	}
+	warnStr, capStr, found := strings.Cut(s, "/")
+	if !found {
+		warnStr, capStr = "", warnStr
+	}
+	if warnStr != "" {
+		if warn, err = parseTokenCount(warnStr); err != nil {
+			return 0, 0, err
+		}
+	}
+	if capStr != "" {
+		if limit, err = parseTokenCount(capStr); err != nil {
+			return 0, 0, err
+		}
+	}
+	if warn > 0 && limit > 0 && warn > limit {
+		return 0, 0, fmt.Errorf("warning threshold is above the cap")
+	}
+	return warn, limit, nil
+}
+
+// describeTokenBudget formats a daily token budget for display
+func describeTokenBudget(warn, limit float64) string {
+	var parts []string
+	if warn > 0 {
+		parts = append(parts, "warn at "+format.Tokens(int64(warn)))
+	}
+	if limit > 0 {
+		parts = append(parts, "cap at "+format.Tokens(int64(limit)))
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
+
 func (c *CLI) attachAgent(args []string) error {
 	flags, remainingArgs := ParseFlags(args)
 	readOnly := flags["read-only"] == "true" || flags["r"] == "true"
@@ -4799,6 +5642,11 @@ func (c *CLI) attachAgent(args []string) error {
 		return errors.AgentNotFound("agent", agentName, repoName)
 	}
 
+	// Headless agents have no window to attach to
+	if headless, _ := agentInfo["headless"].(bool); headless {
+		return errors.InvalidUsage(fmt.Sprintf("agent '%s' runs headless and has no tmux window - follow its output with: multiclaude logs %s --follow", agentName, agentName))
+	}
+
 	// Get tmux session and window
 	tmuxSession := sanitizeTmuxSessionName(repoName)
 	tmuxWindow := agentInfo["tmux_window"].(string)
@@ -5265,6 +6113,10 @@ func (c *CLI) repair(args []string) error {
 	flags, _ := ParseFlags(args)
 	verbose := flags["verbose"] == "true" || flags["v"] == "true"
 
+	if flags["check-schema"] == "true" {
+		return c.checkStateSchema()
+	}
+
 	fmt.Println("Repairing state...")
 
 	// Check if daemon is running
@@ -5300,8 +6152,164 @@ func (c *CLI) repair(args []string) error {
 	return nil
 }
 
-// refresh triggers an immediate worktree sync for all agents
+// checkStateSchema validates state.json against the current state structs
+// and reports fields it doesn't recognize, required fields it lacks, and
+// values of the wrong type. It only reads the file.
+func (c *CLI) checkStateSchema() error {
+	report, err := state.CheckSchemaFile(c.paths.StateFile)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("State file: %s\n", c.paths.StateFile)
+	switch {
+	case report.Version < report.Current:
+		fmt.Printf("Schema version: %d %s\n", report.Version, format.Yellow.Sprintf("(current is %d; migrated on next load, with a backup)", report.Current))
+	case report.Version > report.Current:
+		fmt.Printf("Schema version: %d %s\n", report.Version, format.Red.Sprintf("(newer than this multiclaude, which understands up to %d)", report.Current))
+	default:
+		fmt.Printf("Schema version: %d (current)\n", report.Version)
+	}
+	if data, err := os.ReadFile(state.JournalPath(c.paths.StateFile)); err == nil {
+		if pending := strings.Count(string(data), "\n"); pending > 0 {
+			fmt.Printf("Journal: %d change(s) not yet folded into the state file\n", pending)
+		}
+	}
+
+	for _, section := range []struct {
+		title string
+		paths []string
+	}{
+		{"Unknown fields", report.Unknown},
+		{"Missing fields", report.Missing},
+		{"Invalid values", report.Invalid},
+	} {
+		if len(section.paths) == 0 {
+			continue
+		}
+		fmt.Printf("\n%s:\n", section.title)
+		for _, path := range section.paths {
+			fmt.Printf("  - %s\n", path)
+		}
+	}
+
+	problems := report.Problems()
+	if report.Version > report.Current {
+		problems++
+	}
+	if problems > 0 {
+		fmt.Println()
+		return errors.New(errors.CategoryRuntime, fmt.Sprintf("state file has %d schema problem(s)", problems))
+	}
+	fmt.Println("\n✓ State file matches the current schema")
+	return nil
+}
+
+// exportInstallation writes tracked repositories (or just --repo) to a
+// tar.gz archive that import can rebuild on another machine
+func (c *CLI) exportInstallation(args []string) error {
+	flags, posArgs := ParseFlags(args)
+	if len(posArgs) < 1 {
+		return errors.InvalidUsage("usage: multiclaude export <file.tar.gz> [--repo <repo>]")
+	}
+	archivePath := posArgs[0]
+
+	st, err := state.Load(c.paths.StateFile)
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+	var repos []string
+	if repoName, ok := flags["repo"]; ok {
+		if _, exists := st.GetRepo(repoName); !exists {
+			return errors.RepoNotFound(repoName)
+		}
+		repos = []string{repoName}
+	}
+
+	f, err := os.Create(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", archivePath, err)
+	}
+	result, err := snapshot.Export(c.paths, st, f, repos)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(archivePath)
+		return err
+	}
+
+	for _, warning := range result.Warnings {
+		fmt.Println(format.Yellow.Sprintf("Warning: %s", warning))
+	}
+	bundles := 0
+	for _, b := range result.Manifest.Branches {
+		if b.Bundle != "" {
+			bundles++
+		}
+	}
+	fmt.Printf("✓ Exported %d repo(s) to %s\n", len(result.Manifest.Repos), archivePath)
+	fmt.Printf("  %d worktree branch(es), %d with unpushed commits; %d pending message(s)\n",
+		len(result.Manifest.Branches), bundles, result.Manifest.Messages)
+	return nil
+}
+
+// importInstallation rebuilds the repositories in an export archive, then
+// starts the daemon, which recreates their tmux sessions and resumes the
+// imported workers
+func (c *CLI) importInstallation(args []string) error {
+	_, posArgs := ParseFlags(args)
+	if len(posArgs) < 1 {
+		return errors.InvalidUsage("usage: multiclaude import <file.tar.gz>")
+	}
+
+	pidFile := daemon.NewPIDFile(c.paths.DaemonPID)
+	if running, _, _ := pidFile.IsRunning(); running {
+		return errors.DaemonRunning("import")
+	}
+
+	f, err := os.Open(posArgs[0])
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", posArgs[0], err)
+	}
+	defer f.Close()
+
+	if err := c.paths.EnsureDirectories(); err != nil {
+		return fmt.Errorf("failed to create directories: %w", err)
+	}
+	st, err := state.Load(c.paths.StateFile)
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+
+	fmt.Printf("Importing from %s...\n", posArgs[0])
+	result, err := snapshot.Import(c.paths, st, f)
+	if result != nil {
+		for _, warning := range result.Warnings {
+			fmt.Println(format.Yellow.Sprintf("Warning: %s", warning))
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err := st.Save(); err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+
+	fmt.Printf("✓ Imported %s\n", strings.Join(result.Repos, ", "))
+	fmt.Printf("  %d worktree(s) recreated, %d worker(s) to resume, %d message(s) restored\n",
+		result.Worktrees, result.Workers, result.Messages)
+
+	fmt.Println("Starting daemon to restore tmux sessions...")
+	return c.startDaemon(nil)
+}
+
+// refresh triggers an immediate worktree sync for all agents. With --all it
+// waits for the sync and reports what happened to each agent; --disable and
+// --enable opt an agent out of (or back into) refresh.
 func (c *CLI) refresh(args []string) error {
+	flags, _ := ParseFlags(args)
+
 	// Connect to daemon
 	client := socket.NewClient(c.paths.DaemonSock)
 	_, err := client.Send(socket.Request{Command: "ping"})
@@ -5309,22 +6317,97 @@ func (c *CLI) refresh(args []string) error {
 		return errors.DaemonNotRunning()
 	}
 
-	fmt.Println("Triggering worktree refresh...")
+	for _, flag := range []string{"disable", "enable"} {
+		agentName, ok := flags[flag]
+		enabled := flag == "enable"
+		if !ok {
+			continue
+		}
+		if agentName == "true" {
+			return errors.InvalidUsage(fmt.Sprintf("usage: multiclaude refresh --%s <agent>", flag))
+		}
+		repoName, err := c.resolveRepo(flags)
+		if err != nil {
+			return errors.NotInRepo()
+		}
+		if _, err := c.sendDaemonRequest("set_agent_refresh", map[string]interface{}{
+			"repo":    repoName,
+			"agent":   agentName,
+			"enabled": enabled,
+		}); err != nil {
+			return err
+		}
+		if enabled {
+			fmt.Printf("✓ Refresh enabled for '%s'\n", agentName)
+		} else {
+			fmt.Printf("✓ Refresh disabled for '%s'; its worktree will no longer be synced with main\n", agentName)
+		}
+		return nil
+	}
 
-	resp, err := client.Send(socket.Request{
-		Command: "trigger_refresh",
-	})
-	if err != nil {
-		return fmt.Errorf("failed to trigger refresh: %w", err)
+	reqArgs := map[string]interface{}{}
+	if repoName := flags["repo"]; repoName != "" {
+		reqArgs["repo"] = repoName
 	}
-	if !resp.Success {
-		return fmt.Errorf("refresh failed: %s", resp.Error)
+
+	if flags["all"] != "true" {
+		fmt.Println("Triggering worktree refresh...")
+
+		resp, err := client.Send(socket.Request{
+			Command: "trigger_refresh",
+			Args:    reqArgs,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to trigger refresh: %w", err)
+		}
+		if !resp.Success {
+			return fmt.Errorf("refresh failed: %s", resp.Error)
+		}
+
+		fmt.Println("✓ Worktree refresh triggered")
+		fmt.Println("  Agent worktrees will be synced with main branch in the background.")
+		fmt.Println("  Agents will receive a notification when their worktree is refreshed.")
+		fmt.Println("  Run 'multiclaude refresh --all' to wait and see what happened to each agent.")
+		return nil
+	}
+
+	fmt.Println("Refreshing agent worktrees...")
+	reqArgs["wait"] = true
+	resp, err := c.sendDaemonRequest("trigger_refresh", reqArgs)
+	if err != nil {
+		return err
 	}
 
-	fmt.Println("✓ Worktree refresh triggered")
-	fmt.Println("  Agent worktrees will be synced with main branch in the background.")
-	fmt.Println("  Agents will receive a notification when their worktree is refreshed.")
+	rows, _ := resp.Data.([]interface{})
+	if len(rows) == 0 {
+		fmt.Println("No agent worktrees to refresh")
+		return nil
+	}
 
+	fmt.Println()
+	table := format.NewColoredTable("REPO", "AGENT", "TYPE", "RESULT", "DETAIL")
+	for _, raw := range rows {
+		row, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		repoName, _ := row["repo"].(string)
+		agentName, _ := row["agent"].(string)
+		agentType, _ := row["type"].(string)
+		result, _ := row["result"].(string)
+		detail, _ := row["detail"].(string)
+		if agentName == "" {
+			agentName = "-"
+		}
+		table.AddRow(
+			format.Cell(repoName),
+			format.Cell(agentName),
+			format.Cell(agentType),
+			formatRefreshResultCell(result),
+			format.Cell(format.Truncate(detail, 60)),
+		)
+	}
+	table.Print()
 	return nil
 }
 
@@ -5516,9 +6599,6 @@ func (c *CLI) restartClaude(args []string) error {
 		return fmt.Errorf("agent has no session ID - try removing and recreating the agent")
 	}
 
-	// Get the prompt file path (stored as ~/.multiclaude/prompts/<agent-name>.md)
-	promptFile := filepath.Join(c.paths.Root, "prompts", agentName+".md")
-
 	// Check if the session has history by looking for the .jsonl file
 	// Claude stores sessions in ~/.claude/projects/<encoded-path>/<session-id>.jsonl
 	claudeProjectsDir := filepath.Join(os.Getenv("HOME"), ".claude", "projects")
@@ -5548,10 +6628,21 @@ func (c *CLI) restartClaude(args []string) error {
 		fmt.Printf("Starting new Claude session %s...\n", agent.SessionID)
 	}
 
-	// Add common flags
-	cmdArgs = append(cmdArgs, "--dangerously-skip-permissions")
-	if _, err := os.Stat(promptFile); err == nil {
-		cmdArgs = append(cmdArgs, "--append-system-prompt-file", promptFile)
+	// Add the prompt the session was started with, and the agent's model,
+	// tools, and permissions, as the daemon launches it
+	resp, err := c.sendDaemonRequest("launch_args", map[string]interface{}{
+		"repo":  repoName,
+		"agent": agentName,
+	})
+	if err != nil {
+		return err
+	}
+	data, _ := resp.Data.(map[string]interface{})
+	launchArgs, _ := data["args"].([]interface{})
+	for _, arg := range launchArgs {
+		if s, ok := arg.(string); ok {
+			cmdArgs = append(cmdArgs, s)
+		}
 	}
 
 	// Exec claude
@@ -5666,249 +6757,68 @@ func ParseFlags(args []string) (map[string]string, []string) {
 	return flags, positional
 }
 
-// savePromptToFile writes prompt text to the prompts directory and returns the path.
-// This is a common helper used by various prompt-writing functions.
-func (c *CLI) savePromptToFile(agentName, promptText string) (string, error) {
-	promptDir := filepath.Join(c.paths.Root, "prompts")
-	if err := os.MkdirAll(promptDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create prompt directory: %w", err)
-	}
-
-	promptPath := filepath.Join(promptDir, fmt.Sprintf("%s.md", agentName))
-	if err := os.WriteFile(promptPath, []byte(promptText), 0644); err != nil {
-		return "", fmt.Errorf("failed to write prompt file: %w", err)
-	}
-
-	return promptPath, nil
-}
-
-// getAgentDefinition finds an agent definition by name, copying templates if needed.
-// Returns the prompt content or an error if not found.
-func (c *CLI) getAgentDefinition(repoName, repoPath, agentDefName string) (string, error) {
-	localAgentsDir := c.paths.RepoAgentsDir(repoName)
-	reader := agents.NewReader(localAgentsDir, repoPath)
-	definitions, err := reader.ReadAllDefinitions()
-	if err != nil {
-		return "", fmt.Errorf("failed to read agent definitions: %w", err)
+// parseProfileFlags reads --model, --allowed-tools, --disallowed-tools,
+// --permission-mode, and --claude-args into an agent profile
+func parseProfileFlags(flags map[string]string) (state.AgentProfile, error) {
+	profile := state.AgentProfile{
+		Model:          flags["model"],
+		PermissionMode: flags["permission-mode"],
+		ExtraArgs:      strings.Fields(flags["claude-args"]),
 	}
-
-	// Find the definition
-	for _, def := range definitions {
-		if def.Name == agentDefName {
-			return def.Content, nil
+	for _, tool := range strings.Split(flags["allowed-tools"], ",") {
+		if tool = strings.TrimSpace(tool); tool != "" {
+			profile.AllowedTools = append(profile.AllowedTools, tool)
 		}
 	}
-
-	// If not found, try to copy from templates and retry
-	if _, err := os.Stat(localAgentsDir); os.IsNotExist(err) {
-		if err := templates.CopyAgentTemplates(localAgentsDir); err != nil {
-			return "", fmt.Errorf("failed to copy agent templates: %w", err)
+	for _, tool := range strings.Split(flags["disallowed-tools"], ",") {
+		if tool = strings.TrimSpace(tool); tool != "" {
+			profile.DisallowedTools = append(profile.DisallowedTools, tool)
 		}
-		// Re-read definitions
-		definitions, err = reader.ReadAllDefinitions()
-		if err != nil {
-			return "", fmt.Errorf("failed to read agent definitions after template copy: %w", err)
-		}
-		for _, def := range definitions {
-			if def.Name == agentDefName {
-				return def.Content, nil
-			}
-		}
-	}
-
-	return "", fmt.Errorf("no %s agent definition found", agentDefName)
-}
-
-// appendDocsAndSlashCommands adds CLI documentation and slash commands to prompt text.
-func (c *CLI) appendDocsAndSlashCommands(promptText string) string {
-	if c.documentation != "" {
-		promptText += fmt.Sprintf("\n\n---\n\n%s", c.documentation)
 	}
-
-	slashCommands := prompts.GetSlashCommandsPrompt()
-	if slashCommands != "" {
-		promptText += fmt.Sprintf("\n\n---\n\n%s", slashCommands)
-	}
-
-	return promptText
-}
-
-// writePromptFile writes the agent prompt to a temporary file and returns the path
-func (c *CLI) writePromptFile(repoPath string, agentType state.AgentType, agentName string) (string, error) {
-	// Get the complete prompt (default + custom + CLI docs)
-	promptText, err := prompts.GetPrompt(repoPath, agentType, c.documentation)
-	if err != nil {
-		return "", fmt.Errorf("failed to get prompt: %w", err)
-	}
-
-	return c.savePromptToFile(agentName, promptText)
-}
-
-// writeMergeQueuePromptFile writes a merge-queue prompt file with tracking mode configuration.
-// It reads the merge-queue prompt from agent definitions (configurable agent system).
-func (c *CLI) writeMergeQueuePromptFile(repoPath string, agentName string, mqConfig state.MergeQueueConfig) (string, error) {
-	repoName := filepath.Base(repoPath)
-
-	promptText, err := c.getAgentDefinition(repoName, repoPath, "merge-queue")
-	if err != nil {
-		return "", err
+	if profile.Model == "true" || profile.PermissionMode == "true" {
+		return profile, errors.InvalidUsage("--model and --permission-mode need a value, e.g. --model sonnet")
 	}
-
-	// Add CLI documentation and slash commands
-	promptText = c.appendDocsAndSlashCommands(promptText)
-
-	// Add tracking mode configuration to the prompt
-	trackingConfig := prompts.GenerateTrackingModePrompt(string(mqConfig.TrackMode))
-	promptText = trackingConfig + "\n\n" + promptText
-
-	return c.savePromptToFile(agentName, promptText)
-}
-
-// writePRShepherdPromptFile writes a pr-shepherd prompt file with fork context.
-// It reads the pr-shepherd prompt from agent definitions (configurable agent system).
-func (c *CLI) writePRShepherdPromptFile(repoPath string, agentName string, psConfig state.PRShepherdConfig, forkConfig state.ForkConfig) (string, error) {
-	repoName := filepath.Base(repoPath)
-
-	promptText, err := c.getAgentDefinition(repoName, repoPath, "pr-shepherd")
-	if err != nil {
-		return "", err
+	if err := claude.Profile(profile).Validate(); err != nil {
+		return profile, errors.InvalidUsage(err.Error())
 	}
-
-	// Add CLI documentation and slash commands
-	promptText = c.appendDocsAndSlashCommands(promptText)
-
-	// Add fork workflow context
-	forkContext := prompts.GenerateForkWorkflowPrompt(forkConfig.UpstreamOwner, forkConfig.UpstreamRepo, forkConfig.UpstreamOwner)
-	promptText = forkContext + "\n\n" + promptText
-
-	// Add tracking mode configuration to the prompt
-	trackingConfig := prompts.GenerateTrackingModePrompt(string(psConfig.TrackMode))
-	promptText = trackingConfig + "\n\n" + promptText
-
-	return c.savePromptToFile(agentName, promptText)
+	return profile, nil
 }
 
-// WorkerConfig holds configuration for creating worker prompts
-type WorkerConfig struct {
-	PushToBranch string           // Branch to push to instead of creating a new PR (for iterating on existing PRs)
-	ForkConfig   state.ForkConfig // Fork configuration (if working in a fork)
+// createdAgent is what the daemon reports about an agent it created
+type createdAgent struct {
+	branch       string
+	worktreePath string
+	tmuxSession  string
+	model        string
+	headless     bool
 }
 
-// writeWorkerPromptFile writes a worker prompt file with optional configuration.
-// It reads the worker prompt from agent definitions (configurable agent system).
-func (c *CLI) writeWorkerPromptFile(repoPath string, agentName string, config WorkerConfig) (string, error) {
-	repoName := filepath.Base(repoPath)
-
-	promptText, err := c.getAgentDefinition(repoName, repoPath, "worker")
+// createAgent asks the daemon to spawn an agent (see create_agent in the
+// socket API). When it fails, the daemon has already rolled the spawn back.
+func (c *CLI) createAgent(args map[string]interface{}) (createdAgent, error) {
+	client := socket.NewClient(c.paths.DaemonSock)
+	resp, err := client.Send(socket.Request{
+		Command: "create_agent",
+		Args:    args,
+	})
 	if err != nil {
-		return "", err
-	}
-
-	// Add CLI documentation and slash commands
-	promptText = c.appendDocsAndSlashCommands(promptText)
-
-	// Add fork workflow context if working in a fork
-	if config.ForkConfig.IsFork {
-		// Get the fork owner from the GitHub URL
-		forkOwner := c.extractOwnerFromGitHubURL(repoPath)
-		forkWorkflow := prompts.GenerateForkWorkflowPrompt(
-			config.ForkConfig.UpstreamOwner,
-			config.ForkConfig.UpstreamRepo,
-			forkOwner,
-		)
-		promptText = forkWorkflow + "\n---\n\n" + promptText
-	}
-
-	// Add push-to configuration if specified
-	if config.PushToBranch != "" {
-		pushToConfig := fmt.Sprintf(`## PR Iteration Mode
-
-**IMPORTANT: You are iterating on an existing PR, not creating a new one.**
-
-Instead of creating a new PR, push your changes to the existing branch: %s
-
-When your work is ready:
-1. Commit your changes
-2. Push to origin: git push origin %s
-3. Signal completion with: multiclaude agent complete
-
-Do NOT create a new PR. The existing PR will be updated automatically when you push.
-
----
-
-`, config.PushToBranch, config.PushToBranch)
-		promptText = pushToConfig + promptText
-	}
-
-	return c.savePromptToFile(agentName, promptText)
-}
-
-// setupOutputCapture sets up tmux pipe-pane to capture agent output to a log file.
-// It creates the necessary directories and starts the pipe-pane command.
-// The agentType should be "worker" for worker agents, anything else for system agents.
-func (c *CLI) setupOutputCapture(tmuxSession, tmuxWindow, repoName, agentName, agentType string) error {
-	// Determine log file path based on agent type
-	isWorker := agentType == "worker" || agentType == "review"
-	logFile := c.paths.AgentLogFile(repoName, agentName, isWorker)
-
-	// Ensure directory exists
-	logDir := filepath.Dir(logFile)
-	if err := os.MkdirAll(logDir, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
+		return createdAgent{}, errors.DaemonCommunicationFailed("creating agent", err)
 	}
-
-	// Set up pipe-pane
-	tmuxClient := tmux.NewClient()
-	if err := tmuxClient.StartPipePane(context.Background(), tmuxSession, tmuxWindow, logFile); err != nil {
-		return fmt.Errorf("failed to start output capture: %w", err)
-	}
-
-	return nil
-}
-
-// startClaudeInTmux starts Claude Code in a tmux window with the given configuration
-// Returns the PID of the Claude process
-func (c *CLI) startClaudeInTmux(binaryPath, tmuxSession, tmuxWindow, workDir, sessionID, promptFile, repoName string, initialMessage string) (int, error) {
-	// Build Claude command - uses global ~/.claude/ for auth and slash commands are embedded in prompts
-	claudeCmd := fmt.Sprintf("%s --session-id %s --dangerously-skip-permissions", binaryPath, sessionID)
-
-	// Add prompt file if provided
-	if promptFile != "" {
-		claudeCmd += fmt.Sprintf(" --append-system-prompt-file %s", promptFile)
-	}
-
-	// Send command to tmux window
-	target := fmt.Sprintf("%s:%s", tmuxSession, tmuxWindow)
-	cmd := exec.Command("tmux", "send-keys", "-t", target, claudeCmd, "C-m")
-	if err := cmd.Run(); err != nil {
-		return 0, fmt.Errorf("failed to start Claude in tmux: %w", err)
-	}
-
-	// Wait a moment for Claude to start
-	time.Sleep(500 * time.Millisecond)
-
-	// Get the PID of the Claude process
-	tmuxClient := tmux.NewClient()
-	pid, err := tmuxClient.GetPanePID(context.Background(), tmuxSession, tmuxWindow)
-	if err != nil {
-		// Non-fatal - we'll just not have the PID
-		fmt.Printf("Warning: failed to get Claude PID: %v\n", err)
-		pid = 0
+	if !resp.Success {
+		agentType, _ := args["type"].(string)
+		name, _ := args["name"].(string)
+		return createdAgent{}, errors.AgentSpawnFailed(agentType, name, fmt.Errorf("%s", resp.Error))
 	}
 
-	// If there's an initial message, send it after Claude is ready
-	if initialMessage != "" {
-		// Wait a bit more for Claude to fully initialize
-		time.Sleep(1 * time.Second)
-
-		// Send message using atomic method to avoid race conditions (issue #63)
-		// The atomic method sends text + Enter in a single exec call
-		if err := tmuxClient.SendKeysLiteralWithEnter(context.Background(), tmuxSession, tmuxWindow, initialMessage); err != nil {
-			return pid, fmt.Errorf("failed to send initial message to Claude: %w", err)
-		}
+	var result createdAgent
+	if data, ok := resp.Data.(map[string]interface{}); ok {
+		result.branch, _ = data["branch"].(string)
+		result.worktreePath, _ = data["worktree_path"].(string)
+		result.tmuxSession, _ = data["tmux_session"].(string)
+		result.model, _ = data["model"].(string)
+		result.headless, _ = data["headless"].(bool)
 	}
-
-	return pid, nil
+	return result, nil
 }
 
 // bugReport generates a diagnostic bug report with redacted sensitive information
@@ -6006,21 +6916,3 @@ func (c *CLI) deleteBranch(repoPath, branch string) error {
 	cmd.Dir = repoPath
 	return cmd.Run()
 }
-
-// extractOwnerFromGitHubURL extracts the owner from a repository's origin URL.
-// It first tries to get the origin URL from git remote, then parses it.
-func (c *CLI) extractOwnerFromGitHubURL(repoPath string) string {
-	cmd := exec.Command("git", "remote", "get-url", "origin")
-	cmd.Dir = repoPath
-	output, err := cmd.Output()
-	if err != nil {
-		return ""
-	}
-
-	originURL := strings.TrimSpace(string(output))
-	owner, _, err := fork.ParseGitHubURL(originURL)
-	if err != nil {
-		return ""
-	}
-	return owner
-}
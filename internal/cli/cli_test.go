@@ -591,6 +591,35 @@ func TestCLIAgentMessaging(t *testing.T) {
 	}
 }
 
+func TestParseMessagePriority(t *testing.T) {
+	tests := []struct {
+		args     []string
+		wantArgs []string
+		want     messages.Priority
+		wantErr  bool
+	}{
+		{[]string{"supervisor", "hello"}, []string{"supervisor", "hello"}, messages.PriorityNormal, false},
+		{[]string{"supervisor", "main", "is", "broken", "--urgent"}, []string{"supervisor", "main", "is", "broken"}, messages.PriorityUrgent, false},
+		{[]string{"--priority", "low", "supervisor", "fyi"}, []string{"supervisor", "fyi"}, messages.PriorityLow, false},
+		{[]string{"supervisor", "use", "--force", "--priority=urgent"}, []string{"supervisor", "use", "--force"}, messages.PriorityUrgent, false},
+		{[]string{"supervisor", "hi", "--priority", "asap"}, nil, "", true},
+	}
+
+	for _, tt := range tests {
+		args, priority, err := parseMessagePriority(tt.args)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseMessagePriority(%v) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if strings.Join(args, " ") != strings.Join(tt.wantArgs, " ") || priority != tt.want {
+			t.Errorf("parseMessagePriority(%v) = %v, %q; want %v, %q", tt.args, args, priority, tt.wantArgs, tt.want)
+		}
+	}
+}
+
 func TestCLISendMessageTriggersImmediateRouting(t *testing.T) {
 	cli, d, cleanup := setupTestEnvironment(t)
 	defer cleanup()
@@ -765,6 +794,67 @@ func TestCLISendMessageFallbackWhenDaemonUnavailable(t *testing.T) {
 	}
 }
 
+func TestCLISendMessageBroadcast(t *testing.T) {
+	cli, d, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	repoName := "test-repo"
+	paths := d.GetPaths()
+
+	repo := &state.Repository{
+		GithubURL:   "https://github.com/test/repo",
+		TmuxSession: "mc-test-repo",
+		Agents: map[string]state.Agent{
+			"supervisor": {Type: state.AgentTypeSupervisor, TmuxWindow: "supervisor"},
+			"fox":        {Type: state.AgentTypeWorker, TmuxWindow: "fox", Task: "Task A"},
+			"owl":        {Type: state.AgentTypeWorker, TmuxWindow: "owl", Task: "Task B"},
+		},
+	}
+	if err := d.GetState().AddRepo(repoName, repo); err != nil {
+		t.Fatalf("Failed to add repo: %v", err)
+	}
+
+	worktreeDir := filepath.Join(paths.WorktreesDir, repoName, "fox")
+	if err := os.MkdirAll(worktreeDir, 0755); err != nil {
+		t.Fatalf("Failed to create worktree dir: %v", err)
+	}
+	origDir, _ := os.Getwd()
+	defer os.Chdir(origDir)
+	if err := os.Chdir(worktreeDir); err != nil {
+		t.Fatalf("Failed to change to worktree: %v", err)
+	}
+
+	if err := cli.sendMessage([]string{"@all", "Main", "is", "broken", "--urgent"}); err != nil {
+		t.Fatalf("sendMessage(@all) failed: %v", err)
+	}
+
+	msgMgr := messages.NewManager(paths.MessagesDir)
+	var broadcastID string
+	for _, agent := range []string{"supervisor", "owl"} {
+		msgs, err := msgMgr.List(repoName, agent)
+		if err != nil || len(msgs) != 1 {
+			t.Fatalf("%s mailbox = %v, %v; want one copy", agent, msgs, err)
+		}
+		if msgs[0].Group != "@all" || msgs[0].Body != "Main is broken" || msgs[0].Priority != messages.PriorityUrgent {
+			t.Errorf("%s copy = %+v", agent, msgs[0])
+		}
+		broadcastID = msgs[0].BroadcastID
+	}
+	if msgs, _ := msgMgr.List(repoName, "fox"); len(msgs) != 0 {
+		t.Errorf("sender received its own broadcast: %v", msgs)
+	}
+
+	if err := cli.messageStatus([]string{broadcastID}); err != nil {
+		t.Errorf("messageStatus() failed: %v", err)
+	}
+	if err := cli.messageStatus([]string{"bc-missing"}); err == nil {
+		t.Error("messageStatus() should fail for an unknown broadcast")
+	}
+	if err := cli.sendMessage([]string{"@nobody", "Hello?"}); err == nil {
+		t.Error("sendMessage() should fail for an unknown group")
+	}
+}
+
 func TestCLISocketCommunication(t *testing.T) {
 	_, d, cleanup := setupTestEnvironment(t)
 	defer cleanup()
@@ -3359,6 +3449,98 @@ func TestParseDuration(t *testing.T) {
 	}
 }
 
+// TestParseSince tests parsing of --since values
+func TestParseSince(t *testing.T) {
+	before := time.Now()
+	got, err := parseSince("7d")
+	if err != nil {
+		t.Fatalf("parseSince(7d) failed: %v", err)
+	}
+	if want := before.Add(-7 * 24 * time.Hour); got.Before(want.Add(-time.Second)) || got.After(want.Add(time.Minute)) {
+		t.Errorf("parseSince(7d) = %v, want about %v", got, want)
+	}
+
+	got, err = parseSince("2026-01-02")
+	if err != nil {
+		t.Fatalf("parseSince(date) failed: %v", err)
+	}
+	if want := time.Date(2026, 1, 2, 0, 0, 0, 0, time.Local); !got.Equal(want) {
+		t.Errorf("parseSince(date) = %v, want %v", got, want)
+	}
+
+	if _, err := parseSince("last week"); err == nil {
+		t.Error("parseSince() should reject an unparseable value")
+	}
+}
+
+func TestParseTokenBudget(t *testing.T) {
+	tests := []struct {
+		input     string
+		warn, cap int64
+		wantErr   bool
+	}{
+		{"4M/5M", 4_000_000, 5_000_000, false},
+		{"500k/1.5M", 500_000, 1_500_000, false},
+		{"2M", 0, 2_000_000, false},
+		{"1M/", 1_000_000, 0, false},
+		{"off", 0, 0, false},
+		{"0/0", 0, 0, false},
+		{"5M/4M", 0, 0, true},
+		{"lots", 0, 0, true},
+		{"-1k", 0, 0, true},
+	}
+	for _, tt := range tests {
+		warn, limit, err := parseTokenBudget(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseTokenBudget(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if warn != tt.warn || limit != tt.cap {
+			t.Errorf("parseTokenBudget(%q) = %d/%d, want %d/%d", tt.input, warn, limit, tt.warn, tt.cap)
+		}
+	}
+}
+
+func TestParseProfileFlags(t *testing.T) {
+	flags, _ := ParseFlags([]string{"--model", "opus", "--allowed-tools", "Read, Bash(go test:*)", "--permission-mode=plan", "--claude-args=--verbose --add-dir /tmp"})
+	profile, err := parseProfileFlags(flags)
+	if err != nil {
+		t.Fatalf("parseProfileFlags() failed: %v", err)
+	}
+	if profile.Model != "opus" || profile.PermissionMode != "plan" {
+		t.Errorf("profile = %+v", profile)
+	}
+	if strings.Join(profile.AllowedTools, "|") != "Read|Bash(go test:*)" || len(profile.DisallowedTools) != 0 {
+		t.Errorf("tools = %q / %q", profile.AllowedTools, profile.DisallowedTools)
+	}
+	if strings.Join(profile.ExtraArgs, " ") != "--verbose --add-dir /tmp" {
+		t.Errorf("extra args = %q", profile.ExtraArgs)
+	}
+
+	for _, args := range [][]string{{"--permission-mode", "yolo"}, {"--model"}, {"--claude-args=--session-id abc"}} {
+		flags, _ := ParseFlags(args)
+		if _, err := parseProfileFlags(flags); err == nil {
+			t.Errorf("parseProfileFlags(%v) should fail", args)
+		}
+	}
+}
+
+func TestParsePermissionProfiles(t *testing.T) {
+	profiles, err := parsePermissionProfiles("worker:worker, review:reviewer-readonly,supervisor:")
+	if err != nil {
+		t.Fatalf("parsePermissionProfiles() failed: %v", err)
+	}
+	if profiles["worker"] != "worker" || profiles["review"] != "reviewer-readonly" || profiles["supervisor"] != "" || len(profiles) != 3 {
+		t.Errorf("profiles = %v", profiles)
+	}
+
+	for _, value := range []string{"worker", "robot:worker", "worker:root", "true"} {
+		if _, err := parsePermissionProfiles(value); err == nil {
+			t.Errorf("parsePermissionProfiles(%q) should fail", value)
+		}
+	}
+}
+
 // TestCLIListMessages tests the listMessages command
 func TestCLIListMessages(t *testing.T) {
 	cli, d, cleanup := setupTestEnvironment(t)
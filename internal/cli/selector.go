@@ -102,6 +102,122 @@ func formatAgentStatusCell(status string) format.ColoredCell {
 	}
 }
 
+// formatBranchCell returns a colored cell for an agent's branch, flagging
+// branches whose refresh onto main hit conflicts
+func formatBranchCell(branch string, agent map[string]interface{}) format.ColoredCell {
+	if branch == "" {
+		return format.ColorCell("-", format.Dim)
+	}
+	if needsRebase, _ := agent["needs_rebase"].(bool); needsRebase {
+		return format.ColorCell(branch+" (needs rebase)", format.Yellow)
+	}
+	return format.ColorCell(branch, format.Cyan)
+}
+
+// formatRefreshResultCell returns a colored cell for what a refresh did to an
+// agent's worktree
+func formatRefreshResultCell(result string) format.ColoredCell {
+	switch result {
+	case "rebased":
+		return format.ColorCell(result, format.Green)
+	case "up-to-date":
+		return format.ColorCell(result, format.Dim)
+	case "skipped":
+		return format.ColorCell(result, format.Yellow)
+	case "conflicts", "failed":
+		return format.ColorCell(result, format.Red)
+	default:
+		return format.ColorCell(result, nil)
+	}
+}
+
+// formatOverlap describes a pair of workers changing the same files, in red
+// when their changed lines touch and a merge conflict is likely
+func formatOverlap(raw interface{}) string {
+	overlap, _ := raw.(map[string]interface{})
+	workers, _ := overlap["workers"].([]interface{})
+	files, _ := overlap["files"].([]interface{})
+	if len(workers) != 2 || len(files) == 0 {
+		return ""
+	}
+	var conflicts []string
+	if list, ok := overlap["conflicts"].([]interface{}); ok {
+		for _, file := range list {
+			if name, ok := file.(string); ok {
+				conflicts = append(conflicts, name)
+			}
+		}
+	}
+
+	pair := fmt.Sprintf("%v & %v", workers[0], workers[1])
+	if len(conflicts) == 0 {
+		return format.Yellow.Sprintf("%s both touch %d file(s)", pair, len(files))
+	}
+	return format.Red.Sprintf("%s likely conflict in %s", pair, strings.Join(conflicts, ", "))
+}
+
+// formatActivityCell returns a colored cell for an agent's detected activity
+func formatActivityCell(activity string) format.ColoredCell {
+	switch activity {
+	case "busy":
+		return format.ColorCell(activity, format.Green)
+	case "idle":
+		return format.ColorCell(activity, format.Cyan)
+	case "waiting_permission":
+		return format.ColorCell("needs permission", format.Yellow)
+	case "crashed":
+		return format.ColorCell(activity, format.Red)
+	default:
+		return format.ColorCell("-", format.Dim)
+	}
+}
+
+// formatUsageCell returns a cell with the total tokens and estimated cost of a
+// "usage" object from the daemon, or a dimmed "-" when there is none
+func formatUsageCell(raw interface{}) format.ColoredCell {
+	u, ok := raw.(map[string]interface{})
+	if !ok {
+		return format.ColorCell("-", format.Dim)
+	}
+	var total int64
+	for _, key := range []string{"input_tokens", "output_tokens", "cache_creation_tokens", "cache_read_tokens"} {
+		if v, ok := u[key].(float64); ok {
+			total += int64(v)
+		}
+	}
+	if total == 0 {
+		return format.ColorCell("-", format.Dim)
+	}
+	cost, _ := u["cost_usd"].(float64)
+	return format.Cell(fmt.Sprintf("%s %s", format.Tokens(total), format.Cost(cost)))
+}
+
+// formatPRStateCell returns a colored cell for a pull request state
+func formatPRStateCell(prState string) format.ColoredCell {
+	switch prState {
+	case "merged":
+		return format.ColorCell(prState, format.Green)
+	case "closed":
+		return format.ColorCell(prState, format.Red)
+	default:
+		return format.ColorCell(prState, format.Cyan)
+	}
+}
+
+// formatCIStatusCell returns a colored cell for a pull request's CI status
+func formatCIStatusCell(ciStatus string) format.ColoredCell {
+	switch ciStatus {
+	case "passing":
+		return format.ColorCell(ciStatus, format.Green)
+	case "failing":
+		return format.ColorCell(ciStatus, format.Red)
+	case "pending":
+		return format.ColorCell(ciStatus, format.Yellow)
+	default:
+		return format.ColorCell("-", format.Dim)
+	}
+}
+
 // agentsToSelectableItems converts a list of agents to selectable items,
 // filtering by the specified types. If types is empty, all agents are included.
 func agentsToSelectableItems(agents []interface{}, types []string) []SelectableItem {
@@ -0,0 +1,140 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dlorenc/multiclaude/internal/events"
+	"github.com/dlorenc/multiclaude/internal/state"
+	"github.com/dlorenc/multiclaude/pkg/claude"
+)
+
+// activityCaptureLines is how many lines of pane scrollback are inspected when
+// classifying an agent. Prompts and permission dialogs sit at the bottom of the
+// pane, so a small window is enough and keeps tmux calls cheap.
+const activityCaptureLines = 40
+
+// activityLoop periodically classifies what each agent is doing
+func (d *Daemon) activityLoop() {
+	d.periodicLoop("activity", 30*time.Second, nil, d.updateAgentActivity)
+}
+
+// TriggerActivityCheck triggers an immediate activity check (for testing)
+func (d *Daemon) TriggerActivityCheck() {
+	d.updateAgentActivity()
+}
+
+// updateAgentActivity detects and records the activity of every agent
+func (d *Daemon) updateAgentActivity() {
+	d.logger.Debug("Checking agent activity")
+
+	repos := d.state.GetAllRepos()
+	for repoName, repo := range repos {
+		for agentName, agent := range repo.Agents {
+			d.refreshAgentActivity(repoName, repo.TmuxSession, agentName, agent)
+		}
+	}
+}
+
+// refreshAgentActivity detects an agent's current activity, stores it in state, and
+// tells the supervisor when a worker becomes blocked on a permission prompt.
+func (d *Daemon) refreshAgentActivity(repoName, tmuxSession, agentName string, agent state.Agent) state.AgentActivity {
+	activity := d.detectActivity(repoName, tmuxSession, agentName, agent)
+
+	previous, err := d.state.UpdateAgentActivity(repoName, agentName, activity)
+	if err != nil {
+		d.logger.Debug("Failed to record activity for %s/%s: %v", repoName, agentName, err)
+		return activity
+	}
+	d.resetStableResumes(repoName, agentName, agent, activity)
+
+	if previous != activity {
+		d.logger.Debug("Agent %s/%s activity: %q -> %q", repoName, agentName, previous, activity)
+		// Persistent agents are reported by the health check, which restarts them
+		if activity == state.ActivityCrashed && !agent.Type.IsPersistent() {
+			d.publishEvent(events.AgentDied, repoName, agentName, map[string]interface{}{
+				"type":   string(agent.Type),
+				"reason": "process_exited",
+				"pid":    agent.PID,
+			})
+		}
+		if activity == state.ActivityWaitingPermission && agent.Type != state.AgentTypeSupervisor {
+			msgMgr := d.getMessageManager()
+			msg := fmt.Sprintf("Agent '%s' is waiting on a permission prompt and needs a human to respond (multiclaude agent attach %s).", agentName, agentName)
+			if _, err := msgMgr.Send(repoName, "daemon", "supervisor", msg); err != nil {
+				d.logger.Debug("Could not notify supervisor about %s permission prompt: %v", agentName, err)
+			}
+		}
+	}
+
+	return activity
+}
+
+// detectActivity classifies an agent from its process, log growth, and pane contents
+func (d *Daemon) detectActivity(repoName, tmuxSession, agentName string, agent state.Agent) state.AgentActivity {
+	if agent.PID > 0 && !isProcessAlive(agent.PID) {
+		return state.ActivityCrashed
+	}
+
+	// A headless agent has no pane; it is busy until its run ends
+	if agent.Headless {
+		if d.headlessRunning(repoName, agentName) {
+			return state.ActivityBusy
+		}
+		return state.ActivityUnknown
+	}
+
+	grew := d.agentLogGrew(repoName, agentName, agent.Type)
+
+	pane, err := d.tmux.CapturePane(d.ctx, tmuxSession, agent.TmuxWindow, activityCaptureLines)
+	if err != nil {
+		d.logger.Debug("Failed to capture pane for %s/%s: %v", repoName, agentName, err)
+		return state.ActivityUnknown
+	}
+
+	return classifyPane(pane, grew)
+}
+
+// agentLogGrew reports whether the agent's pipe-pane log has grown since the last check.
+// The first observation of a log only records a baseline.
+func (d *Daemon) agentLogGrew(repoName, agentName string, agentType state.AgentType) bool {
+	isWorker := agentType == state.AgentTypeWorker || agentType == state.AgentTypeReview
+	info, err := os.Stat(d.paths.AgentLogFile(repoName, agentName, isWorker))
+	if err != nil {
+		return false
+	}
+
+	key := repoName + "/" + agentName
+	d.activityMu.Lock()
+	defer d.activityMu.Unlock()
+
+	if d.logSizes == nil {
+		d.logSizes = make(map[string]int64)
+	}
+	last, seen := d.logSizes[key]
+	d.logSizes[key] = info.Size()
+	return seen && info.Size() > last
+}
+
+// classifyPane determines an agent's activity from the tail of its pane.
+// An interruptible tool call or growing output means the agent is busy; a
+// dialog open at the bottom of the pane means it is blocked on a permission
+// prompt; an empty input prompt means it is idle. Dialogs further up the
+// scrollback have been answered and don't count.
+func classifyPane(pane string, logGrew bool) state.AgentActivity {
+	if logGrew || strings.Contains(pane, "esc to interrupt") {
+		return state.ActivityBusy
+	}
+
+	if claude.ShowsDialog(pane) {
+		return state.ActivityWaitingPermission
+	}
+
+	if claude.HasInputPrompt(pane) {
+		return state.ActivityIdle
+	}
+
+	return state.ActivityUnknown
+}
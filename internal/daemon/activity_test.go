@@ -0,0 +1,209 @@
+package daemon
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dlorenc/multiclaude/internal/state"
+	"github.com/dlorenc/multiclaude/pkg/tmux"
+)
+
+func TestClassifyPane(t *testing.T) {
+	tests := []struct {
+		name    string
+		pane    string
+		logGrew bool
+		want    state.AgentActivity
+	}{
+		{
+			name: "idle at prompt",
+			pane: "● Done. The tests pass.\n\n╭──────────────────╮\n│ >                │\n╰──────────────────╯\n  ? for shortcuts",
+			want: state.ActivityIdle,
+		},
+		{
+			name: "idle at bare prompt",
+			pane: "some output\n> ",
+			want: state.ActivityIdle,
+		},
+		{
+			name: "busy running a tool",
+			pane: "● Bash(go test ./...)\n\n✻ Thinking… (12s · esc to interrupt)\n\n│ >                │",
+			want: state.ActivityBusy,
+		},
+		{
+			name:    "busy because log grew",
+			pane:    "│ >                │",
+			logGrew: true,
+			want:    state.ActivityBusy,
+		},
+		{
+			name: "waiting on permission",
+			pane: "Bash command\n  rm -rf build\n\nDo you want to proceed?\n❯ 1. Yes\n  2. No",
+			want: state.ActivityWaitingPermission,
+		},
+		{
+			name:    "growth wins over a dialog being drawn",
+			pane:    "Do you want to make this edit to main.go?\n❯ 1. Yes",
+			logGrew: true,
+			want:    state.ActivityBusy,
+		},
+		{
+			name: "answered permission prompt in scrollback",
+			pane: "Do you want to proceed?\n❯ 1. Yes\n  2. No\n\n● Removed build/\n\n╭──────────────────╮\n│ >                │\n╰──────────────────╯",
+			want: state.ActivityIdle,
+		},
+		{
+			name: "shell prompt is unknown",
+			pane: "user@host:~/repo$ ",
+			want: state.ActivityUnknown,
+		},
+		{
+			name: "empty pane",
+			pane: "",
+			want: state.ActivityUnknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyPane(tt.pane, tt.logGrew); got != tt.want {
+				t.Errorf("classifyPane() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAgentLogGrew(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	logFile := d.paths.AgentLogFile("test-repo", "worker1", true)
+	if err := os.MkdirAll(filepath.Dir(logFile), 0755); err != nil {
+		t.Fatalf("Failed to create log dir: %v", err)
+	}
+
+	// Missing log never counts as growth
+	if d.agentLogGrew("test-repo", "worker1", state.AgentTypeWorker) {
+		t.Error("Missing log should not count as growth")
+	}
+
+	if err := os.WriteFile(logFile, []byte("hello\n"), 0644); err != nil {
+		t.Fatalf("Failed to write log: %v", err)
+	}
+
+	// First observation only records a baseline
+	if d.agentLogGrew("test-repo", "worker1", state.AgentTypeWorker) {
+		t.Error("First observation should not count as growth")
+	}
+	if d.agentLogGrew("test-repo", "worker1", state.AgentTypeWorker) {
+		t.Error("Unchanged log should not count as growth")
+	}
+
+	if err := os.WriteFile(logFile, []byte("hello\nworld\n"), 0644); err != nil {
+		t.Fatalf("Failed to write log: %v", err)
+	}
+	if !d.agentLogGrew("test-repo", "worker1", state.AgentTypeWorker) {
+		t.Error("Growing log should count as growth")
+	}
+}
+
+func TestWakeLoopSkipsBusyAgents(t *testing.T) {
+	tmuxClient := tmux.NewClient()
+	if !tmuxClient.IsTmuxAvailable() {
+		t.Fatal("tmux is required for this test but not available")
+	}
+
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	sessionName := "mc-test-wake-busy"
+	if err := tmuxClient.CreateSession(context.Background(), sessionName, true); err != nil {
+		t.Fatalf("tmux is required for this test but cannot create sessions in this environment: %v", err)
+	}
+	defer tmuxClient.KillSession(context.Background(), sessionName)
+
+	if err := tmuxClient.CreateWindow(context.Background(), sessionName, "worker"); err != nil {
+		t.Fatalf("Failed to create worker window: %v", err)
+	}
+
+	// Make the pane look like a running tool call
+	if err := tmuxClient.SendKeysLiteral(context.Background(), sessionName, "worker", "esc to interrupt"); err != nil {
+		t.Fatalf("Failed to send keys: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		pane, _ := tmuxClient.CapturePane(context.Background(), sessionName, "worker", 0)
+		if strings.Contains(pane, "esc to interrupt") {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	repo := &state.Repository{
+		GithubURL:   "https://github.com/test/repo",
+		TmuxSession: sessionName,
+		Agents:      make(map[string]state.Agent),
+	}
+	if err := d.state.AddRepo("test-repo", repo); err != nil {
+		t.Fatalf("Failed to add repo: %v", err)
+	}
+	agent := state.Agent{
+		Type:       state.AgentTypeWorker,
+		TmuxWindow: "worker",
+		Task:       "busy task",
+		CreatedAt:  time.Now(),
+	}
+	if err := d.state.AddAgent("test-repo", "worker", agent); err != nil {
+		t.Fatalf("Failed to add agent: %v", err)
+	}
+
+	d.TriggerWake()
+
+	updated, exists := d.state.GetAgent("test-repo", "worker")
+	if !exists {
+		t.Fatal("Agent should exist")
+	}
+	if !updated.LastNudge.IsZero() {
+		t.Error("Busy agent should not be nudged")
+	}
+	if updated.Activity != state.ActivityBusy {
+		t.Errorf("Activity = %q, want %q", updated.Activity, state.ActivityBusy)
+	}
+	if updated.ActivityChangedAt.IsZero() {
+		t.Error("ActivityChangedAt should be set")
+	}
+}
+
+func TestActivityCheckDetectsCrashedAgent(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	repo := &state.Repository{
+		GithubURL:   "https://github.com/test/repo",
+		TmuxSession: "mc-test-no-session",
+		Agents:      make(map[string]state.Agent),
+	}
+	if err := d.state.AddRepo("test-repo", repo); err != nil {
+		t.Fatalf("Failed to add repo: %v", err)
+	}
+	agent := state.Agent{
+		Type:       state.AgentTypeWorker,
+		TmuxWindow: "worker",
+		PID:        999999999, // Not a running process
+		CreatedAt:  time.Now(),
+	}
+	if err := d.state.AddAgent("test-repo", "worker", agent); err != nil {
+		t.Fatalf("Failed to add agent: %v", err)
+	}
+
+	d.TriggerActivityCheck()
+
+	updated, _ := d.state.GetAgent("test-repo", "worker")
+	if updated.Activity != state.ActivityCrashed {
+		t.Errorf("Activity = %q, want %q", updated.Activity, state.ActivityCrashed)
+	}
+}
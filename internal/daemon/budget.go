@@ -0,0 +1,311 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dlorenc/multiclaude/internal/format"
+	"github.com/dlorenc/multiclaude/internal/state"
+	"github.com/dlorenc/multiclaude/internal/usage"
+	"github.com/dlorenc/multiclaude/internal/worktree"
+)
+
+// budgetCheckInterval is how often token usage is compared against the budgets
+const budgetCheckInterval = 2 * time.Minute
+
+// dailyUsage is the number of tokens used since local midnight
+type dailyUsage struct {
+	total  int64            // All repositories
+	repos  map[string]int64 // Per repository
+	agents map[string]int64 // Per running agent, keyed "<repo>/<agent>"
+}
+
+// budgetLoop periodically enforces the daily token budgets
+func (d *Daemon) budgetLoop() {
+	d.periodicLoop("budget", budgetCheckInterval, d.enforceBudgets, d.enforceBudgets)
+}
+
+// TriggerBudgetCheck triggers an immediate budget check (for testing)
+func (d *Daemon) TriggerBudgetCheck() {
+	d.enforceBudgets()
+}
+
+// startOfDay returns local midnight on the day of t
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// todaysUsage totals the tokens used in repos since midnight
+func (d *Daemon) todaysUsage(repos map[string]*state.Repository, now time.Time) dailyUsage {
+	used := dailyUsage{repos: make(map[string]int64), agents: make(map[string]int64)}
+	d.forEachUsage(repos, startOfDay(now), func(src usageSource, _ time.Time, u usage.Usage) {
+		tokens := u.TotalTokens()
+		used.total += tokens
+		used.repos[src.repo] += tokens
+		if src.live {
+			used.agents[src.repo+"/"+src.agent] += tokens
+		}
+	})
+	return used
+}
+
+// budgetExhausted reports whether the repository, or all repositories, used
+// up their daily token cap at the last budget check. No new workers start
+// until the budget resets.
+func (d *Daemon) budgetExhausted(repoName string) bool {
+	d.budgetMu.Lock()
+	defer d.budgetMu.Unlock()
+	return d.budgetCapped[""] || d.budgetCapped[repoName]
+}
+
+// budgetResetTime returns when the daily token budgets reset: the next local
+// midnight after now
+func budgetResetTime(now time.Time) time.Time {
+	return startOfDay(now).AddDate(0, 0, 1)
+}
+
+// budgetExhaustedError is the error for a worker or review refused because
+// the repository's daily token budget is used up
+func budgetExhaustedError(repoName string, now time.Time) error {
+	return fmt.Errorf("repository %q has used up its daily token budget; no new workers or reviews start until it resets at %s",
+		repoName, budgetResetTime(now).Format("2006-01-02 15:04"))
+}
+
+// notifyBudgetOnce records that the notice identified by key went out today.
+// Returns false if it already did.
+func (d *Daemon) notifyBudgetOnce(key string, now time.Time) bool {
+	day := now.Format("2006-01-02")
+
+	d.budgetMu.Lock()
+	defer d.budgetMu.Unlock()
+	if d.budgetNotices[key] == day {
+		return false
+	}
+	d.budgetNotices[key] = day
+	return true
+}
+
+// enforceBudgets compares today's token usage with the global, repository, and
+// per-agent-type budgets. Agents past a warning threshold are told to wrap up;
+// workers and review agents past a cap are hibernated, and while a repository
+// (or the global budget) is capped no new workers are spawned.
+func (d *Daemon) enforceBudgets() {
+	now := time.Now()
+	repos := d.state.GetAllRepos()
+	global := d.state.GetGlobalBudget()
+	used := d.todaysUsage(repos, now)
+
+	// Record which budgets are capped first so that workers freed by
+	// hibernation don't start queued tasks
+	capped := make(map[string]bool)
+	if global.CapTokens > 0 && used.total >= global.CapTokens {
+		capped[""] = true
+	}
+	for repoName, repo := range repos {
+		if limit := repo.BudgetConfig.Repo.CapTokens; limit > 0 && used.repos[repoName] >= limit {
+			capped[repoName] = true
+		}
+	}
+	d.budgetMu.Lock()
+	wasCapped := d.budgetCapped
+	d.budgetCapped = capped
+	d.budgetUsage = used
+	d.budgetMu.Unlock()
+
+	msgMgr := d.getMessageManager()
+	notifySupervisor := func(repoName, msg string) {
+		if _, err := msgMgr.Send(repoName, "daemon", "supervisor", msg); err != nil {
+			d.logger.Debug("Could not notify supervisor of %s about its budget: %v", repoName, err)
+		}
+	}
+
+	switch {
+	case capped[""]:
+		if d.notifyBudgetOnce("global:cap", now) {
+			d.logger.Warn("Global token cap reached: %d of %d tokens used today", used.total, global.CapTokens)
+			for repoName := range repos {
+				notifySupervisor(repoName, fmt.Sprintf("The global daily token cap is reached (%s of %s tokens used today across all repositories). Workers are being hibernated and no new workers start until tomorrow.",
+					format.Tokens(used.total), format.Tokens(global.CapTokens)))
+			}
+		}
+	case global.WarnTokens > 0 && used.total >= global.WarnTokens:
+		if d.notifyBudgetOnce("global:warn", now) {
+			for repoName := range repos {
+				notifySupervisor(repoName, fmt.Sprintf("Token usage across all repositories passed the daily warning threshold: %s of %s used today. %s",
+					format.Tokens(used.total), format.Tokens(global.WarnTokens), budgetCapNote(global, used.total)))
+			}
+		}
+	}
+
+	for repoName, repo := range repos {
+		budget := repo.BudgetConfig
+		repoUsed := used.repos[repoName]
+
+		switch {
+		case capped[repoName]:
+			if d.notifyBudgetOnce("repo:"+repoName+":cap", now) {
+				d.logger.Warn("Token cap reached for %s: %d of %d tokens used today", repoName, repoUsed, budget.Repo.CapTokens)
+				notifySupervisor(repoName, fmt.Sprintf("The daily token cap for this repository is reached (%s of %s tokens used today). Workers are being hibernated and no new workers start until tomorrow.",
+					format.Tokens(repoUsed), format.Tokens(budget.Repo.CapTokens)))
+			}
+		case budget.Repo.WarnTokens > 0 && repoUsed >= budget.Repo.WarnTokens:
+			if d.notifyBudgetOnce("repo:"+repoName+":warn", now) {
+				notifySupervisor(repoName, fmt.Sprintf("This repository passed its daily token warning threshold: %s of %s used today. %s",
+					format.Tokens(repoUsed), format.Tokens(budget.Repo.WarnTokens), budgetCapNote(budget.Repo, repoUsed)))
+			}
+		}
+
+		for agentName, agent := range repo.Agents {
+			if agent.ReadyForCleanup {
+				continue
+			}
+			hibernatable := !agent.Type.IsPersistent() // Workers and review agents
+			agentBudget := budget.AgentTypes[agent.Type]
+			agentUsed := used.agents[repoName+"/"+agentName]
+			key := "agent:" + repoName + "/" + agentName
+
+			switch {
+			case hibernatable && (capped[""] || capped[repoName]):
+				d.hibernateAgent(repoName, agentName, agent, "the daily token cap was reached")
+			case agentBudget.CapTokens > 0 && agentUsed >= agentBudget.CapTokens:
+				if hibernatable {
+					d.hibernateAgent(repoName, agentName, agent, fmt.Sprintf("it used %s tokens today, over the %s cap of %s",
+						format.Tokens(agentUsed), agent.Type, format.Tokens(agentBudget.CapTokens)))
+				} else if d.notifyBudgetOnce(key+":cap", now) {
+					d.sendBudgetWarning(repoName, agentName, fmt.Sprintf("You have used %s tokens today, over the daily cap of %s for %s agents. Keep work to a minimum until tomorrow.",
+						format.Tokens(agentUsed), format.Tokens(agentBudget.CapTokens), agent.Type))
+				}
+			case agentBudget.WarnTokens > 0 && agentUsed >= agentBudget.WarnTokens:
+				if d.notifyBudgetOnce(key+":warn", now) {
+					msg := fmt.Sprintf("Token budget warning: you have used %s tokens today (warning threshold %s). %s",
+						format.Tokens(agentUsed), format.Tokens(agentBudget.WarnTokens), budgetCapNote(agentBudget, agentUsed))
+					if hibernatable && agentBudget.CapTokens > 0 {
+						msg += " Commit and push your work and wrap up soon; at the cap you will be hibernated."
+					}
+					d.sendBudgetWarning(repoName, agentName, msg)
+				}
+			}
+		}
+	}
+
+	// A budget that reset at midnight (or was raised) lets queued tasks start again
+	for repoName := range repos {
+		if (wasCapped[""] || wasCapped[repoName]) && !capped[""] && !capped[repoName] {
+			d.logger.Info("Token budget available again for %s", repoName)
+			d.drainWorkerQueue(repoName)
+		}
+	}
+}
+
+// budgetCapNote describes how much of a budget's cap is left
+func budgetCapNote(budget state.TokenBudget, used int64) string {
+	if budget.CapTokens <= 0 {
+		return "There is no hard cap."
+	}
+	return fmt.Sprintf("%s left before the cap of %s.", format.Tokens(budget.CapTokens-used), format.Tokens(budget.CapTokens))
+}
+
+// sendBudgetWarning messages an agent about its token usage
+func (d *Daemon) sendBudgetWarning(repoName, agentName, msg string) {
+	d.logger.Info("Budget warning for %s/%s: %s", repoName, agentName, msg)
+	if _, err := d.getMessageManager().Send(repoName, "daemon", agentName, msg); err != nil {
+		d.logger.Warn("Failed to send budget warning to %s/%s: %v", repoName, agentName, err)
+		return
+	}
+	d.requestMessageRouting()
+}
+
+// hibernateAgent stops a worker or review agent that is over its budget, the
+// same way `multiclaude repo hibernate` does: uncommitted work is archived to
+// the repository's archive dir, then committed as WIP on the agent's branch so
+// it can be picked up again, and the agent is cleaned up with its task marked
+// failed.
+func (d *Daemon) hibernateAgent(repoName, agentName string, agent state.Agent, reason string) {
+	d.logger.Warn("Hibernating %s/%s: %s", repoName, agentName, reason)
+
+	branch := ""
+	var saved []string
+	if agent.WorktreePath != "" {
+		branch, _ = worktree.GetCurrentBranch(agent.WorktreePath)
+		if changed, err := worktree.HasUncommittedChanges(agent.WorktreePath); err == nil && changed {
+			archiveDir := filepath.Join(d.paths.RepoArchiveDir(repoName), time.Now().Format("2006-01-02_15-04-05"))
+			if err := worktree.ArchiveChanges(agent.WorktreePath, archiveDir, agentName); err != nil {
+				d.logger.Warn("Failed to archive changes of %s/%s: %v", repoName, agentName, err)
+			} else {
+				meta, _ := json.MarshalIndent(map[string]interface{}{
+					"name":          agentName,
+					"type":          string(agent.Type),
+					"branch":        branch,
+					"task":          agent.Task,
+					"worktree_path": agent.WorktreePath,
+					"reason":        reason,
+					"archived_at":   time.Now().Format(time.RFC3339),
+				}, "", "  ")
+				if err := os.WriteFile(filepath.Join(archiveDir, agentName+".json"), meta, 0644); err != nil {
+					d.logger.Warn("Failed to write archive metadata for %s/%s: %v", repoName, agentName, err)
+				}
+				saved = append(saved, "archived to "+archiveDir)
+			}
+
+			message := fmt.Sprintf("WIP: %s hibernated by multiclaude\n\n%s.", agentName, reason)
+			if committed, err := worktree.CommitWIP(agent.WorktreePath, message); err != nil {
+				d.logger.Warn("Failed to commit WIP for %s/%s: %v", repoName, agentName, err)
+			} else if committed && branch != "" {
+				saved = append(saved, "committed as WIP on "+branch)
+			}
+		}
+	}
+
+	agent.FailureReason = "hibernated: " + reason
+	agent.ReadyForCleanup = true
+	if err := d.state.UpdateAgent(repoName, agentName, agent); err != nil {
+		d.logger.Error("Failed to mark %s/%s for cleanup: %v", repoName, agentName, err)
+		return
+	}
+
+	msg := fmt.Sprintf("Agent '%s' (%s) was hibernated because %s.", agentName, agent.Type, reason)
+	if len(saved) > 0 {
+		msg += fmt.Sprintf(" Its uncommitted work was %s.", strings.Join(saved, " and "))
+	}
+	if agent.Task != "" {
+		msg += " Task: " + agent.Task
+	}
+	if _, err := d.getMessageManager().Send(repoName, "daemon", "supervisor", msg); err != nil {
+		d.logger.Debug("Could not notify supervisor about hibernated agent %s: %v", agentName, err)
+	}
+
+	d.cleanupDeadAgents(map[string][]string{repoName: {agentName}})
+}
+
+// budgetStatus summarizes today's usage against the repository's and the
+// global budget for the supervisor's wake message. Returns "" when no budget
+// is configured.
+func (d *Daemon) budgetStatus(repoName string, repo *state.Repository) string {
+	d.budgetMu.Lock()
+	used := d.budgetUsage
+	d.budgetMu.Unlock()
+
+	status := ""
+	describe := func(scope string, budget state.TokenBudget, tokens int64) {
+		limit := budget.CapTokens
+		if limit == 0 {
+			limit = budget.WarnTokens
+		}
+		if limit == 0 {
+			return
+		}
+		left := limit - tokens
+		if left < 0 {
+			left = 0
+		}
+		status += fmt.Sprintf(" %s token budget: %s of %s used today, %s left.", scope, format.Tokens(tokens), format.Tokens(limit), format.Tokens(left))
+	}
+	describe("Repository", repo.BudgetConfig.Repo, used.repos[repoName])
+	describe("Global", d.state.GetGlobalBudget(), used.total)
+	return status
+}
@@ -0,0 +1,172 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dlorenc/multiclaude/internal/socket"
+	"github.com/dlorenc/multiclaude/internal/state"
+	"github.com/dlorenc/multiclaude/internal/worktree"
+)
+
+// transcriptToday returns a transcript with one response of the given size written now
+func transcriptToday(tokens int) string {
+	return fmt.Sprintf(`{"type":"assistant","timestamp":%q,"message":{"id":"msg_today","model":"claude-sonnet-4-5","usage":{"input_tokens":%d,"output_tokens":0}}}`+"\n",
+		time.Now().UTC().Format(time.RFC3339), tokens)
+}
+
+func TestEnforceBudgetsWarnsOnce(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	agent, _ := addWorkerWithTranscript(t, d)
+	writeAgentTranscript(t, d, "clever-fox", agent, transcriptToday(1500))
+	if err := d.state.UpdateBudgetConfig("test-repo", state.BudgetConfig{
+		Repo:       state.TokenBudget{WarnTokens: 1000},
+		AgentTypes: map[state.AgentType]state.TokenBudget{state.AgentTypeWorker: {WarnTokens: 1000, CapTokens: 5000}},
+	}); err != nil {
+		t.Fatalf("UpdateBudgetConfig() failed: %v", err)
+	}
+
+	d.TriggerBudgetCheck()
+	d.TriggerBudgetCheck()
+
+	warnings, _ := d.getMessageManager().List("test-repo", "clever-fox")
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Body, "1.5k tokens today") || !strings.Contains(warnings[0].Body, "3.5k left") {
+		t.Errorf("worker messages = %+v, want one budget warning", warnings)
+	}
+	notices, _ := d.getMessageManager().List("test-repo", "supervisor")
+	if len(notices) != 1 || !strings.Contains(notices[0].Body, "warning threshold") {
+		t.Errorf("supervisor messages = %+v, want one repository warning", notices)
+	}
+	if _, exists := d.state.GetAgent("test-repo", "clever-fox"); !exists {
+		t.Error("worker under its cap should keep running")
+	}
+
+	repo, _ := d.state.GetRepo("test-repo")
+	if status := d.budgetStatus("test-repo", repo); !strings.Contains(status, "1.5k of 1.0k used today, 0 left") {
+		t.Errorf("budgetStatus() = %q", status)
+	}
+}
+
+func TestEnforceBudgetsHibernatesWorkerOverCap(t *testing.T) {
+	d, repoPath, cleanup := setupTestDaemonWithGitRepo(t)
+	defer cleanup()
+
+	wtPath := filepath.Join(d.paths.WorktreeDir("test-repo"), "clever-fox")
+	if err := worktree.NewManager(repoPath).CreateNewBranch(wtPath, "work/clever-fox", "HEAD"); err != nil {
+		t.Fatalf("Failed to create worktree: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(wtPath, "auth.go"), []byte("package auth\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	agent := state.Agent{
+		Type:         state.AgentTypeWorker,
+		WorktreePath: wtPath,
+		TmuxWindow:   "clever-fox",
+		SessionID:    "budget-session",
+		Task:         "Add auth",
+		CreatedAt:    time.Now(),
+	}
+	if err := d.state.AddRepo("test-repo", &state.Repository{
+		GithubURL:   "https://github.com/test/repo",
+		TmuxSession: "mc-test-budget",
+		Agents: map[string]state.Agent{
+			"clever-fox": agent,
+			"supervisor": {Type: state.AgentTypeSupervisor, TmuxWindow: "supervisor", CreatedAt: time.Now()},
+		},
+	}); err != nil {
+		t.Fatalf("Failed to add repo: %v", err)
+	}
+	writeAgentTranscript(t, d, "clever-fox", agent, transcriptToday(2000))
+	if err := d.state.UpdateBudgetConfig("test-repo", state.BudgetConfig{
+		Repo: state.TokenBudget{CapTokens: 1000},
+	}); err != nil {
+		t.Fatalf("UpdateBudgetConfig() failed: %v", err)
+	}
+
+	d.TriggerBudgetCheck()
+
+	if _, exists := d.state.GetAgent("test-repo", "clever-fox"); exists {
+		t.Fatal("worker over the cap should be hibernated")
+	}
+	history, _ := d.state.GetTaskHistory("test-repo", 0)
+	if len(history) != 1 || history[0].Status != state.TaskStatusFailed || !strings.HasPrefix(history[0].FailureReason, "hibernated:") {
+		t.Errorf("history = %+v, want a failed hibernated task", history)
+	}
+
+	// The uncommitted work was committed on the branch and archived
+	output, err := exec.Command("git", "-C", repoPath, "show", "--stat", "--format=%s", "work/clever-fox").CombinedOutput()
+	if err != nil || !strings.Contains(string(output), "WIP: clever-fox hibernated") || !strings.Contains(string(output), "auth.go") {
+		t.Errorf("branch head = %s (err: %v), want a WIP commit with auth.go", output, err)
+	}
+	patches, _ := filepath.Glob(filepath.Join(d.paths.RepoArchiveDir("test-repo"), "*", "clever-fox.untracked"))
+	if len(patches) != 1 {
+		t.Errorf("archive files = %v, want the worker's untracked file list", patches)
+	}
+
+	// No new workers start while the repository is capped
+	d.dispatchMu.Lock()
+	hasSlot := d.hasWorkerSlotUnlocked("test-repo")
+	d.dispatchMu.Unlock()
+	if hasSlot {
+		t.Error("a capped repository should have no free worker slots")
+	}
+
+	found := false
+	msgs, _ := d.getMessageManager().List("test-repo", "supervisor")
+	for _, msg := range msgs {
+		found = found || strings.Contains(msg.Body, "'clever-fox' (worker) was hibernated")
+	}
+	if !found {
+		t.Errorf("supervisor was not told about the hibernated worker: %+v", msgs)
+	}
+}
+
+func TestExhaustedBudgetHoldsNewAgents(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	addPendingTestRepo(t, d, "mc-test-repo")
+	d.budgetMu.Lock()
+	d.budgetCapped = map[string]bool{"test-repo": true}
+	d.budgetMu.Unlock()
+
+	// New workers are queued until the budget resets, and say why
+	resp := d.handleRequest(socket.Request{
+		Command: "reserve_worker_slot",
+		Args:    map[string]interface{}{"repo": "test-repo", "name": "first", "task": "Add auth"},
+	})
+	if !resp.Success {
+		t.Fatalf("reserve_worker_slot failed: %s", resp.Error)
+	}
+	data := resp.Data.(map[string]interface{})
+	if data["queued"] != true || data["reason"] != "budget" || !data["budget_resets_at"].(time.Time).Equal(budgetResetTime(time.Now())) {
+		t.Errorf("reserve_worker_slot = %v, want the task queued for the budget", data)
+	}
+
+	resp = d.handleRequest(socket.Request{
+		Command: "reserve_worker_slot",
+		Args:    map[string]interface{}{"repo": "test-repo", "name": "second", "task": "Add billing", "queue": false},
+	})
+	if resp.Success || !strings.Contains(resp.Error, "daily token budget") {
+		t.Errorf("reserve_worker_slot without queueing = success %v, error %q; want a budget error", resp.Success, resp.Error)
+	}
+
+	// Agents spawned directly are refused
+	for _, name := range []string{"third", "reviewer"} {
+		resp = d.handleRequest(socket.Request{
+			Command: "spawn_agent",
+			Args:    map[string]interface{}{"repo": "test-repo", "name": name, "class": "ephemeral", "prompt": "You are an agent.", "task": "Task " + name},
+		})
+		if resp.Success || !strings.Contains(resp.Error, "daily token budget") {
+			t.Errorf("spawn_agent %s = success %v, error %q; want a budget error", name, resp.Success, resp.Error)
+		}
+	}
+}
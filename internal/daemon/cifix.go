@@ -0,0 +1,149 @@
+package daemon
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dlorenc/multiclaude/internal/github"
+	"github.com/dlorenc/multiclaude/internal/state"
+)
+
+const (
+	// ciFixMaxRunLogs bounds how many failed Actions runs are fetched per fix-up
+	ciFixMaxRunLogs = 3
+
+	// ciFixLogLines is how many trailing lines of each failed run log are
+	// passed to the fix-up worker
+	ciFixLogLines = 60
+)
+
+// fixFailedCI spawns a fix-up worker on the branch of an open PR whose checks
+// failed after its worker finished. Each head commit gets at most one fix-up,
+// and once a PR has used its retry budget the supervisor is told instead.
+// Returns the PR status as stored afterwards.
+func (d *Daemon) fixFailedCI(repoName string, repo *state.Repository, status state.PullRequestStatus, pr github.PullRequest) state.PullRequestStatus {
+	if status.State != state.TaskStatusOpen || status.CIStatus != state.CIFailing {
+		return status
+	}
+	if status.HeadSHA == "" || status.HeadSHA == status.FixAttemptSHA {
+		return status
+	}
+
+	// A running worker (the original one or an earlier fix-up) owns the branch
+	if agent, running := repo.Agents[status.Agent]; running && agent.Type == state.AgentTypeWorker && !agent.ReadyForCleanup {
+		return status
+	}
+
+	config, err := d.state.GetCIFixConfig(repoName)
+	if err != nil || !config.Enabled {
+		return status
+	}
+
+	failed := pr.FailedChecks()
+	names := make([]string, 0, len(failed))
+	for _, check := range failed {
+		names = append(names, check.DisplayName())
+	}
+	msgMgr := d.getMessageManager()
+
+	if status.FixAttempts >= config.MaxAttempts {
+		status.FixAttemptSHA = status.HeadSHA
+		if _, _, err := d.state.UpdatePullRequest(repoName, status); err != nil {
+			d.logger.Error("Failed to record CI fix budget for PR #%d in %s: %v", status.Number, repoName, err)
+			return status
+		}
+		d.logger.Warn("CI still failing on PR #%d (%s) after %d fix-up attempts", status.Number, repoName, status.FixAttempts)
+		msg := fmt.Sprintf("CI is still failing on PR #%d (%s) after %d fix-up attempts, so no more fix-up workers will be spawned for it. Failing checks: %s. %s",
+			status.Number, status.Branch, status.FixAttempts, strings.Join(names, ", "), status.URL)
+		if _, err := msgMgr.Send(repoName, "daemon", "supervisor", msg); err != nil {
+			d.logger.Debug("Could not notify supervisor about PR #%d: %v", status.Number, err)
+		}
+		return status
+	}
+
+	attempt := status.FixAttempts + 1
+	workerName := fmt.Sprintf("ci-fix-%d-%d", status.Number, attempt)
+	if _, exists := d.state.GetAgent(repoName, workerName); exists {
+		return status
+	}
+
+	// The task is built before taking dispatchMu, since it fetches CI logs
+	task := d.ciFixTask(repoName, status, failed)
+
+	// Wait for a free worker slot; the next poll tries again
+	if !d.reserveWorkerSlot(repoName, workerName) {
+		d.logger.Debug("CI failing on PR #%d in %s but no worker slot is free", status.Number, repoName)
+		return status
+	}
+	err = d.spawnWithReservedSlot(repoName, workerName, func() error {
+		return d.spawnBranchWorker(repoName, workerName, status.Branch, task)
+	})
+	if err != nil {
+		d.logger.Error("Failed to spawn CI fix-up worker for PR #%d in %s: %v", status.Number, repoName, err)
+		return status
+	}
+
+	status.Agent = workerName
+	status.FixAttempts = attempt
+	status.FixAttemptSHA = status.HeadSHA
+	if _, _, err := d.state.UpdatePullRequest(repoName, status); err != nil {
+		d.logger.Error("Failed to record CI fix-up for PR #%d in %s: %v", status.Number, repoName, err)
+	}
+
+	d.logger.Info("Spawned CI fix-up worker %s/%s for PR #%d (attempt %d of %d)", repoName, workerName, status.Number, attempt, config.MaxAttempts)
+	msg := fmt.Sprintf("CI failed on PR #%d (%s): %s. Spawned fix-up worker '%s' on the PR branch (attempt %d of %d).",
+		status.Number, status.Branch, strings.Join(names, ", "), workerName, attempt, config.MaxAttempts)
+	if _, err := msgMgr.Send(repoName, "daemon", "supervisor", msg); err != nil {
+		d.logger.Debug("Could not notify supervisor about fix-up worker %s: %v", workerName, err)
+	}
+	return status
+}
+
+// ciFixTask builds the task for a fix-up worker: the failing checks and the
+// tail of their GitHub Actions logs when available
+func (d *Daemon) ciFixTask(repoName string, status state.PullRequestStatus, failed []github.Check) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Fix the failing CI checks on PR #%d (%s). Reproduce each failure locally, fix it, and push to %s.\n\nFailing checks:\n",
+		status.Number, status.URL, status.Branch)
+	for _, check := range failed {
+		link := check.DetailsURL
+		if link == "" {
+			link = check.TargetURL
+		}
+		if link != "" {
+			fmt.Fprintf(&b, "- %s (%s)\n", check.DisplayName(), link)
+		} else {
+			fmt.Fprintf(&b, "- %s\n", check.DisplayName())
+		}
+	}
+
+	repoPath := d.paths.RepoDir(repoName)
+	fetched := make(map[string]bool)
+	for _, check := range failed {
+		runID := check.RunID()
+		if runID == "" || fetched[runID] || len(fetched) >= ciFixMaxRunLogs {
+			continue
+		}
+		fetched[runID] = true
+
+		log, err := d.gh.FailedRunLog(d.ctx, repoPath, runID)
+		if err != nil {
+			d.logger.Debug("Could not fetch failed log for run %s in %s: %v", runID, repoName, err)
+			continue
+		}
+		if excerpt := tailLines(log, ciFixLogLines); excerpt != "" {
+			fmt.Fprintf(&b, "\nLog excerpt from run %s (%s):\n```\n%s\n```\n", runID, check.DisplayName(), excerpt)
+		}
+	}
+
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// tailLines returns the last n lines of s, ignoring trailing newlines
+func tailLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,155 @@
+package daemon
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dlorenc/multiclaude/internal/github"
+	"github.com/dlorenc/multiclaude/internal/state"
+	"github.com/dlorenc/multiclaude/internal/worktree"
+	"github.com/dlorenc/multiclaude/pkg/tmux"
+)
+
+// failingPR returns an open PR for work/happy-eagle with a failed Actions check
+func failingPR(headSHA string) github.PullRequest {
+	return github.PullRequest{
+		Number: 12, URL: "https://github.com/test/repo/pull/12", State: "OPEN",
+		HeadRefName: "work/happy-eagle", HeadRefOid: headSHA,
+		StatusCheckRollup: []github.Check{
+			{Name: "build", Status: "COMPLETED", Conclusion: "SUCCESS"},
+			{Name: "test", Status: "COMPLETED", Conclusion: "FAILURE", DetailsURL: "https://github.com/test/repo/actions/runs/555/job/1"},
+		},
+	}
+}
+
+// addCompletedTask records a finished task whose PR is still open
+func addCompletedTask(t *testing.T, d *Daemon) {
+	t.Helper()
+	if err := d.state.AddTaskHistory("test-repo", state.TaskHistoryEntry{
+		Name:        "happy-eagle",
+		Task:        "Fix bug",
+		Branch:      "work/happy-eagle",
+		Status:      state.TaskStatusOpen,
+		PRNumber:    12,
+		CreatedAt:   time.Now().Add(-time.Hour),
+		CompletedAt: time.Now().Add(-time.Minute),
+	}); err != nil {
+		t.Fatalf("Failed to add history: %v", err)
+	}
+}
+
+func TestFixFailedCIDisabledByDefault(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+	fake := setupPRTrackingRepo(t, d)
+	addCompletedTask(t, d)
+	fake.listed = []github.PullRequest{failingPR("abc123")}
+
+	d.TriggerPRTracking()
+
+	prs, _ := d.state.GetPullRequests("test-repo")
+	if len(prs) != 1 || prs[0].CIStatus != state.CIFailing {
+		t.Fatalf("PRs = %+v, want #12 failing", prs)
+	}
+	if prs[0].FixAttempts != 0 || prs[0].FixAttemptSHA != "" {
+		t.Errorf("fix-up recorded while disabled: %+v", prs[0])
+	}
+	if agents, _ := d.state.ListAgents("test-repo"); len(agents) != 0 {
+		t.Errorf("agents spawned while disabled: %v", agents)
+	}
+	if msgs, _ := d.getMessageManager().List("test-repo", "supervisor"); len(msgs) != 0 {
+		t.Errorf("supervisor notified while disabled: %d messages", len(msgs))
+	}
+}
+
+func TestFixFailedCISpawnsWorkerWithinBudget(t *testing.T) {
+	tmuxClient := tmux.NewClient()
+	if !tmuxClient.IsTmuxAvailable() {
+		t.Fatal("tmux is required for this test but not available")
+	}
+
+	t.Setenv("MULTICLAUDE_TEST_MODE", "1")
+
+	d, repoPath, cleanup := setupTestDaemonWithGitRepo(t)
+	defer cleanup()
+
+	sessionName := "mc-test-prs"
+	if err := tmuxClient.CreateSession(context.Background(), sessionName, true); err != nil {
+		t.Fatalf("tmux is required for this test but cannot create sessions in this environment: %v", err)
+	}
+	defer tmuxClient.KillSession(context.Background(), sessionName)
+
+	fake := setupPRTrackingRepo(t, d)
+	fake.logs = map[string]string{"555": "=== RUN TestLogin\n--- FAIL: TestLogin (0.01s)\n"}
+	if err := d.state.UpdateCIFixConfig("test-repo", state.CIFixConfig{Enabled: true, MaxAttempts: 1}); err != nil {
+		t.Fatalf("UpdateCIFixConfig() failed: %v", err)
+	}
+
+	// The completed worker's branch still exists locally
+	if output, err := exec.Command("git", "-C", repoPath, "branch", "work/happy-eagle").CombinedOutput(); err != nil {
+		t.Fatalf("Failed to create branch: %v: %s", err, output)
+	}
+	addCompletedTask(t, d)
+	fake.listed = []github.PullRequest{failingPR("abc123")}
+
+	d.TriggerPRTracking()
+
+	agent, exists := d.state.GetAgent("test-repo", "ci-fix-12-1")
+	if !exists {
+		t.Fatal("fix-up worker should be spawned for the failing PR")
+	}
+	if !strings.Contains(agent.Task, "- test (") || strings.Contains(agent.Task, "- build") {
+		t.Errorf("task should list only the failing check:\n%s", agent.Task)
+	}
+	if !strings.Contains(agent.Task, "--- FAIL: TestLogin") {
+		t.Errorf("task should include the failed log excerpt:\n%s", agent.Task)
+	}
+	if branch, err := worktree.GetCurrentBranch(agent.WorktreePath); err != nil || branch != "work/happy-eagle" {
+		t.Errorf("fix-up worker branch = %q (err: %v), want work/happy-eagle", branch, err)
+	}
+
+	prs, _ := d.state.GetPullRequests("test-repo")
+	if len(prs) != 1 || prs[0].FixAttempts != 1 || prs[0].FixAttemptSHA != "abc123" || prs[0].Agent != "ci-fix-12-1" {
+		t.Errorf("PR after fix-up = %+v", prs)
+	}
+
+	// Polling again while the fix-up worker runs changes nothing
+	d.TriggerPRTracking()
+	if _, exists := d.state.GetAgent("test-repo", "ci-fix-12-2"); exists {
+		t.Error("second fix-up spawned while the first is still running")
+	}
+
+	// The fix-up finished but CI fails again on its commit: the budget is spent
+	if err := d.state.RemoveAgent("test-repo", "ci-fix-12-1"); err != nil {
+		t.Fatalf("Failed to remove agent: %v", err)
+	}
+	fake.mu.Lock()
+	fake.listed = []github.PullRequest{failingPR("def456")}
+	fake.mu.Unlock()
+
+	d.TriggerPRTracking()
+	d.TriggerPRTracking()
+
+	if _, exists := d.state.GetAgent("test-repo", "ci-fix-12-2"); exists {
+		t.Error("fix-up spawned beyond the retry budget")
+	}
+	prs, _ = d.state.GetPullRequests("test-repo")
+	if prs[0].FixAttempts != 1 || prs[0].FixAttemptSHA != "def456" {
+		t.Errorf("PR after budget exhausted = %+v", prs[0])
+	}
+
+	msgs, _ := d.getMessageManager().List("test-repo", "supervisor")
+	if len(msgs) != 2 {
+		t.Fatalf("supervisor messages = %d, want spawn notice and one give-up notice", len(msgs))
+	}
+	gaveUp := false
+	for _, msg := range msgs {
+		gaveUp = gaveUp || strings.Contains(msg.Body, "still failing on PR #12")
+	}
+	if !gaveUp {
+		t.Errorf("supervisor was not told the retry budget is spent: %+v", msgs)
+	}
+}
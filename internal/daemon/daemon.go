@@ -2,11 +2,13 @@ package daemon
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -14,12 +16,18 @@ import (
 
 	"github.com/dlorenc/multiclaude/internal/agents"
 	"github.com/dlorenc/multiclaude/internal/diagnostics"
+	"github.com/dlorenc/multiclaude/internal/events"
+	"github.com/dlorenc/multiclaude/internal/fork"
+	"github.com/dlorenc/multiclaude/internal/github"
 	"github.com/dlorenc/multiclaude/internal/hooks"
 	"github.com/dlorenc/multiclaude/internal/logging"
 	"github.com/dlorenc/multiclaude/internal/messages"
+	"github.com/dlorenc/multiclaude/internal/permissions"
 	"github.com/dlorenc/multiclaude/internal/prompts"
 	"github.com/dlorenc/multiclaude/internal/socket"
 	"github.com/dlorenc/multiclaude/internal/state"
+	"github.com/dlorenc/multiclaude/internal/templates"
+	"github.com/dlorenc/multiclaude/internal/usage"
 	"github.com/dlorenc/multiclaude/internal/worktree"
 	"github.com/dlorenc/multiclaude/pkg/claude"
 	"github.com/dlorenc/multiclaude/pkg/config"
@@ -28,13 +36,54 @@ import (
 
 // Daemon represents the main daemon process
 type Daemon struct {
-	paths        *config.Paths
-	state        *state.State
-	tmux         *tmux.Client
-	logger       *logging.Logger
-	server       *socket.Server
-	pidFile      *PIDFile
-	claudeRunner *claude.Runner
+	paths          *config.Paths
+	state          *state.State
+	tmux           *tmux.Client
+	logger         *logging.Logger
+	server         *socket.Server
+	pidFile        *PIDFile
+	claudeRunner   *claude.Runner
+	headlessRunner *claude.HeadlessRunner
+	events         *events.Bus
+	gh             github.Client
+	usageTracker   *usage.Tracker
+	spawns         *spawnJournal
+	promptStore    *prompts.Store
+
+	// documentation is the CLI reference included in agent prompts
+	documentation string
+
+	// dispatchMu serializes worker dispatch (pending tasks, the worker queue, and
+	// slot reservations) so tasks are never spawned twice or over the limit
+	dispatchMu       sync.Mutex
+	slotReservations map[string]time.Time // "<repo>/<worker>" -> reservation time
+
+	// routeRequests wakes messageRouterLoop so new messages are delivered right away.
+	// It is buffered with capacity 1 so requests coalesce while a delivery is pending.
+	routeRequests chan struct{}
+	// urgentRouteRequests is like routeRequests but skips the debounce
+	urgentRouteRequests chan struct{}
+	// routeMu serializes message routing so a message is never injected twice
+	routeMu sync.Mutex
+
+	// activityMu guards logSizes, the pipe-pane log size seen at the last activity check
+	activityMu sync.Mutex
+	logSizes   map[string]int64 // "<repo>/<agent>" -> log size in bytes
+
+	// headlessMu guards headlessRuns, the headless agents' runs this daemon started
+	headlessMu   sync.Mutex
+	headlessRuns map[string]*headlessRun // "<repo>/<agent>" -> run
+
+	// budgetMu guards the results of the last budget check (see enforceBudgets)
+	budgetMu      sync.Mutex
+	budgetUsage   dailyUsage
+	budgetCapped  map[string]bool   // Repo name ("" = global) -> daily cap reached
+	budgetNotices map[string]string // Notice key -> day it was last sent
+
+	// overlapMu guards the results of the last overlap check (see checkOverlaps)
+	overlapMu      sync.Mutex
+	overlaps       map[string][]workerOverlap // Repo name -> worker pairs changing the same files
+	overlapNotices map[string]string          // "<repo>/<worker>/<worker>" -> conflicting files last reported
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -64,18 +113,29 @@ func New(paths *config.Paths) (*Daemon, error) {
 
 	tmuxClient := tmux.NewClient()
 	d := &Daemon{
-		paths:        paths,
-		state:        st,
-		tmux:         tmuxClient,
-		logger:       logger,
-		pidFile:      NewPIDFile(paths.DaemonPID),
-		claudeRunner: claude.NewRunner(claude.WithTerminal(tmuxClient)),
-		ctx:          ctx,
-		cancel:       cancel,
+		paths:               paths,
+		state:               st,
+		tmux:                tmuxClient,
+		logger:              logger,
+		pidFile:             NewPIDFile(paths.DaemonPID),
+		claudeRunner:        claude.NewRunner(claude.WithTerminal(tmuxClient)),
+		headlessRunner:      claude.NewHeadlessRunner(),
+		events:              events.NewBus(),
+		gh:                  github.NewCLI(),
+		usageTracker:        usage.NewTracker(),
+		spawns:              newSpawnJournal(paths.SpawnJournalFile()),
+		promptStore:         prompts.NewStore(paths.PromptsDir()),
+		routeRequests:       make(chan struct{}, 1),
+		urgentRouteRequests: make(chan struct{}, 1),
+		budgetNotices:       make(map[string]string),
+		overlapNotices:      make(map[string]string),
+		ctx:                 ctx,
+		cancel:              cancel,
 	}
 
 	// Create socket server
 	d.server = socket.NewServer(paths.DaemonSock, socket.HandlerFunc(d.handleRequest))
+	d.server.HandleStream("subscribe", d.handleSubscribe)
 
 	return d, nil
 }
@@ -89,6 +149,9 @@ func (d *Daemon) Start() error {
 		return err
 	}
 
+	// Roll back spawns a crash cut short before anything can spawn again
+	d.recoverSpawns()
+
 	// Start socket server
 	if err := d.server.Start(); err != nil {
 		return fmt.Errorf("failed to start socket server: %w", err)
@@ -106,12 +169,19 @@ func (d *Daemon) Start() error {
 	d.restoreTrackedRepos()
 
 	// Start core loops after restore completes
-	d.wg.Add(5)
+	d.wg.Add(12)
 	go d.healthCheckLoop()
 	go d.messageRouterLoop()
 	go d.wakeLoop()
 	go d.serverLoop()
 	go d.worktreeRefreshLoop()
+	go d.taskDependencyLoop()
+	go d.activityLoop()
+	go d.prTrackingLoop()
+	go d.budgetLoop()
+	go d.overlapLoop()
+	go d.stateSnapshotLoop()
+	go d.messageGCLoop()
 
 	return nil
 }
@@ -146,6 +216,11 @@ func (d *Daemon) TriggerWake() {
 	d.wakeAgents()
 }
 
+// TriggerPendingTasks triggers an immediate pending task resolution (for testing)
+func (d *Daemon) TriggerPendingTasks() {
+	d.resolvePendingTasks()
+}
+
 // logDiagnostics logs system diagnostics in machine-readable JSON format
 func (d *Daemon) logDiagnostics() {
 	// Get version from CLI package (same as used by CLI)
@@ -224,6 +299,27 @@ func getOptionalBoolArg(args map[string]interface{}, key string, defaultVal bool
 	return defaultVal
 }
 
+// getOptionalProfileArg extracts the optional "profile" argument, an object
+// with the json fields of state.AgentProfile, and validates it.
+func getOptionalProfileArg(args map[string]interface{}) (state.AgentProfile, error) {
+	var profile state.AgentProfile
+	raw, ok := args["profile"]
+	if !ok || raw == nil {
+		return profile, nil
+	}
+	data, err := json.Marshal(raw)
+	if err == nil {
+		err = json.Unmarshal(data, &profile)
+	}
+	if err != nil {
+		return profile, fmt.Errorf("invalid profile: %v", err)
+	}
+	if err := claude.Profile(profile).Validate(); err != nil {
+		return profile, fmt.Errorf("invalid profile: %v", err)
+	}
+	return profile, nil
+}
+
 // periodicLoop runs a function periodically at the specified interval.
 // If onStartup is provided, it's called immediately before entering the loop.
 // The onTick function is called on each timer tick.
@@ -250,6 +346,20 @@ func (d *Daemon) periodicLoop(name string, interval time.Duration, onStartup, on
 	}
 }
 
+// stateSnapshotInterval is how often journaled state changes are folded into
+// state.json
+const stateSnapshotInterval = time.Minute
+
+// stateSnapshotLoop periodically folds the state journal into state.json so
+// the file external tools read stays current when the daemon is quiet
+func (d *Daemon) stateSnapshotLoop() {
+	d.periodicLoop("state snapshot", stateSnapshotInterval, nil, func() {
+		if err := d.state.Checkpoint(); err != nil {
+			d.logger.Error("Failed to snapshot state: %v", err)
+		}
+	})
+}
+
 // serverLoop handles socket connections
 func (d *Daemon) serverLoop() {
 	defer d.wg.Done()
@@ -321,6 +431,12 @@ func (d *Daemon) checkAgentHealth() {
 				continue
 			}
 
+			// Headless agents have no window and complete when their run ends
+			if agent.Headless {
+				d.checkHeadlessAgent(repoName, agentName, agent)
+				continue
+			}
+
 			// Check if window exists
 			hasWindow, err := d.tmux.HasWindow(d.ctx, repo.TmuxSession, agent.TmuxWindow)
 			if err != nil {
@@ -341,14 +457,22 @@ func (d *Daemon) checkAgentHealth() {
 
 					// For persistent agents, attempt auto-restart
 					if agent.Type.IsPersistent() {
+						d.publishEvent(events.AgentDied, repoName, agentName, map[string]interface{}{
+							"type":   string(agent.Type),
+							"reason": "process_exited",
+							"pid":    agent.PID,
+						})
 						d.logger.Info("Attempting to auto-restart agent %s", agentName)
 						if err := d.restartAgent(repoName, agentName, agent, repo); err != nil {
 							d.logger.Error("Failed to restart agent %s: %v", agentName, err)
 						} else {
 							d.logger.Info("Successfully restarted agent %s", agentName)
 						}
+					} else {
+						// Workers are resumed in their worktree until their resume budget runs out;
+						// other transient agents (review) complete and clean up
+						d.resumeCrashedWorker(repoName, agentName, agent, repo, "process exited")
 					}
-					// For transient agents (workers, review), don't auto-restart - they complete and clean up
 				}
 			}
 		}
@@ -365,11 +489,78 @@ func (d *Daemon) checkAgentHealth() {
 
 // messageRouterLoop watches for new messages and delivers them
 func (d *Daemon) messageRouterLoop() {
-	d.periodicLoop("message router", 2*time.Minute, nil, d.routeMessages)
+	defer d.wg.Done()
+	d.logger.Info("Starting message router loop")
+
+	// The poll is only a safety net; messages normally arrive via requestMessageRouting
+	ticker := time.NewTicker(messageRoutingFallbackInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.routeMessages()
+		case <-d.routeRequests:
+			// Debounce so a burst of messages is delivered as one batch per agent
+			select {
+			case <-time.After(messageRoutingDebounce):
+			case <-d.ctx.Done():
+				d.logger.Info("message router loop stopped")
+				return
+			}
+			select {
+			case <-d.routeRequests:
+			default:
+			}
+			d.routeMessages()
+		case <-d.urgentRouteRequests:
+			d.routeMessages()
+		case <-d.ctx.Done():
+			d.logger.Info("message router loop stopped")
+			return
+		}
+	}
+}
+
+const (
+	// messageRoutingFallbackInterval is how often pending messages are swept up
+	// if an explicit routing request was missed
+	messageRoutingFallbackInterval = 2 * time.Minute
+
+	// messageRoutingDebounce is how long to wait after a routing request for
+	// more messages to arrive before delivering
+	messageRoutingDebounce = 250 * time.Millisecond
+
+	// maxMessagesPerDelivery caps how many messages are injected into one agent
+	// at once; the rest are delivered in the next routing pass
+	maxMessagesPerDelivery = 10
+)
+
+// requestMessageRouting asks the message router to deliver pending messages soon.
+// It never blocks; requests made while one is already pending are coalesced.
+func (d *Daemon) requestMessageRouting() {
+	select {
+	case d.routeRequests <- struct{}{}:
+	default:
+	}
 }
 
-// routeMessages checks for pending messages and delivers them
+// requestUrgentMessageRouting asks the message router to deliver pending
+// messages now, without waiting for more to arrive
+func (d *Daemon) requestUrgentMessageRouting() {
+	select {
+	case d.urgentRouteRequests <- struct{}{}:
+	default:
+	}
+}
+
+// routeMessages checks for pending messages and delivers them.
+// All pending messages for an agent are injected as a single batch, with
+// urgent messages ahead of the rest.
 func (d *Daemon) routeMessages() {
+	d.routeMu.Lock()
+	defer d.routeMu.Unlock()
+
 	d.logger.Debug("Routing messages")
 
 	// Get messages manager
@@ -387,6 +578,11 @@ func (d *Daemon) routeMessages() {
 				continue
 			}
 
+			// Headless agents have no window to type into; their messages stay pending
+			if agent.Headless {
+				continue
+			}
+
 			// Get unread messages (pending or delivered but not yet read)
 			unreadMsgs, err := msgMgr.ListUnread(repoName, agentName)
 			if err != nil {
@@ -394,30 +590,50 @@ func (d *Daemon) routeMessages() {
 				continue
 			}
 
-			// Deliver each pending message
+			// Collect pending messages (already delivered ones are skipped), urgent first
+			var pending []*messages.Message
 			for _, msg := range unreadMsgs {
-				if msg.Status != messages.StatusPending {
-					// Already delivered, skip
-					continue
+				if msg.Status == messages.StatusPending {
+					pending = append(pending, msg)
 				}
+			}
+			if len(pending) == 0 {
+				continue
+			}
+			sortForDelivery(pending)
 
-				// Format message for delivery
-				messageText := fmt.Sprintf("📨 Message from %s: %s", msg.From, msg.Body)
+			// Apply backpressure: deliver a bounded batch now and the rest on the next pass
+			if len(pending) > maxMessagesPerDelivery {
+				pending = pending[:maxMessagesPerDelivery]
+				d.requestMessageRouting()
+			}
 
-				// Send via tmux using atomic method to avoid race conditions
-				// where Enter might be lost between separate exec calls (issue #63)
-				if err := d.tmux.SendKeysLiteralWithEnter(d.ctx, repo.TmuxSession, agent.TmuxWindow, messageText); err != nil {
-					d.logger.Error("Failed to deliver message %s to %s/%s: %v", msg.ID, repoName, agentName, err)
-					continue
-				}
+			// Format messages for delivery
+			texts := make([]string, len(pending))
+			for i, msg := range pending {
+				texts[i] = formatDelivery(msgMgr, repoName, msg)
+			}
+			messageText := strings.Join(texts, "\n\n")
+
+			// Send via tmux using atomic method to avoid race conditions
+			// where Enter might be lost between separate exec calls (issue #63)
+			if err := d.tmux.SendKeysLiteralWithEnter(d.ctx, repo.TmuxSession, agent.TmuxWindow, messageText); err != nil {
+				d.logger.Error("Failed to deliver %d message(s) to %s/%s: %v", len(pending), repoName, agentName, err)
+				continue
+			}
 
-				// Mark as delivered
+			// Mark as delivered
+			for _, msg := range pending {
 				if err := msgMgr.UpdateStatus(repoName, agentName, msg.ID, messages.StatusDelivered); err != nil {
 					d.logger.Error("Failed to update message %s status: %v", msg.ID, err)
 					continue
 				}
 
 				d.logger.Info("Delivered message %s from %s to %s/%s", msg.ID, msg.From, repoName, agentName)
+				d.publishEvent(events.MessageDelivered, repoName, agentName, map[string]interface{}{
+					"message_id": msg.ID,
+					"from":       msg.From,
+				})
 			}
 		}
 	}
@@ -425,7 +641,9 @@ func (d *Daemon) routeMessages() {
 
 // getMessageManager returns a message manager instance
 func (d *Daemon) getMessageManager() *messages.Manager {
-	return messages.NewManager(d.paths.MessagesDir)
+	return messages.NewManager(d.paths.MessagesDir).WithSendHook(func(repoName, to string) {
+		d.requestMessageRouting()
+	}).WithResolver(d.resolveMessageGroup)
 }
 
 // wakeLoop periodically wakes agents with status checks
@@ -433,7 +651,8 @@ func (d *Daemon) wakeLoop() {
 	d.periodicLoop("wake", 2*time.Minute, nil, d.wakeAgents)
 }
 
-// wakeAgents sends periodic nudges to agents
+// wakeAgents sends periodic nudges to agents. Agents that are busy, blocked on a
+// permission prompt, or crashed are skipped so the nudge doesn't interrupt them.
 func (d *Daemon) wakeAgents() {
 	d.logger.Debug("Waking agents")
 
@@ -443,8 +662,9 @@ func (d *Daemon) wakeAgents() {
 	repos := d.state.GetAllRepos()
 	for repoName, repo := range repos {
 		for agentName, agent := range repo.Agents {
-			// Skip workspace agent - it should only receive direct user input
-			if agent.Type == state.AgentTypeWorkspace {
+			// Skip workspace agent - it should only receive direct user input,
+			// and headless agents, which can't be nudged
+			if agent.Type == state.AgentTypeWorkspace || agent.Headless {
 				continue
 			}
 
@@ -453,6 +673,13 @@ func (d *Daemon) wakeAgents() {
 				continue
 			}
 
+			// Only nudge agents that aren't in the middle of something
+			switch d.refreshAgentActivity(repoName, repo.TmuxSession, agentName, agent) {
+			case state.ActivityBusy, state.ActivityWaitingPermission, state.ActivityCrashed:
+				d.logger.Debug("Skipping wake for agent %s: not idle", agentName)
+				continue
+			}
+
 			// Send wake message based on agent type
 			var message string
 			switch agent.Type {
@@ -470,13 +697,21 @@ func (d *Daemon) wakeAgents() {
 				message = "Status check: Update on your progress?"
 			}
 
+			// Tell the supervisor how much of the day's token budget is left
+			if agent.Type == state.AgentTypeSupervisor {
+				message += d.budgetStatus(repoName, repo)
+			}
+
 			// Send message using atomic method to avoid race conditions (issue #63)
 			if err := d.tmux.SendKeysLiteralWithEnter(d.ctx, repo.TmuxSession, agent.TmuxWindow, message); err != nil {
 				d.logger.Error("Failed to send wake message to agent %s: %v", agentName, err)
 				continue
 			}
 
-			// Update last nudge time
+			// Update last nudge time (re-read so the activity just recorded is kept)
+			if current, exists := d.state.GetAgent(repoName, agentName); exists {
+				agent = current
+			}
 			agent.LastNudge = now
 			if err := d.state.UpdateAgent(repoName, agentName, agent); err != nil {
 				d.logger.Error("Failed to update agent %s last nudge: %v", agentName, err)
@@ -487,7 +722,7 @@ func (d *Daemon) wakeAgents() {
 	}
 }
 
-// worktreeRefreshLoop periodically syncs worker worktrees with main branch
+// worktreeRefreshLoop periodically syncs agent worktrees with main branch
 func (d *Daemon) worktreeRefreshLoop() {
 	defer d.wg.Done()
 	d.logger.Info("Starting worktree refresh loop")
@@ -516,225 +751,772 @@ func (d *Daemon) worktreeRefreshLoop() {
 	}
 }
 
-// refreshWorktrees syncs worker worktrees that are behind main
-func (d *Daemon) refreshWorktrees() {
-	d.logger.Debug("Checking worker worktrees for refresh")
-
-	repos := d.state.GetAllRepos()
-	for repoName, repo := range repos {
-		repoPath := d.paths.RepoDir(repoName)
-
-		// Check if repo path exists
-		if _, err := os.Stat(repoPath); os.IsNotExist(err) {
-			continue
-		}
+// TriggerWorktreeRefresh triggers an immediate worktree refresh (for testing)
+func (d *Daemon) TriggerWorktreeRefresh() {
+	d.refreshWorktrees()
+}
 
-		wt := worktree.NewManager(repoPath)
+// taskDependencyLoop periodically spawns pending tasks whose dependencies have merged
+// and queued tasks once worker slots free up
+func (d *Daemon) taskDependencyLoop() {
+	d.periodicLoop("task dependency", 1*time.Minute, d.dispatchTasks, d.dispatchTasks)
+}
 
-		// Get the upstream remote and default branch
-		remote, err := wt.GetUpstreamRemote()
-		if err != nil {
-			d.logger.Debug("Could not get remote for %s: %v", repoName, err)
-			continue
-		}
+// dispatchTasks spawns pending tasks whose dependencies merged and drains the worker queue
+func (d *Daemon) dispatchTasks() {
+	d.resolvePendingTasks()
+	d.TriggerQueueDrain()
+}
 
-		mainBranch, err := wt.GetDefaultBranch(remote)
-		if err != nil {
-			d.logger.Debug("Could not get default branch for %s: %v", repoName, err)
-			continue
-		}
+// resolvePendingTasks checks every pending task's dependencies and spawns the task
+// from the latest main branch once all of them have merged.
+func (d *Daemon) resolvePendingTasks() {
+	d.logger.Debug("Resolving pending tasks")
 
-		// Fetch from remote to have latest state
-		if err := wt.FetchRemote(remote); err != nil {
-			d.logger.Debug("Could not fetch from remote for %s: %v", repoName, err)
+	repos := d.state.GetAllRepos()
+	for repoName, repo := range repos {
+		if len(repo.PendingTasks) == 0 {
 			continue
 		}
 
-		// Check each worker agent's worktree
-		for agentName, agent := range repo.Agents {
-			// Only refresh worker worktrees
-			if agent.Type != state.AgentTypeWorker {
-				continue
+		repoPath := d.paths.RepoDir(repoName)
+		for _, task := range repo.PendingTasks {
+			// Resolved without dispatchMu, since this may ask GitHub
+			states := d.dependencyStates(repoName, repoPath, task.DependsOn)
+
+			ready := true
+			var failed []string
+			for _, dep := range task.DependsOn {
+				switch states[dep] {
+				case state.DependencyFailed:
+					failed = append(failed, dep)
+					ready = false
+				case state.DependencyWaiting:
+					ready = false
+				}
 			}
 
-			// Skip if worktree path is empty
-			if agent.WorktreePath == "" {
+			if len(failed) > 0 {
+				d.blockPendingTask(repoName, task, failed)
 				continue
 			}
 
-			// Check if worktree exists
-			if _, err := os.Stat(agent.WorktreePath); os.IsNotExist(err) {
+			if !ready {
 				continue
 			}
 
-			// Check worktree state
-			wtState, err := worktree.GetWorktreeState(agent.WorktreePath, remote, mainBranch)
+			claimed, queued, err := d.claimPendingTaskSlot(repoName, task.Name)
 			if err != nil {
-				d.logger.Debug("Could not get worktree state for %s/%s: %v", repoName, agentName, err)
+				d.logger.Error("Failed to dispatch pending task %s/%s: %v", repoName, task.Name, err)
 				continue
 			}
-
-			// Skip if can't refresh (detached HEAD, mid-rebase, mid-merge, on main, or up to date)
-			if !wtState.CanRefresh {
-				d.logger.Debug("Skipping refresh for %s/%s: %s", repoName, agentName, wtState.RefreshReason)
+			if claimed == nil {
+				d.logger.Debug("Pending task %s/%s was removed or claimed while its dependencies were checked", repoName, task.Name)
 				continue
 			}
-
-			// Refresh the worktree
-			d.logger.Info("Refreshing worktree for %s/%s (%d commits behind)", repoName, agentName, wtState.CommitsBehind)
-			result := worktree.RefreshWorktree(agent.WorktreePath, remote, mainBranch)
-
-			if result.Error != nil {
-				if result.HasConflicts {
-					d.logger.Warn("Worktree refresh for %s/%s has conflicts in: %v", repoName, agentName, result.ConflictFiles)
-				} else {
-					d.logger.Error("Failed to refresh worktree for %s/%s: %v", repoName, agentName, result.Error)
-				}
-			} else if result.Skipped {
-				d.logger.Debug("Worktree refresh for %s/%s skipped: %s", repoName, agentName, result.SkipReason)
+			task := *claimed
+			if queued {
+				d.logger.Info("Dependencies of pending task %s/%s have merged, queued until a worker slot frees up", repoName, task.Name)
 			} else {
-				d.logger.Info("Refreshed worktree for %s/%s: rebased %d commits", repoName, agentName, result.CommitsRebased)
+				d.logger.Info("Dependencies of pending task %s/%s have merged, spawning worker", repoName, task.Name)
+				err := d.spawnWithReservedSlot(repoName, task.Name, func() error {
+					return d.spawnWorker(repoName, task.Name, task.Task, task.DependsOn, task.Profile)
+				})
+				if err != nil {
+					d.logger.Error("Failed to spawn pending task %s/%s: %v", repoName, task.Name, err)
+					continue
+				}
 
-				// Notify the agent that their worktree was refreshed
-				msgMgr := d.getMessageManager()
-				msg := fmt.Sprintf("Your worktree has been automatically synced with main (rebased %d commits). Run 'git log --oneline -5' to see recent changes.", result.CommitsRebased)
-				if _, err := msgMgr.Send(repoName, "daemon", agentName, msg); err != nil {
-					d.logger.Debug("Could not send refresh notification to %s/%s: %v", repoName, agentName, err)
+				if err := d.state.RemovePendingTask(repoName, task.Name); err != nil {
+					d.logger.Error("Failed to remove pending task %s/%s: %v", repoName, task.Name, err)
 				}
 			}
+
+			msgMgr := d.getMessageManager()
+			msg := fmt.Sprintf("Pending task '%s' is unblocked (%s merged) and its worker has been spawned: %s", task.Name, strings.Join(task.DependsOn, ", "), task.Task)
+			if queued {
+				msg = fmt.Sprintf("Pending task '%s' is unblocked (%s merged) and has been queued until a worker slot frees up: %s", task.Name, strings.Join(task.DependsOn, ", "), task.Task)
+			}
+			if _, err := msgMgr.Send(repoName, "daemon", "supervisor", msg); err != nil {
+				d.logger.Debug("Could not notify supervisor about spawned task %s: %v", task.Name, err)
+			}
 		}
 	}
 }
 
-// TriggerWorktreeRefresh triggers an immediate worktree refresh (for testing)
-func (d *Daemon) TriggerWorktreeRefresh() {
-	d.refreshWorktrees()
-}
-
-// handleRequest handles incoming socket requests
-func (d *Daemon) handleRequest(req socket.Request) socket.Response {
-	d.logger.Debug("Handling request: %s", req.Command)
+// claimPendingTaskSlot reserves a worker slot for a pending task whose
+// dependencies have merged, so its worker can be spawned without holding
+// dispatchMu. When the repository is at its worker limit the task is moved to
+// the worker queue instead. The task is looked up again under dispatchMu, since
+// its dependencies were checked without it: a task that was removed in the
+// meantime, or that another dispatch already claimed, is left alone and nil is
+// returned. Otherwise returns the task and whether it was queued.
+func (d *Daemon) claimPendingTaskSlot(repoName, taskName string) (*state.PendingTask, bool, error) {
+	d.dispatchMu.Lock()
+	defer d.dispatchMu.Unlock()
+
+	pending, err := d.state.GetPendingTasks(repoName)
+	if err != nil {
+		return nil, false, err
+	}
+	var task *state.PendingTask
+	for i := range pending {
+		if pending[i].Name == taskName {
+			task = &pending[i]
+			break
+		}
+	}
+	if task == nil || d.hasReservationUnlocked(repoName, taskName) {
+		return nil, false, nil
+	}
+	if _, exists := d.state.GetAgent(repoName, taskName); exists {
+		return nil, false, nil
+	}
 
-	switch req.Command {
-	case "ping":
-		return socket.SuccessResponse("pong")
+	if d.hasWorkerSlotUnlocked(repoName) {
+		d.reserveWorkerSlotUnlocked(repoName, taskName)
+		return task, false, nil
+	}
 
-	case "status":
-		return d.handleStatus(req)
+	if err := d.state.RemovePendingTask(repoName, taskName); err != nil {
+		return nil, false, fmt.Errorf("failed to remove pending task: %w", err)
+	}
+	if _, err := d.state.EnqueueTask(repoName, state.QueuedTask{
+		Name:      task.Name,
+		Task:      task.Task,
+		DependsOn: task.DependsOn,
+		Profile:   task.Profile,
+		QueuedAt:  time.Now(),
+	}); err != nil {
+		return nil, false, fmt.Errorf("failed to queue pending task: %w", err)
+	}
+	return task, true, nil
+}
 
-	case "stop":
-		go func() {
-			time.Sleep(100 * time.Millisecond)
-			d.Stop()
-		}()
-		return socket.SuccessResponse("Daemon stopping")
+// slotReservationTTL bounds how long a reserved worker slot is held for a CLI
+// that has not registered its worker yet (e.g., because it crashed mid-create)
+const slotReservationTTL = 10 * time.Minute
 
-	case "list_repos":
-		return d.handleListRepos(req)
+// activeWorkerCountUnlocked counts workers that occupy a slot: running workers that
+// have not completed, plus unexpired reservations for workers still being created.
+// Caller must hold dispatchMu.
+func (d *Daemon) activeWorkerCountUnlocked(repoName string) int {
+	repo, exists := d.state.GetRepo(repoName)
+	if !exists {
+		return 0
+	}
 
-	case "add_repo":
-		return d.handleAddRepo(req)
+	count := 0
+	for _, agent := range repo.Agents {
+		if agent.Type == state.AgentTypeWorker && !agent.ReadyForCleanup {
+			count++
+		}
+	}
 
-	case "remove_repo":
-		return d.handleRemoveRepo(req)
+	prefix := repoName + "/"
+	for key, reservedAt := range d.slotReservations {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if _, registered := repo.Agents[strings.TrimPrefix(key, prefix)]; registered || time.Since(reservedAt) > slotReservationTTL {
+			delete(d.slotReservations, key)
+			continue
+		}
+		count++
+	}
 
-	case "add_agent":
-		return d.handleAddAgent(req)
+	return count
+}
 
-	case "remove_agent":
-		return d.handleRemoveAgent(req)
+// reserveWorkerSlotUnlocked holds a worker slot for a worker that is about to
+// be spawned. The reservation lapses once the worker registers.
+// Caller must hold dispatchMu.
+func (d *Daemon) reserveWorkerSlotUnlocked(repoName, workerName string) {
+	if d.slotReservations == nil {
+		d.slotReservations = make(map[string]time.Time)
+	}
+	d.slotReservations[repoName+"/"+workerName] = time.Now()
+}
 
-	case "list_agents":
-		return d.handleListAgents(req)
+// hasReservationUnlocked reports whether a worker slot is reserved for the
+// worker and the reservation hasn't lapsed. Caller must hold dispatchMu.
+func (d *Daemon) hasReservationUnlocked(repoName, workerName string) bool {
+	reservedAt, reserved := d.slotReservations[repoName+"/"+workerName]
+	return reserved && time.Since(reservedAt) <= slotReservationTTL
+}
 
-	case "complete_agent":
-		return d.handleCompleteAgent(req)
+// reserveWorkerSlot reserves a worker slot for a worker the daemon is about
+// to spawn, if one is free, so the spawn can run without holding dispatchMu
+func (d *Daemon) reserveWorkerSlot(repoName, workerName string) bool {
+	d.dispatchMu.Lock()
+	defer d.dispatchMu.Unlock()
 
-	case "restart_agent":
-		return d.handleRestartAgent(req)
+	if !d.hasWorkerSlotUnlocked(repoName) {
+		return false
+	}
+	d.reserveWorkerSlotUnlocked(repoName, workerName)
+	return true
+}
 
-	case "trigger_cleanup":
-		return d.handleTriggerCleanup(req)
+// releaseWorkerSlot gives back the slot reserved for a worker, e.g. after its
+// spawn failed
+func (d *Daemon) releaseWorkerSlot(repoName, workerName string) {
+	d.dispatchMu.Lock()
+	defer d.dispatchMu.Unlock()
+	delete(d.slotReservations, repoName+"/"+workerName)
+}
 
-	case "repair_state":
-		return d.handleRepairState(req)
+// claimWorkerSlot makes sure a worker about to be created through the socket
+// holds a slot: the one reserve_worker_slot reserved for it, or a free one
+// reserved now. A worker that would go past the repository's limit, or ahead
+// of queued tasks, is refused rather than queued.
+func (d *Daemon) claimWorkerSlot(repoName, workerName string) error {
+	d.dispatchMu.Lock()
+	defer d.dispatchMu.Unlock()
 
-	case "get_repo_config":
-		return d.handleGetRepoConfig(req)
+	if d.hasReservationUnlocked(repoName, workerName) {
+		return nil
+	}
 
-	case "update_repo_config":
-		return d.handleUpdateRepoConfig(req)
+	if d.budgetExhausted(repoName) {
+		return budgetExhaustedError(repoName, time.Now())
+	}
+	if queue, _ := d.state.GetWorkerQueue(repoName); len(queue) > 0 {
+		return fmt.Errorf("repository %q has %d queued tasks waiting for a worker slot; reserve a slot with reserve_worker_slot first", repoName, len(queue))
+	}
+	if !d.hasWorkerSlotUnlocked(repoName) {
+		maxWorkers, _ := d.state.GetMaxWorkers(repoName)
+		return fmt.Errorf("repository %q is at its limit of %d workers; wait for a worker to finish or raise the limit with: multiclaude config %s --max-workers=<n>", repoName, maxWorkers, repoName)
+	}
+	d.reserveWorkerSlotUnlocked(repoName, workerName)
+	return nil
+}
 
-	case "set_current_repo":
-		return d.handleSetCurrentRepo(req)
+// spawnWithReservedSlot runs spawn for a worker whose slot is reserved, without
+// holding dispatchMu, and gives the reservation back afterwards: a registered
+// worker takes its place, and a failed spawn frees the slot.
+func (d *Daemon) spawnWithReservedSlot(repoName, workerName string, spawn func() error) error {
+	defer d.releaseWorkerSlot(repoName, workerName)
+	return spawn()
+}
 
-	case "get_current_repo":
-		return d.handleGetCurrentRepo(req)
+// hasWorkerSlotUnlocked reports whether another worker may start in the repo:
+// it is under its worker limit and its token budget isn't capped for the day.
+// Caller must hold dispatchMu.
+func (d *Daemon) hasWorkerSlotUnlocked(repoName string) bool {
+	if d.budgetExhausted(repoName) {
+		return false
+	}
+	maxWorkers, err := d.state.GetMaxWorkers(repoName)
+	if err != nil || maxWorkers <= 0 {
+		return true
+	}
+	return d.activeWorkerCountUnlocked(repoName) < maxWorkers
+}
 
-	case "clear_current_repo":
-		return d.handleClearCurrentRepo(req)
+// TriggerQueueDrain drains the worker queue of every repository (for testing)
+func (d *Daemon) TriggerQueueDrain() {
+	for _, repoName := range d.state.ListRepos() {
+		d.drainWorkerQueue(repoName)
+	}
+}
 
-	case "route_messages":
-		go d.routeMessages()
-		return socket.SuccessResponse("Message routing triggered")
+// drainWorkerQueue spawns queued tasks in FIFO order while the repo has free worker slots.
+// It runs when workers complete or are cleaned up, and periodically as a fallback.
+func (d *Daemon) drainWorkerQueue(repoName string) {
+	for {
+		task, ok := d.dequeueWithSlot(repoName)
+		if !ok {
+			return
+		}
 
-	case "task_history":
-		return d.handleTaskHistory(req)
+		d.logger.Info("Worker slot available in %s, spawning queued task %s", repoName, task.Name)
+		err := d.spawnWithReservedSlot(repoName, task.Name, func() error {
+			return d.spawnWorker(repoName, task.Name, task.Task, task.DependsOn, task.Profile)
+		})
+		if err != nil {
+			// Drop the task rather than retrying it forever at the head of the queue
+			d.logger.Error("Failed to spawn queued task %s/%s: %v", repoName, task.Name, err)
+			msgMgr := d.getMessageManager()
+			msg := fmt.Sprintf("Queued task '%s' could not be spawned and was removed from the queue: %v. Task: %s", task.Name, err, task.Task)
+			if _, err := msgMgr.Send(repoName, "daemon", "supervisor", msg); err != nil {
+				d.logger.Debug("Could not notify supervisor about failed queued task %s: %v", task.Name, err)
+			}
+		}
+	}
+}
 
-	case "spawn_agent":
-		return d.handleSpawnAgent(req)
+// dequeueWithSlot takes the task at the head of the worker queue and
+// reserves a worker slot for it, if the repository has one free. The worker is
+// spawned without holding dispatchMu.
+func (d *Daemon) dequeueWithSlot(repoName string) (state.QueuedTask, bool) {
+	d.dispatchMu.Lock()
+	defer d.dispatchMu.Unlock()
 
-	case "trigger_refresh":
-		return d.handleTriggerRefresh(req)
+	if !d.hasWorkerSlotUnlocked(repoName) {
+		return state.QueuedTask{}, false
+	}
+	queue, err := d.state.GetWorkerQueue(repoName)
+	if err != nil || len(queue) == 0 {
+		return state.QueuedTask{}, false
+	}
 
-	default:
-		return socket.ErrorResponse("unknown command: %q. Run 'multiclaude --help' for available commands", req.Command)
+	task := queue[0]
+	if err := d.state.RemoveQueuedTask(repoName, task.Name); err != nil {
+		d.logger.Error("Failed to dequeue task %s/%s: %v", repoName, task.Name, err)
+		return state.QueuedTask{}, false
 	}
+	d.reserveWorkerSlotUnlocked(repoName, task.Name)
+	return task, true
 }
 
-// handleStatus returns daemon status
-func (d *Daemon) handleStatus(req socket.Request) socket.Response {
-	repos := d.state.ListRepos()
-	agentCount := 0
-	for _, repo := range repos {
-		agents, _ := d.state.ListAgents(repo)
-		agentCount += len(agents)
+// blockPendingTask records that a pending task can never start because one of its
+// dependencies will not merge, and tells the supervisor the first time this happens.
+func (d *Daemon) blockPendingTask(repoName string, task state.PendingTask, failed []string) {
+	reason := fmt.Sprintf("dependency did not merge: %s", strings.Join(failed, ", "))
+	if task.BlockedReason == reason {
+		return
 	}
 
-	return socket.SuccessResponse(map[string]interface{}{
-		"running":     true,
-		"pid":         os.Getpid(),
-		"repos":       len(repos),
-		"agents":      agentCount,
-		"socket_path": d.paths.DaemonSock,
-	})
+	if err := d.state.UpdatePendingTaskBlockedReason(repoName, task.Name, reason); err != nil {
+		d.logger.Error("Failed to mark pending task %s/%s as blocked: %v", repoName, task.Name, err)
+		return
+	}
+
+	d.logger.Warn("Pending task %s/%s is blocked: %s", repoName, task.Name, reason)
+
+	msgMgr := d.getMessageManager()
+	msg := fmt.Sprintf("Pending task '%s' cannot start because its %s. Remove it with 'multiclaude worker rm %s' or recreate it with different dependencies.", task.Name, reason, task.Name)
+	if _, err := msgMgr.Send(repoName, "daemon", "supervisor", msg); err != nil {
+		d.logger.Debug("Could not notify supervisor about blocked task %s: %v", task.Name, err)
+	}
 }
 
-// handleListRepos lists all repositories with detailed status
-func (d *Daemon) handleListRepos(req socket.Request) socket.Response {
-	repos := d.state.GetAllRepos()
+// dependencyStates resolves each dependency against the task history. Dependencies that
+// are still waiting are re-checked on GitHub so merged PRs are picked up without anyone
+// running 'repo history', and the result is written back to the task history.
+func (d *Daemon) dependencyStates(repoName, repoPath string, deps []string) map[string]state.DependencyState {
+	history, err := d.state.GetTaskHistory(repoName, 0)
+	if err != nil {
+		history = nil
+	}
 
-	// Check if rich format is requested
-	rich := getOptionalBoolArg(req.Args, "rich", false)
-	if !rich {
-		// Return simple list for backward compatibility
-		repoNames := make([]string, 0, len(repos))
-		for name := range repos {
-			repoNames = append(repoNames, name)
+	states := make(map[string]state.DependencyState, len(deps))
+	for _, dep := range deps {
+		depState := state.ResolveDependency(history, dep)
+		if depState == state.DependencyWaiting {
+			depState = d.refreshDependency(repoName, repoPath, history, dep)
 		}
-		return socket.SuccessResponse(repoNames)
+		states[dep] = depState
+	}
+	return states
+}
+
+// refreshDependency queries GitHub for a dependency that is still waiting.
+// Worker dependencies are only checked once the worker has completed and has a history entry.
+func (d *Daemon) refreshDependency(repoName, repoPath string, history []state.TaskHistoryEntry, dep string) state.DependencyState {
+	entry, found := state.FindDependency(history, dep)
+
+	ref := ""
+	switch {
+	case found && entry.PRNumber > 0:
+		ref = strconv.Itoa(entry.PRNumber)
+	case found && entry.Branch != "":
+		ref = entry.Branch
+	case !found:
+		if prNumber, isPR := state.ParsePRDependency(dep); isPR {
+			ref = strconv.Itoa(prNumber)
+		}
+	}
+	if ref == "" {
+		return state.DependencyWaiting
+	}
+
+	status, prURL, prNumber, err := d.queryPRStatus(repoPath, ref)
+	if err != nil {
+		d.logger.Debug("Could not query PR status for dependency %s/%s: %v", repoName, dep, err)
+		return state.DependencyWaiting
+	}
+
+	if found && (status != entry.Status || prNumber != entry.PRNumber) {
+		if err := d.state.UpdateTaskHistoryStatus(repoName, entry.Name, status, prURL, prNumber); err != nil {
+			d.logger.Debug("Could not update task history for %s/%s: %v", repoName, entry.Name, err)
+		} else {
+			d.publishEvent(events.TaskStatusChanged, repoName, entry.Name, map[string]interface{}{
+				"status":          string(status),
+				"previous_status": string(entry.Status),
+				"pr_url":          prURL,
+				"pr_number":       prNumber,
+			})
+		}
+	}
+
+	switch status {
+	case state.TaskStatusMerged:
+		return state.DependencyMerged
+	case state.TaskStatusClosed:
+		return state.DependencyFailed
+	default:
+		return state.DependencyWaiting
+	}
+}
+
+// spawnWorker creates a worker on a fresh branch from the latest upstream main,
+// starts Claude with the task, and registers the worker with state.
+// This is used for workers the daemon starts on its own, such as pending tasks.
+func (d *Daemon) spawnWorker(repoName, workerName, task string, dependsOn []string, profile state.AgentProfile) error {
+	if _, exists := d.state.GetRepo(repoName); !exists {
+		return fmt.Errorf("repository %q not found", repoName)
+	}
+
+	startPoint := d.latestMain(repoName)
+	spec, err := d.workerSpec(repoName, workerName, task, startPoint, "", profile)
+	if err != nil {
+		return err
+	}
+	spec.dependsOn = dependsOn
+	if _, err := d.spawnAgent(spec); err != nil {
+		return err
+	}
+
+	d.logger.Info("Spawned worker %s/%s from %s", repoName, workerName, startPoint)
+	return nil
+}
+
+// spawnBranchWorker creates a worker that iterates on an existing PR branch,
+// like 'worker create --branch origin/<branch> --push-to <branch>'.
+func (d *Daemon) spawnBranchWorker(repoName, workerName, branch, task string) error {
+	if _, exists := d.state.GetRepo(repoName); !exists {
+		return fmt.Errorf("repository %q not found", repoName)
+	}
+
+	// Prefer the pushed branch so the worker sees every commit on the PR
+	wt := worktree.NewManager(d.paths.RepoDir(repoName))
+	startPoint := branch
+	if err := wt.FetchRemote("origin"); err != nil {
+		d.logger.Warn("Failed to fetch origin for %s: %v (continuing with local refs)", repoName, err)
+	} else if exists, err := wt.RemoteBranchExists("origin", branch); err == nil && exists {
+		startPoint = "origin/" + branch
+	}
+
+	spec, err := d.workerSpec(repoName, workerName, task, startPoint, branch, state.AgentProfile{})
+	if err != nil {
+		return err
+	}
+	// A stale local branch is moved to the pushed commit
+	spec.resetBranch = true
+	if _, err := d.spawnAgent(spec); err != nil {
+		return err
+	}
+
+	d.logger.Info("Spawned worker %s/%s on branch %s", repoName, workerName, branch)
+	return nil
+}
+
+// latestMain fetches the upstream remote and returns its main branch, so new
+// workers see merged work. Repos without a remote (e.g., local test repos)
+// fall back to HEAD.
+func (d *Daemon) latestMain(repoName string) string {
+	wt := worktree.NewManager(d.paths.RepoDir(repoName))
+	remote, err := wt.GetUpstreamRemote()
+	if err != nil {
+		return "HEAD"
+	}
+	if err := wt.FetchRemote(remote); err != nil {
+		d.logger.Warn("Failed to fetch %s for %s: %v (continuing with local refs)", remote, repoName, err)
+	}
+	mainBranch, err := wt.GetDefaultBranch(remote)
+	if err != nil {
+		return "HEAD"
+	}
+	return fmt.Sprintf("%s/%s", remote, mainBranch)
+}
+
+// workerSpec returns the spawn spec of a worker for task. The worker gets a
+// new work/<name> branch from startPoint, or when pushTo is set iterates on
+// that PR branch instead of opening a new PR. Fields of profile that are unset
+// come from the worker agent definition, which also picks the runner.
+func (d *Daemon) workerSpec(repoName, workerName, task, startPoint, pushTo string, profile state.AgentProfile) (spawnSpec, error) {
+	d.copyMissingAgentTemplates(repoName)
+	prompt, err := d.workerPrompt(repoName, pushTo)
+	if err != nil {
+		return spawnSpec{}, fmt.Errorf("failed to write worker prompt: %w", err)
+	}
+
+	def := d.agentDefinition(repoName, "worker")
+	spec := spawnSpec{
+		repo:           repoName,
+		name:           workerName,
+		agentType:      state.AgentTypeWorker,
+		branch:         fmt.Sprintf("work/%s", workerName),
+		startPoint:     startPoint,
+		prompt:         prompt,
+		initialMessage: fmt.Sprintf("Task: %s", task),
+		task:           task,
+		profile:        profile.Merge(def.Profile),
+		headless:       d.runsHeadless(repoName, state.AgentTypeWorker, def),
+	}
+	if pushTo != "" {
+		spec.branch = pushTo
+		spec.existingBranch = true
+	}
+	return spec, nil
+}
+
+// copyMissingAgentTemplates copies the agent templates into a repository
+// that has no agent definitions yet. Spawns and restarts call it before they
+// build a prompt, so building one, e.g. for the agent_prompt query, only reads.
+func (d *Daemon) copyMissingAgentTemplates(repoName string) {
+	agentsDir := d.paths.RepoAgentsDir(repoName)
+	if _, err := os.Stat(agentsDir); !os.IsNotExist(err) {
+		return
+	}
+	if err := templates.CopyAgentTemplates(agentsDir); err != nil {
+		d.logger.Warn("Failed to copy agent templates for %s: %v", repoName, err)
+	}
+}
+
+// workerPrompt returns the prompt of a worker. The worker agent definition is
+// prepended to the base worker prompt, and workers iterating on an existing
+// PR are told to push to pushTo.
+func (d *Daemon) workerPrompt(repoName, pushTo string) (string, error) {
+	repoPath := d.paths.RepoDir(repoName)
+	agentsDir := d.paths.RepoAgentsDir(repoName)
+
+	prefix := ""
+	reader := agents.NewReader(agentsDir, repoPath)
+	if definitions, err := reader.ReadAllDefinitions(); err == nil {
+		for _, def := range definitions {
+			if def.Name == "worker" {
+				prefix = def.Content
+				break
+			}
+		}
+	}
+
+	if forkConfig, err := d.state.GetForkConfig(repoName); err == nil && forkConfig.IsFork {
+		forkOwner := forkConfig.UpstreamOwner
+		if repo, exists := d.state.GetRepo(repoName); exists {
+			if owner, _, err := fork.ParseGitHubURL(repo.GithubURL); err == nil {
+				forkOwner = owner
+			}
+		}
+		forkPrompt := prompts.GenerateForkWorkflowPrompt(forkConfig.UpstreamOwner, forkConfig.UpstreamRepo, forkOwner)
+		prefix = forkPrompt + "\n---\n\n" + prefix
+	}
+
+	if pushTo != "" {
+		prefix = prompts.GeneratePushToPrompt(pushTo) + prefix
+	}
+
+	return d.agentPrompt(repoName, state.AgentTypeWorker, prefix)
+}
+
+// definitionProfile returns the profile from the front matter of the named
+// agent definition, or the zero profile if there is no such definition.
+func (d *Daemon) definitionProfile(repoName, name string) state.AgentProfile {
+	return d.agentDefinition(repoName, name).Profile
+}
+
+// agentDefinition returns the named agent definition, or the zero definition
+// if there is no such definition.
+func (d *Daemon) agentDefinition(repoName, name string) agents.Definition {
+	reader := agents.NewReader(d.paths.RepoAgentsDir(repoName), d.paths.RepoDir(repoName))
+	def, found, err := reader.ReadDefinition(name)
+	if err != nil || !found {
+		return agents.Definition{}
+	}
+	return def
+}
+
+// handleRequest handles incoming socket requests
+func (d *Daemon) handleRequest(req socket.Request) socket.Response {
+	d.logger.Debug("Handling request: %s", req.Command)
+
+	switch req.Command {
+	case "ping":
+		return socket.SuccessResponse("pong")
+
+	case "status":
+		return d.handleStatus(req)
+
+	case "stop":
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			d.Stop()
+		}()
+		return socket.SuccessResponse("Daemon stopping")
+
+	case "list_repos":
+		return d.handleListRepos(req)
+
+	case "add_repo":
+		return d.handleAddRepo(req)
+
+	case "remove_repo":
+		return d.handleRemoveRepo(req)
+
+	case "add_agent":
+		return d.handleAddAgent(req)
+
+	case "remove_agent":
+		return d.handleRemoveAgent(req)
+
+	case "list_agents":
+		return d.handleListAgents(req)
+
+	case "complete_agent":
+		return d.handleCompleteAgent(req)
+
+	case "restart_agent":
+		return d.handleRestartAgent(req)
+
+	case "trigger_cleanup":
+		return d.handleTriggerCleanup(req)
+
+	case "repair_state":
+		return d.handleRepairState(req)
+
+	case "get_repo_config":
+		return d.handleGetRepoConfig(req)
+
+	case "update_repo_config":
+		return d.handleUpdateRepoConfig(req)
+
+	case "set_current_repo":
+		return d.handleSetCurrentRepo(req)
+
+	case "get_current_repo":
+		return d.handleGetCurrentRepo(req)
+
+	case "clear_current_repo":
+		return d.handleClearCurrentRepo(req)
+
+	case "route_messages":
+		if getOptionalBoolArg(req.Args, "urgent", false) {
+			d.requestUrgentMessageRouting()
+		} else {
+			d.requestMessageRouting()
+		}
+		return socket.SuccessResponse("Message routing triggered")
+
+	case "send_message":
+		return d.handleSendMessage(req)
+
+	case "gc_messages":
+		return d.handleGCMessages(req)
+
+	case "task_history":
+		return d.handleTaskHistory(req)
+
+	case "create_agent":
+		return d.handleCreateAgent(req)
+
+	case "spawn_agent":
+		return d.handleSpawnAgent(req)
+
+	case "trigger_refresh":
+		return d.handleTriggerRefresh(req)
+
+	case "set_agent_refresh":
+		return d.handleSetAgentRefresh(req)
+
+	case "agent_prompt":
+		return d.handleAgentPrompt(req)
+
+	case "launch_args":
+		return d.handleLaunchArgs(req)
+
+	case "add_pending_task":
+		return d.handleAddPendingTask(req)
+
+	case "list_pending_tasks":
+		return d.handleListPendingTasks(req)
+
+	case "remove_pending_task":
+		return d.handleRemovePendingTask(req)
+
+	case "reserve_worker_slot":
+		return d.handleReserveWorkerSlot(req)
+
+	case "list_worker_queue":
+		return d.handleListWorkerQueue(req)
+
+	case "remove_queued_task":
+		return d.handleRemoveQueuedTask(req)
+
+	case "promote_queued_task":
+		return d.handlePromoteQueuedTask(req)
+
+	case "list_prs":
+		return d.handleListPRs(req)
+
+	case "recent_events":
+		return d.handleRecentEvents(req)
+
+	case "usage":
+		return d.handleUsage(req)
+
+	case "find_similar_tasks":
+		return d.handleFindSimilarTasks(req)
+
+	case "subscribe":
+		// Served by handleSubscribe on a streaming connection; only reachable
+		// when the request bypasses the socket server (e.g. in tests)
+		return socket.ErrorResponse("subscribe is a streaming command and must be sent with socket.Client.Subscribe")
+
+	default:
+		return socket.ErrorResponse("unknown command: %q. Run 'multiclaude --help' for available commands", req.Command)
+	}
+}
+
+// handleStatus returns daemon status
+func (d *Daemon) handleStatus(req socket.Request) socket.Response {
+	repos := d.state.ListRepos()
+	agentCount := 0
+	for _, repo := range repos {
+		agents, _ := d.state.ListAgents(repo)
+		agentCount += len(agents)
+	}
+
+	return socket.SuccessResponse(map[string]interface{}{
+		"running":     true,
+		"pid":         os.Getpid(),
+		"repos":       len(repos),
+		"agents":      agentCount,
+		"socket_path": d.paths.DaemonSock,
+	})
+}
+
+// handleListRepos lists all repositories with detailed status
+func (d *Daemon) handleListRepos(req socket.Request) socket.Response {
+	repos := d.state.GetAllRepos()
+
+	// Check if rich format is requested
+	rich := getOptionalBoolArg(req.Args, "rich", false)
+	if !rich {
+		// Return simple list for backward compatibility
+		repoNames := make([]string, 0, len(repos))
+		for name := range repos {
+			repoNames = append(repoNames, name)
+		}
+		return socket.SuccessResponse(repoNames)
 	}
 
 	// Return detailed repo info
 	repoDetails := make([]map[string]interface{}, 0, len(repos))
 	for repoName, repo := range repos {
-		// Count agents by type
+		// Count agents by type and by detected activity
 		workerCount := 0
 		totalAgents := len(repo.Agents)
+		activityCounts := make(map[string]int)
 		for _, agent := range repo.Agents {
 			if agent.Type == state.AgentTypeWorker {
 				workerCount++
 			}
+			if agent.Activity != state.ActivityUnknown {
+				activityCounts[string(agent.Activity)]++
+			}
 		}
 
 		// Check session health
@@ -760,6 +1542,8 @@ func (d *Daemon) handleListRepos(req socket.Request) socket.Response {
 			"upstream_owner":     repo.ForkConfig.UpstreamOwner,
 			"upstream_repo":      repo.ForkConfig.UpstreamRepo,
 			"pr_management_mode": prManagementMode,
+			"activity":           activityCounts,
+			"overlaps":           overlapDetails(d.repoOverlapsFound(repoName)),
 		})
 	}
 
@@ -772,6 +1556,9 @@ func (d *Daemon) handleAddRepo(req socket.Request) socket.Response {
 	if !ok {
 		return errResp
 	}
+	if err := state.ValidateRepoName(name); err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
 
 	githubURL, errResp, ok := getRequiredStringArg(req.Args, "github_url", "GitHub repository URL is required (e.g., 'https://github.com/owner/repo')")
 	if !ok {
@@ -854,6 +1641,9 @@ func (d *Daemon) handleRemoveRepo(req socket.Request) socket.Response {
 	if err := d.state.RemoveRepo(name); err != nil {
 		return socket.ErrorResponse("%s", err.Error())
 	}
+	if err := d.promptStore.RemoveRepo(name); err != nil {
+		d.logger.Warn("Failed to clean up repository %s: %v", name, err)
+	}
 
 	d.logger.Info("Removed repository: %s", name)
 	return socket.SuccessResponse(nil)
@@ -912,11 +1702,25 @@ func (d *Daemon) handleAddAgent(req socket.Request) socket.Response {
 	// Optional task field for workers
 	agent.Task = getOptionalStringArg(req.Args, "task", "")
 
+	// Optional prompt file the agent's session was started with, reused on restart
+	agent.PromptFile = getOptionalStringArg(req.Args, "prompt_file", "")
+
+	// Optional profile the agent's Claude was started with, reused on restart
+	profile, err := getOptionalProfileArg(req.Args)
+	if err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
+	agent.Profile = profile
+
 	if err := d.state.AddAgent(repoName, agentName, agent); err != nil {
 		return socket.ErrorResponse("%s", err.Error())
 	}
 
 	d.logger.Info("Added agent %s to repo %s", agentName, repoName)
+	d.publishEvent(events.AgentSpawned, repoName, agentName, map[string]interface{}{
+		"type": string(agent.Type),
+		"task": agent.Task,
+	})
 	return socket.SuccessResponse(nil)
 }
 
@@ -932,9 +1736,13 @@ func (d *Daemon) handleRemoveAgent(req socket.Request) socket.Response {
 		return errResp
 	}
 
+	d.stopHeadless(repoName, agentName)
 	if err := d.state.RemoveAgent(repoName, agentName); err != nil {
 		return socket.ErrorResponse("%s", err.Error())
 	}
+	if err := d.promptStore.Remove(repoName, agentName); err != nil {
+		d.logger.Warn("Failed to clean up agent %s/%s: %v", repoName, agentName, err)
+	}
 
 	d.logger.Info("Removed agent %s from repo %s", agentName, repoName)
 	return socket.SuccessResponse(nil)
@@ -971,7 +1779,9 @@ func (d *Daemon) handleListAgents(req socket.Request) socket.Response {
 			"type":          agent.Type,
 			"worktree_path": agent.WorktreePath,
 			"tmux_window":   agent.TmuxWindow,
+			"headless":      agent.Headless,
 			"task":          agent.Task,
+			"model":         agent.Profile.Model,
 			"created_at":    agent.CreatedAt,
 		}
 
@@ -981,6 +1791,12 @@ func (d *Daemon) handleListAgents(req socket.Request) socket.Response {
 			status := "unknown"
 			if agent.ReadyForCleanup {
 				status = "completed"
+			} else if agent.Headless {
+				// A headless agent runs while the daemon runs its process
+				status = "stopped"
+				if d.headlessRunning(repoName, agentName) {
+					status = "running"
+				}
 			} else if repoExists {
 				// Check if window exists (means agent is running)
 				hasWindow, err := d.tmux.HasWindow(d.ctx, repo.TmuxSession, agent.TmuxWindow)
@@ -1012,6 +1828,27 @@ func (d *Daemon) handleListAgents(req socket.Request) socket.Response {
 			}
 			detail["messages_total"] = len(allMsgs)
 			detail["messages_pending"] = pendingCount
+
+			// Last activity detected from the pane (see activityLoop)
+			detail["activity"] = string(agent.Activity)
+			detail["activity_changed_at"] = agent.ActivityChangedAt
+
+			// Times in a row the worker was resumed after crashing
+			detail["resume_count"] = agent.ResumeCount
+
+			// Whether the agent opted out of refresh, and whether refreshing
+			// onto main hit conflicts the agent has to resolve
+			detail["refresh_disabled"] = agent.RefreshDisabled
+			detail["needs_rebase"] = agent.NeedsRebase
+			if agent.NeedsRebase {
+				detail["rebase_conflicts"] = agent.RebaseConflicts
+				detail["needs_rebase_since"] = agent.NeedsRebaseSince
+			}
+
+			// Tokens used by the agent's session so far
+			if tokens, _ := d.agentUsage(repoName, agentName, agent); tokens != nil {
+				detail["usage"] = tokens
+			}
 		}
 
 		agentDetails = append(agentDetails, detail)
@@ -1037,19 +1874,31 @@ func (d *Daemon) handleCompleteAgent(req socket.Request) socket.Response {
 		return socket.ErrorResponse("agent '%s' not found in repository '%s' - check available agents with: multiclaude worker list --repo %s", agentName, repoName, repoName)
 	}
 
+	// Optional: capture summary and failure reason for task history
+	summary := getOptionalStringArg(req.Args, "summary", "")
+	failureReason := getOptionalStringArg(req.Args, "failure_reason", "")
+	if err := d.completeAgent(repoName, agentName, agent, summary, failureReason); err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
+
+	return socket.SuccessResponse(nil)
+}
+
+// completeAgent marks an agent as ready for cleanup, recording the summary and
+// failure reason when given, and tells the agents that wait on it. This is
+// what 'agent complete' does, and what the daemon does when a headless run ends.
+func (d *Daemon) completeAgent(repoName, agentName string, agent state.Agent, summary, failureReason string) error {
 	// Mark as ready for cleanup
 	agent.ReadyForCleanup = true
-
-	// Optional: capture summary and failure reason for task history
-	if summary := getOptionalStringArg(req.Args, "summary", ""); summary != "" {
+	if summary != "" {
 		agent.Summary = summary
 	}
-	if failureReason := getOptionalStringArg(req.Args, "failure_reason", ""); failureReason != "" {
+	if failureReason != "" {
 		agent.FailureReason = failureReason
 	}
 
 	if err := d.state.UpdateAgent(repoName, agentName, agent); err != nil {
-		return socket.ErrorResponse("%s", err.Error())
+		return err
 	}
 
 	d.logger.Info("Agent %s/%s marked as ready for cleanup", repoName, agentName)
@@ -1087,15 +1936,17 @@ func (d *Daemon) handleCompleteAgent(req socket.Request) socket.Response {
 				d.logger.Info("Sent completion notification to merge-queue for review agent %s", agentName)
 			}
 		}
+	}
 
-		// Trigger immediate message delivery
-		go d.routeMessages()
+	// A completed worker frees its slot for the next queued task
+	if agent.Type == state.AgentTypeWorker {
+		go d.drainWorkerQueue(repoName)
 	}
 
 	// Trigger immediate cleanup check
 	go d.checkAgentHealth()
 
-	return socket.SuccessResponse(nil)
+	return nil
 }
 
 // handleRestartAgent restarts an agent that has crashed or exited
@@ -1121,6 +1972,9 @@ func (d *Daemon) handleRestartAgent(req socket.Request) socket.Response {
 	if agent.ReadyForCleanup {
 		return socket.ErrorResponse("agent '%s' is marked as complete and pending cleanup - cannot restart a completed agent", agentName)
 	}
+	if agent.Headless {
+		return socket.ErrorResponse("agent '%s' runs headless and completes when its run ends - it cannot be restarted", agentName)
+	}
 
 	// Check if tmux window exists
 	repo, exists := d.state.GetRepo(repoName)
@@ -1159,24 +2013,108 @@ func (d *Daemon) handleRestartAgent(req socket.Request) socket.Response {
 	})
 }
 
-// handleTriggerCleanup manually triggers cleanup operations
-func (d *Daemon) handleTriggerCleanup(req socket.Request) socket.Response {
-	d.logger.Info("Manual cleanup triggered")
-
-	// Run health check to find dead agents
-	d.checkAgentHealth()
+// handleLaunchArgs returns the flags to run an agent's Claude with, for
+// 'multiclaude claude', which restarts it in the agent's own window: the
+// prompt file its session was started with, and its model, tools, and
+// permissions under the permission profile of its type, which is rendered.
+// The session flags are left to the caller.
+func (d *Daemon) handleLaunchArgs(req socket.Request) socket.Response {
+	repoName, errResp, ok := getRequiredStringArg(req.Args, "repo", "repository name is required")
+	if !ok {
+		return errResp
+	}
 
-	return socket.SuccessResponse("Cleanup triggered")
-}
+	agentName, errResp, ok := getRequiredStringArg(req.Args, "agent", "agent name is required")
+	if !ok {
+		return errResp
+	}
 
-// handleTriggerRefresh manually triggers worktree refresh for all agents
+	agent, exists := d.state.GetAgent(repoName, agentName)
+	if !exists {
+		return socket.ErrorResponse("agent %q not found in repository %q", agentName, repoName)
+	}
+
+	promptFile, err := d.sessionPromptFile(repoName, agentName, agent)
+	if err != nil {
+		return socket.ErrorResponse("failed to find prompt of %s: %v", agentName, err)
+	}
+	profile, err := d.launchProfile(repoName, agentName, agent.Type, agent.WorktreePath, agent.Profile)
+	if err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
+
+	return socket.SuccessResponse(map[string]interface{}{
+		"prompt_file": promptFile,
+		"args":        launchFlags(promptFile, profile),
+	})
+}
+
+// handleTriggerCleanup manually triggers cleanup operations
+func (d *Daemon) handleTriggerCleanup(req socket.Request) socket.Response {
+	d.logger.Info("Manual cleanup triggered")
+
+	// Run health check to find dead agents
+	d.checkAgentHealth()
+
+	return socket.SuccessResponse("Cleanup triggered")
+}
+
+// handleTriggerRefresh manually triggers worktree refresh for all agents
 func (d *Daemon) handleTriggerRefresh(req socket.Request) socket.Response {
 	d.logger.Info("Manual worktree refresh triggered")
 
-	// Run refresh in background so we can return immediately
-	go d.refreshWorktrees()
+	repoFilter := getOptionalStringArg(req.Args, "repo", "")
+	if repoFilter != "" {
+		if _, exists := d.state.GetRepo(repoFilter); !exists {
+			return socket.ErrorResponse("repository '%s' not found", repoFilter)
+		}
+	}
+
+	// Run refresh in background so we can return immediately, unless the
+	// caller wants the per-agent results
+	if !getOptionalBoolArg(req.Args, "wait", false) {
+		go d.refreshRepos(repoFilter)
+		return socket.SuccessResponse("Worktree refresh triggered")
+	}
 
-	return socket.SuccessResponse("Worktree refresh triggered")
+	outcomes := d.refreshRepos(repoFilter)
+	result := make([]map[string]interface{}, 0, len(outcomes))
+	for _, outcome := range outcomes {
+		result = append(result, map[string]interface{}{
+			"repo":    outcome.repo,
+			"agent":   outcome.agent,
+			"type":    outcome.target,
+			"result":  outcome.result,
+			"detail":  outcome.detail,
+			"commits": outcome.commits,
+		})
+	}
+	return socket.SuccessResponse(result)
+}
+
+// handleSetAgentRefresh opts an agent out of (or back into) worktree refresh
+func (d *Daemon) handleSetAgentRefresh(req socket.Request) socket.Response {
+	repoName, errResp, ok := getRequiredStringArg(req.Args, "repo", "repository name is required")
+	if !ok {
+		return errResp
+	}
+
+	agentName, errResp, ok := getRequiredStringArg(req.Args, "agent", "agent name is required")
+	if !ok {
+		return errResp
+	}
+
+	enabled, ok := req.Args["enabled"].(bool)
+	if !ok {
+		return socket.ErrorResponse("enabled is required")
+	}
+
+	if err := d.state.SetAgentRefreshDisabled(repoName, agentName, !enabled); err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
+
+	d.logger.Info("Set refresh for %s/%s: enabled=%v", repoName, agentName, enabled)
+	return socket.SuccessResponse(nil)
 }
 
 // handleRepairState repairs state inconsistencies
@@ -1200,8 +2138,11 @@ func (d *Daemon) handleRepairState(req socket.Request) socket.Response {
 
 		if !hasSession {
 			d.logger.Warn("Tmux session %s not found, removing all agents for repo %s", repo.TmuxSession, repoName)
-			// Remove all agents for this repo
-			for agentName := range repo.Agents {
+			// Remove all agents for this repo but the headless ones, which don't live in the session
+			for agentName, agent := range repo.Agents {
+				if agent.Headless {
+					continue
+				}
 				if err := d.state.RemoveAgent(repoName, agentName); err == nil {
 					agentsRemoved++
 				}
@@ -1212,6 +2153,9 @@ func (d *Daemon) handleRepairState(req socket.Request) socket.Response {
 
 		// Check each agent's resources
 		for agentName, agent := range repo.Agents {
+			if agent.Headless {
+				continue
+			}
 			hasWindow, _ := d.tmux.HasWindow(d.ctx, repo.TmuxSession, agent.TmuxWindow)
 			if !hasWindow {
 				d.logger.Info("Removing agent %s (window not found)", agentName)
@@ -1280,6 +2224,57 @@ func (d *Daemon) handleGetRepoConfig(req socket.Request) socket.Response {
 	// Get fork config
 	forkConfig := repo.ForkConfig
 
+	// Get CI fix-up config (with the default attempt budget filled in)
+	ciFixConfig, err := d.state.GetCIFixConfig(name)
+	if err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
+
+	// Get crashed-worker resume config
+	resumeConfig, err := d.state.GetWorkerResumeConfig(name)
+	if err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
+
+	// Get worktree refresh config
+	refreshConfig, err := d.state.GetRefreshConfig(name)
+	if err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
+
+	// Get named message groups and message retention limits
+	messageGroups, err := d.state.GetMessageGroups(name)
+	if err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
+	retention, err := d.state.GetMessageRetentionConfig(name)
+	if err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
+
+	// Get the permission profile selected per agent type
+	permissionProfiles, err := d.state.GetPermissionProfiles(name)
+	if err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
+
+	// Get daily token budgets with the usage seen at the last budget check
+	budgetConfig, err := d.state.GetBudgetConfig(name)
+	if err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
+	agentTypeBudgets := make(map[string]interface{}, len(budgetConfig.AgentTypes))
+	for agentType, budget := range budgetConfig.AgentTypes {
+		agentTypeBudgets[string(agentType)] = map[string]interface{}{
+			"warn_tokens": budget.WarnTokens,
+			"cap_tokens":  budget.CapTokens,
+		}
+	}
+	globalBudget := d.state.GetGlobalBudget()
+	d.budgetMu.Lock()
+	budgetUsed, globalBudgetUsed := d.budgetUsage.repos[name], d.budgetUsage.total
+	d.budgetMu.Unlock()
+
 	return socket.SuccessResponse(map[string]interface{}{
 		"mq_enabled":      mqConfig.Enabled,
 		"mq_track_mode":   string(mqConfig.TrackMode),
@@ -1290,6 +2285,26 @@ func (d *Daemon) handleGetRepoConfig(req socket.Request) socket.Response {
 		"upstream_owner":  forkConfig.UpstreamOwner,
 		"upstream_repo":   forkConfig.UpstreamRepo,
 		"force_fork_mode": forkConfig.ForceForkMode,
+		"max_workers":     repo.MaxWorkers,
+		"message_groups":  messageGroups,
+
+		"permission_profiles":   permissionProfiles,
+		"message_max_age_days":  retention.MaxAgeDays,
+		"message_max_per_agent": retention.MaxPerAgent,
+		"ci_fix_enabled":        ciFixConfig.Enabled,
+		"ci_fix_max_attempts":   ciFixConfig.MaxAttempts,
+		"resume_enabled":        !resumeConfig.Disabled,
+		"resume_max_attempts":   resumeConfig.MaxAttempts,
+
+		"refresh_resolve_conflicts": refreshConfig.ResolveConflicts,
+
+		"budget_warn_tokens":        budgetConfig.Repo.WarnTokens,
+		"budget_cap_tokens":         budgetConfig.Repo.CapTokens,
+		"budget_used_tokens":        budgetUsed,
+		"agent_type_budgets":        agentTypeBudgets,
+		"global_budget_warn_tokens": globalBudget.WarnTokens,
+		"global_budget_cap_tokens":  globalBudget.CapTokens,
+		"global_budget_used_tokens": globalBudgetUsed,
 	})
 }
 
@@ -1356,6 +2371,196 @@ func (d *Daemon) handleUpdateRepoConfig(req socket.Request) socket.Response {
 		d.logger.Info("Updated PR shepherd config for repo %s: enabled=%v, track=%s", name, currentPSConfig.Enabled, currentPSConfig.TrackMode)
 	}
 
+	// Update worker concurrency limit (JSON numbers arrive as float64)
+	if maxWorkers, ok := req.Args["max_workers"].(float64); ok {
+		if maxWorkers < 0 || maxWorkers != float64(int(maxWorkers)) {
+			return socket.ErrorResponse("invalid max_workers %v: must be a whole number, 0 for unlimited", maxWorkers)
+		}
+		if err := d.state.UpdateMaxWorkers(name, int(maxWorkers)); err != nil {
+			return socket.ErrorResponse("%s", err.Error())
+		}
+		d.logger.Info("Updated max workers for repo %s: %d", name, int(maxWorkers))
+
+		// A higher limit may let queued tasks start right away
+		go d.drainWorkerQueue(name)
+	}
+
+	// Update named message groups; an empty member list removes a group
+	if groups, ok := req.Args["message_groups"].(map[string]interface{}); ok {
+		for group, raw := range groups {
+			if isReservedGroupName(group) {
+				return socket.ErrorResponse("message group name %q is reserved", group)
+			}
+			rawMembers, _ := raw.([]interface{})
+			members := make([]string, 0, len(rawMembers))
+			for _, member := range rawMembers {
+				if s, ok := member.(string); ok && s != "" {
+					members = append(members, s)
+				}
+			}
+			if err := d.state.SetMessageGroup(name, group, members); err != nil {
+				return socket.ErrorResponse("%s", err.Error())
+			}
+			d.logger.Info("Updated message group @%s for repo %s: %v", group, name, members)
+		}
+	}
+
+	// Update permission profiles by agent type; an empty profile runs the type unrestricted
+	if profiles, ok := req.Args["permission_profiles"].(map[string]interface{}); ok {
+		for agentType, raw := range profiles {
+			profile, _ := raw.(string)
+			if profile != "" {
+				if err := permissions.Validate(profile); err != nil {
+					return socket.ErrorResponse("%s", err.Error())
+				}
+			}
+			if err := d.state.SetPermissionProfile(name, state.AgentType(agentType), profile); err != nil {
+				return socket.ErrorResponse("%s", err.Error())
+			}
+			d.logger.Info("Updated permission profile for %s agents of repo %s: %q", agentType, name, profile)
+		}
+	}
+
+	// Update message retention limits; 0 restores a default
+	maxAgeDays, hasMaxAgeDays := req.Args["message_max_age_days"].(float64)
+	maxPerAgent, hasMaxPerAgent := req.Args["message_max_per_agent"].(float64)
+	if hasMaxAgeDays || hasMaxPerAgent {
+		retention := state.MessageRetentionConfig{}
+		if current, ok := d.state.GetAllRepos()[name]; ok {
+			retention = current.MessageRetention
+		}
+		if hasMaxAgeDays {
+			if maxAgeDays < 0 || maxAgeDays != float64(int(maxAgeDays)) {
+				return socket.ErrorResponse("invalid message_max_age_days %v: must be a whole number, 0 for the default", maxAgeDays)
+			}
+			retention.MaxAgeDays = int(maxAgeDays)
+		}
+		if hasMaxPerAgent {
+			if maxPerAgent < 0 || maxPerAgent != float64(int(maxPerAgent)) {
+				return socket.ErrorResponse("invalid message_max_per_agent %v: must be a whole number, 0 for the default", maxPerAgent)
+			}
+			retention.MaxPerAgent = int(maxPerAgent)
+		}
+		if err := d.state.UpdateMessageRetentionConfig(name, retention); err != nil {
+			return socket.ErrorResponse("%s", err.Error())
+		}
+		d.logger.Info("Updated message retention for repo %s: max_age_days=%d, max_per_agent=%d", name, retention.MaxAgeDays, retention.MaxPerAgent)
+	}
+
+	// Update CI fix-up config
+	ciFixEnabled, hasCIFixEnabled := req.Args["ci_fix_enabled"].(bool)
+	ciFixAttempts, hasCIFixAttempts := req.Args["ci_fix_max_attempts"].(float64)
+	if hasCIFixEnabled || hasCIFixAttempts {
+		ciFixConfig, err := d.state.GetCIFixConfig(name)
+		if err != nil {
+			return socket.ErrorResponse("%s", err.Error())
+		}
+		if hasCIFixEnabled {
+			ciFixConfig.Enabled = ciFixEnabled
+		}
+		if hasCIFixAttempts {
+			if ciFixAttempts < 1 || ciFixAttempts != float64(int(ciFixAttempts)) {
+				return socket.ErrorResponse("invalid ci_fix_max_attempts %v: must be a whole number of at least 1", ciFixAttempts)
+			}
+			ciFixConfig.MaxAttempts = int(ciFixAttempts)
+		}
+		if err := d.state.UpdateCIFixConfig(name, ciFixConfig); err != nil {
+			return socket.ErrorResponse("%s", err.Error())
+		}
+		d.logger.Info("Updated CI fix-up config for repo %s: enabled=%v, max_attempts=%d", name, ciFixConfig.Enabled, ciFixConfig.MaxAttempts)
+	}
+
+	// Update crashed-worker resume config
+	resumeEnabled, hasResumeEnabled := req.Args["resume_enabled"].(bool)
+	resumeAttempts, hasResumeAttempts := req.Args["resume_max_attempts"].(float64)
+	if hasResumeEnabled || hasResumeAttempts {
+		resumeConfig, err := d.state.GetWorkerResumeConfig(name)
+		if err != nil {
+			return socket.ErrorResponse("%s", err.Error())
+		}
+		if hasResumeEnabled {
+			resumeConfig.Disabled = !resumeEnabled
+		}
+		if hasResumeAttempts {
+			if resumeAttempts < 1 || resumeAttempts != float64(int(resumeAttempts)) {
+				return socket.ErrorResponse("invalid resume_max_attempts %v: must be a whole number of at least 1", resumeAttempts)
+			}
+			resumeConfig.MaxAttempts = int(resumeAttempts)
+		}
+		if err := d.state.UpdateWorkerResumeConfig(name, resumeConfig); err != nil {
+			return socket.ErrorResponse("%s", err.Error())
+		}
+		d.logger.Info("Updated worker resume config for repo %s: enabled=%v, max_attempts=%d", name, !resumeConfig.Disabled, resumeConfig.MaxAttempts)
+	}
+
+	// Update worktree refresh config
+	if resolveConflicts, ok := req.Args["refresh_resolve_conflicts"].(bool); ok {
+		refreshConfig, err := d.state.GetRefreshConfig(name)
+		if err != nil {
+			return socket.ErrorResponse("%s", err.Error())
+		}
+		refreshConfig.ResolveConflicts = resolveConflicts
+		if err := d.state.UpdateRefreshConfig(name, refreshConfig); err != nil {
+			return socket.ErrorResponse("%s", err.Error())
+		}
+		d.logger.Info("Updated refresh config for repo %s: resolve_conflicts=%v", name, resolveConflicts)
+	}
+
+	// Update daily token budgets; they take effect at the next budget check
+	budgetWarn, hasBudgetWarn := req.Args["budget_warn_tokens"].(float64)
+	budgetCap, hasBudgetCap := req.Args["budget_cap_tokens"].(float64)
+	typeBudgets, hasTypeBudgets := req.Args["agent_type_budgets"].(map[string]interface{})
+	if hasBudgetWarn || hasBudgetCap || hasTypeBudgets {
+		budgetConfig, err := d.state.GetBudgetConfig(name)
+		if err != nil {
+			return socket.ErrorResponse("%s", err.Error())
+		}
+		if hasBudgetWarn {
+			budgetConfig.Repo.WarnTokens = int64(budgetWarn)
+		}
+		if hasBudgetCap {
+			budgetConfig.Repo.CapTokens = int64(budgetCap)
+		}
+		for typeName, raw := range typeBudgets {
+			agentType := state.AgentType(typeName)
+			if !agentType.IsValid() {
+				return socket.ErrorResponse("invalid agent type %q in agent_type_budgets", typeName)
+			}
+			limits, _ := raw.(map[string]interface{})
+			budget := budgetConfig.AgentTypes[agentType]
+			if v, ok := limits["warn_tokens"].(float64); ok {
+				budget.WarnTokens = int64(v)
+			}
+			if v, ok := limits["cap_tokens"].(float64); ok {
+				budget.CapTokens = int64(v)
+			}
+			if budgetConfig.AgentTypes == nil {
+				budgetConfig.AgentTypes = make(map[state.AgentType]state.TokenBudget)
+			}
+			budgetConfig.AgentTypes[agentType] = budget
+		}
+		if err := d.state.UpdateBudgetConfig(name, budgetConfig); err != nil {
+			return socket.ErrorResponse("%s", err.Error())
+		}
+		d.logger.Info("Updated token budgets for repo %s: %+v", name, budgetConfig)
+	}
+
+	globalWarn, hasGlobalWarn := req.Args["global_budget_warn_tokens"].(float64)
+	globalCap, hasGlobalCap := req.Args["global_budget_cap_tokens"].(float64)
+	if hasGlobalWarn || hasGlobalCap {
+		globalBudget := d.state.GetGlobalBudget()
+		if hasGlobalWarn {
+			globalBudget.WarnTokens = int64(globalWarn)
+		}
+		if hasGlobalCap {
+			globalBudget.CapTokens = int64(globalCap)
+		}
+		if err := d.state.UpdateGlobalBudget(globalBudget); err != nil {
+			return socket.ErrorResponse("global budget: %s", err.Error())
+		}
+		d.logger.Info("Updated global token budget: warn=%d, cap=%d", globalBudget.WarnTokens, globalBudget.CapTokens)
+	}
+
 	return socket.SuccessResponse(nil)
 }
 
@@ -1411,13 +2616,23 @@ func (d *Daemon) cleanupDeadAgents(deadAgents map[string][]string) {
 				continue
 			}
 
+			// Agents that didn't signal completion went away unexpectedly
+			if !agent.ReadyForCleanup {
+				d.publishEvent(events.AgentDied, repoName, agentName, map[string]interface{}{
+					"type":   string(agent.Type),
+					"reason": "window_missing",
+				})
+			}
+
 			// Record task history for workers before cleanup
 			if agent.Type == state.AgentTypeWorker {
 				d.recordTaskHistory(repoName, agentName, agent)
 			}
 
-			// Kill tmux window
-			if err := d.tmux.KillWindow(d.ctx, repo.TmuxSession, agent.TmuxWindow); err != nil {
+			// Stop the headless run, or kill the tmux window
+			if agent.Headless {
+				d.stopHeadless(repoName, agentName)
+			} else if err := d.tmux.KillWindow(d.ctx, repo.TmuxSession, agent.TmuxWindow); err != nil {
 				d.logger.Warn("Failed to kill tmux window %s: %v", agent.TmuxWindow, err)
 			} else {
 				d.logger.Info("Killed tmux window for agent %s: %s", agentName, agent.TmuxWindow)
@@ -1427,6 +2642,9 @@ func (d *Daemon) cleanupDeadAgents(deadAgents map[string][]string) {
 			if err := d.state.RemoveAgent(repoName, agentName); err != nil {
 				d.logger.Error("Failed to remove agent %s/%s from state: %v", repoName, agentName, err)
 			}
+			if err := d.promptStore.Remove(repoName, agentName); err != nil {
+				d.logger.Warn("Failed to clean up agent %s/%s: %v", repoName, agentName, err)
+			}
 
 			// Clean up worktree if it exists (workers and review agents have worktrees)
 			if agent.WorktreePath != "" && (agent.Type == state.AgentTypeWorker || agent.Type == state.AgentTypeReview) {
@@ -1439,89 +2657,452 @@ func (d *Daemon) cleanupDeadAgents(deadAgents map[string][]string) {
 				}
 			}
 
-			// Clean up message directory
-			msgMgr := d.getMessageManager()
-			validAgents, _ := d.state.ListAgents(repoName)
-			if _, err := msgMgr.CleanupOrphaned(repoName, validAgents); err != nil {
-				d.logger.Warn("Failed to cleanup orphaned messages for %s: %v", repoName, err)
-			}
+			// Clean up message directory
+			msgMgr := d.getMessageManager()
+			validAgents, _ := d.state.ListAgents(repoName)
+			if _, err := msgMgr.CleanupOrphaned(repoName, validAgents); err != nil {
+				d.logger.Warn("Failed to cleanup orphaned messages for %s: %v", repoName, err)
+			}
+		}
+
+		// Removed workers free slots for queued tasks
+		d.drainWorkerQueue(repoName)
+	}
+}
+
+// recordTaskHistory saves a worker's task to the history before cleanup
+func (d *Daemon) recordTaskHistory(repoName, agentName string, agent state.Agent) {
+	// Get the branch name from the worktree if it exists
+	branch := ""
+	if agent.WorktreePath != "" {
+		if b, err := worktree.GetCurrentBranch(agent.WorktreePath); err == nil {
+			branch = b
+		} else {
+			// Fallback: construct expected branch name
+			branch = "work/" + agentName
+		}
+	}
+
+	// Determine initial status
+	status := state.TaskStatusUnknown
+	if agent.FailureReason != "" {
+		status = state.TaskStatusFailed
+	}
+
+	entry := state.TaskHistoryEntry{
+		Name:          agentName,
+		Task:          agent.Task,
+		Branch:        branch,
+		Status:        status, // Will be updated when displaying if a PR exists
+		Summary:       agent.Summary,
+		FailureReason: agent.FailureReason,
+		DependsOn:     agent.DependsOn,
+		CreatedAt:     agent.CreatedAt,
+		CompletedAt:   time.Now(),
+	}
+
+	// Keep the token totals; the transcript outlives the worktree but may be
+	// cleaned up by Claude later
+	entry.Usage, entry.Transcript = d.agentUsage(repoName, agentName, agent)
+
+	// Keep the worker's mailbox with its task instead of deleting it
+	if archive, _, err := d.archiveMailbox(repoName, agentName); err != nil {
+		d.logger.Warn("Failed to archive mailbox of %s: %v", agentName, err)
+	} else {
+		entry.Messages = archive
+	}
+
+	if err := d.state.AddTaskHistory(repoName, entry); err != nil {
+		d.logger.Warn("Failed to record task history for %s: %v", agentName, err)
+	} else {
+		d.logger.Info("Recorded task history for %s (branch: %s, summary: %q)", agentName, branch, agent.Summary)
+		d.publishEvent(events.TaskStatusChanged, repoName, agentName, map[string]interface{}{
+			"status": string(status),
+			"branch": branch,
+		})
+	}
+}
+
+// handleTaskHistory returns the task history for a repository
+func (d *Daemon) handleTaskHistory(req socket.Request) socket.Response {
+	repoName, errResp, ok := getRequiredStringArg(req.Args, "repo", "repository name is required")
+	if !ok {
+		return errResp
+	}
+
+	// Get optional limit
+	limit := 10 // default
+	if l, ok := req.Args["limit"].(float64); ok {
+		limit = int(l)
+	}
+
+	history, err := d.state.GetTaskHistory(repoName, limit)
+	if err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
+
+	// Convert to interface slice for JSON serialization
+	result := make([]map[string]interface{}, len(history))
+	for i, entry := range history {
+		result[i] = map[string]interface{}{
+			"name":           entry.Name,
+			"task":           entry.Task,
+			"branch":         entry.Branch,
+			"pr_url":         entry.PRURL,
+			"pr_number":      entry.PRNumber,
+			"status":         string(entry.Status),
+			"summary":        entry.Summary,
+			"failure_reason": entry.FailureReason,
+			"depends_on":     entry.DependsOn,
+			"messages":       entry.Messages,
+			"created_at":     entry.CreatedAt,
+			"completed_at":   entry.CompletedAt,
+		}
+		if entry.Usage != nil {
+			result[i]["usage"] = entry.Usage
+		}
+	}
+
+	return socket.SuccessResponse(result)
+}
+
+// handleAddPendingTask queues a worker task that starts once its dependencies merge.
+// Args:
+//   - repo: repository name
+//   - name: worker name to use when the task is spawned
+//   - task: task description
+//   - after: dependencies, either a list or a comma-separated string of worker names and PR numbers ("#123")
+func (d *Daemon) handleAddPendingTask(req socket.Request) socket.Response {
+	repoName, errResp, ok := getRequiredStringArg(req.Args, "repo", "repository name is required")
+	if !ok {
+		return errResp
+	}
+
+	taskName, errResp, ok := getRequiredStringArg(req.Args, "name", "worker name is required")
+	if !ok {
+		return errResp
+	}
+
+	task, errResp, ok := getRequiredStringArg(req.Args, "task", "task description is required")
+	if !ok {
+		return errResp
+	}
+
+	dependsOn := parseListArg(req.Args["after"])
+	if len(dependsOn) == 0 {
+		return socket.ErrorResponse("missing 'after': at least one dependency is required")
+	}
+
+	repo, exists := d.state.GetRepo(repoName)
+	if !exists {
+		return socket.ErrorResponse("repository %q not found", repoName)
+	}
+
+	history, _ := d.state.GetTaskHistory(repoName, 0)
+	for _, dep := range dependsOn {
+		if dep == taskName {
+			return socket.ErrorResponse("task %q cannot depend on itself", taskName)
+		}
+		if _, isPR := state.ParsePRDependency(dep); isPR {
+			continue
+		}
+		if _, exists := repo.Agents[dep]; exists {
+			continue
+		}
+		if _, found := state.FindDependency(history, dep); found {
+			continue
+		}
+		known := false
+		for _, pending := range repo.PendingTasks {
+			if pending.Name == dep {
+				known = true
+				break
+			}
+		}
+		for _, queued := range repo.WorkerQueue {
+			if queued.Name == dep {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return socket.ErrorResponse("unknown dependency %q: expected a worker name or PR number (e.g. #123)", dep)
+		}
+	}
+
+	profile, err := getOptionalProfileArg(req.Args)
+	if err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
+
+	pending := state.PendingTask{
+		Name:      taskName,
+		Task:      task,
+		DependsOn: dependsOn,
+		Profile:   profile,
+		CreatedAt: time.Now(),
+	}
+	if err := d.state.AddPendingTask(repoName, pending); err != nil {
+		return socket.ErrorResponse("failed to add pending task: %v", err)
+	}
+
+	d.logger.Info("Queued pending task %s/%s after %s", repoName, taskName, strings.Join(dependsOn, ", "))
+	return socket.SuccessResponse(nil)
+}
+
+// parseListArg accepts a JSON list of strings or a comma-separated string,
+// returning the trimmed, de-duplicated, non-empty values
+func parseListArg(raw interface{}) []string {
+	var parts []string
+	switch v := raw.(type) {
+	case string:
+		parts = strings.Split(v, ",")
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				parts = append(parts, s)
+			}
+		}
+	}
+
+	var values []string
+	seen := make(map[string]bool)
+	for _, part := range parts {
+		value := strings.TrimSpace(part)
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		values = append(values, value)
+	}
+	return values
+}
+
+// handleListPendingTasks returns the pending tasks for a repository along with
+// the current state of each dependency edge
+func (d *Daemon) handleListPendingTasks(req socket.Request) socket.Response {
+	repoName, errResp, ok := getRequiredStringArg(req.Args, "repo", "repository name is required")
+	if !ok {
+		return errResp
+	}
+
+	tasks, err := d.state.GetPendingTasks(repoName)
+	if err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
+
+	history, _ := d.state.GetTaskHistory(repoName, 0)
+
+	result := make([]map[string]interface{}, len(tasks))
+	for i, task := range tasks {
+		overall := "waiting"
+		if task.BlockedReason != "" {
+			overall = "blocked"
+		}
+
+		deps := make([]map[string]interface{}, len(task.DependsOn))
+		for j, dep := range task.DependsOn {
+			deps[j] = map[string]interface{}{
+				"name":  dep,
+				"state": string(state.ResolveDependency(history, dep)),
+			}
+		}
+
+		result[i] = map[string]interface{}{
+			"name":           task.Name,
+			"task":           task.Task,
+			"depends_on":     deps,
+			"state":          overall,
+			"blocked_reason": task.BlockedReason,
+			"created_at":     task.CreatedAt,
+		}
+	}
+
+	return socket.SuccessResponse(result)
+}
+
+// handleRemovePendingTask removes a pending task before it is spawned
+func (d *Daemon) handleRemovePendingTask(req socket.Request) socket.Response {
+	repoName, errResp, ok := getRequiredStringArg(req.Args, "repo", "repository name is required")
+	if !ok {
+		return errResp
+	}
+
+	taskName, errResp, ok := getRequiredStringArg(req.Args, "name", "task name is required")
+	if !ok {
+		return errResp
+	}
+
+	if err := d.state.RemovePendingTask(repoName, taskName); err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
+
+	d.logger.Info("Removed pending task %s/%s", repoName, taskName)
+	return socket.SuccessResponse(nil)
+}
+
+// handleReserveWorkerSlot claims a worker slot for a worker the CLI is about to create.
+// When the repo is at its max_workers limit (or other tasks are already waiting) the
+// task is appended to the worker queue instead, unless queueing is disabled.
+// Args:
+//   - repo: repository name
+//   - name: worker name
+//   - task: task description
+//   - queue: whether to queue the task when no slot is free (default true)
+func (d *Daemon) handleReserveWorkerSlot(req socket.Request) socket.Response {
+	repoName, errResp, ok := getRequiredStringArg(req.Args, "repo", "repository name is required")
+	if !ok {
+		return errResp
+	}
+
+	workerName, errResp, ok := getRequiredStringArg(req.Args, "name", "worker name is required")
+	if !ok {
+		return errResp
+	}
+
+	task, errResp, ok := getRequiredStringArg(req.Args, "task", "task description is required")
+	if !ok {
+		return errResp
+	}
+
+	allowQueue := getOptionalBoolArg(req.Args, "queue", true)
+	profile, err := getOptionalProfileArg(req.Args)
+	if err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
+
+	d.dispatchMu.Lock()
+	defer d.dispatchMu.Unlock()
+
+	maxWorkers, err := d.state.GetMaxWorkers(repoName)
+	if err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
+
+	queue, _ := d.state.GetWorkerQueue(repoName)
+	if len(queue) == 0 && d.hasWorkerSlotUnlocked(repoName) {
+		if maxWorkers > 0 {
+			d.reserveWorkerSlotUnlocked(repoName, workerName)
 		}
+		return socket.SuccessResponse(map[string]interface{}{
+			"queued": false,
+		})
 	}
-}
 
-// recordTaskHistory saves a worker's task to the history before cleanup
-func (d *Daemon) recordTaskHistory(repoName, agentName string, agent state.Agent) {
-	// Get the branch name from the worktree if it exists
-	branch := ""
-	if agent.WorktreePath != "" {
-		if b, err := worktree.GetCurrentBranch(agent.WorktreePath); err == nil {
-			branch = b
-		} else {
-			// Fallback: construct expected branch name
-			branch = "work/" + agentName
+	// Tasks queued while the daily budget is used up start once it resets
+	budgetExhausted := d.budgetExhausted(repoName)
+	if !allowQueue {
+		if budgetExhausted {
+			return socket.ErrorResponse("%s", budgetExhaustedError(repoName, time.Now()).Error())
 		}
+		return socket.ErrorResponse("repository %q is at its limit of %d workers; wait for a worker to finish or raise the limit with: multiclaude config %s --max-workers=<n>", repoName, maxWorkers, repoName)
 	}
 
-	// Determine initial status
-	status := state.TaskStatusUnknown
-	if agent.FailureReason != "" {
-		status = state.TaskStatusFailed
+	position, err := d.state.EnqueueTask(repoName, state.QueuedTask{
+		Name:     workerName,
+		Task:     task,
+		Profile:  profile,
+		QueuedAt: time.Now(),
+	})
+	if err != nil {
+		return socket.ErrorResponse("failed to queue task: %v", err)
+	}
+
+	if budgetExhausted {
+		resetsAt := budgetResetTime(time.Now())
+		d.logger.Info("Repository %s has used up its daily token budget, queued task %s at position %d", repoName, workerName, position)
+		return socket.SuccessResponse(map[string]interface{}{
+			"queued":           true,
+			"position":         position,
+			"max_workers":      maxWorkers,
+			"reason":           "budget",
+			"budget_resets_at": resetsAt,
+		})
 	}
 
-	entry := state.TaskHistoryEntry{
-		Name:          agentName,
-		Task:          agent.Task,
-		Branch:        branch,
-		Status:        status, // Will be updated when displaying if a PR exists
-		Summary:       agent.Summary,
-		FailureReason: agent.FailureReason,
-		CreatedAt:     agent.CreatedAt,
-		CompletedAt:   time.Now(),
+	d.logger.Info("Repository %s is at its limit of %d workers, queued task %s at position %d", repoName, maxWorkers, workerName, position)
+	return socket.SuccessResponse(map[string]interface{}{
+		"queued":      true,
+		"position":    position,
+		"max_workers": maxWorkers,
+		"reason":      "max_workers",
+	})
+}
+
+// handleListWorkerQueue returns the worker queue for a repository along with its limit
+func (d *Daemon) handleListWorkerQueue(req socket.Request) socket.Response {
+	repoName, errResp, ok := getRequiredStringArg(req.Args, "repo", "repository name is required")
+	if !ok {
+		return errResp
 	}
 
-	if err := d.state.AddTaskHistory(repoName, entry); err != nil {
-		d.logger.Warn("Failed to record task history for %s: %v", agentName, err)
-	} else {
-		d.logger.Info("Recorded task history for %s (branch: %s, summary: %q)", agentName, branch, agent.Summary)
+	queue, err := d.state.GetWorkerQueue(repoName)
+	if err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
+
+	maxWorkers, _ := d.state.GetMaxWorkers(repoName)
+
+	d.dispatchMu.Lock()
+	activeWorkers := d.activeWorkerCountUnlocked(repoName)
+	d.dispatchMu.Unlock()
+
+	tasks := make([]map[string]interface{}, len(queue))
+	for i, task := range queue {
+		tasks[i] = map[string]interface{}{
+			"position":   i + 1,
+			"name":       task.Name,
+			"task":       task.Task,
+			"depends_on": task.DependsOn,
+			"queued_at":  task.QueuedAt,
+		}
 	}
+
+	return socket.SuccessResponse(map[string]interface{}{
+		"max_workers":    maxWorkers,
+		"active_workers": activeWorkers,
+		"tasks":          tasks,
+	})
 }
 
-// handleTaskHistory returns the task history for a repository
-func (d *Daemon) handleTaskHistory(req socket.Request) socket.Response {
+// handleRemoveQueuedTask removes a task from the worker queue
+func (d *Daemon) handleRemoveQueuedTask(req socket.Request) socket.Response {
 	repoName, errResp, ok := getRequiredStringArg(req.Args, "repo", "repository name is required")
 	if !ok {
 		return errResp
 	}
 
-	// Get optional limit
-	limit := 10 // default
-	if l, ok := req.Args["limit"].(float64); ok {
-		limit = int(l)
+	taskName, errResp, ok := getRequiredStringArg(req.Args, "name", "task name is required")
+	if !ok {
+		return errResp
 	}
 
-	history, err := d.state.GetTaskHistory(repoName, limit)
-	if err != nil {
+	if err := d.state.RemoveQueuedTask(repoName, taskName); err != nil {
 		return socket.ErrorResponse("%s", err.Error())
 	}
 
-	// Convert to interface slice for JSON serialization
-	result := make([]map[string]interface{}, len(history))
-	for i, entry := range history {
-		result[i] = map[string]interface{}{
-			"name":           entry.Name,
-			"task":           entry.Task,
-			"branch":         entry.Branch,
-			"pr_url":         entry.PRURL,
-			"pr_number":      entry.PRNumber,
-			"status":         string(entry.Status),
-			"summary":        entry.Summary,
-			"failure_reason": entry.FailureReason,
-			"created_at":     entry.CreatedAt,
-			"completed_at":   entry.CompletedAt,
-		}
+	d.logger.Info("Removed queued task %s/%s", repoName, taskName)
+	return socket.SuccessResponse(nil)
+}
+
+// handlePromoteQueuedTask moves a task to the front of the worker queue
+func (d *Daemon) handlePromoteQueuedTask(req socket.Request) socket.Response {
+	repoName, errResp, ok := getRequiredStringArg(req.Args, "repo", "repository name is required")
+	if !ok {
+		return errResp
 	}
 
-	return socket.SuccessResponse(result)
+	taskName, errResp, ok := getRequiredStringArg(req.Args, "name", "task name is required")
+	if !ok {
+		return errResp
+	}
+
+	if err := d.state.PromoteQueuedTask(repoName, taskName); err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
+
+	d.logger.Info("Promoted queued task %s/%s to the front of the queue", repoName, taskName)
+	return socket.SuccessResponse(nil)
 }
 
 // handleSpawnAgent spawns a new agent with an inline prompt (no hardcoded type).
@@ -1542,6 +3123,9 @@ func (d *Daemon) handleSpawnAgent(req socket.Request) socket.Response {
 	if !ok {
 		return errResp
 	}
+	if err := state.ValidateAgentName(agentName); err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
 
 	agentClass, errResp, ok := getRequiredStringArg(req.Args, "class", "agent class is required (persistent or ephemeral)")
 	if !ok {
@@ -1562,7 +3146,7 @@ func (d *Daemon) handleSpawnAgent(req socket.Request) socket.Response {
 	task := getOptionalStringArg(req.Args, "task", "")
 
 	// Get repository
-	repo, exists := d.state.GetRepo(repoName)
+	_, exists := d.state.GetRepo(repoName)
 	if !exists {
 		return socket.ErrorResponse("repository %q not found", repoName)
 	}
@@ -1572,6 +3156,14 @@ func (d *Daemon) handleSpawnAgent(req socket.Request) socket.Response {
 		return socket.ErrorResponse("agent %q already exists in repository %q", agentName, repoName)
 	}
 
+	// Refuse tasks that look like work already in flight or merged
+	if agentClass == "ephemeral" && task != "" && !getOptionalBoolArg(req.Args, "force", false) {
+		matches, err := d.similarTasks(repoName, task)
+		if err == nil && len(matches) > 0 {
+			return socket.ErrorResponse("%s", duplicateTaskError(matches))
+		}
+	}
+
 	// Determine agent type based on class
 	var agentType state.AgentType
 	if agentClass == "persistent" {
@@ -1593,72 +3185,25 @@ func (d *Daemon) handleSpawnAgent(req socket.Request) socket.Response {
 		}
 	}
 
-	// Create worktree for the agent
-	repoPath := d.paths.RepoDir(repoName)
-	worktreePath := d.paths.AgentWorktree(repoName, agentName)
-
-	wt := worktree.NewManager(repoPath)
-
-	// Create worktree - persistent agents use repo dir, ephemeral get their own branch
-	if agentClass == "persistent" {
-		// Persistent agents work directly in the repo directory
-		worktreePath = repoPath
-	} else {
-		// Ephemeral agents get their own worktree with a new branch
-		branchName := fmt.Sprintf("work/%s", agentName)
-		if err := wt.CreateNewBranch(worktreePath, branchName, "HEAD"); err != nil {
-			return socket.ErrorResponse("failed to create worktree: %v", err)
-		}
-	}
-
-	// Create tmux window with working directory
-	cmd := exec.Command("tmux", "new-window", "-d", "-t", repo.TmuxSession, "-n", agentName, "-c", worktreePath)
-	if err := cmd.Run(); err != nil {
-		// Clean up worktree on failure (only for ephemeral agents that have their own worktree)
-		if agentClass != "persistent" {
-			wt.Remove(worktreePath, true)
-		}
-		return socket.ErrorResponse("failed to create tmux window: %v", err)
-	}
-
-	// Write prompt to file
-	promptDir := filepath.Join(d.paths.Root, "prompts")
-	if err := os.MkdirAll(promptDir, 0755); err != nil {
-		return socket.ErrorResponse("failed to create prompt directory: %v", err)
-	}
-
-	promptPath := filepath.Join(promptDir, fmt.Sprintf("%s.md", agentName))
-	if err := os.WriteFile(promptPath, []byte(promptText), 0644); err != nil {
-		return socket.ErrorResponse("failed to write prompt file: %v", err)
-	}
-
-	// Copy hooks config
-	if err := hooks.CopyConfig(repoPath, worktreePath); err != nil {
-		d.logger.Warn("Failed to copy hooks config: %v", err)
-	}
-
-	// Start Claude in the tmux window
-	cfg := agentStartConfig{
-		agentName:  agentName,
-		agentType:  agentType,
-		promptFile: promptPath,
-		workDir:    worktreePath,
+	// Persistent agents work directly in the repo checkout, ephemeral agents
+	// get a worktree with a new branch. The profile is that of the agent's
+	// definition.
+	spec := spawnSpec{
+		repo:      repoName,
+		name:      agentName,
+		agentType: agentType,
+		prompt:    promptText,
+		task:      task,
+		profile:   d.definitionProfile(repoName, agentName),
 	}
-
-	if err := d.startAgentWithConfig(repoName, repo, cfg); err != nil {
-		// Clean up on failure
-		d.tmux.KillWindow(d.ctx, repo.TmuxSession, agentName)
-		if agentClass != "persistent" {
-			wt.Remove(worktreePath, true)
-		}
-		return socket.ErrorResponse("failed to start agent: %v", err)
+	if agentClass == "ephemeral" {
+		spec.branch = fmt.Sprintf("work/%s", agentName)
+		spec.startPoint = "HEAD"
 	}
 
-	// Update task if provided
-	if task != "" {
-		agent, _ := d.state.GetAgent(repoName, agentName)
-		agent.Task = task
-		d.state.UpdateAgent(repoName, agentName, agent)
+	agent, err := d.spawnRequestedAgent(spec)
+	if err != nil {
+		return socket.ErrorResponse("failed to spawn agent: %v", err)
 	}
 
 	d.logger.Info("Spawned agent %s/%s (class=%s, type=%s)", repoName, agentName, agentClass, agentType)
@@ -1667,7 +3212,7 @@ func (d *Daemon) handleSpawnAgent(req socket.Request) socket.Response {
 		"name":          agentName,
 		"class":         agentClass,
 		"type":          string(agentType),
-		"worktree_path": worktreePath,
+		"worktree_path": agent.WorktreePath,
 	})
 }
 
@@ -1773,6 +3318,11 @@ func (d *Daemon) restoreDeadAgents(repoName string, repo *state.Repository) {
 	d.logger.Debug("Checking for dead agents in repo %s", repoName)
 
 	for agentName, agent := range repo.Agents {
+		// Headless agents have no window; the health check reports lost runs
+		if agent.Headless {
+			continue
+		}
+
 		// Skip agents without a PID (shouldn't happen, but be safe)
 		if agent.PID <= 0 {
 			d.logger.Debug("Agent %s has no PID, skipping", agentName)
@@ -1807,6 +3357,8 @@ func (d *Daemon) restoreDeadAgents(repoName string, repo *state.Repository) {
 			} else {
 				d.logger.Info("Successfully restarted agent %s with --resume", agentName)
 			}
+		} else if d.resumeCrashedWorker(repoName, agentName, agent, repo, "process died while the daemon was down") {
+			d.logger.Info("Handled crashed worker %s", agentName)
 		} else {
 			d.logger.Debug("Skipping transient agent %s (type %s) - will be cleaned up", agentName, agent.Type)
 		}
@@ -1822,8 +3374,20 @@ func (d *Daemon) restoreRepoAgents(repoName string, repo *state.Repository) erro
 		return fmt.Errorf("repository path does not exist: %s", repoPath)
 	}
 
-	// Clear any stale agents from state (their tmux session is gone)
-	for agentName := range repo.Agents {
+	// Clear any stale agents from state (their tmux session is gone), keeping
+	// unfinished workers so they can be resumed in their worktrees, and
+	// headless agents, which don't live in the session
+	resumable := make(map[string]state.Agent)
+	profiles := make(map[string]state.AgentProfile)
+	for agentName, agent := range repo.Agents {
+		if agent.Headless {
+			continue
+		}
+		if canResumeWorker(agent) {
+			resumable[agentName] = agent
+			continue
+		}
+		profiles[agentName] = agent.Profile
 		d.logger.Debug("Removing stale agent %s/%s from state", repoName, agentName)
 		if err := d.state.RemoveAgent(repoName, agentName); err != nil {
 			d.logger.Warn("Failed to remove stale agent %s/%s: %v", repoName, agentName, err)
@@ -1844,7 +3408,7 @@ func (d *Daemon) restoreRepoAgents(repoName string, repo *state.Repository) erro
 	}
 
 	// Start supervisor agent
-	if err := d.startAgent(repoName, repo, "supervisor", state.AgentTypeSupervisor, repoPath); err != nil {
+	if err := d.startAgent(repoName, repo, "supervisor", state.AgentTypeSupervisor, repoPath, profiles["supervisor"]); err != nil {
 		d.logger.Error("Failed to start supervisor for %s: %v", repoName, err)
 	}
 
@@ -1899,12 +3463,22 @@ func (d *Daemon) restoreRepoAgents(repoName string, repo *state.Repository) erro
 		if err := cmd.Run(); err != nil {
 			d.logger.Error("Failed to create workspace window: %v", err)
 		} else {
-			if err := d.startAgent(repoName, repo, "workspace", state.AgentTypeWorkspace, workspacePath); err != nil {
+			if err := d.startAgent(repoName, repo, "workspace", state.AgentTypeWorkspace, workspacePath, profiles["workspace"]); err != nil {
 				d.logger.Error("Failed to start workspace for %s: %v", repoName, err)
 			}
 		}
 	}
 
+	// Resume workers whose tmux windows went away with the session
+	for agentName, agent := range resumable {
+		if !d.resumeCrashedWorker(repoName, agentName, agent, repo, "tmux session was lost") {
+			d.logger.Debug("Removing stale worker %s/%s from state", repoName, agentName)
+			if err := d.state.RemoveAgent(repoName, agentName); err != nil {
+				d.logger.Warn("Failed to remove stale agent %s/%s: %v", repoName, agentName, err)
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -2029,24 +3603,69 @@ func (d *Daemon) getClaudeBinaryPath() (string, error) {
 
 // agentStartConfig holds configuration for starting an agent
 type agentStartConfig struct {
-	agentName  string
-	agentType  state.AgentType
-	promptFile string
-	workDir    string
+	agentName      string
+	agentType      state.AgentType
+	promptFile     string
+	workDir        string
+	initialMessage string             // Optional first message sent once Claude is up (e.g., the worker task)
+	profile        state.AgentProfile // Model, tools, and permissions; stored on the agent for restarts
 }
 
-// startAgentWithConfig is the unified agent start function that handles all common logic
+// startAgentWithConfig starts Claude in an agent's tmux window and registers
+// the agent with state
 func (d *Daemon) startAgentWithConfig(repoName string, repo *state.Repository, cfg agentStartConfig) error {
+	// Copy hooks config if needed
+	if err := hooks.CopyConfig(d.paths.RepoDir(repoName), cfg.workDir); err != nil {
+		d.logger.Warn("Failed to copy hooks config: %v", err)
+	}
+
+	sessionID, pid, err := d.launchClaude(repoName, repo, cfg)
+	if err != nil {
+		return err
+	}
+
+	// Register agent with state
+	agent := state.Agent{
+		Type:         cfg.agentType,
+		WorktreePath: cfg.workDir,
+		TmuxWindow:   cfg.agentName,
+		SessionID:    sessionID,
+		PID:          pid,
+		CreatedAt:    time.Now(),
+		Profile:      cfg.profile,
+		PromptFile:   cfg.promptFile,
+	}
+
+	if err := d.state.AddAgent(repoName, cfg.agentName, agent); err != nil {
+		return fmt.Errorf("failed to register agent: %w", err)
+	}
+
+	d.logger.Info("Started and registered agent %s/%s", repoName, cfg.agentName)
+	d.publishEvent(events.AgentSpawned, repoName, cfg.agentName, map[string]interface{}{
+		"type": string(cfg.agentType),
+	})
+	return nil
+}
+
+// launchClaude starts Claude in an agent's existing tmux window, under the
+// permission profile of its type, waits for its prompt, and sends the initial
+// message. The agent's hooks must already be in place. Returns the new session ID and the
+// PID of the pane.
+func (d *Daemon) launchClaude(repoName string, repo *state.Repository, cfg agentStartConfig) (string, int, error) {
+	if err := claude.Profile(cfg.profile).Validate(); err != nil {
+		return "", 0, fmt.Errorf("invalid profile for %s: %w", cfg.agentName, err)
+	}
+
 	// Generate session ID
 	sessionID, err := claude.GenerateSessionID()
 	if err != nil {
-		return fmt.Errorf("failed to generate session ID: %w", err)
+		return "", 0, fmt.Errorf("failed to generate session ID: %w", err)
 	}
 
-	// Copy hooks config if needed
-	repoPath := d.paths.RepoDir(repoName)
-	if err := hooks.CopyConfig(repoPath, cfg.workDir); err != nil {
-		d.logger.Warn("Failed to copy hooks config: %v", err)
+	// Render the permission profile of the agent's type next to the hooks
+	profile, err := d.launchProfile(repoName, cfg.agentName, cfg.agentType, cfg.workDir, cfg.profile)
+	if err != nil {
+		return "", 0, err
 	}
 
 	var pid int
@@ -2056,50 +3675,87 @@ func (d *Daemon) startAgentWithConfig(repoName string, repo *state.Repository, c
 		// Resolve claude binary path
 		binaryPath, err := d.getClaudeBinaryPath()
 		if err != nil {
-			return fmt.Errorf("failed to resolve claude binary: %w", err)
+			return "", 0, fmt.Errorf("failed to resolve claude binary: %w", err)
 		}
 
 		// Build CLI command
-		claudeCmd := fmt.Sprintf("%s --session-id %s --dangerously-skip-permissions --append-system-prompt-file %s",
-			binaryPath, sessionID, cfg.promptFile)
+		claudeCmd := fmt.Sprintf("%s --session-id %s %s", binaryPath, sessionID, claude.QuoteArgs(launchFlags(cfg.promptFile, profile)))
 
 		// Send command to tmux window
 		target := fmt.Sprintf("%s:%s", repo.TmuxSession, cfg.agentName)
 		cmd := exec.Command("tmux", "send-keys", "-t", target, claudeCmd, "C-m")
 		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to start Claude in tmux: %w", err)
+			return "", 0, fmt.Errorf("failed to start Claude in tmux: %w", err)
 		}
 
-		// Wait a moment for Claude to start
-		time.Sleep(500 * time.Millisecond)
+		// Wait for Claude's input prompt, so nothing is typed into the shell
+		if err := d.waitForClaude(repo.TmuxSession, cfg.agentName); err != nil {
+			return "", 0, err
+		}
 
 		// Get PID
 		pid, err = d.tmux.GetPanePID(d.ctx, repo.TmuxSession, cfg.agentName)
 		if err != nil {
-			return fmt.Errorf("failed to get Claude PID: %w", err)
+			return "", 0, fmt.Errorf("failed to get Claude PID: %w", err)
+		}
+
+		// Send the initial message and check that Claude received it
+		if cfg.initialMessage != "" {
+			if err := d.tmux.SendKeysLiteralWithEnter(d.ctx, repo.TmuxSession, cfg.agentName, cfg.initialMessage); err != nil {
+				return "", 0, fmt.Errorf("failed to send initial message: %w", err)
+			}
+			if d.claudeRunner.DeliveryTimeout > 0 {
+				if err := claude.ConfirmDelivery(d.ctx, d.tmux, repo.TmuxSession, cfg.agentName, cfg.initialMessage, d.claudeRunner.DeliveryTimeout); err != nil {
+					return "", 0, fmt.Errorf("failed to send initial message: %w", err)
+				}
+			}
 		}
 	}
 
-	// Register agent with state
-	agent := state.Agent{
-		Type:         cfg.agentType,
-		WorktreePath: cfg.workDir,
-		TmuxWindow:   cfg.agentName,
-		SessionID:    sessionID,
-		PID:          pid,
-		CreatedAt:    time.Now(),
+	return sessionID, pid, nil
+}
+
+// launchFlags returns the flags for Claude besides the session: the system
+// prompt file and the profile's flags. A permission mode in the profile
+// replaces skipping permissions.
+func launchFlags(promptFile string, profile claude.Profile) []string {
+	var flags []string
+	if profile.PermissionMode == "" {
+		flags = append(flags, "--dangerously-skip-permissions")
 	}
+	flags = append(flags, "--append-system-prompt-file", promptFile)
+	return append(flags, profile.Args()...)
+}
 
-	if err := d.state.AddAgent(repoName, cfg.agentName, agent); err != nil {
-		return fmt.Errorf("failed to register agent: %w", err)
+// waitForClaude waits for Claude's input prompt in an agent's window, using
+// the same timeout as restarts through the runner. A zero timeout falls back
+// to the runner's fixed delays.
+func (d *Daemon) waitForClaude(session, window string) error {
+	if d.claudeRunner.ReadyTimeout <= 0 {
+		time.Sleep(d.claudeRunner.StartupDelay + d.claudeRunner.MessageDelay)
+		return nil
 	}
+	return claude.WaitForReady(d.ctx, d.tmux, session, window, d.claudeRunner.ReadyTimeout)
+}
 
-	d.logger.Info("Started and registered agent %s/%s", repoName, cfg.agentName)
-	return nil
+// launchProfile renders the permission profile the repository picked for the
+// agent's type and returns the profile to launch Claude with. The agent's own
+// profile is stored unchanged, so a restart picks up a changed selection.
+func (d *Daemon) launchProfile(repoName, agentName string, agentType state.AgentType, workDir string, profile state.AgentProfile) (claude.Profile, error) {
+	name := d.state.GetPermissionProfile(repoName, agentType)
+	perms, ok := permissions.Get(name)
+	if !ok {
+		return claude.Profile{}, fmt.Errorf("unknown permission profile %q for %s agents", name, agentType)
+	}
+	settingsFile, err := perms.Install(d.paths.RepoDir(repoName), workDir, d.paths.AgentSettingsFile(repoName, agentName))
+	if err != nil {
+		return claude.Profile{}, fmt.Errorf("failed to install permission profile %s for %s: %w", perms.Name, agentName, err)
+	}
+	return claude.Profile(perms.Apply(profile, settingsFile)), nil
 }
 
 // startAgent starts a Claude agent in a tmux window and registers it with state
-func (d *Daemon) startAgent(repoName string, repo *state.Repository, agentName string, agentType state.AgentType, workDir string) error {
+func (d *Daemon) startAgent(repoName string, repo *state.Repository, agentName string, agentType state.AgentType, workDir string, profile state.AgentProfile) error {
 	promptFile, err := d.writePromptFile(repoName, agentType, agentName)
 	if err != nil {
 		return fmt.Errorf("failed to write prompt file: %w", err)
@@ -2110,36 +3766,105 @@ func (d *Daemon) startAgent(repoName string, repo *state.Repository, agentName s
 		agentType:  agentType,
 		promptFile: promptFile,
 		workDir:    workDir,
+		profile:    profile,
 	})
 }
 
 // writePromptFileWithPrefix writes a prompt file with an optional prefix prepended to the content
 func (d *Daemon) writePromptFileWithPrefix(repoName string, agentType state.AgentType, agentName, prefix string) (string, error) {
-	repoPath := d.paths.RepoDir(repoName)
+	promptText, err := d.agentPrompt(repoName, agentType, prefix)
+	if err != nil {
+		return "", err
+	}
+	return d.savePromptFile(repoName, agentName, promptText)
+}
 
-	// Get the base prompt (without CLI docs since we don't have them in daemon context)
-	promptText, err := prompts.GetPrompt(repoPath, agentType, "")
+// agentPrompt returns the base prompt of an agent type, with the CLI
+// documentation, and with an optional prefix prepended
+func (d *Daemon) agentPrompt(repoName string, agentType state.AgentType, prefix string) (string, error) {
+	promptText, err := prompts.GetPrompt(d.paths.RepoDir(repoName), agentType, d.documentation)
 	if err != nil {
 		return "", fmt.Errorf("failed to get prompt: %w", err)
 	}
 
-	// Prepend prefix if provided
 	if prefix != "" {
 		promptText = prefix + "\n\n" + promptText
 	}
+	return promptText, nil
+}
+
+// savePromptFile stores an agent's prompt as its newest version and returns
+// the path of the file
+func (d *Daemon) savePromptFile(repoName, agentName, promptText string) (string, error) {
+	promptPath, _, err := d.promptStore.Save(repoName, agentName, promptText)
+	return promptPath, err
+}
+
+// currentPrompt returns the prompt an agent would be launched with now, from
+// the repository's current agent definitions and configuration. Agents whose
+// prompt was given to spawn_agent cannot be regenerated.
+func (d *Daemon) currentPrompt(repoName, agentName string, agent state.Agent) (string, error) {
+	switch agent.Type {
+	case state.AgentTypeSupervisor, state.AgentTypeWorkspace, state.AgentTypeReview:
+		return d.agentPrompt(repoName, agent.Type, "")
+	case state.AgentTypeWorker:
+		// A worker that is not on its own work/<name> branch pushes to a PR branch
+		pushTo := ""
+		if branch, err := worktree.GetCurrentBranch(agent.WorktreePath); err == nil && branch != "work/"+agentName {
+			pushTo = branch
+		}
+		return d.workerPrompt(repoName, pushTo)
+	case state.AgentTypeMergeQueue, state.AgentTypePRShepherd:
+		return d.trackingAgentPrompt(repoName, agent.Type)
+	default:
+		return "", fmt.Errorf("the prompt of %s agents is given when they are spawned and cannot be regenerated", agent.Type)
+	}
+}
+
+// trackingAgentPrompt returns the prompt of a merge-queue or pr-shepherd
+// agent, as 'multiclaude init' starts them: the agent definition with the CLI
+// documentation, preceded by the PR tracking mode and, for the pr-shepherd,
+// the fork workflow
+func (d *Daemon) trackingAgentPrompt(repoName string, agentType state.AgentType) (string, error) {
+	reader := agents.NewReader(d.paths.RepoAgentsDir(repoName), d.paths.RepoDir(repoName))
+	def, found, err := reader.ReadDefinition(string(agentType))
+	if err != nil {
+		return "", fmt.Errorf("failed to read agent definitions: %w", err)
+	}
+	if !found {
+		return "", fmt.Errorf("no %s agent definition found", agentType)
+	}
 
-	// Create prompt file in prompts directory
-	promptDir := filepath.Join(d.paths.Root, "prompts")
-	if err := os.MkdirAll(promptDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create prompt directory: %w", err)
+	promptText := def.Content
+	if d.documentation != "" {
+		promptText += fmt.Sprintf("\n\n---\n\n%s", d.documentation)
+	}
+	if slashCommands := prompts.GetSlashCommandsPrompt(); slashCommands != "" {
+		promptText += fmt.Sprintf("\n\n---\n\n%s", slashCommands)
 	}
 
-	promptPath := filepath.Join(promptDir, fmt.Sprintf("%s.md", agentName))
-	if err := os.WriteFile(promptPath, []byte(promptText), 0644); err != nil {
-		return "", fmt.Errorf("failed to write prompt file: %w", err)
+	var trackMode state.TrackMode
+	if agentType == state.AgentTypePRShepherd {
+		psConfig, err := d.state.GetPRShepherdConfig(repoName)
+		if err != nil {
+			return "", err
+		}
+		forkConfig, err := d.state.GetForkConfig(repoName)
+		if err != nil {
+			return "", err
+		}
+		forkContext := prompts.GenerateForkWorkflowPrompt(forkConfig.UpstreamOwner, forkConfig.UpstreamRepo, forkConfig.UpstreamOwner)
+		promptText = forkContext + "\n\n" + promptText
+		trackMode = psConfig.TrackMode
+	} else {
+		mqConfig, err := d.state.GetMergeQueueConfig(repoName)
+		if err != nil {
+			return "", err
+		}
+		trackMode = mqConfig.TrackMode
 	}
 
-	return promptPath, nil
+	return prompts.GenerateTrackingModePrompt(string(trackMode)) + "\n\n" + promptText, nil
 }
 
 // restartAgent restarts an agent that has exited.
@@ -2161,14 +3886,19 @@ func (d *Daemon) restartAgent(repoName, agentName string, agent state.Agent, rep
 		hasHistory = true
 	}
 
-	// Get the existing prompt file path
-	promptFile := filepath.Join(d.paths.Root, "prompts", agentName+".md")
-	if _, err := os.Stat(promptFile); os.IsNotExist(err) {
-		// Regenerate the prompt file if it doesn't exist
-		promptFile, err = d.writePromptFile(repoName, prompts.AgentType(agent.Type), agentName)
-		if err != nil {
-			return fmt.Errorf("failed to regenerate prompt file: %w", err)
-		}
+	// Resume with the prompt the session was started with
+	promptFile, err := d.sessionPromptFile(repoName, agentName, agent)
+	if err != nil {
+		return fmt.Errorf("failed to regenerate prompt file: %w", err)
+	}
+
+	// Refresh hooks and permissions so config changes apply to the restarted agent
+	if err := hooks.CopyConfig(d.paths.RepoDir(repoName), agent.WorktreePath); err != nil {
+		d.logger.Warn("Failed to copy hooks config: %v", err)
+	}
+	profile, err := d.launchProfile(repoName, agentName, agent.Type, agent.WorktreePath, agent.Profile)
+	if err != nil {
+		return err
 	}
 
 	// Restart Claude using the runner
@@ -2177,6 +3907,7 @@ func (d *Daemon) restartAgent(repoName, agentName string, agent state.Agent, rep
 		SessionID:        agent.SessionID,
 		Resume:           hasHistory,
 		SystemPromptFile: promptFile,
+		Profile:          profile,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to restart Claude: %w", err)
@@ -2188,9 +3919,74 @@ func (d *Daemon) restartAgent(repoName, agentName string, agent state.Agent, rep
 	}
 
 	d.logger.Info("Restarted agent %s with PID %d (resumed=%v)", agentName, result.PID, hasHistory)
+	d.publishEvent(events.AgentRestarted, repoName, agentName, map[string]interface{}{
+		"type":    string(agent.Type),
+		"pid":     result.PID,
+		"resumed": hasHistory,
+	})
 	return nil
 }
 
+// sessionPromptFile returns the prompt file to restart an agent's session
+// with. Agents started before prompts were kept per repository have none
+// recorded; the prompt resolveSessionPrompt finds for them is saved if need
+// be and recorded from then on.
+func (d *Daemon) sessionPromptFile(repoName, agentName string, agent state.Agent) (string, error) {
+	d.copyMissingAgentTemplates(repoName)
+	promptFile, promptText, err := d.resolveSessionPrompt(repoName, agentName, agent)
+	if err != nil {
+		return "", err
+	}
+	if promptFile != "" && promptFile == agent.PromptFile {
+		return promptFile, nil
+	}
+
+	if promptFile == "" {
+		if promptFile, err = d.savePromptFile(repoName, agentName, promptText); err != nil {
+			return "", err
+		}
+	}
+	if err := d.state.SetAgentPromptFile(repoName, agentName, promptFile); err != nil {
+		d.logger.Warn("Failed to record prompt file of %s: %v", agentName, err)
+	}
+	return promptFile, nil
+}
+
+// resolveSessionPrompt returns the prompt an agent's session was started with
+// and its file, without saving or recording anything: the recorded prompt
+// file, or for agents without one their latest prompt version, or a
+// regenerated prompt, whose file is empty since it was never saved.
+func (d *Daemon) resolveSessionPrompt(repoName, agentName string, agent state.Agent) (string, string, error) {
+	if agent.PromptFile != "" {
+		if data, err := os.ReadFile(agent.PromptFile); err == nil {
+			return agent.PromptFile, string(data), nil
+		}
+	}
+
+	versions, err := d.promptStore.Versions(repoName, agentName)
+	if err != nil {
+		return "", "", err
+	}
+	if len(versions) > 0 {
+		latest := versions[len(versions)-1].Path
+		data, err := os.ReadFile(latest)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read prompt file: %w", err)
+		}
+		return latest, string(data), nil
+	}
+
+	promptText, err := d.currentPrompt(repoName, agentName, agent)
+	if err != nil {
+		// Fall back to the base prompt of the agent's type
+		promptText, err = d.agentPrompt(repoName, agent.Type, "")
+		if err != nil {
+			return "", "", err
+		}
+	}
+	return "", promptText, nil
+}
+
 // writePromptFile writes the agent prompt to a file and returns the path
 func (d *Daemon) writePromptFile(repoName string, agentType state.AgentType, agentName string) (string, error) {
 	return d.writePromptFileWithPrefix(repoName, agentType, agentName, "")
@@ -2216,8 +4012,9 @@ func appendToSliceMap(m map[string][]string, key, value string) {
 	m[key] = append(m[key], value)
 }
 
-// Run runs the daemon in the foreground
-func Run() error {
+// Run runs the daemon in the foreground. documentation is the CLI reference
+// included in the prompts of the agents the daemon spawns.
+func Run(documentation string) error {
 	paths, err := config.DefaultPaths()
 	if err != nil {
 		return fmt.Errorf("failed to get paths: %w", err)
@@ -2227,6 +4024,7 @@ func Run() error {
 	if err != nil {
 		return fmt.Errorf("failed to create daemon: %w", err)
 	}
+	d.documentation = documentation
 
 	if err := d.Start(); err != nil {
 		return fmt.Errorf("failed to start daemon: %w", err)
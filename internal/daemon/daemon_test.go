@@ -2,6 +2,7 @@ package daemon
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -53,6 +54,10 @@ func setupTestDaemon(t *testing.T) (*Daemon, func()) {
 		t.Fatalf("Failed to create daemon: %v", err)
 	}
 
+	// Tests that launch agents in tmux have no usable Claude to wait for;
+	// use the runner's fixed startup delay instead
+	d.claudeRunner.ReadyTimeout = 0
+
 	cleanup := func() {
 		os.RemoveAll(tmpDir)
 	}
@@ -1182,6 +1187,116 @@ func TestMessageRoutingWithRealTmux(t *testing.T) {
 	}
 }
 
+// setupRoutingTestAgent creates a tmux session with a single worker window registered in state
+func setupRoutingTestAgent(t *testing.T, d *Daemon, sessionName string) {
+	t.Helper()
+
+	tmuxClient := tmux.NewClient()
+	if !tmuxClient.IsTmuxAvailable() {
+		t.Fatal("tmux is required for this test but not available")
+	}
+	if err := tmuxClient.CreateSession(context.Background(), sessionName, true); err != nil {
+		t.Fatalf("tmux is required for this test but cannot create sessions in this environment: %v", err)
+	}
+	t.Cleanup(func() { tmuxClient.KillSession(context.Background(), sessionName) })
+
+	if err := tmuxClient.CreateWindow(context.Background(), sessionName, "worker1"); err != nil {
+		t.Fatalf("Failed to create worker window: %v", err)
+	}
+
+	repo := &state.Repository{
+		GithubURL:   "https://github.com/test/repo",
+		TmuxSession: sessionName,
+		Agents:      make(map[string]state.Agent),
+	}
+	if err := d.state.AddRepo("test-repo", repo); err != nil {
+		t.Fatalf("Failed to add repo: %v", err)
+	}
+	if err := d.state.AddAgent("test-repo", "worker1", state.Agent{
+		Type:       state.AgentTypeWorker,
+		TmuxWindow: "worker1",
+		CreatedAt:  time.Now(),
+	}); err != nil {
+		t.Fatalf("Failed to add worker: %v", err)
+	}
+}
+
+func countMessagesWithStatus(t *testing.T, msgMgr *messages.Manager, status messages.Status) int {
+	t.Helper()
+
+	msgs, err := msgMgr.List("test-repo", "worker1")
+	if err != nil {
+		t.Fatalf("Failed to list messages: %v", err)
+	}
+	count := 0
+	for _, msg := range msgs {
+		if msg.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+func TestMessageRoutingBatchesBurst(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	setupRoutingTestAgent(t, d, "mc-test-batch")
+
+	msgMgr := messages.NewManager(d.paths.MessagesDir)
+	total := maxMessagesPerDelivery + 3
+	for i := 0; i < total; i++ {
+		if _, err := msgMgr.Send("test-repo", "supervisor", "worker1", fmt.Sprintf("Message %d", i)); err != nil {
+			t.Fatalf("Failed to send message: %v", err)
+		}
+	}
+
+	// First pass delivers a bounded batch and asks for another pass
+	d.TriggerMessageRouting()
+	if got := countMessagesWithStatus(t, msgMgr, messages.StatusDelivered); got != maxMessagesPerDelivery {
+		t.Errorf("delivered after first pass = %d, want %d", got, maxMessagesPerDelivery)
+	}
+	select {
+	case <-d.routeRequests:
+	default:
+		t.Error("a follow-up routing request should be queued when messages remain")
+	}
+
+	d.TriggerMessageRouting()
+	if got := countMessagesWithStatus(t, msgMgr, messages.StatusDelivered); got != total {
+		t.Errorf("delivered after second pass = %d, want %d", got, total)
+	}
+}
+
+func TestMessageRouterLoopDeliversOnSend(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	setupRoutingTestAgent(t, d, "mc-test-event-routing")
+
+	d.wg.Add(1)
+	go d.messageRouterLoop()
+	defer func() {
+		d.cancel()
+		d.wg.Wait()
+	}()
+
+	// Daemon-side sends request routing without waiting for the fallback poll
+	msgMgr := d.getMessageManager()
+	if _, err := msgMgr.Send("test-repo", "supervisor", "worker1", "Hello worker!"); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if countMessagesWithStatus(t, msgMgr, messages.StatusDelivered) == 1 {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("message was not delivered shortly after being sent")
+}
+
 func TestWakeLoopUpdatesNudgeTime(t *testing.T) {
 	tmuxClient := tmux.NewClient()
 	if !tmuxClient.IsTmuxAvailable() {
@@ -1710,8 +1825,8 @@ func TestWritePromptFileWorker(t *testing.T) {
 		t.Fatalf("writePromptFile() failed: %v", err)
 	}
 
-	// Verify file path is unique to agent name
-	expectedPath := filepath.Join(d.paths.Root, "prompts", "my-worker.md")
+	// Verify file path is unique to repository and agent name
+	expectedPath := filepath.Join(d.paths.Root, "prompts", repoName, "my-worker", "v1.md")
 	if promptPath != expectedPath {
 		t.Errorf("Prompt path = %s, want %s", promptPath, expectedPath)
 	}
@@ -0,0 +1,79 @@
+package daemon
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dlorenc/multiclaude/internal/format"
+	"github.com/dlorenc/multiclaude/internal/messages"
+)
+
+const (
+	// maxThreadContext is how many earlier messages of a thread are shown
+	// when a reply is delivered
+	maxThreadContext = 5
+
+	// threadContextWidth truncates each earlier message shown with a reply
+	threadContextWidth = 200
+)
+
+// sortForDelivery orders pending messages by priority, then by send time
+func sortForDelivery(pending []*messages.Message) {
+	sort.SliceStable(pending, func(i, j int) bool {
+		if ri, rj := pending[i].Priority.Rank(), pending[j].Priority.Rank(); ri != rj {
+			return ri > rj
+		}
+		return pending[i].Timestamp.Before(pending[j].Timestamp)
+	})
+}
+
+// formatDelivery renders a message for injection into an agent's pane. The ID
+// is included so the agent can reply; broadcasts name the group they were
+// sent to, and replies are followed by the messages that came before them in
+// the thread.
+func formatDelivery(msgMgr *messages.Manager, repoName string, msg *messages.Message) string {
+	kind, icon := "Message", "📨"
+	switch {
+	case msg.ReplyTo != "":
+		kind = "Reply"
+	case msg.Group != "":
+		kind, icon = "Broadcast", "📢"
+	}
+	if msg.Priority == messages.PriorityUrgent {
+		icon = "🚨"
+		kind = "Urgent " + strings.ToLower(kind)
+	}
+	if msg.Group != "" && msg.ReplyTo == "" {
+		kind += " to " + msg.Group
+	}
+	text := fmt.Sprintf("%s %s from %s [%s]: %s", icon, kind, msg.From, msg.ID, msg.Body)
+	if msg.ReplyTo == "" {
+		return text
+	}
+
+	thread, err := msgMgr.Thread(repoName, msg.Thread())
+	if err != nil {
+		return text
+	}
+	var earlier []*messages.Message
+	for _, m := range thread {
+		if m.ID != msg.ID && !m.Timestamp.After(msg.Timestamp) {
+			earlier = append(earlier, m)
+		}
+	}
+	if len(earlier) == 0 {
+		return text
+	}
+
+	lines := []string{text, "Earlier in this thread:"}
+	if omitted := len(earlier) - maxThreadContext; omitted > 0 {
+		lines = append(lines, fmt.Sprintf("  (%d earlier message(s) not shown: multiclaude message list --thread %s)", omitted, msg.Thread()))
+		earlier = earlier[omitted:]
+	}
+	for _, m := range earlier {
+		body := strings.Join(strings.Fields(m.Body), " ")
+		lines = append(lines, fmt.Sprintf("  %s → %s: %s", m.From, m.To, format.Truncate(body, threadContextWidth)))
+	}
+	return strings.Join(lines, "\n")
+}
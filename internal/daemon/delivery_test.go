@@ -0,0 +1,99 @@
+package daemon
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dlorenc/multiclaude/internal/messages"
+	"github.com/dlorenc/multiclaude/internal/socket"
+)
+
+func TestFormatDelivery(t *testing.T) {
+	msgMgr := messages.NewManager(t.TempDir())
+
+	question, _ := msgMgr.Send("test-repo", "worker1", "supervisor", "Which API\nshould I use?")
+	if got := formatDelivery(msgMgr, "test-repo", question); got != fmt.Sprintf("📨 Message from worker1 [%s]: Which API\nshould I use?", question.ID) {
+		t.Errorf("formatDelivery(question) = %q", got)
+	}
+
+	answer, _ := msgMgr.Reply("test-repo", "supervisor", question.ID, "The v2 one", messages.PriorityUrgent)
+	got := formatDelivery(msgMgr, "test-repo", answer)
+	want := fmt.Sprintf("🚨 Urgent reply from supervisor [%s]: The v2 one\nEarlier in this thread:\n  worker1 → supervisor: Which API should I use?", answer.ID)
+	if got != want {
+		t.Errorf("formatDelivery(answer) = %q, want %q", got, want)
+	}
+
+	broadcast := &messages.Message{ID: "msg-bc", From: "supervisor", Body: "Stop pushing", Group: "@workers", Priority: messages.PriorityNormal}
+	if got := formatDelivery(msgMgr, "test-repo", broadcast); got != "📢 Broadcast to @workers from supervisor [msg-bc]: Stop pushing" {
+		t.Errorf("formatDelivery(broadcast) = %q", got)
+	}
+
+	// Long threads show only the most recent context
+	last := answer
+	for i := 0; i < maxThreadContext; i++ {
+		from := "worker1"
+		if last.From == "worker1" {
+			from = "supervisor"
+		}
+		last, _ = msgMgr.Reply("test-repo", from, last.ID, fmt.Sprintf("Reply %d", i), messages.PriorityNormal)
+	}
+	got = formatDelivery(msgMgr, "test-repo", last)
+	if !strings.Contains(got, "(1 earlier message(s) not shown: multiclaude message list --thread "+question.ID+")") {
+		t.Errorf("long thread should point at the full thread:\n%s", got)
+	}
+	if strings.Contains(got, "Which API") || strings.Count(got, "\n  ") != maxThreadContext+1 {
+		t.Errorf("long thread should show only the last %d earlier messages:\n%s", maxThreadContext, got)
+	}
+}
+
+func TestMessageRoutingDeliversUrgentFirst(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	setupRoutingTestAgent(t, d, "mc-test-urgent")
+
+	msgMgr := messages.NewManager(d.paths.MessagesDir)
+	for i := 0; i < maxMessagesPerDelivery; i++ {
+		if _, err := msgMgr.Send("test-repo", "supervisor", "worker1", fmt.Sprintf("Chatter %d", i)); err != nil {
+			t.Fatalf("Failed to send message: %v", err)
+		}
+	}
+	urgent, err := msgMgr.SendWithOptions("test-repo", "supervisor", "worker1", "Main is broken, stop pushing", messages.SendOptions{Priority: messages.PriorityUrgent})
+	if err != nil {
+		t.Fatalf("Failed to send urgent message: %v", err)
+	}
+
+	// The batch is full of older chatter, but the urgent message goes first
+	d.TriggerMessageRouting()
+	delivered, err := msgMgr.Get("test-repo", "worker1", urgent.ID)
+	if err != nil {
+		t.Fatalf("Failed to read urgent message: %v", err)
+	}
+	if delivered.Status != messages.StatusDelivered {
+		t.Errorf("urgent message status = %s, want delivered in the first batch", delivered.Status)
+	}
+	if got := countMessagesWithStatus(t, msgMgr, messages.StatusPending); got != 1 {
+		t.Errorf("pending after first pass = %d, want the newest chatter left over", got)
+	}
+}
+
+func TestRouteMessagesUrgentSkipsDebounce(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	resp := d.handleRequest(socket.Request{Command: "route_messages", Args: map[string]interface{}{"urgent": true}})
+	if !resp.Success {
+		t.Fatalf("route_messages failed: %s", resp.Error)
+	}
+	select {
+	case <-d.urgentRouteRequests:
+	default:
+		t.Error("urgent routing request should be queued")
+	}
+	select {
+	case <-d.routeRequests:
+		t.Error("urgent routing should not go through the debounced queue")
+	default:
+	}
+}
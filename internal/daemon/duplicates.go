@@ -0,0 +1,104 @@
+package daemon
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dlorenc/multiclaude/internal/dedup"
+	"github.com/dlorenc/multiclaude/internal/socket"
+	"github.com/dlorenc/multiclaude/internal/state"
+)
+
+// duplicateHistoryWindow is how far back finished tasks are compared with a
+// new one
+const duplicateHistoryWindow = 30 * 24 * time.Hour
+
+// maxDuplicateMatches is how many similar tasks are reported
+const maxDuplicateMatches = 3
+
+// taskCandidates collects the tasks of a repository a new worker could
+// duplicate: running agents, queued and pending workers, and recent history
+// entries whose work is open or merged. Tasks that failed or were closed
+// without merging are left out since retrying them is expected.
+func taskCandidates(repo *state.Repository, now time.Time) []dedup.Candidate {
+	var candidates []dedup.Candidate
+	for name, agent := range repo.Agents {
+		if agent.Task == "" || agent.ReadyForCleanup {
+			continue
+		}
+		candidates = append(candidates, dedup.Candidate{Name: name, Task: agent.Task, Status: "running"})
+	}
+	for _, task := range repo.WorkerQueue {
+		candidates = append(candidates, dedup.Candidate{Name: task.Name, Task: task.Task, Status: "queued"})
+	}
+	for _, task := range repo.PendingTasks {
+		candidates = append(candidates, dedup.Candidate{Name: task.Name, Task: task.Task, Status: "pending"})
+	}
+	for _, entry := range repo.TaskHistory {
+		if _, running := repo.Agents[entry.Name]; running || entry.Task == "" {
+			continue
+		}
+		if entry.Status != state.TaskStatusOpen && entry.Status != state.TaskStatusMerged {
+			continue
+		}
+		finished := entry.CompletedAt
+		if finished.IsZero() {
+			finished = entry.CreatedAt
+		}
+		if now.Sub(finished) > duplicateHistoryWindow {
+			continue
+		}
+		candidates = append(candidates, dedup.Candidate{Name: entry.Name, Task: entry.Task, Status: string(entry.Status)})
+	}
+	return candidates
+}
+
+// similarTasks returns the tasks in a repository that look like task, best
+// match first
+func (d *Daemon) similarTasks(repoName, task string) ([]dedup.Match, error) {
+	repo, exists := d.state.GetAllRepos()[repoName]
+	if !exists {
+		return nil, fmt.Errorf("repository %q not found", repoName)
+	}
+	return dedup.FindSimilar(task, taskCandidates(repo, time.Now()), dedup.DefaultThreshold, maxDuplicateMatches), nil
+}
+
+// handleFindSimilarTasks reports the tasks already running, queued, or
+// recently finished in a repository that resemble a new one
+func (d *Daemon) handleFindSimilarTasks(req socket.Request) socket.Response {
+	repoName, errResp, ok := getRequiredStringArg(req.Args, "repo", "repository name is required")
+	if !ok {
+		return errResp
+	}
+
+	task, errResp, ok := getRequiredStringArg(req.Args, "task", "task description is required")
+	if !ok {
+		return errResp
+	}
+
+	matches, err := d.similarTasks(repoName, task)
+	if err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
+
+	result := make([]map[string]interface{}, 0, len(matches))
+	for _, m := range matches {
+		result = append(result, map[string]interface{}{
+			"name":   m.Name,
+			"task":   m.Task,
+			"status": m.Status,
+			"score":  m.Score,
+		})
+	}
+	return socket.SuccessResponse(result)
+}
+
+// duplicateTaskError describes the tasks a new one appears to duplicate
+func duplicateTaskError(matches []dedup.Match) string {
+	descriptions := make([]string, 0, len(matches))
+	for _, m := range matches {
+		descriptions = append(descriptions, fmt.Sprintf("%s (%s): %q", m.Name, m.Status, m.Task))
+	}
+	return fmt.Sprintf("task looks like a duplicate of %s; pass force to spawn it anyway", strings.Join(descriptions, "; "))
+}
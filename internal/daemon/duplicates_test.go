@@ -0,0 +1,98 @@
+package daemon
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dlorenc/multiclaude/internal/socket"
+	"github.com/dlorenc/multiclaude/internal/state"
+)
+
+func TestTaskCandidates(t *testing.T) {
+	now := time.Now()
+	repo := &state.Repository{
+		Agents: map[string]state.Agent{
+			"supervisor": {Type: state.AgentTypeSupervisor},
+			"clever-fox": {Type: state.AgentTypeWorker, Task: "Fix flaky auth test"},
+			"done-owl":   {Type: state.AgentTypeWorker, Task: "Finished work", ReadyForCleanup: true},
+		},
+		WorkerQueue:  []state.QueuedTask{{Name: "queued-bee", Task: "Queued work"}},
+		PendingTasks: []state.PendingTask{{Name: "pending-elk", Task: "Pending work"}},
+		TaskHistory: []state.TaskHistoryEntry{
+			{Name: "merged-yak", Task: "Merged work", Status: state.TaskStatusMerged, CompletedAt: now.Add(-time.Hour)},
+			{Name: "open-emu", Task: "Open work", Status: state.TaskStatusOpen, CreatedAt: now.Add(-2 * time.Hour)},
+			{Name: "failed-gnu", Task: "Failed work", Status: state.TaskStatusFailed, CompletedAt: now},
+			{Name: "old-cat", Task: "Old work", Status: state.TaskStatusMerged, CompletedAt: now.Add(-60 * 24 * time.Hour)},
+			{Name: "clever-fox", Task: "Fix flaky auth test", Status: state.TaskStatusOpen, CreatedAt: now},
+		},
+	}
+
+	got := make(map[string]string)
+	for _, c := range taskCandidates(repo, now) {
+		if _, dup := got[c.Name]; dup {
+			t.Errorf("%s listed twice", c.Name)
+		}
+		got[c.Name] = c.Status
+	}
+	want := map[string]string{
+		"clever-fox":  "running",
+		"queued-bee":  "queued",
+		"pending-elk": "pending",
+		"merged-yak":  "merged",
+		"open-emu":    "open",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("taskCandidates() = %v, want %v", got, want)
+	}
+	for name, status := range want {
+		if got[name] != status {
+			t.Errorf("%s status = %q, want %q", name, got[name], status)
+		}
+	}
+}
+
+func TestSpawnAgentRefusesDuplicateTask(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	repo := &state.Repository{
+		GithubURL:   "https://github.com/test/repo",
+		TmuxSession: "mc-test-dup",
+		Agents: map[string]state.Agent{
+			"clever-fox": {Type: state.AgentTypeWorker, Task: "Fix the flaky TestDaemonRestart test", CreatedAt: time.Now()},
+		},
+	}
+	if err := d.state.AddRepo("test-repo", repo); err != nil {
+		t.Fatalf("Failed to add repo: %v", err)
+	}
+
+	resp := d.handleFindSimilarTasks(socket.Request{Command: "find_similar_tasks", Args: map[string]interface{}{
+		"repo": "test-repo",
+		"task": "fix flaky TestDaemonRestart test",
+	}})
+	matches, _ := resp.Data.([]map[string]interface{})
+	if !resp.Success || len(matches) != 1 || matches[0]["name"] != "clever-fox" {
+		t.Fatalf("find_similar_tasks = %+v (%s), want clever-fox", resp.Data, resp.Error)
+	}
+
+	args := map[string]interface{}{
+		"repo":   "test-repo",
+		"name":   "happy-owl",
+		"class":  "ephemeral",
+		"prompt": "You are a worker",
+		"task":   "fix flaky TestDaemonRestart test",
+	}
+	resp = d.handleSpawnAgent(socket.Request{Command: "spawn_agent", Args: args})
+	if resp.Success || !strings.Contains(resp.Error, "duplicate of clever-fox") {
+		t.Fatalf("spawn_agent error = %q, want a duplicate of clever-fox", resp.Error)
+	}
+
+	// With force the check is skipped and spawning fails later on, without a
+	// repository checkout to create the worktree in
+	args["force"] = true
+	resp = d.handleSpawnAgent(socket.Request{Command: "spawn_agent", Args: args})
+	if strings.Contains(resp.Error, "duplicate") {
+		t.Errorf("spawn_agent with force still refused: %s", resp.Error)
+	}
+}
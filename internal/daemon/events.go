@@ -0,0 +1,91 @@
+package daemon
+
+import (
+	"fmt"
+
+	"github.com/dlorenc/multiclaude/internal/events"
+	"github.com/dlorenc/multiclaude/internal/socket"
+)
+
+// publishEvent emits a daemon event to subscribers
+func (d *Daemon) publishEvent(eventType events.Type, repoName, agentName string, data map[string]interface{}) {
+	d.events.Publish(events.Event{
+		Type:  eventType,
+		Repo:  repoName,
+		Agent: agentName,
+		Data:  data,
+	})
+}
+
+// parseEventFilter builds an event filter from the optional repo (string) and
+// types (list or comma-separated string of event types) request args
+func (d *Daemon) parseEventFilter(args map[string]interface{}) (events.Filter, error) {
+	filter := events.Filter{Repo: getOptionalStringArg(args, "repo", "")}
+	for _, t := range parseListArg(args["types"]) {
+		eventType := events.Type(t)
+		if !eventType.IsValid() {
+			return filter, fmt.Errorf("unknown event type %q (valid types: %v)", t, events.AllTypes)
+		}
+		filter.Types = append(filter.Types, eventType)
+	}
+
+	if filter.Repo != "" {
+		if _, exists := d.state.GetRepo(filter.Repo); !exists {
+			return filter, fmt.Errorf("repository %q not found", filter.Repo)
+		}
+	}
+	return filter, nil
+}
+
+// handleRecentEvents returns the events the daemon has retained, oldest first.
+// Accepts the same filter args as subscribe plus an optional limit.
+func (d *Daemon) handleRecentEvents(req socket.Request) socket.Response {
+	filter, err := d.parseEventFilter(req.Args)
+	if err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
+
+	limit := 0
+	if v, ok := req.Args["limit"].(float64); ok {
+		limit = int(v)
+	}
+
+	recent := d.events.Recent(filter, limit)
+	if recent == nil {
+		recent = []events.Event{}
+	}
+	return socket.SuccessResponse(recent)
+}
+
+// handleSubscribe streams events as newline-delimited JSON until the client
+// disconnects or the daemon stops. See parseEventFilter for the accepted args.
+func (d *Daemon) handleSubscribe(req socket.Request, stream *socket.Stream) {
+	filter, err := d.parseEventFilter(req.Args)
+	if err != nil {
+		stream.Send(socket.ErrorResponse("%s", err.Error()))
+		return
+	}
+
+	sub := d.events.Subscribe(filter)
+	defer sub.Close()
+
+	if err := stream.Send(socket.SuccessResponse("subscribed")); err != nil {
+		return
+	}
+	d.logger.Debug("Event subscriber connected (repo=%q, types=%v)", filter.Repo, filter.Types)
+
+	for {
+		select {
+		case event := <-sub.C:
+			if err := stream.Send(event); err != nil {
+				d.logger.Debug("Event subscriber write failed: %v", err)
+				return
+			}
+		case <-stream.Done():
+			d.logger.Debug("Event subscriber disconnected (dropped %d events)", sub.Dropped())
+			return
+		case <-d.ctx.Done():
+			return
+		}
+	}
+}
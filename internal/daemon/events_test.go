@@ -0,0 +1,146 @@
+package daemon
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dlorenc/multiclaude/internal/events"
+	"github.com/dlorenc/multiclaude/internal/socket"
+	"github.com/dlorenc/multiclaude/internal/state"
+)
+
+func TestSubscribeStreamsEvents(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	repo := &state.Repository{
+		GithubURL:   "https://github.com/test/repo",
+		TmuxSession: "mc-test-events",
+		Agents:      make(map[string]state.Agent),
+	}
+	if err := d.state.AddRepo("test-repo", repo); err != nil {
+		t.Fatalf("Failed to add repo: %v", err)
+	}
+
+	if err := d.Start(); err != nil {
+		t.Fatalf("Failed to start daemon: %v", err)
+	}
+	defer d.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	client := socket.NewClient(d.paths.DaemonSock)
+
+	// Unknown event types are rejected up front
+	err := client.Subscribe(socket.Request{
+		Command: "subscribe",
+		Args:    map[string]interface{}{"types": "agent_exploded"},
+	}, func(json.RawMessage) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "unknown event type") {
+		t.Errorf("Subscribe() error = %v, want unknown event type", err)
+	}
+
+	received := make(chan events.Event, 1)
+	subErr := make(chan error, 1)
+	go func() {
+		subErr <- client.Subscribe(socket.Request{
+			Command: "subscribe",
+			Args:    map[string]interface{}{"repo": "test-repo", "types": []interface{}{"agent_spawned"}},
+		}, func(raw json.RawMessage) error {
+			var e events.Event
+			if err := json.Unmarshal(raw, &e); err != nil {
+				return err
+			}
+			received <- e
+			return socket.ErrStopStream
+		})
+	}()
+
+	// Wait for the subscription to register before generating events
+	deadline := time.Now().Add(2 * time.Second)
+	for d.events.SubscriberCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Filtered out by type
+	d.publishEvent(events.MessageDelivered, "test-repo", "supervisor", nil)
+
+	resp, err := client.Send(socket.Request{
+		Command: "add_agent",
+		Args: map[string]interface{}{
+			"repo":          "test-repo",
+			"agent":         "clever-fox",
+			"type":          "worker",
+			"worktree_path": "/tmp/clever-fox",
+			"tmux_window":   "clever-fox",
+			"task":          "Add events",
+		},
+	})
+	if err != nil || !resp.Success {
+		t.Fatalf("add_agent failed: %v %+v", err, resp)
+	}
+
+	select {
+	case e := <-received:
+		if e.Type != events.AgentSpawned || e.Repo != "test-repo" || e.Agent != "clever-fox" {
+			t.Errorf("event = %+v, want agent_spawned for test-repo/clever-fox", e)
+		}
+		if e.Data["task"] != "Add events" {
+			t.Errorf("event task = %v, want 'Add events'", e.Data["task"])
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for agent_spawned event")
+	}
+
+	if err := <-subErr; err != nil {
+		t.Errorf("Subscribe() failed: %v", err)
+	}
+
+	// The disconnected subscriber is cleaned up
+	deadline = time.Now().Add(2 * time.Second)
+	for d.events.SubscriberCount() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := d.events.SubscriberCount(); n != 0 {
+		t.Errorf("SubscriberCount() = %d after disconnect, want 0", n)
+	}
+}
+
+func TestRecentEvents(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	d.publishEvent(events.AgentSpawned, "repo-a", "w1", nil)
+	d.publishEvent(events.WorktreeRefreshed, "repo-a", "w1", nil)
+	d.publishEvent(events.AgentSpawned, "repo-b", "w2", nil)
+
+	resp := d.handleRequest(socket.Request{
+		Command: "recent_events",
+		Args:    map[string]interface{}{"types": "agent_spawned"},
+	})
+	if !resp.Success {
+		t.Fatalf("recent_events failed: %s", resp.Error)
+	}
+	recent, ok := resp.Data.([]events.Event)
+	if !ok || len(recent) != 2 {
+		t.Fatalf("recent_events returned %#v, want 2 agent_spawned events", resp.Data)
+	}
+	if recent[0].Repo != "repo-a" || recent[1].Repo != "repo-b" {
+		t.Errorf("events out of order: %+v", recent)
+	}
+
+	// Filtering by an untracked repo is an error
+	resp = d.handleRequest(socket.Request{
+		Command: "recent_events",
+		Args:    map[string]interface{}{"repo": "repo-a"},
+	})
+	if resp.Success {
+		t.Error("recent_events should reject unknown repos")
+	}
+
+	// subscribe only works over a streaming connection
+	if resp := d.handleRequest(socket.Request{Command: "subscribe"}); resp.Success {
+		t.Error("subscribe should fail outside a streaming connection")
+	}
+}
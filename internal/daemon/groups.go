@@ -0,0 +1,164 @@
+package daemon
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dlorenc/multiclaude/internal/messages"
+	"github.com/dlorenc/multiclaude/internal/socket"
+	"github.com/dlorenc/multiclaude/internal/state"
+)
+
+// Built-in group addresses. Named groups from the repository config are
+// addressed as @<name>.
+const (
+	groupAll      = "@all"
+	groupWorkers  = "@workers"
+	groupTypePfx  = "@type:"
+	maxGroupDepth = 5 // Nesting limit for named groups that include other groups
+)
+
+// isReservedGroupName reports whether a named group would shadow a built-in address
+func isReservedGroupName(name string) bool {
+	address := "@" + name
+	return address == groupAll || address == groupWorkers || strings.HasPrefix(address, groupTypePfx)
+}
+
+// expandGroup resolves a group address against the agents currently in a
+// repository. @all is every agent, @workers the workers still on their task,
+// @type:<type> every agent of that type, and @<name> a named group whose
+// members are agent names or other group addresses. The workspace is never
+// included since the router doesn't deliver to it. Members of named groups
+// that are no longer running are skipped.
+func expandGroup(repo *state.Repository, address string) ([]string, error) {
+	found := make(map[string]bool)
+	if err := expandGroupInto(repo, address, found, 0); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(found))
+	for name := range found {
+		if agent, ok := repo.Agents[name]; ok && agent.Type != state.AgentTypeWorkspace {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func expandGroupInto(repo *state.Repository, address string, found map[string]bool, depth int) error {
+	if depth > maxGroupDepth {
+		return fmt.Errorf("message group %s nests too deeply (is it part of a cycle?)", address)
+	}
+
+	switch {
+	case address == groupAll:
+		for name := range repo.Agents {
+			found[name] = true
+		}
+	case address == groupWorkers:
+		for name, agent := range repo.Agents {
+			if agent.Type == state.AgentTypeWorker && !agent.ReadyForCleanup {
+				found[name] = true
+			}
+		}
+	case strings.HasPrefix(address, groupTypePfx):
+		agentType := state.AgentType(strings.TrimPrefix(address, groupTypePfx))
+		if !agentType.IsValid() {
+			return fmt.Errorf("unknown agent type in %s", address)
+		}
+		for name, agent := range repo.Agents {
+			if agent.Type == agentType {
+				found[name] = true
+			}
+		}
+	default:
+		members, ok := repo.MessageGroups[strings.TrimPrefix(address, "@")]
+		if !ok {
+			return fmt.Errorf("unknown message group %s (use @all, @workers, @type:<type>, or a group defined with 'multiclaude config --message-group')", address)
+		}
+		for _, member := range members {
+			if !messages.IsGroupAddress(member) {
+				found[member] = true
+				continue
+			}
+			if err := expandGroupInto(repo, member, found, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolveMessageGroup expands a group address for the message manager at
+// send time
+func (d *Daemon) resolveMessageGroup(repoName, from, address string) ([]string, error) {
+	repo, exists := d.state.GetAllRepos()[repoName]
+	if !exists {
+		return nil, fmt.Errorf("repository %q not found", repoName)
+	}
+	return expandGroup(repo, address)
+}
+
+// handleSendMessage sends a message on behalf of an agent. Group addresses
+// are expanded here, against the agents running when the message is sent.
+func (d *Daemon) handleSendMessage(req socket.Request) socket.Response {
+	repoName, errResp, ok := getRequiredStringArg(req.Args, "repo", "repository name is required")
+	if !ok {
+		return errResp
+	}
+	from, errResp, ok := getRequiredStringArg(req.Args, "from", "sender is required")
+	if !ok {
+		return errResp
+	}
+	to, errResp, ok := getRequiredStringArg(req.Args, "to", "recipient is required")
+	if !ok {
+		return errResp
+	}
+	body, errResp, ok := getRequiredStringArg(req.Args, "body", "message body is required")
+	if !ok {
+		return errResp
+	}
+	priority, err := messages.ParsePriority(getOptionalStringArg(req.Args, "priority", ""))
+	if err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
+
+	msgMgr := d.getMessageManager()
+	opts := messages.SendOptions{Priority: priority}
+
+	var sent []*messages.Message
+	broadcastID := ""
+	if messages.IsGroupAddress(to) {
+		broadcast, err := msgMgr.Broadcast(repoName, from, to, body, opts)
+		if err != nil {
+			return socket.ErrorResponse("failed to send message to %s: %s", to, err.Error())
+		}
+		sent, broadcastID = broadcast.Messages, broadcast.ID
+	} else {
+		msg, err := msgMgr.SendWithOptions(repoName, from, to, body, opts)
+		if err != nil {
+			return socket.ErrorResponse("failed to send message: %s", err.Error())
+		}
+		sent = []*messages.Message{msg}
+	}
+	if priority == messages.PriorityUrgent {
+		d.requestUrgentMessageRouting()
+	}
+
+	ids := make([]string, len(sent))
+	recipients := make([]string, len(sent))
+	for i, msg := range sent {
+		ids[i] = msg.ID
+		recipients[i] = msg.To
+	}
+	if broadcastID != "" {
+		d.logger.Info("Broadcast %s from %s to %s in %s: %s", broadcastID, from, to, repoName, strings.Join(recipients, ", "))
+	}
+	return socket.SuccessResponse(map[string]interface{}{
+		"broadcast_id": broadcastID,
+		"message_ids":  ids,
+		"recipients":   recipients,
+	})
+}
@@ -0,0 +1,137 @@
+package daemon
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dlorenc/multiclaude/internal/messages"
+	"github.com/dlorenc/multiclaude/internal/socket"
+	"github.com/dlorenc/multiclaude/internal/state"
+)
+
+func TestExpandGroup(t *testing.T) {
+	repo := &state.Repository{
+		Agents: map[string]state.Agent{
+			"supervisor":  {Type: state.AgentTypeSupervisor},
+			"merge-queue": {Type: state.AgentTypeMergeQueue},
+			"workspace":   {Type: state.AgentTypeWorkspace},
+			"fox":         {Type: state.AgentTypeWorker},
+			"owl":         {Type: state.AgentTypeWorker},
+			"done-bee":    {Type: state.AgentTypeWorker, ReadyForCleanup: true},
+			"reviewer":    {Type: state.AgentTypeReview},
+		},
+		MessageGroups: map[string][]string{
+			"frontend": {"fox", "gone-elk"},
+			"leads":    {"supervisor", "@frontend", "@type:review"},
+			"loop":     {"@loop"},
+		},
+	}
+
+	tests := []struct {
+		address string
+		want    string
+	}{
+		{"@all", "done-bee,fox,merge-queue,owl,reviewer,supervisor"},
+		{"@workers", "fox,owl"},
+		{"@type:review", "reviewer"},
+		{"@type:merge-queue", "merge-queue"},
+		{"@frontend", "fox"},
+		{"@leads", "fox,reviewer,supervisor"},
+	}
+	for _, tt := range tests {
+		got, err := expandGroup(repo, tt.address)
+		if err != nil {
+			t.Errorf("expandGroup(%s) failed: %v", tt.address, err)
+			continue
+		}
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("expandGroup(%s) = %v, want %s", tt.address, got, tt.want)
+		}
+	}
+
+	for _, address := range []string{"@type:nonsense", "@missing", "@loop"} {
+		if _, err := expandGroup(repo, address); err == nil {
+			t.Errorf("expandGroup(%s) should fail", address)
+		}
+	}
+}
+
+func TestHandleSendMessageBroadcast(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	repo := &state.Repository{
+		GithubURL:   "https://github.com/test/repo",
+		TmuxSession: "mc-test",
+		Agents: map[string]state.Agent{
+			"supervisor": {Type: state.AgentTypeSupervisor},
+			"fox":        {Type: state.AgentTypeWorker},
+			"owl":        {Type: state.AgentTypeWorker},
+		},
+	}
+	if err := d.state.AddRepo("test-repo", repo); err != nil {
+		t.Fatalf("Failed to add repo: %v", err)
+	}
+
+	resp := d.handleRequest(socket.Request{Command: "send_message", Args: map[string]interface{}{
+		"repo":     "test-repo",
+		"from":     "supervisor",
+		"to":       "@workers",
+		"body":     "Main is broken, stop pushing",
+		"priority": "urgent",
+	}})
+	if !resp.Success {
+		t.Fatalf("send_message failed: %s", resp.Error)
+	}
+	data := resp.Data.(map[string]interface{})
+	broadcastID, _ := data["broadcast_id"].(string)
+	if broadcastID == "" || strings.Join(data["recipients"].([]string), ",") != "fox,owl" {
+		t.Fatalf("send_message response = %+v", data)
+	}
+
+	copies, err := messages.NewManager(d.paths.MessagesDir).BroadcastStatus("test-repo", broadcastID)
+	if err != nil {
+		t.Fatalf("BroadcastStatus() failed: %v", err)
+	}
+	if len(copies) != 2 || copies[0].Group != "@workers" || copies[0].Priority != messages.PriorityUrgent {
+		t.Errorf("broadcast copies = %+v", copies)
+	}
+
+	// Named groups are managed through the repo config
+	resp = d.handleRequest(socket.Request{Command: "update_repo_config", Args: map[string]interface{}{
+		"name":           "test-repo",
+		"message_groups": map[string]interface{}{"all": []interface{}{"fox"}},
+	}})
+	if resp.Success {
+		t.Error("update_repo_config should refuse a group named after a built-in address")
+	}
+	resp = d.handleRequest(socket.Request{Command: "update_repo_config", Args: map[string]interface{}{
+		"name":           "test-repo",
+		"message_groups": map[string]interface{}{"pair": []interface{}{"owl", "supervisor"}},
+	}})
+	if !resp.Success {
+		t.Fatalf("update_repo_config failed: %s", resp.Error)
+	}
+	resp = d.handleRequest(socket.Request{Command: "send_message", Args: map[string]interface{}{
+		"repo": "test-repo",
+		"from": "fox",
+		"to":   "@pair",
+		"body": "Can one of you review?",
+	}})
+	if !resp.Success {
+		t.Fatalf("send_message to a named group failed: %s", resp.Error)
+	}
+	if got := resp.Data.(map[string]interface{})["recipients"].([]string); strings.Join(got, ",") != "owl,supervisor" {
+		t.Errorf("@pair recipients = %v", got)
+	}
+
+	resp = d.handleRequest(socket.Request{Command: "send_message", Args: map[string]interface{}{
+		"repo": "test-repo",
+		"from": "fox",
+		"to":   "@type:review",
+		"body": "Anyone?",
+	}})
+	if resp.Success || !strings.Contains(resp.Error, "no agents match") {
+		t.Errorf("send_message to an empty group = %+v, want no agents match", resp)
+	}
+}
@@ -3,6 +3,7 @@ package daemon
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -2033,3 +2034,143 @@ func TestHandleGetRepoConfigTableDriven(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleAddAgentProfile(t *testing.T) {
+	d, cleanup := setupTestDaemonWithState(t, func(s *state.State) {
+		s.AddRepo("test-repo", &state.Repository{
+			GithubURL:   "https://github.com/test/repo",
+			TmuxSession: "test-session",
+			Agents:      make(map[string]state.Agent),
+		})
+	})
+	defer cleanup()
+
+	addAgent := func(name string, profile interface{}) socket.Response {
+		return d.handleRequest(socket.Request{
+			Command: "add_agent",
+			Args: map[string]interface{}{
+				"repo":          "test-repo",
+				"agent":         name,
+				"type":          "worker",
+				"worktree_path": "/tmp/test",
+				"tmux_window":   name,
+				"profile":       profile,
+			},
+		})
+	}
+
+	// Profiles arrive as decoded JSON objects over the socket
+	resp := addAgent("fox", map[string]interface{}{
+		"model":           "opus",
+		"allowed_tools":   []interface{}{"Read", "Bash(go test:*)"},
+		"permission_mode": "acceptEdits",
+	})
+	if !resp.Success {
+		t.Fatalf("add_agent failed: %s", resp.Error)
+	}
+	agent, _ := d.state.GetAgent("test-repo", "fox")
+	if agent.Profile.Model != "opus" || agent.Profile.PermissionMode != "acceptEdits" || len(agent.Profile.AllowedTools) != 2 {
+		t.Errorf("stored profile = %+v", agent.Profile)
+	}
+
+	resp = addAgent("owl", map[string]interface{}{"permission_mode": "yolo"})
+	if resp.Success || !strings.Contains(resp.Error, "invalid profile") {
+		t.Errorf("add_agent with an unknown permission mode = %+v, want invalid profile", resp)
+	}
+	resp = addAgent("bee", map[string]interface{}{"extra_args": []interface{}{"--resume", "abc"}})
+	if resp.Success {
+		t.Error("add_agent should refuse extra args that override the session")
+	}
+
+	// Queued workers keep the profile they were created with
+	if err := d.state.UpdateMaxWorkers("test-repo", 1); err != nil {
+		t.Fatalf("UpdateMaxWorkers() failed: %v", err)
+	}
+	resp = d.handleRequest(socket.Request{
+		Command: "reserve_worker_slot",
+		Args: map[string]interface{}{
+			"repo":    "test-repo",
+			"name":    "elk",
+			"task":    "Hard task",
+			"profile": state.AgentProfile{Model: "opus"},
+		},
+	})
+	if !resp.Success {
+		t.Fatalf("reserve_worker_slot failed: %s", resp.Error)
+	}
+	queue, _ := d.state.GetWorkerQueue("test-repo")
+	if len(queue) != 1 || queue[0].Profile.Model != "opus" {
+		t.Errorf("queued task = %+v, want it to keep the opus model", queue)
+	}
+}
+
+func TestPermissionProfiles(t *testing.T) {
+	d, cleanup := setupTestDaemonWithState(t, func(s *state.State) {
+		s.AddRepo("test-repo", &state.Repository{
+			GithubURL:   "https://github.com/test/repo",
+			TmuxSession: "test-session",
+			Agents:      make(map[string]state.Agent),
+		})
+	})
+	defer cleanup()
+
+	updateProfiles := func(profiles map[string]interface{}) socket.Response {
+		return d.handleRequest(socket.Request{Command: "update_repo_config", Args: map[string]interface{}{
+			"name":                "test-repo",
+			"permission_profiles": profiles,
+		}})
+	}
+	if resp := updateProfiles(map[string]interface{}{"worker": "root"}); resp.Success {
+		t.Error("update_repo_config should refuse an unknown permission profile")
+	}
+	if resp := updateProfiles(map[string]interface{}{"robot": "worker"}); resp.Success {
+		t.Error("update_repo_config should refuse an unknown agent type")
+	}
+	if resp := updateProfiles(map[string]interface{}{"worker": "worker", "supervisor": "supervisor-cli"}); !resp.Success {
+		t.Fatalf("update_repo_config failed: %s", resp.Error)
+	}
+
+	resp := d.handleRequest(socket.Request{Command: "get_repo_config", Args: map[string]interface{}{"name": "test-repo"}})
+	if !resp.Success {
+		t.Fatalf("get_repo_config failed: %s", resp.Error)
+	}
+	selected := resp.Data.(map[string]interface{})["permission_profiles"].(map[string]string)
+	if selected["worker"] != "worker" || selected["supervisor"] != "supervisor-cli" || len(selected) != 2 {
+		t.Errorf("permission_profiles = %v", selected)
+	}
+
+	// Workers get the rules in their worktree and keep a stricter mode of their own
+	worktree := t.TempDir()
+	profile, err := d.launchProfile("test-repo", "fox", state.AgentTypeWorker, worktree, state.AgentProfile{Model: "opus"})
+	if err != nil {
+		t.Fatalf("launchProfile(worker) failed: %v", err)
+	}
+	if profile.PermissionMode != "acceptEdits" || profile.Model != "opus" || len(profile.ExtraArgs) != 0 {
+		t.Errorf("worker launch profile = %+v", profile)
+	}
+	if _, err := os.Stat(filepath.Join(worktree, ".claude", "settings.json")); err != nil {
+		t.Errorf("worker settings not written: %v", err)
+	}
+
+	// The supervisor shares the repository checkout, so its rules are passed with --settings
+	profile, err = d.launchProfile("test-repo", "supervisor", state.AgentTypeSupervisor, d.paths.RepoDir("test-repo"), state.AgentProfile{})
+	if err != nil {
+		t.Fatalf("launchProfile(supervisor) failed: %v", err)
+	}
+	settingsFile := d.paths.AgentSettingsFile("test-repo", "supervisor")
+	if profile.PermissionMode != "default" || strings.Join(profile.ExtraArgs, " ") != "--settings "+settingsFile {
+		t.Errorf("supervisor launch profile = %+v", profile)
+	}
+	if _, err := os.Stat(settingsFile); err != nil {
+		t.Errorf("supervisor settings not written: %v", err)
+	}
+
+	// Clearing the selection runs the type unrestricted again
+	if resp := updateProfiles(map[string]interface{}{"worker": ""}); !resp.Success {
+		t.Fatalf("update_repo_config failed: %s", resp.Error)
+	}
+	profile, err = d.launchProfile("test-repo", "owl", state.AgentTypeWorker, t.TempDir(), state.AgentProfile{})
+	if err != nil || profile.PermissionMode != "" {
+		t.Errorf("unrestricted launch profile = %+v, %v", profile, err)
+	}
+}
@@ -0,0 +1,197 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dlorenc/multiclaude/internal/agents"
+	"github.com/dlorenc/multiclaude/internal/state"
+	"github.com/dlorenc/multiclaude/pkg/claude"
+)
+
+// headlessSummaryLimit is how much of a headless run's final message is kept
+// as the agent's summary
+const headlessSummaryLimit = 500
+
+// headlessRun is the run of a headless agent this daemon started
+type headlessRun struct {
+	session *claude.HeadlessSession
+	log     *os.File // The agent's output log, receiving the run's stream-json
+}
+
+// runsHeadless reports whether agents of the definition run headless. Only
+// workers and reviews can, since they work through one task and exit; an
+// unknown runner falls back to tmux.
+func (d *Daemon) runsHeadless(repoName string, agentType state.AgentType, def agents.Definition) bool {
+	switch def.Runner {
+	case "", agents.RunnerTmux:
+		return false
+	case agents.RunnerHeadless:
+		if agentType == state.AgentTypeWorker || agentType == state.AgentTypeReview {
+			return true
+		}
+		d.logger.Warn("Agent definition %s in %s asks for the headless runner, which only workers and reviews support; using tmux", def.Name, repoName)
+		return false
+	default:
+		d.logger.Warn("Agent definition %s in %s has unknown runner %q; using tmux", def.Name, repoName, def.Runner)
+		return false
+	}
+}
+
+// startHeadless starts Claude for an agent as a headless run, working on the
+// agent's initial message and appending its stream-json output to the agent's
+// log. Like launchClaude it returns the session ID and PID; the run is tracked
+// until watchHeadless or stopHeadless is done with it.
+func (d *Daemon) startHeadless(repoName string, cfg agentStartConfig) (string, int, error) {
+	if cfg.initialMessage == "" {
+		return "", 0, fmt.Errorf("headless agent %s needs a task", cfg.agentName)
+	}
+	if err := claude.Profile(cfg.profile).Validate(); err != nil {
+		return "", 0, fmt.Errorf("invalid profile for %s: %w", cfg.agentName, err)
+	}
+
+	sessionID, err := claude.GenerateSessionID()
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to generate session ID: %w", err)
+	}
+
+	// Render the permission profile of the agent's type next to the hooks
+	profile, err := d.launchProfile(repoName, cfg.agentName, cfg.agentType, cfg.workDir, cfg.profile)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// Skip actual Claude startup in test mode
+	if os.Getenv("MULTICLAUDE_TEST_MODE") == "1" {
+		return sessionID, 0, nil
+	}
+
+	logFile := d.paths.AgentLogFile(repoName, cfg.agentName, true)
+	if err := os.MkdirAll(filepath.Dir(logFile), 0755); err != nil {
+		return "", 0, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	log, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to open output log: %w", err)
+	}
+
+	session, err := d.headlessRunner.Start(d.ctx, claude.HeadlessConfig{
+		SessionID:        sessionID,
+		WorkDir:          cfg.workDir,
+		SystemPromptFile: cfg.promptFile,
+		Prompt:           cfg.initialMessage,
+		Profile:          profile,
+		Output:           log,
+	})
+	if err != nil {
+		log.Close()
+		return "", 0, err
+	}
+
+	d.headlessMu.Lock()
+	if d.headlessRuns == nil {
+		d.headlessRuns = make(map[string]*headlessRun)
+	}
+	d.headlessRuns[repoName+"/"+cfg.agentName] = &headlessRun{session: session, log: log}
+	d.headlessMu.Unlock()
+
+	return sessionID, session.PID, nil
+}
+
+// headlessRunning reports whether this daemon is running the agent's headless run
+func (d *Daemon) headlessRunning(repoName, agentName string) bool {
+	d.headlessMu.Lock()
+	defer d.headlessMu.Unlock()
+	_, running := d.headlessRuns[repoName+"/"+agentName]
+	return running
+}
+
+// releaseHeadless stops tracking the agent's run and returns it, or nil if it
+// was already released. Whoever releases the run closes its log.
+func (d *Daemon) releaseHeadless(repoName, agentName string) *headlessRun {
+	key := repoName + "/" + agentName
+	d.headlessMu.Lock()
+	defer d.headlessMu.Unlock()
+
+	run := d.headlessRuns[key]
+	delete(d.headlessRuns, key)
+	return run
+}
+
+// stopHeadless stops the agent's headless run, if this daemon is running one,
+// before the agent is removed
+func (d *Daemon) stopHeadless(repoName, agentName string) {
+	run := d.releaseHeadless(repoName, agentName)
+	if run == nil {
+		return
+	}
+	d.logger.Info("Stopping headless run of %s/%s", repoName, agentName)
+	run.session.Stop()
+	run.log.Close()
+}
+
+// watchHeadless waits for a registered headless agent's run to end and
+// completes the agent with its outcome: the final message as the summary, or
+// why the run failed. An agent that completed itself or was removed is left
+// alone, and so is a run cut short by the daemon stopping, which the health
+// check reports on the next start.
+func (d *Daemon) watchHeadless(repoName, agentName string) {
+	defer d.wg.Done()
+
+	d.headlessMu.Lock()
+	run, exists := d.headlessRuns[repoName+"/"+agentName]
+	d.headlessMu.Unlock()
+	if !exists {
+		return
+	}
+
+	result, err := run.session.Wait()
+	if d.releaseHeadless(repoName, agentName) != nil {
+		run.log.Close()
+	}
+	if d.ctx.Err() != nil {
+		return
+	}
+
+	var summary, failureReason string
+	if err != nil {
+		d.logger.Warn("Headless run of %s/%s failed: %v", repoName, agentName, err)
+		failureReason = fmt.Sprintf("headless run failed: %v", err)
+	} else {
+		d.logger.Info("Headless run of %s/%s finished (turns=%d, cost=$%.2f)", repoName, agentName, result.NumTurns, result.CostUSD)
+		summary = result.Result
+		if runes := []rune(summary); len(runes) > headlessSummaryLimit {
+			summary = string(runes[:headlessSummaryLimit]) + "..."
+		}
+	}
+
+	agent, exists := d.state.GetAgent(repoName, agentName)
+	if !exists || agent.ReadyForCleanup {
+		return
+	}
+	if err := d.completeAgent(repoName, agentName, agent, summary, failureReason); err != nil {
+		d.logger.Error("Failed to complete headless agent %s/%s: %v", repoName, agentName, err)
+	}
+}
+
+// checkHeadlessAgent is the health check of a headless agent. Its run is
+// watched while this daemon runs it; a run the daemon lost track of, because
+// the daemon stopped while it ran, can't be resumed and fails the agent's task.
+// A lost run that is still going is killed first, so it stops working in the
+// worktree the agent's cleanup removes.
+func (d *Daemon) checkHeadlessAgent(repoName, agentName string, agent state.Agent) {
+	if agent.PID <= 0 || d.headlessRunning(repoName, agentName) {
+		return
+	}
+
+	d.logger.Warn("Lost headless run of %s/%s (PID %d) to a daemon restart", repoName, agentName, agent.PID)
+	if isProcessAlive(agent.PID) {
+		if err := claude.KillRun(agent.PID); err != nil {
+			d.logger.Warn("Failed to kill lost headless run of %s/%s (PID %d): %v", repoName, agentName, agent.PID, err)
+		}
+	}
+	if err := d.completeAgent(repoName, agentName, agent, "", "headless run was interrupted by a daemon restart"); err != nil {
+		d.logger.Error("Failed to complete headless agent %s/%s: %v", repoName, agentName, err)
+	}
+}
@@ -0,0 +1,152 @@
+package daemon
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dlorenc/multiclaude/internal/state"
+	"github.com/dlorenc/multiclaude/pkg/claude"
+)
+
+// fakeHeadlessClaude writes a script standing in for `claude -p` that runs body
+func fakeHeadlessClaude(t *testing.T, body string) string {
+	t.Helper()
+	binary := filepath.Join(t.TempDir(), "claude")
+	if err := os.WriteFile(binary, []byte("#!/bin/sh\ncat > /dev/null\n"+body+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return binary
+}
+
+func TestSpawnHeadlessWorker(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantSummary string
+		wantFailure string
+	}{
+		{
+			name:        "run succeeds",
+			body:        `echo '{"type":"result","subtype":"success","is_error":false,"session_id":"abc","result":"Opened PR #7","num_turns":4}'`,
+			wantSummary: "Opened PR #7",
+		},
+		{
+			name:        "run fails",
+			body:        "echo 'Error: invalid API key' >&2; exit 2",
+			wantFailure: "headless run failed: claude exited with status 2: Error: invalid API key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, cleanup := setupSpawnTest(t, "mc-test-spawn-headless")
+			defer cleanup()
+			d.headlessRunner.BinaryPath = fakeHeadlessClaude(t, tt.body)
+
+			agent, err := d.spawnAgent(spawnSpec{
+				repo:           "test-repo",
+				name:           "clever-fox",
+				agentType:      state.AgentTypeWorker,
+				branch:         "work/clever-fox",
+				startPoint:     "HEAD",
+				prompt:         "You are a worker.",
+				initialMessage: "Task: fix the bug",
+				task:           "fix the bug",
+				headless:       true,
+			})
+			if err != nil {
+				t.Fatalf("spawnAgent() failed: %v", err)
+			}
+			if !agent.Headless || agent.TmuxWindow != "" || agent.PID <= 0 {
+				t.Errorf("agent = %+v, want a headless run without a window", agent)
+			}
+			if exists, _ := d.tmux.HasWindow(context.Background(), "mc-test-spawn-headless", "clever-fox"); exists {
+				t.Error("a headless agent should not get a tmux window")
+			}
+
+			// The run ends, the agent completes, and the health check cleans it up
+			var entry *state.TaskHistoryEntry
+			for deadline := time.Now().Add(10 * time.Second); entry == nil && time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+				history, _ := d.state.GetTaskHistory("test-repo", 0)
+				for i := range history {
+					if history[i].Name == "clever-fox" {
+						entry = &history[i]
+					}
+				}
+			}
+			if entry == nil {
+				t.Fatal("headless worker should complete and be recorded in the task history")
+			}
+			if entry.Summary != tt.wantSummary || entry.FailureReason != tt.wantFailure {
+				t.Errorf("history entry summary = %q, failure = %q; want %q, %q", entry.Summary, entry.FailureReason, tt.wantSummary, tt.wantFailure)
+			}
+			if d.headlessRunning("test-repo", "clever-fox") {
+				t.Error("the finished run should no longer be tracked")
+			}
+
+			if tt.wantSummary != "" {
+				output, _ := os.ReadFile(d.paths.AgentLogFile("test-repo", "clever-fox", true))
+				if !strings.Contains(string(output), `"result":"Opened PR #7"`) {
+					t.Errorf("output log = %q, want the run's stream", output)
+				}
+			}
+		})
+	}
+}
+
+func TestHeadlessRunLostToRestart(t *testing.T) {
+	t.Setenv("MULTICLAUDE_TEST_MODE", "1")
+	d, cleanup := setupSpawnTest(t, "mc-test-headless-lost")
+	defer cleanup()
+
+	// A headless worker whose run, still going with a tool it started, was
+	// started by an earlier daemon
+	d.headlessRunner.BinaryPath = fakeHeadlessClaude(t, "sleep 30 &\n"+`echo '{"type":"system","subtype":"init","session_id":"abc"}'`+"\nwait")
+	started := make(chan struct{})
+	run, err := d.headlessRunner.Start(context.Background(), claude.HeadlessConfig{
+		Prompt:  "fix the bug",
+		OnEvent: func(claude.Event) { close(started) },
+	})
+	if err != nil {
+		t.Fatalf("Start() failed: %v", err)
+	}
+	defer run.Stop()
+	<-started
+	agent := state.Agent{
+		Type:         state.AgentTypeWorker,
+		WorktreePath: t.TempDir(),
+		Headless:     true,
+		PID:          run.PID,
+		Task:         "fix the bug",
+		CreatedAt:    time.Now(),
+	}
+	if err := d.state.AddAgent("test-repo", "clever-fox", agent); err != nil {
+		t.Fatal(err)
+	}
+	if canResumeWorker(agent) {
+		t.Error("headless workers should not be resumed in tmux")
+	}
+
+	// The lost run is killed, the worker fails, and the health check it
+	// triggers cleans it up
+	d.checkHeadlessAgent("test-repo", "clever-fox", agent)
+	select {
+	case <-run.Done():
+	case <-time.After(5 * time.Second):
+		t.Error("the lost run and its tools should be killed")
+	}
+	var entry *state.TaskHistoryEntry
+	for deadline := time.Now().Add(10 * time.Second); entry == nil && time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		history, _ := d.state.GetTaskHistory("test-repo", 0)
+		if len(history) > 0 {
+			entry = &history[0]
+		}
+	}
+	if entry == nil || entry.Status != state.TaskStatusFailed || !strings.Contains(entry.FailureReason, "daemon restart") {
+		t.Errorf("history entry = %+v, want the task failed by the lost run", entry)
+	}
+}
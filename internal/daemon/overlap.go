@@ -0,0 +1,186 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dlorenc/multiclaude/internal/state"
+	"github.com/dlorenc/multiclaude/internal/worktree"
+)
+
+// overlapCheckInterval is how often worker branches are compared with each other
+const overlapCheckInterval = 10 * time.Minute
+
+// workerOverlap is a pair of workers whose branches change the same files
+type workerOverlap struct {
+	workers   [2]string // Worker names, sorted
+	files     []string  // Files both branches change
+	conflicts []string  // Files where the changed lines touch, likely to conflict
+}
+
+// overlapLoop periodically looks for workers changing the same files
+func (d *Daemon) overlapLoop() {
+	d.periodicLoop("overlap", overlapCheckInterval, d.checkOverlaps, d.checkOverlaps)
+}
+
+// TriggerOverlapCheck triggers an immediate overlap check (for testing)
+func (d *Daemon) TriggerOverlapCheck() {
+	d.checkOverlaps()
+}
+
+// checkOverlaps diffs every active worker branch against main and records
+// which pairs of workers change the same files. The supervisor is told about
+// pairs whose changes are likely to conflict, once per set of files, so it
+// can redirect or stop one of them before both open PRs.
+func (d *Daemon) checkOverlaps() {
+	d.logger.Debug("Checking for overlapping workers")
+
+	found := make(map[string][]workerOverlap)
+	for repoName, repo := range d.state.GetAllRepos() {
+		overlaps := d.repoOverlaps(repoName, repo)
+		if len(overlaps) > 0 {
+			found[repoName] = overlaps
+		}
+	}
+
+	d.overlapMu.Lock()
+	d.overlaps = found
+	notify := make(map[string][]workerOverlap)
+	seen := make(map[string]bool)
+	for repoName, overlaps := range found {
+		for _, overlap := range overlaps {
+			if len(overlap.conflicts) == 0 {
+				continue
+			}
+			key := repoName + "/" + overlap.workers[0] + "/" + overlap.workers[1]
+			seen[key] = true
+			notice := strings.Join(overlap.conflicts, "\x00")
+			if d.overlapNotices[key] == notice {
+				continue
+			}
+			d.overlapNotices[key] = notice
+			notify[repoName] = append(notify[repoName], overlap)
+		}
+	}
+	// Pairs that stopped conflicting are reported again if they start over
+	for key := range d.overlapNotices {
+		if !seen[key] {
+			delete(d.overlapNotices, key)
+		}
+	}
+	d.overlapMu.Unlock()
+
+	if len(notify) == 0 {
+		return
+	}
+	msgMgr := d.getMessageManager()
+	for repoName, overlaps := range notify {
+		for _, overlap := range overlaps {
+			d.logger.Warn("Workers %s and %s in %s are likely to conflict in: %v", overlap.workers[0], overlap.workers[1], repoName, overlap.conflicts)
+			if _, err := msgMgr.Send(repoName, "daemon", "supervisor", overlapMessage(overlap)); err != nil {
+				d.logger.Warn("Failed to notify supervisor about overlapping workers in %s: %v", repoName, err)
+			}
+		}
+	}
+	d.requestMessageRouting()
+}
+
+// repoOverlaps compares the changes of every pair of active workers in a
+// repository
+func (d *Daemon) repoOverlaps(repoName string, repo *state.Repository) []workerOverlap {
+	var names []string
+	for agentName, agent := range repo.Agents {
+		if agent.Type == state.AgentTypeWorker && !agent.ReadyForCleanup && agent.WorktreePath != "" {
+			names = append(names, agentName)
+		}
+	}
+	if len(names) < 2 {
+		return nil
+	}
+	sort.Strings(names)
+
+	repoPath := d.paths.RepoDir(repoName)
+	if _, err := os.Stat(repoPath); err != nil {
+		return nil
+	}
+	wt := worktree.NewManager(repoPath)
+	remote, err := wt.GetUpstreamRemote()
+	if err != nil {
+		d.logger.Debug("Could not get remote for %s: %v", repoName, err)
+		return nil
+	}
+	mainBranch, err := wt.GetDefaultBranch(remote)
+	if err != nil {
+		d.logger.Debug("Could not get default branch for %s: %v", repoName, err)
+		return nil
+	}
+
+	changes := make(map[string]map[string][]worktree.Hunk, len(names))
+	for _, name := range names {
+		hunks, err := worktree.ChangedHunks(repo.Agents[name].WorktreePath, remote+"/"+mainBranch)
+		if err != nil {
+			d.logger.Debug("Could not diff worktree of %s/%s: %v", repoName, name, err)
+			continue
+		}
+		changes[name] = hunks
+	}
+
+	var overlaps []workerOverlap
+	for i, a := range names {
+		for _, b := range names[i+1:] {
+			if changes[a] == nil || changes[b] == nil {
+				continue
+			}
+			overlap := workerOverlap{workers: [2]string{a, b}}
+			for file, hunksA := range changes[a] {
+				hunksB, ok := changes[b][file]
+				if !ok {
+					continue
+				}
+				overlap.files = append(overlap.files, file)
+				if worktree.HunksOverlap(hunksA, hunksB) {
+					overlap.conflicts = append(overlap.conflicts, file)
+				}
+			}
+			if len(overlap.files) > 0 {
+				sort.Strings(overlap.files)
+				sort.Strings(overlap.conflicts)
+				overlaps = append(overlaps, overlap)
+			}
+		}
+	}
+	return overlaps
+}
+
+// repoOverlapsFound returns the overlaps found in a repository at the last check
+func (d *Daemon) repoOverlapsFound(repoName string) []workerOverlap {
+	d.overlapMu.Lock()
+	defer d.overlapMu.Unlock()
+	return d.overlaps[repoName]
+}
+
+// overlapDetails converts overlaps for a socket response
+func overlapDetails(overlaps []workerOverlap) []map[string]interface{} {
+	details := make([]map[string]interface{}, 0, len(overlaps))
+	for _, overlap := range overlaps {
+		details = append(details, map[string]interface{}{
+			"workers":   overlap.workers[:],
+			"files":     overlap.files,
+			"conflicts": overlap.conflicts,
+		})
+	}
+	return details
+}
+
+// overlapMessage tells the supervisor two workers are likely to conflict
+func overlapMessage(overlap workerOverlap) string {
+	msg := fmt.Sprintf("Workers '%s' and '%s' are changing the same lines in %s, so their PRs will likely conflict.",
+		overlap.workers[0], overlap.workers[1], describeFiles(overlap.conflicts))
+	if others := len(overlap.files) - len(overlap.conflicts); others > 0 {
+		msg += fmt.Sprintf(" They also both touch %d other file(s).", others)
+	}
+	return msg + " Consider redirecting or stopping one of them before both open PRs."
+}
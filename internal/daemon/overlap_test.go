@@ -0,0 +1,110 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dlorenc/multiclaude/internal/state"
+)
+
+// addOverlappingWorkers creates workers whose branches edit lines.txt: fox and
+// owl change the same line, bee changes one far below it
+func addOverlappingWorkers(t *testing.T, d *Daemon, repoDir string) {
+	t.Helper()
+
+	var lines []string
+	for i := 1; i <= 20; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "lines.txt"), []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, repoDir, "add", "lines.txt")
+	runGit(t, repoDir, "commit", "-m", "Add lines")
+	runGit(t, repoDir, "remote", "add", "origin", repoDir)
+	runGit(t, repoDir, "fetch", "origin")
+
+	agents := map[string]state.Agent{
+		"supervisor": {Type: state.AgentTypeSupervisor, TmuxWindow: "supervisor", CreatedAt: time.Now()},
+	}
+	for name, line := range map[string]int{"fox": 2, "owl": 2, "bee": 15} {
+		wtPath := filepath.Join(d.paths.WorktreeDir("test-repo"), name)
+		runGit(t, repoDir, "worktree", "add", "-b", "work/"+name, wtPath, "main")
+
+		changed := append([]string(nil), lines...)
+		changed[line-1] = "changed by " + name
+		if err := os.WriteFile(filepath.Join(wtPath, "lines.txt"), []byte(strings.Join(changed, "\n")+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		runGit(t, wtPath, "commit", "-am", "Edit lines")
+
+		agents[name] = state.Agent{Type: state.AgentTypeWorker, WorktreePath: wtPath, TmuxWindow: name, Task: "Edit lines", CreatedAt: time.Now()}
+	}
+
+	repo := &state.Repository{
+		GithubURL:   "https://github.com/test/repo",
+		TmuxSession: "test-session",
+		Agents:      agents,
+	}
+	if err := d.state.AddRepo("test-repo", repo); err != nil {
+		t.Fatalf("Failed to add repo: %v", err)
+	}
+}
+
+func TestCheckOverlaps(t *testing.T) {
+	d, repoDir, cleanup := setupTestDaemonWithGitRepo(t)
+	defer cleanup()
+	addOverlappingWorkers(t, d, repoDir)
+
+	d.TriggerOverlapCheck()
+
+	overlaps := d.repoOverlapsFound("test-repo")
+	if len(overlaps) != 3 {
+		t.Fatalf("found %d overlaps, want 3: %+v", len(overlaps), overlaps)
+	}
+	conflicting := 0
+	for _, overlap := range overlaps {
+		if len(overlap.files) != 1 || overlap.files[0] != "lines.txt" {
+			t.Errorf("overlap %v files = %v, want [lines.txt]", overlap.workers, overlap.files)
+		}
+		if len(overlap.conflicts) > 0 {
+			conflicting++
+			if overlap.workers != [2]string{"fox", "owl"} {
+				t.Errorf("workers %v should not conflict", overlap.workers)
+			}
+		}
+	}
+	if conflicting != 1 {
+		t.Errorf("found %d conflicting pairs, want 1", conflicting)
+	}
+
+	msgs, err := d.getMessageManager().List("test-repo", "supervisor")
+	if err != nil {
+		t.Fatalf("Failed to list messages: %v", err)
+	}
+	if len(msgs) != 1 || !strings.Contains(msgs[0].Body, "'fox' and 'owl'") {
+		t.Fatalf("supervisor messages = %+v, want one about fox and owl", msgs)
+	}
+
+	// The same conflict is not reported twice
+	d.TriggerOverlapCheck()
+	msgs, _ = d.getMessageManager().List("test-repo", "supervisor")
+	if len(msgs) != 1 {
+		t.Errorf("supervisor got %d messages after a second check, want 1", len(msgs))
+	}
+
+	// Finished workers are left out
+	owl, _ := d.state.GetAgent("test-repo", "owl")
+	owl.ReadyForCleanup = true
+	if err := d.state.UpdateAgent("test-repo", "owl", owl); err != nil {
+		t.Fatalf("Failed to update agent: %v", err)
+	}
+	d.TriggerOverlapCheck()
+	if overlaps := d.repoOverlapsFound("test-repo"); len(overlaps) != 1 || len(overlaps[0].conflicts) != 0 {
+		t.Errorf("overlaps after owl finished = %+v, want only fox and bee", overlaps)
+	}
+}
@@ -0,0 +1,322 @@
+package daemon
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dlorenc/multiclaude/internal/socket"
+	"github.com/dlorenc/multiclaude/internal/state"
+	"github.com/dlorenc/multiclaude/pkg/tmux"
+)
+
+func addPendingTestRepo(t *testing.T, d *Daemon, tmuxSession string) {
+	t.Helper()
+
+	repo := &state.Repository{
+		GithubURL:   "https://github.com/test/repo",
+		TmuxSession: tmuxSession,
+		Agents:      make(map[string]state.Agent),
+	}
+	if err := d.state.AddRepo("test-repo", repo); err != nil {
+		t.Fatalf("Failed to add repo: %v", err)
+	}
+}
+
+func TestHandleAddPendingTask(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        map[string]interface{}
+		wantSuccess bool
+		wantError   string
+	}{
+		{
+			name:      "missing after",
+			args:      map[string]interface{}{"repo": "test-repo", "name": "child", "task": "Do it"},
+			wantError: "at least one dependency",
+		},
+		{
+			name:      "unknown worker dependency",
+			args:      map[string]interface{}{"repo": "test-repo", "name": "child", "task": "Do it", "after": "nobody"},
+			wantError: "unknown dependency",
+		},
+		{
+			name:      "self dependency",
+			args:      map[string]interface{}{"repo": "test-repo", "name": "child", "task": "Do it", "after": "child"},
+			wantError: "cannot depend on itself",
+		},
+		{
+			name:      "name taken by active agent",
+			args:      map[string]interface{}{"repo": "test-repo", "name": "parent", "task": "Do it", "after": "#12"},
+			wantError: "already exists",
+		},
+		{
+			name:        "worker and PR dependencies as string",
+			args:        map[string]interface{}{"repo": "test-repo", "name": "child", "task": "Do it", "after": "parent, #12"},
+			wantSuccess: true,
+		},
+		{
+			name:        "dependencies as list",
+			args:        map[string]interface{}{"repo": "test-repo", "name": "child", "task": "Do it", "after": []interface{}{"old-worker"}},
+			wantSuccess: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, cleanup := setupTestDaemon(t)
+			defer cleanup()
+
+			addPendingTestRepo(t, d, "mc-test-repo")
+			if err := d.state.AddAgent("test-repo", "parent", state.Agent{
+				Type:       state.AgentTypeWorker,
+				TmuxWindow: "parent",
+				CreatedAt:  time.Now(),
+			}); err != nil {
+				t.Fatalf("Failed to add agent: %v", err)
+			}
+			if err := d.state.AddTaskHistory("test-repo", state.TaskHistoryEntry{
+				Name:   "old-worker",
+				Status: state.TaskStatusOpen,
+			}); err != nil {
+				t.Fatalf("Failed to add history: %v", err)
+			}
+
+			resp := d.handleRequest(socket.Request{Command: "add_pending_task", Args: tt.args})
+			if resp.Success != tt.wantSuccess {
+				t.Fatalf("add_pending_task success = %v, want %v (error: %s)", resp.Success, tt.wantSuccess, resp.Error)
+			}
+			if tt.wantError != "" && !strings.Contains(resp.Error, tt.wantError) {
+				t.Errorf("add_pending_task error = %q, want it to contain %q", resp.Error, tt.wantError)
+			}
+			if !tt.wantSuccess {
+				return
+			}
+
+			tasks, err := d.state.GetPendingTasks("test-repo")
+			if err != nil {
+				t.Fatalf("GetPendingTasks() failed: %v", err)
+			}
+			if len(tasks) != 1 || tasks[0].Name != "child" {
+				t.Fatalf("pending tasks = %+v, want one task named child", tasks)
+			}
+		})
+	}
+}
+
+func TestHandleListAndRemovePendingTasks(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	addPendingTestRepo(t, d, "mc-test-repo")
+	if err := d.state.AddTaskHistory("test-repo", state.TaskHistoryEntry{
+		Name:     "parent",
+		Status:   state.TaskStatusMerged,
+		PRNumber: 7,
+	}); err != nil {
+		t.Fatalf("Failed to add history: %v", err)
+	}
+	if err := d.state.AddPendingTask("test-repo", state.PendingTask{
+		Name:      "child",
+		Task:      "Build on parent",
+		DependsOn: []string{"parent", "#99"},
+		CreatedAt: time.Now(),
+	}); err != nil {
+		t.Fatalf("Failed to add pending task: %v", err)
+	}
+
+	resp := d.handleRequest(socket.Request{
+		Command: "list_pending_tasks",
+		Args:    map[string]interface{}{"repo": "test-repo"},
+	})
+	if !resp.Success {
+		t.Fatalf("list_pending_tasks failed: %s", resp.Error)
+	}
+
+	tasks, ok := resp.Data.([]map[string]interface{})
+	if !ok || len(tasks) != 1 {
+		t.Fatalf("list_pending_tasks data = %#v, want one task", resp.Data)
+	}
+	if tasks[0]["state"] != "waiting" {
+		t.Errorf("task state = %v, want waiting", tasks[0]["state"])
+	}
+	deps, _ := tasks[0]["depends_on"].([]map[string]interface{})
+	if len(deps) != 2 {
+		t.Fatalf("depends_on = %#v, want 2 entries", tasks[0]["depends_on"])
+	}
+	if deps[0]["state"] != "merged" || deps[1]["state"] != "waiting" {
+		t.Errorf("dependency states = %v/%v, want merged/waiting", deps[0]["state"], deps[1]["state"])
+	}
+
+	resp = d.handleRequest(socket.Request{
+		Command: "remove_pending_task",
+		Args:    map[string]interface{}{"repo": "test-repo", "name": "child"},
+	})
+	if !resp.Success {
+		t.Fatalf("remove_pending_task failed: %s", resp.Error)
+	}
+
+	resp = d.handleRequest(socket.Request{
+		Command: "remove_pending_task",
+		Args:    map[string]interface{}{"repo": "test-repo", "name": "child"},
+	})
+	if resp.Success {
+		t.Error("remove_pending_task should fail for a task that no longer exists")
+	}
+}
+
+func TestResolvePendingTasksBlocksOnClosedDependency(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	addPendingTestRepo(t, d, "mc-test-repo")
+	if err := d.state.AddTaskHistory("test-repo", state.TaskHistoryEntry{
+		Name:   "parent",
+		Status: state.TaskStatusClosed,
+	}); err != nil {
+		t.Fatalf("Failed to add history: %v", err)
+	}
+	if err := d.state.AddPendingTask("test-repo", state.PendingTask{
+		Name:      "child",
+		Task:      "Build on parent",
+		DependsOn: []string{"parent"},
+		CreatedAt: time.Now(),
+	}); err != nil {
+		t.Fatalf("Failed to add pending task: %v", err)
+	}
+
+	d.TriggerPendingTasks()
+
+	tasks, err := d.state.GetPendingTasks("test-repo")
+	if err != nil {
+		t.Fatalf("GetPendingTasks() failed: %v", err)
+	}
+	if len(tasks) != 1 {
+		t.Fatalf("blocked task should stay pending, got %d tasks", len(tasks))
+	}
+	if !strings.Contains(tasks[0].BlockedReason, "parent") {
+		t.Errorf("BlockedReason = %q, want it to mention parent", tasks[0].BlockedReason)
+	}
+
+	msgs, err := d.getMessageManager().List("test-repo", "supervisor")
+	if err != nil {
+		t.Fatalf("Failed to list messages: %v", err)
+	}
+	if len(msgs) != 1 {
+		t.Errorf("supervisor should be notified once, got %d messages", len(msgs))
+	}
+
+	// A second pass must not notify again
+	d.TriggerPendingTasks()
+	msgs, _ = d.getMessageManager().List("test-repo", "supervisor")
+	if len(msgs) != 1 {
+		t.Errorf("supervisor should still have 1 message, got %d", len(msgs))
+	}
+}
+
+func TestResolvePendingTasksSpawnsWhenDependenciesMerge(t *testing.T) {
+	tmuxClient := tmux.NewClient()
+	if !tmuxClient.IsTmuxAvailable() {
+		t.Fatal("tmux is required for this test but not available")
+	}
+
+	t.Setenv("MULTICLAUDE_TEST_MODE", "1")
+
+	d, _, cleanup := setupTestDaemonWithGitRepo(t)
+	defer cleanup()
+
+	sessionName := "mc-test-pending"
+	if err := tmuxClient.CreateSession(context.Background(), sessionName, true); err != nil {
+		t.Fatalf("tmux is required for this test but cannot create sessions in this environment: %v", err)
+	}
+	defer tmuxClient.KillSession(context.Background(), sessionName)
+
+	addPendingTestRepo(t, d, sessionName)
+	if err := d.state.AddTaskHistory("test-repo", state.TaskHistoryEntry{
+		Name:     "parent",
+		Status:   state.TaskStatusMerged,
+		PRNumber: 7,
+	}); err != nil {
+		t.Fatalf("Failed to add history: %v", err)
+	}
+	if err := d.state.AddPendingTask("test-repo", state.PendingTask{
+		Name:      "child",
+		Task:      "Build on parent",
+		DependsOn: []string{"parent"},
+		CreatedAt: time.Now(),
+	}); err != nil {
+		t.Fatalf("Failed to add pending task: %v", err)
+	}
+
+	d.TriggerPendingTasks()
+
+	tasks, _ := d.state.GetPendingTasks("test-repo")
+	if len(tasks) != 0 {
+		t.Errorf("pending task should be removed after spawning, got %+v", tasks)
+	}
+
+	agent, exists := d.state.GetAgent("test-repo", "child")
+	if !exists {
+		t.Fatal("worker should be registered after its dependencies merged")
+	}
+	if agent.Type != state.AgentTypeWorker {
+		t.Errorf("agent type = %s, want worker", agent.Type)
+	}
+	if agent.Task != "Build on parent" {
+		t.Errorf("agent task = %q, want %q", agent.Task, "Build on parent")
+	}
+	if len(agent.DependsOn) != 1 || agent.DependsOn[0] != "parent" {
+		t.Errorf("agent DependsOn = %v, want [parent]", agent.DependsOn)
+	}
+	if _, err := os.Stat(agent.WorktreePath); err != nil {
+		t.Errorf("worker worktree should exist: %v", err)
+	}
+
+	hasWindow, err := tmuxClient.HasWindow(context.Background(), sessionName, "child")
+	if err != nil || !hasWindow {
+		t.Errorf("worker tmux window should exist (err: %v)", err)
+	}
+}
+
+func TestClaimPendingTaskSlotRechecksTask(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	addPendingTestRepo(t, d, "mc-test-repo")
+	if err := d.state.AddPendingTask("test-repo", state.PendingTask{
+		Name:      "child",
+		Task:      "Build on parent",
+		DependsOn: []string{"parent"},
+		CreatedAt: time.Now(),
+	}); err != nil {
+		t.Fatalf("Failed to add pending task: %v", err)
+	}
+
+	task, queued, err := d.claimPendingTaskSlot("test-repo", "child")
+	if err != nil || task == nil || queued || task.Task != "Build on parent" {
+		t.Fatalf("claimPendingTaskSlot() = %+v, %v, %v; want the task with a reserved slot", task, queued, err)
+	}
+
+	// A second dispatch that checked the task before the first claimed it
+	task, _, err = d.claimPendingTaskSlot("test-repo", "child")
+	if err != nil || task != nil {
+		t.Errorf("claimPendingTaskSlot() of a claimed task = %+v, %v; want nil", task, err)
+	}
+
+	// A task removed while its dependencies were checked
+	d.releaseWorkerSlot("test-repo", "child")
+	if err := d.state.RemovePendingTask("test-repo", "child"); err != nil {
+		t.Fatalf("RemovePendingTask() failed: %v", err)
+	}
+	task, _, err = d.claimPendingTaskSlot("test-repo", "child")
+	if err != nil || task != nil {
+		t.Errorf("claimPendingTaskSlot() of a removed task = %+v, %v; want nil", task, err)
+	}
+	d.dispatchMu.Lock()
+	defer d.dispatchMu.Unlock()
+	if d.activeWorkerCountUnlocked("test-repo") != 0 {
+		t.Error("a removed task should not hold a worker slot")
+	}
+}
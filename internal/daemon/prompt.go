@@ -0,0 +1,61 @@
+package daemon
+
+import (
+	"github.com/dlorenc/multiclaude/internal/prompts"
+	"github.com/dlorenc/multiclaude/internal/socket"
+)
+
+// handleAgentPrompt returns the prompt an agent's session was started with,
+// the prompt it would get now from the repository's current definitions, and
+// the versions kept of its prompt. This is what 'multiclaude agent prompt'
+// shows and diffs.
+func (d *Daemon) handleAgentPrompt(req socket.Request) socket.Response {
+	repoName, errResp, ok := getRequiredStringArg(req.Args, "repo", "repository name is required")
+	if !ok {
+		return errResp
+	}
+
+	agentName, errResp, ok := getRequiredStringArg(req.Args, "agent", "agent name is required")
+	if !ok {
+		return errResp
+	}
+
+	agent, exists := d.state.GetAgent(repoName, agentName)
+	if !exists {
+		return socket.ErrorResponse("agent %q not found in repository %q", agentName, repoName)
+	}
+
+	// A query: the prompt is resolved, but only a restart saves and records it
+	promptFile, launched, err := d.resolveSessionPrompt(repoName, agentName, agent)
+	if err != nil {
+		return socket.ErrorResponse("failed to find prompt of %s: %v", agentName, err)
+	}
+
+	versions, err := d.promptStore.Versions(repoName, agentName)
+	if err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
+	versionList := make([]map[string]interface{}, 0, len(versions))
+	for _, v := range versions {
+		versionList = append(versionList, map[string]interface{}{
+			"version":  v.Number,
+			"path":     v.Path,
+			"saved_at": v.SavedAt,
+		})
+	}
+
+	result := map[string]interface{}{
+		"type":        string(agent.Type),
+		"prompt_file": promptFile,
+		"version":     prompts.VersionOf(promptFile),
+		"prompt":      launched,
+		"versions":    versionList,
+	}
+	if current, err := d.currentPrompt(repoName, agentName, agent); err == nil {
+		result["current"] = current
+		result["changed"] = current != launched
+	} else {
+		result["current_error"] = err.Error()
+	}
+	return socket.SuccessResponse(result)
+}
@@ -0,0 +1,252 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dlorenc/multiclaude/internal/socket"
+	"github.com/dlorenc/multiclaude/internal/state"
+)
+
+func TestPromptFilesNamespacedPerRepo(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	for _, repoName := range []string{"app", "docs"} {
+		if err := os.MkdirAll(d.paths.RepoDir(repoName), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	customPath := filepath.Join(d.paths.RepoDir("docs"), ".multiclaude", "SUPERVISOR.md")
+	if err := os.MkdirAll(filepath.Dir(customPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(customPath, []byte("Only touch the docs."), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	appPrompt, err := d.writePromptFile("app", state.AgentTypeSupervisor, "supervisor")
+	if err != nil {
+		t.Fatalf("writePromptFile() failed: %v", err)
+	}
+	docsPrompt, err := d.writePromptFile("docs", state.AgentTypeSupervisor, "supervisor")
+	if err != nil {
+		t.Fatalf("writePromptFile() failed: %v", err)
+	}
+
+	if appPrompt == docsPrompt {
+		t.Fatalf("both supervisors use %s", appPrompt)
+	}
+	content, _ := os.ReadFile(appPrompt)
+	if strings.Contains(string(content), "Only touch the docs.") {
+		t.Error("the docs supervisor's prompt overwrote the app supervisor's")
+	}
+}
+
+// addPromptWorker registers a worker launched with the current worker
+// definition of test-repo, which is set to definition first
+func addPromptWorker(t *testing.T, d *Daemon, definition string) string {
+	t.Helper()
+
+	if err := d.state.AddRepo("test-repo", &state.Repository{
+		GithubURL:   "https://github.com/test/repo",
+		TmuxSession: "mc-test-repo",
+		Agents:      make(map[string]state.Agent),
+	}); err != nil {
+		t.Fatalf("Failed to add repo: %v", err)
+	}
+	setWorkerDefinition(t, d, definition)
+
+	promptText, err := d.workerPrompt("test-repo", "")
+	if err != nil {
+		t.Fatalf("workerPrompt() failed: %v", err)
+	}
+	promptFile, err := d.savePromptFile("test-repo", "clever-fox", promptText)
+	if err != nil {
+		t.Fatalf("savePromptFile() failed: %v", err)
+	}
+	if err := d.state.AddAgent("test-repo", "clever-fox", state.Agent{
+		Type:         state.AgentTypeWorker,
+		WorktreePath: d.paths.AgentWorktree("test-repo", "clever-fox"),
+		TmuxWindow:   "clever-fox",
+		CreatedAt:    time.Now(),
+		PromptFile:   promptFile,
+	}); err != nil {
+		t.Fatalf("Failed to add agent: %v", err)
+	}
+	return promptFile
+}
+
+func setWorkerDefinition(t *testing.T, d *Daemon, definition string) {
+	t.Helper()
+	agentsDir := d.paths.RepoAgentsDir("test-repo")
+	if err := os.MkdirAll(agentsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(agentsDir, "worker.md"), []byte(definition), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionPromptFileKeepsLaunchedVersion(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	launched := addPromptWorker(t, d, "# Worker\n\nRun the tests before pushing.")
+
+	// A newer prompt is saved, e.g. by a worker of the same name in a later session
+	if _, err := d.savePromptFile("test-repo", "clever-fox", "something else"); err != nil {
+		t.Fatal(err)
+	}
+
+	agent, _ := d.state.GetAgent("test-repo", "clever-fox")
+	promptFile, err := d.sessionPromptFile("test-repo", "clever-fox", agent)
+	if err != nil || promptFile != launched {
+		t.Errorf("sessionPromptFile() = %q, %v, want the launched %s", promptFile, err, launched)
+	}
+
+	// Agents from before prompts were versioned get the latest version recorded
+	agent.PromptFile = ""
+	promptFile, err = d.sessionPromptFile("test-repo", "clever-fox", agent)
+	if err != nil || !strings.HasSuffix(promptFile, "v2.md") {
+		t.Errorf("sessionPromptFile() = %q, %v, want the latest version", promptFile, err)
+	}
+	if recorded, _ := d.state.GetAgent("test-repo", "clever-fox"); recorded.PromptFile != promptFile {
+		t.Errorf("recorded prompt file = %q, want %q", recorded.PromptFile, promptFile)
+	}
+}
+
+func TestResolveSessionPromptHasNoSideEffects(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	// An agent from before prompts were versioned, with no prompt saved
+	if err := d.state.AddRepo("test-repo", &state.Repository{Agents: make(map[string]state.Agent)}); err != nil {
+		t.Fatal(err)
+	}
+	agent := state.Agent{Type: state.AgentTypeSupervisor, CreatedAt: time.Now()}
+	if err := d.state.AddAgent("test-repo", "supervisor", agent); err != nil {
+		t.Fatal(err)
+	}
+
+	promptFile, promptText, err := d.resolveSessionPrompt("test-repo", "supervisor", agent)
+	if err != nil || promptFile != "" || promptText == "" {
+		t.Fatalf("resolveSessionPrompt() = %q, %d bytes, %v; want a regenerated prompt without a file", promptFile, len(promptText), err)
+	}
+	resp := d.handleRequest(socket.Request{
+		Command: "agent_prompt",
+		Args:    map[string]interface{}{"repo": "test-repo", "agent": "supervisor"},
+	})
+	if !resp.Success {
+		t.Fatalf("agent_prompt failed: %s", resp.Error)
+	}
+	if versions, _ := d.promptStore.Versions("test-repo", "supervisor"); len(versions) != 0 {
+		t.Errorf("querying the prompt saved %d version(s)", len(versions))
+	}
+	if recorded, _ := d.state.GetAgent("test-repo", "supervisor"); recorded.PromptFile != "" {
+		t.Errorf("querying the prompt recorded %q", recorded.PromptFile)
+	}
+
+	// Nor does querying a worker's prompt copy the agent templates
+	if err := d.state.AddAgent("test-repo", "clever-fox", state.Agent{Type: state.AgentTypeWorker, CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	resp = d.handleRequest(socket.Request{
+		Command: "agent_prompt",
+		Args:    map[string]interface{}{"repo": "test-repo", "agent": "clever-fox"},
+	})
+	if !resp.Success {
+		t.Fatalf("agent_prompt failed: %s", resp.Error)
+	}
+	if _, err := os.Stat(d.paths.RepoAgentsDir("test-repo")); !os.IsNotExist(err) {
+		t.Error("querying a worker's prompt copied the agent templates")
+	}
+
+	// A restart saves and records it
+	promptFile, err = d.sessionPromptFile("test-repo", "supervisor", agent)
+	if err != nil || !strings.HasSuffix(promptFile, "v1.md") {
+		t.Fatalf("sessionPromptFile() = %q, %v, want a saved v1", promptFile, err)
+	}
+	if recorded, _ := d.state.GetAgent("test-repo", "supervisor"); recorded.PromptFile != promptFile {
+		t.Errorf("recorded prompt file = %q, want %q", recorded.PromptFile, promptFile)
+	}
+}
+
+func TestHandleAgentPrompt(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	launched := addPromptWorker(t, d, "# Worker\n\nRun the tests before pushing.")
+
+	get := func() map[string]interface{} {
+		t.Helper()
+		resp := d.handleRequest(socket.Request{
+			Command: "agent_prompt",
+			Args:    map[string]interface{}{"repo": "test-repo", "agent": "clever-fox"},
+		})
+		if !resp.Success {
+			t.Fatalf("agent_prompt failed: %s", resp.Error)
+		}
+		return resp.Data.(map[string]interface{})
+	}
+
+	data := get()
+	if data["prompt_file"] != launched || data["version"] != 1 || data["changed"] != false {
+		t.Errorf("agent_prompt = %+v, want v1 unchanged", data)
+	}
+
+	setWorkerDefinition(t, d, "# Worker\n\nRun the linter before pushing.")
+	data = get()
+	if data["changed"] != true {
+		t.Fatalf("changed = %v, want true after the definition changed", data["changed"])
+	}
+	if !strings.Contains(data["prompt"].(string), "Run the tests") || !strings.Contains(data["current"].(string), "Run the linter") {
+		t.Error("prompt should be the launched one and current the regenerated one")
+	}
+
+	resp := d.handleRequest(socket.Request{
+		Command: "agent_prompt",
+		Args:    map[string]interface{}{"repo": "test-repo", "agent": "nobody"},
+	})
+	if resp.Success {
+		t.Error("agent_prompt should fail for an unknown agent")
+	}
+}
+
+func TestRemovingAgentsRemovesPrompts(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	addPromptWorker(t, d, "# Worker\n\nRun the tests before pushing.")
+	if _, err := d.savePromptFile("test-repo", "supervisor", "You are the supervisor."); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := d.handleRequest(socket.Request{
+		Command: "remove_agent",
+		Args:    map[string]interface{}{"repo": "test-repo", "agent": "clever-fox"},
+	})
+	if !resp.Success {
+		t.Fatalf("remove_agent failed: %s", resp.Error)
+	}
+	if versions, _ := d.promptStore.Versions("test-repo", "clever-fox"); len(versions) != 0 {
+		t.Errorf("removed agent still has %d prompt version(s)", len(versions))
+	}
+	if versions, _ := d.promptStore.Versions("test-repo", "supervisor"); len(versions) != 1 {
+		t.Errorf("supervisor has %d prompt version(s), want its own kept", len(versions))
+	}
+
+	resp = d.handleRequest(socket.Request{
+		Command: "remove_repo",
+		Args:    map[string]interface{}{"name": "test-repo"},
+	})
+	if !resp.Success {
+		t.Fatalf("remove_repo failed: %s", resp.Error)
+	}
+	if versions, _ := d.promptStore.Versions("test-repo", "supervisor"); len(versions) != 0 {
+		t.Errorf("removed repository still has %d prompt version(s)", len(versions))
+	}
+}
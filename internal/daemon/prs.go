@@ -0,0 +1,289 @@
+package daemon
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dlorenc/multiclaude/internal/events"
+	"github.com/dlorenc/multiclaude/internal/github"
+	"github.com/dlorenc/multiclaude/internal/socket"
+	"github.com/dlorenc/multiclaude/internal/state"
+	"github.com/dlorenc/multiclaude/internal/worktree"
+)
+
+const (
+	// prTrackingInterval is how often tracked branches are checked on GitHub
+	prTrackingInterval = 5 * time.Minute
+
+	// prListLimit is how many recent PRs are fetched per repo in one gh call.
+	// Tracked PRs older than that are looked up individually.
+	prListLimit = 100
+
+	// prTrackingWindow is how long finished tasks without a PR, and merged or
+	// closed PRs, keep being tracked
+	prTrackingWindow = 7 * 24 * time.Hour
+)
+
+// trackedBranch is a branch whose PR the daemon follows
+type trackedBranch struct {
+	owner    string // Worker (or history entry) the branch belongs to
+	prNumber int    // Known PR number, 0 if none has been seen yet
+}
+
+// prTrackingLoop periodically refreshes the PR status of tracked branches
+func (d *Daemon) prTrackingLoop() {
+	d.periodicLoop("PR tracking", prTrackingInterval, nil, d.trackPullRequests)
+}
+
+// TriggerPRTracking triggers an immediate PR status refresh (for testing)
+func (d *Daemon) TriggerPRTracking() {
+	d.trackPullRequests()
+}
+
+// trackPullRequests polls GitHub for every repo with tracked branches
+func (d *Daemon) trackPullRequests() {
+	d.logger.Debug("Tracking pull requests")
+
+	repos := d.state.GetAllRepos()
+	for repoName, repo := range repos {
+		d.trackRepoPullRequests(repoName, repo)
+	}
+}
+
+// trackRepoPullRequests refreshes the PRs for one repository. Recent PRs come
+// from a single `gh pr list`; tracked PRs that have scrolled out of that list
+// are fetched with `gh pr view`.
+func (d *Daemon) trackRepoPullRequests(repoName string, repo *state.Repository) {
+	branches := trackedBranches(repo)
+	if len(branches) == 0 {
+		d.pruneTrackedPullRequests(repoName, repo)
+		return
+	}
+
+	repoPath := d.paths.RepoDir(repoName)
+	if _, err := os.Stat(repoPath); err != nil {
+		return
+	}
+
+	prs, err := d.gh.ListPRs(d.ctx, repoPath, prListLimit)
+	if err != nil {
+		d.logger.Debug("Could not list PRs for %s: %v", repoName, err)
+		return
+	}
+
+	// gh lists newest first, so the first PR per branch is the current one
+	byBranch := make(map[string]github.PullRequest, len(prs))
+	for _, pr := range prs {
+		if _, seen := byBranch[pr.HeadRefName]; !seen {
+			byBranch[pr.HeadRefName] = pr
+		}
+	}
+
+	for branch, tracked := range branches {
+		pr, found := byBranch[branch]
+		if !found {
+			if tracked.prNumber == 0 {
+				continue
+			}
+			viewed, err := d.gh.ViewPR(d.ctx, repoPath, strconv.Itoa(tracked.prNumber))
+			if err != nil {
+				d.logger.Debug("Could not view PR #%d for %s: %v", tracked.prNumber, repoName, err)
+				continue
+			}
+			pr = *viewed
+		}
+
+		d.recordPullRequest(repoName, repo, branch, tracked.owner, pr)
+	}
+
+	d.pruneTrackedPullRequests(repoName, repo)
+}
+
+// trackedBranches returns the branches whose PRs should be polled: branches of
+// running workers, recently finished tasks still waiting on a PR outcome, and
+// PRs already being tracked that are still open.
+func trackedBranches(repo *state.Repository) map[string]trackedBranch {
+	branches := make(map[string]trackedBranch)
+
+	for agentName, agent := range repo.Agents {
+		if agent.Type != state.AgentTypeWorker {
+			continue
+		}
+		branch := "work/" + agentName
+		if agent.WorktreePath != "" {
+			if b, err := worktree.GetCurrentBranch(agent.WorktreePath); err == nil && b != "" {
+				branch = b
+			}
+		}
+		branches[branch] = trackedBranch{owner: agentName}
+	}
+
+	now := time.Now()
+	for _, entry := range repo.TaskHistory {
+		if entry.Branch == "" || entry.Status == state.TaskStatusMerged || entry.Status == state.TaskStatusClosed {
+			continue
+		}
+		if entry.Status != state.TaskStatusOpen && now.Sub(entry.CompletedAt) > prTrackingWindow {
+			continue
+		}
+		tracked := branches[entry.Branch]
+		if tracked.owner == "" {
+			tracked.owner = entry.Name
+		}
+		if entry.PRNumber > 0 {
+			tracked.prNumber = entry.PRNumber
+		}
+		branches[entry.Branch] = tracked
+	}
+
+	for branch, pr := range repo.PullRequests {
+		tracked, isTracked := branches[branch]
+		if !isTracked && pr.State != state.TaskStatusOpen {
+			continue
+		}
+		if tracked.owner == "" {
+			tracked.owner = pr.Agent
+		}
+		if tracked.prNumber == 0 {
+			tracked.prNumber = pr.Number
+		}
+		branches[branch] = tracked
+	}
+
+	return branches
+}
+
+// recordPullRequest stores a PR observation, announces changes, and brings the
+// owning task history entries in line with the PR's state
+func (d *Daemon) recordPullRequest(repoName string, repo *state.Repository, branch, owner string, pr github.PullRequest) {
+	status := state.PullRequestStatus{
+		Branch:         branch,
+		Agent:          owner,
+		Number:         pr.Number,
+		URL:            pr.URL,
+		State:          prTaskStatus(pr.State),
+		CIStatus:       state.CIStatus(pr.CIStatus()),
+		ReviewDecision: pr.ReviewDecision,
+		Mergeable:      pr.Mergeable,
+		UpdatedAt:      pr.UpdatedAt,
+		CheckedAt:      time.Now(),
+		HeadSHA:        pr.HeadRefOid,
+	}
+	if known, ok := repo.PullRequests[branch]; ok {
+		status.FixAttempts = known.FixAttempts
+		status.FixAttemptSHA = known.FixAttemptSHA
+	}
+
+	previous, existed, err := d.state.UpdatePullRequest(repoName, status)
+	if err != nil {
+		d.logger.Error("Failed to record PR #%d for %s: %v", pr.Number, repoName, err)
+		return
+	}
+
+	if !existed || pullRequestChanged(previous, status) {
+		d.logger.Info("PR #%d (%s/%s): state=%s ci=%s review=%s mergeable=%s", status.Number, repoName, branch, status.State, status.CIStatus, status.ReviewDecision, status.Mergeable)
+		d.publishEvent(events.PRStatusChanged, repoName, owner, map[string]interface{}{
+			"branch":          branch,
+			"pr_number":       status.Number,
+			"pr_url":          status.URL,
+			"state":           string(status.State),
+			"ci_status":       string(status.CIStatus),
+			"review_decision": status.ReviewDecision,
+			"mergeable":       status.Mergeable,
+		})
+	}
+
+	status = d.fixFailedCI(repoName, repo, status, pr)
+
+	// Update the latest history entry of each task that worked on this branch
+	seen := make(map[string]bool)
+	for i := len(repo.TaskHistory) - 1; i >= 0; i-- {
+		entry := repo.TaskHistory[i]
+		if entry.Branch != branch || seen[entry.Name] {
+			continue
+		}
+		seen[entry.Name] = true
+
+		// A failed task keeps its status unless its PR made it in anyway
+		if entry.Status == state.TaskStatusFailed && status.State != state.TaskStatusMerged {
+			continue
+		}
+		if entry.Status == status.State && entry.PRNumber == status.Number {
+			continue
+		}
+
+		if err := d.state.UpdateTaskHistoryStatus(repoName, entry.Name, status.State, status.URL, status.Number); err != nil {
+			d.logger.Debug("Could not update task history for %s/%s: %v", repoName, entry.Name, err)
+			continue
+		}
+		d.publishEvent(events.TaskStatusChanged, repoName, entry.Name, map[string]interface{}{
+			"status":          string(status.State),
+			"previous_status": string(entry.Status),
+			"pr_url":          status.URL,
+			"pr_number":       status.Number,
+		})
+	}
+}
+
+// pruneTrackedPullRequests forgets merged and closed PRs once they age out
+func (d *Daemon) pruneTrackedPullRequests(repoName string, repo *state.Repository) {
+	for branch, pr := range repo.PullRequests {
+		if pr.State == state.TaskStatusOpen || time.Since(pr.UpdatedAt) < prTrackingWindow {
+			continue
+		}
+		if _, isWorker := repo.Agents[pr.Agent]; isWorker {
+			continue
+		}
+		if err := d.state.RemovePullRequest(repoName, branch); err != nil {
+			d.logger.Debug("Could not prune PR #%d for %s: %v", pr.Number, repoName, err)
+		}
+	}
+}
+
+// pullRequestChanged reports whether anything worth announcing changed
+func pullRequestChanged(a, b state.PullRequestStatus) bool {
+	return a.Number != b.Number ||
+		a.State != b.State ||
+		a.CIStatus != b.CIStatus ||
+		a.ReviewDecision != b.ReviewDecision ||
+		a.Mergeable != b.Mergeable
+}
+
+// prTaskStatus converts gh's PR state to a task status
+func prTaskStatus(prState string) state.TaskStatus {
+	switch strings.ToLower(prState) {
+	case "merged":
+		return state.TaskStatusMerged
+	case "open":
+		return state.TaskStatusOpen
+	case "closed":
+		return state.TaskStatusClosed
+	default:
+		return state.TaskStatusUnknown
+	}
+}
+
+// queryPRStatus looks up a PR by number or head branch
+func (d *Daemon) queryPRStatus(repoPath, ref string) (state.TaskStatus, string, int, error) {
+	pr, err := d.gh.ViewPR(d.ctx, repoPath, ref)
+	if err != nil {
+		return state.TaskStatusUnknown, "", 0, err
+	}
+	return prTaskStatus(pr.State), pr.URL, pr.Number, nil
+}
+
+// handleListPRs returns the tracked pull requests for a repository
+func (d *Daemon) handleListPRs(req socket.Request) socket.Response {
+	repoName, errResp, ok := getRequiredStringArg(req.Args, "repo", "repository name is required")
+	if !ok {
+		return errResp
+	}
+
+	prs, err := d.state.GetPullRequests(repoName)
+	if err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
+	return socket.SuccessResponse(prs)
+}
@@ -0,0 +1,239 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dlorenc/multiclaude/internal/events"
+	"github.com/dlorenc/multiclaude/internal/github"
+	"github.com/dlorenc/multiclaude/internal/socket"
+	"github.com/dlorenc/multiclaude/internal/state"
+)
+
+// fakeGitHub is an in-memory github.Client
+type fakeGitHub struct {
+	mu     sync.Mutex
+	listed []github.PullRequest          // Returned by ListPRs
+	byRef  map[string]github.PullRequest // Returned by ViewPR
+	views  []string                      // Refs passed to ViewPR
+	logs   map[string]string             // Returned by FailedRunLog, keyed by run ID
+	err    error
+}
+
+func (f *fakeGitHub) ListPRs(ctx context.Context, repoPath string, limit int) ([]github.PullRequest, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	return append([]github.PullRequest(nil), f.listed...), nil
+}
+
+func (f *fakeGitHub) ViewPR(ctx context.Context, repoPath, ref string) (*github.PullRequest, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.views = append(f.views, ref)
+	if f.err != nil {
+		return nil, f.err
+	}
+	pr, ok := f.byRef[ref]
+	if !ok {
+		return nil, fmt.Errorf("no pull requests found for %s", ref)
+	}
+	return &pr, nil
+}
+
+func (f *fakeGitHub) FailedRunLog(ctx context.Context, repoPath, runID string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	log, ok := f.logs[runID]
+	if !ok {
+		return "", fmt.Errorf("run %s not found", runID)
+	}
+	return log, nil
+}
+
+// setupPRTrackingRepo registers a repo whose checkout directory exists
+func setupPRTrackingRepo(t *testing.T, d *Daemon) *fakeGitHub {
+	t.Helper()
+
+	if err := os.MkdirAll(d.paths.RepoDir("test-repo"), 0755); err != nil {
+		t.Fatalf("Failed to create repo dir: %v", err)
+	}
+	repo := &state.Repository{
+		GithubURL:   "https://github.com/test/repo",
+		TmuxSession: "mc-test-prs",
+		Agents:      make(map[string]state.Agent),
+	}
+	if err := d.state.AddRepo("test-repo", repo); err != nil {
+		t.Fatalf("Failed to add repo: %v", err)
+	}
+
+	fake := &fakeGitHub{byRef: make(map[string]github.PullRequest)}
+	d.gh = fake
+	return fake
+}
+
+func TestTrackPullRequestsUpdatesStateAndHistory(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+	fake := setupPRTrackingRepo(t, d)
+
+	// A running worker and a finished task that hasn't resolved yet
+	if err := d.state.AddAgent("test-repo", "clever-fox", state.Agent{
+		Type:       state.AgentTypeWorker,
+		TmuxWindow: "clever-fox",
+		Task:       "Add auth",
+		CreatedAt:  time.Now(),
+	}); err != nil {
+		t.Fatalf("Failed to add agent: %v", err)
+	}
+	if err := d.state.AddTaskHistory("test-repo", state.TaskHistoryEntry{
+		Name:        "happy-eagle",
+		Task:        "Fix bug",
+		Branch:      "work/happy-eagle",
+		Status:      state.TaskStatusUnknown,
+		CreatedAt:   time.Now().Add(-time.Hour),
+		CompletedAt: time.Now().Add(-time.Minute),
+	}); err != nil {
+		t.Fatalf("Failed to add history: %v", err)
+	}
+
+	updatedAt := time.Now().Add(-10 * time.Minute).UTC().Truncate(time.Second)
+	fake.listed = []github.PullRequest{
+		{
+			Number: 12, URL: "https://github.com/test/repo/pull/12", State: "OPEN",
+			HeadRefName: "work/clever-fox", ReviewDecision: "REVIEW_REQUIRED", Mergeable: "MERGEABLE",
+			UpdatedAt:         updatedAt,
+			StatusCheckRollup: []github.Check{{Name: "test", Status: "IN_PROGRESS"}},
+		},
+		{
+			Number: 11, URL: "https://github.com/test/repo/pull/11", State: "MERGED",
+			HeadRefName: "work/happy-eagle", ReviewDecision: "APPROVED", Mergeable: "UNKNOWN",
+			UpdatedAt:         updatedAt,
+			StatusCheckRollup: []github.Check{{Name: "test", Status: "COMPLETED", Conclusion: "SUCCESS"}},
+		},
+		// Older PR for the same branch must not override the newer one
+		{Number: 3, State: "CLOSED", HeadRefName: "work/clever-fox"},
+		// Untracked branch is ignored
+		{Number: 10, State: "OPEN", HeadRefName: "someone-else"},
+	}
+
+	sub := d.events.Subscribe(events.Filter{Types: []events.Type{events.PRStatusChanged, events.TaskStatusChanged}})
+	defer sub.Close()
+
+	d.TriggerPRTracking()
+
+	prs, err := d.state.GetPullRequests("test-repo")
+	if err != nil {
+		t.Fatalf("GetPullRequests() failed: %v", err)
+	}
+	if len(prs) != 2 {
+		t.Fatalf("tracked %d PRs, want 2: %+v", len(prs), prs)
+	}
+
+	eagle, fox := prs[0], prs[1]
+	if fox.Number != 12 || fox.Agent != "clever-fox" || fox.State != state.TaskStatusOpen {
+		t.Errorf("clever-fox PR = %+v", fox)
+	}
+	if fox.CIStatus != state.CIPending || fox.ReviewDecision != "REVIEW_REQUIRED" || fox.Mergeable != "MERGEABLE" {
+		t.Errorf("clever-fox PR details = %+v", fox)
+	}
+	if !fox.UpdatedAt.Equal(updatedAt) || fox.CheckedAt.IsZero() {
+		t.Errorf("clever-fox PR times: updated=%v checked=%v", fox.UpdatedAt, fox.CheckedAt)
+	}
+	if eagle.Number != 11 || eagle.State != state.TaskStatusMerged || eagle.CIStatus != state.CIPassing {
+		t.Errorf("happy-eagle PR = %+v", eagle)
+	}
+
+	history, _ := d.state.GetTaskHistory("test-repo", 0)
+	if len(history) != 1 || history[0].Status != state.TaskStatusMerged || history[0].PRNumber != 11 {
+		t.Errorf("history = %+v, want happy-eagle merged as #11", history)
+	}
+
+	// Two PR changes plus one task status change
+	counts := make(map[events.Type]int)
+	for len(sub.C) > 0 {
+		counts[(<-sub.C).Type]++
+	}
+	if counts[events.PRStatusChanged] != 2 || counts[events.TaskStatusChanged] != 1 {
+		t.Errorf("events = %v, want 2 pr_status_changed and 1 task_status_changed", counts)
+	}
+
+	// Polling again without changes stays quiet
+	d.TriggerPRTracking()
+	if len(sub.C) != 0 {
+		t.Errorf("unchanged PRs produced %d events", len(sub.C))
+	}
+
+	// CI finishing is announced
+	fake.mu.Lock()
+	fake.listed[0].StatusCheckRollup = []github.Check{{Name: "test", Status: "COMPLETED", Conclusion: "FAILURE"}}
+	fake.mu.Unlock()
+	d.TriggerPRTracking()
+
+	prs, _ = d.state.GetPullRequests("test-repo")
+	if prs[1].CIStatus != state.CIFailing {
+		t.Errorf("CI status = %q, want failing", prs[1].CIStatus)
+	}
+	if len(sub.C) != 1 {
+		t.Errorf("CI change produced %d events, want 1", len(sub.C))
+	}
+}
+
+func TestTrackPullRequestsViewsOlderPRs(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+	fake := setupPRTrackingRepo(t, d)
+
+	// An open PR we already know about that has scrolled out of `gh pr list`
+	if _, _, err := d.state.UpdatePullRequest("test-repo", state.PullRequestStatus{
+		Branch: "work/old-task", Agent: "old-task", Number: 7, State: state.TaskStatusOpen,
+	}); err != nil {
+		t.Fatalf("UpdatePullRequest() failed: %v", err)
+	}
+	fake.byRef["7"] = github.PullRequest{Number: 7, State: "CLOSED", HeadRefName: "work/old-task"}
+
+	d.TriggerPRTracking()
+
+	if len(fake.views) != 1 || fake.views[0] != "7" {
+		t.Errorf("ViewPR calls = %v, want [7]", fake.views)
+	}
+	prs, _ := d.state.GetPullRequests("test-repo")
+	if len(prs) != 1 || prs[0].State != state.TaskStatusClosed {
+		t.Errorf("PRs = %+v, want #7 closed", prs)
+	}
+
+	// Closed PRs are no longer polled
+	d.TriggerPRTracking()
+	if len(fake.views) != 1 {
+		t.Errorf("closed PR was polled again: %v", fake.views)
+	}
+}
+
+func TestTrackPullRequestsSkipsOnError(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+	fake := setupPRTrackingRepo(t, d)
+	fake.err = fmt.Errorf("gh: not authenticated")
+
+	if err := d.state.AddAgent("test-repo", "clever-fox", state.Agent{Type: state.AgentTypeWorker, TmuxWindow: "clever-fox"}); err != nil {
+		t.Fatalf("Failed to add agent: %v", err)
+	}
+
+	d.TriggerPRTracking()
+
+	prs, _ := d.state.GetPullRequests("test-repo")
+	if len(prs) != 0 {
+		t.Errorf("PRs recorded despite gh error: %+v", prs)
+	}
+
+	resp := d.handleListPRs(socket.Request{Command: "list_prs", Args: map[string]interface{}{"repo": "test-repo"}})
+	if !resp.Success {
+		t.Errorf("list_prs failed: %s", resp.Error)
+	}
+}
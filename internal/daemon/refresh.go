@@ -0,0 +1,357 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dlorenc/multiclaude/internal/events"
+	"github.com/dlorenc/multiclaude/internal/state"
+	"github.com/dlorenc/multiclaude/internal/worktree"
+)
+
+// Refresh results reported per agent by refreshRepos
+const (
+	refreshRebased   = "rebased"
+	refreshUpToDate  = "up-to-date"
+	refreshSkipped   = "skipped"
+	refreshConflicts = "conflicts"
+	refreshFailed    = "failed"
+)
+
+// refreshOutcome is what a refresh did to one agent's worktree, or to the
+// repository checkout shared by the persistent agents
+type refreshOutcome struct {
+	repo    string
+	agent   string // Agents sharing the checkout, comma separated, for the repo checkout
+	target  string // Agent type, or "checkout" for the repository checkout
+	result  string
+	detail  string
+	commits int
+}
+
+// refreshable reports whether agents of this type get their own worktree
+// rebased onto main. Persistent agents share the repository checkout, which is
+// fast-forwarded instead.
+func refreshable(agentType state.AgentType) bool {
+	return agentType == state.AgentTypeWorker || agentType == state.AgentTypeWorkspace || agentType == state.AgentTypeReview
+}
+
+// refreshWorktrees syncs the worktrees of every repository with main
+func (d *Daemon) refreshWorktrees() []refreshOutcome {
+	return d.refreshRepos("")
+}
+
+// refreshRepos syncs agent worktrees that are behind main: worker, workspace,
+// and review worktrees are rebased (stashing uncommitted work), and the
+// repository checkout used by persistent agents is fast-forwarded. Agents that
+// opted out are left alone. Only repoFilter is refreshed when it is set.
+// Returns what happened to each agent.
+func (d *Daemon) refreshRepos(repoFilter string) []refreshOutcome {
+	d.logger.Debug("Checking agent worktrees for refresh")
+
+	var outcomes []refreshOutcome
+	repos := d.state.GetAllRepos()
+	for repoName, repo := range repos {
+		if repoFilter != "" && repoName != repoFilter {
+			continue
+		}
+		repoPath := d.paths.RepoDir(repoName)
+
+		// Check if repo path exists
+		if _, err := os.Stat(repoPath); os.IsNotExist(err) {
+			continue
+		}
+
+		failed := func(detail string) {
+			outcomes = append(outcomes, refreshOutcome{repo: repoName, target: "repository", result: refreshFailed, detail: detail})
+		}
+
+		wt := worktree.NewManager(repoPath)
+
+		// Get the upstream remote and default branch
+		remote, err := wt.GetUpstreamRemote()
+		if err != nil {
+			d.logger.Debug("Could not get remote for %s: %v", repoName, err)
+			failed("no upstream remote")
+			continue
+		}
+
+		mainBranch, err := wt.GetDefaultBranch(remote)
+		if err != nil {
+			d.logger.Debug("Could not get default branch for %s: %v", repoName, err)
+			failed("could not determine default branch")
+			continue
+		}
+
+		// Fetch from remote to have latest state
+		if err := wt.FetchRemote(remote); err != nil {
+			d.logger.Debug("Could not fetch from remote for %s: %v", repoName, err)
+			failed("fetch failed")
+			continue
+		}
+
+		var checkoutUsers, checkoutOptedOut []string
+		for agentName, agent := range repo.Agents {
+			if agent.WorktreePath == repoPath {
+				checkoutUsers = append(checkoutUsers, agentName)
+				if agent.RefreshDisabled {
+					checkoutOptedOut = append(checkoutOptedOut, agentName)
+				}
+				continue
+			}
+			if !refreshable(agent.Type) || agent.WorktreePath == "" {
+				continue
+			}
+			if _, err := os.Stat(agent.WorktreePath); os.IsNotExist(err) {
+				continue
+			}
+			outcome := d.refreshAgentWorktree(repoName, agentName, agent, remote, mainBranch, repo.RefreshConfig)
+			outcomes = append(outcomes, outcome)
+		}
+
+		if len(checkoutUsers) > 0 {
+			sort.Strings(checkoutUsers)
+			outcome := refreshOutcome{repo: repoName, agent: strings.Join(checkoutUsers, ", "), target: "checkout"}
+			if len(checkoutOptedOut) > 0 {
+				sort.Strings(checkoutOptedOut)
+				outcome.result = refreshSkipped
+				outcome.detail = "refresh disabled for " + strings.Join(checkoutOptedOut, ", ")
+			} else {
+				outcome = d.fastForwardCheckout(repoName, repoPath, remote, mainBranch, outcome)
+			}
+			outcomes = append(outcomes, outcome)
+		}
+	}
+
+	sort.Slice(outcomes, func(i, j int) bool {
+		if outcomes[i].repo != outcomes[j].repo {
+			return outcomes[i].repo < outcomes[j].repo
+		}
+		return outcomes[i].agent < outcomes[j].agent
+	})
+	return outcomes
+}
+
+// refreshAgentWorktree rebases one agent's worktree onto main
+func (d *Daemon) refreshAgentWorktree(repoName, agentName string, agent state.Agent, remote, mainBranch string, config state.RefreshConfig) refreshOutcome {
+	outcome := refreshOutcome{repo: repoName, agent: agentName, target: string(agent.Type)}
+
+	if agent.RefreshDisabled {
+		outcome.result = refreshSkipped
+		outcome.detail = "refresh disabled"
+		return outcome
+	}
+
+	// Check worktree state
+	wtState, err := worktree.GetWorktreeState(agent.WorktreePath, remote, mainBranch)
+	if err != nil {
+		d.logger.Debug("Could not get worktree state for %s/%s: %v", repoName, agentName, err)
+		outcome.result = refreshFailed
+		outcome.detail = "could not read worktree state"
+		return outcome
+	}
+
+	// Skip if can't refresh (detached HEAD, mid-rebase, mid-merge, on main, or up to date)
+	if !wtState.CanRefresh {
+		d.logger.Debug("Skipping refresh for %s/%s: %s", repoName, agentName, wtState.RefreshReason)
+		// An agent that rebased onto main itself no longer needs to
+		if agent.NeedsRebase && !wtState.IsMidRebase && !wtState.IsMidMerge && wtState.CommitsBehind == 0 {
+			d.clearNeedsRebase(repoName, agentName)
+		}
+		outcome.result = refreshSkipped
+		if wtState.RefreshReason == "already up to date" {
+			outcome.result = refreshUpToDate
+		}
+		outcome.detail = wtState.RefreshReason
+		return outcome
+	}
+
+	// Refresh the worktree. Only workers may be left mid-rebase: workspaces
+	// belong to the user and review agents don't own their branch.
+	d.logger.Info("Refreshing worktree for %s/%s (%d commits behind)", repoName, agentName, wtState.CommitsBehind)
+	result := worktree.RefreshWorktreeWithOptions(agent.WorktreePath, remote, mainBranch, worktree.RefreshOptions{
+		KeepConflicts: agent.Type == state.AgentTypeWorker && config.ResolveConflicts,
+	})
+
+	if result.Error != nil {
+		if result.HasConflicts {
+			d.handleRefreshConflict(repoName, agentName, agent.Type, remote+"/"+mainBranch, result)
+			outcome.result = refreshConflicts
+			outcome.detail = describeFiles(result.ConflictFiles)
+			if result.RebaseInProgress {
+				outcome.detail += ", rebase left in progress"
+			}
+			return outcome
+		}
+		d.logger.Error("Failed to refresh worktree for %s/%s: %v", repoName, agentName, result.Error)
+		outcome.result = refreshFailed
+		outcome.detail = strings.SplitN(result.Error.Error(), "\n", 2)[0]
+		return outcome
+	}
+	if result.Skipped {
+		d.logger.Debug("Worktree refresh for %s/%s skipped: %s", repoName, agentName, result.SkipReason)
+		outcome.result = refreshSkipped
+		outcome.detail = result.SkipReason
+		return outcome
+	}
+
+	d.logger.Info("Refreshed worktree for %s/%s: rebased %d commits", repoName, agentName, result.CommitsRebased)
+	if agent.NeedsRebase {
+		d.clearNeedsRebase(repoName, agentName)
+	}
+	d.publishEvent(events.WorktreeRefreshed, repoName, agentName, map[string]interface{}{
+		"commits_rebased": result.CommitsRebased,
+		"branch":          mainBranch,
+	})
+
+	// Notify the agent that their worktree was refreshed. Workspaces only
+	// take input from the user.
+	if agent.Type != state.AgentTypeWorkspace {
+		msgMgr := d.getMessageManager()
+		msg := fmt.Sprintf("Your worktree has been automatically synced with main (rebased %d commits). Run 'git log --oneline -5' to see recent changes.", result.CommitsRebased)
+		if _, err := msgMgr.Send(repoName, "daemon", agentName, msg); err != nil {
+			d.logger.Debug("Could not send refresh notification to %s/%s: %v", repoName, agentName, err)
+		}
+	}
+
+	outcome.result = refreshRebased
+	outcome.commits = result.CommitsRebased
+	outcome.detail = fmt.Sprintf("%d commits behind", wtState.CommitsBehind)
+	if result.WasStashed {
+		outcome.detail += ", uncommitted changes stashed and restored"
+	}
+	return outcome
+}
+
+// fastForwardCheckout fast-forwards the repository checkout the persistent
+// agents run in
+func (d *Daemon) fastForwardCheckout(repoName, repoPath, remote, mainBranch string, outcome refreshOutcome) refreshOutcome {
+	result := worktree.FastForwardWorktree(repoPath, remote, mainBranch)
+	switch {
+	case result.Error != nil:
+		d.logger.Warn("Failed to fast-forward repository checkout of %s: %v", repoName, result.Error)
+		outcome.result = refreshFailed
+		outcome.detail = strings.SplitN(result.Error.Error(), "\n", 2)[0]
+	case result.Skipped:
+		d.logger.Debug("Fast-forward of repository checkout of %s skipped: %s", repoName, result.SkipReason)
+		outcome.result = refreshSkipped
+		if result.SkipReason == "already up to date" {
+			outcome.result = refreshUpToDate
+		}
+		outcome.detail = result.SkipReason
+	default:
+		d.logger.Info("Fast-forwarded repository checkout of %s by %d commits", repoName, result.CommitsRebased)
+		d.publishEvent(events.WorktreeRefreshed, repoName, "", map[string]interface{}{
+			"commits_rebased": result.CommitsRebased,
+			"branch":          mainBranch,
+		})
+		outcome.result = refreshRebased
+		outcome.commits = result.CommitsRebased
+		outcome.detail = fmt.Sprintf("fast-forwarded %d commits", result.CommitsRebased)
+	}
+	return outcome
+}
+
+// maxConflictCommitsListed caps the upstream commits quoted in a conflict message
+const maxConflictCommitsListed = 10
+
+// handleRefreshConflict records that an agent's branch conflicts with main and
+// tells the agent which files conflict and which upstream commits touched
+// them. For workers the supervisor is told when the set of conflicting files
+// changes, so a worker that ignores the message isn't reported again every
+// refresh. Workspaces only take input from the user, so they aren't messaged.
+func (d *Daemon) handleRefreshConflict(repoName, agentName string, agentType state.AgentType, upstream string, result worktree.RefreshResult) {
+	d.logger.Warn("Worktree refresh for %s/%s has conflicts in: %v", repoName, agentName, result.ConflictFiles)
+
+	changed, err := d.state.SetAgentNeedsRebase(repoName, agentName, result.ConflictFiles)
+	if err != nil {
+		d.logger.Error("Failed to record needs-rebase for %s/%s: %v", repoName, agentName, err)
+		return
+	}
+
+	d.publishEvent(events.WorktreeConflicted, repoName, agentName, map[string]interface{}{
+		"conflict_files":     result.ConflictFiles,
+		"rebase_in_progress": result.RebaseInProgress,
+		"branch":             result.Branch,
+	})
+
+	// A rebase left in progress is new work for the agent even when the files
+	// are the same as last time
+	if !changed && !result.RebaseInProgress {
+		return
+	}
+
+	msgMgr := d.getMessageManager()
+	if agentType != state.AgentTypeWorkspace {
+		if _, err := msgMgr.Send(repoName, "daemon", agentName, conflictMessage(upstream, result)); err != nil {
+			d.logger.Warn("Failed to send conflict notice to %s/%s: %v", repoName, agentName, err)
+		}
+	}
+
+	if changed && agentType == state.AgentTypeWorker {
+		msg := fmt.Sprintf("Worker '%s' needs a rebase: its branch conflicts with %s in %s. The worker has been told which files and commits conflict.",
+			agentName, upstream, describeFiles(result.ConflictFiles))
+		if _, err := msgMgr.Send(repoName, "daemon", "supervisor", msg); err != nil {
+			d.logger.Warn("Failed to notify supervisor about conflicts of %s/%s: %v", repoName, agentName, err)
+		}
+	}
+	d.requestMessageRouting()
+}
+
+// clearNeedsRebase clears the needs-rebase state of an agent whose branch is
+// back in sync with main
+func (d *Daemon) clearNeedsRebase(repoName, agentName string) {
+	changed, err := d.state.SetAgentNeedsRebase(repoName, agentName, nil)
+	if err != nil {
+		d.logger.Debug("Could not clear needs-rebase for %s/%s: %v", repoName, agentName, err)
+		return
+	}
+	if changed {
+		d.logger.Info("Worktree of %s/%s is in sync with main again", repoName, agentName)
+	}
+}
+
+// conflictMessage builds the message telling a worker its branch conflicts
+// with upstream
+func conflictMessage(upstream string, result worktree.RefreshResult) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Your branch '%s' conflicts with %s and could not be synced automatically.\n\n", result.Branch, upstream)
+
+	b.WriteString("Conflicting files:\n")
+	for _, file := range result.ConflictFiles {
+		fmt.Fprintf(&b, "  - %s\n", file)
+	}
+
+	if len(result.ConflictCommits) > 0 {
+		b.WriteString("\nUpstream commits touching them:\n")
+		for i, commit := range result.ConflictCommits {
+			if i == maxConflictCommitsListed {
+				fmt.Fprintf(&b, "  ... and %d more\n", len(result.ConflictCommits)-i)
+				break
+			}
+			fmt.Fprintf(&b, "  - %s\n", commit)
+		}
+	}
+
+	b.WriteString("\n")
+	if result.RebaseInProgress {
+		b.WriteString("The rebase is still in progress in your worktree. Resolve the conflicts, 'git add' the files, and run 'git rebase --continue' (or 'git rebase --abort' to put your branch back as it was).")
+	} else {
+		fmt.Fprintf(&b, "The rebase was aborted, so your worktree is unchanged. When you reach a good stopping point, run 'git rebase %s' and resolve the conflicts.", upstream)
+	}
+	return b.String()
+}
+
+// describeFiles lists a few file names for a one-line summary
+func describeFiles(files []string) string {
+	const maxListed = 3
+	if len(files) == 1 {
+		return "1 file (" + files[0] + ")"
+	}
+	if len(files) <= maxListed {
+		return fmt.Sprintf("%d files (%s)", len(files), strings.Join(files, ", "))
+	}
+	return fmt.Sprintf("%d files (%s, ...)", len(files), strings.Join(files[:maxListed], ", "))
+}
@@ -0,0 +1,222 @@
+package daemon
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dlorenc/multiclaude/internal/state"
+)
+
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, output)
+	}
+}
+
+// addConflictingWorker creates a worker whose branch changes README.md while
+// main changes it too
+func addConflictingWorker(t *testing.T, d *Daemon, repoDir string) string {
+	t.Helper()
+
+	runGit(t, repoDir, "remote", "add", "origin", repoDir)
+	wtPath := filepath.Join(d.paths.WorktreeDir("test-repo"), "clever-fox")
+	runGit(t, repoDir, "worktree", "add", "-b", "work/clever-fox", wtPath, "main")
+
+	if err := os.WriteFile(filepath.Join(wtPath, "README.md"), []byte("# Feature\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, wtPath, "commit", "-am", "Feature README")
+
+	if err := os.WriteFile(filepath.Join(repoDir, "README.md"), []byte("# Upstream\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, repoDir, "commit", "-am", "Upstream README")
+	runGit(t, repoDir, "fetch", "origin")
+
+	repo := &state.Repository{
+		GithubURL:   "https://github.com/test/repo",
+		TmuxSession: "test-session",
+		Agents: map[string]state.Agent{
+			"supervisor": {Type: state.AgentTypeSupervisor, TmuxWindow: "supervisor", CreatedAt: time.Now()},
+			"clever-fox": {Type: state.AgentTypeWorker, WorktreePath: wtPath, TmuxWindow: "clever-fox", Task: "Edit README", CreatedAt: time.Now()},
+		},
+	}
+	if err := d.state.AddRepo("test-repo", repo); err != nil {
+		t.Fatalf("Failed to add repo: %v", err)
+	}
+	return wtPath
+}
+
+func TestRefreshWorktreesReportsConflicts(t *testing.T) {
+	d, repoDir, cleanup := setupTestDaemonWithGitRepo(t)
+	defer cleanup()
+	wtPath := addConflictingWorker(t, d, repoDir)
+
+	d.refreshWorktrees()
+
+	agent, _ := d.state.GetAgent("test-repo", "clever-fox")
+	if !agent.NeedsRebase || len(agent.RebaseConflicts) != 1 || agent.RebaseConflicts[0] != "README.md" {
+		t.Fatalf("agent = %+v, want needs rebase on README.md", agent)
+	}
+
+	msgs, _ := d.getMessageManager().List("test-repo", "clever-fox")
+	if len(msgs) != 1 {
+		t.Fatalf("worker got %d messages, want 1", len(msgs))
+	}
+	for _, want := range []string{"README.md", "Upstream README", "rebase was aborted"} {
+		if !strings.Contains(msgs[0].Body, want) {
+			t.Errorf("worker message missing %q:\n%s", want, msgs[0].Body)
+		}
+	}
+	if msgs, _ := d.getMessageManager().List("test-repo", "supervisor"); len(msgs) != 1 || !strings.Contains(msgs[0].Body, "needs a rebase") {
+		t.Errorf("supervisor messages = %+v, want a needs-rebase notice", msgs)
+	}
+
+	// The same conflicts aren't reported again
+	d.refreshWorktrees()
+	if msgs, _ := d.getMessageManager().List("test-repo", "clever-fox"); len(msgs) != 1 {
+		t.Errorf("worker got %d messages after a second refresh, want 1", len(msgs))
+	}
+
+	// Once the worker resolves the conflicts itself the state is cleared
+	cmd := exec.Command("git", "rebase", "origin/main")
+	cmd.Dir = wtPath
+	cmd.Run()
+	if err := os.WriteFile(filepath.Join(wtPath, "README.md"), []byte("# Both\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, wtPath, "add", "README.md")
+	runGit(t, wtPath, "-c", "core.editor=true", "rebase", "--continue")
+
+	d.refreshWorktrees()
+	if agent, _ := d.state.GetAgent("test-repo", "clever-fox"); agent.NeedsRebase {
+		t.Errorf("agent = %+v, want needs-rebase cleared", agent)
+	}
+}
+
+func TestRefreshWorktreesLeavesConflictsToResolve(t *testing.T) {
+	d, repoDir, cleanup := setupTestDaemonWithGitRepo(t)
+	defer cleanup()
+	addConflictingWorker(t, d, repoDir)
+	if err := d.state.UpdateRefreshConfig("test-repo", state.RefreshConfig{ResolveConflicts: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	d.refreshWorktrees()
+
+	msgs, _ := d.getMessageManager().List("test-repo", "clever-fox")
+	if len(msgs) != 1 || !strings.Contains(msgs[0].Body, "rebase is still in progress") {
+		t.Fatalf("worker messages = %+v, want a notice about the rebase in progress", msgs)
+	}
+
+	// The worker is mid-rebase, so later refreshes leave it alone
+	d.refreshWorktrees()
+	if agent, _ := d.state.GetAgent("test-repo", "clever-fox"); !agent.NeedsRebase {
+		t.Error("needs-rebase should stay set while the rebase is in progress")
+	}
+	if msgs, _ := d.getMessageManager().List("test-repo", "clever-fox"); len(msgs) != 1 {
+		t.Errorf("worker got %d messages, want 1", len(msgs))
+	}
+}
+
+func TestRefreshReposCoversPersistentAgents(t *testing.T) {
+	d, repoDir, cleanup := setupTestDaemonWithGitRepo(t)
+	defer cleanup()
+
+	// origin is a bare copy of the repository
+	upstream := filepath.Join(t.TempDir(), "upstream.git")
+	runGit(t, repoDir, "clone", "--bare", repoDir, upstream)
+	runGit(t, repoDir, "remote", "add", "origin", upstream)
+	runGit(t, repoDir, "fetch", "origin")
+
+	wtDir := d.paths.WorktreeDir("test-repo")
+	wsPath := filepath.Join(wtDir, "default")
+	reviewPath := filepath.Join(wtDir, "review-12")
+	optedOutPath := filepath.Join(wtDir, "lazy-owl")
+	runGit(t, repoDir, "worktree", "add", "-b", "workspace/default", wsPath, "main")
+	runGit(t, repoDir, "worktree", "add", "-b", "review/review-12", reviewPath, "main")
+	runGit(t, repoDir, "worktree", "add", "-b", "work/lazy-owl", optedOutPath, "main")
+
+	// Someone else lands a commit on main
+	other := filepath.Join(t.TempDir(), "other")
+	runGit(t, repoDir, "clone", upstream, other)
+	if err := os.WriteFile(filepath.Join(other, "new.txt"), []byte("new\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, other, "add", "new.txt")
+	runGit(t, other, "-c", "user.name=Other", "-c", "user.email=other@example.com", "commit", "-m", "Upstream change")
+	runGit(t, other, "push", "origin", "main")
+
+	// The user has uncommitted work in the workspace
+	if err := os.WriteFile(filepath.Join(wsPath, "notes.txt"), []byte("wip\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	repo := &state.Repository{
+		GithubURL:   "https://github.com/test/repo",
+		TmuxSession: "test-session",
+		Agents: map[string]state.Agent{
+			"supervisor":  {Type: state.AgentTypeSupervisor, WorktreePath: repoDir, TmuxWindow: "supervisor", CreatedAt: now},
+			"merge-queue": {Type: state.AgentTypeMergeQueue, WorktreePath: repoDir, TmuxWindow: "merge-queue", CreatedAt: now},
+			"default":     {Type: state.AgentTypeWorkspace, WorktreePath: wsPath, TmuxWindow: "default", CreatedAt: now},
+			"review-12":   {Type: state.AgentTypeReview, WorktreePath: reviewPath, TmuxWindow: "review-12", CreatedAt: now},
+			"lazy-owl":    {Type: state.AgentTypeWorker, WorktreePath: optedOutPath, TmuxWindow: "lazy-owl", CreatedAt: now},
+		},
+	}
+	if err := d.state.AddRepo("test-repo", repo); err != nil {
+		t.Fatalf("Failed to add repo: %v", err)
+	}
+	if err := d.state.SetAgentRefreshDisabled("test-repo", "lazy-owl", true); err != nil {
+		t.Fatal(err)
+	}
+
+	results := make(map[string]refreshOutcome)
+	for _, outcome := range d.refreshRepos("test-repo") {
+		results[outcome.agent] = outcome
+	}
+
+	if got := results["merge-queue, supervisor"]; got.result != refreshRebased || got.target != "checkout" || got.commits != 1 {
+		t.Errorf("repo checkout outcome = %+v, want fast-forwarded by 1 commit", got)
+	}
+	if _, err := os.Stat(filepath.Join(repoDir, "new.txt")); err != nil {
+		t.Errorf("repo checkout should have the upstream commit: %v", err)
+	}
+
+	if got := results["default"]; got.result != refreshRebased || !strings.Contains(got.detail, "stashed") {
+		t.Errorf("workspace outcome = %+v, want rebased with stash", got)
+	}
+	if _, err := os.Stat(filepath.Join(wsPath, "notes.txt")); err != nil {
+		t.Errorf("workspace changes should be restored: %v", err)
+	}
+	if msgs, _ := d.getMessageManager().List("test-repo", "default"); len(msgs) != 0 {
+		t.Errorf("workspace got %d messages, want none", len(msgs))
+	}
+
+	if got := results["review-12"]; got.result != refreshRebased {
+		t.Errorf("review outcome = %+v, want rebased", got)
+	}
+	if got := results["lazy-owl"]; got.result != refreshSkipped || got.detail != "refresh disabled" {
+		t.Errorf("opted-out worker outcome = %+v, want skipped", got)
+	}
+	if _, err := os.Stat(filepath.Join(optedOutPath, "new.txt")); err == nil {
+		t.Error("opted-out worker's worktree should not be refreshed")
+	}
+
+	// Opting out a persistent agent leaves the shared checkout alone
+	if err := d.state.SetAgentRefreshDisabled("test-repo", "supervisor", true); err != nil {
+		t.Fatal(err)
+	}
+	for _, outcome := range d.refreshRepos("test-repo") {
+		if outcome.target == "checkout" && (outcome.result != refreshSkipped || !strings.Contains(outcome.detail, "supervisor")) {
+			t.Errorf("repo checkout outcome = %+v, want skipped for supervisor", outcome)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/dlorenc/multiclaude/internal/state"
+)
+
+// resumeStableAfter is how long a resumed worker must keep running before its
+// resumes stop counting against the budget, which then only limits crashes in
+// a row
+const resumeStableAfter = 10 * time.Minute
+
+// canResumeWorker reports whether a worker left behind by a crash can be
+// resumed: it runs in tmux, has not finished, and its worktree is still on disk
+func canResumeWorker(agent state.Agent) bool {
+	if agent.Type != state.AgentTypeWorker || agent.Headless || agent.ReadyForCleanup || agent.WorktreePath == "" {
+		return false
+	}
+	_, err := os.Stat(agent.WorktreePath)
+	return err == nil
+}
+
+// resumeCrashedWorker restarts a worker whose Claude process died, using
+// --resume in its existing worktree so the conversation picks up where it left
+// off. Once the worker has used up its resume budget its task is marked failed
+// and the health check cleans it up. Returns false when resuming is disabled or
+// impossible, in which case the caller falls back to its usual handling.
+func (d *Daemon) resumeCrashedWorker(repoName, agentName string, agent state.Agent, repo *state.Repository, reason string) bool {
+	if !canResumeWorker(agent) {
+		return false
+	}
+
+	config, err := d.state.GetWorkerResumeConfig(repoName)
+	if err != nil || config.Disabled {
+		return false
+	}
+
+	msgMgr := d.getMessageManager()
+
+	if agent.ResumeCount >= config.MaxAttempts {
+		agent.FailureReason = fmt.Sprintf("worker crashed (%s) after being resumed %d times", reason, agent.ResumeCount)
+		agent.ReadyForCleanup = true
+		if err := d.state.UpdateAgent(repoName, agentName, agent); err != nil {
+			d.logger.Error("Failed to mark worker %s/%s as failed: %v", repoName, agentName, err)
+			return false
+		}
+		d.logger.Warn("Worker %s/%s crashed again after %d resumes, marking its task failed", repoName, agentName, agent.ResumeCount)
+		msg := fmt.Sprintf("Worker '%s' crashed again (%s) after being resumed %d times and has been marked failed. Task: %s", agentName, reason, agent.ResumeCount, agent.Task)
+		if _, err := msgMgr.Send(repoName, "daemon", "supervisor", msg); err != nil {
+			d.logger.Debug("Could not notify supervisor about failed worker %s: %v", agentName, err)
+		}
+		return true
+	}
+
+	// Count the attempt up front so a resume that fails still uses up budget
+	count, err := d.state.RecordAgentResume(repoName, agentName)
+	if err != nil {
+		d.logger.Error("Failed to record resume of worker %s/%s: %v", repoName, agentName, err)
+		return false
+	}
+
+	if err := d.ensureWorkerWindow(repoName, agentName, agent, repo); err != nil {
+		d.logger.Error("Failed to recreate window for worker %s/%s: %v", repoName, agentName, err)
+		return true
+	}
+
+	if err := d.restartAgent(repoName, agentName, agent, repo); err != nil {
+		d.logger.Error("Failed to resume worker %s/%s (attempt %d of %d): %v", repoName, agentName, count, config.MaxAttempts, err)
+		return true
+	}
+
+	d.logger.Info("Resumed worker %s/%s after %s (attempt %d of %d)", repoName, agentName, reason, count, config.MaxAttempts)
+
+	// Remind the worker of its task; a resumed session may be sitting at an empty prompt
+	reminder := fmt.Sprintf("You were restarted after your session was interrupted (%s). Check the state of your worktree and continue your task: %s", reason, agent.Task)
+	if _, err := msgMgr.Send(repoName, "daemon", agentName, reminder); err != nil {
+		d.logger.Debug("Could not send resume reminder to %s: %v", agentName, err)
+	}
+	msg := fmt.Sprintf("Worker '%s' crashed (%s) and was resumed in its worktree (resume %d of %d).", agentName, reason, count, config.MaxAttempts)
+	if _, err := msgMgr.Send(repoName, "daemon", "supervisor", msg); err != nil {
+		d.logger.Debug("Could not notify supervisor about resumed worker %s: %v", agentName, err)
+	}
+	d.requestMessageRouting()
+	return true
+}
+
+// ensureWorkerWindow recreates a worker's tmux window in its worktree when the
+// window is gone (e.g., the tmux server did not survive a restart)
+func (d *Daemon) ensureWorkerWindow(repoName, agentName string, agent state.Agent, repo *state.Repository) error {
+	hasWindow, err := d.tmux.HasWindow(d.ctx, repo.TmuxSession, agent.TmuxWindow)
+	if err != nil {
+		return err
+	}
+	if hasWindow {
+		return nil
+	}
+
+	cmd := exec.Command("tmux", "new-window", "-d", "-t", repo.TmuxSession, "-n", agentName, "-c", agent.WorktreePath)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to create tmux window: %w", err)
+	}
+
+	if current, exists := d.state.GetAgent(repoName, agentName); exists && current.TmuxWindow != agentName {
+		current.TmuxWindow = agentName
+		if err := d.state.UpdateAgent(repoName, agentName, current); err != nil {
+			d.logger.Warn("Failed to update window for worker %s: %v", agentName, err)
+		}
+	}
+
+	// Capture output like a freshly created worker
+	logFile := d.paths.AgentLogFile(repoName, agentName, true)
+	if err := os.MkdirAll(filepath.Dir(logFile), 0755); err == nil {
+		if err := d.tmux.StartPipePane(d.ctx, repo.TmuxSession, agentName, logFile); err != nil {
+			d.logger.Warn("Failed to set up output capture for %s: %v", agentName, err)
+		}
+	}
+	return nil
+}
+
+// resetStableResumes clears the resume count of a worker that an activity
+// check found alive long enough after its last resume
+func (d *Daemon) resetStableResumes(repoName, agentName string, agent state.Agent, activity state.AgentActivity) {
+	if agent.ResumeCount == 0 || time.Since(agent.LastResumedAt) < resumeStableAfter {
+		return
+	}
+	switch activity {
+	case state.ActivityBusy, state.ActivityIdle, state.ActivityWaitingPermission:
+	default:
+		return
+	}
+
+	if err := d.state.ResetAgentResumes(repoName, agentName); err != nil {
+		d.logger.Debug("Failed to reset resumes of %s/%s: %v", repoName, agentName, err)
+		return
+	}
+	d.logger.Info("Worker %s/%s has run stably since its last resume, resetting its resume count", repoName, agentName)
+}
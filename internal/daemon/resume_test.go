@@ -0,0 +1,164 @@
+package daemon
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dlorenc/multiclaude/internal/state"
+	"github.com/dlorenc/multiclaude/pkg/tmux"
+)
+
+// addCrashedWorker registers a repo with a worker whose process is dead
+func addCrashedWorker(t *testing.T, d *Daemon, tmuxSession string, resumeCount int) state.Agent {
+	t.Helper()
+
+	agent := state.Agent{
+		Type:         state.AgentTypeWorker,
+		WorktreePath: t.TempDir(),
+		TmuxWindow:   "clever-fox",
+		SessionID:    "test-session-id",
+		PID:          99999, // Dead PID
+		Task:         "Add auth",
+		CreatedAt:    time.Now(),
+		ResumeCount:  resumeCount,
+	}
+	repo := &state.Repository{
+		GithubURL:   "https://github.com/test/repo",
+		TmuxSession: tmuxSession,
+		Agents:      map[string]state.Agent{"clever-fox": agent},
+	}
+	if err := d.state.AddRepo("test-repo", repo); err != nil {
+		t.Fatalf("Failed to add repo: %v", err)
+	}
+	return agent
+}
+
+func TestResumeCrashedWorkerDisabled(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	agent := addCrashedWorker(t, d, "mc-test-resume", 0)
+	if err := d.state.UpdateWorkerResumeConfig("test-repo", state.WorkerResumeConfig{Disabled: true}); err != nil {
+		t.Fatalf("UpdateWorkerResumeConfig() failed: %v", err)
+	}
+
+	repo, _ := d.state.GetRepo("test-repo")
+	if d.resumeCrashedWorker("test-repo", "clever-fox", agent, repo, "process exited") {
+		t.Error("resumeCrashedWorker() should not handle workers when resuming is disabled")
+	}
+
+	updated, _ := d.state.GetAgent("test-repo", "clever-fox")
+	if updated.ResumeCount != 0 || updated.ReadyForCleanup {
+		t.Errorf("agent changed while resuming is disabled: %+v", updated)
+	}
+}
+
+func TestResumeCrashedWorkerFailsAfterBudget(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	agent := addCrashedWorker(t, d, "mc-test-resume", state.DefaultWorkerResumeMaxAttempts)
+
+	repo, _ := d.state.GetRepo("test-repo")
+	if !d.resumeCrashedWorker("test-repo", "clever-fox", agent, repo, "process exited") {
+		t.Fatal("resumeCrashedWorker() should handle a worker that used up its budget")
+	}
+
+	updated, _ := d.state.GetAgent("test-repo", "clever-fox")
+	if !updated.ReadyForCleanup || !strings.Contains(updated.FailureReason, "resumed 3 times") {
+		t.Errorf("worker should be marked failed, got %+v", updated)
+	}
+	if updated.ResumeCount != state.DefaultWorkerResumeMaxAttempts {
+		t.Errorf("ResumeCount = %d, want it unchanged", updated.ResumeCount)
+	}
+
+	msgs, _ := d.getMessageManager().List("test-repo", "supervisor")
+	if len(msgs) != 1 || !strings.Contains(msgs[0].Body, "marked failed") {
+		t.Errorf("supervisor messages = %+v, want one failure notice", msgs)
+	}
+
+	// Cleanup records the task as failed
+	d.cleanupDeadAgents(map[string][]string{"test-repo": {"clever-fox"}})
+	history, _ := d.state.GetTaskHistory("test-repo", 0)
+	if len(history) != 1 || history[0].Status != state.TaskStatusFailed {
+		t.Errorf("history = %+v, want one failed task", history)
+	}
+}
+
+func TestResumeCrashedWorkerRecreatesWindow(t *testing.T) {
+	tmuxClient := tmux.NewClient()
+	if !tmuxClient.IsTmuxAvailable() {
+		t.Fatal("tmux is required for this test but not available")
+	}
+
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	sessionName := "mc-test-resume-worker"
+	if err := tmuxClient.CreateSession(context.Background(), sessionName, true); err != nil {
+		t.Fatalf("tmux is required for this test but cannot create sessions in this environment: %v", err)
+	}
+	defer tmuxClient.KillSession(context.Background(), sessionName)
+
+	agent := addCrashedWorker(t, d, sessionName, 0)
+
+	repo, _ := d.state.GetRepo("test-repo")
+	if !d.resumeCrashedWorker("test-repo", "clever-fox", agent, repo, "tmux session was lost") {
+		t.Fatal("resumeCrashedWorker() should resume the worker")
+	}
+
+	hasWindow, err := tmuxClient.HasWindow(context.Background(), sessionName, "clever-fox")
+	if err != nil || !hasWindow {
+		t.Errorf("worker window should be recreated (err: %v)", err)
+	}
+
+	updated, _ := d.state.GetAgent("test-repo", "clever-fox")
+	if updated.ResumeCount != 1 || updated.LastResumedAt.IsZero() {
+		t.Errorf("resume not recorded: count=%d at=%v", updated.ResumeCount, updated.LastResumedAt)
+	}
+	if updated.PID == 99999 {
+		t.Error("PID should be updated after the restart")
+	}
+	if updated.ReadyForCleanup {
+		t.Error("resumed worker should not be marked for cleanup")
+	}
+
+	reminders, _ := d.getMessageManager().List("test-repo", "clever-fox")
+	if len(reminders) != 1 || !strings.Contains(reminders[0].Body, "Add auth") {
+		t.Errorf("worker should be reminded of its task, got %+v", reminders)
+	}
+	notices, _ := d.getMessageManager().List("test-repo", "supervisor")
+	if len(notices) != 1 || !strings.Contains(notices[0].Body, "resume 1 of 3") {
+		t.Errorf("supervisor messages = %+v, want one resume notice", notices)
+	}
+}
+
+func TestResetStableResumes(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	agent := addCrashedWorker(t, d, "mc-test-repo", 2)
+	agent.LastResumedAt = time.Now()
+	if err := d.state.UpdateAgent("test-repo", "clever-fox", agent); err != nil {
+		t.Fatal(err)
+	}
+
+	// Alive right after a resume doesn't count as stable yet
+	d.resetStableResumes("test-repo", "clever-fox", agent, state.ActivityBusy)
+	if got, _ := d.state.GetAgent("test-repo", "clever-fox"); got.ResumeCount != 2 {
+		t.Errorf("resume count = %d, want 2 kept right after a resume", got.ResumeCount)
+	}
+
+	agent.LastResumedAt = time.Now().Add(-resumeStableAfter - time.Minute)
+	d.resetStableResumes("test-repo", "clever-fox", agent, state.ActivityCrashed)
+	if got, _ := d.state.GetAgent("test-repo", "clever-fox"); got.ResumeCount != 2 {
+		t.Errorf("resume count = %d, want 2 kept for a crashed worker", got.ResumeCount)
+	}
+
+	d.resetStableResumes("test-repo", "clever-fox", agent, state.ActivityIdle)
+	if got, _ := d.state.GetAgent("test-repo", "clever-fox"); got.ResumeCount != 0 {
+		t.Errorf("resume count = %d, want it reset once the worker ran stably", got.ResumeCount)
+	}
+}
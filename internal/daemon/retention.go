@@ -0,0 +1,158 @@
+package daemon
+
+import (
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/dlorenc/multiclaude/internal/messages"
+	"github.com/dlorenc/multiclaude/internal/socket"
+)
+
+// messageGCInterval is how often message retention is enforced
+const messageGCInterval = time.Hour
+
+// messageGCReport describes what message garbage collection removed, or
+// would remove, in one repository
+type messageGCReport struct {
+	repo     string
+	expired  map[string]int // Delivered messages removed, by mailbox
+	archived map[string]int // Messages in archived mailboxes of agents no longer in state
+}
+
+// messageGCLoop periodically enforces each repository's message retention
+func (d *Daemon) messageGCLoop() {
+	d.periodicLoop("message gc", messageGCInterval, nil, func() {
+		d.collectMessages("", false)
+	})
+}
+
+// collectMessages removes delivered messages beyond each repository's
+// retention limits and archives the mailboxes of agents that are no longer
+// in state, such as workers cleaned up before their mailbox was archived.
+// With dryRun nothing is changed and the report says what would be.
+func (d *Daemon) collectMessages(repoFilter string, dryRun bool) []messageGCReport {
+	msgMgr := d.getMessageManager()
+	now := time.Now()
+
+	repoNames := d.state.ListRepos()
+	sort.Strings(repoNames)
+
+	var reports []messageGCReport
+	for _, repoName := range repoNames {
+		if repoFilter != "" && repoName != repoFilter {
+			continue
+		}
+		config, err := d.state.GetMessageRetentionConfig(repoName)
+		if err != nil {
+			continue
+		}
+		policy := messages.RetentionPolicy{
+			MaxAge:      time.Duration(config.MaxAgeDays) * 24 * time.Hour,
+			MaxPerAgent: config.MaxPerAgent,
+		}
+
+		agentNames, _ := d.state.ListAgents(repoName)
+		live := make(map[string]bool, len(agentNames))
+		for _, name := range agentNames {
+			live[name] = true
+		}
+
+		mailboxes, err := msgMgr.Mailboxes(repoName)
+		if err != nil {
+			d.logger.Warn("Failed to list mailboxes for %s: %v", repoName, err)
+			continue
+		}
+
+		report := messageGCReport{repo: repoName, expired: map[string]int{}, archived: map[string]int{}}
+		for _, agentName := range mailboxes {
+			if !live[agentName] {
+				count := 0
+				if dryRun {
+					msgs, _ := msgMgr.List(repoName, agentName)
+					count = len(msgs)
+				} else {
+					archive, n, err := d.archiveMailbox(repoName, agentName)
+					if err != nil {
+						d.logger.Warn("Failed to archive mailbox of %s/%s: %v", repoName, agentName, err)
+						continue
+					}
+					if archive != "" {
+						if _, err := d.state.LinkTaskMessages(repoName, agentName, archive); err != nil {
+							d.logger.Warn("Failed to link archived mailbox of %s/%s: %v", repoName, agentName, err)
+						}
+					}
+					count = n
+				}
+				if count > 0 {
+					report.archived[agentName] = count
+				}
+				continue
+			}
+
+			expired, err := msgMgr.Expired(repoName, agentName, policy, now)
+			if err != nil {
+				d.logger.Warn("Failed to check messages of %s/%s: %v", repoName, agentName, err)
+				continue
+			}
+			removed := 0
+			for _, msg := range expired {
+				if dryRun {
+					removed++
+				} else if err := msgMgr.Delete(repoName, agentName, msg.ID); err == nil {
+					removed++
+				}
+			}
+			if removed > 0 {
+				report.expired[agentName] = removed
+			}
+		}
+
+		if !dryRun && (len(report.expired) > 0 || len(report.archived) > 0) {
+			d.logger.Info("Message gc for %s: removed %v, archived %v", repoName, report.expired, report.archived)
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// archiveMailbox moves a finished agent's mailbox into the repository's
+// message archive. Returns the archive path ("" if the mailbox was empty) and
+// the number of messages archived.
+func (d *Daemon) archiveMailbox(repoName, agentName string) (string, int, error) {
+	dest := filepath.Join(d.paths.MessageArchiveDir(repoName), agentName+"_"+time.Now().Format("2006-01-02_15-04-05"))
+	count, err := d.getMessageManager().ArchiveMailbox(repoName, agentName, dest)
+	if err != nil || count == 0 {
+		return "", 0, err
+	}
+	return dest, count, nil
+}
+
+// handleGCMessages runs message garbage collection on demand
+func (d *Daemon) handleGCMessages(req socket.Request) socket.Response {
+	repoFilter := getOptionalStringArg(req.Args, "repo", "")
+	if repoFilter != "" {
+		if _, exists := d.state.GetRepo(repoFilter); !exists {
+			return socket.ErrorResponse("repository %q not found", repoFilter)
+		}
+	}
+	dryRun := getOptionalBoolArg(req.Args, "dry_run", false)
+
+	reports := d.collectMessages(repoFilter, dryRun)
+	result := make([]map[string]interface{}, 0, len(reports))
+	for _, r := range reports {
+		retention, _ := d.state.GetMessageRetentionConfig(r.repo)
+		result = append(result, map[string]interface{}{
+			"repo":          r.repo,
+			"expired":       r.expired,
+			"archived":      r.archived,
+			"archive_dir":   d.paths.MessageArchiveDir(r.repo),
+			"max_age_days":  retention.MaxAgeDays,
+			"max_per_agent": retention.MaxPerAgent,
+		})
+	}
+	return socket.SuccessResponse(map[string]interface{}{
+		"dry_run": dryRun,
+		"repos":   result,
+	})
+}
@@ -0,0 +1,150 @@
+package daemon
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dlorenc/multiclaude/internal/messages"
+	"github.com/dlorenc/multiclaude/internal/socket"
+	"github.com/dlorenc/multiclaude/internal/state"
+)
+
+// writeAgedMessage sends a message and backdates it
+func writeAgedMessage(t *testing.T, msgMgr *messages.Manager, messagesDir, to string, age time.Duration, status messages.Status) *messages.Message {
+	t.Helper()
+	msg, err := msgMgr.Send("test-repo", "supervisor", to, "hello")
+	if err != nil {
+		t.Fatalf("Send() failed: %v", err)
+	}
+	msg.Timestamp = time.Now().Add(-age)
+	msg.Status = status
+	data, _ := json.Marshal(msg)
+	if err := os.WriteFile(filepath.Join(messagesDir, "test-repo", to, msg.ID+".json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestCollectMessages(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	repo := &state.Repository{
+		GithubURL:   "https://github.com/test/repo",
+		TmuxSession: "mc-test",
+		Agents: map[string]state.Agent{
+			"supervisor": {Type: state.AgentTypeSupervisor},
+		},
+		TaskHistory: []state.TaskHistoryEntry{{Name: "old-owl", Task: "Old work", Status: state.TaskStatusMerged}},
+	}
+	if err := d.state.AddRepo("test-repo", repo); err != nil {
+		t.Fatalf("Failed to add repo: %v", err)
+	}
+
+	msgMgr := messages.NewManager(d.paths.MessagesDir)
+	stale := writeAgedMessage(t, msgMgr, d.paths.MessagesDir, "supervisor", 10*24*time.Hour, messages.StatusAcked)
+	waiting := writeAgedMessage(t, msgMgr, d.paths.MessagesDir, "supervisor", 10*24*time.Hour, messages.StatusPending)
+	recent := writeAgedMessage(t, msgMgr, d.paths.MessagesDir, "supervisor", time.Hour, messages.StatusDelivered)
+	writeAgedMessage(t, msgMgr, d.paths.MessagesDir, "old-owl", time.Hour, messages.StatusAcked)
+
+	// A dry run reports without changing anything
+	resp := d.handleRequest(socket.Request{Command: "gc_messages", Args: map[string]interface{}{"dry_run": true}})
+	if !resp.Success {
+		t.Fatalf("gc_messages failed: %s", resp.Error)
+	}
+	if _, err := msgMgr.Get("test-repo", "supervisor", stale.ID); err != nil {
+		t.Error("dry run removed a message")
+	}
+	reports := d.collectMessages("test-repo", true)
+	if len(reports) != 1 || reports[0].expired["supervisor"] != 1 || reports[0].archived["old-owl"] != 1 {
+		t.Fatalf("dry run report = %+v", reports)
+	}
+
+	d.collectMessages("", false)
+
+	if _, err := msgMgr.Get("test-repo", "supervisor", stale.ID); err == nil {
+		t.Error("message past the age limit should be removed")
+	}
+	for _, msg := range []*messages.Message{waiting, recent} {
+		if _, err := msgMgr.Get("test-repo", "supervisor", msg.ID); err != nil {
+			t.Errorf("message %s (%s) should be kept", msg.ID, msg.Status)
+		}
+	}
+
+	// The orphaned mailbox is archived and linked from the task that owned it
+	if mailboxes, _ := msgMgr.Mailboxes("test-repo"); len(mailboxes) != 1 {
+		t.Errorf("mailboxes = %v, want only supervisor", mailboxes)
+	}
+	history, _ := d.state.GetTaskHistory("test-repo", 0)
+	if len(history) != 1 || history[0].Messages == "" {
+		t.Fatalf("task history = %+v, want the archive linked", history)
+	}
+	if entries, err := os.ReadDir(history[0].Messages); err != nil || len(entries) != 1 {
+		t.Errorf("archive %s = %v, %v", history[0].Messages, entries, err)
+	}
+}
+
+func TestCollectMessagesCountLimit(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	repo := &state.Repository{
+		GithubURL:   "https://github.com/test/repo",
+		TmuxSession: "mc-test",
+		Agents:      map[string]state.Agent{"supervisor": {Type: state.AgentTypeSupervisor}},
+	}
+	if err := d.state.AddRepo("test-repo", repo); err != nil {
+		t.Fatalf("Failed to add repo: %v", err)
+	}
+	if err := d.state.UpdateMessageRetentionConfig("test-repo", state.MessageRetentionConfig{MaxPerAgent: 2}); err != nil {
+		t.Fatalf("UpdateMessageRetentionConfig() failed: %v", err)
+	}
+
+	msgMgr := messages.NewManager(d.paths.MessagesDir)
+	oldest := writeAgedMessage(t, msgMgr, d.paths.MessagesDir, "supervisor", 3*time.Hour, messages.StatusAcked)
+	writeAgedMessage(t, msgMgr, d.paths.MessagesDir, "supervisor", 2*time.Hour, messages.StatusRead)
+	writeAgedMessage(t, msgMgr, d.paths.MessagesDir, "supervisor", time.Hour, messages.StatusAcked)
+
+	reports := d.collectMessages("test-repo", false)
+	if len(reports) != 1 || reports[0].expired["supervisor"] != 1 {
+		t.Fatalf("report = %+v", reports)
+	}
+	if _, err := msgMgr.Get("test-repo", "supervisor", oldest.ID); err == nil {
+		t.Error("oldest message beyond the count limit should be removed")
+	}
+}
+
+func TestRecordTaskHistoryArchivesMailbox(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	repo := &state.Repository{
+		GithubURL:   "https://github.com/test/repo",
+		TmuxSession: "mc-test",
+		Agents:      make(map[string]state.Agent),
+	}
+	if err := d.state.AddRepo("test-repo", repo); err != nil {
+		t.Fatalf("Failed to add repo: %v", err)
+	}
+
+	msgMgr := messages.NewManager(d.paths.MessagesDir)
+	if _, err := msgMgr.Send("test-repo", "supervisor", "clever-fox", "Rebase please"); err != nil {
+		t.Fatalf("Send() failed: %v", err)
+	}
+
+	d.recordTaskHistory("test-repo", "clever-fox", state.Agent{Type: state.AgentTypeWorker, Task: "Fix bug"})
+
+	history, _ := d.state.GetTaskHistory("test-repo", 10)
+	if len(history) != 1 || history[0].Messages == "" {
+		t.Fatalf("task history = %+v, want the mailbox archive linked", history)
+	}
+	if msgs, _ := msgMgr.List("test-repo", "clever-fox"); len(msgs) != 0 {
+		t.Errorf("mailbox still has %d message(s) after archiving", len(msgs))
+	}
+	if entries, err := os.ReadDir(history[0].Messages); err != nil || len(entries) != 1 {
+		t.Errorf("archive %s = %v, %v", history[0].Messages, entries, err)
+	}
+}
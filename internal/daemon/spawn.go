@@ -0,0 +1,634 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dlorenc/multiclaude/internal/events"
+	"github.com/dlorenc/multiclaude/internal/hooks"
+	"github.com/dlorenc/multiclaude/internal/socket"
+	"github.com/dlorenc/multiclaude/internal/state"
+	"github.com/dlorenc/multiclaude/internal/worktree"
+)
+
+// spawnSpec describes an agent for spawnAgent
+type spawnSpec struct {
+	repo      string
+	name      string
+	agentType state.AgentType
+
+	// branch is checked out in a worktree of the agent's own, created from
+	// startPoint. Without a branch the agent works in the repository checkout.
+	branch     string
+	startPoint string
+	// existingBranch allows branch to exist already, in which case it is
+	// checked out as is, or moved to startPoint when resetBranch is set
+	existingBranch bool
+	resetBranch    bool
+
+	prompt         string             // System prompt
+	initialMessage string             // Optional first message once Claude is up (e.g., the task)
+	task           string             // Recorded on the agent
+	dependsOn      []string           // Recorded on the agent
+	profile        state.AgentProfile // Model, tools, and permissions; stored on the agent for restarts
+	headless       bool               // Run Claude headless on initialMessage instead of in a tmux window
+}
+
+// spawnRecord is the journal entry of a spawn in flight. Each resource is
+// recorded before it is created, so whatever a crash leaves behind is known.
+// The prompt file is the exception: it is recorded once it is known to be a
+// new version, since a version an earlier agent of the same name was started
+// with must not be rolled back.
+type spawnRecord struct {
+	Repo        string          `json:"repo"`
+	Agent       string          `json:"agent"`
+	Type        state.AgentType `json:"type"`
+	StartedAt   time.Time       `json:"started_at"`
+	Worktree    string          `json:"worktree,omitempty"`     // Worktree created for the agent
+	Branch      string          `json:"branch,omitempty"`       // Branch created for the agent
+	PromptFile  string          `json:"prompt_file,omitempty"`  // Prompt file written for the agent
+	TmuxSession string          `json:"tmux_session,omitempty"` // Session of the agent's window
+	TmuxWindow  string          `json:"tmux_window,omitempty"`  // Window created for the agent
+}
+
+// spawnJournal keeps the spawns in flight in a file, so that the daemon can
+// roll back a spawn it crashed in the middle of
+type spawnJournal struct {
+	mu      sync.Mutex
+	path    string
+	records map[string]spawnRecord // "<repo>/<agent>" -> record
+}
+
+func newSpawnJournal(path string) *spawnJournal {
+	return &spawnJournal{path: path, records: make(map[string]spawnRecord)}
+}
+
+// load reads the journal file, replacing the spawns in memory, and returns
+// the records in the order the spawns started
+func (j *spawnJournal) load() ([]spawnRecord, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.records = make(map[string]spawnRecord)
+	data, err := os.ReadFile(j.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spawn journal: %w", err)
+	}
+
+	var records []spawnRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to parse spawn journal: %w", err)
+	}
+	for _, record := range records {
+		j.records[record.Repo+"/"+record.Agent] = record
+	}
+	return records, nil
+}
+
+// begin records a new spawn. It fails if the agent is already being spawned.
+func (j *spawnJournal) begin(record spawnRecord) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	key := record.Repo + "/" + record.Agent
+	if _, exists := j.records[key]; exists {
+		return fmt.Errorf("agent %q is already being spawned in repository %q", record.Agent, record.Repo)
+	}
+	j.records[key] = record
+	return j.saveUnlocked()
+}
+
+// update records the resources of a spawn in flight
+func (j *spawnJournal) update(record spawnRecord) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.records[record.Repo+"/"+record.Agent] = record
+	return j.saveUnlocked()
+}
+
+// finish removes a spawn that completed or was rolled back
+func (j *spawnJournal) finish(repoName, agentName string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	delete(j.records, repoName+"/"+agentName)
+	return j.saveUnlocked()
+}
+
+// saveUnlocked writes the journal atomically, or removes it when no spawn is
+// in flight. Caller must hold mu.
+func (j *spawnJournal) saveUnlocked() error {
+	if len(j.records) == 0 {
+		if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove spawn journal: %w", err)
+		}
+		return nil
+	}
+
+	records := make([]spawnRecord, 0, len(j.records))
+	for _, record := range j.records {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(a, b int) bool {
+		return records[a].StartedAt.Before(records[b].StartedAt)
+	})
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal spawn journal: %w", err)
+	}
+	tmpPath := j.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write spawn journal: %w", err)
+	}
+	if err := os.Rename(tmpPath, j.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write spawn journal: %w", err)
+	}
+	return nil
+}
+
+// spawnAgent creates an agent from start to finish: its worktree, hooks,
+// prompt, tmux window (unless it runs headless), Claude, and registration with
+// state. This is the one place agents are spawned, whether the CLI asks for
+// them or the daemon starts them on its own. When a step fails, everything the earlier steps created is
+// removed again. Each step is journaled before it runs, so a spawn cut short
+// by a daemon crash is rolled back by recoverSpawns on the next start.
+func (d *Daemon) spawnAgent(spec spawnSpec) (state.Agent, error) {
+	repo, exists := d.state.GetRepo(spec.repo)
+	if !exists {
+		return state.Agent{}, fmt.Errorf("repository %q not found", spec.repo)
+	}
+	if _, exists := repo.Agents[spec.name]; exists {
+		return state.Agent{}, fmt.Errorf("agent %q already exists in repository %q", spec.name, spec.repo)
+	}
+
+	record := spawnRecord{Repo: spec.repo, Agent: spec.name, Type: spec.agentType, StartedAt: time.Now()}
+	if err := d.spawns.begin(record); err != nil {
+		return state.Agent{}, err
+	}
+
+	agent, err := d.runSpawn(spec, repo, &record)
+	if err != nil {
+		d.logger.Warn("Spawning %s/%s failed, rolling back: %v", spec.repo, spec.name, err)
+		d.rollbackSpawn(record)
+	}
+	if err := d.spawns.finish(spec.repo, spec.name); err != nil {
+		d.logger.Warn("Failed to update spawn journal: %v", err)
+	}
+	return agent, err
+}
+
+// runSpawn runs the steps of a spawn, recording what it creates in record
+func (d *Daemon) runSpawn(spec spawnSpec, repo *state.Repository, record *spawnRecord) (state.Agent, error) {
+	repoPath := d.paths.RepoDir(spec.repo)
+
+	// Worktree; agents without a branch work in the repository checkout
+	workDir := repoPath
+	if spec.branch != "" {
+		workDir = d.paths.AgentWorktree(spec.repo, spec.name)
+		if err := d.createSpawnWorktree(spec, workDir, record); err != nil {
+			return state.Agent{}, err
+		}
+	}
+
+	// Hooks
+	if err := hooks.CopyConfig(repoPath, workDir); err != nil {
+		d.logger.Warn("Failed to copy hooks config: %v", err)
+	}
+
+	// Prompt
+	promptFile, created, err := d.promptStore.Save(spec.repo, spec.name, spec.prompt)
+	if err != nil {
+		return state.Agent{}, err
+	}
+	if created {
+		record.PromptFile = promptFile
+		if err := d.spawns.update(*record); err != nil {
+			return state.Agent{}, err
+		}
+	}
+
+	cfg := agentStartConfig{
+		agentName:      spec.name,
+		agentType:      spec.agentType,
+		promptFile:     promptFile,
+		workDir:        workDir,
+		initialMessage: spec.initialMessage,
+		profile:        spec.profile,
+	}
+
+	// Claude; a headless run has no window and writes its own output log
+	var sessionID, tmuxWindow string
+	var pid int
+	if spec.headless {
+		if sessionID, pid, err = d.startHeadless(spec.repo, cfg); err != nil {
+			return state.Agent{}, err
+		}
+	} else {
+		// Tmux window
+		if err := d.createSpawnWindow(repo.TmuxSession, spec.name, workDir, record); err != nil {
+			return state.Agent{}, err
+		}
+		tmuxWindow = spec.name
+
+		if sessionID, pid, err = d.launchClaude(spec.repo, repo, cfg); err != nil {
+			return state.Agent{}, err
+		}
+
+		// Output capture
+		isWorker := spec.agentType == state.AgentTypeWorker || spec.agentType == state.AgentTypeReview
+		logFile := d.paths.AgentLogFile(spec.repo, spec.name, isWorker)
+		if err := os.MkdirAll(filepath.Dir(logFile), 0755); err == nil {
+			if err := d.tmux.StartPipePane(d.ctx, repo.TmuxSession, spec.name, logFile); err != nil {
+				d.logger.Warn("Failed to set up output capture for %s: %v", spec.name, err)
+			}
+		}
+	}
+
+	// Registration
+	agent := state.Agent{
+		Type:         spec.agentType,
+		WorktreePath: workDir,
+		TmuxWindow:   tmuxWindow,
+		Headless:     spec.headless,
+		SessionID:    sessionID,
+		PID:          pid,
+		Task:         spec.task,
+		DependsOn:    spec.dependsOn,
+		CreatedAt:    time.Now(),
+		Profile:      spec.profile,
+		PromptFile:   promptFile,
+	}
+	if err := d.state.AddAgent(spec.repo, spec.name, agent); err != nil {
+		return state.Agent{}, fmt.Errorf("failed to register agent: %w", err)
+	}
+
+	// The agent completes when its headless run ends
+	if spec.headless {
+		d.wg.Add(1)
+		go d.watchHeadless(spec.repo, spec.name)
+	}
+
+	d.logger.Info("Spawned agent %s/%s (type=%s, workdir=%s, headless=%v)", spec.repo, spec.name, spec.agentType, workDir, spec.headless)
+	d.publishEvent(events.AgentSpawned, spec.repo, spec.name, map[string]interface{}{
+		"type": string(spec.agentType),
+	})
+	return agent, nil
+}
+
+// createSpawnWorktree creates the agent's worktree at path. A worktree left at
+// path by an earlier agent of the same name is removed first; a branch that
+// exists already is only ever checked out, never recorded for rollback.
+func (d *Daemon) createSpawnWorktree(spec spawnSpec, path string, record *spawnRecord) error {
+	wt := worktree.NewManager(d.paths.RepoDir(spec.repo))
+
+	if _, err := os.Stat(path); err == nil {
+		d.logger.Warn("Removing stale worktree %s before spawning %s", path, spec.name)
+		if err := wt.Remove(path, true); err != nil {
+			return fmt.Errorf("failed to remove stale worktree %s: %w", path, err)
+		}
+	}
+
+	branchExists, err := wt.BranchExists(spec.branch)
+	if err != nil {
+		return fmt.Errorf("failed to check branch %s: %w", spec.branch, err)
+	}
+	if branchExists && !spec.existingBranch {
+		return fmt.Errorf("failed to create worktree: a branch named '%s' already exists", spec.branch)
+	}
+
+	record.Worktree = path
+	if !branchExists {
+		record.Branch = spec.branch
+	}
+	if err := d.spawns.update(*record); err != nil {
+		return err
+	}
+
+	if branchExists {
+		err = wt.Create(path, spec.branch)
+	} else {
+		err = wt.CreateNewBranch(path, spec.branch, spec.startPoint)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create worktree: %w", err)
+	}
+
+	// A stale local branch is moved to the start point
+	if branchExists && spec.resetBranch && spec.startPoint != spec.branch {
+		if output, err := exec.Command("git", "-C", path, "reset", "--hard", spec.startPoint).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to reset %s to %s: %s", spec.branch, spec.startPoint, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
+
+// createSpawnWindow opens the agent's tmux window in workDir, replacing a
+// stale window of the same name. When the repository's session doesn't exist
+// yet, as for the first agent 'multiclaude init' creates, or is gone, it is
+// created with the agent's window as its first.
+func (d *Daemon) createSpawnWindow(session, name, workDir string, record *spawnRecord) error {
+	hasSession, err := d.tmux.HasSession(d.ctx, session)
+	if err != nil {
+		return fmt.Errorf("failed to check tmux session: %w", err)
+	}
+	if hasSession {
+		if exists, err := d.tmux.HasWindow(d.ctx, session, name); err == nil && exists {
+			d.logger.Warn("Killing stale tmux window %s:%s before spawning %s", session, name, name)
+			if err := d.tmux.KillWindow(d.ctx, session, name); err != nil {
+				return fmt.Errorf("failed to kill stale tmux window: %w", err)
+			}
+		}
+	}
+
+	record.TmuxSession, record.TmuxWindow = session, name
+	if err := d.spawns.update(*record); err != nil {
+		return err
+	}
+
+	args := []string{"new-window", "-d", "-t", session, "-n", name, "-c", workDir}
+	if !hasSession {
+		d.logger.Info("Tmux session %s not found, creating it", session)
+		args = []string{"new-session", "-d", "-s", session, "-n", name, "-c", workDir}
+	}
+	if output, err := exec.Command("tmux", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create tmux window: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// rollbackSpawn removes what a failed spawn created, in reverse order. Every
+// step tolerates resources that were never created, so it is safe to run on a
+// record written just before a crash.
+func (d *Daemon) rollbackSpawn(record spawnRecord) {
+	d.stopHeadless(record.Repo, record.Agent)
+
+	if record.TmuxWindow != "" {
+		if exists, err := d.tmux.HasWindow(d.ctx, record.TmuxSession, record.TmuxWindow); err == nil && exists {
+			if err := d.tmux.KillWindow(d.ctx, record.TmuxSession, record.TmuxWindow); err != nil {
+				d.logger.Warn("Rollback: failed to kill tmux window %s:%s: %v", record.TmuxSession, record.TmuxWindow, err)
+			}
+		}
+	}
+
+	if record.PromptFile != "" {
+		if err := os.Remove(record.PromptFile); err != nil && !os.IsNotExist(err) {
+			d.logger.Warn("Rollback: failed to remove prompt file %s: %v", record.PromptFile, err)
+		}
+	}
+
+	wt := worktree.NewManager(d.paths.RepoDir(record.Repo))
+	if record.Worktree != "" {
+		if _, err := os.Stat(record.Worktree); err == nil {
+			if err := wt.Remove(record.Worktree, true); err != nil {
+				d.logger.Warn("Rollback: failed to remove worktree %s: %v", record.Worktree, err)
+			}
+		}
+		wt.Prune()
+	}
+	if record.Branch != "" {
+		if exists, err := wt.BranchExists(record.Branch); err == nil && exists {
+			if err := wt.DeleteBranch(record.Branch); err != nil {
+				d.logger.Warn("Rollback: failed to delete branch %s: %v", record.Branch, err)
+			}
+		}
+	}
+}
+
+// recoverSpawns rolls back the spawns that were in flight when the daemon
+// last stopped. A spawn that got as far as registering its agent completed and
+// is left alone.
+func (d *Daemon) recoverSpawns() {
+	records, err := d.spawns.load()
+	if err != nil {
+		d.logger.Error("Failed to load spawn journal: %v", err)
+		return
+	}
+
+	for _, record := range records {
+		if _, registered := d.state.GetAgent(record.Repo, record.Agent); registered {
+			d.logger.Info("Spawn of %s/%s completed before the daemon stopped", record.Repo, record.Agent)
+		} else {
+			d.logger.Warn("Rolling back spawn of %s/%s interrupted at %s", record.Repo, record.Agent, record.StartedAt.Format(time.RFC3339))
+			d.rollbackSpawn(record)
+		}
+		if err := d.spawns.finish(record.Repo, record.Agent); err != nil {
+			d.logger.Warn("Failed to update spawn journal: %v", err)
+		}
+	}
+}
+
+// handleCreateAgent spawns an agent of any type but the ad hoc ones of
+// spawn_agent. This is what 'init', 'worker create', 'workspace add', and
+// 'review' ask the daemon for.
+func (d *Daemon) handleCreateAgent(req socket.Request) socket.Response {
+	repoName, errResp, ok := getRequiredStringArg(req.Args, "repo", "repository name is required")
+	if !ok {
+		return errResp
+	}
+
+	agentName, errResp, ok := getRequiredStringArg(req.Args, "name", "agent name is required")
+	if !ok {
+		return errResp
+	}
+	if err := state.ValidateAgentName(agentName); err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
+
+	agentType, errResp, ok := getRequiredStringArg(req.Args, "type", "agent type is required (worker, workspace, review, supervisor, merge-queue, or pr-shepherd)")
+	if !ok {
+		return errResp
+	}
+
+	repo, exists := d.state.GetRepo(repoName)
+	if !exists {
+		return socket.ErrorResponse("repository %q not found", repoName)
+	}
+	if _, exists := repo.Agents[agentName]; exists {
+		return socket.ErrorResponse("agent %q already exists in repository %q", agentName, repoName)
+	}
+
+	var spec spawnSpec
+	var err error
+	switch state.AgentType(agentType) {
+	case state.AgentTypeWorker:
+		spec, err = d.createWorkerSpec(repoName, agentName, req.Args)
+	case state.AgentTypeWorkspace:
+		spec, err = d.workspaceSpec(repoName, agentName, getOptionalStringArg(req.Args, "branch", ""))
+	case state.AgentTypeReview:
+		spec, err = d.reviewSpec(repoName, agentName, req.Args)
+	case state.AgentTypeSupervisor, state.AgentTypeMergeQueue, state.AgentTypePRShepherd:
+		spec, err = d.persistentSpec(repoName, agentName, state.AgentType(agentType))
+	default:
+		return socket.ErrorResponse("invalid agent type %q: must be worker, workspace, review, supervisor, merge-queue, or pr-shepherd", agentType)
+	}
+	if err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
+
+	agent, err := d.spawnRequestedAgent(spec)
+	if err != nil {
+		return socket.ErrorResponse("%s", err.Error())
+	}
+
+	return socket.SuccessResponse(map[string]interface{}{
+		"name":          agentName,
+		"type":          string(agent.Type),
+		"branch":        spec.branch,
+		"worktree_path": agent.WorktreePath,
+		"tmux_session":  repo.TmuxSession,
+		"model":         agent.Profile.Model,
+		"headless":      agent.Headless,
+	})
+}
+
+// spawnRequestedAgent spawns an agent a socket client asked for. A worker
+// first claims a slot, the one 'worker create' reserved or a free one, so no
+// client can go past the repository's worker limit, and no review starts
+// while the repository's daily token budget is used up.
+func (d *Daemon) spawnRequestedAgent(spec spawnSpec) (state.Agent, error) {
+	if spec.agentType == state.AgentTypeReview && d.budgetExhausted(spec.repo) {
+		return state.Agent{}, budgetExhaustedError(spec.repo, time.Now())
+	}
+	if spec.agentType != state.AgentTypeWorker {
+		return d.spawnAgent(spec)
+	}
+	if err := d.claimWorkerSlot(spec.repo, spec.name); err != nil {
+		return state.Agent{}, err
+	}
+
+	var agent state.Agent
+	err := d.spawnWithReservedSlot(spec.repo, spec.name, func() error {
+		var err error
+		agent, err = d.spawnAgent(spec)
+		return err
+	})
+	return agent, err
+}
+
+// createWorkerSpec returns the spec of a worker for create_agent: a new branch
+// from "branch" or the latest main, or with "push_to" that existing PR branch
+func (d *Daemon) createWorkerSpec(repoName, workerName string, args map[string]interface{}) (spawnSpec, error) {
+	task := getOptionalStringArg(args, "task", "")
+	if task == "" {
+		return spawnSpec{}, fmt.Errorf("task description is required")
+	}
+	profile, err := getOptionalProfileArg(args)
+	if err != nil {
+		return spawnSpec{}, err
+	}
+
+	startPoint := getOptionalStringArg(args, "branch", "")
+	pushTo := getOptionalStringArg(args, "push_to", "")
+	if pushTo != "" && startPoint == "" {
+		return spawnSpec{}, fmt.Errorf("push_to requires branch, the remote branch to start from")
+	}
+	if startPoint == "" {
+		startPoint = d.latestMain(repoName)
+	}
+
+	return d.workerSpec(repoName, workerName, task, startPoint, pushTo, profile)
+}
+
+// workspaceSpec returns the spec of a workspace on a new workspace/<name>
+// branch from startPoint, or HEAD
+func (d *Daemon) workspaceSpec(repoName, workspaceName, startPoint string) (spawnSpec, error) {
+	prompt, err := d.agentPrompt(repoName, state.AgentTypeWorkspace, "")
+	if err != nil {
+		return spawnSpec{}, fmt.Errorf("failed to write workspace prompt: %w", err)
+	}
+	if startPoint == "" {
+		startPoint = "HEAD"
+	}
+
+	return spawnSpec{
+		repo:       repoName,
+		name:       workspaceName,
+		agentType:  state.AgentTypeWorkspace,
+		branch:     fmt.Sprintf("workspace/%s", workspaceName),
+		startPoint: startPoint,
+		prompt:     prompt,
+	}, nil
+}
+
+// reviewSpec returns the spec of a review agent for PR "pr". The PR is
+// fetched through GitHub's refs/pull/<number>/head, which works for PRs from
+// forks too, and reviewed on a review/<name> branch. The reviewer agent
+// definition picks the profile and runner.
+func (d *Daemon) reviewSpec(repoName, reviewerName string, args map[string]interface{}) (spawnSpec, error) {
+	pr := getOptionalStringArg(args, "pr", "")
+	if pr == "" {
+		return spawnSpec{}, fmt.Errorf("PR number is required")
+	}
+	if _, err := strconv.Atoi(pr); err != nil {
+		return spawnSpec{}, fmt.Errorf("invalid PR number %q", pr)
+	}
+	prURL := getOptionalStringArg(args, "pr_url", "")
+
+	localRef := fmt.Sprintf("refs/multiclaude/pr-%s", pr)
+	cmd := exec.Command("git", "fetch", "origin", fmt.Sprintf("refs/pull/%s/head:%s", pr, localRef))
+	cmd.Dir = d.paths.RepoDir(repoName)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return spawnSpec{}, fmt.Errorf("failed to fetch PR #%s: %s", pr, strings.TrimSpace(string(output)))
+	}
+
+	prompt, err := d.agentPrompt(repoName, state.AgentTypeReview, "")
+	if err != nil {
+		return spawnSpec{}, fmt.Errorf("failed to write reviewer prompt: %w", err)
+	}
+
+	initialMessage := fmt.Sprintf("Review PR #%s", pr)
+	if prURL != "" {
+		initialMessage += ": " + prURL
+	}
+	def := d.agentDefinition(repoName, "reviewer")
+	return spawnSpec{
+		repo:           repoName,
+		name:           reviewerName,
+		agentType:      state.AgentTypeReview,
+		branch:         fmt.Sprintf("review/%s", reviewerName),
+		startPoint:     localRef,
+		prompt:         prompt,
+		initialMessage: initialMessage,
+		task:           fmt.Sprintf("Review PR #%s", pr),
+		profile:        def.Profile,
+		headless:       d.runsHeadless(repoName, state.AgentTypeReview, def),
+	}, nil
+}
+
+// persistentSpec returns the spec of a supervisor, merge-queue, or pr-shepherd
+// agent. They work in the repository checkout; the merge-queue and
+// pr-shepherd get the PR tracking mode in their prompt and run with the
+// profile from their definition's front matter.
+func (d *Daemon) persistentSpec(repoName, agentName string, agentType state.AgentType) (spawnSpec, error) {
+	spec := spawnSpec{
+		repo:      repoName,
+		name:      agentName,
+		agentType: agentType,
+	}
+
+	var err error
+	if agentType == state.AgentTypeSupervisor {
+		spec.prompt, err = d.agentPrompt(repoName, agentType, "")
+	} else {
+		spec.prompt, err = d.trackingAgentPrompt(repoName, agentType)
+		spec.profile = d.definitionProfile(repoName, string(agentType))
+	}
+	if err != nil {
+		return spawnSpec{}, fmt.Errorf("failed to write %s prompt: %w", agentType, err)
+	}
+	return spec, nil
+}
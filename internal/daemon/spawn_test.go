@@ -0,0 +1,295 @@
+package daemon
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dlorenc/multiclaude/internal/socket"
+	"github.com/dlorenc/multiclaude/internal/state"
+	"github.com/dlorenc/multiclaude/internal/worktree"
+	"github.com/dlorenc/multiclaude/pkg/tmux"
+)
+
+// setupSpawnTest returns a daemon with a git repository registered under a
+// fresh tmux session
+func setupSpawnTest(t *testing.T, sessionName string) (*Daemon, func()) {
+	t.Helper()
+
+	tmuxClient := tmux.NewClient()
+	if !tmuxClient.IsTmuxAvailable() {
+		t.Fatal("tmux is required for this test but not available")
+	}
+
+	d, _, cleanup := setupTestDaemonWithGitRepo(t)
+	d.claudeRunner.ReadyTimeout = 0
+
+	if err := tmuxClient.CreateSession(context.Background(), sessionName, true); err != nil {
+		cleanup()
+		t.Fatalf("tmux is required for this test but cannot create sessions in this environment: %v", err)
+	}
+	if err := d.state.AddRepo("test-repo", &state.Repository{
+		GithubURL:   "https://github.com/test/repo",
+		TmuxSession: sessionName,
+		Agents:      make(map[string]state.Agent),
+	}); err != nil {
+		t.Fatalf("Failed to add repo: %v", err)
+	}
+
+	return d, func() {
+		tmuxClient.KillSession(context.Background(), sessionName)
+		cleanup()
+	}
+}
+
+func TestSpawnAgentRollsBackOnFailure(t *testing.T) {
+	t.Setenv("MULTICLAUDE_TEST_MODE", "1")
+	d, cleanup := setupSpawnTest(t, "mc-test-spawn-rollback")
+	defer cleanup()
+
+	// An invalid permission mode fails the launch, after the worktree,
+	// prompt file, and window were created
+	_, err := d.spawnAgent(spawnSpec{
+		repo:       "test-repo",
+		name:       "clever-fox",
+		agentType:  state.AgentTypeWorker,
+		branch:     "work/clever-fox",
+		startPoint: "HEAD",
+		prompt:     "You are a worker.",
+		profile:    state.AgentProfile{PermissionMode: "bogus"},
+	})
+	if err == nil {
+		t.Fatal("spawnAgent() should fail with an invalid permission mode")
+	}
+
+	if _, exists := d.state.GetAgent("test-repo", "clever-fox"); exists {
+		t.Error("agent should not be registered")
+	}
+	if _, err := os.Stat(d.paths.AgentWorktree("test-repo", "clever-fox")); !os.IsNotExist(err) {
+		t.Error("worktree should be removed")
+	}
+	wt := worktree.NewManager(d.paths.RepoDir("test-repo"))
+	if exists, _ := wt.BranchExists("work/clever-fox"); exists {
+		t.Error("branch should be deleted")
+	}
+	if versions, _ := d.promptStore.Versions("test-repo", "clever-fox"); len(versions) != 0 {
+		t.Errorf("prompt versions = %+v, want the new prompt removed", versions)
+	}
+	if exists, _ := d.tmux.HasWindow(context.Background(), "mc-test-spawn-rollback", "clever-fox"); exists {
+		t.Error("tmux window should be killed")
+	}
+	if _, err := os.Stat(d.paths.SpawnJournalFile()); !os.IsNotExist(err) {
+		t.Error("spawn journal should be removed once no spawn is in flight")
+	}
+}
+
+func TestSpawnAgentKeepsExistingBranch(t *testing.T) {
+	t.Setenv("MULTICLAUDE_TEST_MODE", "1")
+	d, cleanup := setupSpawnTest(t, "mc-test-spawn-branch")
+	defer cleanup()
+
+	if output, err := exec.Command("git", "-C", d.paths.RepoDir("test-repo"), "branch", "fix/login").CombinedOutput(); err != nil {
+		t.Fatalf("Failed to create branch: %v\n%s", err, output)
+	}
+
+	spec := spawnSpec{
+		repo:       "test-repo",
+		name:       "clever-fox",
+		agentType:  state.AgentTypeWorker,
+		branch:     "fix/login",
+		startPoint: "HEAD",
+		profile:    state.AgentProfile{PermissionMode: "bogus"},
+	}
+	if _, err := d.spawnAgent(spec); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("spawnAgent() = %v, want the existing branch refused", err)
+	}
+
+	spec.existingBranch = true
+	if _, err := d.spawnAgent(spec); err == nil {
+		t.Fatal("spawnAgent() should fail with an invalid permission mode")
+	}
+	wt := worktree.NewManager(d.paths.RepoDir("test-repo"))
+	if exists, _ := wt.BranchExists("fix/login"); !exists {
+		t.Error("rollback must not delete a branch it did not create")
+	}
+}
+
+func TestRecoverSpawns(t *testing.T) {
+	d, cleanup := setupSpawnTest(t, "mc-test-spawn-recover")
+	defer cleanup()
+
+	// What a daemon that crashed in the middle of a spawn leaves behind
+	worktreePath := d.paths.AgentWorktree("test-repo", "clever-fox")
+	wt := worktree.NewManager(d.paths.RepoDir("test-repo"))
+	if err := wt.CreateNewBranch(worktreePath, "work/clever-fox", "HEAD"); err != nil {
+		t.Fatalf("Failed to create worktree: %v", err)
+	}
+	promptFile, err := d.savePromptFile("test-repo", "clever-fox", "You are a worker.")
+	if err != nil {
+		t.Fatalf("Failed to write prompt file: %v", err)
+	}
+	crashed := spawnRecord{
+		Repo:       "test-repo",
+		Agent:      "clever-fox",
+		Type:       state.AgentTypeWorker,
+		StartedAt:  time.Now(),
+		Worktree:   worktreePath,
+		Branch:     "work/clever-fox",
+		PromptFile: promptFile,
+	}
+	if err := d.spawns.begin(crashed); err != nil {
+		t.Fatalf("begin() failed: %v", err)
+	}
+
+	// A spawn that registered its agent before the crash
+	if err := d.state.AddAgent("test-repo", "happy-owl", state.Agent{
+		Type:         state.AgentTypeWorker,
+		WorktreePath: d.paths.RepoDir("test-repo"),
+		TmuxWindow:   "happy-owl",
+		CreatedAt:    time.Now(),
+	}); err != nil {
+		t.Fatalf("Failed to add agent: %v", err)
+	}
+	if err := d.spawns.begin(spawnRecord{Repo: "test-repo", Agent: "happy-owl", StartedAt: time.Now()}); err != nil {
+		t.Fatalf("begin() failed: %v", err)
+	}
+
+	// A new daemon reads the journal from disk
+	d.spawns = newSpawnJournal(d.paths.SpawnJournalFile())
+	d.recoverSpawns()
+
+	if _, err := os.Stat(worktreePath); !os.IsNotExist(err) {
+		t.Error("interrupted spawn's worktree should be removed")
+	}
+	if exists, _ := wt.BranchExists("work/clever-fox"); exists {
+		t.Error("interrupted spawn's branch should be deleted")
+	}
+	if _, err := os.Stat(promptFile); !os.IsNotExist(err) {
+		t.Error("interrupted spawn's prompt file should be removed")
+	}
+	if _, exists := d.state.GetAgent("test-repo", "happy-owl"); !exists {
+		t.Error("completed spawn should be left alone")
+	}
+	if _, err := os.Stat(d.paths.SpawnJournalFile()); !os.IsNotExist(err) {
+		t.Error("spawn journal should be empty after recovery")
+	}
+}
+
+func TestSpawnJournalRejectsConcurrentSpawn(t *testing.T) {
+	journal := newSpawnJournal(filepath.Join(t.TempDir(), "spawns.json"))
+
+	record := spawnRecord{Repo: "test-repo", Agent: "clever-fox", StartedAt: time.Now()}
+	if err := journal.begin(record); err != nil {
+		t.Fatalf("begin() failed: %v", err)
+	}
+	if err := journal.begin(record); err == nil {
+		t.Error("begin() should refuse an agent that is already being spawned")
+	}
+	if err := journal.finish("test-repo", "clever-fox"); err != nil {
+		t.Fatalf("finish() failed: %v", err)
+	}
+	if err := journal.begin(record); err != nil {
+		t.Errorf("begin() after finish() failed: %v", err)
+	}
+}
+
+func TestHandleCreateAgent(t *testing.T) {
+	t.Setenv("MULTICLAUDE_TEST_MODE", "1")
+	d, cleanup := setupSpawnTest(t, "mc-test-create-agent")
+	defer cleanup()
+
+	resp := d.handleRequest(socket.Request{
+		Command: "create_agent",
+		Args: map[string]interface{}{
+			"repo": "test-repo",
+			"name": "clever-fox",
+			"type": "worker",
+			"task": "Add auth",
+		},
+	})
+	if !resp.Success {
+		t.Fatalf("create_agent failed: %s", resp.Error)
+	}
+
+	agent, exists := d.state.GetAgent("test-repo", "clever-fox")
+	if !exists {
+		t.Fatal("worker should be registered")
+	}
+	if agent.Task != "Add auth" || agent.Type != state.AgentTypeWorker {
+		t.Errorf("agent = %+v", agent)
+	}
+	if agent.WorktreePath != d.paths.AgentWorktree("test-repo", "clever-fox") {
+		t.Errorf("worktree = %s, want the worker's own", agent.WorktreePath)
+	}
+	wt := worktree.NewManager(d.paths.RepoDir("test-repo"))
+	if exists, _ := wt.BranchExists("work/clever-fox"); !exists {
+		t.Error("worker branch should be created")
+	}
+
+	tests := []struct {
+		name string
+		args map[string]interface{}
+	}{
+		{"existing agent", map[string]interface{}{"repo": "test-repo", "name": "clever-fox", "type": "worker", "task": "Again"}},
+		{"invalid type", map[string]interface{}{"repo": "test-repo", "name": "happy-owl", "type": "robot"}},
+		{"worker without task", map[string]interface{}{"repo": "test-repo", "name": "happy-owl", "type": "worker"}},
+		{"push_to without branch", map[string]interface{}{"repo": "test-repo", "name": "happy-owl", "type": "worker", "task": "Fix", "push_to": "fix/login"}},
+		{"review without PR", map[string]interface{}{"repo": "test-repo", "name": "happy-owl", "type": "review"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := d.handleRequest(socket.Request{Command: "create_agent", Args: tt.args})
+			if resp.Success {
+				t.Error("create_agent should fail")
+			}
+		})
+	}
+}
+
+func TestHandleCreateAgentCreatesSession(t *testing.T) {
+	t.Setenv("MULTICLAUDE_TEST_MODE", "1")
+	d, cleanup := setupSpawnTest(t, "mc-test-create-session")
+	defer cleanup()
+
+	// 'multiclaude init' registers the repository before its session exists
+	if err := d.tmux.KillSession(context.Background(), "mc-test-create-session"); err != nil {
+		t.Fatalf("Failed to kill session: %v", err)
+	}
+
+	resp := d.handleRequest(socket.Request{
+		Command: "create_agent",
+		Args:    map[string]interface{}{"repo": "test-repo", "name": "supervisor", "type": "supervisor"},
+	})
+	if !resp.Success {
+		t.Fatalf("create_agent failed: %s", resp.Error)
+	}
+
+	agent, exists := d.state.GetAgent("test-repo", "supervisor")
+	if !exists || agent.Type != state.AgentTypeSupervisor {
+		t.Fatalf("supervisor = %+v (found %v)", agent, exists)
+	}
+	if agent.WorktreePath != d.paths.RepoDir("test-repo") {
+		t.Errorf("worktree = %s, want the repository checkout", agent.WorktreePath)
+	}
+	windows, err := d.tmux.ListWindows(context.Background(), "mc-test-create-session")
+	if err != nil || len(windows) != 1 || windows[0] != "supervisor" {
+		t.Errorf("windows = %v, %v, want the session created with the supervisor's window only", windows, err)
+	}
+
+	resp = d.handleRequest(socket.Request{
+		Command: "launch_args",
+		Args:    map[string]interface{}{"repo": "test-repo", "agent": "supervisor"},
+	})
+	if !resp.Success {
+		t.Fatalf("launch_args failed: %s", resp.Error)
+	}
+	args, _ := resp.Data.(map[string]interface{})["args"].([]string)
+	if !slices.Equal(args, []string{"--dangerously-skip-permissions", "--append-system-prompt-file", agent.PromptFile}) {
+		t.Errorf("launch_args = %v", args)
+	}
+}
@@ -0,0 +1,252 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/dlorenc/multiclaude/internal/socket"
+	"github.com/dlorenc/multiclaude/internal/state"
+	"github.com/dlorenc/multiclaude/internal/usage"
+)
+
+// usageSource is one Claude session counted in a usage report: a running
+// agent or a finished task from the history
+type usageSource struct {
+	repo       string
+	agent      string
+	task       string
+	live       bool              // A running agent rather than a history entry
+	transcript string            // Session transcript, "" if it can't be found
+	stored     *state.TokenUsage // Totals recorded when the task finished
+	at         time.Time         // When the stored totals were recorded
+}
+
+// claudeConfigDirs lists the directories an agent's Claude session may write
+// its transcript under, most specific first
+func (d *Daemon) claudeConfigDirs(repoName, agentName string) []string {
+	dirs := []string{d.paths.AgentClaudeConfigDir(repoName, agentName)}
+	if dir := os.Getenv("CLAUDE_CONFIG_DIR"); dir != "" {
+		dirs = append(dirs, dir)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".claude"))
+	}
+	return dirs
+}
+
+// agentTranscript returns the path of an agent's session transcript, or "" if
+// Claude hasn't written one yet
+func (d *Daemon) agentTranscript(repoName, agentName string, agent state.Agent) string {
+	return usage.FindTranscript(d.claudeConfigDirs(repoName, agentName), agent.WorktreePath, agent.SessionID)
+}
+
+// agentUsage totals the tokens an agent's session has used so far. Returns nil
+// when there is no transcript to read.
+func (d *Daemon) agentUsage(repoName, agentName string, agent state.Agent) (*state.TokenUsage, string) {
+	transcript := d.agentTranscript(repoName, agentName, agent)
+	if transcript == "" {
+		return nil, ""
+	}
+	records, err := d.usageTracker.Records(transcript)
+	if err != nil {
+		d.logger.Debug("Could not read transcript of %s/%s: %v", repoName, agentName, err)
+		return nil, transcript
+	}
+	return tokenUsage(usage.Sum(records, time.Time{})), transcript
+}
+
+// tokenUsage converts parsed usage into its persisted form
+func tokenUsage(u usage.Usage) *state.TokenUsage {
+	return &state.TokenUsage{
+		InputTokens:         u.InputTokens,
+		OutputTokens:        u.OutputTokens,
+		CacheCreationTokens: u.CacheCreationTokens,
+		CacheReadTokens:     u.CacheReadTokens,
+		CostUSD:             u.CostUSD,
+	}
+}
+
+// usageSources collects the running agents and finished tasks of a repository.
+// A task whose transcript is also a running agent's is counted once.
+func (d *Daemon) usageSources(repoName string, repo *state.Repository) []usageSource {
+	var sources []usageSource
+	seen := make(map[string]bool)
+
+	for agentName, agent := range repo.Agents {
+		transcript := d.agentTranscript(repoName, agentName, agent)
+		if transcript == "" {
+			continue
+		}
+		seen[transcript] = true
+		sources = append(sources, usageSource{repo: repoName, agent: agentName, task: agent.Task, live: true, transcript: transcript})
+	}
+
+	for _, entry := range repo.TaskHistory {
+		if entry.Transcript != "" && seen[entry.Transcript] {
+			continue
+		}
+		transcript := entry.Transcript
+		if _, err := os.Stat(transcript); transcript != "" && err != nil {
+			transcript = ""
+		}
+		if transcript == "" && entry.Usage == nil {
+			continue
+		}
+		if transcript != "" {
+			seen[transcript] = true
+		}
+		sources = append(sources, usageSource{
+			repo:       repoName,
+			agent:      entry.Name,
+			task:       entry.Task,
+			transcript: transcript,
+			stored:     entry.Usage,
+			at:         entry.CompletedAt,
+		})
+	}
+	return sources
+}
+
+// forEachUsage calls fn with the usage of every session in repos at or after
+// since (all of it if since is zero). Transcripts are read per response;
+// finished tasks whose transcript is gone contribute their stored totals,
+// dated when the task completed.
+func (d *Daemon) forEachUsage(repos map[string]*state.Repository, since time.Time, fn func(src usageSource, at time.Time, u usage.Usage)) {
+	for repoName, repo := range repos {
+		for _, src := range d.usageSources(repoName, repo) {
+			if src.transcript != "" {
+				records, err := d.usageTracker.Records(src.transcript)
+				if err == nil {
+					for _, r := range records {
+						if since.IsZero() || !r.Time.Before(since) {
+							fn(src, r.Time, r.Usage)
+						}
+					}
+					continue
+				}
+				d.logger.Debug("Could not read transcript %s: %v", src.transcript, err)
+			}
+			if src.stored != nil && (since.IsZero() || !src.at.Before(since)) {
+				fn(src, src.at, usage.Usage{
+					InputTokens:         src.stored.InputTokens,
+					OutputTokens:        src.stored.OutputTokens,
+					CacheCreationTokens: src.stored.CacheCreationTokens,
+					CacheReadTokens:     src.stored.CacheReadTokens,
+					CostUSD:             src.stored.CostUSD,
+				})
+			}
+		}
+	}
+}
+
+// usageRow is one line of a usage report
+type usageRow struct {
+	repo  string
+	agent string
+	task  string
+	day   string
+	usage usage.Usage
+}
+
+// handleUsage reports token usage and estimated cost, grouped by agent, task,
+// or day. Usage is read from session transcripts where they still exist and
+// from the totals recorded in the task history otherwise.
+func (d *Daemon) handleUsage(req socket.Request) socket.Response {
+	repoFilter := getOptionalStringArg(req.Args, "repo", "")
+
+	by := getOptionalStringArg(req.Args, "by", "")
+	if by == "" {
+		by = "agent"
+	}
+	if by != "agent" && by != "task" && by != "day" {
+		return socket.ErrorResponse("invalid grouping %q (valid values: agent, task, day)", by)
+	}
+
+	var since time.Time
+	if s := getOptionalStringArg(req.Args, "since", ""); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return socket.ErrorResponse("invalid since time %q: %v", s, err)
+		}
+		since = t
+	}
+
+	repos := d.state.GetAllRepos()
+	if repoFilter != "" {
+		repo, exists := repos[repoFilter]
+		if !exists {
+			return socket.ErrorResponse("repository '%s' not found", repoFilter)
+		}
+		repos = map[string]*state.Repository{repoFilter: repo}
+	}
+
+	rows := make(map[string]*usageRow)
+	d.forEachUsage(repos, since, func(src usageSource, at time.Time, u usage.Usage) {
+		if by == "task" && src.task == "" {
+			return
+		}
+		row := usageRow{repo: src.repo}
+		switch by {
+		case "agent":
+			row.agent = src.agent
+		case "task":
+			row.agent, row.task = src.agent, src.task
+		case "day":
+			row.repo = ""
+			row.day = at.Local().Format("2006-01-02")
+		}
+		key := fmt.Sprintf("%s\x00%s\x00%s", row.repo, row.agent, row.day)
+		if existing, ok := rows[key]; ok {
+			existing.usage.Add(u)
+			return
+		}
+		row.usage = u
+		rows[key] = &row
+	})
+
+	sorted := make([]*usageRow, 0, len(rows))
+	for _, row := range rows {
+		sorted = append(sorted, row)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if by == "day" {
+			return sorted[i].day < sorted[j].day
+		}
+		if sorted[i].usage.CostUSD != sorted[j].usage.CostUSD {
+			return sorted[i].usage.CostUSD > sorted[j].usage.CostUSD
+		}
+		if sorted[i].usage.TotalTokens() != sorted[j].usage.TotalTokens() {
+			return sorted[i].usage.TotalTokens() > sorted[j].usage.TotalTokens()
+		}
+		return sorted[i].repo+"/"+sorted[i].agent < sorted[j].repo+"/"+sorted[j].agent
+	})
+
+	result := make([]map[string]interface{}, 0, len(sorted))
+	for _, row := range sorted {
+		item := map[string]interface{}{
+			"input_tokens":          row.usage.InputTokens,
+			"output_tokens":         row.usage.OutputTokens,
+			"cache_creation_tokens": row.usage.CacheCreationTokens,
+			"cache_read_tokens":     row.usage.CacheReadTokens,
+			"total_tokens":          row.usage.TotalTokens(),
+			"cost_usd":              row.usage.CostUSD,
+		}
+		switch by {
+		case "agent":
+			item["repo"] = row.repo
+			item["agent"] = row.agent
+		case "task":
+			item["repo"] = row.repo
+			item["agent"] = row.agent
+			item["task"] = row.task
+		case "day":
+			item["day"] = row.day
+		}
+		result = append(result, item)
+	}
+
+	return socket.SuccessResponse(result)
+}
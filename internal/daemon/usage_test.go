@@ -0,0 +1,129 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dlorenc/multiclaude/internal/socket"
+	"github.com/dlorenc/multiclaude/internal/state"
+	"github.com/dlorenc/multiclaude/internal/usage"
+)
+
+const workerTranscript = `{"type":"assistant","timestamp":"2026-01-02T10:00:00Z","message":{"id":"msg_1","model":"claude-sonnet-4-5","usage":{"input_tokens":1000,"output_tokens":200,"cache_creation_input_tokens":0,"cache_read_input_tokens":0}}}
+{"type":"assistant","timestamp":"2026-01-03T10:00:00Z","message":{"id":"msg_2","model":"claude-sonnet-4-5","usage":{"input_tokens":500,"output_tokens":100,"cache_creation_input_tokens":0,"cache_read_input_tokens":0}}}
+`
+
+// addWorkerWithTranscript registers a worker whose session transcript lives in
+// its per-agent Claude config dir and returns the agent and transcript path
+func addWorkerWithTranscript(t *testing.T, d *Daemon) (state.Agent, string) {
+	t.Helper()
+
+	agent := state.Agent{
+		Type:         state.AgentTypeWorker,
+		WorktreePath: t.TempDir(),
+		TmuxWindow:   "clever-fox",
+		SessionID:    "usage-session",
+		Task:         "Add auth",
+		CreatedAt:    time.Now(),
+	}
+	repo := &state.Repository{
+		GithubURL:   "https://github.com/test/repo",
+		TmuxSession: "mc-test-usage",
+		Agents:      map[string]state.Agent{"clever-fox": agent},
+	}
+	if err := d.state.AddRepo("test-repo", repo); err != nil {
+		t.Fatalf("Failed to add repo: %v", err)
+	}
+
+	return agent, writeAgentTranscript(t, d, "clever-fox", agent, workerTranscript)
+}
+
+// writeAgentTranscript writes an agent's session transcript to its per-agent
+// Claude config dir and returns the path
+func writeAgentTranscript(t *testing.T, d *Daemon, agentName string, agent state.Agent, content string) string {
+	t.Helper()
+
+	transcript := filepath.Join(d.paths.AgentClaudeConfigDir("test-repo", agentName), "projects",
+		usage.EncodeProjectPath(agent.WorktreePath), agent.SessionID+".jsonl")
+	if err := os.MkdirAll(filepath.Dir(transcript), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(transcript, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return transcript
+}
+
+func usageRows(t *testing.T, d *Daemon, args map[string]interface{}) []map[string]interface{} {
+	t.Helper()
+	resp := d.handleUsage(socket.Request{Command: "usage", Args: args})
+	if !resp.Success {
+		t.Fatalf("usage failed: %s", resp.Error)
+	}
+	rows, ok := resp.Data.([]map[string]interface{})
+	if !ok {
+		t.Fatalf("unexpected usage data: %T", resp.Data)
+	}
+	return rows
+}
+
+func TestHandleUsageByAgentAndDay(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+	addWorkerWithTranscript(t, d)
+
+	rows := usageRows(t, d, map[string]interface{}{"repo": "test-repo"})
+	if len(rows) != 1 || rows[0]["agent"] != "clever-fox" || rows[0]["total_tokens"] != int64(1800) {
+		t.Fatalf("usage by agent = %+v", rows)
+	}
+	if cost := rows[0]["cost_usd"].(float64); cost <= 0 {
+		t.Errorf("cost_usd = %v, want a priced total", cost)
+	}
+
+	rows = usageRows(t, d, map[string]interface{}{"by": "day"})
+	if len(rows) != 2 || rows[0]["input_tokens"] != int64(1000) || rows[1]["input_tokens"] != int64(500) {
+		t.Errorf("usage by day = %+v", rows)
+	}
+
+	rows = usageRows(t, d, map[string]interface{}{"since": "2026-01-03T00:00:00Z"})
+	if len(rows) != 1 || rows[0]["total_tokens"] != int64(600) {
+		t.Errorf("usage since = %+v", rows)
+	}
+
+	if resp := d.handleUsage(socket.Request{Command: "usage", Args: map[string]interface{}{"by": "week"}}); resp.Success {
+		t.Error("usage should reject an unknown grouping")
+	}
+}
+
+func TestUsageRecordedInTaskHistory(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+	agent, transcript := addWorkerWithTranscript(t, d)
+
+	d.recordTaskHistory("test-repo", "clever-fox", agent)
+	if err := d.state.RemoveAgent("test-repo", "clever-fox"); err != nil {
+		t.Fatalf("Failed to remove agent: %v", err)
+	}
+
+	history, _ := d.state.GetTaskHistory("test-repo", 0)
+	if len(history) != 1 || history[0].Usage == nil {
+		t.Fatalf("history = %+v, want usage recorded", history)
+	}
+	if history[0].Usage.InputTokens != 1500 || history[0].Usage.OutputTokens != 300 || history[0].Transcript != transcript {
+		t.Errorf("recorded usage = %+v (transcript %q)", history[0].Usage, history[0].Transcript)
+	}
+
+	// Once the transcript is gone the stored totals are reported
+	if err := os.Remove(transcript); err != nil {
+		t.Fatal(err)
+	}
+	rows := usageRows(t, d, map[string]interface{}{"by": "task"})
+	if len(rows) != 1 || rows[0]["task"] != "Add auth" || rows[0]["total_tokens"] != int64(1800) {
+		t.Errorf("usage by task = %+v", rows)
+	}
+	if rows := usageRows(t, d, map[string]interface{}{"since": time.Now().Add(time.Hour).Format(time.RFC3339)}); len(rows) != 0 {
+		t.Errorf("usage since the future = %+v", rows)
+	}
+}
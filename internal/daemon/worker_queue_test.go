@@ -0,0 +1,255 @@
+package daemon
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dlorenc/multiclaude/internal/socket"
+	"github.com/dlorenc/multiclaude/internal/state"
+	"github.com/dlorenc/multiclaude/pkg/tmux"
+)
+
+func TestHandleReserveWorkerSlot(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	addPendingTestRepo(t, d, "mc-test-repo")
+	if err := d.state.UpdateMaxWorkers("test-repo", 1); err != nil {
+		t.Fatalf("UpdateMaxWorkers() failed: %v", err)
+	}
+
+	reserve := func(name string, queue bool) socket.Response {
+		return d.handleRequest(socket.Request{
+			Command: "reserve_worker_slot",
+			Args:    map[string]interface{}{"repo": "test-repo", "name": name, "task": "Task " + name, "queue": queue},
+		})
+	}
+
+	// First worker gets the only slot
+	resp := reserve("first", true)
+	if !resp.Success {
+		t.Fatalf("reserve_worker_slot failed: %s", resp.Error)
+	}
+	if data := resp.Data.(map[string]interface{}); data["queued"] != false {
+		t.Errorf("first worker should not be queued, got %v", data)
+	}
+
+	// The reservation holds the slot even before the worker registers
+	resp = reserve("second", true)
+	if !resp.Success {
+		t.Fatalf("reserve_worker_slot failed: %s", resp.Error)
+	}
+	data := resp.Data.(map[string]interface{})
+	if data["queued"] != true || data["position"] != 1 {
+		t.Errorf("second worker should be queued at position 1, got %v", data)
+	}
+
+	// Workers that cannot be queued get an error instead
+	resp = reserve("third", false)
+	if resp.Success || !strings.Contains(resp.Error, "limit of 1 workers") {
+		t.Errorf("reserve without queueing should fail at the limit, got success=%v error=%q", resp.Success, resp.Error)
+	}
+
+	// Once the first worker registers and completes, its slot is free again,
+	// but new tasks still wait behind the queued one
+	if err := d.state.AddAgent("test-repo", "first", state.Agent{
+		Type:            state.AgentTypeWorker,
+		ReadyForCleanup: true,
+		CreatedAt:       time.Now(),
+	}); err != nil {
+		t.Fatalf("AddAgent() failed: %v", err)
+	}
+	resp = reserve("fourth", true)
+	if data := resp.Data.(map[string]interface{}); data["queued"] != true || data["position"] != 2 {
+		t.Errorf("fourth worker should queue behind second, got %v", data)
+	}
+}
+
+func TestHandleWorkerQueueCommands(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	addPendingTestRepo(t, d, "mc-test-repo")
+	for _, name := range []string{"first", "second"} {
+		if _, err := d.state.EnqueueTask("test-repo", state.QueuedTask{Name: name, Task: "Task " + name, QueuedAt: time.Now()}); err != nil {
+			t.Fatalf("EnqueueTask() failed: %v", err)
+		}
+	}
+
+	resp := d.handleRequest(socket.Request{
+		Command: "promote_queued_task",
+		Args:    map[string]interface{}{"repo": "test-repo", "name": "second"},
+	})
+	if !resp.Success {
+		t.Fatalf("promote_queued_task failed: %s", resp.Error)
+	}
+
+	resp = d.handleRequest(socket.Request{
+		Command: "list_worker_queue",
+		Args:    map[string]interface{}{"repo": "test-repo"},
+	})
+	if !resp.Success {
+		t.Fatalf("list_worker_queue failed: %s", resp.Error)
+	}
+	tasks := resp.Data.(map[string]interface{})["tasks"].([]map[string]interface{})
+	if len(tasks) != 2 || tasks[0]["name"] != "second" || tasks[0]["position"] != 1 {
+		t.Errorf("queue after promote = %v, want second first", tasks)
+	}
+
+	resp = d.handleRequest(socket.Request{
+		Command: "remove_queued_task",
+		Args:    map[string]interface{}{"repo": "test-repo", "name": "first"},
+	})
+	if !resp.Success {
+		t.Fatalf("remove_queued_task failed: %s", resp.Error)
+	}
+	queue, _ := d.state.GetWorkerQueue("test-repo")
+	if len(queue) != 1 {
+		t.Errorf("queue length = %d, want 1", len(queue))
+	}
+}
+
+func TestHandleUpdateRepoConfigMaxWorkers(t *testing.T) {
+	d, cleanup := setupTestDaemon(t)
+	defer cleanup()
+
+	addPendingTestRepo(t, d, "mc-test-repo")
+
+	resp := d.handleRequest(socket.Request{
+		Command: "update_repo_config",
+		Args:    map[string]interface{}{"name": "test-repo", "max_workers": float64(-2)},
+	})
+	if resp.Success {
+		t.Error("update_repo_config should reject a negative max_workers")
+	}
+
+	resp = d.handleRequest(socket.Request{
+		Command: "update_repo_config",
+		Args:    map[string]interface{}{"name": "test-repo", "max_workers": float64(3)},
+	})
+	if !resp.Success {
+		t.Fatalf("update_repo_config failed: %s", resp.Error)
+	}
+
+	resp = d.handleRequest(socket.Request{
+		Command: "get_repo_config",
+		Args:    map[string]interface{}{"name": "test-repo"},
+	})
+	if !resp.Success {
+		t.Fatalf("get_repo_config failed: %s", resp.Error)
+	}
+	if got := resp.Data.(map[string]interface{})["max_workers"]; got != 3 {
+		t.Errorf("max_workers = %v, want 3", got)
+	}
+}
+
+func TestDrainWorkerQueueSpawnsWhenSlotFrees(t *testing.T) {
+	tmuxClient := tmux.NewClient()
+	if !tmuxClient.IsTmuxAvailable() {
+		t.Fatal("tmux is required for this test but not available")
+	}
+
+	t.Setenv("MULTICLAUDE_TEST_MODE", "1")
+
+	d, _, cleanup := setupTestDaemonWithGitRepo(t)
+	defer cleanup()
+
+	sessionName := "mc-test-queue"
+	if err := tmuxClient.CreateSession(context.Background(), sessionName, true); err != nil {
+		t.Fatalf("tmux is required for this test but cannot create sessions in this environment: %v", err)
+	}
+	defer tmuxClient.KillSession(context.Background(), sessionName)
+
+	addPendingTestRepo(t, d, sessionName)
+	if err := d.state.UpdateMaxWorkers("test-repo", 1); err != nil {
+		t.Fatalf("UpdateMaxWorkers() failed: %v", err)
+	}
+	if err := d.state.AddAgent("test-repo", "busy", state.Agent{
+		Type:       state.AgentTypeWorker,
+		TmuxWindow: "busy",
+		CreatedAt:  time.Now(),
+	}); err != nil {
+		t.Fatalf("AddAgent() failed: %v", err)
+	}
+	if _, err := d.state.EnqueueTask("test-repo", state.QueuedTask{Name: "waiting", Task: "Queued work", QueuedAt: time.Now()}); err != nil {
+		t.Fatalf("EnqueueTask() failed: %v", err)
+	}
+
+	// At the limit: nothing is spawned
+	d.TriggerQueueDrain()
+	if _, exists := d.state.GetAgent("test-repo", "waiting"); exists {
+		t.Fatal("queued task should not spawn while the repo is at its limit")
+	}
+
+	// The busy worker completes, freeing its slot
+	busy, _ := d.state.GetAgent("test-repo", "busy")
+	busy.ReadyForCleanup = true
+	if err := d.state.UpdateAgent("test-repo", "busy", busy); err != nil {
+		t.Fatalf("UpdateAgent() failed: %v", err)
+	}
+
+	d.TriggerQueueDrain()
+
+	agent, exists := d.state.GetAgent("test-repo", "waiting")
+	if !exists {
+		t.Fatal("queued task should spawn once a slot frees up")
+	}
+	if agent.Task != "Queued work" {
+		t.Errorf("agent task = %q, want %q", agent.Task, "Queued work")
+	}
+	queue, _ := d.state.GetWorkerQueue("test-repo")
+	if len(queue) != 0 {
+		t.Errorf("queue should be empty after draining, got %d tasks", len(queue))
+	}
+}
+
+func TestCreateAgentEnforcesWorkerLimit(t *testing.T) {
+	t.Setenv("MULTICLAUDE_TEST_MODE", "1")
+	d, cleanup := setupSpawnTest(t, "mc-test-create-limit")
+	defer cleanup()
+
+	if err := d.state.UpdateMaxWorkers("test-repo", 2); err != nil {
+		t.Fatalf("UpdateMaxWorkers() failed: %v", err)
+	}
+	create := func(name string) socket.Response {
+		return d.handleRequest(socket.Request{
+			Command: "create_agent",
+			Args:    map[string]interface{}{"repo": "test-repo", "name": name, "type": "worker", "task": "Task " + name},
+		})
+	}
+
+	// A worker created without a reservation takes a free slot
+	if resp := create("first"); !resp.Success {
+		t.Fatalf("create_agent without a reservation should take a free slot: %s", resp.Error)
+	}
+
+	// The last slot is reserved for another worker, which can still be created
+	resp := d.handleRequest(socket.Request{
+		Command: "reserve_worker_slot",
+		Args:    map[string]interface{}{"repo": "test-repo", "name": "second", "task": "Task second"},
+	})
+	if !resp.Success || resp.Data.(map[string]interface{})["queued"] != false {
+		t.Fatalf("reserve_worker_slot should reserve the last slot, got %+v", resp)
+	}
+	if resp := create("third"); resp.Success || !strings.Contains(resp.Error, "limit of 2 workers") {
+		t.Errorf("create_agent past the limit should fail, got success=%v error=%q", resp.Success, resp.Error)
+	}
+	resp = d.handleRequest(socket.Request{
+		Command: "spawn_agent",
+		Args:    map[string]interface{}{"repo": "test-repo", "name": "fourth", "class": "ephemeral", "prompt": "You are a worker.", "task": "Task fourth"},
+	})
+	if resp.Success || !strings.Contains(resp.Error, "limit of 2 workers") {
+		t.Errorf("spawn_agent past the limit should fail, got success=%v error=%q", resp.Success, resp.Error)
+	}
+	if resp := create("second"); !resp.Success {
+		t.Fatalf("create_agent with a reservation failed: %s", resp.Error)
+	}
+
+	for _, name := range []string{"third", "fourth"} {
+		if _, exists := d.state.GetAgent("test-repo", name); exists {
+			t.Errorf("worker %s should not be created past the limit", name)
+		}
+	}
+}
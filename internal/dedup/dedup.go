@@ -0,0 +1,147 @@
+// Package dedup finds earlier tasks that look like a new one.
+//
+// Task descriptions are reduced to word and word-pair shingles, weighted by
+// TF-IDF over the set being compared, and scored by cosine similarity. It is
+// deliberately local and cheap: good enough to catch "fix flaky auth test"
+// being spawned twice, not to understand what the tasks mean.
+package dedup
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// DefaultThreshold is the similarity at which a task counts as a likely duplicate
+const DefaultThreshold = 0.5
+
+// Candidate is an existing task a new one is compared against
+type Candidate struct {
+	Name   string // Agent or task name
+	Task   string // Task description
+	Status string // Where the task stands, e.g. "running", "queued", "merged"
+}
+
+// Match is a candidate that resembles the new task
+type Match struct {
+	Candidate
+	Score float64 // Cosine similarity in [0, 1]
+}
+
+// stopWords carry no signal about what a task is for
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "by": true, "for": true, "from": true, "in": true, "into": true,
+	"is": true, "it": true, "its": true, "of": true, "on": true, "or": true,
+	"so": true, "that": true, "the": true, "this": true, "to": true, "we": true,
+	"when": true, "with": true, "please": true, "should": true, "make": true,
+}
+
+// stem strips common English suffixes so "fixes", "fixing", and "fixed"
+// land near "fix"
+func stem(word string) string {
+	switch {
+	case len(word) > 4 && strings.HasSuffix(word, "ies"):
+		return word[:len(word)-3] + "y"
+	case len(word) > 5 && strings.HasSuffix(word, "ing"):
+		return word[:len(word)-3]
+	case len(word) > 4 && strings.HasSuffix(word, "ed"):
+		return word[:len(word)-2]
+	case len(word) > 3 && strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss"):
+		return word[:len(word)-1]
+	}
+	return word
+}
+
+// words splits a task description into lowercased, stemmed words, dropping
+// stop words and single characters
+func words(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	result := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if len(f) < 2 || stopWords[f] {
+			continue
+		}
+		result = append(result, stem(f))
+	}
+	return result
+}
+
+// shingles counts the words and adjacent word pairs of a task description
+func shingles(text string) map[string]float64 {
+	ws := words(text)
+	counts := make(map[string]float64, 2*len(ws))
+	for i, w := range ws {
+		counts[w]++
+		if i > 0 {
+			counts[ws[i-1]+" "+w]++
+		}
+	}
+	return counts
+}
+
+// FindSimilar returns the candidates whose similarity to task is at least
+// threshold, best first, at most limit of them (all if limit is 0)
+func FindSimilar(task string, candidates []Candidate, threshold float64, limit int) []Match {
+	query := shingles(task)
+	if len(query) == 0 || len(candidates) == 0 {
+		return nil
+	}
+
+	docs := make([]map[string]float64, len(candidates))
+	docFreq := make(map[string]int)
+	for term := range query {
+		docFreq[term]++
+	}
+	for i, c := range candidates {
+		docs[i] = shingles(c.Task)
+		for term := range docs[i] {
+			docFreq[term]++
+		}
+	}
+
+	// Smoothed IDF, so terms shared by every document still count a little
+	n := float64(len(candidates) + 1)
+	weigh := func(counts map[string]float64) map[string]float64 {
+		vec := make(map[string]float64, len(counts))
+		for term, tf := range counts {
+			vec[term] = tf * (math.Log((n+1)/(float64(docFreq[term])+1)) + 1)
+		}
+		return vec
+	}
+
+	queryVec := weigh(query)
+	var matches []Match
+	for i, c := range candidates {
+		if score := cosine(queryVec, weigh(docs[i])); score >= threshold {
+			matches = append(matches, Match{Candidate: c, Score: score})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// cosine returns the cosine similarity of two sparse vectors
+func cosine(a, b map[string]float64) float64 {
+	var dot, normA, normB float64
+	for term, w := range a {
+		normA += w * w
+		dot += w * b[term]
+	}
+	for _, w := range b {
+		normB += w * w
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
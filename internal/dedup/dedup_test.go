@@ -0,0 +1,62 @@
+package dedup
+
+import (
+	"slices"
+	"testing"
+)
+
+var history = []Candidate{
+	{Name: "clever-fox", Task: "Fix the flaky TestDaemonRestart test in internal/daemon", Status: "running"},
+	{Name: "happy-owl", Task: "Add retry logic to the GitHub client when the API rate limits us", Status: "merged"},
+	{Name: "brave-bee", Task: "Update README with installation instructions for Homebrew", Status: "open"},
+	{Name: "calm-koala", Task: "Refactor message routing to batch deliveries", Status: "queued"},
+}
+
+func TestFindSimilar(t *testing.T) {
+	tests := []struct {
+		task string
+		want []string
+	}{
+		{"fix flaky TestDaemonRestart test", []string{"clever-fox"}},
+		{"Add retries to the github client on rate limiting", []string{"happy-owl"}},
+		{"update the README installation instructions (homebrew)", []string{"brave-bee"}},
+		{"Add a dark mode to the web dashboard", nil},
+		{"Implement OAuth login for the CLI", nil},
+		{"the and of", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, m := range FindSimilar(tt.task, history, DefaultThreshold, 0) {
+			got = append(got, m.Name)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("FindSimilar(%q) = %v, want %v", tt.task, got, tt.want)
+		}
+	}
+}
+
+func TestFindSimilarOrdersAndLimits(t *testing.T) {
+	candidates := []Candidate{
+		{Name: "a", Task: "fix login bug"},
+		{Name: "b", Task: "fix login bug in the settings page"},
+		{Name: "c", Task: "fix login bug in settings"},
+	}
+	matches := FindSimilar("fix login bug in settings", candidates, 0.3, 2)
+	if len(matches) != 2 || matches[0].Name != "c" {
+		t.Fatalf("FindSimilar() = %+v, want c first and two matches", matches)
+	}
+	if matches[0].Score < 0.99 {
+		t.Errorf("identical task scored %v, want 1", matches[0].Score)
+	}
+	if matches[0].Score < matches[1].Score {
+		t.Errorf("matches not sorted by score: %+v", matches)
+	}
+}
+
+func TestWords(t *testing.T) {
+	got := words("Fixes the failing tests, and retries the API calls!")
+	want := []string{"fixe", "fail", "test", "retry", "api", "call"}
+	if !slices.Equal(got, want) {
+		t.Errorf("words() = %v, want %v", got, want)
+	}
+}
@@ -89,6 +89,19 @@ func Format(err error) string {
 			sb.WriteString("\n\nTry: ")
 			sb.WriteString(cliErr.Suggestion)
 		}
+	} else if cliErr := wrappedCLIError(err); cliErr != nil {
+		// CLIError wrapped with more context - keep the context, and the
+		// category, cause, and suggestion of the CLIError
+		sb.WriteString(categoryPrefix(cliErr.Category))
+		sb.WriteString(err.Error())
+		if cliErr.Cause != nil {
+			sb.WriteString(": ")
+			sb.WriteString(cliErr.Cause.Error())
+		}
+		if cliErr.Suggestion != "" {
+			sb.WriteString("\n\nTry: ")
+			sb.WriteString(cliErr.Suggestion)
+		}
 	} else {
 		// Regular error - format with generic prefix
 		sb.WriteString("Error: ")
@@ -98,6 +111,22 @@ func Format(err error) string {
 	return sb.String()
 }
 
+// wrappedCLIError returns the CLIError wrapped by err, e.g. with
+// fmt.Errorf("...: %w", cliErr), or nil if there is none
+func wrappedCLIError(err error) *CLIError {
+	for err != nil {
+		if cliErr, ok := err.(*CLIError); ok {
+			return cliErr
+		}
+		wrapper, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			return nil
+		}
+		err = wrapper.Unwrap()
+	}
+	return nil
+}
+
 // categoryPrefix returns the prefix for each error category
 func categoryPrefix(cat Category) string {
 	switch cat {
@@ -127,6 +156,15 @@ func DaemonNotRunning() *CLIError {
 	}
 }
 
+// DaemonRunning creates an error for operations that need the daemon stopped
+func DaemonRunning(operation string) *CLIError {
+	return &CLIError{
+		Category:   CategoryConfig,
+		Message:    fmt.Sprintf("the daemon must be stopped to %s", operation),
+		Suggestion: "multiclaude daemon stop",
+	}
+}
+
 // DaemonCommunicationFailed creates an error for daemon communication failures
 func DaemonCommunicationFailed(operation string, cause error) *CLIError {
 	return &CLIError{
@@ -300,6 +338,40 @@ func ClaudeNotFound(cause error) *CLIError {
 	}
 }
 
+// AgentSpawnFailed creates an error for an agent the daemon could not spawn.
+// The daemon has already removed whatever the spawn created.
+func AgentSpawnFailed(agentType, name string, cause error) *CLIError {
+	return &CLIError{
+		Category:   CategoryRuntime,
+		Message:    fmt.Sprintf("failed to create %s '%s'", agentType, name),
+		Cause:      cause,
+		Suggestion: spawnSuggestionForError(cause),
+	}
+}
+
+// spawnSuggestionForError provides specific suggestions based on the step of
+// the spawn that failed. The cause comes from the daemon as text, so the
+// readiness and delivery failures are recognized by the messages of
+// claude.StartupTimeoutError and claude.DeliveryError.
+func spawnSuggestionForError(cause error) string {
+	errMsg := ""
+	if cause != nil {
+		errMsg = cause.Error()
+	}
+
+	switch {
+	case strings.Contains(errMsg, "did not become ready") || strings.Contains(errMsg, "exited during startup"):
+		return "run 'claude' once by hand to answer any login, theme, or folder trust prompt, then try again"
+	case strings.Contains(errMsg, "did not appear in the pane"):
+		return "Claude did not receive its first message; try again"
+	case strings.Contains(errMsg, "failed to fetch PR"):
+		return "ensure the PR exists and you have access to the repository"
+	case strings.Contains(errMsg, "worktree") || strings.Contains(errMsg, "branch named"):
+		return worktreeSuggestionForError(cause)
+	}
+	return "everything created for it was removed again; see what went wrong with: multiclaude daemon logs"
+}
+
 // MissingArgument creates an error for missing required arguments
 func MissingArgument(argName, expectedType string) *CLIError {
 	msg := fmt.Sprintf("missing required argument: %s", argName)
@@ -391,3 +463,13 @@ func WorkspaceNotFound(name, repo string) *CLIError {
 		Suggestion: fmt.Sprintf("multiclaude workspace list --repo %s", repo),
 	}
 }
+
+// DuplicateTask creates an error for a task that resembles work already in
+// flight or recently merged
+func DuplicateTask(repo string) *CLIError {
+	return &CLIError{
+		Category:   CategoryUsage,
+		Message:    fmt.Sprintf("task looks like a duplicate of existing work in repo '%s'", repo),
+		Suggestion: "add --force to create the worker anyway",
+	}
+}
@@ -2,8 +2,12 @@ package errors
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/dlorenc/multiclaude/pkg/claude"
 )
 
 func TestCLIError_Error(t *testing.T) {
@@ -89,6 +93,20 @@ func TestFormat_RegularError(t *testing.T) {
 	}
 }
 
+func TestFormat_WrappedCLIError(t *testing.T) {
+	err := fmt.Errorf("failed to start worker Claude: %w", ClaudeNotFound(errors.New("exec: \"claude\": executable file not found in $PATH")))
+	formatted := Format(err)
+
+	for _, want := range []string{
+		"failed to start worker Claude: claude binary not found in PATH: exec: \"claude\": executable file not found in $PATH",
+		"Try: install Claude Code CLI",
+	} {
+		if !strings.Contains(formatted, want) {
+			t.Errorf("expected %q in: %s", want, formatted)
+		}
+	}
+}
+
 func TestFormat_Nil(t *testing.T) {
 	if Format(nil) != "" {
 		t.Error("Format(nil) should return empty string")
@@ -577,3 +595,27 @@ func TestWorkspaceNotFound(t *testing.T) {
 		t.Errorf("expected workspace list suggestion, got: %s", formatted)
 	}
 }
+
+func TestAgentSpawnFailed(t *testing.T) {
+	tests := []struct {
+		cause      string
+		suggestion string
+	}{
+		{(&claude.StartupTimeoutError{Session: "mc-repo", Window: "fox", Waited: 90 * time.Second}).Error(), "folder trust prompt"},
+		{(&claude.StartupTimeoutError{Session: "mc-repo", Window: "fox", Command: "bash", Exited: true}).Error(), "folder trust prompt"},
+		{(&claude.DeliveryError{Session: "mc-repo", Window: "fox", Waited: 10 * time.Second}).Error(), "did not receive its first message"},
+		{"failed to create worktree: a branch named 'work/fox' already exists", "git branch -D work/fox"},
+		{"failed to fetch PR #12: fatal: couldn't find remote ref", "ensure the PR exists"},
+		{"failed to create tmux window: exit status 1", "multiclaude daemon logs"},
+	}
+	for _, tt := range tests {
+		err := AgentSpawnFailed("worker", "fox", fmt.Errorf("%s", tt.cause))
+		formatted := Format(err)
+		if !strings.Contains(formatted, "failed to create worker 'fox'") {
+			t.Errorf("expected agent in message, got: %s", formatted)
+		}
+		if !strings.Contains(err.Suggestion, tt.suggestion) {
+			t.Errorf("AgentSpawnFailed(%q) suggestion = %q, want to contain %q", tt.cause, err.Suggestion, tt.suggestion)
+		}
+	}
+}
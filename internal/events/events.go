@@ -0,0 +1,195 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Type identifies what happened
+type Type string
+
+const (
+	// AgentSpawned is emitted when an agent is registered with the daemon
+	AgentSpawned Type = "agent_spawned"
+	// AgentDied is emitted when an agent's process or window goes away unexpectedly
+	AgentDied Type = "agent_died"
+	// AgentRestarted is emitted when the daemon restarts an agent's Claude process
+	AgentRestarted Type = "agent_restarted"
+	// MessageDelivered is emitted when a message is injected into an agent's pane
+	MessageDelivered Type = "message_delivered"
+	// WorktreeRefreshed is emitted when a worker's worktree is rebased onto the main branch
+	WorktreeRefreshed Type = "worktree_refreshed"
+	// WorktreeConflicted is emitted when rebasing a worker's worktree onto the main branch hits conflicts
+	WorktreeConflicted Type = "worktree_conflicted"
+	// TaskStatusChanged is emitted when a task history entry is recorded or its status changes
+	TaskStatusChanged Type = "task_status_changed"
+	// PRStatusChanged is emitted when a tracked PR's state, CI, review, or mergeability changes
+	PRStatusChanged Type = "pr_status_changed"
+)
+
+// AllTypes lists every event type, in the order they are documented
+var AllTypes = []Type{
+	AgentSpawned,
+	AgentDied,
+	AgentRestarted,
+	MessageDelivered,
+	WorktreeRefreshed,
+	WorktreeConflicted,
+	TaskStatusChanged,
+	PRStatusChanged,
+}
+
+// IsValid reports whether t is a known event type
+func (t Type) IsValid() bool {
+	for _, known := range AllTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is a single occurrence in the daemon, streamed to subscribers as one JSON line
+type Event struct {
+	Type  Type                   `json:"type"`
+	Time  time.Time              `json:"time"`
+	Repo  string                 `json:"repo,omitempty"`
+	Agent string                 `json:"agent,omitempty"`
+	Data  map[string]interface{} `json:"data,omitempty"`
+}
+
+// Filter selects which events a subscriber receives. Empty fields match everything.
+type Filter struct {
+	Repo  string
+	Types []Type
+}
+
+// Matches reports whether the event passes the filter
+func (f Filter) Matches(e Event) bool {
+	if f.Repo != "" && e.Repo != f.Repo {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if e.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	// subscriberBuffer is how many events can queue for a subscriber before new
+	// events are dropped for it
+	subscriberBuffer = 256
+
+	// historySize is how many recent events the bus keeps for Recent
+	historySize = 200
+)
+
+// Subscription receives events matching its filter until it is closed
+type Subscription struct {
+	C <-chan Event
+
+	ch      chan Event
+	filter  Filter
+	bus     *Bus
+	dropped int
+}
+
+// Dropped returns how many events were discarded because the subscriber fell behind
+func (s *Subscription) Dropped() int {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	return s.dropped
+}
+
+// Close unsubscribes and closes C. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	if _, ok := s.bus.subs[s]; !ok {
+		return
+	}
+	delete(s.bus.subs, s)
+	close(s.ch)
+}
+
+// Bus fans events out to subscribers. Publishing never blocks: a subscriber
+// that isn't keeping up misses events rather than stalling the daemon.
+type Bus struct {
+	mu      sync.Mutex
+	subs    map[*Subscription]struct{}
+	history []Event // most recent last, capped at historySize
+}
+
+// NewBus creates an event bus with no subscribers
+func NewBus() *Bus {
+	return &Bus{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscribe registers a subscriber for events matching filter
+func (b *Bus) Subscribe(filter Filter) *Subscription {
+	ch := make(chan Event, subscriberBuffer)
+	sub := &Subscription{C: ch, ch: ch, filter: filter, bus: b}
+
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	return sub
+}
+
+// Publish sends an event to every matching subscriber. A zero Time is set to now.
+func (b *Bus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.history = append(b.history, e)
+	if len(b.history) > historySize {
+		b.history = b.history[len(b.history)-historySize:]
+	}
+
+	for sub := range b.subs {
+		if !sub.filter.Matches(e) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			sub.dropped++
+		}
+	}
+}
+
+// Recent returns up to limit of the most recently published events matching
+// filter, oldest first. A limit of 0 or less returns every retained match.
+func (b *Bus) Recent(filter Filter, limit int) []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var matched []Event
+	for _, e := range b.history {
+		if filter.Matches(e) {
+			matched = append(matched, e)
+		}
+	}
+	if limit > 0 && len(matched) > limit {
+		matched = matched[len(matched)-limit:]
+	}
+	return matched
+}
+
+// SubscriberCount returns the number of active subscribers
+func (b *Bus) SubscriberCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
@@ -0,0 +1,125 @@
+package events
+
+import (
+	"testing"
+)
+
+func TestFilterMatches(t *testing.T) {
+	event := Event{Type: AgentSpawned, Repo: "my-repo", Agent: "clever-fox"}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"empty filter", Filter{}, true},
+		{"matching repo", Filter{Repo: "my-repo"}, true},
+		{"other repo", Filter{Repo: "other"}, false},
+		{"matching type", Filter{Types: []Type{AgentDied, AgentSpawned}}, true},
+		{"other type", Filter{Types: []Type{AgentDied}}, false},
+		{"repo and type", Filter{Repo: "my-repo", Types: []Type{AgentSpawned}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Matches(event); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTypeIsValid(t *testing.T) {
+	for _, eventType := range AllTypes {
+		if !eventType.IsValid() {
+			t.Errorf("%q should be valid", eventType)
+		}
+	}
+	if Type("agent_exploded").IsValid() {
+		t.Error("unknown type should not be valid")
+	}
+}
+
+func TestBusPublishSubscribe(t *testing.T) {
+	bus := NewBus()
+
+	all := bus.Subscribe(Filter{})
+	deaths := bus.Subscribe(Filter{Types: []Type{AgentDied}})
+	if bus.SubscriberCount() != 2 {
+		t.Fatalf("SubscriberCount() = %d, want 2", bus.SubscriberCount())
+	}
+
+	bus.Publish(Event{Type: AgentSpawned, Repo: "r", Agent: "a"})
+	bus.Publish(Event{Type: AgentDied, Repo: "r", Agent: "a"})
+
+	first := <-all.C
+	if first.Type != AgentSpawned || first.Time.IsZero() {
+		t.Errorf("first event = %+v, want agent_spawned with a timestamp", first)
+	}
+	if second := <-all.C; second.Type != AgentDied {
+		t.Errorf("second event = %q, want agent_died", second.Type)
+	}
+	if got := <-deaths.C; got.Type != AgentDied {
+		t.Errorf("filtered event = %q, want agent_died", got.Type)
+	}
+	select {
+	case e := <-deaths.C:
+		t.Errorf("filtered subscriber got unexpected event %q", e.Type)
+	default:
+	}
+
+	all.Close()
+	all.Close() // safe to call twice
+	if _, ok := <-all.C; ok {
+		t.Error("channel should be closed after Close()")
+	}
+	if bus.SubscriberCount() != 1 {
+		t.Errorf("SubscriberCount() = %d, want 1", bus.SubscriberCount())
+	}
+	deaths.Close()
+}
+
+func TestBusDropsForSlowSubscriber(t *testing.T) {
+	bus := NewBus()
+	sub := bus.Subscribe(Filter{})
+	defer sub.Close()
+
+	for i := 0; i < subscriberBuffer+5; i++ {
+		bus.Publish(Event{Type: MessageDelivered})
+	}
+
+	if sub.Dropped() != 5 {
+		t.Errorf("Dropped() = %d, want 5", sub.Dropped())
+	}
+	if len(sub.C) != subscriberBuffer {
+		t.Errorf("buffered = %d, want %d", len(sub.C), subscriberBuffer)
+	}
+}
+
+func TestBusRecent(t *testing.T) {
+	bus := NewBus()
+
+	for i := 0; i < historySize+10; i++ {
+		eventType := MessageDelivered
+		if i%2 == 0 {
+			eventType = WorktreeRefreshed
+		}
+		bus.Publish(Event{Type: eventType, Data: map[string]interface{}{"i": i}})
+	}
+
+	all := bus.Recent(Filter{}, 0)
+	if len(all) != historySize {
+		t.Fatalf("Recent() returned %d events, want %d", len(all), historySize)
+	}
+	if all[len(all)-1].Data["i"] != historySize+9 {
+		t.Errorf("last event = %v, want most recent", all[len(all)-1].Data["i"])
+	}
+
+	refreshed := bus.Recent(Filter{Types: []Type{WorktreeRefreshed}}, 3)
+	if len(refreshed) != 3 {
+		t.Fatalf("Recent(limit 3) returned %d events", len(refreshed))
+	}
+	if refreshed[2].Data["i"] != historySize+8 {
+		t.Errorf("newest refreshed event = %v, want %d", refreshed[2].Data["i"], historySize+8)
+	}
+}
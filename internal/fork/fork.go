@@ -160,12 +160,12 @@ func AddUpstreamRemote(repoPath, upstreamURL string) error {
 	_, err := getRemoteURL(repoPath, "upstream")
 	if err == nil {
 		// Upstream already exists - update it
-		cmd := exec.Command("git", "-C", repoPath, "remote", "set-url", "upstream", upstreamURL)
+		cmd := exec.Command("git", "-C", repoPath, "remote", "set-url", "--", "upstream", upstreamURL)
 		return cmd.Run()
 	}
 
 	// Add new upstream remote
-	cmd := exec.Command("git", "-C", repoPath, "remote", "add", "upstream", upstreamURL)
+	cmd := exec.Command("git", "-C", repoPath, "remote", "add", "--", "upstream", upstreamURL)
 	return cmd.Run()
 }
 
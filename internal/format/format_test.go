@@ -229,6 +229,42 @@ func TestMessageBadge(t *testing.T) {
 	}
 }
 
+func TestTokens(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0"},
+		{950, "950"},
+		{12_345, "12.3k"},
+		{4_120_000, "4.1M"},
+	}
+
+	for _, tt := range tests {
+		if got := Tokens(tt.n); got != tt.want {
+			t.Errorf("Tokens(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestCost(t *testing.T) {
+	tests := []struct {
+		usd  float64
+		want string
+	}{
+		{0, "$0.00"},
+		{0.004, "<$0.01"},
+		{1.234, "$1.23"},
+		{42, "$42.00"},
+	}
+
+	for _, tt := range tests {
+		if got := Cost(tt.usd); got != tt.want {
+			t.Errorf("Cost(%v) = %q, want %q", tt.usd, got, tt.want)
+		}
+	}
+}
+
 func TestColoredTableTotalWidth(t *testing.T) {
 	// Test totalWidth through the ColoredTable
 	table := NewColoredTable("Name", "Status", "Task")
@@ -0,0 +1,205 @@
+// Package github queries pull request state through the gh CLI.
+//
+// Callers depend on the Client interface so tests can substitute a fake
+// instead of shelling out to gh.
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// CI status values summarizing a pull request's checks
+const (
+	CIPending = "pending"
+	CIPassing = "passing"
+	CIFailing = "failing"
+	CINone    = "none"
+)
+
+// prFields are the `gh pr --json` fields decoded into PullRequest
+const prFields = "number,url,state,headRefName,headRefOid,reviewDecision,mergeable,updatedAt,statusCheckRollup"
+
+// Check is a single entry of a PR's status check rollup. Check runs report
+// Status and Conclusion; commit status contexts report State.
+type Check struct {
+	Name       string `json:"name,omitempty"`
+	Context    string `json:"context,omitempty"`
+	Status     string `json:"status,omitempty"`
+	Conclusion string `json:"conclusion,omitempty"`
+	State      string `json:"state,omitempty"`
+	DetailsURL string `json:"detailsUrl,omitempty"` // Check run page
+	TargetURL  string `json:"targetUrl,omitempty"`  // Status context link
+}
+
+// DisplayName returns the check's name, or its context for commit statuses
+func (c Check) DisplayName() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.Context
+}
+
+// RunID extracts the GitHub Actions run ID from the check's link, or returns
+// "" when the check did not come from Actions
+func (c Check) RunID() string {
+	for _, link := range []string{c.DetailsURL, c.TargetURL} {
+		_, rest, found := strings.Cut(link, "/actions/runs/")
+		if !found {
+			continue
+		}
+		id, _, _ := strings.Cut(rest, "/")
+		if id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// PullRequest is the subset of gh's pull request JSON that multiclaude tracks
+type PullRequest struct {
+	Number            int       `json:"number"`
+	URL               string    `json:"url"`
+	State             string    `json:"state"`          // OPEN, MERGED, CLOSED
+	HeadRefName       string    `json:"headRefName"`    // Branch the PR was opened from
+	HeadRefOid        string    `json:"headRefOid"`     // Commit at the head of the branch
+	ReviewDecision    string    `json:"reviewDecision"` // APPROVED, CHANGES_REQUESTED, REVIEW_REQUIRED, or empty
+	Mergeable         string    `json:"mergeable"`      // MERGEABLE, CONFLICTING, UNKNOWN
+	UpdatedAt         time.Time `json:"updatedAt"`
+	StatusCheckRollup []Check   `json:"statusCheckRollup"`
+}
+
+// CIStatus summarizes the status check rollup: failing if any check failed,
+// pending if any check hasn't finished, passing if all succeeded, and none
+// when the PR has no checks.
+func (pr PullRequest) CIStatus() string {
+	if len(pr.StatusCheckRollup) == 0 {
+		return CINone
+	}
+
+	pending := false
+	for _, check := range pr.StatusCheckRollup {
+		switch checkResult(check) {
+		case CIFailing:
+			return CIFailing
+		case CIPending:
+			pending = true
+		}
+	}
+	if pending {
+		return CIPending
+	}
+	return CIPassing
+}
+
+// FailedChecks returns the checks that completed unsuccessfully
+func (pr PullRequest) FailedChecks() []Check {
+	var failed []Check
+	for _, check := range pr.StatusCheckRollup {
+		if checkResult(check) == CIFailing {
+			failed = append(failed, check)
+		}
+	}
+	return failed
+}
+
+// checkResult classifies a single check
+func checkResult(check Check) string {
+	if check.State != "" {
+		switch strings.ToUpper(check.State) {
+		case "SUCCESS":
+			return CIPassing
+		case "FAILURE", "ERROR":
+			return CIFailing
+		default:
+			return CIPending
+		}
+	}
+
+	if strings.ToUpper(check.Status) != "COMPLETED" {
+		return CIPending
+	}
+	switch strings.ToUpper(check.Conclusion) {
+	case "SUCCESS", "NEUTRAL", "SKIPPED":
+		return CIPassing
+	default:
+		return CIFailing
+	}
+}
+
+// Client looks up pull requests for a local repository checkout
+type Client interface {
+	// ListPRs returns up to limit of the repository's most recently created
+	// pull requests in any state, newest first
+	ListPRs(ctx context.Context, repoPath string, limit int) ([]PullRequest, error)
+
+	// ViewPR returns a single pull request by number, URL, or head branch
+	ViewPR(ctx context.Context, repoPath, ref string) (*PullRequest, error)
+
+	// FailedRunLog returns the log output of the failed steps of a GitHub
+	// Actions run
+	FailedRunLog(ctx context.Context, repoPath, runID string) (string, error)
+}
+
+// CLI implements Client by running gh in the repository directory
+type CLI struct{}
+
+// NewCLI creates a Client backed by the gh CLI
+func NewCLI() *CLI {
+	return &CLI{}
+}
+
+// ListPRs runs `gh pr list --state all`
+func (c *CLI) ListPRs(ctx context.Context, repoPath string, limit int) ([]PullRequest, error) {
+	output, err := c.run(ctx, repoPath, "pr", "list", "--state", "all", "--limit", fmt.Sprintf("%d", limit), "--json", prFields)
+	if err != nil {
+		return nil, err
+	}
+
+	var prs []PullRequest
+	if err := json.Unmarshal(output, &prs); err != nil {
+		return nil, fmt.Errorf("failed to parse gh pr list output: %w", err)
+	}
+	return prs, nil
+}
+
+// ViewPR runs `gh pr view <ref>`
+func (c *CLI) ViewPR(ctx context.Context, repoPath, ref string) (*PullRequest, error) {
+	output, err := c.run(ctx, repoPath, "pr", "view", ref, "--json", prFields)
+	if err != nil {
+		return nil, err
+	}
+
+	var pr PullRequest
+	if err := json.Unmarshal(output, &pr); err != nil {
+		return nil, fmt.Errorf("failed to parse gh pr view output: %w", err)
+	}
+	return &pr, nil
+}
+
+// FailedRunLog runs `gh run view <id> --log-failed`
+func (c *CLI) FailedRunLog(ctx context.Context, repoPath, runID string) (string, error) {
+	output, err := c.run(ctx, repoPath, "run", "view", runID, "--log-failed")
+	if err != nil {
+		return "", err
+	}
+	return string(output), nil
+}
+
+// run executes gh with the given arguments in repoPath
+func (c *CLI) run(ctx context.Context, repoPath string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "gh", args...)
+	cmd.Dir = repoPath
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("gh %s failed: %s", strings.Join(args[:2], " "), strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("gh %s failed: %w", strings.Join(args[:2], " "), err)
+	}
+	return output, nil
+}
@@ -0,0 +1,101 @@
+package github
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCIStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		checks []Check
+		want   string
+	}{
+		{"no checks", nil, CINone},
+		{"all passing", []Check{
+			{Name: "build", Status: "COMPLETED", Conclusion: "SUCCESS"},
+			{Name: "lint", Status: "COMPLETED", Conclusion: "SKIPPED"},
+			{Context: "ci/legacy", State: "SUCCESS"},
+		}, CIPassing},
+		{"one running", []Check{
+			{Name: "build", Status: "COMPLETED", Conclusion: "SUCCESS"},
+			{Name: "test", Status: "IN_PROGRESS"},
+		}, CIPending},
+		{"status context pending", []Check{
+			{Context: "ci/legacy", State: "PENDING"},
+		}, CIPending},
+		{"failure wins over pending", []Check{
+			{Name: "test", Status: "IN_PROGRESS"},
+			{Name: "build", Status: "COMPLETED", Conclusion: "FAILURE"},
+		}, CIFailing},
+		{"timed out counts as failure", []Check{
+			{Name: "e2e", Status: "COMPLETED", Conclusion: "TIMED_OUT"},
+		}, CIFailing},
+		{"status context error", []Check{
+			{Context: "ci/legacy", State: "ERROR"},
+		}, CIFailing},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pr := PullRequest{StatusCheckRollup: tt.checks}
+			if got := pr.CIStatus(); got != tt.want {
+				t.Errorf("CIStatus() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPullRequestJSON(t *testing.T) {
+	// Trimmed `gh pr view --json` output
+	raw := `{
+		"number": 42,
+		"url": "https://github.com/owner/repo/pull/42",
+		"state": "OPEN",
+		"headRefName": "work/clever-fox",
+		"reviewDecision": "CHANGES_REQUESTED",
+		"mergeable": "CONFLICTING",
+		"updatedAt": "2024-01-15T10:30:00Z",
+		"statusCheckRollup": [
+			{"__typename": "CheckRun", "name": "test", "status": "COMPLETED", "conclusion": "FAILURE"}
+		]
+	}`
+
+	var pr PullRequest
+	if err := json.Unmarshal([]byte(raw), &pr); err != nil {
+		t.Fatalf("Unmarshal() failed: %v", err)
+	}
+
+	if pr.Number != 42 || pr.HeadRefName != "work/clever-fox" || pr.State != "OPEN" {
+		t.Errorf("unexpected PR: %+v", pr)
+	}
+	if pr.ReviewDecision != "CHANGES_REQUESTED" || pr.Mergeable != "CONFLICTING" {
+		t.Errorf("unexpected review/mergeable: %q %q", pr.ReviewDecision, pr.Mergeable)
+	}
+	if pr.UpdatedAt.IsZero() {
+		t.Error("UpdatedAt should be parsed")
+	}
+	if pr.CIStatus() != CIFailing {
+		t.Errorf("CIStatus() = %q, want failing", pr.CIStatus())
+	}
+}
+
+func TestFailedChecks(t *testing.T) {
+	pr := PullRequest{StatusCheckRollup: []Check{
+		{Name: "build", Status: "COMPLETED", Conclusion: "SUCCESS"},
+		{Name: "test", Status: "COMPLETED", Conclusion: "FAILURE", DetailsURL: "https://github.com/o/r/actions/runs/123456/job/789"},
+		{Context: "ci/legacy", State: "ERROR", TargetURL: "https://ci.example.com/build/5"},
+		{Name: "lint", Status: "IN_PROGRESS"},
+	}}
+
+	failed := pr.FailedChecks()
+	if len(failed) != 2 {
+		t.Fatalf("FailedChecks() returned %d checks, want 2: %+v", len(failed), failed)
+	}
+	if failed[0].DisplayName() != "test" || failed[0].RunID() != "123456" {
+		t.Errorf("first failed check: name=%q run=%q", failed[0].DisplayName(), failed[0].RunID())
+	}
+	if failed[1].DisplayName() != "ci/legacy" || failed[1].RunID() != "" {
+		t.Errorf("second failed check: name=%q run=%q", failed[1].DisplayName(), failed[1].RunID())
+	}
+}
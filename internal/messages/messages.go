@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,20 +22,91 @@ const (
 	StatusAcked     Status = "acked"
 )
 
+// Priority controls the order in which pending messages are delivered
+type Priority string
+
+const (
+	PriorityLow    Priority = "low"
+	PriorityNormal Priority = "normal"
+	PriorityUrgent Priority = "urgent"
+)
+
+// ParsePriority validates a priority name; empty means normal
+func ParsePriority(s string) (Priority, error) {
+	switch p := Priority(s); p {
+	case "":
+		return PriorityNormal, nil
+	case PriorityLow, PriorityNormal, PriorityUrgent:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid priority %q (must be low, normal, or urgent)", s)
+}
+
+// Rank orders priorities for delivery; higher ranks are delivered first.
+// Messages written before priorities existed count as normal.
+func (p Priority) Rank() int {
+	switch p {
+	case PriorityUrgent:
+		return 2
+	case PriorityLow:
+		return 0
+	}
+	return 1
+}
+
 // Message represents a message between agents
 type Message struct {
-	ID        string     `json:"id"`
-	From      string     `json:"from"`
-	To        string     `json:"to"`
-	Timestamp time.Time  `json:"timestamp"`
-	Body      string     `json:"body"`
-	Status    Status     `json:"status"`
-	AckedAt   *time.Time `json:"acked_at,omitempty"`
+	ID          string     `json:"id"`
+	From        string     `json:"from"`
+	To          string     `json:"to"`
+	Timestamp   time.Time  `json:"timestamp"`
+	Body        string     `json:"body"`
+	Status      Status     `json:"status"`
+	AckedAt     *time.Time `json:"acked_at,omitempty"`
+	ReplyTo     string     `json:"reply_to,omitempty"`  // ID of the message this answers
+	ThreadID    string     `json:"thread_id,omitempty"` // ID of the message that started the thread
+	Priority    Priority   `json:"priority,omitempty"`
+	Group       string     `json:"group,omitempty"`        // Group address the message was sent to, e.g. @workers
+	BroadcastID string     `json:"broadcast_id,omitempty"` // Shared by every copy of a group message
+}
+
+// IsGroupAddress reports whether an address names a group of agents, such as
+// @all, @workers, @type:review, or a named group, rather than a single agent
+func IsGroupAddress(to string) bool {
+	return strings.HasPrefix(to, "@")
+}
+
+// Resolver expands a group address into the agents it names at send time
+type Resolver func(repoName, from, address string) ([]string, error)
+
+// Broadcast is a message sent to a group address: one copy is written to
+// each recipient's mailbox, and each copy is tracked separately
+type Broadcast struct {
+	ID       string
+	Group    string
+	Messages []*Message
+}
+
+// Thread returns the ID of the thread the message belongs to. Messages
+// written before threading existed start their own thread.
+func (msg *Message) Thread() string {
+	if msg.ThreadID != "" {
+		return msg.ThreadID
+	}
+	return msg.ID
+}
+
+// SendOptions holds the optional fields of a new message
+type SendOptions struct {
+	Priority Priority
+	ReplyTo  *Message // Message being answered; the reply joins its thread
 }
 
 // Manager handles message filesystem operations
 type Manager struct {
 	messagesRoot string
+	onSend       func(repoName, to string)
+	resolve      Resolver
 }
 
 // NewManager creates a new message manager
@@ -41,8 +114,97 @@ func NewManager(messagesRoot string) *Manager {
 	return &Manager{messagesRoot: messagesRoot}
 }
 
-// Send creates a new message file
+// WithSendHook sets a function that is called after each message is written.
+// The daemon uses this to deliver messages immediately instead of waiting for its next poll.
+func (m *Manager) WithSendHook(fn func(repoName, to string)) *Manager {
+	m.onSend = fn
+	return m
+}
+
+// WithResolver sets the function that expands group addresses. The daemon
+// expands them against the agents currently in state; without a resolver,
+// group addresses can't be sent to.
+func (m *Manager) WithResolver(fn Resolver) *Manager {
+	m.resolve = fn
+	return m
+}
+
+// Send creates a new message file. Group addresses are broadcast, and the
+// copy sent to the first recipient is returned.
 func (m *Manager) Send(repoName, from, to, body string) (*Message, error) {
+	return m.SendWithOptions(repoName, from, to, body, SendOptions{})
+}
+
+// SendWithOptions creates a new message file with a priority or as a reply.
+// Group addresses are broadcast, and the copy sent to the first recipient is
+// returned.
+func (m *Manager) SendWithOptions(repoName, from, to, body string, opts SendOptions) (*Message, error) {
+	if IsGroupAddress(to) {
+		broadcast, err := m.Broadcast(repoName, from, to, body, opts)
+		if err != nil {
+			return nil, err
+		}
+		return broadcast.Messages[0], nil
+	}
+
+	msg := newMessage(from, to, body, opts)
+	if err := m.deliver(repoName, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// Broadcast sends a message to every agent a group address names, except the
+// sender. Each recipient gets its own copy, which starts its own thread so
+// replies stay between the sender and that recipient.
+func (m *Manager) Broadcast(repoName, from, group, body string, opts SendOptions) (*Broadcast, error) {
+	if m.resolve == nil {
+		return nil, fmt.Errorf("cannot send to %s: group addresses are expanded by the daemon", group)
+	}
+	recipients, err := m.resolve(repoName, from, group)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{from: true}
+	broadcast := &Broadcast{ID: fmt.Sprintf("bc-%s", uuid.New().String()[:13]), Group: group}
+	for _, to := range recipients {
+		if seen[to] {
+			continue
+		}
+		seen[to] = true
+
+		msg := newMessage(from, to, body, SendOptions{Priority: opts.Priority})
+		msg.Group = group
+		msg.BroadcastID = broadcast.ID
+		if err := m.deliver(repoName, msg); err != nil {
+			return broadcast, err
+		}
+		broadcast.Messages = append(broadcast.Messages, msg)
+	}
+	if len(broadcast.Messages) == 0 {
+		return nil, fmt.Errorf("no agents match %s", group)
+	}
+	return broadcast, nil
+}
+
+// BroadcastStatus returns every copy of a broadcast, one per recipient,
+// ordered by recipient
+func (m *Manager) BroadcastStatus(repoName, broadcastID string) ([]*Message, error) {
+	copies, err := m.find(repoName, func(msg *Message) bool {
+		return msg.BroadcastID == broadcastID
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(copies, func(i, j int) bool {
+		return copies[i].To < copies[j].To
+	})
+	return copies, nil
+}
+
+// newMessage builds a pending message, threading it under opts.ReplyTo
+func newMessage(from, to, body string, opts SendOptions) *Message {
 	msg := &Message{
 		ID:        fmt.Sprintf("msg-%s", uuid.New().String()[:13]),
 		From:      from,
@@ -50,13 +212,28 @@ func (m *Manager) Send(repoName, from, to, body string) (*Message, error) {
 		Timestamp: time.Now(),
 		Body:      body,
 		Status:    StatusPending,
+		Priority:  opts.Priority,
 	}
-
-	if err := m.write(repoName, to, msg); err != nil {
-		return nil, err
+	msg.ThreadID = msg.ID
+	if opts.ReplyTo != nil {
+		msg.ReplyTo = opts.ReplyTo.ID
+		msg.ThreadID = opts.ReplyTo.Thread()
 	}
+	if msg.Priority == "" {
+		msg.Priority = PriorityNormal
+	}
+	return msg
+}
 
-	return msg, nil
+// deliver writes a new message to its recipient's mailbox and runs the send hook
+func (m *Manager) deliver(repoName string, msg *Message) error {
+	if err := m.write(repoName, msg.To, msg); err != nil {
+		return err
+	}
+	if m.onSend != nil {
+		m.onSend(repoName, msg.To)
+	}
+	return nil
 }
 
 // List returns all messages for an agent
@@ -95,6 +272,62 @@ func (m *Manager) Get(repoName, agentName, messageID string) (*Message, error) {
 	return m.read(repoName, agentName, filename)
 }
 
+// Reply answers a message in agentName's mailbox, sending the reply to the
+// original sender in the same thread
+func (m *Manager) Reply(repoName, agentName, messageID, body string, priority Priority) (*Message, error) {
+	original, err := m.Get(repoName, agentName, messageID)
+	if err != nil {
+		return nil, err
+	}
+	return m.SendWithOptions(repoName, agentName, original.From, body, SendOptions{
+		Priority: priority,
+		ReplyTo:  original,
+	})
+}
+
+// Thread returns the messages in a thread across every mailbox in the
+// repository, oldest first
+func (m *Manager) Thread(repoName, threadID string) ([]*Message, error) {
+	thread, err := m.find(repoName, func(msg *Message) bool {
+		return msg.Thread() == threadID
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(thread, func(i, j int) bool {
+		return thread[i].Timestamp.Before(thread[j].Timestamp)
+	})
+	return thread, nil
+}
+
+// find returns the messages in every mailbox in the repository that match
+func (m *Manager) find(repoName string, match func(*Message) bool) ([]*Message, error) {
+	entries, err := os.ReadDir(filepath.Join(m.messagesRoot, repoName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*Message{}, nil
+		}
+		return nil, fmt.Errorf("failed to read repo messages dir: %w", err)
+	}
+
+	found := []*Message{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		msgs, err := m.List(repoName, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range msgs {
+			if match(msg) {
+				found = append(found, msg)
+			}
+		}
+	}
+	return found, nil
+}
+
 // UpdateStatus updates the status of a message
 func (m *Manager) UpdateStatus(repoName, agentName, messageID string, status Status) error {
 	msg, err := m.Get(repoName, agentName, messageID)
@@ -207,6 +440,88 @@ func (m *Manager) read(repoName, agentName, filename string) (*Message, error) {
 	return &msg, nil
 }
 
+// RetentionPolicy limits the delivered messages a mailbox keeps. Pending
+// messages are never removed, since their recipient hasn't seen them.
+type RetentionPolicy struct {
+	MaxAge      time.Duration // Delivered messages older than this are removed (0 = no limit)
+	MaxPerAgent int           // Only the newest this many delivered messages are kept (0 = no limit)
+}
+
+// Expired returns the messages in an agent's mailbox that policy removes,
+// oldest first
+func (m *Manager) Expired(repoName, agentName string, policy RetentionPolicy, now time.Time) ([]*Message, error) {
+	msgs, err := m.List(repoName, agentName)
+	if err != nil {
+		return nil, err
+	}
+
+	var delivered []*Message
+	for _, msg := range msgs {
+		if msg.Status != StatusPending {
+			delivered = append(delivered, msg)
+		}
+	}
+	sort.Slice(delivered, func(i, j int) bool {
+		return delivered[i].Timestamp.Before(delivered[j].Timestamp)
+	})
+
+	excess := 0
+	if policy.MaxPerAgent > 0 && len(delivered) > policy.MaxPerAgent {
+		excess = len(delivered) - policy.MaxPerAgent
+	}
+	var expired []*Message
+	for i, msg := range delivered {
+		if i < excess || (policy.MaxAge > 0 && now.Sub(msg.Timestamp) > policy.MaxAge) {
+			expired = append(expired, msg)
+		}
+	}
+	return expired, nil
+}
+
+// Mailboxes returns the names of the agents in a repository that have a
+// mailbox directory
+func (m *Manager) Mailboxes(repoName string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(m.messagesRoot, repoName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, fmt.Errorf("failed to read repo messages dir: %w", err)
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// ArchiveMailbox moves an agent's mailbox to dest. An empty mailbox is removed
+// instead. Returns the number of messages archived.
+func (m *Manager) ArchiveMailbox(repoName, agentName, dest string) (int, error) {
+	msgs, err := m.List(repoName, agentName)
+	if err != nil {
+		return 0, err
+	}
+	dir := m.agentDir(repoName, agentName)
+	if len(msgs) == 0 {
+		if err := os.RemoveAll(dir); err != nil {
+			return 0, fmt.Errorf("failed to remove empty mailbox: %w", err)
+		}
+		return 0, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	if err := os.Rename(dir, dest); err != nil {
+		return 0, fmt.Errorf("failed to archive mailbox: %w", err)
+	}
+	return len(msgs), nil
+}
+
 // CleanupOrphaned removes message directories for non-existent agents
 func (m *Manager) CleanupOrphaned(repoName string, validAgents []string) (int, error) {
 	repoDir := filepath.Join(m.messagesRoot, repoName)
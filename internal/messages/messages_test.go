@@ -1,8 +1,10 @@
 package messages
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -546,3 +548,220 @@ func TestErrorHandling(t *testing.T) {
 		}
 	})
 }
+
+func TestSendHook(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	var gotRepo, gotTo string
+	calls := 0
+	m := NewManager(tmpDir).WithSendHook(func(repoName, to string) {
+		gotRepo, gotTo = repoName, to
+		calls++
+	})
+
+	if _, err := m.Send("test-repo", "supervisor", "worker1", "Hello"); err != nil {
+		t.Fatalf("Send() failed: %v", err)
+	}
+
+	if calls != 1 {
+		t.Errorf("send hook called %d times, want 1", calls)
+	}
+	if gotRepo != "test-repo" || gotTo != "worker1" {
+		t.Errorf("send hook got (%q, %q), want (%q, %q)", gotRepo, gotTo, "test-repo", "worker1")
+	}
+
+	// Status updates are not sends
+	msgs, _ := m.List("test-repo", "worker1")
+	if err := m.UpdateStatus("test-repo", "worker1", msgs[0].ID, StatusDelivered); err != nil {
+		t.Fatalf("UpdateStatus() failed: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("send hook called %d times after UpdateStatus, want 1", calls)
+	}
+}
+
+func TestReplyThreads(t *testing.T) {
+	m := NewManager(t.TempDir())
+
+	question, err := m.Send("test-repo", "worker1", "supervisor", "Which API should I use?")
+	if err != nil {
+		t.Fatalf("Send() failed: %v", err)
+	}
+	if question.ThreadID != question.ID || question.Priority != PriorityNormal {
+		t.Errorf("new message thread = %q, priority = %q; want its own ID and normal", question.ThreadID, question.Priority)
+	}
+
+	answer, err := m.Reply("test-repo", "supervisor", question.ID, "The v2 one", PriorityUrgent)
+	if err != nil {
+		t.Fatalf("Reply() failed: %v", err)
+	}
+	if answer.To != "worker1" || answer.ReplyTo != question.ID || answer.ThreadID != question.ID || answer.Priority != PriorityUrgent {
+		t.Errorf("reply = %+v", answer)
+	}
+
+	followUp, err := m.Reply("test-repo", "worker1", answer.ID, "Thanks", PriorityNormal)
+	if err != nil {
+		t.Fatalf("Reply() failed: %v", err)
+	}
+	if followUp.ThreadID != question.ID {
+		t.Errorf("reply to a reply joined thread %q, want %q", followUp.ThreadID, question.ID)
+	}
+	if _, err := m.Send("test-repo", "supervisor", "worker1", "Unrelated"); err != nil {
+		t.Fatalf("Send() failed: %v", err)
+	}
+
+	thread, err := m.Thread("test-repo", question.ID)
+	if err != nil {
+		t.Fatalf("Thread() failed: %v", err)
+	}
+	var ids []string
+	for _, msg := range thread {
+		ids = append(ids, msg.ID)
+	}
+	if want := []string{question.ID, answer.ID, followUp.ID}; strings.Join(ids, ",") != strings.Join(want, ",") {
+		t.Errorf("thread = %v, want %v", ids, want)
+	}
+
+	if _, err := m.Reply("test-repo", "supervisor", "msg-missing", "Hello?", PriorityNormal); err == nil {
+		t.Error("Reply() to an unknown message should fail")
+	}
+
+	// Messages written before threading start their own thread
+	legacy := &Message{ID: "msg-legacy"}
+	if legacy.Thread() != "msg-legacy" || legacy.Priority.Rank() != PriorityNormal.Rank() {
+		t.Errorf("legacy message thread = %q, rank = %d", legacy.Thread(), legacy.Priority.Rank())
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	for input, want := range map[string]Priority{"": PriorityNormal, "low": PriorityLow, "urgent": PriorityUrgent} {
+		if got, err := ParsePriority(input); err != nil || got != want {
+			t.Errorf("ParsePriority(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+	if _, err := ParsePriority("asap"); err == nil {
+		t.Error("ParsePriority(asap) should fail")
+	}
+	if !(PriorityUrgent.Rank() > PriorityNormal.Rank() && PriorityNormal.Rank() > PriorityLow.Rank()) {
+		t.Error("priorities should rank urgent > normal > low")
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	m := NewManager(t.TempDir())
+
+	if _, err := m.Send("test-repo", "supervisor", "@workers", "Main is broken"); err == nil {
+		t.Error("Send() to a group should fail without a resolver")
+	}
+
+	var sent []string
+	m.WithSendHook(func(repoName, to string) {
+		sent = append(sent, to)
+	}).WithResolver(func(repoName, from, address string) ([]string, error) {
+		if address != "@workers" {
+			return nil, nil
+		}
+		return []string{"owl", "fox", "supervisor", "fox"}, nil
+	})
+
+	broadcast, err := m.Broadcast("test-repo", "supervisor", "@workers", "Main is broken, stop pushing", SendOptions{Priority: PriorityUrgent})
+	if err != nil {
+		t.Fatalf("Broadcast() failed: %v", err)
+	}
+	if len(broadcast.Messages) != 2 || strings.Join(sent, ",") != "owl,fox" {
+		t.Fatalf("broadcast went to %v, want owl and fox once each without the sender", sent)
+	}
+	for _, msg := range broadcast.Messages {
+		if msg.BroadcastID != broadcast.ID || msg.Group != "@workers" || msg.ThreadID != msg.ID || msg.Priority != PriorityUrgent {
+			t.Errorf("broadcast copy = %+v", msg)
+		}
+	}
+
+	// Each copy is tracked in its recipient's mailbox
+	if err := m.Ack("test-repo", "owl", broadcast.Messages[0].ID); err != nil {
+		t.Fatalf("Ack() failed: %v", err)
+	}
+	copies, err := m.BroadcastStatus("test-repo", broadcast.ID)
+	if err != nil {
+		t.Fatalf("BroadcastStatus() failed: %v", err)
+	}
+	if len(copies) != 2 || copies[0].To != "fox" || copies[0].Status != StatusPending || copies[1].To != "owl" || copies[1].Status != StatusAcked {
+		t.Errorf("BroadcastStatus() = %+v", copies)
+	}
+
+	// Send on a group address returns the first copy
+	msg, err := m.Send("test-repo", "supervisor", "@workers", "Fixed")
+	if err != nil || msg.To != "owl" || msg.BroadcastID == "" {
+		t.Errorf("Send(@workers) = %+v, %v", msg, err)
+	}
+
+	if _, err := m.Send("test-repo", "supervisor", "@nobody", "Hello?"); err == nil || !strings.Contains(err.Error(), "no agents match") {
+		t.Errorf("Send() to an empty group error = %v", err)
+	}
+}
+
+func TestExpired(t *testing.T) {
+	m := NewManager(t.TempDir())
+	now := time.Now()
+
+	var sent []*Message
+	for i, status := range []Status{StatusAcked, StatusPending, StatusRead, StatusDelivered} {
+		msg, err := m.Send("test-repo", "supervisor", "worker1", fmt.Sprintf("Message %d", i))
+		if err != nil {
+			t.Fatalf("Send() failed: %v", err)
+		}
+		msg.Timestamp = now.Add(-time.Duration(4-i) * time.Hour)
+		msg.Status = status
+		if err := m.write("test-repo", "worker1", msg); err != nil {
+			t.Fatal(err)
+		}
+		sent = append(sent, msg)
+	}
+
+	expiredIDs := func(policy RetentionPolicy) []string {
+		expired, err := m.Expired("test-repo", "worker1", policy, now)
+		if err != nil {
+			t.Fatalf("Expired() failed: %v", err)
+		}
+		var ids []string
+		for _, msg := range expired {
+			ids = append(ids, msg.ID)
+		}
+		return ids
+	}
+
+	// Pending messages are kept however old they are
+	if got := expiredIDs(RetentionPolicy{MaxAge: 90 * time.Minute}); strings.Join(got, ",") != sent[0].ID+","+sent[2].ID {
+		t.Errorf("expired by age = %v, want the acked and read messages", got)
+	}
+	if got := expiredIDs(RetentionPolicy{MaxPerAgent: 1}); strings.Join(got, ",") != sent[0].ID+","+sent[2].ID {
+		t.Errorf("expired by count = %v, want all but the newest delivered message", got)
+	}
+	if got := expiredIDs(RetentionPolicy{}); len(got) != 0 {
+		t.Errorf("no limits expired %v", got)
+	}
+}
+
+func TestArchiveMailbox(t *testing.T) {
+	root := t.TempDir()
+	m := NewManager(filepath.Join(root, "messages"))
+
+	if _, err := m.Send("test-repo", "supervisor", "worker1", "Hello"); err != nil {
+		t.Fatalf("Send() failed: %v", err)
+	}
+	os.MkdirAll(m.agentDir("test-repo", "empty"), 0755)
+
+	dest := filepath.Join(root, "archive", "worker1")
+	if count, err := m.ArchiveMailbox("test-repo", "worker1", dest); err != nil || count != 1 {
+		t.Fatalf("ArchiveMailbox() = %d, %v", count, err)
+	}
+	if entries, _ := os.ReadDir(dest); len(entries) != 1 {
+		t.Errorf("archive has %d file(s), want 1", len(entries))
+	}
+	if count, err := m.ArchiveMailbox("test-repo", "empty", filepath.Join(root, "archive", "empty")); err != nil || count != 0 {
+		t.Errorf("ArchiveMailbox(empty) = %d, %v", count, err)
+	}
+	if mailboxes, _ := m.Mailboxes("test-repo"); len(mailboxes) != 0 {
+		t.Errorf("mailboxes after archiving = %v", mailboxes)
+	}
+}
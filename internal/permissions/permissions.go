@@ -0,0 +1,319 @@
+// Package permissions provides the named permission profiles agents run under.
+//
+// A profile is a set of Claude permission rules and the permission mode that
+// enforces them. Restricted profiles are rendered into the agent's
+// .claude/settings.json, next to the hooks copied by hooks.CopyConfig, and
+// replace --dangerously-skip-permissions on the command line. Repositories
+// pick a profile per agent type; agent types without one run unrestricted.
+package permissions
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/dlorenc/multiclaude/internal/state"
+)
+
+// Unrestricted is the profile agents run under unless their repository picks
+// another: no rules, and permission prompts are skipped.
+const Unrestricted = "unrestricted"
+
+// Profile is a named set of permission rules
+type Profile struct {
+	Name        string
+	Description string
+
+	// Allow and Deny are Claude permission rules, e.g. "Read" or "Bash(git:*)"
+	Allow []string
+	Deny  []string
+
+	// Mode is the permission mode the agent runs in. Empty means
+	// --dangerously-skip-permissions, which is only used by Unrestricted.
+	Mode string
+}
+
+// readTools are the tools every profile may use to look at the code
+var readTools = []string{"Read", "Grep", "Glob", "LS"}
+
+// editTools change files. Restricted profiles deny them or leave them to the
+// permission mode; allowing them outright would allow edits anywhere.
+var editTools = []string{"Edit", "MultiEdit", "Write", "NotebookEdit"}
+
+var profiles = map[string]Profile{
+	Unrestricted: {
+		Name:        Unrestricted,
+		Description: "No restrictions; permission prompts are skipped",
+	},
+	"reviewer-readonly": {
+		Name:        "reviewer-readonly",
+		Description: "Read the code and PRs, comment on them, and use the multiclaude CLI",
+		Allow: concat(readTools, []string{
+			"Bash(git diff:*)",
+			"Bash(git log:*)",
+			"Bash(git show:*)",
+			"Bash(git status:*)",
+			"Bash(gh pr view:*)",
+			"Bash(gh pr diff:*)",
+			"Bash(gh pr checks:*)",
+			"Bash(gh pr comment:*)",
+			"Bash(gh pr review:*)",
+			"Bash(multiclaude:*)",
+		}),
+		Deny: editTools,
+		Mode: "default",
+	},
+	"worker": {
+		Name:        "worker",
+		Description: "Edit files in its worktree and run git, gh, tests, and the multiclaude CLI",
+		Allow: concat(readTools, []string{
+			"Bash(git:*)",
+			"Bash(gh:*)",
+			"Bash(multiclaude:*)",
+			"Bash(go build:*)",
+			"Bash(go test:*)",
+			"Bash(go vet:*)",
+			"Bash(make test:*)",
+			"Bash(npm test:*)",
+			"Bash(npm run test:*)",
+			"Bash(pytest:*)",
+			"Bash(cargo test:*)",
+		}),
+		// Edits aren't in Allow: acceptEdits accepts them inside the working
+		// directory only, which keeps the worker to its worktree
+		Mode: "acceptEdits",
+	},
+	"supervisor-cli": {
+		Name:        "supervisor-cli",
+		Description: "Read the code and use the multiclaude CLI, nothing else",
+		Allow:       concat(readTools, []string{"Bash(multiclaude:*)"}),
+		Deny:        editTools,
+		Mode:        "default",
+	},
+}
+
+// Get returns the named profile. An empty name is Unrestricted.
+func Get(name string) (Profile, bool) {
+	if name == "" {
+		name = Unrestricted
+	}
+	p, ok := profiles[name]
+	return p, ok
+}
+
+// Names returns the names of all profiles, sorted
+func Names() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate checks that name is a known profile
+func Validate(name string) error {
+	if _, ok := Get(name); !ok {
+		return fmt.Errorf("unknown permission profile %q (use %s)", name, strings.Join(Names(), ", "))
+	}
+	return nil
+}
+
+// Restricted reports whether agents under the profile are subject to
+// permission checks
+func (p Profile) Restricted() bool {
+	return p.Mode != ""
+}
+
+// Render merges the profile's rules into the "permissions" key of settings,
+// which may be empty or the contents of a settings.json file. Other keys,
+// such as hooks, are kept.
+func (p Profile) Render(settings []byte) ([]byte, error) {
+	doc := map[string]interface{}{}
+	if len(settings) > 0 {
+		if err := json.Unmarshal(settings, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse settings: %w", err)
+		}
+	}
+	perms, _ := doc["permissions"].(map[string]interface{})
+	if perms == nil {
+		perms = map[string]interface{}{}
+	}
+	perms["allow"] = nonNil(p.Allow)
+	perms["deny"] = nonNil(p.Deny)
+	perms["defaultMode"] = p.Mode
+	doc["permissions"] = perms
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Install renders the profile for an agent working in workDir. An agent with
+// its own checkout gets the rules in workDir/.claude/settings.json, merged with
+// the repository's .multiclaude/hooks.json. Agents that share the repository
+// checkout would overwrite each other's settings there, so they get the rules
+// in sharedFile instead. Returns the settings file Claude must be given with
+// --settings, or "" if none is needed.
+func (p Profile) Install(repoPath, workDir, sharedFile string) (string, error) {
+	if !p.Restricted() {
+		return "", nil
+	}
+
+	var base []byte
+	settingsPath := sharedFile
+	if filepath.Clean(workDir) != filepath.Clean(repoPath) {
+		data, err := os.ReadFile(filepath.Join(repoPath, ".multiclaude", "hooks.json"))
+		if err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to read hooks config: %w", err)
+		}
+		base = data
+		settingsPath = filepath.Join(workDir, ".claude", "settings.json")
+	}
+
+	data, err := p.Render(base)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(settingsPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create settings directory: %w", err)
+	}
+	if err := os.WriteFile(settingsPath, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", settingsPath, err)
+	}
+
+	if settingsPath == sharedFile {
+		return sharedFile, nil
+	}
+	return "", nil
+}
+
+// bypassFlags would lift a restricted profile's permission checks if passed
+// as extra arguments. --permission-mode takes a value, and the allowed tools
+// flags take a list of them.
+var bypassFlags = []string{"--dangerously-skip-permissions", "--allow-dangerously-skip-permissions", "--permission-mode", "--allowedTools", "--allowed-tools"}
+
+// Apply returns the agent profile to launch Claude with under p: the
+// profile's permission mode unless the agent picked its own, and settingsFile
+// (as returned by Install) passed with --settings. The agent's allowed tools
+// are narrowed to those the profile permits, and extra arguments that would
+// bypass the profile are dropped.
+func (p Profile) Apply(agent state.AgentProfile, settingsFile string) state.AgentProfile {
+	if !p.Restricted() {
+		return agent
+	}
+	if agent.PermissionMode == "" || agent.PermissionMode == "bypassPermissions" {
+		agent.PermissionMode = p.Mode
+	}
+	var allowed []string
+	for _, rule := range agent.AllowedTools {
+		if p.Permits(rule) {
+			allowed = append(allowed, rule)
+		}
+	}
+	agent.AllowedTools = allowed
+	agent.ExtraArgs = withoutBypassFlags(agent.ExtraArgs)
+	if settingsFile != "" {
+		agent.ExtraArgs = append(agent.ExtraArgs, "--settings", settingsFile)
+	}
+	return agent
+}
+
+// Permits reports whether the profile allows a permission rule, e.g. an
+// agent's "Bash(git log:*)" under a profile allowing "Bash(git:*)". A rule is
+// permitted only if one of the profile's allow rules covers it and none of its
+// deny rules do, so granting it can't widen the profile.
+func (p Profile) Permits(rule string) bool {
+	if !p.Restricted() {
+		return true
+	}
+	for _, deny := range p.Deny {
+		if covers(deny, rule) || covers(rule, deny) {
+			return false
+		}
+	}
+	for _, allow := range p.Allow {
+		if covers(allow, rule) {
+			return true
+		}
+	}
+	return false
+}
+
+// covers reports whether permission rule general allows everything rule
+// specific does: the same rule, a bare tool name covering any use of the tool,
+// or a command prefix like "Bash(git:*)" covering the commands it starts, such
+// as "Bash(git log:*)" and "Bash(git status)"
+func covers(general, specific string) bool {
+	if general == specific {
+		return true
+	}
+	generalTool, generalSpec, generalScoped := splitRule(general)
+	specificTool, specificSpec, specificScoped := splitRule(specific)
+	if generalTool != specificTool {
+		return false
+	}
+	if !generalScoped {
+		return true
+	}
+	prefix, isPrefix := strings.CutSuffix(generalSpec, ":*")
+	if !isPrefix || !specificScoped {
+		return false
+	}
+	command := strings.TrimSuffix(specificSpec, ":*")
+	return command == prefix || strings.HasPrefix(command, prefix+" ")
+}
+
+// splitRule splits a permission rule like "Bash(git:*)" into its tool and
+// specifier; scoped is false for a bare tool name like "Read"
+func splitRule(rule string) (tool, spec string, scoped bool) {
+	tool, rest, scoped := strings.Cut(rule, "(")
+	if !scoped || !strings.HasSuffix(rest, ")") {
+		return rule, "", false
+	}
+	return tool, strings.TrimSuffix(rest, ")"), true
+}
+
+// withoutBypassFlags returns a copy of args without bypassFlags and their values
+func withoutBypassFlags(args []string) []string {
+	var out []string
+	for i := 0; i < len(args); i++ {
+		name, _, hasValue := strings.Cut(args[i], "=")
+		if !slices.Contains(bypassFlags, name) {
+			out = append(out, args[i])
+			continue
+		}
+		switch {
+		case hasValue:
+		case name == "--permission-mode":
+			i++ // Skip the mode too
+		case name == "--allowedTools" || name == "--allowed-tools":
+			// Skip the tools, which run up to the next flag
+			for i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				i++
+			}
+		}
+	}
+	return out
+}
+
+func concat(lists ...[]string) []string {
+	var out []string
+	for _, l := range lists {
+		out = append(out, l...)
+	}
+	return out
+}
+
+func nonNil(rules []string) []string {
+	if rules == nil {
+		return []string{}
+	}
+	return rules
+}
@@ -0,0 +1,218 @@
+package permissions
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/dlorenc/multiclaude/internal/state"
+)
+
+func TestGet(t *testing.T) {
+	if p, ok := Get(""); !ok || p.Name != Unrestricted || p.Restricted() {
+		t.Errorf("Get(\"\") = %+v, %v, want unrestricted", p, ok)
+	}
+	for _, name := range []string{"reviewer-readonly", "worker", "supervisor-cli"} {
+		p, ok := Get(name)
+		if !ok || !p.Restricted() {
+			t.Errorf("Get(%s) = %+v, %v, want a restricted profile", name, p, ok)
+		}
+	}
+	if err := Validate("root"); err == nil {
+		t.Error("Validate() should reject unknown profiles")
+	}
+	if !slices.IsSorted(Names()) {
+		t.Errorf("Names() = %v, want sorted", Names())
+	}
+}
+
+func TestRenderKeepsHooks(t *testing.T) {
+	hooks := []byte(`{"hooks": {"Stop": [{"hooks": [{"type": "command", "command": "notify"}]}]}, "permissions": {"additionalDirectories": ["/data"]}}`)
+	p, _ := Get("reviewer-readonly")
+
+	data, err := p.Render(hooks)
+	if err != nil {
+		t.Fatalf("Render() failed: %v", err)
+	}
+	var settings struct {
+		Hooks       map[string]interface{} `json:"hooks"`
+		Permissions struct {
+			Allow                 []string `json:"allow"`
+			Deny                  []string `json:"deny"`
+			DefaultMode           string   `json:"defaultMode"`
+			AdditionalDirectories []string `json:"additionalDirectories"`
+		} `json:"permissions"`
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		t.Fatalf("rendered settings are not JSON: %v\n%s", err, data)
+	}
+	if settings.Hooks["Stop"] == nil {
+		t.Error("hooks should be kept")
+	}
+	if len(settings.Permissions.AdditionalDirectories) != 1 {
+		t.Error("other permission settings should be kept")
+	}
+	if !slices.Contains(settings.Permissions.Allow, "Bash(gh pr review:*)") || !slices.Contains(settings.Permissions.Deny, "Edit") {
+		t.Errorf("permissions = %+v", settings.Permissions)
+	}
+	if settings.Permissions.DefaultMode != "default" {
+		t.Errorf("defaultMode = %q, want default", settings.Permissions.DefaultMode)
+	}
+
+	if _, err := p.Render([]byte("{not json")); err == nil {
+		t.Error("Render() should fail on invalid settings")
+	}
+}
+
+func TestInstall(t *testing.T) {
+	tmpDir := t.TempDir()
+	repoPath := filepath.Join(tmpDir, "repo")
+	worktree := filepath.Join(tmpDir, "wts", "fox")
+	sharedFile := filepath.Join(tmpDir, "claude-config", "supervisor", "settings.json")
+	if err := os.MkdirAll(filepath.Join(repoPath, ".multiclaude"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repoPath, ".multiclaude", "hooks.json"), []byte(`{"hooks": {}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("unrestricted writes nothing", func(t *testing.T) {
+		p, _ := Get(Unrestricted)
+		file, err := p.Install(repoPath, worktree, sharedFile)
+		if err != nil || file != "" {
+			t.Fatalf("Install() = %q, %v", file, err)
+		}
+		if _, err := os.Stat(filepath.Join(worktree, ".claude", "settings.json")); !os.IsNotExist(err) {
+			t.Error("unrestricted profile should not write settings")
+		}
+	})
+
+	t.Run("own worktree", func(t *testing.T) {
+		p, _ := Get("worker")
+		file, err := p.Install(repoPath, worktree, sharedFile)
+		if err != nil || file != "" {
+			t.Fatalf("Install() = %q, %v, want the worktree settings to be used", file, err)
+		}
+		data, err := os.ReadFile(filepath.Join(worktree, ".claude", "settings.json"))
+		if err != nil {
+			t.Fatalf("worktree settings not written: %v", err)
+		}
+		var settings map[string]interface{}
+		if err := json.Unmarshal(data, &settings); err != nil || settings["hooks"] == nil || settings["permissions"] == nil {
+			t.Errorf("worktree settings = %s, want hooks and permissions", data)
+		}
+	})
+
+	t.Run("shared checkout", func(t *testing.T) {
+		p, _ := Get("supervisor-cli")
+		file, err := p.Install(repoPath, repoPath, sharedFile)
+		if err != nil || file != sharedFile {
+			t.Fatalf("Install() = %q, %v, want %s", file, err, sharedFile)
+		}
+		if _, err := os.Stat(filepath.Join(repoPath, ".claude", "settings.json")); !os.IsNotExist(err) {
+			t.Error("shared checkout settings should not be written")
+		}
+		data, _ := os.ReadFile(sharedFile)
+		var settings map[string]interface{}
+		if err := json.Unmarshal(data, &settings); err != nil || settings["hooks"] != nil {
+			t.Errorf("shared settings = %s, want permissions only (hooks come from the checkout)", data)
+		}
+	})
+}
+
+func TestApply(t *testing.T) {
+	agent := state.AgentProfile{Model: "opus", ExtraArgs: []string{"--verbose"}}
+
+	unrestricted, _ := Get(Unrestricted)
+	if got := unrestricted.Apply(agent, ""); got.PermissionMode != "" {
+		t.Errorf("unrestricted Apply() = %+v, want the profile unchanged", got)
+	}
+
+	worker, _ := Get("worker")
+	got := worker.Apply(agent, "/tmp/settings.json")
+	if got.PermissionMode != "acceptEdits" || got.Model != "opus" {
+		t.Errorf("Apply() = %+v", got)
+	}
+	if !slices.Equal(got.ExtraArgs, []string{"--verbose", "--settings", "/tmp/settings.json"}) {
+		t.Errorf("Apply() extra args = %v", got.ExtraArgs)
+	}
+	if len(agent.ExtraArgs) != 1 {
+		t.Error("Apply() should not modify the agent's profile")
+	}
+
+	// The agent may pick a stricter mode, but not bypass the profile
+	if got := worker.Apply(state.AgentProfile{PermissionMode: "plan"}, ""); got.PermissionMode != "plan" {
+		t.Errorf("Apply() mode = %q, want the agent's plan mode", got.PermissionMode)
+	}
+	if got := worker.Apply(state.AgentProfile{PermissionMode: "bypassPermissions"}, ""); got.PermissionMode != "acceptEdits" {
+		t.Errorf("Apply() mode = %q, want bypassPermissions replaced", got.PermissionMode)
+	}
+
+	// Nor pass flags that bypass it
+	bypass := state.AgentProfile{ExtraArgs: []string{
+		"--dangerously-skip-permissions", "--verbose",
+		"--permission-mode", "bypassPermissions",
+		"--permission-mode=bypassPermissions",
+	}}
+	if got := worker.Apply(bypass, ""); !slices.Equal(got.ExtraArgs, []string{"--verbose"}) {
+		t.Errorf("Apply() extra args = %v, want the bypass flags dropped", got.ExtraArgs)
+	}
+	if got := unrestricted.Apply(bypass, ""); len(got.ExtraArgs) != 5 {
+		t.Errorf("unrestricted Apply() extra args = %v, want them unchanged", got.ExtraArgs)
+	}
+	widen := state.AgentProfile{ExtraArgs: []string{"--allowedTools", "Bash", "Edit", "--verbose", "--allowed-tools=Write"}}
+	if got := worker.Apply(widen, ""); !slices.Equal(got.ExtraArgs, []string{"--verbose"}) {
+		t.Errorf("Apply() extra args = %v, want the allowed tools flags dropped", got.ExtraArgs)
+	}
+
+	// Nor allow tools the profile doesn't
+	reviewer, _ := Get("reviewer-readonly")
+	tools := state.AgentProfile{AllowedTools: []string{"Read", "Bash(git log:*)", "Bash", "Bash(rm:*)", "Edit", "Write(src/*)"}}
+	if got := reviewer.Apply(tools, ""); !slices.Equal(got.AllowedTools, []string{"Read", "Bash(git log:*)"}) {
+		t.Errorf("Apply() allowed tools = %v, want those the profile permits", got.AllowedTools)
+	}
+	if got := unrestricted.Apply(tools, ""); len(got.AllowedTools) != 6 {
+		t.Errorf("unrestricted Apply() allowed tools = %v, want them unchanged", got.AllowedTools)
+	}
+}
+
+func TestPermits(t *testing.T) {
+	worker, _ := Get("worker")
+	reviewer, _ := Get("reviewer-readonly")
+	tests := []struct {
+		profile Profile
+		rule    string
+		want    bool
+	}{
+		{worker, "Read", true},
+		{worker, "Bash(git:*)", true},
+		{worker, "Bash(git log:*)", true},
+		{worker, "Bash(git push origin work/fox)", true},
+		{worker, "Bash(gitk:*)", false},
+		{worker, "Bash(go test ./...)", true},
+		{worker, "Bash(go run:*)", false},
+		{worker, "Bash", false},
+		{worker, "Edit", false},
+		{worker, "WebFetch", false},
+		{reviewer, "Bash(gh pr view:*)", true},
+		{reviewer, "Bash(gh pr merge:*)", false},
+		{reviewer, "Bash(git:*)", false},
+		{reviewer, "Edit(docs/*)", false},
+	}
+	for _, tt := range tests {
+		if got := tt.profile.Permits(tt.rule); got != tt.want {
+			t.Errorf("%s.Permits(%q) = %v, want %v", tt.profile.Name, tt.rule, got, tt.want)
+		}
+	}
+}
+
+func TestWorkerDoesNotAllowEditsOutright(t *testing.T) {
+	worker, _ := Get("worker")
+	for _, tool := range editTools {
+		if slices.Contains(worker.Allow, tool) {
+			t.Errorf("worker allows %s everywhere; edits should be left to acceptEdits", tool)
+		}
+	}
+}
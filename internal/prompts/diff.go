@@ -0,0 +1,41 @@
+package prompts
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Diff returns a unified diff from the prompt text old to new, with the two
+// sides labelled oldName and newName. It is empty when the prompts are the same.
+func Diff(oldName, old, newName, new string) (string, error) {
+	if old == new {
+		return "", nil
+	}
+
+	tmpDir, err := os.MkdirTemp("", "multiclaude-prompt-diff-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := os.WriteFile(filepath.Join(tmpDir, oldName), []byte(old), 0644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", oldName, err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, newName), []byte(new), 0644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", newName, err)
+	}
+
+	// git diff --no-index exits with 1 when the files differ
+	cmd := exec.Command("git", "diff", "--no-index", "--no-color", "--no-prefix", "--", oldName, newName)
+	cmd.Dir = tmpDir
+	output, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		err = nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to diff prompts: %w", err)
+	}
+	return string(output), nil
+}
@@ -225,6 +225,28 @@ git checkout main && git merge --ff-only upstream/main && git push origin main
 		upstreamOwner, upstreamRepo)
 }
 
+// GeneratePushToPrompt generates prompt text for a worker iterating on an
+// existing PR branch. It is prepended to the worker prompt so the worker pushes
+// to the branch instead of opening a new PR.
+func GeneratePushToPrompt(branch string) string {
+	return fmt.Sprintf(`## PR Iteration Mode
+
+**IMPORTANT: You are iterating on an existing PR, not creating a new one.**
+
+Instead of creating a new PR, push your changes to the existing branch: %s
+
+When your work is ready:
+1. Commit your changes
+2. Push to origin: git push origin %s
+3. Signal completion with: multiclaude agent complete
+
+Do NOT create a new PR. The existing PR will be updated automatically when you push.
+
+---
+
+`, branch, branch)
+}
+
 // GetSlashCommandsPrompt returns a formatted prompt section containing all available
 // slash commands. This can be included in agent prompts to document the available
 // commands.
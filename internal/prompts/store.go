@@ -0,0 +1,129 @@
+package prompts
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Store keeps the prompt files agents are launched with, in a directory per
+// repository and agent: <root>/<repo>/<agent>/v<N>.md. A prompt that differs
+// from the agent's latest version is saved as a new version rather than
+// overwriting it, so the prompt each session was started with is kept for
+// restarts, and changes to the agent's definitions since can be shown.
+type Store struct {
+	root string
+}
+
+// PromptVersion is one saved prompt of an agent
+type PromptVersion struct {
+	Number  int
+	Path    string
+	SavedAt time.Time
+}
+
+// NewStore returns a store of prompt files under root
+func NewStore(root string) *Store {
+	return &Store{root: root}
+}
+
+// Dir returns the directory of an agent's prompt versions
+func (s *Store) Dir(repoName, agentName string) string {
+	return filepath.Join(s.root, repoName, agentName)
+}
+
+// Save stores text as the agent's newest prompt and returns the path of its
+// file. When the latest version already has this text it is reused, and
+// created is false.
+func (s *Store) Save(repoName, agentName, text string) (path string, created bool, err error) {
+	versions, err := s.Versions(repoName, agentName)
+	if err != nil {
+		return "", false, err
+	}
+
+	next := 1
+	if len(versions) > 0 {
+		latest := versions[len(versions)-1]
+		if existing, err := os.ReadFile(latest.Path); err == nil && string(existing) == text {
+			return latest.Path, false, nil
+		}
+		next = latest.Number + 1
+	}
+
+	dir := s.Dir(repoName, agentName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", false, fmt.Errorf("failed to create prompt directory: %w", err)
+	}
+	path = filepath.Join(dir, fmt.Sprintf("v%d.md", next))
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		return "", false, fmt.Errorf("failed to write prompt file: %w", err)
+	}
+	return path, true, nil
+}
+
+// Versions returns the agent's saved prompts, oldest first
+func (s *Store) Versions(repoName, agentName string) ([]PromptVersion, error) {
+	entries, err := os.ReadDir(s.Dir(repoName, agentName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompt directory: %w", err)
+	}
+
+	var versions []PromptVersion
+	for _, entry := range entries {
+		number, ok := parseVersionFile(entry.Name())
+		if !ok || entry.IsDir() {
+			continue
+		}
+		version := PromptVersion{Number: number, Path: filepath.Join(s.Dir(repoName, agentName), entry.Name())}
+		if info, err := entry.Info(); err == nil {
+			version.SavedAt = info.ModTime()
+		}
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Number < versions[j].Number
+	})
+	return versions, nil
+}
+
+// Remove deletes all of an agent's prompt versions
+func (s *Store) Remove(repoName, agentName string) error {
+	if err := os.RemoveAll(s.Dir(repoName, agentName)); err != nil {
+		return fmt.Errorf("failed to remove prompts of %s: %w", agentName, err)
+	}
+	return nil
+}
+
+// RemoveRepo deletes the prompt versions of all of a repository's agents
+func (s *Store) RemoveRepo(repoName string) error {
+	if err := os.RemoveAll(filepath.Join(s.root, repoName)); err != nil {
+		return fmt.Errorf("failed to remove prompts of %s: %w", repoName, err)
+	}
+	return nil
+}
+
+// VersionOf returns the version number of a prompt file saved by a Store,
+// or 0 if path is not one
+func VersionOf(path string) int {
+	number, _ := parseVersionFile(filepath.Base(path))
+	return number
+}
+
+// parseVersionFile returns the version number of a "v<N>.md" file name
+func parseVersionFile(name string) (int, bool) {
+	if !strings.HasPrefix(name, "v") || !strings.HasSuffix(name, ".md") {
+		return 0, false
+	}
+	number, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "v"), ".md"))
+	if err != nil || number < 1 {
+		return 0, false
+	}
+	return number, true
+}
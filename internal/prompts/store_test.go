@@ -0,0 +1,98 @@
+package prompts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStoreSave(t *testing.T) {
+	root := t.TempDir()
+	store := NewStore(root)
+
+	path, created, err := store.Save("app", "supervisor", "first")
+	if err != nil || !created {
+		t.Fatalf("Save() = %q, %v, %v", path, created, err)
+	}
+	if want := filepath.Join(root, "app", "supervisor", "v1.md"); path != want {
+		t.Errorf("path = %s, want %s", path, want)
+	}
+
+	// The same prompt reuses the latest version
+	if again, created, _ := store.Save("app", "supervisor", "first"); again != path || created {
+		t.Errorf("Save() of an unchanged prompt = %q, %v, want %q reused", again, created, path)
+	}
+
+	// A changed prompt is a new version; the old one is kept
+	second, created, err := store.Save("app", "supervisor", "second")
+	if err != nil || !created || VersionOf(second) != 2 {
+		t.Fatalf("Save() = %q, %v, %v, want v2", second, created, err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "first" {
+		t.Errorf("v1 = %q, want it kept", content)
+	}
+
+	// Another repository's agent of the same name has prompts of its own
+	other, _, err := store.Save("docs", "supervisor", "docs supervisor")
+	if err != nil || VersionOf(other) != 1 {
+		t.Fatalf("Save() = %q, %v, want v1 of the other repository", other, err)
+	}
+
+	versions, err := store.Versions("app", "supervisor")
+	if err != nil || len(versions) != 2 || versions[0].Number != 1 || versions[1].Path != second {
+		t.Errorf("Versions() = %+v, %v", versions, err)
+	}
+
+	if err := store.Remove("app", "supervisor"); err != nil {
+		t.Fatalf("Remove() failed: %v", err)
+	}
+	if versions, _ := store.Versions("app", "supervisor"); len(versions) != 0 {
+		t.Errorf("Versions() after Remove() = %+v", versions)
+	}
+}
+
+func TestStoreVersionsSortNumerically(t *testing.T) {
+	store := NewStore(t.TempDir())
+	dir := store.Dir("app", "fox")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"v2.md", "v10.md", "v1.md", "notes.txt", "vx.md"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	versions, err := store.Versions("app", "fox")
+	if err != nil {
+		t.Fatalf("Versions() failed: %v", err)
+	}
+	var numbers []int
+	for _, v := range versions {
+		numbers = append(numbers, v.Number)
+	}
+	if len(numbers) != 3 || numbers[0] != 1 || numbers[1] != 2 || numbers[2] != 10 {
+		t.Errorf("version numbers = %v, want [1 2 10]", numbers)
+	}
+
+	if path, _, _ := store.Save("app", "fox", "new"); VersionOf(path) != 11 {
+		t.Errorf("Save() = %s, want v11", path)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	diff, err := Diff("v1.md", "intro\nold rule\nend\n", "current.md", "intro\nnew rule\nend\n")
+	if err != nil {
+		t.Fatalf("Diff() failed: %v", err)
+	}
+	for _, want := range []string{"--- v1.md", "+++ current.md", "-old rule", "+new rule"} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("diff should contain %q:\n%s", want, diff)
+		}
+	}
+
+	if diff, err := Diff("v1.md", "same", "current.md", "same"); err != nil || diff != "" {
+		t.Errorf("Diff() of equal prompts = %q, %v, want empty", diff, err)
+	}
+}
@@ -0,0 +1,358 @@
+// Package snapshot moves a multiclaude installation between machines. Export
+// writes tracked repositories, their agent definitions, unacknowledged
+// messages, archived work, and worker branches that exist only locally into a
+// tar.gz archive; Import rebuilds them under another set of paths.
+package snapshot
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dlorenc/multiclaude/internal/messages"
+	"github.com/dlorenc/multiclaude/internal/state"
+	"github.com/dlorenc/multiclaude/internal/worktree"
+	"github.com/dlorenc/multiclaude/pkg/config"
+)
+
+// FormatVersion is the archive layout version written by Export
+const FormatVersion = 1
+
+// Archive layout
+const (
+	manifestFile = "manifest.json"
+	stateFile    = "state.json"
+	agentsDir    = "agents"
+	messagesDir  = "messages"
+	archiveDir   = "archive"
+	branchesDir  = "branches"
+)
+
+// Manifest describes the contents of an export archive
+type Manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Repos     []string  `json:"repos"`
+	Branches  []Branch  `json:"branches,omitempty"`
+	Messages  int       `json:"messages"`
+}
+
+// Branch records the branch checked out in an agent's worktree at export time
+type Branch struct {
+	Repo     string `json:"repo"`
+	Agent    string `json:"agent"`
+	Branch   string `json:"branch"`
+	Unpushed int    `json:"unpushed,omitempty"` // Commits not on any remote
+	Bundle   string `json:"bundle,omitempty"`   // Git bundle holding the unpushed commits
+	Patch    string `json:"patch,omitempty"`    // Uncommitted changes to tracked files
+}
+
+// ExportResult summarizes an export
+type ExportResult struct {
+	Manifest Manifest
+	Warnings []string
+}
+
+// Export writes the given repositories (all tracked repositories if none are
+// named) to w as a gzipped tar archive
+func Export(paths *config.Paths, st *state.State, w io.Writer, repoNames []string) (*ExportResult, error) {
+	all := st.GetAllRepos()
+	full := len(repoNames) == 0
+	if full {
+		for name := range all {
+			repoNames = append(repoNames, name)
+		}
+	}
+	sort.Strings(repoNames)
+
+	selected := make(map[string]*state.Repository, len(repoNames))
+	for _, name := range repoNames {
+		repo, ok := all[name]
+		if !ok {
+			return nil, fmt.Errorf("repository %q is not tracked", name)
+		}
+		selected[name] = repo
+	}
+
+	tmpDir, err := os.MkdirTemp("", "multiclaude-export-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	result := &ExportResult{Manifest: Manifest{
+		Version:   FormatVersion,
+		CreatedAt: time.Now(),
+		Repos:     repoNames,
+	}}
+
+	exported := &state.State{Version: state.CurrentSchemaVersion, Repos: selected}
+	if current := st.GetCurrentRepo(); selected[current] != nil {
+		exported.CurrentRepo = current
+	}
+	if full {
+		exported.GlobalBudget = st.GetGlobalBudget()
+	}
+	data, err := json.MarshalIndent(exported, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal state: %w", err)
+	}
+	if err := addFile(tw, stateFile, data); err != nil {
+		return nil, err
+	}
+
+	msgMgr := messages.NewManager(paths.MessagesDir)
+	for _, name := range repoNames {
+		if err := addTree(tw, path.Join(agentsDir, name), paths.RepoAgentsDir(name)); err != nil {
+			return nil, fmt.Errorf("failed to add agent definitions for %s: %w", name, err)
+		}
+		if err := addTree(tw, path.Join(archiveDir, name), paths.RepoArchiveDir(name)); err != nil {
+			return nil, fmt.Errorf("failed to add archived work for %s: %w", name, err)
+		}
+
+		count, err := addMessages(tw, msgMgr, paths, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add messages for %s: %w", name, err)
+		}
+		result.Manifest.Messages += count
+
+		agentNames := make([]string, 0, len(selected[name].Agents))
+		for agentName := range selected[name].Agents {
+			agentNames = append(agentNames, agentName)
+		}
+		sort.Strings(agentNames)
+
+		for _, agentName := range agentNames {
+			agent := selected[name].Agents[agentName]
+			if !carriesWork(agent) {
+				continue
+			}
+			branch, warnings, err := exportBranch(tw, tmpDir, name, agentName, agent)
+			if err != nil {
+				return nil, fmt.Errorf("failed to export branch of %s/%s: %w", name, agentName, err)
+			}
+			result.Warnings = append(result.Warnings, warnings...)
+			if branch != nil {
+				result.Manifest.Branches = append(result.Manifest.Branches, *branch)
+			}
+		}
+	}
+
+	data, err = json.MarshalIndent(result.Manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := addFile(tw, manifestFile, data); err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return result, nil
+}
+
+// carriesWork reports whether an agent's worktree can hold work that isn't
+// on the remote: unfinished workers and the user's workspace
+func carriesWork(agent state.Agent) bool {
+	switch agent.Type {
+	case state.AgentTypeWorker:
+		return !agent.ReadyForCleanup
+	case state.AgentTypeWorkspace:
+		return true
+	}
+	return false
+}
+
+// exportBranch records the branch in an agent's worktree, bundling commits
+// that are on no remote and saving uncommitted changes as a patch. Returns nil
+// when the worktree is gone.
+func exportBranch(tw *tar.Writer, tmpDir, repoName, agentName string, agent state.Agent) (*Branch, []string, error) {
+	if agent.WorktreePath == "" {
+		return nil, nil, nil
+	}
+	if _, err := os.Stat(agent.WorktreePath); err != nil {
+		return nil, []string{fmt.Sprintf("%s/%s: worktree %s is missing, not exported", repoName, agentName, agent.WorktreePath)}, nil
+	}
+
+	name, err := worktree.GetCurrentBranch(agent.WorktreePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if name == "HEAD" {
+		return nil, []string{fmt.Sprintf("%s/%s: worktree has a detached HEAD, not exported", repoName, agentName)}, nil
+	}
+
+	branch := &Branch{Repo: repoName, Agent: agentName, Branch: name}
+	var warnings []string
+
+	out, err := gitOutput(agent.WorktreePath, "rev-list", "--count", "refs/heads/"+name, "--not", "--remotes")
+	if err != nil {
+		return nil, nil, err
+	}
+	branch.Unpushed, _ = strconv.Atoi(out)
+
+	if branch.Unpushed > 0 {
+		bundlePath := filepath.Join(tmpDir, repoName+"-"+agentName+".bundle")
+		if _, err := gitOutput(agent.WorktreePath, "bundle", "create", bundlePath, "refs/heads/"+name, "--not", "--remotes"); err != nil {
+			return nil, nil, err
+		}
+		branch.Bundle = path.Join(branchesDir, repoName, agentName+".bundle")
+		if err := addLocalFile(tw, branch.Bundle, bundlePath); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	dirty, err := worktree.HasUncommittedChanges(agent.WorktreePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if dirty {
+		changesDir := filepath.Join(tmpDir, repoName)
+		if err := worktree.ArchiveChanges(agent.WorktreePath, changesDir, agentName); err != nil {
+			return nil, nil, err
+		}
+		patchPath := filepath.Join(changesDir, agentName+".patch")
+		if info, err := os.Stat(patchPath); err == nil && info.Size() > 0 {
+			branch.Patch = path.Join(branchesDir, repoName, agentName+".patch")
+			if err := addLocalFile(tw, branch.Patch, patchPath); err != nil {
+				return nil, nil, err
+			}
+		}
+		if untracked, err := os.ReadFile(filepath.Join(changesDir, agentName+".untracked")); err == nil {
+			n := strings.Count(strings.TrimSpace(string(untracked)), "\n") + 1
+			warnings = append(warnings, fmt.Sprintf("%s/%s: %d untracked file(s) are not exported; commit them to include them", repoName, agentName, n))
+		}
+	}
+
+	return branch, warnings, nil
+}
+
+// addMessages adds the messages in a repository that haven't been
+// acknowledged. Returns the number added.
+func addMessages(tw *tar.Writer, msgMgr *messages.Manager, paths *config.Paths, repoName string) (int, error) {
+	entries, err := os.ReadDir(paths.RepoMessagesDir(repoName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	count := 0
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		msgs, err := msgMgr.List(repoName, entry.Name())
+		if err != nil {
+			return count, err
+		}
+		for _, msg := range msgs {
+			if msg.Status == messages.StatusAcked {
+				continue
+			}
+			data, err := json.MarshalIndent(msg, "", "  ")
+			if err != nil {
+				return count, fmt.Errorf("failed to marshal message: %w", err)
+			}
+			if err := addFile(tw, path.Join(messagesDir, repoName, entry.Name(), msg.ID+".json"), data); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// addTree adds the regular files under dir to the archive beneath prefix.
+// A missing dir adds nothing.
+func addTree(tw *tar.Writer, prefix, dir string) error {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+	return filepath.WalkDir(dir, func(p string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		return addLocalFile(tw, path.Join(prefix, filepath.ToSlash(rel)), p)
+	})
+}
+
+// addLocalFile streams a file on disk into the archive, since bundles can be
+// large
+func addLocalFile(tw *tar.Writer, name, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to add %s to archive: %w", name, err)
+	}
+	if _, err := io.Copy(tw, f); err != nil {
+		return fmt.Errorf("failed to add %s to archive: %w", name, err)
+	}
+	return nil
+}
+
+func addFile(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to add %s to archive: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to add %s to archive: %w", name, err)
+	}
+	return nil
+}
+
+// gitOutput runs git in dir and returns its trimmed output
+func gitOutput(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
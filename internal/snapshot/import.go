@@ -0,0 +1,505 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dlorenc/multiclaude/internal/fork"
+	"github.com/dlorenc/multiclaude/internal/messages"
+	"github.com/dlorenc/multiclaude/internal/state"
+	"github.com/dlorenc/multiclaude/internal/worktree"
+	"github.com/dlorenc/multiclaude/pkg/config"
+)
+
+// ImportResult summarizes an import
+type ImportResult struct {
+	Repos     []string
+	Worktrees int // Worktrees recreated
+	Workers   int // Workers left in state to be resumed
+	Messages  int
+	Warnings  []string
+}
+
+// Import rebuilds the repositories in an export archive under paths and adds
+// them to st. Repositories are cloned from their GitHub URL (an existing
+// clone is reused), unpushed branches are fetched from their bundles, and
+// worktrees are recreated for unfinished workers and the workspace. Only the
+// workers stay in state: the daemon recreates the tmux session, supervisor,
+// and workspace for each repository on startup and resumes the workers in
+// their worktrees. Messages are restored as pending so the new sessions
+// receive them.
+//
+// Repository and agent names in the archive are checked like the names given
+// to 'repo init' and 'agent create', since they become paths. The repositories
+// are added to st only once all of them are restored; if any fails, what the
+// import created so far is removed again.
+//
+// The daemon must not be running, since st is written directly.
+func Import(paths *config.Paths, st *state.State, r io.Reader) (result *ImportResult, err error) {
+	tmpDir, err := os.MkdirTemp("", "multiclaude-import-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := extract(r, tmpDir); err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	data, err := os.ReadFile(filepath.Join(tmpDir, manifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("not a multiclaude export: %w", err)
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if manifest.Version > FormatVersion {
+		return nil, fmt.Errorf("export has format version %d but this multiclaude only understands up to %d; upgrade multiclaude", manifest.Version, FormatVersion)
+	}
+
+	imported, err := state.LoadFrom(state.NewFileStore(filepath.Join(tmpDir, stateFile)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load exported state: %w", err)
+	}
+	repos := imported.GetAllRepos()
+
+	for _, name := range manifest.Repos {
+		if err := state.ValidateRepoName(name); err != nil {
+			return nil, fmt.Errorf("invalid export: %w", err)
+		}
+		repo, ok := repos[name]
+		if !ok {
+			return nil, fmt.Errorf("export lists repository %q but has no state for it", name)
+		}
+		for agentName := range repo.Agents {
+			if err := state.ValidateAgentName(agentName); err != nil {
+				return nil, fmt.Errorf("invalid export: %s: %w", name, err)
+			}
+		}
+		if err := checkRemoteURL(repo.GithubURL); err != nil {
+			return nil, fmt.Errorf("invalid export: %s: %w", name, err)
+		}
+		if repo.ForkConfig.UpstreamURL != "" {
+			if err := checkRemoteURL(repo.ForkConfig.UpstreamURL); err != nil {
+				return nil, fmt.Errorf("invalid export: %s: upstream: %w", name, err)
+			}
+		}
+		if _, exists := st.GetRepo(name); exists {
+			return nil, fmt.Errorf("repository %q is already tracked; remove it with 'multiclaude repo rm %s' first", name, name)
+		}
+	}
+
+	branches := make(map[string]map[string]Branch)
+	for _, b := range manifest.Branches {
+		if err := checkBranch(b); err != nil {
+			return nil, fmt.Errorf("invalid export: %w", err)
+		}
+		if branches[b.Repo] == nil {
+			branches[b.Repo] = make(map[string]Branch)
+		}
+		branches[b.Repo][b.Agent] = b
+	}
+
+	var undo rollback
+	defer func() {
+		if err != nil {
+			undo.run()
+		}
+	}()
+
+	result = &ImportResult{}
+	for _, name := range manifest.Repos {
+		if err := importRepo(paths, tmpDir, name, repos[name], branches[name], result, &undo); err != nil {
+			return result, fmt.Errorf("failed to import %s: %w", name, err)
+		}
+	}
+
+	for _, name := range manifest.Repos {
+		if err := st.AddRepo(name, repos[name]); err != nil {
+			return result, err
+		}
+		undo.add(func() { st.RemoveRepo(name) })
+		result.Repos = append(result.Repos, name)
+	}
+
+	if current := imported.GetCurrentRepo(); current != "" && st.GetCurrentRepo() == "" {
+		if err := st.SetCurrentRepo(current); err != nil {
+			return result, err
+		}
+	}
+	if budget := imported.GetGlobalBudget(); !budget.IsZero() && st.GetGlobalBudget().IsZero() {
+		if err := st.UpdateGlobalBudget(budget); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// importRepo clones a repository, restores its files and branches, and trims
+// repo.Agents down to the workers that can be resumed. What it creates is
+// recorded in undo.
+func importRepo(paths *config.Paths, tmpDir, name string, repo *state.Repository, branches map[string]Branch, result *ImportResult, undo *rollback) error {
+	repoPath := paths.RepoDir(name)
+	if _, err := os.Stat(repoPath); os.IsNotExist(err) {
+		if err := undo.mkdirAll(filepath.Dir(repoPath)); err != nil {
+			return err
+		}
+		undo.add(func() { os.RemoveAll(repoPath) })
+		if _, err := gitOutput(filepath.Dir(repoPath), "clone", "--", repo.GithubURL, repoPath); err != nil {
+			return err
+		}
+	} else if _, err := gitOutput(repoPath, "rev-parse", "--git-dir"); err != nil {
+		return fmt.Errorf("%s exists but is not a git repository", repoPath)
+	}
+
+	if repo.ForkConfig.IsFork && repo.ForkConfig.UpstreamURL != "" && !fork.HasUpstreamRemote(repoPath) {
+		if err := fork.AddUpstreamRemote(repoPath, repo.ForkConfig.UpstreamURL); err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s: failed to add upstream remote: %v", name, err))
+		} else {
+			undo.add(func() { gitOutput(repoPath, "remote", "remove", "upstream") })
+		}
+	}
+
+	if err := copyTree(filepath.Join(tmpDir, agentsDir, name), paths.RepoAgentsDir(name), undo); err != nil {
+		return fmt.Errorf("failed to restore agent definitions: %w", err)
+	}
+	if err := copyTree(filepath.Join(tmpDir, archiveDir, name), paths.RepoArchiveDir(name), undo); err != nil {
+		return fmt.Errorf("failed to restore archived work: %w", err)
+	}
+	count, err := importMessages(tmpDir, paths, name, undo)
+	if err != nil {
+		return fmt.Errorf("failed to restore messages: %w", err)
+	}
+	result.Messages += count
+
+	agentNames := make([]string, 0, len(repo.Agents))
+	for agentName := range repo.Agents {
+		agentNames = append(agentNames, agentName)
+	}
+	sort.Strings(agentNames)
+
+	for _, agentName := range agentNames {
+		agent := repo.Agents[agentName]
+		delete(repo.Agents, agentName)
+
+		branch, ok := branches[agentName]
+		if !ok || !carriesWork(agent) {
+			continue
+		}
+		wtPath := paths.AgentWorktree(name, agentName)
+		warnings, err := restoreBranch(tmpDir, repoPath, wtPath, branch, undo)
+		result.Warnings = append(result.Warnings, warnings...)
+		if err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s/%s: %v", name, agentName, err))
+			continue
+		}
+		result.Worktrees++
+
+		// The workspace is started by the daemon; workers are resumed in place
+		if agent.Type != state.AgentTypeWorker {
+			continue
+		}
+		agent.WorktreePath = wtPath
+		agent.TmuxWindow = agentName
+		agent.PID = 0
+		agent.ResumeCount = 0
+		repo.Agents[agentName] = agent
+		result.Workers++
+	}
+	return nil
+}
+
+// restoreBranch fetches an agent's branch from its bundle, checks it out in a
+// new worktree at wtPath, and reapplies uncommitted changes. The branch and
+// worktree it creates are recorded in undo.
+func restoreBranch(tmpDir, repoPath, wtPath string, b Branch, undo *rollback) ([]string, error) {
+	var warnings []string
+	wt := worktree.NewManager(repoPath)
+
+	exists, err := wt.BranchExists(b.Branch)
+	if err != nil {
+		return nil, err
+	}
+	if b.Bundle != "" {
+		if exists {
+			warnings = append(warnings, fmt.Sprintf("%s/%s: branch %s already exists, keeping it instead of the exported one", b.Repo, b.Agent, b.Branch))
+		} else {
+			bundle := filepath.Join(tmpDir, filepath.FromSlash(b.Bundle))
+			ref := "refs/heads/" + b.Branch
+			if _, err := gitOutput(repoPath, "fetch", bundle, ref+":"+ref); err != nil {
+				return warnings, fmt.Errorf("failed to fetch bundle: %w", err)
+			}
+			undo.add(func() { wt.DeleteBranch(b.Branch) })
+			exists = true
+		}
+	}
+
+	if _, err := os.Stat(wtPath); err == nil {
+		return warnings, nil
+	}
+	if err := undo.mkdirAll(filepath.Dir(wtPath)); err != nil {
+		return warnings, err
+	}
+	switch remote, _ := wt.RemoteBranchExists("origin", b.Branch); {
+	case exists:
+		err = wt.Create(wtPath, b.Branch)
+	case remote:
+		err = wt.CreateNewBranch(wtPath, b.Branch, "origin/"+b.Branch)
+	default:
+		err = wt.CreateNewBranch(wtPath, b.Branch, "HEAD")
+	}
+	if err != nil {
+		return warnings, err
+	}
+	if !exists {
+		undo.add(func() { wt.DeleteBranch(b.Branch) })
+	}
+	undo.add(func() {
+		wt.Remove(wtPath, true)
+		os.RemoveAll(wtPath)
+	})
+
+	if b.Patch != "" {
+		patch := filepath.Join(tmpDir, filepath.FromSlash(b.Patch))
+		if _, err := gitOutput(wtPath, "apply", patch); err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s/%s: uncommitted changes did not apply: %v", b.Repo, b.Agent, err))
+		}
+	}
+	return warnings, nil
+}
+
+// importMessages restores a repository's exported messages as pending,
+// leaving any message that already exists alone. Returns the number restored.
+func importMessages(tmpDir string, paths *config.Paths, repoName string, undo *rollback) (int, error) {
+	repoDir := filepath.Join(tmpDir, messagesDir, repoName)
+	agents, err := os.ReadDir(repoDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	count := 0
+	for _, agent := range agents {
+		if !agent.IsDir() {
+			continue
+		}
+		if err := state.ValidateAgentName(agent.Name()); err != nil {
+			return count, fmt.Errorf("invalid export: %w", err)
+		}
+		files, err := os.ReadDir(filepath.Join(repoDir, agent.Name()))
+		if err != nil {
+			return count, err
+		}
+		destDir := paths.AgentMessagesDir(repoName, agent.Name())
+		for _, file := range files {
+			dest := filepath.Join(destDir, file.Name())
+			if _, err := os.Stat(dest); err == nil {
+				continue
+			}
+
+			data, err := os.ReadFile(filepath.Join(repoDir, agent.Name(), file.Name()))
+			if err != nil {
+				return count, err
+			}
+			var msg messages.Message
+			if err := json.Unmarshal(data, &msg); err != nil {
+				return count, fmt.Errorf("failed to parse message %s: %w", file.Name(), err)
+			}
+			msg.Status = messages.StatusPending
+			msg.AckedAt = nil
+			if data, err = json.MarshalIndent(&msg, "", "  "); err != nil {
+				return count, fmt.Errorf("failed to marshal message: %w", err)
+			}
+
+			if err := undo.mkdirAll(destDir); err != nil {
+				return count, err
+			}
+			undo.add(func() { os.Remove(dest) })
+			if err := os.WriteFile(dest, data, 0644); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// copyTree copies the files under src into dst, overwriting files that exist.
+// A missing src copies nothing. Overwritten files are restored by undo.
+func copyTree(src, dst string, undo *rollback) error {
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return nil
+	}
+	return filepath.WalkDir(src, func(p string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if entry.IsDir() {
+			return undo.mkdirAll(target)
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if previous, err := os.ReadFile(target); err == nil {
+			undo.add(func() { os.WriteFile(target, previous, 0644) })
+		} else {
+			undo.add(func() { os.Remove(target) })
+		}
+		return os.WriteFile(target, data, 0644)
+	})
+}
+
+// checkBranch checks that a manifest entry names a valid repository and agent
+// and that its bundle and patch are inside the archive
+func checkBranch(b Branch) error {
+	if err := state.ValidateRepoName(b.Repo); err != nil {
+		return err
+	}
+	if err := state.ValidateAgentName(b.Agent); err != nil {
+		return err
+	}
+	if b.Branch == "" || strings.HasPrefix(b.Branch, "-") {
+		return fmt.Errorf("%s/%s: invalid branch name %q", b.Repo, b.Agent, b.Branch)
+	}
+	for _, file := range []string{b.Bundle, b.Patch} {
+		if file != "" && !withinArchive(file) {
+			return fmt.Errorf("%s/%s: %q is outside the archive", b.Repo, b.Agent, file)
+		}
+	}
+	return nil
+}
+
+// scpRemote matches scp-like git remotes such as git@github.com:owner/repo.git
+var scpRemote = regexp.MustCompile(`^([A-Za-z0-9._-]+@)?[A-Za-z0-9][A-Za-z0-9.-]*:[^:]`)
+
+// checkRemoteURL checks that a remote URL from an export is one git fetches
+// over the network: an https, ssh, or git URL, or an scp-like ssh address.
+// Local paths, remote helpers like ext::, and anything git could take for an
+// option are refused.
+func checkRemoteURL(remote string) error {
+	if remote == "" || strings.HasPrefix(remote, "-") || strings.ContainsAny(remote, " \t\r\n") {
+		return fmt.Errorf("invalid remote URL %q", remote)
+	}
+	if strings.Contains(remote, "://") {
+		u, err := url.Parse(remote)
+		if err != nil {
+			return fmt.Errorf("invalid remote URL %q: %w", remote, err)
+		}
+		switch u.Scheme {
+		case "https", "ssh", "git":
+		default:
+			return fmt.Errorf("remote URL %q has unsupported scheme %q (want https, ssh, or git)", remote, u.Scheme)
+		}
+		if u.Host == "" || strings.HasPrefix(u.Host, "-") {
+			return fmt.Errorf("remote URL %q has no valid host", remote)
+		}
+		return nil
+	}
+	if !scpRemote.MatchString(remote) {
+		return fmt.Errorf("remote URL %q is not an https, ssh, or git URL", remote)
+	}
+	return nil
+}
+
+// withinArchive reports whether a slash-separated archive path stays inside
+// the directory it is extracted to
+func withinArchive(name string) bool {
+	name = filepath.Clean(filepath.FromSlash(name))
+	return !filepath.IsAbs(name) && name != ".." && !strings.HasPrefix(name, ".."+string(filepath.Separator))
+}
+
+// rollback is the list of steps that undo an import, run newest first when
+// the import fails
+type rollback []func()
+
+// add records a step undoing a change just made
+func (r *rollback) add(step func()) {
+	*r = append(*r, step)
+}
+
+// mkdirAll creates dir and any missing parents, recording the removal of the
+// outermost directory it created
+func (r *rollback) mkdirAll(dir string) error {
+	created := ""
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil || filepath.Dir(d) == d {
+			break
+		}
+		created = d
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if created != "" {
+		r.add(func() { os.RemoveAll(created) })
+	}
+	return nil
+}
+
+// run undoes the recorded changes, newest first
+func (r rollback) run() {
+	for i := len(r) - 1; i >= 0; i-- {
+		r[i]()
+	}
+}
+
+// extract unpacks a gzipped tar archive into dir, refusing entries that
+// would land outside it
+func extract(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("not a gzipped archive: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if !withinArchive(hdr.Name) {
+			return fmt.Errorf("archive entry %q is outside the archive", hdr.Name)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to extract %s: %w", hdr.Name, err)
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+}
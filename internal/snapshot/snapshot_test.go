@@ -0,0 +1,361 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dlorenc/multiclaude/internal/messages"
+	"github.com/dlorenc/multiclaude/internal/state"
+	"github.com/dlorenc/multiclaude/pkg/config"
+)
+
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	args = append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, output)
+	}
+}
+
+// localRemotes has git fetch URLs under the returned https base from the
+// returned directory, since imports only accept network remotes
+func localRemotes(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	base := "https://git.example.invalid/"
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	t.Setenv("GIT_CONFIG_KEY_0", "url."+dir+"/.insteadOf")
+	t.Setenv("GIT_CONFIG_VALUE_0", base)
+	return dir, base
+}
+
+func newTestPaths(t *testing.T) *config.Paths {
+	t.Helper()
+	paths := config.NewTestPaths(t.TempDir())
+	if err := paths.EnsureDirectories(); err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+// setupInstallation creates a remote and an installation tracking it with a
+// worker that has an unpushed commit and uncommitted changes, a finished
+// worker, agent definitions, and messages
+func setupInstallation(t *testing.T) (*config.Paths, *state.State, string) {
+	t.Helper()
+
+	seed := t.TempDir()
+	runGit(t, seed, "init", "-b", "main")
+	os.WriteFile(filepath.Join(seed, "README.md"), []byte("hello\n"), 0644)
+	runGit(t, seed, "add", "README.md")
+	runGit(t, seed, "commit", "-m", "Initial commit")
+	remotes, base := localRemotes(t)
+	remote := filepath.Join(remotes, "remote.git")
+	runGit(t, seed, "clone", "--bare", seed, remote)
+
+	paths := newTestPaths(t)
+	repoPath := paths.RepoDir("my-app")
+	runGit(t, paths.ReposDir, "clone", remote, repoPath)
+
+	foxPath := paths.AgentWorktree("my-app", "fox")
+	runGit(t, repoPath, "worktree", "add", "-b", "work/fox", foxPath)
+	os.WriteFile(filepath.Join(foxPath, "auth.go"), []byte("package auth\n"), 0644)
+	runGit(t, foxPath, "add", "auth.go")
+	runGit(t, foxPath, "commit", "-m", "Add auth")
+	os.WriteFile(filepath.Join(foxPath, "README.md"), []byte("hello\nauth\n"), 0644)
+	os.WriteFile(filepath.Join(foxPath, "notes.txt"), []byte("scratch\n"), 0644)
+
+	os.MkdirAll(paths.RepoAgentsDir("my-app"), 0755)
+	os.WriteFile(filepath.Join(paths.RepoAgentsDir("my-app"), "reviewer.md"), []byte("# Reviewer\n"), 0644)
+
+	msgMgr := messages.NewManager(paths.MessagesDir)
+	if _, err := msgMgr.Send("my-app", "supervisor", "fox", "Remember the tests"); err != nil {
+		t.Fatal(err)
+	}
+	acked, err := msgMgr.Send("my-app", "supervisor", "fox", "Old news")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgMgr.Ack("my-app", "fox", acked.ID)
+
+	st := state.New(paths.StateFile)
+	repo := &state.Repository{
+		GithubURL:   base + "remote.git",
+		TmuxSession: "mc-my-app",
+		Agents: map[string]state.Agent{
+			"supervisor": {Type: state.AgentTypeSupervisor, WorktreePath: repoPath, TmuxWindow: "supervisor", PID: 10},
+			"fox":        {Type: state.AgentTypeWorker, WorktreePath: foxPath, TmuxWindow: "fox", Task: "Add auth", PID: 11, ResumeCount: 2, CreatedAt: time.Now()},
+			"owl":        {Type: state.AgentTypeWorker, Task: "Fix bug", ReadyForCleanup: true},
+		},
+		TaskHistory: []state.TaskHistoryEntry{{Name: "bee", Task: "Docs", Status: state.TaskStatusMerged}},
+	}
+	if err := st.AddRepo("my-app", repo); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetCurrentRepo("my-app"); err != nil {
+		t.Fatal(err)
+	}
+	return paths, st, foxPath
+}
+
+func TestExportImport(t *testing.T) {
+	srcPaths, srcState, _ := setupInstallation(t)
+
+	var archive bytes.Buffer
+	exported, err := Export(srcPaths, srcState, &archive, nil)
+	if err != nil {
+		t.Fatalf("Export() failed: %v", err)
+	}
+	if len(exported.Manifest.Branches) != 1 {
+		t.Fatalf("branches = %+v, want only fox", exported.Manifest.Branches)
+	}
+	fox := exported.Manifest.Branches[0]
+	if fox.Agent != "fox" || fox.Branch != "work/fox" || fox.Unpushed != 1 || fox.Bundle == "" || fox.Patch == "" {
+		t.Errorf("fox branch = %+v", fox)
+	}
+	if exported.Manifest.Messages != 1 {
+		t.Errorf("exported %d messages, want only the unacked one", exported.Manifest.Messages)
+	}
+	if len(exported.Warnings) != 1 || !strings.Contains(exported.Warnings[0], "untracked") {
+		t.Errorf("warnings = %v, want one about the untracked file", exported.Warnings)
+	}
+
+	dstPaths := newTestPaths(t)
+	dstState := state.New(dstPaths.StateFile)
+	imported, err := Import(dstPaths, dstState, bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		t.Fatalf("Import() failed: %v", err)
+	}
+	if imported.Worktrees != 1 || imported.Workers != 1 || imported.Messages != 1 || len(imported.Warnings) != 0 {
+		t.Errorf("import result = %+v", imported)
+	}
+
+	repo, ok := dstState.GetRepo("my-app")
+	if !ok {
+		t.Fatal("repository not imported")
+	}
+	if len(repo.Agents) != 1 {
+		t.Errorf("agents = %v, want only the unfinished worker", repo.Agents)
+	}
+	agent := repo.Agents["fox"]
+	foxPath := dstPaths.AgentWorktree("my-app", "fox")
+	if agent.WorktreePath != foxPath || agent.PID != 0 || agent.ResumeCount != 0 || agent.Task != "Add auth" {
+		t.Errorf("imported fox = %+v", agent)
+	}
+	if len(repo.TaskHistory) != 1 || repo.TaskHistory[0].Name != "bee" {
+		t.Errorf("task history = %+v", repo.TaskHistory)
+	}
+	if dstState.GetCurrentRepo() != "my-app" {
+		t.Errorf("current repo = %q", dstState.GetCurrentRepo())
+	}
+
+	// The unpushed commit and the uncommitted change come back in the worktree
+	if _, err := os.Stat(filepath.Join(foxPath, "auth.go")); err != nil {
+		t.Errorf("unpushed commit not restored: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(foxPath, "README.md")); string(data) != "hello\nauth\n" {
+		t.Errorf("README.md = %q, want the uncommitted change applied", data)
+	}
+	if _, err := os.Stat(filepath.Join(dstPaths.RepoAgentsDir("my-app"), "reviewer.md")); err != nil {
+		t.Errorf("agent definition not restored: %v", err)
+	}
+
+	msgs, err := messages.NewManager(dstPaths.MessagesDir).List("my-app", "fox")
+	if err != nil || len(msgs) != 1 || msgs[0].Body != "Remember the tests" || msgs[0].Status != messages.StatusPending {
+		t.Errorf("imported messages = %+v, %v", msgs, err)
+	}
+
+	// Importing again would clobber the tracked repository
+	if _, err := Import(dstPaths, dstState, bytes.NewReader(archive.Bytes())); err == nil || !strings.Contains(err.Error(), "already tracked") {
+		t.Errorf("second Import() error = %v, want already tracked", err)
+	}
+}
+
+func TestExportUnknownRepo(t *testing.T) {
+	paths := newTestPaths(t)
+	st := state.New(paths.StateFile)
+	if _, err := Export(paths, st, &bytes.Buffer{}, []string{"missing"}); err == nil {
+		t.Error("Export() should fail for an untracked repository")
+	}
+}
+
+// writeArchive builds an export archive holding manifest, the given
+// repositories as its state, and files
+func writeArchive(t *testing.T, manifest Manifest, repos map[string]*state.Repository, files map[string]string) []byte {
+	t.Helper()
+
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	st := state.New(statePath)
+	for name, repo := range repos {
+		if err := st.AddRepo(name, repo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.Save(); err != nil {
+		t.Fatal(err)
+	}
+	stateData, err := os.ReadFile(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifestData, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	add := func(name string, data []byte) {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add(manifestFile, manifestData)
+	add(stateFile, stateData)
+	for name, content := range files {
+		add(name, []byte(content))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImportRejectsUnsafeNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest Manifest
+		repos    map[string]*state.Repository
+	}{
+		{
+			name:     "repository outside the repos directory",
+			manifest: Manifest{Version: FormatVersion, Repos: []string{"../evil"}},
+			repos:    map[string]*state.Repository{"../evil": {GithubURL: "https://github.com/test/evil"}},
+		},
+		{
+			name:     "agent outside the worktrees directory",
+			manifest: Manifest{Version: FormatVersion, Repos: []string{"my-app"}},
+			repos: map[string]*state.Repository{"my-app": {
+				GithubURL: "https://github.com/test/my-app",
+				Agents:    map[string]state.Agent{"../../evil": {Type: state.AgentTypeWorker}},
+			}},
+		},
+		{
+			name: "branch of an agent outside the worktrees directory",
+			manifest: Manifest{Version: FormatVersion, Repos: []string{"my-app"}, Branches: []Branch{
+				{Repo: "my-app", Agent: "../evil", Branch: "work/evil"},
+			}},
+			repos: map[string]*state.Repository{"my-app": {GithubURL: "https://github.com/test/my-app"}},
+		},
+		{
+			name: "bundle outside the archive",
+			manifest: Manifest{Version: FormatVersion, Repos: []string{"my-app"}, Branches: []Branch{
+				{Repo: "my-app", Agent: "fox", Branch: "work/fox", Bundle: "../../fox.bundle"},
+			}},
+			repos: map[string]*state.Repository{"my-app": {GithubURL: "https://github.com/test/my-app"}},
+		},
+		{
+			name:     "remote that is a git option",
+			manifest: Manifest{Version: FormatVersion, Repos: []string{"my-app"}},
+			repos:    map[string]*state.Repository{"my-app": {GithubURL: "--upload-pack=touch /tmp/pwned"}},
+		},
+		{
+			name:     "remote on the local filesystem",
+			manifest: Manifest{Version: FormatVersion, Repos: []string{"my-app"}},
+			repos:    map[string]*state.Repository{"my-app": {GithubURL: "file:///etc"}},
+		},
+		{
+			name:     "remote through a transport helper",
+			manifest: Manifest{Version: FormatVersion, Repos: []string{"my-app"}},
+			repos:    map[string]*state.Repository{"my-app": {GithubURL: "ext::sh -c touch% /tmp/pwned"}},
+		},
+		{
+			name:     "remote given as a local path",
+			manifest: Manifest{Version: FormatVersion, Repos: []string{"my-app"}},
+			repos:    map[string]*state.Repository{"my-app": {GithubURL: "/srv/git/my-app.git"}},
+		},
+		{
+			name:     "upstream that is a git option",
+			manifest: Manifest{Version: FormatVersion, Repos: []string{"my-app"}},
+			repos: map[string]*state.Repository{"my-app": {
+				GithubURL:  "git@github.com:test/my-app.git",
+				ForkConfig: state.ForkConfig{IsFork: true, UpstreamURL: "-oProxyCommand=touch /tmp/pwned"},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths := newTestPaths(t)
+			st := state.New(paths.StateFile)
+			archive := writeArchive(t, tt.manifest, tt.repos, nil)
+
+			if _, err := Import(paths, st, bytes.NewReader(archive)); err == nil || !strings.Contains(err.Error(), "invalid export") {
+				t.Errorf("Import() error = %v, want the archive refused", err)
+			}
+			if len(st.GetAllRepos()) != 0 {
+				t.Error("no repository should be added")
+			}
+		})
+	}
+}
+
+func TestImportRollsBackOnFailure(t *testing.T) {
+	remotes, base := localRemotes(t)
+	seed := filepath.Join(remotes, "my-app")
+	runGit(t, remotes, "init", "-b", "main", seed)
+	os.WriteFile(filepath.Join(seed, "README.md"), []byte("hello\n"), 0644)
+	runGit(t, seed, "add", "README.md")
+	runGit(t, seed, "commit", "-m", "Initial commit")
+
+	paths := newTestPaths(t)
+	st := state.New(paths.StateFile)
+
+	// my-app restores fine, but broken cannot be cloned
+	archive := writeArchive(t,
+		Manifest{Version: FormatVersion, Repos: []string{"my-app", "broken"}},
+		map[string]*state.Repository{
+			"my-app": {GithubURL: base + "my-app"},
+			"broken": {GithubURL: base + "missing.git"},
+		},
+		map[string]string{
+			"agents/my-app/reviewer.md":                 "# Reviewer\n",
+			"messages/my-app/fox/msg-1.json":            `{"id":"msg-1","from":"supervisor","to":"fox","body":"Hi"}`,
+			"archive/my-app/work-fox/notes.txt":         "scratch\n",
+			"agents/my-app/nested/shared/checklist.txt": "- tests\n",
+		})
+
+	if _, err := Import(paths, st, bytes.NewReader(archive)); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Fatalf("Import() error = %v, want broken to fail", err)
+	}
+	if len(st.GetAllRepos()) != 0 {
+		t.Errorf("repos = %v, want none added", st.GetAllRepos())
+	}
+	for _, path := range []string{
+		paths.RepoDir("my-app"),
+		paths.RepoAgentsDir("my-app"),
+		paths.RepoArchiveDir("my-app"),
+		paths.AgentMessagesDir("my-app", "fox"),
+	} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s should be removed by the rollback", path)
+		}
+	}
+}
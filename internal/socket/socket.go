@@ -1,11 +1,14 @@
 package socket
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
+	"sync"
 )
 
 // Request represents a request sent to the daemon
@@ -70,11 +73,83 @@ func (c *Client) Send(req Request) (*Response, error) {
 	return &resp, nil
 }
 
+// ErrStopStream can be returned from a Subscribe callback to end the stream cleanly
+var ErrStopStream = errors.New("stop stream")
+
+// Subscribe sends a streaming request and keeps the connection open. The daemon
+// first replies with a Response; if it is successful, fn is called with each
+// newline-delimited JSON value that follows until fn returns an error or the
+// daemon closes the connection. Returning ErrStopStream from fn ends the
+// subscription without an error.
+func (c *Client) Subscribe(req Request, fn func(json.RawMessage) error) error {
+	conn, err := net.Dial("unix", c.socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to connect to daemon: %w", err)
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(conn))
+
+	var resp Response
+	if err := dec.Decode(&resp); err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if !resp.Success {
+		return errors.New(resp.Error)
+	}
+
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("failed to read event: %w", err)
+		}
+		if err := fn(raw); err != nil {
+			if errors.Is(err, ErrStopStream) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
 // Server listens on a Unix socket for requests
 type Server struct {
 	socketPath string
 	listener   net.Listener
 	handler    Handler
+	streams    map[string]StreamHandler
+}
+
+// StreamHandler serves a command that keeps its connection open. It must first
+// send a Response (use ErrorResponse to reject the request), then may send any
+// number of values, each written as one JSON line. The connection is closed
+// when the handler returns.
+type StreamHandler func(req Request, stream *Stream)
+
+// Stream is the server side of a streaming connection
+type Stream struct {
+	mu   sync.Mutex
+	enc  *json.Encoder
+	done chan struct{}
+}
+
+// Send writes v to the client as a single JSON line
+func (s *Stream) Send(v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(v)
+}
+
+// Done is closed when the client disconnects
+func (s *Stream) Done() <-chan struct{} {
+	return s.done
 }
 
 // Handler processes requests
@@ -98,6 +173,15 @@ func NewServer(socketPath string, handler Handler) *Server {
 	}
 }
 
+// HandleStream registers a streaming handler for a command. Requests for that
+// command are routed to fn instead of the regular Handler.
+func (s *Server) HandleStream(command string, fn StreamHandler) {
+	if s.streams == nil {
+		s.streams = make(map[string]StreamHandler)
+	}
+	s.streams[command] = fn
+}
+
 // Start starts the socket server
 func (s *Server) Start() error {
 	// Remove stale socket file if exists
@@ -164,9 +248,32 @@ func (s *Server) handleConnection(conn net.Conn) {
 		return
 	}
 
+	if fn, ok := s.streams[req.Command]; ok {
+		s.serveStream(conn, req, fn)
+		return
+	}
+
 	resp := s.handler.Handle(req)
 	if err := json.NewEncoder(conn).Encode(resp); err != nil {
 		// Can't send error response at this point
 		return
 	}
 }
+
+// serveStream runs a streaming handler, closing its Done channel once the
+// client hangs up. Clients don't send anything after the request, so any
+// read result means the connection is finished.
+func (s *Server) serveStream(conn net.Conn, req Request, fn StreamHandler) {
+	stream := &Stream{
+		enc:  json.NewEncoder(conn),
+		done: make(chan struct{}),
+	}
+
+	go func() {
+		buf := make([]byte, 1)
+		conn.Read(buf)
+		close(stream.done)
+	}()
+
+	fn(req, stream)
+}
@@ -346,3 +346,76 @@ func TestServerStopRemovesSocket(t *testing.T) {
 		t.Error("Socket file should be removed after Stop()")
 	}
 }
+
+func TestStreamSubscribe(t *testing.T) {
+	tmpDir := t.TempDir()
+	sockPath := filepath.Join(tmpDir, "test.sock")
+
+	handler := HandlerFunc(func(req Request) Response {
+		return Response{Success: true}
+	})
+
+	disconnected := make(chan struct{})
+	server := NewServer(sockPath, handler)
+	server.HandleStream("watch", func(req Request, stream *Stream) {
+		if req.Args["fail"] == true {
+			stream.Send(ErrorResponse("bad filter"))
+			return
+		}
+		stream.Send(SuccessResponse(nil))
+		for i := 0; i < 3; i++ {
+			stream.Send(map[string]int{"n": i})
+		}
+		<-stream.Done()
+		close(disconnected)
+	})
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start() failed: %v", err)
+	}
+	defer server.Stop()
+	go server.Serve()
+
+	client := NewClient(sockPath)
+
+	// Handler rejects the request
+	err := client.Subscribe(Request{Command: "watch", Args: map[string]interface{}{"fail": true}}, func(json.RawMessage) error {
+		t.Error("callback should not run for a rejected subscription")
+		return nil
+	})
+	if err == nil || err.Error() != "bad filter" {
+		t.Errorf("Subscribe() error = %v, want 'bad filter'", err)
+	}
+
+	// Stream values until the callback stops
+	var got []int
+	err = client.Subscribe(Request{Command: "watch"}, func(raw json.RawMessage) error {
+		var v map[string]int
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return err
+		}
+		got = append(got, v["n"])
+		if len(got) == 3 {
+			return ErrStopStream
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Subscribe() failed: %v", err)
+	}
+	if len(got) != 3 || got[0] != 0 || got[2] != 2 {
+		t.Errorf("received %v, want [0 1 2]", got)
+	}
+
+	// Closing the client side should be noticed by the handler
+	select {
+	case <-disconnected:
+	case <-time.After(2 * time.Second):
+		t.Error("stream handler was not notified of client disconnect")
+	}
+
+	// Regular commands still use the request/response handler
+	resp, err := client.Send(Request{Command: "other"})
+	if err != nil || !resp.Success {
+		t.Errorf("Send() = %v, %v; want success", resp, err)
+	}
+}
@@ -0,0 +1,143 @@
+package state
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// CurrentSchemaVersion is the version of the state file this build reads and
+// writes. Bump it together with a new entry in migrations whenever a field is
+// renamed, moved, or needs a value filled in for existing state.
+const CurrentSchemaVersion = 1
+
+// Migration upgrades a raw state document from Version-1 to Version
+type Migration struct {
+	Version     int
+	Description string
+	Migrate     func(doc map[string]interface{}) error
+}
+
+// migrations are applied in order to documents older than their version.
+// They work on the decoded JSON rather than the structs so that they can see
+// fields the structs no longer have.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "store merge queue and PR shepherd defaults explicitly",
+		Migrate:     migrateExplicitDefaults,
+	},
+}
+
+// Migrations returns the registered migrations in order
+func Migrations() []Migration {
+	return append([]Migration(nil), migrations...)
+}
+
+// docVersion returns the schema version recorded in a raw state document;
+// files written before versioning have none and count as version 0
+func docVersion(doc map[string]interface{}) (int, error) {
+	raw, ok := doc["version"]
+	if !ok || raw == nil {
+		return 0, nil
+	}
+	var version int
+	if _, err := fmt.Sscan(fmt.Sprint(raw), &version); err != nil {
+		return 0, fmt.Errorf("invalid state schema version %v", raw)
+	}
+	return version, nil
+}
+
+// migrateDoc runs the migrations newer than the document's version and
+// records the current version in it. Returns the version it started at.
+func migrateDoc(doc map[string]interface{}) (int, error) {
+	from, err := docVersion(doc)
+	if err != nil {
+		return 0, err
+	}
+	if from > CurrentSchemaVersion {
+		return from, fmt.Errorf("state file has schema version %d but this multiclaude only understands up to %d; upgrade multiclaude", from, CurrentSchemaVersion)
+	}
+	for _, m := range migrations {
+		if m.Version <= from {
+			continue
+		}
+		if err := m.Migrate(doc); err != nil {
+			return from, fmt.Errorf("state migration to version %d (%s) failed: %w", m.Version, m.Description, err)
+		}
+	}
+	doc["version"] = CurrentSchemaVersion
+	return from, nil
+}
+
+// upgradeDoc migrates a raw state document loaded from files, copying each
+// file that exists to <file>.v<version>.bak first. An existing backup is
+// kept, so the first copy of the old state survives repeated loads. Returns
+// the version the document was at.
+func upgradeDoc(doc map[string]interface{}, files ...string) (int, error) {
+	from, err := docVersion(doc)
+	if err != nil {
+		return 0, err
+	}
+	if from < CurrentSchemaVersion {
+		for _, file := range files {
+			if err := backupFile(file, fmt.Sprintf("%s.v%d.bak", file, from)); err != nil {
+				return from, fmt.Errorf("failed to back up %s before migration: %w", file, err)
+			}
+		}
+	}
+	return migrateDoc(doc)
+}
+
+// backupFile copies src to dst unless src is missing or dst already exists
+func backupFile(src, dst string) error {
+	if _, err := os.Stat(dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+// migrateExplicitDefaults fills in the merge queue and PR shepherd configs
+// that older state left empty and the getters defaulted at read time, and
+// gives repositories without agents an empty map
+func migrateExplicitDefaults(doc map[string]interface{}) error {
+	repos, _ := doc["repos"].(map[string]interface{})
+	for _, raw := range repos {
+		repo, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, ok := repo["agents"].(map[string]interface{}); !ok {
+			repo["agents"] = map[string]interface{}{}
+		}
+		defaults := map[string]MergeQueueConfig{
+			"merge_queue_config": DefaultMergeQueueConfig(),
+			"pr_shepherd_config": MergeQueueConfig(DefaultPRShepherdConfig()),
+		}
+		for key, def := range defaults {
+			config, _ := repo[key].(map[string]interface{})
+			if mode, _ := config["track_mode"].(string); mode == "" {
+				repo[key] = map[string]interface{}{"enabled": def.Enabled, "track_mode": string(def.TrackMode)}
+			}
+		}
+	}
+	return nil
+}
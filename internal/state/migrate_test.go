@@ -0,0 +1,136 @@
+package state
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const unversionedState = `{
+  "repos": {
+    "my-app": {
+      "github_url": "https://github.com/test/my-app",
+      "tmux_session": "mc-my-app",
+      "agents": null,
+      "merge_queue_config": {"enabled": false, "track_mode": ""}
+    }
+  },
+  "current_repo": "my-app"
+}`
+
+func TestMigrationsAreOrdered(t *testing.T) {
+	for i, m := range Migrations() {
+		if m.Version != i+1 {
+			t.Errorf("migration %d has version %d, want %d", i, m.Version, i+1)
+		}
+		if m.Description == "" || m.Migrate == nil {
+			t.Errorf("migration %d is incomplete", m.Version)
+		}
+	}
+	if n := len(Migrations()); n != CurrentSchemaVersion {
+		t.Errorf("%d migrations registered, want one per version up to %d", n, CurrentSchemaVersion)
+	}
+}
+
+func TestLoadMigratesUnversionedState(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(statePath, []byte(unversionedState), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Load(statePath)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if s.Version != CurrentSchemaVersion {
+		t.Errorf("Version = %d, want %d", s.Version, CurrentSchemaVersion)
+	}
+	repo, _ := s.GetRepo("my-app")
+	if repo.Agents == nil {
+		t.Error("migration should give repositories an agents map")
+	}
+	if repo.MergeQueueConfig != DefaultMergeQueueConfig() || repo.PRShepherdConfig != DefaultPRShepherdConfig() {
+		t.Errorf("configs = %+v / %+v, want the defaults", repo.MergeQueueConfig, repo.PRShepherdConfig)
+	}
+
+	backup, err := os.ReadFile(statePath + ".v0.bak")
+	if err != nil || string(backup) != unversionedState {
+		t.Fatalf("backup missing or changed: %v", err)
+	}
+
+	// The migrated state is written out on the next change
+	if err := s.AddAgent("my-app", "fox", Agent{Type: AgentTypeWorker, CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("AddAgent() failed: %v", err)
+	}
+	report, err := CheckSchemaFile(statePath)
+	if err != nil {
+		t.Fatalf("CheckSchemaFile() failed: %v", err)
+	}
+	if report.Version != CurrentSchemaVersion || report.Problems() != 0 {
+		t.Errorf("schema after migration = %+v", report)
+	}
+}
+
+func TestLoadRejectsNewerSchema(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	data := fmt.Sprintf(`{"version": %d, "repos": {}}`, CurrentSchemaVersion+1)
+	if err := os.WriteFile(statePath, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(statePath); err == nil || !strings.Contains(err.Error(), "upgrade multiclaude") {
+		t.Errorf("Load() error = %v, want a schema version error", err)
+	}
+}
+
+func TestCheckSchema(t *testing.T) {
+	data := fmt.Sprintf(`{
+  "version": %d,
+  "repos": {
+    "my-app": {
+      "github_url": "https://github.com/test/my-app",
+      "agents": {
+        "fox": {"type": "worker", "worktree_path": "/tmp/fox", "tmux_window": "fox", "pid": "42", "created_at": "yesterday", "mood": "happy"}
+      },
+      "task_history": [{"name": "owl", "task": "t", "branch": "b", "status": "merged", "created_at": "2026-01-02T10:00:00Z", "extra": 1}]
+    }
+  },
+  "hooks": {}
+}`, CurrentSchemaVersion)
+
+	report, err := CheckSchema([]byte(data))
+	if err != nil {
+		t.Fatalf("CheckSchema() failed: %v", err)
+	}
+	wantUnknown := []string{"hooks", "repos.my-app.agents.fox.mood", "repos.my-app.task_history[0].extra"}
+	if !slices.Equal(report.Unknown, wantUnknown) {
+		t.Errorf("Unknown = %v, want %v", report.Unknown, wantUnknown)
+	}
+	wantMissing := []string{"repos.my-app.agents.fox.session_id", "repos.my-app.tmux_session"}
+	if !slices.Equal(report.Missing, wantMissing) {
+		t.Errorf("Missing = %v, want %v", report.Missing, wantMissing)
+	}
+	if len(report.Invalid) != 2 || !strings.HasPrefix(report.Invalid[0], "repos.my-app.agents.fox.created_at") ||
+		!strings.HasPrefix(report.Invalid[1], "repos.my-app.agents.fox.pid: want integer") {
+		t.Errorf("Invalid = %v", report.Invalid)
+	}
+
+	// State written by this build matches its own schema
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	s := New(statePath)
+	if err := s.AddRepo("my-app", &Repository{Agents: map[string]Agent{"fox": {Type: AgentTypeWorker}}}); err != nil {
+		t.Fatalf("AddRepo() failed: %v", err)
+	}
+	if err := s.AddTaskHistory("my-app", TaskHistoryEntry{Name: "owl", Status: TaskStatusMerged}); err != nil {
+		t.Fatalf("AddTaskHistory() failed: %v", err)
+	}
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	if report, err := CheckSchemaFile(statePath); err != nil || report.Problems() != 0 {
+		t.Errorf("CheckSchemaFile() = %+v, %v; want no problems", report, err)
+	}
+}
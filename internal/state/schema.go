@@ -0,0 +1,216 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SchemaReport describes how a state file differs from the current structs
+type SchemaReport struct {
+	Version int      // Schema version recorded in the file (0 if none)
+	Current int      // Schema version this build writes
+	Unknown []string // Fields in the file the structs don't have
+	Missing []string // Required fields the file doesn't have
+	Invalid []string // Fields whose value has the wrong JSON type
+}
+
+// Problems returns the number of fields that don't match the structs
+func (r *SchemaReport) Problems() int {
+	return len(r.Unknown) + len(r.Missing) + len(r.Invalid)
+}
+
+// CheckSchemaFile validates the state file at path against the current
+// structs. The file is checked as written, without migrating it or replaying
+// the journal.
+func CheckSchemaFile(path string) (*SchemaReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+	return CheckSchema(data)
+}
+
+// CheckSchema validates a state document against the current structs. Fields
+// without omitempty are required; map keys and slice positions appear in the
+// reported paths, e.g. repos.my-app.agents.clever-fox.pid.
+func CheckSchema(data []byte) (*SchemaReport, error) {
+	doc, err := decodeRaw(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse state file: %w", err)
+	}
+	version, err := docVersion(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	// The journal's stamp on snapshots is not part of State
+	delete(doc, "journal_generation")
+
+	report := &SchemaReport{Version: version, Current: CurrentSchemaVersion}
+	checkValue(report, "", doc, reflect.TypeOf(State{}))
+	sort.Strings(report.Unknown)
+	sort.Strings(report.Missing)
+	sort.Strings(report.Invalid)
+	return report, nil
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// checkValue compares a decoded JSON value with the Go type it unmarshals into
+func checkValue(report *SchemaReport, path string, value interface{}, t reflect.Type) {
+	if value == nil {
+		return
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	invalid := func(want string) {
+		report.Invalid = append(report.Invalid, fmt.Sprintf("%s: want %s, got %s", displayPath(path), want, jsonKind(value)))
+	}
+
+	switch {
+	case t == timeType:
+		s, ok := value.(string)
+		if !ok {
+			invalid("RFC 3339 time")
+		} else if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+			invalid("RFC 3339 time")
+		}
+		return
+	case t == rawMessageType || t.Kind() == reflect.Interface:
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			invalid("object")
+			return
+		}
+		known := make(map[string]bool)
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, omitempty := jsonFieldName(field)
+			if name == "-" {
+				continue
+			}
+			known[name] = true
+			fieldValue, present := obj[name]
+			if !present {
+				if !omitempty {
+					report.Missing = append(report.Missing, joinPath(path, name))
+				}
+				continue
+			}
+			checkValue(report, joinPath(path, name), fieldValue, field.Type)
+		}
+		for name := range obj {
+			if !known[name] {
+				report.Unknown = append(report.Unknown, joinPath(path, name))
+			}
+		}
+	case reflect.Map:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			invalid("object")
+			return
+		}
+		for key, v := range obj {
+			checkValue(report, joinPath(path, key), v, t.Elem())
+		}
+	case reflect.Slice, reflect.Array:
+		list, ok := value.([]interface{})
+		if !ok {
+			invalid("array")
+			return
+		}
+		for i, v := range list {
+			checkValue(report, fmt.Sprintf("%s[%d]", path, i), v, t.Elem())
+		}
+	case reflect.String:
+		if _, ok := value.(string); !ok {
+			invalid("string")
+		}
+	case reflect.Bool:
+		if _, ok := value.(bool); !ok {
+			invalid("boolean")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := value.(json.Number)
+		if !ok {
+			invalid("integer")
+		} else if _, err := n.Int64(); err != nil {
+			invalid("integer")
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, ok := value.(json.Number); !ok {
+			invalid("number")
+		}
+	}
+}
+
+// jsonFieldName returns the JSON name of a struct field and whether it's
+// omitted when empty
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "" {
+		return field.Name, false
+	}
+	parts := strings.Split(tag, ",")
+	name := parts[0]
+	if name == "" {
+		name = field.Name
+	}
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			return name, true
+		}
+	}
+	return name, false
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "(root)"
+	}
+	return path
+}
+
+// jsonKind names the JSON type of a decoded value
+func jsonKind(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
@@ -1,10 +1,13 @@
 package state
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -35,6 +38,16 @@ func (t AgentType) IsPersistent() bool {
 	}
 }
 
+// IsValid reports whether t is a known agent type
+func (t AgentType) IsValid() bool {
+	switch t {
+	case AgentTypeWorker, AgentTypeReview:
+		return true
+	default:
+		return t.IsPersistent()
+	}
+}
+
 // TrackMode defines which PRs the merge queue should track
 type TrackMode string
 
@@ -108,6 +121,90 @@ type ForkConfig struct {
 	ForceForkMode bool `json:"force_fork_mode,omitempty"`
 }
 
+// DefaultCIFixMaxAttempts is how many fix-up workers are spawned per PR when
+// CIFixConfig.MaxAttempts is not set
+const DefaultCIFixMaxAttempts = 2
+
+// CIFixConfig holds configuration for automatically fixing failed CI on PRs
+// from completed workers
+type CIFixConfig struct {
+	// Enabled determines whether the daemon spawns fix-up workers for failing PRs (default: false)
+	Enabled bool `json:"enabled"`
+	// MaxAttempts is how many fix-up workers may be spawned per PR (default: 2)
+	MaxAttempts int `json:"max_attempts,omitempty"`
+}
+
+// DefaultWorkerResumeMaxAttempts is how many times a crashed worker is resumed
+// when WorkerResumeConfig.MaxAttempts is not set
+const DefaultWorkerResumeMaxAttempts = 3
+
+// WorkerResumeConfig holds configuration for resuming workers whose Claude
+// process died (e.g., after a crash or machine restart)
+type WorkerResumeConfig struct {
+	// Disabled turns off resuming; crashed workers are cleaned up instead (default: false)
+	Disabled bool `json:"disabled,omitempty"`
+	// MaxAttempts is how many times a worker may be resumed before its task is marked failed (default: 3)
+	MaxAttempts int `json:"max_attempts,omitempty"`
+}
+
+// Defaults for MessageRetentionConfig fields that are not set
+const (
+	DefaultMessageMaxAgeDays  = 7
+	DefaultMessageMaxPerAgent = 200
+)
+
+// MessageRetentionConfig holds configuration for removing old messages.
+// Only messages that have been delivered are removed; pending ones are kept
+// until they reach their recipient.
+type MessageRetentionConfig struct {
+	// MaxAgeDays is how long a delivered message is kept (default: 7)
+	MaxAgeDays int `json:"max_age_days,omitempty"`
+	// MaxPerAgent is how many delivered messages each mailbox keeps, newest first (default: 200)
+	MaxPerAgent int `json:"max_per_agent,omitempty"`
+}
+
+// RefreshConfig holds configuration for syncing agent worktrees with the
+// main branch
+type RefreshConfig struct {
+	// ResolveConflicts leaves a conflicting rebase in progress for the worker
+	// to resolve instead of aborting it (default: false)
+	ResolveConflicts bool `json:"resolve_conflicts,omitempty"`
+}
+
+// TokenBudget limits the tokens used per day (local time), counted from
+// Claude session transcripts. A zero limit is disabled.
+type TokenBudget struct {
+	// WarnTokens is the daily usage at which a warning is sent
+	WarnTokens int64 `json:"warn_tokens,omitempty"`
+	// CapTokens is the daily usage at which workers are hibernated
+	CapTokens int64 `json:"cap_tokens,omitempty"`
+}
+
+// IsZero reports whether neither limit is set
+func (b TokenBudget) IsZero() bool {
+	return b.WarnTokens == 0 && b.CapTokens == 0
+}
+
+// Validate checks that the limits are non-negative and that the warning
+// comes before the cap
+func (b TokenBudget) Validate() error {
+	if b.WarnTokens < 0 || b.CapTokens < 0 {
+		return fmt.Errorf("token budgets must be 0 (disabled) or greater")
+	}
+	if b.WarnTokens > 0 && b.CapTokens > 0 && b.WarnTokens > b.CapTokens {
+		return fmt.Errorf("warning threshold (%d) is above the cap (%d)", b.WarnTokens, b.CapTokens)
+	}
+	return nil
+}
+
+// BudgetConfig holds the daily token budgets of a repository
+type BudgetConfig struct {
+	// Repo limits all agents of the repository combined
+	Repo TokenBudget `json:"repo,omitempty"`
+	// AgentTypes limits each agent of a type separately (e.g. every worker)
+	AgentTypes map[AgentType]TokenBudget `json:"agent_types,omitempty"`
+}
+
 // TaskStatus represents the status of a completed task
 type TaskStatus string
 
@@ -128,23 +225,163 @@ const (
 
 // TaskHistoryEntry represents a completed task in the history
 type TaskHistoryEntry struct {
-	Name          string     `json:"name"`                     // Worker name
-	Task          string     `json:"task"`                     // Task description
-	Branch        string     `json:"branch"`                   // Git branch
-	PRURL         string     `json:"pr_url,omitempty"`         // Pull request URL if created
-	PRNumber      int        `json:"pr_number,omitempty"`      // PR number for quick lookup
-	Status        TaskStatus `json:"status"`                   // Current status
-	Summary       string     `json:"summary,omitempty"`        // Brief summary of what was accomplished
-	FailureReason string     `json:"failure_reason,omitempty"` // Why the task failed (if applicable)
-	CreatedAt     time.Time  `json:"created_at"`               // When the task was started
-	CompletedAt   time.Time  `json:"completed_at,omitempty"`   // When the task was completed
+	Name          string      `json:"name"`                     // Worker name
+	Task          string      `json:"task"`                     // Task description
+	Branch        string      `json:"branch"`                   // Git branch
+	PRURL         string      `json:"pr_url,omitempty"`         // Pull request URL if created
+	PRNumber      int         `json:"pr_number,omitempty"`      // PR number for quick lookup
+	Status        TaskStatus  `json:"status"`                   // Current status
+	Summary       string      `json:"summary,omitempty"`        // Brief summary of what was accomplished
+	FailureReason string      `json:"failure_reason,omitempty"` // Why the task failed (if applicable)
+	DependsOn     []string    `json:"depends_on,omitempty"`     // Tasks that had to merge before this one started
+	Usage         *TokenUsage `json:"usage,omitempty"`          // Tokens the worker's Claude session used
+	Transcript    string      `json:"transcript,omitempty"`     // Path of the worker's Claude session transcript
+	Messages      string      `json:"messages,omitempty"`       // Archived mailbox of the worker, see config.Paths.MessageArchiveDir
+	CreatedAt     time.Time   `json:"created_at"`               // When the task was started
+	CompletedAt   time.Time   `json:"completed_at,omitempty"`   // When the task was completed
+}
+
+// TokenUsage is the token count of a Claude session and its estimated cost
+type TokenUsage struct {
+	InputTokens         int64   `json:"input_tokens"`          // Uncached input tokens
+	OutputTokens        int64   `json:"output_tokens"`         // Output tokens
+	CacheCreationTokens int64   `json:"cache_creation_tokens"` // Input tokens written to the prompt cache
+	CacheReadTokens     int64   `json:"cache_read_tokens"`     // Input tokens read from the prompt cache
+	CostUSD             float64 `json:"cost_usd"`              // Estimated cost at list prices
 }
 
+// PendingTask represents a worker task that is waiting for its dependencies
+// to merge before the daemon spawns it.
+type PendingTask struct {
+	Name          string       `json:"name"`                     // Worker name to use when spawned
+	Task          string       `json:"task"`                     // Task description
+	DependsOn     []string     `json:"depends_on"`               // Worker names or PR numbers ("#123") that must merge first
+	BlockedReason string       `json:"blocked_reason,omitempty"` // Why the task can never start (a dependency closed or failed)
+	Profile       AgentProfile `json:"profile,omitempty"`        // Profile requested with 'worker create'
+	CreatedAt     time.Time    `json:"created_at"`               // When the task was queued
+}
+
+// QueuedTask represents a worker task parked until the repository has a free
+// worker slot (see Repository.MaxWorkers). Tasks are spawned in FIFO order.
+type QueuedTask struct {
+	Name      string       `json:"name"`                 // Worker name to use when spawned
+	Task      string       `json:"task"`                 // Task description
+	DependsOn []string     `json:"depends_on,omitempty"` // Dependencies that merged before the task was queued
+	Profile   AgentProfile `json:"profile,omitempty"`    // Profile requested with 'worker create'
+	QueuedAt  time.Time    `json:"queued_at"`            // When the task entered the queue
+}
+
+// CIStatus summarizes the status checks on a pull request
+type CIStatus string
+
+const (
+	// CIPending means at least one check hasn't finished
+	CIPending CIStatus = "pending"
+	// CIPassing means every check succeeded
+	CIPassing CIStatus = "passing"
+	// CIFailing means at least one check failed
+	CIFailing CIStatus = "failing"
+	// CINone means the pull request has no checks
+	CINone CIStatus = "none"
+)
+
+// PullRequestStatus is the daemon's latest observation of the pull request
+// opened from a tracked branch (see the daemon's PR tracking loop).
+type PullRequestStatus struct {
+	Branch         string     `json:"branch"`                    // Head branch of the PR
+	Agent          string     `json:"agent,omitempty"`           // Worker that owns the branch
+	Number         int        `json:"number"`                    // PR number
+	URL            string     `json:"url"`                       // PR URL
+	State          TaskStatus `json:"state"`                     // open, merged, or closed
+	CIStatus       CIStatus   `json:"ci_status"`                 // Summary of status checks
+	ReviewDecision string     `json:"review_decision,omitempty"` // APPROVED, CHANGES_REQUESTED, REVIEW_REQUIRED
+	Mergeable      string     `json:"mergeable,omitempty"`       // MERGEABLE, CONFLICTING, UNKNOWN
+	UpdatedAt      time.Time  `json:"updated_at"`                // Last update on GitHub
+	CheckedAt      time.Time  `json:"checked_at"`                // When the daemon last polled the PR
+	HeadSHA        string     `json:"head_sha,omitempty"`        // Commit the checks ran against
+	FixAttempts    int        `json:"fix_attempts,omitempty"`    // Fix-up workers spawned for failed CI
+	FixAttemptSHA  string     `json:"fix_attempt_sha,omitempty"` // Head commit the last fix-up (or give-up notice) was for
+}
+
+// DependencyState describes how far a single task dependency has progressed
+type DependencyState string
+
+const (
+	// DependencyWaiting means the dependency has not merged yet
+	DependencyWaiting DependencyState = "waiting"
+	// DependencyMerged means the dependency's PR has merged
+	DependencyMerged DependencyState = "merged"
+	// DependencyFailed means the dependency can no longer merge (closed, failed, or no PR)
+	DependencyFailed DependencyState = "failed"
+)
+
+// ParsePRDependency returns the PR number for a dependency of the form "#123" or "123".
+// Returns false if the dependency refers to a worker name instead.
+func ParsePRDependency(dep string) (int, bool) {
+	n, err := strconv.Atoi(strings.TrimPrefix(dep, "#"))
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// FindDependency returns the most recent task history entry matching a dependency.
+// Worker-name dependencies match on Name, PR dependencies match on PRNumber.
+func FindDependency(history []TaskHistoryEntry, dep string) (TaskHistoryEntry, bool) {
+	prNumber, isPR := ParsePRDependency(dep)
+	for i := len(history) - 1; i >= 0; i-- {
+		entry := history[i]
+		if isPR && entry.PRNumber == prNumber {
+			return entry, true
+		}
+		if !isPR && entry.Name == dep {
+			return entry, true
+		}
+	}
+	return TaskHistoryEntry{}, false
+}
+
+// ResolveDependency reports the state of a dependency based on the task history.
+// Dependencies without a history entry are still running (or not yet started) and
+// are reported as waiting.
+func ResolveDependency(history []TaskHistoryEntry, dep string) DependencyState {
+	entry, found := FindDependency(history, dep)
+	if !found {
+		return DependencyWaiting
+	}
+
+	switch entry.Status {
+	case TaskStatusMerged:
+		return DependencyMerged
+	case TaskStatusClosed, TaskStatusFailed, TaskStatusNoPR:
+		return DependencyFailed
+	default:
+		return DependencyWaiting
+	}
+}
+
+// AgentActivity describes what an agent is doing, as detected from its tmux pane
+type AgentActivity string
+
+const (
+	// ActivityUnknown means the pane could not be inspected or didn't match a known pattern
+	ActivityUnknown AgentActivity = ""
+	// ActivityBusy means the agent is working (output is growing or a tool call is running)
+	ActivityBusy AgentActivity = "busy"
+	// ActivityIdle means the agent is sitting at its input prompt
+	ActivityIdle AgentActivity = "idle"
+	// ActivityWaitingPermission means the agent is blocked on a permission prompt
+	ActivityWaitingPermission AgentActivity = "waiting_permission"
+	// ActivityCrashed means the agent process is no longer running
+	ActivityCrashed AgentActivity = "crashed"
+)
+
 // Agent represents an agent's state
 type Agent struct {
 	Type            AgentType `json:"type"`
 	WorktreePath    string    `json:"worktree_path"`
-	TmuxWindow      string    `json:"tmux_window"`
+	TmuxWindow      string    `json:"tmux_window"`        // Empty for headless agents
+	Headless        bool      `json:"headless,omitempty"` // Runs as a headless claude -p process instead of in a window
 	SessionID       string    `json:"session_id"`
 	PID             int       `json:"pid"`
 	Task            string    `json:"task,omitempty"`           // Only for workers
@@ -153,60 +390,120 @@ type Agent struct {
 	CreatedAt       time.Time `json:"created_at"`
 	LastNudge       time.Time `json:"last_nudge,omitempty"`
 	ReadyForCleanup bool      `json:"ready_for_cleanup,omitempty"` // Only for workers
+	DependsOn       []string  `json:"depends_on,omitempty"`        // Tasks that merged before this worker was spawned
+	ResumeCount     int       `json:"resume_count,omitempty"`      // Times in a row the worker was resumed after crashing
+	LastResumedAt   time.Time `json:"last_resumed_at,omitempty"`   // When the worker was last resumed
+
+	Activity          AgentActivity `json:"activity,omitempty"`            // Last detected activity (see AgentActivity)
+	ActivityChangedAt time.Time     `json:"activity_changed_at,omitempty"` // When Activity last changed
+
+	RefreshDisabled  bool      `json:"refresh_disabled,omitempty"`   // Opted out of syncing with main by the daemon
+	NeedsRebase      bool      `json:"needs_rebase,omitempty"`       // Refresh onto main hit conflicts the agent must resolve
+	RebaseConflicts  []string  `json:"rebase_conflicts,omitempty"`   // Files that conflicted on the last refresh
+	NeedsRebaseSince time.Time `json:"needs_rebase_since,omitempty"` // When the conflicts were first detected
+
+	Profile    AgentProfile `json:"profile,omitempty"`     // Model, tools, and permissions Claude was started with; reused on restart
+	PromptFile string       `json:"prompt_file,omitempty"` // Prompt version the agent's session was started with; reused on restart
+}
+
+// AgentProfile selects the model, tools, and permissions an agent's Claude
+// runs with. It comes from the agent definition's front matter or from flags
+// to 'worker create'; the zero value uses Claude's defaults. The fields match
+// claude.Profile so one converts directly to the other.
+type AgentProfile struct {
+	Model           string   `json:"model,omitempty"`            // e.g. "sonnet", "opus", or a full model name
+	AllowedTools    []string `json:"allowed_tools,omitempty"`    // Tools allowed without prompting, e.g. "Bash(git log:*)"
+	DisallowedTools []string `json:"disallowed_tools,omitempty"` // Tools the agent may not use
+	PermissionMode  string   `json:"permission_mode,omitempty"`  // Replaces --dangerously-skip-permissions when set
+	ExtraArgs       []string `json:"extra_args,omitempty"`       // Additional claude CLI arguments
+}
+
+// Merge returns p with every field that is unset taken from defaults
+func (p AgentProfile) Merge(defaults AgentProfile) AgentProfile {
+	if p.Model == "" {
+		p.Model = defaults.Model
+	}
+	if len(p.AllowedTools) == 0 {
+		p.AllowedTools = defaults.AllowedTools
+	}
+	if len(p.DisallowedTools) == 0 {
+		p.DisallowedTools = defaults.DisallowedTools
+	}
+	if p.PermissionMode == "" {
+		p.PermissionMode = defaults.PermissionMode
+	}
+	if len(p.ExtraArgs) == 0 {
+		p.ExtraArgs = defaults.ExtraArgs
+	}
+	return p
 }
 
 // Repository represents a tracked repository's state
 type Repository struct {
-	GithubURL        string             `json:"github_url"`
-	TmuxSession      string             `json:"tmux_session"`
-	Agents           map[string]Agent   `json:"agents"`
-	TaskHistory      []TaskHistoryEntry `json:"task_history,omitempty"`
-	MergeQueueConfig MergeQueueConfig   `json:"merge_queue_config,omitempty"`
-	PRShepherdConfig PRShepherdConfig   `json:"pr_shepherd_config,omitempty"`
-	ForkConfig       ForkConfig         `json:"fork_config,omitempty"`
-	TargetBranch     string             `json:"target_branch,omitempty"` // Default branch for PRs (usually "main")
+	GithubURL          string                       `json:"github_url"`
+	TmuxSession        string                       `json:"tmux_session"`
+	Agents             map[string]Agent             `json:"agents"`
+	TaskHistory        []TaskHistoryEntry           `json:"task_history,omitempty"`
+	PendingTasks       []PendingTask                `json:"pending_tasks,omitempty"`
+	WorkerQueue        []QueuedTask                 `json:"worker_queue,omitempty"`
+	PullRequests       map[string]PullRequestStatus `json:"pull_requests,omitempty"` // Tracked PRs keyed by head branch
+	MergeQueueConfig   MergeQueueConfig             `json:"merge_queue_config,omitempty"`
+	PRShepherdConfig   PRShepherdConfig             `json:"pr_shepherd_config,omitempty"`
+	ForkConfig         ForkConfig                   `json:"fork_config,omitempty"`
+	CIFixConfig        CIFixConfig                  `json:"ci_fix_config,omitempty"`
+	WorkerResumeConfig WorkerResumeConfig           `json:"worker_resume_config,omitempty"`
+	RefreshConfig      RefreshConfig                `json:"refresh_config,omitempty"`
+	BudgetConfig       BudgetConfig                 `json:"budget_config,omitempty"`
+	TargetBranch       string                       `json:"target_branch,omitempty"`  // Default branch for PRs (usually "main")
+	MaxWorkers         int                          `json:"max_workers,omitempty"`    // Maximum concurrent workers (0 = unlimited)
+	MessageGroups      map[string][]string          `json:"message_groups,omitempty"` // Named message groups, addressed as @<name>
+	MessageRetention   MessageRetentionConfig       `json:"message_retention,omitempty"`
+	PermissionProfiles map[string]string            `json:"permission_profiles,omitempty"` // Permission profile name by agent type
 }
 
 // State represents the entire daemon state
 type State struct {
-	Repos       map[string]*Repository `json:"repos"`
-	CurrentRepo string                 `json:"current_repo,omitempty"`
-	mu          sync.RWMutex
-	path        string
+	Version      int                    `json:"version"` // Schema version, see CurrentSchemaVersion
+	Repos        map[string]*Repository `json:"repos"`
+	CurrentRepo  string                 `json:"current_repo,omitempty"`
+	GlobalBudget TokenBudget            `json:"global_budget,omitempty"` // Daily budget across all repositories
+	mu           sync.RWMutex
+	store        Store
+	dirty        []docKey // Documents changed by the mutation being committed
 }
 
-// New creates a new empty state
+// New creates a new empty state persisted to path through a journal
 func New(path string) *State {
+	return NewWithStore(NewJournalStore(path))
+}
+
+// NewWithStore creates a new empty state persisted through store
+func NewWithStore(store Store) *State {
 	return &State{
-		Repos: make(map[string]*Repository),
-		path:  path,
+		Version: CurrentSchemaVersion,
+		Repos:   make(map[string]*Repository),
+		store:   store,
 	}
 }
 
-// Load loads state from disk
+// Load loads state from disk: the state file plus any journal written since
 func Load(path string) (*State, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// No state file, return empty state
-			return New(path), nil
-		}
-		return nil, fmt.Errorf("failed to read state file: %w", err)
-	}
+	return LoadFrom(NewJournalStore(path))
+}
 
-	var s State
-	if err := json.Unmarshal(data, &s); err != nil {
-		return nil, fmt.Errorf("failed to parse state file: %w", err)
+// LoadFrom loads state from store
+func LoadFrom(store Store) (*State, error) {
+	s := NewWithStore(store)
+	if err := store.Load(s); err != nil {
+		return nil, err
 	}
 
-	s.path = path
-
 	// Initialize map if nil
 	if s.Repos == nil {
 		s.Repos = make(map[string]*Repository)
 	}
 
-	return &s, nil
+	return s, nil
 }
 
 // atomicWrite writes data to a file atomically using a temp file and rename.
@@ -221,15 +518,21 @@ func atomicWrite(path string, data []byte) error {
 	}
 	tmpPath := tmpFile.Name()
 
-	// Write data and close the file
+	// Write data, flush it to disk so the rename can't expose an empty or
+	// partial file after a crash, and close the file
 	_, writeErr := tmpFile.Write(data)
+	syncErr := tmpFile.Sync()
 	closeErr := tmpFile.Close()
 
-	// Check for write or close errors
+	// Check for write, sync, or close errors
 	if writeErr != nil {
 		os.Remove(tmpPath) // Clean up temp file on error
 		return fmt.Errorf("failed to write state file: %w", writeErr)
 	}
+	if syncErr != nil {
+		os.Remove(tmpPath) // Clean up temp file on error
+		return fmt.Errorf("failed to sync state file: %w", syncErr)
+	}
 	if closeErr != nil {
 		os.Remove(tmpPath) // Clean up temp file on error
 		return fmt.Errorf("failed to close temp file: %w", closeErr)
@@ -244,17 +547,61 @@ func atomicWrite(path string, data []byte) error {
 	return nil
 }
 
-// Save persists state to disk
+// Save writes the whole state file, folding in anything journaled since the
+// last snapshot
 func (s *State) Save() error {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	data, err := json.MarshalIndent(s, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal state: %w", err)
+	return s.store.Snapshot(s)
+}
+
+// Checkpoint writes the state file if changes have been committed since it
+// was last written
+func (s *State) Checkpoint() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.store.Pending() == 0 {
+		return nil
 	}
+	return s.store.Snapshot(s)
+}
+
+// ValidateRepoName checks that name can name a repository. Repository names
+// are directory names under ~/.multiclaude, so they must be a single path
+// element.
+func ValidateRepoName(name string) error {
+	return validateName("repository", name)
+}
+
+// ValidateAgentName checks that name can name an agent. Agent names are
+// directory names as well as part of the agent's branch name.
+func ValidateAgentName(name string) error {
+	return validateName("agent", name)
+}
 
-	return atomicWrite(s.path, data)
+// validateName checks name against the rules of both path elements and git
+// branch names
+func validateName(kind, name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("%s name cannot be empty", kind)
+	case name == "." || name == "..":
+		return fmt.Errorf("%s name cannot be '.' or '..'", kind)
+	case strings.HasPrefix(name, ".") || strings.HasPrefix(name, "-"):
+		return fmt.Errorf("%s name %q cannot start with '.' or '-'", kind, name)
+	case strings.HasSuffix(name, "."):
+		return fmt.Errorf("%s name %q cannot end with '.'", kind, name)
+	case strings.Contains(name, ".."):
+		return fmt.Errorf("%s name %q cannot contain '..'", kind, name)
+	}
+	for _, r := range name {
+		if r < ' ' || r == 0x7f || strings.ContainsRune(`/\~^:?*[@{} `, r) {
+			return fmt.Errorf("%s name %q cannot contain %q", kind, name, r)
+		}
+	}
+	return nil
 }
 
 // AddRepo adds a new repository to the state
@@ -271,7 +618,7 @@ func (s *State) AddRepo(name string, repo *Repository) error {
 	}
 
 	s.Repos[name] = repo
-	return s.saveUnlocked()
+	return s.saveUnlocked(repoKeys(name, repo)...)
 }
 
 // GetRepo returns a repository by name
@@ -293,7 +640,7 @@ func (s *State) RemoveRepo(name string) error {
 	}
 
 	delete(s.Repos, name)
-	return s.saveUnlocked()
+	return s.saveUnlocked(repoKey(name))
 }
 
 // ListRepos returns all repository names
@@ -314,10 +661,14 @@ func (s *State) ClearAllAgents() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	for _, repo := range s.Repos {
+	var changed []docKey
+	for repoName, repo := range s.Repos {
+		for agentName := range repo.Agents {
+			changed = append(changed, agentKey(repoName, agentName))
+		}
 		repo.Agents = make(map[string]Agent)
 	}
-	return s.saveUnlocked()
+	return s.saveUnlocked(changed...)
 }
 
 // SetCurrentRepo sets the current/default repository
@@ -331,7 +682,7 @@ func (s *State) SetCurrentRepo(name string) error {
 	}
 
 	s.CurrentRepo = name
-	return s.saveUnlocked()
+	return s.saveUnlocked(metaKey())
 }
 
 // GetCurrentRepo returns the current/default repository name
@@ -347,7 +698,7 @@ func (s *State) ClearCurrentRepo() error {
 	defer s.mu.Unlock()
 
 	s.CurrentRepo = ""
-	return s.saveUnlocked()
+	return s.saveUnlocked(metaKey())
 }
 
 // GetAllRepos returns a snapshot of all repositories
@@ -361,13 +712,19 @@ func (s *State) GetAllRepos() map[string]*Repository {
 	for name, repo := range s.Repos {
 		// Copy the repository
 		repoCopy := &Repository{
-			GithubURL:        repo.GithubURL,
-			TmuxSession:      repo.TmuxSession,
-			Agents:           make(map[string]Agent, len(repo.Agents)),
-			MergeQueueConfig: repo.MergeQueueConfig,
-			PRShepherdConfig: repo.PRShepherdConfig,
-			ForkConfig:       repo.ForkConfig,
-			TargetBranch:     repo.TargetBranch,
+			GithubURL:          repo.GithubURL,
+			TmuxSession:        repo.TmuxSession,
+			Agents:             make(map[string]Agent, len(repo.Agents)),
+			MergeQueueConfig:   repo.MergeQueueConfig,
+			PRShepherdConfig:   repo.PRShepherdConfig,
+			ForkConfig:         repo.ForkConfig,
+			CIFixConfig:        repo.CIFixConfig,
+			WorkerResumeConfig: repo.WorkerResumeConfig,
+			RefreshConfig:      repo.RefreshConfig,
+			BudgetConfig:       copyBudgetConfig(repo.BudgetConfig),
+			MessageRetention:   repo.MessageRetention,
+			TargetBranch:       repo.TargetBranch,
+			MaxWorkers:         repo.MaxWorkers,
 		}
 		// Copy agents
 		for agentName, agent := range repo.Agents {
@@ -378,6 +735,37 @@ func (s *State) GetAllRepos() map[string]*Repository {
 			repoCopy.TaskHistory = make([]TaskHistoryEntry, len(repo.TaskHistory))
 			copy(repoCopy.TaskHistory, repo.TaskHistory)
 		}
+		// Copy pending tasks
+		if repo.PendingTasks != nil {
+			repoCopy.PendingTasks = make([]PendingTask, len(repo.PendingTasks))
+			copy(repoCopy.PendingTasks, repo.PendingTasks)
+		}
+		// Copy worker queue
+		if repo.WorkerQueue != nil {
+			repoCopy.WorkerQueue = make([]QueuedTask, len(repo.WorkerQueue))
+			copy(repoCopy.WorkerQueue, repo.WorkerQueue)
+		}
+		// Copy tracked pull requests
+		if repo.PullRequests != nil {
+			repoCopy.PullRequests = make(map[string]PullRequestStatus, len(repo.PullRequests))
+			for branch, pr := range repo.PullRequests {
+				repoCopy.PullRequests[branch] = pr
+			}
+		}
+		// Copy message groups
+		if repo.MessageGroups != nil {
+			repoCopy.MessageGroups = make(map[string][]string, len(repo.MessageGroups))
+			for group, members := range repo.MessageGroups {
+				repoCopy.MessageGroups[group] = append([]string(nil), members...)
+			}
+		}
+		// Copy permission profiles
+		if repo.PermissionProfiles != nil {
+			repoCopy.PermissionProfiles = make(map[string]string, len(repo.PermissionProfiles))
+			for agentType, profile := range repo.PermissionProfiles {
+				repoCopy.PermissionProfiles[agentType] = profile
+			}
+		}
 		repos[name] = repoCopy
 	}
 	return repos
@@ -398,7 +786,7 @@ func (s *State) AddAgent(repoName, agentName string, agent Agent) error {
 	}
 
 	repo.Agents[agentName] = agent
-	return s.saveUnlocked()
+	return s.saveUnlocked(agentKey(repoName, agentName))
 }
 
 // UpdateAgent updates an existing agent
@@ -416,7 +804,7 @@ func (s *State) UpdateAgent(repoName, agentName string, agent Agent) error {
 	}
 
 	repo.Agents[agentName] = agent
-	return s.saveUnlocked()
+	return s.saveUnlocked(agentKey(repoName, agentName))
 }
 
 // UpdateAgentPID updates just the PID of an agent
@@ -436,7 +824,154 @@ func (s *State) UpdateAgentPID(repoName, agentName string, pid int) error {
 
 	agent.PID = pid
 	repo.Agents[agentName] = agent
-	return s.saveUnlocked()
+	return s.saveUnlocked(agentKey(repoName, agentName))
+}
+
+// RecordAgentResume counts a resume of a crashed agent and returns the new count
+func (s *State) RecordAgentResume(repoName, agentName string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return 0, fmt.Errorf("repository %q not found", repoName)
+	}
+
+	agent, exists := repo.Agents[agentName]
+	if !exists {
+		return 0, fmt.Errorf("agent %q not found in repository %q", agentName, repoName)
+	}
+
+	agent.ResumeCount++
+	agent.LastResumedAt = time.Now()
+	repo.Agents[agentName] = agent
+	return agent.ResumeCount, s.saveUnlocked(agentKey(repoName, agentName))
+}
+
+// ResetAgentResumes clears the resume count of an agent that has been running
+// stably since it was last resumed, so only crashes in a row use up its budget
+func (s *State) ResetAgentResumes(repoName, agentName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return fmt.Errorf("repository %q not found", repoName)
+	}
+
+	agent, exists := repo.Agents[agentName]
+	if !exists {
+		return fmt.Errorf("agent %q not found in repository %q", agentName, repoName)
+	}
+
+	agent.ResumeCount = 0
+	repo.Agents[agentName] = agent
+	return s.saveUnlocked(agentKey(repoName, agentName))
+}
+
+// UpdateAgentActivity records the detected activity of an agent. ActivityChangedAt
+// is only bumped when the activity actually changes. Returns the previous activity.
+func (s *State) UpdateAgentActivity(repoName, agentName string, activity AgentActivity) (AgentActivity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return ActivityUnknown, fmt.Errorf("repository %q not found", repoName)
+	}
+
+	agent, exists := repo.Agents[agentName]
+	if !exists {
+		return ActivityUnknown, fmt.Errorf("agent %q not found in repository %q", agentName, repoName)
+	}
+
+	previous := agent.Activity
+	if previous == activity {
+		return previous, nil
+	}
+
+	agent.Activity = activity
+	agent.ActivityChangedAt = time.Now()
+	repo.Agents[agentName] = agent
+	return previous, s.saveUnlocked(agentKey(repoName, agentName))
+}
+
+// SetAgentRefreshDisabled opts an agent out of (or back into) having its
+// worktree synced with main by the daemon
+func (s *State) SetAgentRefreshDisabled(repoName, agentName string, disabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return fmt.Errorf("repository %q not found", repoName)
+	}
+
+	agent, exists := repo.Agents[agentName]
+	if !exists {
+		return fmt.Errorf("agent %q not found in repository %q", agentName, repoName)
+	}
+
+	agent.RefreshDisabled = disabled
+	repo.Agents[agentName] = agent
+	return s.saveUnlocked(agentKey(repoName, agentName))
+}
+
+// SetAgentPromptFile records the prompt file an agent's session was started with
+func (s *State) SetAgentPromptFile(repoName, agentName, promptFile string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return fmt.Errorf("repository %q not found", repoName)
+	}
+
+	agent, exists := repo.Agents[agentName]
+	if !exists {
+		return fmt.Errorf("agent %q not found in repository %q", agentName, repoName)
+	}
+
+	agent.PromptFile = promptFile
+	repo.Agents[agentName] = agent
+	return s.saveUnlocked(agentKey(repoName, agentName))
+}
+
+// SetAgentNeedsRebase records the files that conflicted when the agent's
+// worktree was refreshed, or clears the needs-rebase state when files is
+// empty. Returns whether the state changed.
+func (s *State) SetAgentNeedsRebase(repoName, agentName string, files []string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return false, fmt.Errorf("repository %q not found", repoName)
+	}
+
+	agent, exists := repo.Agents[agentName]
+	if !exists {
+		return false, fmt.Errorf("agent %q not found in repository %q", agentName, repoName)
+	}
+
+	needsRebase := len(files) > 0
+	if agent.NeedsRebase == needsRebase && slices.Equal(agent.RebaseConflicts, files) {
+		return false, nil
+	}
+
+	if !needsRebase {
+		agent.NeedsRebase = false
+		agent.RebaseConflicts = nil
+		agent.NeedsRebaseSince = time.Time{}
+	} else {
+		if !agent.NeedsRebase {
+			agent.NeedsRebaseSince = time.Now()
+		}
+		agent.NeedsRebase = true
+		agent.RebaseConflicts = append([]string(nil), files...)
+	}
+	repo.Agents[agentName] = agent
+	return true, s.saveUnlocked(agentKey(repoName, agentName))
 }
 
 // RemoveAgent removes an agent from a repository
@@ -450,7 +985,7 @@ func (s *State) RemoveAgent(repoName, agentName string) error {
 	}
 
 	delete(repo.Agents, agentName)
-	return s.saveUnlocked()
+	return s.saveUnlocked(agentKey(repoName, agentName))
 }
 
 // GetAgent returns an agent by name
@@ -512,7 +1047,7 @@ func (s *State) UpdateMergeQueueConfig(repoName string, config MergeQueueConfig)
 	}
 
 	repo.MergeQueueConfig = config
-	return s.saveUnlocked()
+	return s.saveUnlocked(repoKey(repoName))
 }
 
 // GetPRShepherdConfig returns the PR shepherd config for a repository
@@ -543,7 +1078,7 @@ func (s *State) UpdatePRShepherdConfig(repoName string, config PRShepherdConfig)
 	}
 
 	repo.PRShepherdConfig = config
-	return s.saveUnlocked()
+	return s.saveUnlocked(repoKey(repoName))
 }
 
 // GetForkConfig returns the fork config for a repository
@@ -570,7 +1105,7 @@ func (s *State) UpdateForkConfig(repoName string, config ForkConfig) error {
 	}
 
 	repo.ForkConfig = config
-	return s.saveUnlocked()
+	return s.saveUnlocked(repoKey(repoName))
 }
 
 // IsForkMode returns true if the repository should operate in fork mode.
@@ -587,7 +1122,16 @@ func (s *State) IsForkMode(repoName string) bool {
 	return repo.ForkConfig.IsFork || repo.ForkConfig.ForceForkMode
 }
 
-// AddTaskHistory adds a completed task to the repository's history
+// Task history is capped per repository. Once it grows past maxTaskHistory
+// entries the oldest are dropped down to compactedTaskHistory at once, since
+// shifting the history rewrites every entry in the journal.
+const (
+	maxTaskHistory       = 1000
+	compactedTaskHistory = 900
+)
+
+// AddTaskHistory adds a completed task to the repository's history, dropping
+// the oldest entries once the history is over its cap
 func (s *State) AddTaskHistory(repoName string, entry TaskHistoryEntry) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -598,7 +1142,17 @@ func (s *State) AddTaskHistory(repoName string, entry TaskHistoryEntry) error {
 	}
 
 	repo.TaskHistory = append(repo.TaskHistory, entry)
-	return s.saveUnlocked()
+	if len(repo.TaskHistory) <= maxTaskHistory {
+		return s.saveUnlocked(historyKey(repoName, len(repo.TaskHistory)-1))
+	}
+
+	changed := make([]docKey, len(repo.TaskHistory))
+	for i := range changed {
+		changed[i] = historyKey(repoName, i)
+	}
+	dropped := len(repo.TaskHistory) - compactedTaskHistory
+	repo.TaskHistory = append([]TaskHistoryEntry(nil), repo.TaskHistory[dropped:]...)
+	return s.saveUnlocked(changed...)
 }
 
 // GetTaskHistory returns the task history for a repository, optionally limited to N entries
@@ -650,13 +1204,69 @@ func (s *State) UpdateTaskHistoryStatus(repoName, taskName string, status TaskSt
 			if prNumber > 0 {
 				repo.TaskHistory[i].PRNumber = prNumber
 			}
-			return s.saveUnlocked()
+			return s.saveUnlocked(historyKey(repoName, i))
 		}
 	}
 
 	return fmt.Errorf("task %q not found in history", taskName)
 }
 
+// UpdatePullRequest records the latest status of a tracked pull request and
+// returns the previous record, if there was one.
+func (s *State) UpdatePullRequest(repoName string, pr PullRequestStatus) (PullRequestStatus, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return PullRequestStatus{}, false, fmt.Errorf("repository %q not found", repoName)
+	}
+
+	if repo.PullRequests == nil {
+		repo.PullRequests = make(map[string]PullRequestStatus)
+	}
+	previous, existed := repo.PullRequests[pr.Branch]
+	repo.PullRequests[pr.Branch] = pr
+	return previous, existed, s.saveUnlocked(repoKey(repoName))
+}
+
+// GetPullRequests returns the tracked pull requests for a repository, sorted by PR number
+func (s *State) GetPullRequests(repoName string) ([]PullRequestStatus, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return nil, fmt.Errorf("repository %q not found", repoName)
+	}
+
+	prs := make([]PullRequestStatus, 0, len(repo.PullRequests))
+	for _, pr := range repo.PullRequests {
+		prs = append(prs, pr)
+	}
+	sort.Slice(prs, func(i, j int) bool {
+		return prs[i].Number < prs[j].Number
+	})
+	return prs, nil
+}
+
+// RemovePullRequest stops tracking the pull request for a branch
+func (s *State) RemovePullRequest(repoName, branch string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return fmt.Errorf("repository %q not found", repoName)
+	}
+
+	if _, exists := repo.PullRequests[branch]; !exists {
+		return nil
+	}
+	delete(repo.PullRequests, branch)
+	return s.saveUnlocked(repoKey(repoName))
+}
+
 // UpdateTaskHistorySummary updates the summary and failure reason for a task by name
 func (s *State) UpdateTaskHistorySummary(repoName, taskName, summary, failureReason string) error {
 	s.mu.Lock()
@@ -678,19 +1288,539 @@ func (s *State) UpdateTaskHistorySummary(repoName, taskName, summary, failureRea
 				// Also update status to failed if a failure reason is provided
 				repo.TaskHistory[i].Status = TaskStatusFailed
 			}
-			return s.saveUnlocked()
+			return s.saveUnlocked(historyKey(repoName, i))
 		}
 	}
 
 	return fmt.Errorf("task %q not found in history", taskName)
 }
 
-// saveUnlocked saves state without acquiring lock (caller must hold lock)
-func (s *State) saveUnlocked() error {
-	data, err := json.MarshalIndent(s, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal state: %w", err)
+// AddPendingTask queues a task that waits on its dependencies before spawning
+func (s *State) AddPendingTask(repoName string, task PendingTask) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return fmt.Errorf("repository %q not found", repoName)
+	}
+
+	if err := checkTaskNameUnlocked(repoName, repo, task.Name); err != nil {
+		return err
 	}
 
-	return atomicWrite(s.path, data)
+	repo.PendingTasks = append(repo.PendingTasks, task)
+	return s.saveUnlocked(repoKey(repoName))
+}
+
+// GetPendingTasks returns the pending tasks for a repository in queue order
+func (s *State) GetPendingTasks(repoName string) ([]PendingTask, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return nil, fmt.Errorf("repository %q not found", repoName)
+	}
+
+	result := make([]PendingTask, len(repo.PendingTasks))
+	copy(result, repo.PendingTasks)
+	return result, nil
+}
+
+// RemovePendingTask removes a pending task by name
+func (s *State) RemovePendingTask(repoName, taskName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return fmt.Errorf("repository %q not found", repoName)
+	}
+
+	for i, pending := range repo.PendingTasks {
+		if pending.Name == taskName {
+			repo.PendingTasks = append(repo.PendingTasks[:i], repo.PendingTasks[i+1:]...)
+			return s.saveUnlocked(repoKey(repoName))
+		}
+	}
+
+	return fmt.Errorf("pending task %q not found in repository %q", taskName, repoName)
+}
+
+// UpdatePendingTaskBlockedReason records why a pending task cannot start
+func (s *State) UpdatePendingTaskBlockedReason(repoName, taskName, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return fmt.Errorf("repository %q not found", repoName)
+	}
+
+	for i := range repo.PendingTasks {
+		if repo.PendingTasks[i].Name == taskName {
+			repo.PendingTasks[i].BlockedReason = reason
+			return s.saveUnlocked(repoKey(repoName))
+		}
+	}
+
+	return fmt.Errorf("pending task %q not found in repository %q", taskName, repoName)
+}
+
+// checkTaskNameUnlocked returns an error if a worker name is already used by an
+// agent, a pending task, or a queued task (caller must hold lock)
+func checkTaskNameUnlocked(repoName string, repo *Repository, name string) error {
+	if _, exists := repo.Agents[name]; exists {
+		return fmt.Errorf("agent %q already exists in repository %q", name, repoName)
+	}
+	for _, pending := range repo.PendingTasks {
+		if pending.Name == name {
+			return fmt.Errorf("pending task %q already exists in repository %q", name, repoName)
+		}
+	}
+	for _, queued := range repo.WorkerQueue {
+		if queued.Name == name {
+			return fmt.Errorf("task %q is already queued in repository %q", name, repoName)
+		}
+	}
+	return nil
+}
+
+// GetMaxWorkers returns the worker concurrency limit for a repository (0 = unlimited)
+func (s *State) GetMaxWorkers(repoName string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return 0, fmt.Errorf("repository %q not found", repoName)
+	}
+	return repo.MaxWorkers, nil
+}
+
+// UpdateMaxWorkers sets the worker concurrency limit for a repository
+func (s *State) UpdateMaxWorkers(repoName string, maxWorkers int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return fmt.Errorf("repository %q not found", repoName)
+	}
+	if maxWorkers < 0 {
+		return fmt.Errorf("max workers must be 0 (unlimited) or greater, got %d", maxWorkers)
+	}
+
+	repo.MaxWorkers = maxWorkers
+	return s.saveUnlocked(repoKey(repoName))
+}
+
+// GetMessageGroups returns a copy of the named message groups for a repository
+func (s *State) GetMessageGroups(repoName string) (map[string][]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return nil, fmt.Errorf("repository %q not found", repoName)
+	}
+	groups := make(map[string][]string, len(repo.MessageGroups))
+	for group, members := range repo.MessageGroups {
+		groups[group] = append([]string(nil), members...)
+	}
+	return groups, nil
+}
+
+// SetMessageGroup defines a named message group for a repository. An empty
+// member list removes the group.
+func (s *State) SetMessageGroup(repoName, group string, members []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return fmt.Errorf("repository %q not found", repoName)
+	}
+	if group == "" || strings.ContainsAny(group, "@ \t") {
+		return fmt.Errorf("invalid message group name %q", group)
+	}
+
+	if len(members) == 0 {
+		delete(repo.MessageGroups, group)
+	} else {
+		if repo.MessageGroups == nil {
+			repo.MessageGroups = make(map[string][]string)
+		}
+		repo.MessageGroups[group] = append([]string(nil), members...)
+	}
+	return s.saveUnlocked(repoKey(repoName))
+}
+
+// GetPermissionProfiles returns a copy of the permission profile selected for
+// each agent type of a repository. Agent types without an entry run unrestricted.
+func (s *State) GetPermissionProfiles(repoName string) (map[string]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return nil, fmt.Errorf("repository %q not found", repoName)
+	}
+	profiles := make(map[string]string, len(repo.PermissionProfiles))
+	for agentType, profile := range repo.PermissionProfiles {
+		profiles[agentType] = profile
+	}
+	return profiles, nil
+}
+
+// GetPermissionProfile returns the name of the permission profile agents of
+// the given type run with, or "" if none is selected
+func (s *State) GetPermissionProfile(repoName string, agentType AgentType) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return ""
+	}
+	return repo.PermissionProfiles[string(agentType)]
+}
+
+// SetPermissionProfile selects the permission profile for an agent type of a
+// repository. An empty profile removes the selection.
+func (s *State) SetPermissionProfile(repoName string, agentType AgentType, profile string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return fmt.Errorf("repository %q not found", repoName)
+	}
+	if !agentType.IsValid() {
+		return fmt.Errorf("unknown agent type %q", agentType)
+	}
+
+	if profile == "" {
+		delete(repo.PermissionProfiles, string(agentType))
+	} else {
+		if repo.PermissionProfiles == nil {
+			repo.PermissionProfiles = make(map[string]string)
+		}
+		repo.PermissionProfiles[string(agentType)] = profile
+	}
+	return s.saveUnlocked(repoKey(repoName))
+}
+
+// GetCIFixConfig returns the CI fix-up config for a repository
+func (s *State) GetCIFixConfig(repoName string) (CIFixConfig, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return CIFixConfig{}, fmt.Errorf("repository %q not found", repoName)
+	}
+
+	config := repo.CIFixConfig
+	if config.MaxAttempts == 0 {
+		config.MaxAttempts = DefaultCIFixMaxAttempts
+	}
+	return config, nil
+}
+
+// UpdateCIFixConfig updates the CI fix-up config for a repository
+func (s *State) UpdateCIFixConfig(repoName string, config CIFixConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return fmt.Errorf("repository %q not found", repoName)
+	}
+	if config.MaxAttempts < 0 {
+		return fmt.Errorf("max attempts must be 0 (default) or greater, got %d", config.MaxAttempts)
+	}
+
+	repo.CIFixConfig = config
+	return s.saveUnlocked(repoKey(repoName))
+}
+
+// GetWorkerResumeConfig returns the crashed-worker resume config for a repository
+func (s *State) GetWorkerResumeConfig(repoName string) (WorkerResumeConfig, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return WorkerResumeConfig{}, fmt.Errorf("repository %q not found", repoName)
+	}
+
+	config := repo.WorkerResumeConfig
+	if config.MaxAttempts == 0 {
+		config.MaxAttempts = DefaultWorkerResumeMaxAttempts
+	}
+	return config, nil
+}
+
+// UpdateWorkerResumeConfig updates the crashed-worker resume config for a repository
+func (s *State) UpdateWorkerResumeConfig(repoName string, config WorkerResumeConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return fmt.Errorf("repository %q not found", repoName)
+	}
+	if config.MaxAttempts < 0 {
+		return fmt.Errorf("max attempts must be 0 (default) or greater, got %d", config.MaxAttempts)
+	}
+
+	repo.WorkerResumeConfig = config
+	return s.saveUnlocked(repoKey(repoName))
+}
+
+// GetMessageRetentionConfig returns the message retention config for a
+// repository, with defaults filled in
+func (s *State) GetMessageRetentionConfig(repoName string) (MessageRetentionConfig, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return MessageRetentionConfig{}, fmt.Errorf("repository %q not found", repoName)
+	}
+
+	config := repo.MessageRetention
+	if config.MaxAgeDays == 0 {
+		config.MaxAgeDays = DefaultMessageMaxAgeDays
+	}
+	if config.MaxPerAgent == 0 {
+		config.MaxPerAgent = DefaultMessageMaxPerAgent
+	}
+	return config, nil
+}
+
+// UpdateMessageRetentionConfig updates the message retention config for a repository
+func (s *State) UpdateMessageRetentionConfig(repoName string, config MessageRetentionConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return fmt.Errorf("repository %q not found", repoName)
+	}
+	if config.MaxAgeDays < 0 || config.MaxPerAgent < 0 {
+		return fmt.Errorf("message retention limits must be 0 (default) or greater, got %d days and %d messages", config.MaxAgeDays, config.MaxPerAgent)
+	}
+
+	repo.MessageRetention = config
+	return s.saveUnlocked(repoKey(repoName))
+}
+
+// LinkTaskMessages records where a finished task's mailbox was archived. The
+// most recent history entry for the agent without an archive is updated.
+// Returns false if there is no such entry.
+func (s *State) LinkTaskMessages(repoName, agentName, archivePath string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return false, fmt.Errorf("repository %q not found", repoName)
+	}
+	for i := len(repo.TaskHistory) - 1; i >= 0; i-- {
+		entry := &repo.TaskHistory[i]
+		if entry.Name == agentName && entry.Messages == "" {
+			entry.Messages = archivePath
+			return true, s.saveUnlocked(historyKey(repoName, i))
+		}
+	}
+	return false, nil
+}
+
+// GetRefreshConfig returns the worktree refresh config for a repository
+func (s *State) GetRefreshConfig(repoName string) (RefreshConfig, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return RefreshConfig{}, fmt.Errorf("repository %q not found", repoName)
+	}
+	return repo.RefreshConfig, nil
+}
+
+// UpdateRefreshConfig updates the worktree refresh config for a repository
+func (s *State) UpdateRefreshConfig(repoName string, config RefreshConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return fmt.Errorf("repository %q not found", repoName)
+	}
+
+	repo.RefreshConfig = config
+	return s.saveUnlocked(repoKey(repoName))
+}
+
+// copyBudgetConfig returns a copy of config that shares no map with it
+func copyBudgetConfig(config BudgetConfig) BudgetConfig {
+	if config.AgentTypes != nil {
+		types := make(map[AgentType]TokenBudget, len(config.AgentTypes))
+		for agentType, budget := range config.AgentTypes {
+			types[agentType] = budget
+		}
+		config.AgentTypes = types
+	}
+	return config
+}
+
+// GetBudgetConfig returns the daily token budgets of a repository
+func (s *State) GetBudgetConfig(repoName string) (BudgetConfig, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return BudgetConfig{}, fmt.Errorf("repository %q not found", repoName)
+	}
+	return copyBudgetConfig(repo.BudgetConfig), nil
+}
+
+// UpdateBudgetConfig updates the daily token budgets of a repository.
+// Agent types whose budget is zero are dropped.
+func (s *State) UpdateBudgetConfig(repoName string, config BudgetConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return fmt.Errorf("repository %q not found", repoName)
+	}
+	if err := config.Repo.Validate(); err != nil {
+		return fmt.Errorf("repository budget: %w", err)
+	}
+	config = copyBudgetConfig(config)
+	for agentType, budget := range config.AgentTypes {
+		if err := budget.Validate(); err != nil {
+			return fmt.Errorf("%s budget: %w", agentType, err)
+		}
+		if budget.IsZero() {
+			delete(config.AgentTypes, agentType)
+		}
+	}
+	if len(config.AgentTypes) == 0 {
+		config.AgentTypes = nil
+	}
+
+	repo.BudgetConfig = config
+	return s.saveUnlocked(repoKey(repoName))
+}
+
+// GetGlobalBudget returns the daily token budget across all repositories
+func (s *State) GetGlobalBudget() TokenBudget {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.GlobalBudget
+}
+
+// UpdateGlobalBudget updates the daily token budget across all repositories
+func (s *State) UpdateGlobalBudget(budget TokenBudget) error {
+	if err := budget.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.GlobalBudget = budget
+	return s.saveUnlocked(metaKey())
+}
+
+// EnqueueTask appends a task to the repository's worker queue and returns its
+// 1-based position
+func (s *State) EnqueueTask(repoName string, task QueuedTask) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return 0, fmt.Errorf("repository %q not found", repoName)
+	}
+
+	if err := checkTaskNameUnlocked(repoName, repo, task.Name); err != nil {
+		return 0, err
+	}
+
+	repo.WorkerQueue = append(repo.WorkerQueue, task)
+	if err := s.saveUnlocked(repoKey(repoName)); err != nil {
+		return 0, err
+	}
+	return len(repo.WorkerQueue), nil
+}
+
+// GetWorkerQueue returns the queued tasks for a repository in FIFO order
+func (s *State) GetWorkerQueue(repoName string) ([]QueuedTask, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return nil, fmt.Errorf("repository %q not found", repoName)
+	}
+
+	result := make([]QueuedTask, len(repo.WorkerQueue))
+	copy(result, repo.WorkerQueue)
+	return result, nil
+}
+
+// RemoveQueuedTask removes a task from the worker queue by name
+func (s *State) RemoveQueuedTask(repoName, taskName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return fmt.Errorf("repository %q not found", repoName)
+	}
+
+	for i, queued := range repo.WorkerQueue {
+		if queued.Name == taskName {
+			repo.WorkerQueue = append(repo.WorkerQueue[:i], repo.WorkerQueue[i+1:]...)
+			return s.saveUnlocked(repoKey(repoName))
+		}
+	}
+
+	return fmt.Errorf("task %q not found in queue for repository %q", taskName, repoName)
+}
+
+// PromoteQueuedTask moves a queued task to the front of the worker queue
+func (s *State) PromoteQueuedTask(repoName, taskName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, exists := s.Repos[repoName]
+	if !exists {
+		return fmt.Errorf("repository %q not found", repoName)
+	}
+
+	for i, queued := range repo.WorkerQueue {
+		if queued.Name == taskName {
+			copy(repo.WorkerQueue[1:i+1], repo.WorkerQueue[:i])
+			repo.WorkerQueue[0] = queued
+			return s.saveUnlocked(repoKey(repoName))
+		}
+	}
+
+	return fmt.Errorf("task %q not found in queue for repository %q", taskName, repoName)
+}
+
+// saveUnlocked commits the changes made to state, naming the documents the
+// mutation changed (caller must hold lock)
+func (s *State) saveUnlocked(changed ...docKey) error {
+	s.dirty = changed
+	defer func() { s.dirty = nil }()
+	return s.store.Commit(s)
 }
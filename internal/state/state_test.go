@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -123,6 +124,26 @@ func TestAddRepoDuplicate(t *testing.T) {
 	}
 }
 
+func TestValidateNames(t *testing.T) {
+	for _, name := range []string{"my-app", "my.app", "clever-fox", "Repo_2"} {
+		if err := ValidateRepoName(name); err != nil {
+			t.Errorf("ValidateRepoName(%q) = %v", name, err)
+		}
+		if err := ValidateAgentName(name); err != nil {
+			t.Errorf("ValidateAgentName(%q) = %v", name, err)
+		}
+	}
+
+	for _, name := range []string{"", ".", "..", "../evil", "a/b", `a\b`, ".hidden", "-flag", "name.", "a..b", "a b", "a:b", "a@b", "a\nb"} {
+		if err := ValidateRepoName(name); err == nil {
+			t.Errorf("ValidateRepoName(%q) should fail", name)
+		}
+		if err := ValidateAgentName(name); err == nil {
+			t.Errorf("ValidateAgentName(%q) should fail", name)
+		}
+	}
+}
+
 func TestGetRepoNonExistent(t *testing.T) {
 	tmpDir := t.TempDir()
 	statePath := filepath.Join(tmpDir, "state.json")
@@ -1515,6 +1536,35 @@ func TestUpdateAgentPID(t *testing.T) {
 	}
 }
 
+func TestSetAgentPromptFile(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	s := New(statePath)
+
+	if err := s.AddRepo("test-repo", &Repository{Agents: make(map[string]Agent)}); err != nil {
+		t.Fatalf("AddRepo() failed: %v", err)
+	}
+	if err := s.AddAgent("test-repo", "supervisor", Agent{Type: AgentTypeSupervisor, CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("AddAgent() failed: %v", err)
+	}
+
+	promptFile := "/tmp/prompts/test-repo/supervisor/v2.md"
+	if err := s.SetAgentPromptFile("test-repo", "supervisor", promptFile); err != nil {
+		t.Fatalf("SetAgentPromptFile() failed: %v", err)
+	}
+
+	loaded, err := Load(statePath)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if agent, _ := loaded.GetAgent("test-repo", "supervisor"); agent.PromptFile != promptFile {
+		t.Errorf("PromptFile = %q, want %q", agent.PromptFile, promptFile)
+	}
+
+	if err := s.SetAgentPromptFile("test-repo", "nonexistent", promptFile); err == nil {
+		t.Error("SetAgentPromptFile should fail for nonexistent agent")
+	}
+}
+
 func TestUpdateTaskHistorySummary(t *testing.T) {
 	tmpDir := t.TempDir()
 	statePath := filepath.Join(tmpDir, "state.json")
@@ -1602,6 +1652,19 @@ func TestAgentTypeIsPersistent(t *testing.T) {
 	}
 }
 
+func TestAgentTypeIsValid(t *testing.T) {
+	for _, agentType := range []AgentType{AgentTypeSupervisor, AgentTypeWorker, AgentTypeMergeQueue, AgentTypePRShepherd, AgentTypeWorkspace, AgentTypeReview, AgentTypeGenericPersistent} {
+		if !agentType.IsValid() {
+			t.Errorf("AgentType(%q).IsValid() = false, want true", agentType)
+		}
+	}
+	for _, agentType := range []AgentType{"unknown", ""} {
+		if agentType.IsValid() {
+			t.Errorf("AgentType(%q).IsValid() = true, want false", agentType)
+		}
+	}
+}
+
 func TestDefaultPRShepherdConfig(t *testing.T) {
 	config := DefaultPRShepherdConfig()
 
@@ -2206,3 +2269,627 @@ func TestGetTaskHistoryNoLimit(t *testing.T) {
 		t.Errorf("GetTaskHistory() with limit=0 returned %d entries, want 5", len(history))
 	}
 }
+
+func TestPendingTasks(t *testing.T) {
+	tmpDir := t.TempDir()
+	statePath := filepath.Join(tmpDir, "state.json")
+
+	s := New(statePath)
+
+	repo := &Repository{
+		GithubURL:   "https://github.com/test/repo",
+		TmuxSession: "mc-test",
+		Agents:      make(map[string]Agent),
+	}
+	if err := s.AddRepo("test-repo", repo); err != nil {
+		t.Fatalf("AddRepo() failed: %v", err)
+	}
+	if err := s.AddAgent("test-repo", "parent", Agent{Type: AgentTypeWorker, CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("AddAgent() failed: %v", err)
+	}
+
+	task := PendingTask{
+		Name:      "child",
+		Task:      "Build on parent",
+		DependsOn: []string{"parent", "#42"},
+		CreatedAt: time.Now(),
+	}
+	if err := s.AddPendingTask("test-repo", task); err != nil {
+		t.Fatalf("AddPendingTask() failed: %v", err)
+	}
+
+	// Names must be unique across agents and pending tasks
+	if err := s.AddPendingTask("test-repo", task); err == nil {
+		t.Error("AddPendingTask() should fail for a duplicate pending task")
+	}
+	if err := s.AddPendingTask("test-repo", PendingTask{Name: "parent", DependsOn: []string{"#1"}}); err == nil {
+		t.Error("AddPendingTask() should fail when an agent has the same name")
+	}
+	if err := s.AddPendingTask("missing-repo", task); err == nil {
+		t.Error("AddPendingTask() should fail for a nonexistent repo")
+	}
+
+	if err := s.UpdatePendingTaskBlockedReason("test-repo", "child", "dependency did not merge: parent"); err != nil {
+		t.Fatalf("UpdatePendingTaskBlockedReason() failed: %v", err)
+	}
+
+	// Pending tasks survive a reload
+	loaded, err := Load(statePath)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	tasks, err := loaded.GetPendingTasks("test-repo")
+	if err != nil {
+		t.Fatalf("GetPendingTasks() failed: %v", err)
+	}
+	if len(tasks) != 1 {
+		t.Fatalf("GetPendingTasks() returned %d tasks, want 1", len(tasks))
+	}
+	if len(tasks[0].DependsOn) != 2 || tasks[0].BlockedReason == "" {
+		t.Errorf("pending task not persisted correctly: %+v", tasks[0])
+	}
+
+	if err := s.RemovePendingTask("test-repo", "child"); err != nil {
+		t.Fatalf("RemovePendingTask() failed: %v", err)
+	}
+	if err := s.RemovePendingTask("test-repo", "child"); err == nil {
+		t.Error("RemovePendingTask() should fail for a missing task")
+	}
+	tasks, _ = s.GetPendingTasks("test-repo")
+	if len(tasks) != 0 {
+		t.Errorf("GetPendingTasks() returned %d tasks after removal, want 0", len(tasks))
+	}
+}
+
+func TestParsePRDependency(t *testing.T) {
+	tests := []struct {
+		dep    string
+		want   int
+		wantOK bool
+	}{
+		{"#42", 42, true},
+		{"42", 42, true},
+		{"clever-fox", 0, false},
+		{"#", 0, false},
+		{"#0", 0, false},
+		{"#-3", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParsePRDependency(tt.dep)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("ParsePRDependency(%q) = (%d, %v), want (%d, %v)", tt.dep, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestResolveDependency(t *testing.T) {
+	history := []TaskHistoryEntry{
+		{Name: "merged-worker", Status: TaskStatusMerged, PRNumber: 10},
+		{Name: "open-worker", Status: TaskStatusOpen, PRNumber: 11},
+		{Name: "closed-worker", Status: TaskStatusClosed, PRNumber: 12},
+		{Name: "failed-worker", Status: TaskStatusFailed},
+		{Name: "no-pr-worker", Status: TaskStatusNoPR},
+	}
+
+	tests := []struct {
+		dep  string
+		want DependencyState
+	}{
+		{"merged-worker", DependencyMerged},
+		{"#10", DependencyMerged},
+		{"open-worker", DependencyWaiting},
+		{"#11", DependencyWaiting},
+		{"closed-worker", DependencyFailed},
+		{"failed-worker", DependencyFailed},
+		{"no-pr-worker", DependencyFailed},
+		{"still-running", DependencyWaiting},
+		{"#99", DependencyWaiting},
+	}
+
+	for _, tt := range tests {
+		if got := ResolveDependency(history, tt.dep); got != tt.want {
+			t.Errorf("ResolveDependency(%q) = %s, want %s", tt.dep, got, tt.want)
+		}
+	}
+}
+
+func TestWorkerQueue(t *testing.T) {
+	tmpDir := t.TempDir()
+	statePath := filepath.Join(tmpDir, "state.json")
+
+	s := New(statePath)
+
+	repo := &Repository{
+		GithubURL:   "https://github.com/test/repo",
+		TmuxSession: "mc-test",
+		Agents:      make(map[string]Agent),
+	}
+	if err := s.AddRepo("test-repo", repo); err != nil {
+		t.Fatalf("AddRepo() failed: %v", err)
+	}
+
+	if err := s.UpdateMaxWorkers("test-repo", -1); err == nil {
+		t.Error("UpdateMaxWorkers() should reject negative limits")
+	}
+	if err := s.UpdateMaxWorkers("test-repo", 2); err != nil {
+		t.Fatalf("UpdateMaxWorkers() failed: %v", err)
+	}
+
+	for i, name := range []string{"first", "second", "third"} {
+		position, err := s.EnqueueTask("test-repo", QueuedTask{Name: name, Task: "Task " + name, QueuedAt: time.Now()})
+		if err != nil {
+			t.Fatalf("EnqueueTask(%s) failed: %v", name, err)
+		}
+		if position != i+1 {
+			t.Errorf("EnqueueTask(%s) position = %d, want %d", name, position, i+1)
+		}
+	}
+
+	if _, err := s.EnqueueTask("test-repo", QueuedTask{Name: "second"}); err == nil {
+		t.Error("EnqueueTask() should reject duplicate names")
+	}
+	if err := s.AddPendingTask("test-repo", PendingTask{Name: "third", DependsOn: []string{"#1"}}); err == nil {
+		t.Error("AddPendingTask() should reject names already in the queue")
+	}
+
+	if err := s.PromoteQueuedTask("test-repo", "third"); err != nil {
+		t.Fatalf("PromoteQueuedTask() failed: %v", err)
+	}
+	if err := s.RemoveQueuedTask("test-repo", "first"); err != nil {
+		t.Fatalf("RemoveQueuedTask() failed: %v", err)
+	}
+	if err := s.RemoveQueuedTask("test-repo", "first"); err == nil {
+		t.Error("RemoveQueuedTask() should fail for a missing task")
+	}
+	if err := s.PromoteQueuedTask("test-repo", "missing"); err == nil {
+		t.Error("PromoteQueuedTask() should fail for a missing task")
+	}
+
+	// Queue order and limit survive a reload
+	loaded, err := Load(statePath)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	queue, err := loaded.GetWorkerQueue("test-repo")
+	if err != nil {
+		t.Fatalf("GetWorkerQueue() failed: %v", err)
+	}
+	var names []string
+	for _, task := range queue {
+		names = append(names, task.Name)
+	}
+	if strings.Join(names, ",") != "third,second" {
+		t.Errorf("queue order = %v, want [third second]", names)
+	}
+	if maxWorkers, _ := loaded.GetMaxWorkers("test-repo"); maxWorkers != 2 {
+		t.Errorf("GetMaxWorkers() = %d, want 2", maxWorkers)
+	}
+}
+
+func TestMessageGroups(t *testing.T) {
+	tmpDir := t.TempDir()
+	statePath := filepath.Join(tmpDir, "state.json")
+
+	s := New(statePath)
+	if err := s.AddRepo("test-repo", &Repository{Agents: make(map[string]Agent)}); err != nil {
+		t.Fatalf("AddRepo() failed: %v", err)
+	}
+
+	if err := s.SetMessageGroup("test-repo", "@frontend", []string{"fox"}); err == nil {
+		t.Error("SetMessageGroup() should reject names with @")
+	}
+	if err := s.SetMessageGroup("test-repo", "frontend", []string{"fox", "owl"}); err != nil {
+		t.Fatalf("SetMessageGroup() failed: %v", err)
+	}
+	if err := s.SetMessageGroup("test-repo", "leads", []string{"supervisor"}); err != nil {
+		t.Fatalf("SetMessageGroup() failed: %v", err)
+	}
+	if err := s.SetMessageGroup("test-repo", "leads", nil); err != nil {
+		t.Fatalf("SetMessageGroup() removal failed: %v", err)
+	}
+
+	// Copies don't alias state
+	s.GetAllRepos()["test-repo"].MessageGroups["frontend"][0] = "changed"
+
+	loaded, err := Load(statePath)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	groups, err := loaded.GetMessageGroups("test-repo")
+	if err != nil {
+		t.Fatalf("GetMessageGroups() failed: %v", err)
+	}
+	if len(groups) != 1 || strings.Join(groups["frontend"], ",") != "fox,owl" {
+		t.Errorf("groups = %v, want only frontend: [fox owl]", groups)
+	}
+}
+
+func TestMessageRetentionConfig(t *testing.T) {
+	s := New(filepath.Join(t.TempDir(), "state.json"))
+	repo := &Repository{
+		Agents: make(map[string]Agent),
+		TaskHistory: []TaskHistoryEntry{
+			{Name: "fox", Task: "First attempt", Messages: "/archive/fox_1"},
+			{Name: "fox", Task: "Second attempt"},
+		},
+	}
+	if err := s.AddRepo("test-repo", repo); err != nil {
+		t.Fatalf("AddRepo() failed: %v", err)
+	}
+
+	config, err := s.GetMessageRetentionConfig("test-repo")
+	if err != nil {
+		t.Fatalf("GetMessageRetentionConfig() failed: %v", err)
+	}
+	if config.MaxAgeDays != DefaultMessageMaxAgeDays || config.MaxPerAgent != DefaultMessageMaxPerAgent {
+		t.Errorf("default retention = %+v", config)
+	}
+	if err := s.UpdateMessageRetentionConfig("test-repo", MessageRetentionConfig{MaxAgeDays: -1}); err == nil {
+		t.Error("UpdateMessageRetentionConfig() should reject negative limits")
+	}
+	if err := s.UpdateMessageRetentionConfig("test-repo", MessageRetentionConfig{MaxAgeDays: 30}); err != nil {
+		t.Fatalf("UpdateMessageRetentionConfig() failed: %v", err)
+	}
+	if config, _ := s.GetMessageRetentionConfig("test-repo"); config.MaxAgeDays != 30 || config.MaxPerAgent != DefaultMessageMaxPerAgent {
+		t.Errorf("retention = %+v, want 30 days and the default count", config)
+	}
+
+	// The archive is linked to the latest entry that doesn't have one
+	if linked, err := s.LinkTaskMessages("test-repo", "fox", "/archive/fox_2"); err != nil || !linked {
+		t.Fatalf("LinkTaskMessages() = %v, %v", linked, err)
+	}
+	if linked, _ := s.LinkTaskMessages("test-repo", "fox", "/archive/fox_3"); linked {
+		t.Error("LinkTaskMessages() should not overwrite an existing link")
+	}
+	history, _ := s.GetTaskHistory("test-repo", 0)
+	for _, entry := range history {
+		if entry.Task == "Second attempt" && entry.Messages != "/archive/fox_2" {
+			t.Errorf("second attempt messages = %q", entry.Messages)
+		}
+	}
+}
+
+func TestUpdateAgentActivity(t *testing.T) {
+	tmpDir := t.TempDir()
+	statePath := filepath.Join(tmpDir, "state.json")
+
+	s := New(statePath)
+
+	repo := &Repository{
+		GithubURL:   "https://github.com/test/repo",
+		TmuxSession: "mc-test",
+		Agents:      make(map[string]Agent),
+	}
+	if err := s.AddRepo("test-repo", repo); err != nil {
+		t.Fatalf("AddRepo() failed: %v", err)
+	}
+	if err := s.AddAgent("test-repo", "worker", Agent{Type: AgentTypeWorker, Task: "task"}); err != nil {
+		t.Fatalf("AddAgent() failed: %v", err)
+	}
+
+	if _, err := s.UpdateAgentActivity("test-repo", "missing", ActivityIdle); err == nil {
+		t.Error("UpdateAgentActivity() should fail for unknown agent")
+	}
+
+	previous, err := s.UpdateAgentActivity("test-repo", "worker", ActivityBusy)
+	if err != nil {
+		t.Fatalf("UpdateAgentActivity() failed: %v", err)
+	}
+	if previous != ActivityUnknown {
+		t.Errorf("previous = %q, want unknown", previous)
+	}
+
+	agent, _ := s.GetAgent("test-repo", "worker")
+	changedAt := agent.ActivityChangedAt
+	if agent.Activity != ActivityBusy || changedAt.IsZero() {
+		t.Fatalf("Activity = %q (changed %v), want busy with timestamp", agent.Activity, changedAt)
+	}
+	if agent.Task != "task" {
+		t.Error("UpdateAgentActivity() should not touch other fields")
+	}
+
+	// Same activity keeps the original timestamp
+	if previous, _ := s.UpdateAgentActivity("test-repo", "worker", ActivityBusy); previous != ActivityBusy {
+		t.Errorf("previous = %q, want busy", previous)
+	}
+	agent, _ = s.GetAgent("test-repo", "worker")
+	if !agent.ActivityChangedAt.Equal(changedAt) {
+		t.Error("ActivityChangedAt should not change when activity is unchanged")
+	}
+
+	if _, err := s.UpdateAgentActivity("test-repo", "worker", ActivityWaitingPermission); err != nil {
+		t.Fatalf("UpdateAgentActivity() failed: %v", err)
+	}
+
+	loaded, err := Load(statePath)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	agent, _ = loaded.GetAgent("test-repo", "worker")
+	if agent.Activity != ActivityWaitingPermission {
+		t.Errorf("loaded Activity = %q, want waiting_permission", agent.Activity)
+	}
+}
+
+func TestPullRequests(t *testing.T) {
+	tmpDir := t.TempDir()
+	statePath := filepath.Join(tmpDir, "state.json")
+
+	s := New(statePath)
+
+	repo := &Repository{
+		GithubURL:   "https://github.com/test/repo",
+		TmuxSession: "mc-test",
+		Agents:      make(map[string]Agent),
+	}
+	if err := s.AddRepo("test-repo", repo); err != nil {
+		t.Fatalf("AddRepo() failed: %v", err)
+	}
+
+	if _, _, err := s.UpdatePullRequest("missing", PullRequestStatus{Branch: "b"}); err == nil {
+		t.Error("UpdatePullRequest() should fail for unknown repo")
+	}
+
+	_, existed, err := s.UpdatePullRequest("test-repo", PullRequestStatus{Branch: "work/b", Number: 9, State: TaskStatusOpen, CIStatus: CIPending})
+	if err != nil || existed {
+		t.Fatalf("UpdatePullRequest() = existed %v, err %v; want new record", existed, err)
+	}
+	if _, _, err := s.UpdatePullRequest("test-repo", PullRequestStatus{Branch: "work/a", Number: 4, State: TaskStatusMerged}); err != nil {
+		t.Fatalf("UpdatePullRequest() failed: %v", err)
+	}
+
+	previous, existed, err := s.UpdatePullRequest("test-repo", PullRequestStatus{Branch: "work/b", Number: 9, State: TaskStatusOpen, CIStatus: CIFailing})
+	if err != nil || !existed || previous.CIStatus != CIPending {
+		t.Errorf("UpdatePullRequest() previous = %+v, existed %v, err %v", previous, existed, err)
+	}
+
+	// Snapshots don't share the map with live state
+	snapshot := s.GetAllRepos()["test-repo"]
+	delete(snapshot.PullRequests, "work/a")
+
+	loaded, err := Load(statePath)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	prs, err := loaded.GetPullRequests("test-repo")
+	if err != nil {
+		t.Fatalf("GetPullRequests() failed: %v", err)
+	}
+	if len(prs) != 2 || prs[0].Number != 4 || prs[1].CIStatus != CIFailing {
+		t.Errorf("GetPullRequests() = %+v, want #4 then #9 (failing)", prs)
+	}
+
+	if err := s.RemovePullRequest("test-repo", "work/a"); err != nil {
+		t.Fatalf("RemovePullRequest() failed: %v", err)
+	}
+	if err := s.RemovePullRequest("test-repo", "work/none"); err != nil {
+		t.Errorf("RemovePullRequest() of untracked branch should be a no-op: %v", err)
+	}
+	if prs, _ := s.GetPullRequests("test-repo"); len(prs) != 1 {
+		t.Errorf("GetPullRequests() after remove = %d PRs, want 1", len(prs))
+	}
+}
+
+func TestCIFixConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	statePath := filepath.Join(tmpDir, "state.json")
+
+	s := New(statePath)
+
+	if _, err := s.GetCIFixConfig("nonexistent"); err == nil {
+		t.Error("GetCIFixConfig() should fail for nonexistent repo")
+	}
+
+	repo := &Repository{
+		GithubURL:   "https://github.com/test/repo",
+		TmuxSession: "mc-test",
+		Agents:      make(map[string]Agent),
+	}
+	if err := s.AddRepo("test-repo", repo); err != nil {
+		t.Fatalf("AddRepo() failed: %v", err)
+	}
+
+	// Disabled by default with the default attempt budget
+	config, err := s.GetCIFixConfig("test-repo")
+	if err != nil {
+		t.Fatalf("GetCIFixConfig() failed: %v", err)
+	}
+	if config.Enabled || config.MaxAttempts != DefaultCIFixMaxAttempts {
+		t.Errorf("default config = %+v", config)
+	}
+
+	if err := s.UpdateCIFixConfig("test-repo", CIFixConfig{Enabled: true, MaxAttempts: -1}); err == nil {
+		t.Error("UpdateCIFixConfig() should reject negative attempts")
+	}
+	if err := s.UpdateCIFixConfig("test-repo", CIFixConfig{Enabled: true, MaxAttempts: 5}); err != nil {
+		t.Fatalf("UpdateCIFixConfig() failed: %v", err)
+	}
+
+	// Persisted across reloads
+	loaded, err := Load(statePath)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	config, _ = loaded.GetCIFixConfig("test-repo")
+	if !config.Enabled || config.MaxAttempts != 5 {
+		t.Errorf("loaded config = %+v, want enabled with 5 attempts", config)
+	}
+}
+
+func TestWorkerResume(t *testing.T) {
+	tmpDir := t.TempDir()
+	statePath := filepath.Join(tmpDir, "state.json")
+
+	s := New(statePath)
+
+	repo := &Repository{
+		GithubURL:   "https://github.com/test/repo",
+		TmuxSession: "mc-test",
+		Agents:      map[string]Agent{"clever-fox": {Type: AgentTypeWorker}},
+	}
+	if err := s.AddRepo("test-repo", repo); err != nil {
+		t.Fatalf("AddRepo() failed: %v", err)
+	}
+
+	// Enabled by default with the default attempt budget
+	config, err := s.GetWorkerResumeConfig("test-repo")
+	if err != nil {
+		t.Fatalf("GetWorkerResumeConfig() failed: %v", err)
+	}
+	if config.Disabled || config.MaxAttempts != DefaultWorkerResumeMaxAttempts {
+		t.Errorf("default config = %+v", config)
+	}
+	if err := s.UpdateWorkerResumeConfig("test-repo", WorkerResumeConfig{MaxAttempts: -1}); err == nil {
+		t.Error("UpdateWorkerResumeConfig() should reject negative attempts")
+	}
+	if err := s.UpdateWorkerResumeConfig("test-repo", WorkerResumeConfig{Disabled: true, MaxAttempts: 1}); err != nil {
+		t.Fatalf("UpdateWorkerResumeConfig() failed: %v", err)
+	}
+	if config, _ := s.GetWorkerResumeConfig("test-repo"); !config.Disabled || config.MaxAttempts != 1 {
+		t.Errorf("updated config = %+v", config)
+	}
+
+	if _, err := s.RecordAgentResume("test-repo", "missing"); err == nil {
+		t.Error("RecordAgentResume() should fail for unknown agent")
+	}
+	for want := 1; want <= 2; want++ {
+		count, err := s.RecordAgentResume("test-repo", "clever-fox")
+		if err != nil || count != want {
+			t.Errorf("RecordAgentResume() = %d, %v; want %d", count, err, want)
+		}
+	}
+
+	loaded, err := Load(statePath)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	agent, _ := loaded.GetAgent("test-repo", "clever-fox")
+	if agent.ResumeCount != 2 || agent.LastResumedAt.IsZero() {
+		t.Errorf("loaded agent resume = %d at %v, want 2 with a timestamp", agent.ResumeCount, agent.LastResumedAt)
+	}
+
+	if err := s.ResetAgentResumes("test-repo", "clever-fox"); err != nil {
+		t.Fatalf("ResetAgentResumes() failed: %v", err)
+	}
+	if count, _ := s.RecordAgentResume("test-repo", "clever-fox"); count != 1 {
+		t.Errorf("RecordAgentResume() after a reset = %d, want 1", count)
+	}
+}
+
+func TestBudgetConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	statePath := filepath.Join(tmpDir, "state.json")
+
+	s := New(statePath)
+	if err := s.AddRepo("test-repo", &Repository{GithubURL: "https://github.com/test/repo", Agents: map[string]Agent{}}); err != nil {
+		t.Fatalf("AddRepo() failed: %v", err)
+	}
+
+	if config, err := s.GetBudgetConfig("test-repo"); err != nil || !config.Repo.IsZero() || config.AgentTypes != nil {
+		t.Errorf("default budget = %+v, %v; want none", config, err)
+	}
+
+	invalid := []BudgetConfig{
+		{Repo: TokenBudget{WarnTokens: -1}},
+		{Repo: TokenBudget{WarnTokens: 200, CapTokens: 100}},
+		{AgentTypes: map[AgentType]TokenBudget{AgentTypeWorker: {WarnTokens: 5, CapTokens: 1}}},
+	}
+	for _, config := range invalid {
+		if err := s.UpdateBudgetConfig("test-repo", config); err == nil {
+			t.Errorf("UpdateBudgetConfig(%+v) should fail", config)
+		}
+	}
+
+	config := BudgetConfig{
+		Repo: TokenBudget{WarnTokens: 800, CapTokens: 1000},
+		AgentTypes: map[AgentType]TokenBudget{
+			AgentTypeWorker: {CapTokens: 300},
+			AgentTypeReview: {}, // Cleared
+		},
+	}
+	if err := s.UpdateBudgetConfig("test-repo", config); err != nil {
+		t.Fatalf("UpdateBudgetConfig() failed: %v", err)
+	}
+
+	loaded, err := Load(statePath)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	got, _ := loaded.GetBudgetConfig("test-repo")
+	if got.Repo.CapTokens != 1000 || len(got.AgentTypes) != 1 || got.AgentTypes[AgentTypeWorker].CapTokens != 300 {
+		t.Errorf("persisted budget = %+v", got)
+	}
+
+	// Snapshots don't share the map
+	repos := loaded.GetAllRepos()
+	repos["test-repo"].BudgetConfig.AgentTypes[AgentTypeWorker] = TokenBudget{}
+	if got, _ := loaded.GetBudgetConfig("test-repo"); got.AgentTypes[AgentTypeWorker].CapTokens != 300 {
+		t.Error("GetAllRepos() snapshot shares the budget map with state")
+	}
+
+	if err := s.UpdateGlobalBudget(TokenBudget{WarnTokens: 10, CapTokens: 5}); err == nil {
+		t.Error("UpdateGlobalBudget() should reject a warning above the cap")
+	}
+	if err := s.UpdateGlobalBudget(TokenBudget{CapTokens: 5000}); err != nil {
+		t.Fatalf("UpdateGlobalBudget() failed: %v", err)
+	}
+	if loaded, _ := Load(statePath); loaded.GetGlobalBudget().CapTokens != 5000 {
+		t.Errorf("global budget not persisted: %+v", loaded.GetGlobalBudget())
+	}
+}
+
+func TestSetAgentNeedsRebase(t *testing.T) {
+	tmpDir := t.TempDir()
+	statePath := filepath.Join(tmpDir, "state.json")
+
+	s := New(statePath)
+
+	repo := &Repository{
+		GithubURL:   "https://github.com/test/repo",
+		TmuxSession: "mc-test",
+		Agents:      make(map[string]Agent),
+	}
+	if err := s.AddRepo("test-repo", repo); err != nil {
+		t.Fatalf("AddRepo() failed: %v", err)
+	}
+	if err := s.AddAgent("test-repo", "worker", Agent{Type: AgentTypeWorker, Task: "task"}); err != nil {
+		t.Fatalf("AddAgent() failed: %v", err)
+	}
+
+	if _, err := s.SetAgentNeedsRebase("test-repo", "missing", []string{"a.go"}); err == nil {
+		t.Error("SetAgentNeedsRebase() should fail for unknown agent")
+	}
+
+	changed, err := s.SetAgentNeedsRebase("test-repo", "worker", []string{"a.go"})
+	if err != nil || !changed {
+		t.Fatalf("SetAgentNeedsRebase() = %v, %v; want changed", changed, err)
+	}
+	agent, _ := s.GetAgent("test-repo", "worker")
+	since := agent.NeedsRebaseSince
+	if !agent.NeedsRebase || since.IsZero() || len(agent.RebaseConflicts) != 1 {
+		t.Fatalf("agent = %+v, want needs rebase on a.go", agent)
+	}
+
+	// The same conflicts are not a change
+	if changed, _ := s.SetAgentNeedsRebase("test-repo", "worker", []string{"a.go"}); changed {
+		t.Error("SetAgentNeedsRebase() reported a change for the same files")
+	}
+
+	// New conflicts keep the original timestamp
+	if changed, _ := s.SetAgentNeedsRebase("test-repo", "worker", []string{"a.go", "b.go"}); !changed {
+		t.Error("SetAgentNeedsRebase() should report new conflicting files")
+	}
+	agent, _ = s.GetAgent("test-repo", "worker")
+	if !agent.NeedsRebaseSince.Equal(since) || len(agent.RebaseConflicts) != 2 {
+		t.Errorf("agent = %+v, want two conflicts since %v", agent, since)
+	}
+
+	if changed, _ := s.SetAgentNeedsRebase("test-repo", "worker", nil); !changed {
+		t.Error("SetAgentNeedsRebase(nil) should clear the state")
+	}
+	agent, _ = s.GetAgent("test-repo", "worker")
+	if agent.NeedsRebase || agent.RebaseConflicts != nil || !agent.NeedsRebaseSince.IsZero() {
+		t.Errorf("agent = %+v, want needs-rebase cleared", agent)
+	}
+}
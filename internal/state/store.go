@@ -0,0 +1,604 @@
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store persists a State. Mutators commit through the store while holding the
+// state's write lock, so implementations only need to guard their own fields.
+type Store interface {
+	// Load reads the persisted state into s. A missing store leaves s empty.
+	Load(s *State) error
+	// Commit persists the changes made to s since the last commit. The
+	// documents the mutation changed are in s.dirty.
+	Commit(s *State) error
+	// Snapshot writes all of s to the state file
+	Snapshot(s *State) error
+	// Pending returns the number of committed changes not yet in the state file
+	Pending() int
+}
+
+// FileStore rewrites the whole state file on every commit
+type FileStore struct {
+	path string
+}
+
+// NewFileStore creates a store that keeps state in a single JSON file
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Load reads the state file, migrating it if it's from an older schema
+func (f *FileStore) Load(s *State) error {
+	doc, exists, err := readStateDoc(f.path)
+	if err != nil || !exists {
+		return err
+	}
+	if _, err := upgradeDoc(doc, f.path); err != nil {
+		return err
+	}
+	return decodeStateDoc(doc, s)
+}
+
+// Commit rewrites the state file
+func (f *FileStore) Commit(s *State) error {
+	return f.Snapshot(s)
+}
+
+// Snapshot rewrites the state file
+func (f *FileStore) Snapshot(s *State) error {
+	return writeStateFile(f.path, s)
+}
+
+// Pending is always 0: every commit rewrites the state file
+func (f *FileStore) Pending() int {
+	return 0
+}
+
+// readStateDoc decodes a state file into a raw document. Numbers are kept
+// as json.Number so token counts survive the round trip exactly.
+func readStateDoc(path string) (map[string]interface{}, bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]interface{}{}, false, nil
+		}
+		return nil, false, fmt.Errorf("failed to read state file: %w", err)
+	}
+	doc, err := decodeRaw(data)
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to parse state file: %w", err)
+	}
+	return doc, true, nil
+}
+
+// decodeRaw decodes a JSON object, keeping numbers as json.Number
+func decodeRaw(data []byte) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc map[string]interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		doc = map[string]interface{}{}
+	}
+	return doc, nil
+}
+
+// decodeStateDoc fills s from a raw state document
+func decodeStateDoc(doc map[string]interface{}, s *State) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return fmt.Errorf("failed to parse state file: %w", err)
+	}
+	return nil
+}
+
+// writeStateFile atomically writes all of s to path
+func writeStateFile(path string, s *State) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+	return atomicWrite(path, data)
+}
+
+const (
+	// journalSnapshotRecords is how many journal records trigger a snapshot
+	journalSnapshotRecords = 1000
+	// journalSnapshotInterval is the longest a commit waits before the state
+	// file is brought up to date
+	journalSnapshotInterval = time.Minute
+)
+
+// Journal record kinds. A repository record holds everything but its agents
+// and task history, which get a record each so that touching one agent only
+// appends that agent.
+const (
+	recordMeta    = "meta"
+	recordRepo    = "repo"
+	recordAgent   = "agent"
+	recordHistory = "history"
+)
+
+// journalRecord is one line of the journal: a document written or deleted
+type journalRecord struct {
+	Op    string          `json:"op"`            // "put" or "delete"
+	Gen   int             `json:"gen,omitempty"` // Journal generation the record was appended in
+	Kind  string          `json:"kind"`
+	Repo  string          `json:"repo,omitempty"`
+	Name  string          `json:"name,omitempty"`  // Agent name
+	Index int             `json:"index,omitempty"` // Task history position
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+func (r journalRecord) key() string {
+	return fmt.Sprintf("%s\x00%s\x00%s\x00%d", r.Kind, r.Repo, r.Name, r.Index)
+}
+
+// docKey names one document the journal tracks. Mutators pass the documents
+// they changed to saveUnlocked, so a commit only marshals those.
+type docKey struct {
+	kind  string
+	repo  string
+	name  string // Agent name
+	index int    // Task history position
+}
+
+func metaKey() docKey                      { return docKey{kind: recordMeta} }
+func repoKey(repo string) docKey           { return docKey{kind: recordRepo, repo: repo} }
+func agentKey(repo, name string) docKey    { return docKey{kind: recordAgent, repo: repo, name: name} }
+func historyKey(repo string, i int) docKey { return docKey{kind: recordHistory, repo: repo, index: i} }
+
+// repoKeys returns the keys of a repository's documents: the repository
+// itself, its agents, and its task history
+func repoKeys(name string, repo *Repository) []docKey {
+	keys := []docKey{repoKey(name)}
+	for agentName := range repo.Agents {
+		keys = append(keys, agentKey(name, agentName))
+	}
+	for i := range repo.TaskHistory {
+		keys = append(keys, historyKey(name, i))
+	}
+	return keys
+}
+
+// docRecord returns the put record of the document of s named by key and its
+// marshaled form, or false if s has no such document
+func docRecord(s *State, key docKey) (journalRecord, []byte, bool) {
+	var value interface{}
+	switch key.kind {
+	case recordMeta:
+		value = metaDoc{Version: s.Version, CurrentRepo: s.CurrentRepo, GlobalBudget: s.GlobalBudget}
+	case recordRepo:
+		repo, ok := s.Repos[key.repo]
+		if !ok {
+			return journalRecord{}, nil, false
+		}
+		bare := *repo
+		bare.Agents = nil
+		bare.TaskHistory = nil
+		value = bare
+	case recordAgent:
+		repo, ok := s.Repos[key.repo]
+		if !ok {
+			return journalRecord{}, nil, false
+		}
+		agent, ok := repo.Agents[key.name]
+		if !ok {
+			return journalRecord{}, nil, false
+		}
+		value = agent
+	case recordHistory:
+		repo, ok := s.Repos[key.repo]
+		if !ok || key.index < 0 || key.index >= len(repo.TaskHistory) {
+			return journalRecord{}, nil, false
+		}
+		value = repo.TaskHistory[key.index]
+	default:
+		return journalRecord{}, nil, false
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return journalRecord{}, nil, false
+	}
+	rec := journalRecord{Op: "put", Kind: key.kind, Repo: key.repo, Name: key.name, Index: key.index, Value: data}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return journalRecord{}, nil, false
+	}
+	return rec, line, true
+}
+
+// metaDoc is the part of State outside any repository
+type metaDoc struct {
+	Version      int         `json:"version"`
+	CurrentRepo  string      `json:"current_repo,omitempty"`
+	GlobalBudget TokenBudget `json:"global_budget,omitempty"`
+}
+
+// JournalStore appends the documents each commit changed to a write-ahead
+// journal and periodically folds them into a snapshot of the whole state.
+// The snapshot is the state file, so external tools can keep reading it;
+// it lags the journal by at most journalSnapshotInterval.
+//
+// Records carry the generation of the journal they were appended to, and each
+// snapshot is stamped with the generation it folded in. Load skips records at
+// or below the snapshot's generation, so a journal left behind by a crash
+// between writing a snapshot and removing the journal is not replayed over
+// the newer snapshot.
+type JournalStore struct {
+	path        string // State file, doubling as the snapshot
+	journalPath string
+
+	mu           sync.Mutex
+	written      map[string][]byte // Last value persisted for each document
+	records      int               // Records appended since the last snapshot
+	generation   int               // Generation of the records being appended
+	lastSnapshot time.Time
+	migrated     bool // Loaded state was migrated and must be snapshotted
+}
+
+// journalSnapshot is the state file a JournalStore writes: the state, stamped
+// with the journal generation folded into it
+type journalSnapshot struct {
+	*State
+	JournalGeneration int `json:"journal_generation"`
+}
+
+// NewJournalStore creates a journaling store for the state file at path. The
+// journal lives next to it with a .journal extension.
+func NewJournalStore(path string) *JournalStore {
+	return &JournalStore{
+		path:        path,
+		journalPath: JournalPath(path),
+		written:     make(map[string][]byte),
+	}
+}
+
+// JournalPath returns the journal that goes with a state file
+func JournalPath(statePath string) string {
+	return strings.TrimSuffix(statePath, filepath.Ext(statePath)) + ".journal"
+}
+
+// Load reads the snapshot, replays the journal on top of it, and migrates
+// the result if it's from an older schema. A torn last line, left by a crash
+// mid-append, is ignored.
+func (j *JournalStore) Load(s *State) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	doc, exists, err := readStateDoc(j.path)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(j.path); err == nil {
+		j.lastSnapshot = info.ModTime()
+	}
+
+	// Snapshots from before generations were stamped include no record for sure
+	snapshotGen := -1
+	if gen, ok := doc["journal_generation"].(json.Number); ok {
+		if n, err := gen.Int64(); err == nil {
+			snapshotGen = int(n)
+		}
+	}
+	delete(doc, "journal_generation")
+	j.generation = max(snapshotGen, 0) + 1
+
+	j.records = 0
+	file, err := os.Open(j.journalPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to open state journal: %w", err)
+	}
+	if file != nil {
+		defer file.Close()
+		exists = true
+		reader := bufio.NewReader(file)
+		for {
+			line, readErr := reader.ReadBytes('\n')
+			if len(bytes.TrimSpace(line)) > 0 {
+				var rec journalRecord
+				if err := json.Unmarshal(line, &rec); err == nil && rec.Gen > snapshotGen {
+					if err := applyRecord(doc, rec); err != nil {
+						return fmt.Errorf("failed to replay state journal: %w", err)
+					}
+					j.records++
+				}
+			}
+			if readErr != nil {
+				break
+			}
+		}
+	}
+
+	if exists {
+		from, err := upgradeDoc(doc, j.path, j.journalPath)
+		if err != nil {
+			return err
+		}
+		j.migrated = from < CurrentSchemaVersion
+		if err := decodeStateDoc(doc, s); err != nil {
+			return err
+		}
+	}
+	if s.Repos == nil {
+		s.Repos = make(map[string]*Repository)
+	}
+
+	j.written = stateDocs(s)
+	return nil
+}
+
+// Commit appends a record for every document the mutation changed, and
+// snapshots once the journal is long or old enough. Only the changed
+// documents are marshaled, and those that end up as they were written last
+// are skipped.
+func (j *JournalStore) Commit(s *State) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, err := os.Stat(j.path); os.IsNotExist(err) {
+		return j.snapshotLocked(s)
+	}
+	if j.migrated || j.records >= journalSnapshotRecords || time.Since(j.lastSnapshot) >= journalSnapshotInterval {
+		return j.snapshotLocked(s)
+	}
+
+	records, lines := j.changedRecords(s, s.dirty)
+	if len(records) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	for _, rec := range records {
+		rec.Gen = j.generation
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return fmt.Errorf("failed to marshal journal record: %w", err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	file, err := os.OpenFile(j.journalPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open state journal: %w", err)
+	}
+	_, writeErr := file.Write(buf.Bytes())
+	syncErr := file.Sync()
+	closeErr := file.Close()
+	if writeErr != nil {
+		return fmt.Errorf("failed to append to state journal: %w", writeErr)
+	}
+	if syncErr != nil {
+		return fmt.Errorf("failed to sync state journal: %w", syncErr)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("failed to close state journal: %w", closeErr)
+	}
+
+	for _, rec := range records {
+		key := rec.key()
+		if rec.Op == "put" {
+			j.written[key] = lines[key]
+			continue
+		}
+		delete(j.written, key)
+		if rec.Kind == recordRepo {
+			// Replaying the delete drops the repository's agents and history too
+			for _, kind := range []string{recordAgent, recordHistory} {
+				prefix := kind + "\x00" + rec.Repo + "\x00"
+				for written := range j.written {
+					if strings.HasPrefix(written, prefix) {
+						delete(j.written, written)
+					}
+				}
+			}
+		}
+	}
+	j.records += len(records)
+	return nil
+}
+
+// changedRecords returns the records that bring the journal up to date with
+// the documents of s named by keys, along with the marshaled put records by
+// key. A document s no longer has is deleted.
+func (j *JournalStore) changedRecords(s *State, keys []docKey) ([]journalRecord, map[string][]byte) {
+	var puts, deletes []journalRecord
+	lines := make(map[string][]byte)
+	for _, key := range keys {
+		rec, line, exists := docRecord(s, key)
+		if !exists {
+			rec = journalRecord{Op: "delete", Kind: key.kind, Repo: key.repo, Name: key.name, Index: key.index}
+		}
+		k := rec.key()
+		if _, seen := lines[k]; seen {
+			continue
+		}
+		lines[k] = line
+
+		written, wasWritten := j.written[k]
+		switch {
+		case exists && !bytes.Equal(written, line):
+			puts = append(puts, rec)
+		case !exists && wasWritten:
+			deletes = append(deletes, rec)
+		}
+	}
+
+	sort.Slice(puts, func(a, b int) bool { return lessRecord(puts[a], puts[b]) })
+	sort.Slice(deletes, func(a, b int) bool { return lessRecord(deletes[b], deletes[a]) })
+	return append(puts, deletes...), lines
+}
+
+// Snapshot writes the whole state file and empties the journal
+func (j *JournalStore) Snapshot(s *State) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.snapshotLocked(s)
+}
+
+// Pending returns the number of journal records not yet in the snapshot
+func (j *JournalStore) Pending() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.records
+}
+
+func (j *JournalStore) snapshotLocked(s *State) error {
+	data, err := json.MarshalIndent(journalSnapshot{State: s, JournalGeneration: j.generation}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+	if err := atomicWrite(j.path, data); err != nil {
+		return err
+	}
+	// The snapshot's stamp covers the journal from here on, so a crash
+	// before the journal is removed leaves records Load skips
+	if err := os.Remove(j.journalPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to truncate state journal: %w", err)
+	}
+	j.written = stateDocs(s)
+	j.records = 0
+	j.generation++
+	j.lastSnapshot = time.Now()
+	j.migrated = false
+	return nil
+}
+
+// stateDocs marshals every document of s the journal tracks, keyed by
+// journalRecord.key
+func stateDocs(s *State) map[string][]byte {
+	keys := []docKey{metaKey()}
+	for repoName, repo := range s.Repos {
+		keys = append(keys, repoKeys(repoName, repo)...)
+	}
+
+	docs := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		if rec, line, exists := docRecord(s, key); exists {
+			docs[rec.key()] = line
+		}
+	}
+	return docs
+}
+
+// recordOrder sorts records so that replay creates a repository before its
+// agents and history, and deletes them before the repository
+var recordOrder = map[string]int{recordMeta: 0, recordRepo: 1, recordAgent: 2, recordHistory: 3}
+
+func lessRecord(a, b journalRecord) bool {
+	if recordOrder[a.Kind] != recordOrder[b.Kind] {
+		return recordOrder[a.Kind] < recordOrder[b.Kind]
+	}
+	if a.Repo != b.Repo {
+		return a.Repo < b.Repo
+	}
+	if a.Name != b.Name {
+		return a.Name < b.Name
+	}
+	return a.Index < b.Index
+}
+
+// applyRecord replays one journal record onto a raw state document
+func applyRecord(doc map[string]interface{}, rec journalRecord) error {
+	var value interface{}
+	switch rec.Op {
+	case "put":
+		decoder := json.NewDecoder(bytes.NewReader(rec.Value))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			return err
+		}
+	case "delete":
+	default:
+		return fmt.Errorf("unknown journal operation %q", rec.Op)
+	}
+	put := rec.Op == "put"
+	repos := childMap(doc, "repos")
+
+	switch rec.Kind {
+	case recordMeta:
+		meta, _ := value.(map[string]interface{})
+		for _, key := range []string{"version", "current_repo", "global_budget"} {
+			delete(doc, key)
+		}
+		for key, v := range meta {
+			doc[key] = v
+		}
+	case recordRepo:
+		if !put {
+			delete(repos, rec.Repo)
+			return nil
+		}
+		repo, _ := value.(map[string]interface{})
+		if repo == nil {
+			return fmt.Errorf("repository %q is not an object", rec.Repo)
+		}
+		if existing, ok := repos[rec.Repo].(map[string]interface{}); ok {
+			repo["agents"] = existing["agents"]
+			repo["task_history"] = existing["task_history"]
+		}
+		if _, ok := repo["agents"].(map[string]interface{}); !ok {
+			repo["agents"] = map[string]interface{}{}
+		}
+		if repo["task_history"] == nil {
+			delete(repo, "task_history")
+		}
+		repos[rec.Repo] = repo
+	case recordAgent:
+		repo, ok := repos[rec.Repo].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		agents := childMap(repo, "agents")
+		if put {
+			agents[rec.Name] = value
+		} else {
+			delete(agents, rec.Name)
+		}
+	case recordHistory:
+		repo, ok := repos[rec.Repo].(map[string]interface{})
+		if !ok || rec.Index < 0 {
+			return nil
+		}
+		history, _ := repo["task_history"].([]interface{})
+		if put {
+			for len(history) <= rec.Index {
+				history = append(history, map[string]interface{}{})
+			}
+			history[rec.Index] = value
+		} else if rec.Index < len(history) {
+			history = history[:rec.Index]
+		}
+		repo["task_history"] = history
+	default:
+		return fmt.Errorf("unknown journal record kind %q", rec.Kind)
+	}
+	return nil
+}
+
+// childMap returns the object under key in m, creating it if needed
+func childMap(m map[string]interface{}, key string) map[string]interface{} {
+	if child, ok := m[key].(map[string]interface{}); ok {
+		return child
+	}
+	child := map[string]interface{}{}
+	m[key] = child
+	return child
+}
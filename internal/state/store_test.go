@@ -0,0 +1,280 @@
+package state
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJournalStoreAppendsChanges(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	journalPath := JournalPath(statePath)
+	if journalPath != strings.TrimSuffix(statePath, ".json")+".journal" {
+		t.Fatalf("JournalPath() = %q", journalPath)
+	}
+
+	s := New(statePath)
+	if err := s.AddRepo("repo", &Repository{GithubURL: "https://github.com/test/repo", Agents: map[string]Agent{}}); err != nil {
+		t.Fatalf("AddRepo() failed: %v", err)
+	}
+	// The first commit writes the snapshot since there isn't one yet
+	snapshot, err := os.ReadFile(statePath)
+	if err != nil {
+		t.Fatalf("state file not written: %v", err)
+	}
+
+	if err := s.AddAgent("repo", "fox", Agent{Type: AgentTypeWorker, Task: "Add auth", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("AddAgent() failed: %v", err)
+	}
+	if err := s.UpdateAgentPID("repo", "fox", 42); err != nil {
+		t.Fatalf("UpdateAgentPID() failed: %v", err)
+	}
+	if err := s.AddTaskHistory("repo", TaskHistoryEntry{Name: "owl", Task: "Fix bug", Status: TaskStatusMerged}); err != nil {
+		t.Fatalf("AddTaskHistory() failed: %v", err)
+	}
+
+	if data, _ := os.ReadFile(statePath); string(data) != string(snapshot) {
+		t.Error("commits should append to the journal, not rewrite the state file")
+	}
+	journal, err := os.ReadFile(journalPath)
+	if err != nil {
+		t.Fatalf("journal not written: %v", err)
+	}
+	if lines := strings.Count(string(journal), "\n"); lines != 3 {
+		t.Errorf("journal has %d records, want 3 (one per changed document):\n%s", lines, journal)
+	}
+
+	loaded, err := Load(statePath)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	agent, ok := loaded.GetAgent("repo", "fox")
+	if !ok || agent.PID != 42 || agent.Task != "Add auth" {
+		t.Errorf("replayed agent = %+v (found %v)", agent, ok)
+	}
+	if history, _ := loaded.GetTaskHistory("repo", 0); len(history) != 1 || history[0].Name != "owl" {
+		t.Errorf("replayed history = %+v", history)
+	}
+
+	// A checkpoint folds the journal into the state file
+	if err := s.Checkpoint(); err != nil {
+		t.Fatalf("Checkpoint() failed: %v", err)
+	}
+	if _, err := os.Stat(journalPath); !os.IsNotExist(err) {
+		t.Error("journal should be removed after a snapshot")
+	}
+	if data, _ := os.ReadFile(statePath); !strings.Contains(string(data), `"fox"`) {
+		t.Error("state file should include journaled changes after a snapshot")
+	}
+}
+
+func TestJournalStoreReplaysDeletes(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+
+	s := New(statePath)
+	for _, name := range []string{"keep", "drop"} {
+		if err := s.AddRepo(name, &Repository{Agents: map[string]Agent{}}); err != nil {
+			t.Fatalf("AddRepo() failed: %v", err)
+		}
+		if err := s.AddAgent(name, "fox", Agent{Type: AgentTypeWorker}); err != nil {
+			t.Fatalf("AddAgent() failed: %v", err)
+		}
+	}
+	if err := s.AddAgent("keep", "owl", Agent{Type: AgentTypeWorker}); err != nil {
+		t.Fatalf("AddAgent() failed: %v", err)
+	}
+	if err := s.RemoveAgent("keep", "fox"); err != nil {
+		t.Fatalf("RemoveAgent() failed: %v", err)
+	}
+	if err := s.RemoveRepo("drop"); err != nil {
+		t.Fatalf("RemoveRepo() failed: %v", err)
+	}
+	if err := s.SetCurrentRepo("keep"); err != nil {
+		t.Fatalf("SetCurrentRepo() failed: %v", err)
+	}
+
+	loaded, err := Load(statePath)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if repos := loaded.ListRepos(); len(repos) != 1 || repos[0] != "keep" {
+		t.Errorf("replayed repos = %v, want [keep]", repos)
+	}
+	if agents, _ := loaded.ListAgents("keep"); len(agents) != 1 || agents[0] != "owl" {
+		t.Errorf("replayed agents = %v, want [owl]", agents)
+	}
+	if loaded.GetCurrentRepo() != "keep" {
+		t.Errorf("replayed current repo = %q, want keep", loaded.GetCurrentRepo())
+	}
+}
+
+func TestJournalStoreCommitsOnlyChangedDocuments(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	journalPath := JournalPath(statePath)
+
+	s := New(statePath)
+	if err := s.AddRepo("repo", &Repository{Agents: map[string]Agent{"fox": {Type: AgentTypeWorker}, "owl": {Type: AgentTypeWorker}}}); err != nil {
+		t.Fatalf("AddRepo() failed: %v", err)
+	}
+
+	// A document changed behind the store's back isn't looked at by commits
+	// that don't name it
+	s.Repos["repo"].Agents["owl"] = Agent{Type: AgentTypeWorker, Task: "unsaved"}
+	if err := s.UpdateAgentPID("repo", "fox", 42); err != nil {
+		t.Fatalf("UpdateAgentPID() failed: %v", err)
+	}
+	// Committing a document as it was last written appends nothing
+	if err := s.UpdateAgentPID("repo", "fox", 42); err != nil {
+		t.Fatalf("UpdateAgentPID() failed: %v", err)
+	}
+
+	journal, err := os.ReadFile(journalPath)
+	if err != nil {
+		t.Fatalf("journal not written: %v", err)
+	}
+	if lines := strings.Count(string(journal), "\n"); lines != 1 || !strings.Contains(string(journal), `"name":"fox"`) {
+		t.Errorf("journal = %s, want the one record of fox", journal)
+	}
+}
+
+func TestJournalStoreReplaysCompactedHistory(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+
+	s := New(statePath)
+	if err := s.AddRepo("repo", &Repository{Agents: map[string]Agent{}}); err != nil {
+		t.Fatalf("AddRepo() failed: %v", err)
+	}
+	for i := 0; i <= maxTaskHistory; i++ {
+		// The entry going over the cap is journaled on top of a snapshot
+		if i == maxTaskHistory {
+			if err := s.Checkpoint(); err != nil {
+				t.Fatalf("Checkpoint() failed: %v", err)
+			}
+		}
+		if err := s.AddTaskHistory("repo", TaskHistoryEntry{Name: fmt.Sprintf("task-%d", i)}); err != nil {
+			t.Fatalf("AddTaskHistory() failed: %v", err)
+		}
+	}
+	if s.store.Pending() == 0 {
+		t.Fatal("the compaction should be journaled")
+	}
+
+	loaded, err := Load(statePath)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	for _, st := range []*State{s, loaded} {
+		history, _ := st.GetTaskHistory("repo", 0)
+		if len(history) != compactedTaskHistory {
+			t.Fatalf("history has %d entries, want %d", len(history), compactedTaskHistory)
+		}
+		if newest, oldest := history[0].Name, history[len(history)-1].Name; newest != fmt.Sprintf("task-%d", maxTaskHistory) || oldest != fmt.Sprintf("task-%d", maxTaskHistory+1-compactedTaskHistory) {
+			t.Errorf("history runs from %s to %s, want the newest %d tasks", oldest, newest, compactedTaskHistory)
+		}
+	}
+}
+
+func TestJournalStoreSkipsRecordsInSnapshot(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	journalPath := JournalPath(statePath)
+
+	s := New(statePath)
+	if err := s.AddRepo("repo", &Repository{Agents: map[string]Agent{}}); err != nil {
+		t.Fatalf("AddRepo() failed: %v", err)
+	}
+	if err := s.AddAgent("repo", "fox", Agent{Type: AgentTypeWorker, CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("AddAgent() failed: %v", err)
+	}
+	stale, err := os.ReadFile(journalPath)
+	if err != nil {
+		t.Fatalf("journal not written: %v", err)
+	}
+
+	if err := s.RemoveAgent("repo", "fox"); err != nil {
+		t.Fatalf("RemoveAgent() failed: %v", err)
+	}
+	if err := s.Checkpoint(); err != nil {
+		t.Fatalf("Checkpoint() failed: %v", err)
+	}
+	// A crash after the snapshot was written but before the journal was removed
+	if err := os.WriteFile(journalPath, stale, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(statePath)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if _, ok := loaded.GetAgent("repo", "fox"); ok {
+		t.Error("records already folded into the snapshot were replayed over it")
+	}
+
+	// Records appended after the reload are replayed
+	if err := loaded.AddAgent("repo", "owl", Agent{Type: AgentTypeWorker, CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("AddAgent() failed: %v", err)
+	}
+	reloaded, err := Load(statePath)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if _, ok := reloaded.GetAgent("repo", "owl"); !ok {
+		t.Error("agent added after the reload should be replayed")
+	}
+	if _, ok := reloaded.GetAgent("repo", "fox"); ok {
+		t.Error("stale records should stay skipped")
+	}
+}
+
+func TestJournalStoreIgnoresTornRecord(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+
+	s := New(statePath)
+	if err := s.AddRepo("repo", &Repository{Agents: map[string]Agent{}}); err != nil {
+		t.Fatalf("AddRepo() failed: %v", err)
+	}
+	if err := s.AddAgent("repo", "fox", Agent{Type: AgentTypeWorker}); err != nil {
+		t.Fatalf("AddAgent() failed: %v", err)
+	}
+
+	// A crash mid-append leaves half a line behind
+	f, err := os.OpenFile(JournalPath(statePath), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"op":"put","kind":"agent","repo":"repo","name":"owl","val`)
+	f.Close()
+
+	loaded, err := Load(statePath)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if agents, _ := loaded.ListAgents("repo"); len(agents) != 1 || agents[0] != "fox" {
+		t.Errorf("agents after torn record = %v, want [fox]", agents)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+
+	s := NewWithStore(NewFileStore(statePath))
+	if err := s.AddRepo("repo", &Repository{Agents: map[string]Agent{}}); err != nil {
+		t.Fatalf("AddRepo() failed: %v", err)
+	}
+	if err := s.AddAgent("repo", "fox", Agent{Type: AgentTypeWorker}); err != nil {
+		t.Fatalf("AddAgent() failed: %v", err)
+	}
+	if _, err := os.Stat(JournalPath(statePath)); !os.IsNotExist(err) {
+		t.Error("file store should not write a journal")
+	}
+
+	loaded, err := LoadFrom(NewFileStore(statePath))
+	if err != nil {
+		t.Fatalf("LoadFrom() failed: %v", err)
+	}
+	if _, ok := loaded.GetAgent("repo", "fox"); !ok {
+		t.Error("agent not persisted by the file store")
+	}
+}
@@ -0,0 +1,291 @@
+// Package usage reads token usage out of Claude Code session transcripts.
+//
+// Claude Code appends one JSON object per line to
+// <config dir>/projects/<encoded working directory>/<session id>.jsonl. Every
+// assistant turn carries the API usage for that request, which is summed here
+// into per-session totals and priced with a static per-model table.
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Usage is a token count and its estimated cost
+type Usage struct {
+	InputTokens         int64   `json:"input_tokens"`
+	OutputTokens        int64   `json:"output_tokens"`
+	CacheCreationTokens int64   `json:"cache_creation_tokens"`
+	CacheReadTokens     int64   `json:"cache_read_tokens"`
+	CostUSD             float64 `json:"cost_usd"`
+}
+
+// Add accumulates other into u
+func (u *Usage) Add(other Usage) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.CacheCreationTokens += other.CacheCreationTokens
+	u.CacheReadTokens += other.CacheReadTokens
+	u.CostUSD += other.CostUSD
+}
+
+// TotalTokens returns every token counted, including cache reads and writes
+func (u Usage) TotalTokens() int64 {
+	return u.InputTokens + u.OutputTokens + u.CacheCreationTokens + u.CacheReadTokens
+}
+
+// IsZero reports whether no tokens were counted
+func (u Usage) IsZero() bool {
+	return u.TotalTokens() == 0
+}
+
+// Record is the usage of a single API response in a transcript
+type Record struct {
+	ID    string    // Message ID; streamed responses repeat it on several lines
+	Time  time.Time // When the response was written
+	Model string    // Model that produced the response
+	Usage Usage
+}
+
+// Sum totals the records written at or after since (all of them if since is zero)
+func Sum(records []Record, since time.Time) Usage {
+	var total Usage
+	for _, r := range records {
+		if !since.IsZero() && r.Time.Before(since) {
+			continue
+		}
+		total.Add(r.Usage)
+	}
+	return total
+}
+
+// price is the cost of a model in USD per million tokens
+type price struct {
+	input, output float64
+}
+
+// prices maps model name prefixes to list prices. More specific prefixes come
+// first. Cache writes cost 1.25x and cache reads 0.1x the input price.
+var prices = []struct {
+	prefix string
+	price  price
+}{
+	{"claude-opus-4-5", price{5, 25}},
+	{"claude-opus", price{15, 75}},
+	{"claude-3-opus", price{15, 75}},
+	{"claude-haiku-4-5", price{1, 5}},
+	{"claude-3-5-haiku", price{0.80, 4}},
+	{"claude-haiku", price{0.80, 4}},
+	{"claude-3-haiku", price{0.25, 1.25}},
+	{"claude-sonnet", price{3, 15}},
+	{"claude-3-5-sonnet", price{3, 15}},
+	{"claude-3-7-sonnet", price{3, 15}},
+}
+
+// Cost estimates the USD cost of u for model. Unknown models cost nothing.
+func Cost(model string, u Usage) float64 {
+	for _, p := range prices {
+		if strings.HasPrefix(model, p.prefix) {
+			perToken := p.price.input / 1e6
+			return float64(u.InputTokens)*perToken +
+				float64(u.CacheCreationTokens)*perToken*1.25 +
+				float64(u.CacheReadTokens)*perToken*0.1 +
+				float64(u.OutputTokens)*p.price.output/1e6
+		}
+	}
+	return 0
+}
+
+// transcriptLine is the subset of a transcript line carrying usage
+type transcriptLine struct {
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	RequestID string    `json:"requestId"`
+	Message   struct {
+		ID    string `json:"id"`
+		Model string `json:"model"`
+		Usage *struct {
+			InputTokens              int64 `json:"input_tokens"`
+			OutputTokens             int64 `json:"output_tokens"`
+			CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+			CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+		} `json:"usage"`
+	} `json:"message"`
+}
+
+// parseLine returns the usage record on a transcript line, if any
+func parseLine(line []byte) (Record, bool) {
+	var entry transcriptLine
+	if err := json.Unmarshal(line, &entry); err != nil {
+		return Record{}, false
+	}
+	if entry.Type != "assistant" || entry.Message.Usage == nil {
+		return Record{}, false
+	}
+
+	id := entry.Message.ID
+	if id == "" {
+		id = entry.RequestID
+	}
+	u := Usage{
+		InputTokens:         entry.Message.Usage.InputTokens,
+		OutputTokens:        entry.Message.Usage.OutputTokens,
+		CacheCreationTokens: entry.Message.Usage.CacheCreationInputTokens,
+		CacheReadTokens:     entry.Message.Usage.CacheReadInputTokens,
+	}
+	u.CostUSD = Cost(entry.Message.Model, u)
+	return Record{ID: id, Time: entry.Timestamp, Model: entry.Message.Model, Usage: u}, true
+}
+
+// records accumulates parsed records, keeping the last line seen for each
+// message ID since streamed responses log the same usage once per content block
+type records struct {
+	list  []Record
+	index map[string]int
+}
+
+func (r *records) add(rec Record) {
+	if rec.ID != "" {
+		if r.index == nil {
+			r.index = make(map[string]int)
+		}
+		if i, ok := r.index[rec.ID]; ok {
+			r.list[i] = rec
+			return
+		}
+		r.index[rec.ID] = len(r.list)
+	}
+	r.list = append(r.list, rec)
+}
+
+// ParseTranscript reads the usage records from a session transcript.
+// Lines that aren't valid JSON or carry no usage are skipped.
+func ParseTranscript(r io.Reader) ([]Record, error) {
+	var recs records
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if rec, ok := parseLine(line); ok {
+			recs.add(rec)
+		}
+		if err == io.EOF {
+			return recs.list, nil
+		}
+		if err != nil {
+			return recs.list, err
+		}
+	}
+}
+
+// EncodeProjectPath returns the directory name Claude Code uses under
+// projects/ for a working directory: every character other than a letter
+// or digit becomes "-"
+func EncodeProjectPath(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
+
+// FindTranscript returns the transcript of a session started in workDir,
+// looking under each Claude config directory in turn. Older Claude Code
+// versions only replaced "/" when encoding the directory, so both forms are
+// tried. Returns "" if no transcript exists.
+func FindTranscript(configDirs []string, workDir, sessionID string) string {
+	if workDir == "" || sessionID == "" {
+		return ""
+	}
+	encodings := []string{EncodeProjectPath(workDir)}
+	if legacy := strings.ReplaceAll(workDir, "/", "-"); legacy != encodings[0] {
+		encodings = append(encodings, legacy)
+	}
+	for _, dir := range configDirs {
+		for _, encoded := range encodings {
+			path := filepath.Join(dir, "projects", encoded, sessionID+".jsonl")
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// Tracker caches parsed transcripts so that polling a growing transcript
+// only reads the lines appended since the last call
+type Tracker struct {
+	mu    sync.Mutex
+	files map[string]*trackedFile
+}
+
+type trackedFile struct {
+	offset  int64 // Bytes consumed, always at a line boundary
+	records records
+}
+
+// NewTracker creates an empty tracker
+func NewTracker() *Tracker {
+	return &Tracker{files: make(map[string]*trackedFile)}
+}
+
+// Records returns every usage record in the transcript at path
+func (t *Tracker) Records(path string) ([]Record, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	f, err := os.Open(path)
+	if err != nil {
+		delete(t.files, path)
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	tracked, ok := t.files[path]
+	if !ok || info.Size() < tracked.offset {
+		// New or truncated transcript: start over
+		tracked = &trackedFile{}
+		t.files[path] = tracked
+	}
+
+	if info.Size() > tracked.offset {
+		if _, err := f.Seek(tracked.offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		reader := bufio.NewReader(f)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				// Leave a partially written last line for the next call
+				break
+			}
+			tracked.offset += int64(len(line))
+			if rec, ok := parseLine(line); ok {
+				tracked.records.add(rec)
+			}
+		}
+	}
+
+	return append([]Record(nil), tracked.records.list...), nil
+}
+
+// Forget drops the cached state for path
+func (t *Tracker) Forget(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.files, path)
+}
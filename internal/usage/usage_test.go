@@ -0,0 +1,139 @@
+package usage
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const transcript = `{"type":"user","timestamp":"2026-01-02T10:00:00Z","message":{"role":"user","content":"hi"}}
+{"type":"assistant","timestamp":"2026-01-02T10:00:05Z","requestId":"req_1","message":{"id":"msg_1","model":"claude-sonnet-4-5-20250929","usage":{"input_tokens":100,"output_tokens":10,"cache_creation_input_tokens":1000,"cache_read_input_tokens":0}}}
+{"type":"assistant","timestamp":"2026-01-02T10:00:06Z","requestId":"req_1","message":{"id":"msg_1","model":"claude-sonnet-4-5-20250929","usage":{"input_tokens":100,"output_tokens":50,"cache_creation_input_tokens":1000,"cache_read_input_tokens":0}}}
+not json
+{"type":"assistant","timestamp":"2026-01-03T09:00:00Z","requestId":"req_2","message":{"id":"msg_2","model":"claude-sonnet-4-5-20250929","usage":{"input_tokens":20,"output_tokens":30,"cache_creation_input_tokens":0,"cache_read_input_tokens":5000}}}
+{"type":"assistant","timestamp":"2026-01-03T09:01:00Z","message":{"id":"msg_3","model":"<synthetic>","content":"no usage"}}
+`
+
+func TestParseTranscript(t *testing.T) {
+	records, err := ParseTranscript(strings.NewReader(transcript))
+	if err != nil {
+		t.Fatalf("ParseTranscript() failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2 (duplicate message IDs collapsed): %+v", len(records), records)
+	}
+	if records[0].Usage.OutputTokens != 50 {
+		t.Errorf("streamed message should keep the last usage, got %d output tokens", records[0].Usage.OutputTokens)
+	}
+
+	total := Sum(records, time.Time{})
+	want := Usage{InputTokens: 120, OutputTokens: 80, CacheCreationTokens: 1000, CacheReadTokens: 5000}
+	if total.InputTokens != want.InputTokens || total.OutputTokens != want.OutputTokens ||
+		total.CacheCreationTokens != want.CacheCreationTokens || total.CacheReadTokens != want.CacheReadTokens {
+		t.Errorf("Sum() = %+v, want %+v", total, want)
+	}
+	if total.TotalTokens() != 6200 {
+		t.Errorf("TotalTokens() = %d, want 6200", total.TotalTokens())
+	}
+
+	since := time.Date(2026, 1, 3, 0, 0, 0, 0, time.UTC)
+	if got := Sum(records, since); got.InputTokens != 20 {
+		t.Errorf("Sum(since) input = %d, want 20", got.InputTokens)
+	}
+}
+
+func TestCost(t *testing.T) {
+	u := Usage{InputTokens: 1_000_000, OutputTokens: 1_000_000, CacheCreationTokens: 1_000_000, CacheReadTokens: 1_000_000}
+
+	tests := []struct {
+		model string
+		want  float64
+	}{
+		{"claude-sonnet-4-5-20250929", 3 + 15 + 3.75 + 0.3},
+		{"claude-opus-4-1-20250805", 15 + 75 + 18.75 + 1.5},
+		{"claude-opus-4-5-20251101", 5 + 25 + 6.25 + 0.5},
+		{"claude-haiku-4-5-20251001", 1 + 5 + 1.25 + 0.1},
+		{"<synthetic>", 0},
+	}
+	for _, tt := range tests {
+		if got := Cost(tt.model, u); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Cost(%q) = %v, want %v", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeProjectPath(t *testing.T) {
+	got := EncodeProjectPath("/home/me/.multiclaude/wts/my_repo/clever-fox")
+	want := "-home-me--multiclaude-wts-my-repo-clever-fox"
+	if got != want {
+		t.Errorf("EncodeProjectPath() = %q, want %q", got, want)
+	}
+}
+
+func TestFindTranscript(t *testing.T) {
+	configDir := t.TempDir()
+	workDir := "/tmp/wts/repo/clever.fox"
+
+	if got := FindTranscript([]string{configDir}, workDir, "abc"); got != "" {
+		t.Errorf("FindTranscript() = %q before the transcript exists", got)
+	}
+
+	// Older Claude Code versions only replaced slashes
+	legacy := filepath.Join(configDir, "projects", "-tmp-wts-repo-clever.fox", "abc.jsonl")
+	if err := os.MkdirAll(filepath.Dir(legacy), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(legacy, []byte("{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := FindTranscript([]string{t.TempDir(), configDir}, workDir, "abc"); got != legacy {
+		t.Errorf("FindTranscript() = %q, want %q", got, legacy)
+	}
+}
+
+func TestTrackerReadsIncrementally(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	lines := strings.SplitAfter(transcript, "\n")
+
+	// The second line is only half written
+	partial := lines[0] + lines[1][:20]
+	if err := os.WriteFile(path, []byte(partial), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tracker := NewTracker()
+	records, err := tracker.Records(path)
+	if err != nil {
+		t.Fatalf("Records() failed: %v", err)
+	}
+	if len(records) != 0 {
+		t.Fatalf("partial line should be skipped, got %+v", records)
+	}
+
+	if err := os.WriteFile(path, []byte(transcript), 0644); err != nil {
+		t.Fatal(err)
+	}
+	records, err = tracker.Records(path)
+	if err != nil {
+		t.Fatalf("Records() failed: %v", err)
+	}
+	if len(records) != 2 || records[0].Usage.OutputTokens != 50 {
+		t.Errorf("Records() after append = %+v", records)
+	}
+
+	// A truncated transcript is read from the start again
+	if err := os.WriteFile(path, []byte(lines[0]+lines[4]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	records, _ = tracker.Records(path)
+	if len(records) != 1 || records[0].ID != "msg_2" {
+		t.Errorf("Records() after truncation = %+v", records)
+	}
+
+	if _, err := tracker.Records(filepath.Join(t.TempDir(), "missing.jsonl")); err == nil {
+		t.Error("Records() should fail for a missing transcript")
+	}
+}
@@ -125,6 +125,59 @@ func HasUncommittedChanges(path string) (bool, error) {
 	return len(strings.TrimSpace(string(output))) > 0, nil
 }
 
+// ArchiveChanges saves the uncommitted work in a worktree to archiveDir:
+// <name>.patch holds the diff of tracked files against HEAD and
+// <name>.untracked lists untracked files. The patch can be restored with
+// `git apply`.
+func ArchiveChanges(path, archiveDir, name string) error {
+	cmd := exec.Command("git", "diff", "HEAD")
+	cmd.Dir = path
+	patch, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to create patch: %w", err)
+	}
+
+	untrackedCmd := exec.Command("git", "ls-files", "--others", "--exclude-standard")
+	untrackedCmd.Dir = path
+	untracked, _ := untrackedCmd.Output()
+
+	if err := os.MkdirAll(archiveDir, 0755); err != nil {
+		return fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(archiveDir, name+".patch"), patch, 0644); err != nil {
+		return fmt.Errorf("failed to write patch: %w", err)
+	}
+	if len(untracked) > 0 {
+		if err := os.WriteFile(filepath.Join(archiveDir, name+".untracked"), untracked, 0644); err != nil {
+			return fmt.Errorf("failed to write untracked files list: %w", err)
+		}
+	}
+	return nil
+}
+
+// CommitWIP commits everything in a worktree, untracked files included, as a
+// work-in-progress commit so it survives the worktree being removed. Hooks are
+// skipped. Returns false if there was nothing to commit.
+func CommitWIP(path, message string) (bool, error) {
+	hasChanges, err := HasUncommittedChanges(path)
+	if err != nil || !hasChanges {
+		return false, err
+	}
+
+	addCmd := exec.Command("git", "add", "-A")
+	addCmd.Dir = path
+	if output, err := addCmd.CombinedOutput(); err != nil {
+		return false, fmt.Errorf("failed to stage changes: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	commitCmd := exec.Command("git", "commit", "--no-verify", "-m", message)
+	commitCmd.Dir = path
+	if output, err := commitCmd.CombinedOutput(); err != nil {
+		return false, fmt.Errorf("failed to commit: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return true, nil
+}
+
 // HasUnpushedCommits checks if a worktree has unpushed commits
 func HasUnpushedCommits(path string) (bool, error) {
 	// First verify this is a valid git repository
@@ -228,6 +281,20 @@ func (m *Manager) BranchExists(branchName string) (bool, error) {
 	return true, nil
 }
 
+// RemoteBranchExists checks if a remote-tracking branch exists (e.g., origin/work/foo)
+func (m *Manager) RemoteBranchExists(remote, branchName string) (bool, error) {
+	cmd := exec.Command("git", "show-ref", "--verify", "--quiet", "refs/remotes/"+remote+"/"+branchName)
+	cmd.Dir = m.repoPath
+	err := cmd.Run()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check remote branch existence: %w", err)
+	}
+	return true, nil
+}
+
 // RenameBranch renames a branch from oldName to newName
 func (m *Manager) RenameBranch(oldName, newName string) error {
 	_, err := m.runGit("branch", "-m", oldName, newName)
@@ -731,15 +798,35 @@ type RefreshResult struct {
 	StashRestored  bool
 	HasConflicts   bool
 	ConflictFiles  []string
-	Error          error
-	Skipped        bool
-	SkipReason     string
+	// ConflictCommits lists the upstream commits ("<short sha> <subject>")
+	// that touch the conflicting files, newest first
+	ConflictCommits []string
+	// RebaseInProgress is true when a conflicting rebase was left for the
+	// agent to resolve instead of being aborted
+	RebaseInProgress bool
+	Error            error
+	Skipped          bool
+	SkipReason       string
+}
+
+// RefreshOptions controls how RefreshWorktreeWithOptions handles conflicts
+type RefreshOptions struct {
+	// KeepConflicts leaves a conflicting rebase in progress instead of
+	// aborting it. Ignored when uncommitted changes had to be stashed, since
+	// they could not be restored until the rebase finishes.
+	KeepConflicts bool
 }
 
 // RefreshWorktree syncs a worktree with the latest changes from the main branch.
 // It fetches from the remote, stashes any uncommitted changes, rebases onto main,
 // and restores the stash. Returns detailed results about what happened.
 func RefreshWorktree(worktreePath string, remote string, mainBranch string) RefreshResult {
+	return RefreshWorktreeWithOptions(worktreePath, remote, mainBranch, RefreshOptions{})
+}
+
+// RefreshWorktreeWithOptions is RefreshWorktree with control over what happens
+// when the rebase conflicts
+func RefreshWorktreeWithOptions(worktreePath string, remote string, mainBranch string, opts RefreshOptions) RefreshResult {
 	result := RefreshResult{
 		WorktreePath: worktreePath,
 	}
@@ -845,6 +932,16 @@ func RefreshWorktree(worktreePath string, remote string, mainBranch string) Refr
 		if len(conflictFiles) > 0 && conflictFiles[0] != "" {
 			result.HasConflicts = true
 			result.ConflictFiles = conflictFiles
+			// The branch ref doesn't move until the rebase finishes, so this
+			// still compares the original branch with main
+			if commits, err := UpstreamCommits(worktreePath, branch, fmt.Sprintf("%s/%s", remote, mainBranch), conflictFiles); err == nil {
+				result.ConflictCommits = commits
+			}
+			if opts.KeepConflicts && !result.WasStashed {
+				result.RebaseInProgress = true
+				result.Error = fmt.Errorf("rebase stopped on conflicts: %w\nOutput: %s", rebaseErr, rebaseOutput)
+				return result
+			}
 			// Abort the rebase to leave the worktree in a clean state
 			abortCmd := exec.Command("git", "rebase", "--abort")
 			abortCmd.Dir = worktreePath
@@ -884,6 +981,195 @@ func RefreshWorktree(worktreePath string, remote string, mainBranch string) Refr
 	return result
 }
 
+// FastForwardWorktree brings a checkout of the main branch up to date with
+// remote/mainBranch. Unlike RefreshWorktree it never rewrites history: a
+// checkout on another branch, mid-rebase or mid-merge, or with commits of its
+// own is skipped. Uncommitted changes are left in place; git refuses the
+// fast-forward if it would overwrite them. CommitsRebased is the number of
+// commits fast-forwarded. The caller is expected to have fetched the remote.
+func FastForwardWorktree(worktreePath string, remote string, mainBranch string) RefreshResult {
+	result := RefreshResult{
+		WorktreePath: worktreePath,
+	}
+
+	state, err := GetWorktreeState(worktreePath, remote, mainBranch)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+	result.Branch = state.Branch
+	switch {
+	case state.IsDetachedHEAD || state.IsMidRebase || state.IsMidMerge:
+		result.Skipped = true
+		result.SkipReason = state.RefreshReason
+		return result
+	case state.Branch != mainBranch:
+		result.Skipped = true
+		result.SkipReason = fmt.Sprintf("on branch %s, not %s", state.Branch, mainBranch)
+		return result
+	}
+
+	// GetWorktreeState doesn't count commits on the main branch itself
+	upstream := fmt.Sprintf("%s/%s", remote, mainBranch)
+	cmd := exec.Command("git", "rev-list", "--left-right", "--count", upstream+"...HEAD")
+	cmd.Dir = worktreePath
+	output, err := cmd.Output()
+	if err != nil {
+		result.Error = fmt.Errorf("failed to compare with %s: %w", upstream, err)
+		return result
+	}
+	var behind, ahead int
+	if parts := strings.Fields(string(output)); len(parts) == 2 {
+		fmt.Sscanf(parts[0], "%d", &behind)
+		fmt.Sscanf(parts[1], "%d", &ahead)
+	}
+	if ahead > 0 {
+		result.Skipped = true
+		result.SkipReason = fmt.Sprintf("%d local commits not on %s", ahead, upstream)
+		return result
+	}
+	if behind == 0 {
+		result.Skipped = true
+		result.SkipReason = "already up to date"
+		return result
+	}
+
+	cmd = exec.Command("git", "merge", "--ff-only", upstream)
+	cmd.Dir = worktreePath
+	if output, err := cmd.CombinedOutput(); err != nil {
+		result.Error = fmt.Errorf("fast-forward failed: %w\nOutput: %s", err, output)
+		return result
+	}
+	result.CommitsRebased = behind
+	return result
+}
+
+// UpstreamCommits returns the commits on upstream that are not on branch and
+// touch any of files, as "<short sha> <subject>" lines, newest first
+func UpstreamCommits(worktreePath, branch, upstream string, files []string) ([]string, error) {
+	args := []string{"log", "--format=%h %s", fmt.Sprintf("%s..%s", branch, upstream), "--"}
+	cmd := exec.Command("git", append(args, files...)...)
+	cmd.Dir = worktreePath
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list upstream commits: %w", err)
+	}
+
+	var commits []string
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if line != "" {
+			commits = append(commits, line)
+		}
+	}
+	return commits, nil
+}
+
+// Hunk is a range of lines a branch changed in the base version of a file
+type Hunk struct {
+	Start int // First line changed, or the line after which lines were inserted (0 = start of file)
+	Count int // Lines changed; 0 for a pure insertion
+}
+
+// span returns the first and last base lines a hunk touches. An insertion
+// touches the lines on either side of it.
+func (h Hunk) span() (int, int) {
+	if h.Count == 0 {
+		return h.Start, h.Start + 1
+	}
+	return h.Start, h.Start + h.Count - 1
+}
+
+// HunksOverlap reports whether any hunk in a touches or is adjacent to a hunk
+// in b. Git can't merge changes to adjacent lines, so these are likely
+// conflicts.
+func HunksOverlap(a, b []Hunk) bool {
+	for _, ha := range a {
+		aStart, aEnd := ha.span()
+		for _, hb := range b {
+			bStart, bEnd := hb.span()
+			if aStart <= bEnd+1 && bStart <= aEnd+1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ChangedHunks returns the hunks each file changed in a worktree compared
+// with its merge base with base (e.g. "origin/main"), keyed by path. Committed
+// and uncommitted changes are both included. New files, tracked or not, get a
+// single hunk at the start of the file.
+func ChangedHunks(worktreePath, base string) (map[string][]Hunk, error) {
+	cmd := exec.Command("git", "merge-base", "HEAD", base)
+	cmd.Dir = worktreePath
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find merge base with %s: %w", base, err)
+	}
+	mergeBase := strings.TrimSpace(string(output))
+
+	// Diff the working tree against the merge base
+	cmd = exec.Command("git", "diff", "-U0", "--no-color", "--no-ext-diff", mergeBase)
+	cmd.Dir = worktreePath
+	output, err = cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff against %s: %w", base, err)
+	}
+	hunks := parseDiffHunks(string(output))
+
+	// git diff doesn't list untracked files
+	cmd = exec.Command("git", "ls-files", "--others", "--exclude-standard")
+	cmd.Dir = worktreePath
+	output, err = cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list untracked files: %w", err)
+	}
+	for _, path := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if path != "" {
+			hunks[path] = []Hunk{{Start: 0, Count: 0}}
+		}
+	}
+	return hunks, nil
+}
+
+// parseDiffHunks parses the old-side line ranges out of `git diff -U0` output
+func parseDiffHunks(diff string) map[string][]Hunk {
+	hunks := make(map[string][]Hunk)
+	oldPath, path := "", ""
+	inHeader := false // Removed lines can start with "--- " too
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			oldPath, path = "", ""
+			inHeader = true
+		case inHeader && strings.HasPrefix(line, "--- "):
+			oldPath = strings.TrimPrefix(strings.TrimPrefix(line, "--- "), "a/")
+		case inHeader && strings.HasPrefix(line, "+++ "):
+			path = strings.TrimPrefix(strings.TrimPrefix(line, "+++ "), "b/")
+			if path == "/dev/null" {
+				// A deleted file is keyed by its old path
+				path = oldPath
+			}
+		case strings.HasPrefix(line, "@@ ") && path != "":
+			inHeader = false
+			// @@ -start[,count] +start[,count] @@
+			fields := strings.Fields(line)
+			if len(fields) < 2 || !strings.HasPrefix(fields[1], "-") {
+				continue
+			}
+			start, count := strings.TrimPrefix(fields[1], "-"), "1"
+			if idx := strings.Index(start, ","); idx != -1 {
+				start, count = start[:idx], start[idx+1:]
+			}
+			var h Hunk
+			fmt.Sscanf(start, "%d", &h.Start)
+			fmt.Sscanf(count, "%d", &h.Count)
+			hunks[path] = append(hunks[path], h)
+		}
+	}
+	return hunks
+}
+
 // RefreshWorktreeWithDefaults refreshes a worktree using the repository's default remote and branch
 func (m *Manager) RefreshWorktreeWithDefaults(worktreePath string) RefreshResult {
 	// Get the upstream remote
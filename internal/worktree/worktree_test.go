@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -837,6 +838,37 @@ func TestBranchExists(t *testing.T) {
 	}
 }
 
+func TestRemoteBranchExists(t *testing.T) {
+	repoPath, cleanup := createTestRepo(t)
+	defer cleanup()
+
+	manager := NewManager(repoPath)
+
+	// A local branch is not a remote-tracking branch
+	exists, err := manager.RemoteBranchExists("origin", "main")
+	if err != nil {
+		t.Fatalf("Failed to check remote branch existence: %v", err)
+	}
+	if exists {
+		t.Error("origin/main should not exist without a remote")
+	}
+
+	// Simulate a fetched remote branch
+	cmd := exec.Command("git", "update-ref", "refs/remotes/origin/work/test", "HEAD")
+	cmd.Dir = repoPath
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to create remote ref: %v", err)
+	}
+
+	exists, err = manager.RemoteBranchExists("origin", "work/test")
+	if err != nil {
+		t.Fatalf("Failed to check remote branch existence: %v", err)
+	}
+	if !exists {
+		t.Error("origin/work/test should exist")
+	}
+}
+
 // TestCreateWorktreeForExistingBranch tests creating a worktree for a branch
 // that already exists locally. This is the scenario that occurs when using
 // --push-to with a branch that has already been checked out locally (fix for #278).
@@ -1990,6 +2022,237 @@ func TestRefreshWorktree(t *testing.T) {
 	})
 }
 
+func TestRefreshWorktreeConflicts(t *testing.T) {
+	// setup creates a worktree whose commit to README.md conflicts with a
+	// later commit on main
+	setup := func(t *testing.T) (string, string) {
+		repoPath, cleanup := createTestRepo(t)
+		t.Cleanup(cleanup)
+
+		run := func(dir string, args ...string) {
+			t.Helper()
+			cmd := exec.Command("git", args...)
+			cmd.Dir = dir
+			if output, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("git %v failed: %v\n%s", args, err, output)
+			}
+		}
+
+		run(repoPath, "remote", "add", "origin", repoPath)
+		wtPath := filepath.Join(repoPath, "wt-conflict")
+		if err := NewManager(repoPath).CreateNewBranch(wtPath, "feature/conflict", "main"); err != nil {
+			t.Fatalf("Failed to create worktree: %v", err)
+		}
+
+		if err := os.WriteFile(filepath.Join(wtPath, "README.md"), []byte("# Feature\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		run(wtPath, "commit", "-am", "Feature README")
+
+		if err := os.WriteFile(filepath.Join(repoPath, "README.md"), []byte("# Upstream\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		run(repoPath, "commit", "-am", "Upstream README")
+		run(repoPath, "fetch", "origin")
+		return repoPath, wtPath
+	}
+
+	t.Run("aborts by default", func(t *testing.T) {
+		_, wtPath := setup(t)
+
+		result := RefreshWorktree(wtPath, "origin", "main")
+		if !result.HasConflicts || result.RebaseInProgress {
+			t.Fatalf("result = %+v, want aborted conflicts", result)
+		}
+		if len(result.ConflictFiles) != 1 || result.ConflictFiles[0] != "README.md" {
+			t.Errorf("ConflictFiles = %v, want [README.md]", result.ConflictFiles)
+		}
+		if len(result.ConflictCommits) != 1 || !strings.HasSuffix(result.ConflictCommits[0], " Upstream README") {
+			t.Errorf("ConflictCommits = %v, want the upstream commit", result.ConflictCommits)
+		}
+
+		state, err := GetWorktreeState(wtPath, "origin", "main")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state.IsMidRebase {
+			t.Error("rebase should have been aborted")
+		}
+	})
+
+	t.Run("keeps the rebase when asked", func(t *testing.T) {
+		_, wtPath := setup(t)
+
+		result := RefreshWorktreeWithOptions(wtPath, "origin", "main", RefreshOptions{KeepConflicts: true})
+		if !result.HasConflicts || !result.RebaseInProgress || result.Error == nil {
+			t.Fatalf("result = %+v, want conflicts left in progress", result)
+		}
+
+		state, err := GetWorktreeState(wtPath, "origin", "main")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !state.IsMidRebase {
+			t.Error("rebase should still be in progress")
+		}
+	})
+
+	t.Run("aborts when changes were stashed", func(t *testing.T) {
+		_, wtPath := setup(t)
+
+		if err := os.WriteFile(filepath.Join(wtPath, "scratch.txt"), []byte("wip"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		result := RefreshWorktreeWithOptions(wtPath, "origin", "main", RefreshOptions{KeepConflicts: true})
+		if !result.HasConflicts || result.RebaseInProgress || !result.StashRestored {
+			t.Fatalf("result = %+v, want aborted conflicts with the stash restored", result)
+		}
+		if _, err := os.Stat(filepath.Join(wtPath, "scratch.txt")); err != nil {
+			t.Errorf("uncommitted file should be restored: %v", err)
+		}
+	})
+}
+
+func TestFastForwardWorktree(t *testing.T) {
+	repoPath, cleanup := createTestRepo(t)
+	defer cleanup()
+
+	run := func(dir string, args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, output)
+		}
+	}
+
+	// origin/main is one commit ahead of the checkout
+	run(repoPath, "checkout", "-b", "ahead")
+	run(repoPath, "commit", "--allow-empty", "-m", "Upstream change")
+	run(repoPath, "checkout", "main")
+	run(repoPath, "update-ref", "refs/remotes/origin/main", "ahead")
+
+	run(repoPath, "checkout", "ahead")
+	if result := FastForwardWorktree(repoPath, "origin", "main"); !result.Skipped || !strings.Contains(result.SkipReason, "not main") {
+		t.Errorf("result on another branch = %+v, want skipped", result)
+	}
+	run(repoPath, "checkout", "main")
+
+	result := FastForwardWorktree(repoPath, "origin", "main")
+	if result.Error != nil || result.Skipped || result.CommitsRebased != 1 {
+		t.Fatalf("result = %+v, want fast-forwarded by 1 commit", result)
+	}
+	if result := FastForwardWorktree(repoPath, "origin", "main"); result.SkipReason != "already up to date" {
+		t.Errorf("second result = %+v, want already up to date", result)
+	}
+
+	// Local commits are never rewritten
+	run(repoPath, "commit", "--allow-empty", "-m", "Local change")
+	run(repoPath, "update-ref", "refs/remotes/origin/main", "ahead")
+	if result := FastForwardWorktree(repoPath, "origin", "main"); !result.Skipped || !strings.Contains(result.SkipReason, "local commits") {
+		t.Errorf("result with local commits = %+v, want skipped", result)
+	}
+}
+
+func TestParseDiffHunks(t *testing.T) {
+	diff := `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -3 +3 @@ package main
+-import "fmt"
++import "os"
+@@ -10,0 +11,2 @@ func main() {
++	one()
++	two()
+diff --git a/old.txt b/old.txt
+deleted file mode 100644
+--- a/old.txt
++++ /dev/null
+@@ -1,2 +0,0 @@
+--- not a header
+-bye
+diff --git a/new.txt b/new.txt
+new file mode 100644
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1 @@
++hello
+`
+	got := parseDiffHunks(diff)
+	want := map[string][]Hunk{
+		"main.go": {{Start: 3, Count: 1}, {Start: 10, Count: 0}},
+		"old.txt": {{Start: 1, Count: 2}},
+		"new.txt": {{Start: 0, Count: 0}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("parseDiffHunks() = %+v, want %+v", got, want)
+	}
+	for file, hunks := range want {
+		if !slices.Equal(got[file], hunks) {
+			t.Errorf("hunks of %s = %+v, want %+v", file, got[file], hunks)
+		}
+	}
+}
+
+func TestHunksOverlap(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []Hunk
+		want bool
+	}{
+		{"same lines", []Hunk{{Start: 5, Count: 2}}, []Hunk{{Start: 6, Count: 1}}, true},
+		{"adjacent lines", []Hunk{{Start: 5, Count: 2}}, []Hunk{{Start: 7, Count: 1}}, true},
+		{"one line apart", []Hunk{{Start: 5, Count: 2}}, []Hunk{{Start: 8, Count: 1}}, false},
+		{"insertion next to a change", []Hunk{{Start: 4, Count: 0}}, []Hunk{{Start: 6, Count: 1}}, true},
+		{"far apart", []Hunk{{Start: 1, Count: 1}}, []Hunk{{Start: 100, Count: 3}}, false},
+		{"both new files", []Hunk{{Start: 0, Count: 0}}, []Hunk{{Start: 0, Count: 0}}, true},
+	}
+	for _, tt := range tests {
+		if got := HunksOverlap(tt.a, tt.b); got != tt.want {
+			t.Errorf("%s: HunksOverlap() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestChangedHunks(t *testing.T) {
+	repoPath, cleanup := createTestRepo(t)
+	defer cleanup()
+
+	wtPath := filepath.Join(repoPath, "wt-hunks")
+	if err := NewManager(repoPath).CreateNewBranch(wtPath, "feature/hunks", "main"); err != nil {
+		t.Fatalf("Failed to create worktree: %v", err)
+	}
+
+	// One committed change, one uncommitted, one untracked file
+	if err := os.WriteFile(filepath.Join(wtPath, "README.md"), []byte("# Changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("git", "commit", "-am", "Change README")
+	cmd.Dir = wtPath
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("commit failed: %v\n%s", err, output)
+	}
+	if err := os.WriteFile(filepath.Join(wtPath, "README.md"), []byte("# Changed\nmore\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(wtPath, "scratch.go"), []byte("package x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hunks, err := ChangedHunks(wtPath, "main")
+	if err != nil {
+		t.Fatalf("ChangedHunks() failed: %v", err)
+	}
+	if len(hunks) != 2 || len(hunks["README.md"]) != 1 || hunks["README.md"][0].Start != 1 {
+		t.Errorf("ChangedHunks() = %+v, want README.md line 1 and scratch.go", hunks)
+	}
+	if _, ok := hunks["scratch.go"]; !ok {
+		t.Errorf("ChangedHunks() should include untracked files, got %+v", hunks)
+	}
+}
+
 func TestRefreshWorktreeWithDefaults(t *testing.T) {
 	t.Run("uses repository defaults", func(t *testing.T) {
 		repoPath, cleanup := createTestRepo(t)
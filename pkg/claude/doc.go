@@ -4,9 +4,11 @@
 // instances running in terminal emulators. It handles:
 //
 //   - CLI flag construction (--session-id, --dangerously-skip-permissions, --append-system-prompt-file)
+//   - Per-instance model, tool, and permission selection via [Profile]
 //   - Session ID generation (UUID v4)
-//   - Startup timing quirks
+//   - Waiting for Claude's prompt before sending messages
 //   - Terminal integration via the [TerminalRunner] interface
+//   - Headless runs in print mode, decoded into typed events, via [HeadlessRunner]
 //
 // # Installation
 //
@@ -80,12 +82,29 @@
 //
 // Use [GenerateSessionID] to create new session IDs, or provide your own via [Config.SessionID].
 //
-// # Timing Considerations
+// # Readiness
 //
-// Starting Claude and sending messages requires careful timing:
+// A message typed into the pane before Claude is up goes to the shell instead.
+// When the terminal implements [PaneInspector] (tmux.Client does), the Runner
+// waits for Claude's input prompt rather than a fixed delay:
 //
-//   - [Runner.StartupDelay] (default 500ms): Wait after launching before getting PID
-//   - [Runner.MessageDelay] (default 1s): Wait before sending initial message
+//   - [Runner.ReadyTimeout] (default 90s): How long [WaitForReady] waits for the
+//     prompt. A pane still running a shell is never ready. On timeout, or if
+//     Claude exits back to the shell, a [*StartupTimeoutError] is returned.
+//   - [Runner.DeliveryTimeout] (default 10s): How long [ConfirmDelivery] waits
+//     for a sent message to show up in the pane before returning a [*DeliveryError].
 //
-// These can be adjusted via [WithStartupDelay] and [WithMessageDelay] options.
+// Terminals that can't be inspected fall back to fixed delays:
+// [Runner.StartupDelay] (default 500ms) before getting the PID and
+// [Runner.MessageDelay] (default 1s) before sending the initial message.
+//
+// # Headless Runs
+//
+// An agent that works through one task and exits doesn't need a terminal.
+// [HeadlessRunner] starts `claude -p --output-format stream-json` as a child
+// process with the task on stdin, and an [EventDecoder] turns its output into
+// typed events: [InitEvent], [TextEvent], [ToolUseEvent], [ToolResultEvent],
+// [UsageEvent], and finally a [ResultEvent]. [HeadlessSession.Wait] returns the
+// result, or a [*HeadlessError] when Claude exits with a non-zero status, exits
+// without a result, or reports an error result.
 package claude
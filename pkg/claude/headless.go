@@ -0,0 +1,331 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultStopTimeout is how long a headless run is given to exit after being
+// interrupted before it is killed.
+const DefaultStopTimeout = 10 * time.Second
+
+// stderrTailBytes is how much of a headless run's stderr is kept for errors.
+const stderrTailBytes = 4096
+
+// HeadlessRunner runs Claude as a child process in print mode
+// (`claude -p --output-format stream-json`) instead of in a terminal. It
+// suits agents that work through one task and exit, like reviews: the run's
+// events are decoded as they arrive, and it ends with an exit status and a
+// [ResultEvent] rather than a pane that has to be watched.
+type HeadlessRunner struct {
+	// BinaryPath is the path to the claude binary.
+	// Defaults to "claude" (relies on PATH).
+	BinaryPath string
+
+	// SkipPermissions controls whether to pass --dangerously-skip-permissions.
+	// A headless run can't answer permission prompts. Defaults to true.
+	SkipPermissions bool
+
+	// StopTimeout is how long Stop, or cancelling the context given to
+	// Start, waits for Claude to exit after interrupting it before killing
+	// it. Defaults to DefaultStopTimeout.
+	StopTimeout time.Duration
+}
+
+// NewHeadlessRunner creates a headless runner with the default settings.
+func NewHeadlessRunner() *HeadlessRunner {
+	return &HeadlessRunner{
+		BinaryPath:      "claude",
+		SkipPermissions: true,
+		StopTimeout:     DefaultStopTimeout,
+	}
+}
+
+// HeadlessConfig contains configuration for a headless Claude run.
+type HeadlessConfig struct {
+	// SessionID is the unique identifier for this Claude session.
+	// If empty, a new UUID will be generated.
+	SessionID string
+
+	// Resume continues an existing session, using --resume instead of
+	// --session-id.
+	Resume bool
+
+	// WorkDir is the working directory of the Claude process.
+	WorkDir string
+
+	// SystemPromptFile is the path to a file containing the system prompt.
+	// This is passed via --append-system-prompt-file.
+	SystemPromptFile string
+
+	// Prompt is the task Claude works on. It is written to Claude's stdin.
+	Prompt string
+
+	// Profile selects the model, tools, and permission mode.
+	Profile Profile
+
+	// Env holds extra environment variables ("KEY=value") for the process.
+	Env []string
+
+	// Output, if non-nil, receives a copy of the raw stream-json output,
+	// e.g. to keep it in a log file.
+	Output io.Writer
+
+	// OnEvent, if non-nil, is called with each event in order, from the
+	// goroutine reading the stream.
+	OnEvent func(Event)
+}
+
+// HeadlessSession is a running headless Claude process.
+type HeadlessSession struct {
+	// SessionID is the session ID of the run.
+	SessionID string
+
+	// PID is the process ID of the Claude process.
+	PID int
+
+	cmd         *exec.Cmd
+	stopTimeout time.Duration
+	stderr      *tailBuffer
+	done        chan struct{}
+	result      *ResultEvent
+	err         error
+}
+
+// HeadlessError is returned by [HeadlessSession.Wait] when a run fails:
+// Claude exited with a non-zero status, exited without a result, or reported
+// an error result.
+type HeadlessError struct {
+	ExitCode int          // Exit status of the process, -1 if it was killed by a signal
+	Stderr   string       // The end of what the process wrote to stderr
+	Result   *ResultEvent // The run's result, nil if Claude exited before reporting one
+}
+
+func (e *HeadlessError) Error() string {
+	var what string
+	switch {
+	case e.Result != nil && e.Result.IsError:
+		what = fmt.Sprintf("claude run failed (%s)", e.Result.Subtype)
+		if e.Result.Result != "" {
+			what += ": " + e.Result.Result
+		}
+		return what
+	case e.ExitCode != 0:
+		what = fmt.Sprintf("claude exited with status %d", e.ExitCode)
+	default:
+		what = "claude exited without a result"
+	}
+	if line := lastLine(e.Stderr); line != "" {
+		what += ": " + line
+	}
+	return what
+}
+
+// IsHeadlessError returns true if the error reports a failed headless run.
+func IsHeadlessError(err error) bool {
+	var headless *HeadlessError
+	return errors.As(err, &headless)
+}
+
+// Start launches a headless Claude run and returns once the process has
+// started. The run is interrupted when ctx is cancelled.
+func (r *HeadlessRunner) Start(ctx context.Context, cfg HeadlessConfig) (*HeadlessSession, error) {
+	if cfg.Prompt == "" {
+		return nil, fmt.Errorf("a headless run needs a prompt")
+	}
+
+	sessionID := cfg.SessionID
+	if sessionID == "" {
+		var err error
+		sessionID, err = GenerateSessionID()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate session ID: %w", err)
+		}
+	}
+
+	stopTimeout := r.StopTimeout
+	if stopTimeout <= 0 {
+		stopTimeout = DefaultStopTimeout
+	}
+
+	cmd := exec.CommandContext(ctx, r.BinaryPath, r.buildArgs(sessionID, cfg)...)
+	cmd.Dir = cfg.WorkDir
+	if len(cfg.Env) > 0 {
+		cmd.Env = append(os.Environ(), cfg.Env...)
+	}
+	cmd.Stdin = strings.NewReader(cfg.Prompt)
+	stderr := &tailBuffer{limit: stderrTailBytes}
+	cmd.Stderr = stderr
+	// Claude and the tools it runs share a process group of their own, so the
+	// whole run can be killed by its PID
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	// Waiting gives up on output still held open by Claude's own children
+	// this long after Claude exits
+	cmd.WaitDelay = stopTimeout
+
+	stdout, stdoutWriter := io.Pipe()
+	cmd.Stdout = stdoutWriter
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start claude: %w", err)
+	}
+
+	s := &HeadlessSession{
+		SessionID:   sessionID,
+		PID:         cmd.Process.Pid,
+		cmd:         cmd,
+		stopTimeout: stopTimeout,
+		stderr:      stderr,
+		done:        make(chan struct{}),
+	}
+	go s.run(stdout, stdoutWriter, cfg)
+	return s, nil
+}
+
+// buildArgs constructs the claude CLI arguments of a headless run.
+func (r *HeadlessRunner) buildArgs(sessionID string, cfg HeadlessConfig) []string {
+	args := []string{"-p", "--output-format", "stream-json", "--verbose"}
+
+	if cfg.Resume {
+		args = append(args, "--resume", sessionID)
+	} else {
+		args = append(args, "--session-id", sessionID)
+	}
+
+	// Add skip permissions flag, unless the profile picks a permission mode
+	if r.SkipPermissions && cfg.Profile.PermissionMode == "" {
+		args = append(args, "--dangerously-skip-permissions")
+	}
+
+	if cfg.SystemPromptFile != "" {
+		args = append(args, "--append-system-prompt-file", cfg.SystemPromptFile)
+	}
+
+	return append(args, cfg.Profile.Args()...)
+}
+
+// run decodes the stream while waiting for the process to exit. The stream
+// ends once the process has exited and its output is copied.
+func (s *HeadlessSession) run(stdout *io.PipeReader, stdoutWriter *io.PipeWriter, cfg HeadlessConfig) {
+	defer close(s.done)
+
+	waited := make(chan error, 1)
+	go func() {
+		err := s.cmd.Wait()
+		stdoutWriter.Close()
+		waited <- err
+	}()
+
+	var stream io.Reader = stdout
+	if cfg.Output != nil {
+		stream = io.TeeReader(stdout, cfg.Output)
+	}
+	decoder := NewEventDecoder(stream)
+	var decodeErr error
+	for {
+		event, err := decoder.Next()
+		if err != nil {
+			if err != io.EOF {
+				decodeErr = err
+			}
+			break
+		}
+		if result, ok := event.(*ResultEvent); ok {
+			s.result = result
+		}
+		if cfg.OnEvent != nil {
+			cfg.OnEvent(event)
+		}
+	}
+	// Keep the pipe drained so the process never blocks writing to it
+	io.Copy(io.Discard, stream)
+
+	waitErr := <-waited
+	exitCode := s.cmd.ProcessState.ExitCode()
+	switch {
+	case exitCode != 0 || (s.result != nil && s.result.IsError):
+		s.err = &HeadlessError{ExitCode: exitCode, Stderr: s.stderr.String(), Result: s.result}
+	case decodeErr != nil:
+		s.err = decodeErr
+	case s.result == nil:
+		s.err = &HeadlessError{Stderr: s.stderr.String()}
+	case waitErr != nil && !errors.Is(waitErr, exec.ErrWaitDelay):
+		s.err = waitErr
+	}
+}
+
+// Wait waits for the run to end and returns its result. The error is a
+// [*HeadlessError] if the run failed; the result is nil if Claude exited
+// before reporting one.
+func (s *HeadlessSession) Wait() (*ResultEvent, error) {
+	<-s.done
+	return s.result, s.err
+}
+
+// Done returns a channel that is closed when the run has ended.
+func (s *HeadlessSession) Done() <-chan struct{} {
+	return s.done
+}
+
+// Stop interrupts the run and waits for it to end, killing Claude and the
+// tools it runs if it doesn't exit within the runner's StopTimeout.
+func (s *HeadlessSession) Stop() {
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+
+	s.cmd.Process.Signal(os.Interrupt)
+	select {
+	case <-s.done:
+	case <-time.After(s.stopTimeout):
+		KillRun(s.PID)
+		<-s.done
+	}
+}
+
+// KillRun kills the headless run started with the given PID, along with the
+// tools it runs. It works without the [HeadlessSession], e.g. for a run left
+// behind by an earlier process, and only kills a process group led by pid,
+// which every run is.
+func KillRun(pid int) error {
+	if pid <= 0 {
+		return fmt.Errorf("invalid PID %d", pid)
+	}
+	return syscall.Kill(-pid, syscall.SIGKILL)
+}
+
+// tailBuffer keeps the last limit bytes written to it.
+type tailBuffer struct {
+	mu    sync.Mutex
+	limit int
+	data  []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.data = append(b.data, p...)
+	if over := len(b.data) - b.limit; over > 0 {
+		b.data = b.data[over:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.data)
+}
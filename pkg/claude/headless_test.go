@@ -0,0 +1,181 @@
+package claude
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClaude writes a script standing in for the claude binary. It records
+// its arguments, stdin, and working directory in dir, then runs body.
+func fakeClaude(t *testing.T, body string) (binary, dir string) {
+	t.Helper()
+	dir = t.TempDir()
+	binary = filepath.Join(dir, "claude")
+	script := "#!/bin/sh\n" +
+		"printf '%s\\n' \"$@\" > " + filepath.Join(dir, "args") + "\n" +
+		"cat > " + filepath.Join(dir, "stdin") + "\n" +
+		"pwd > " + filepath.Join(dir, "pwd") + "\n" +
+		body + "\n"
+	if err := os.WriteFile(binary, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return binary, dir
+}
+
+func TestHeadlessRunnerBuildArgs(t *testing.T) {
+	r := NewHeadlessRunner()
+
+	args := r.buildArgs("abc", HeadlessConfig{SystemPromptFile: "/tmp/prompt.md"})
+	want := []string{"-p", "--output-format", "stream-json", "--verbose", "--session-id", "abc", "--dangerously-skip-permissions", "--append-system-prompt-file", "/tmp/prompt.md"}
+	if !slices.Equal(args, want) {
+		t.Errorf("buildArgs() = %v, want %v", args, want)
+	}
+
+	args = r.buildArgs("abc", HeadlessConfig{Resume: true, Profile: Profile{Model: "haiku", PermissionMode: "acceptEdits"}})
+	want = []string{"-p", "--output-format", "stream-json", "--verbose", "--resume", "abc", "--model", "haiku", "--permission-mode", "acceptEdits"}
+	if !slices.Equal(args, want) {
+		t.Errorf("buildArgs() = %v, want %v", args, want)
+	}
+}
+
+func TestHeadlessRunnerStart(t *testing.T) {
+	binary, dir := fakeClaude(t, "cat <<'EOF'\n"+sampleStream+"EOF")
+	r := NewHeadlessRunner()
+	r.BinaryPath = binary
+	workDir := t.TempDir()
+
+	var output bytes.Buffer
+	var events []Event
+	session, err := r.Start(context.Background(), HeadlessConfig{
+		SessionID: "abc",
+		WorkDir:   workDir,
+		Prompt:    "Review PR #42",
+		Output:    &output,
+		OnEvent:   func(e Event) { events = append(events, e) },
+	})
+	if err != nil {
+		t.Fatalf("Start() failed: %v", err)
+	}
+	if session.SessionID != "abc" || session.PID <= 0 {
+		t.Errorf("session = %+v", session)
+	}
+
+	result, err := session.Wait()
+	if err != nil {
+		t.Fatalf("Wait() failed: %v", err)
+	}
+	if result == nil || result.Result != "LGTM" {
+		t.Errorf("result = %+v, want LGTM", result)
+	}
+	if len(events) != 7 {
+		t.Errorf("got %d events, want 7", len(events))
+	}
+	if output.String() != sampleStream {
+		t.Errorf("output = %q, want the raw stream", output.String())
+	}
+
+	if stdin, _ := os.ReadFile(filepath.Join(dir, "stdin")); string(stdin) != "Review PR #42" {
+		t.Errorf("stdin = %q, want the prompt", stdin)
+	}
+	if pwd, _ := os.ReadFile(filepath.Join(dir, "pwd")); strings.TrimSpace(string(pwd)) != workDir {
+		t.Errorf("working directory = %q, want %s", pwd, workDir)
+	}
+	if args, _ := os.ReadFile(filepath.Join(dir, "args")); !strings.Contains(string(args), "stream-json\n") {
+		t.Errorf("args = %q", args)
+	}
+}
+
+func TestHeadlessRunnerFailures(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantResult bool
+		wantError  string
+		wantCode   int
+	}{
+		{
+			name:      "non-zero exit",
+			body:      "echo 'Error: invalid API key' >&2; exit 3",
+			wantError: "claude exited with status 3: Error: invalid API key",
+			wantCode:  3,
+		},
+		{
+			name:      "exit without a result",
+			body:      `echo '{"type":"system","subtype":"init","session_id":"abc"}'`,
+			wantError: "claude exited without a result",
+		},
+		{
+			name:       "error result",
+			body:       `echo '{"type":"result","subtype":"error_max_turns","is_error":true,"session_id":"abc"}'`,
+			wantResult: true,
+			wantError:  "claude run failed (error_max_turns)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			binary, _ := fakeClaude(t, tt.body)
+			r := NewHeadlessRunner()
+			r.BinaryPath = binary
+
+			session, err := r.Start(context.Background(), HeadlessConfig{Prompt: "Do it"})
+			if err != nil {
+				t.Fatalf("Start() failed: %v", err)
+			}
+			result, err := session.Wait()
+			if !IsHeadlessError(err) || err.Error() != tt.wantError {
+				t.Fatalf("Wait() error = %v, want %q", err, tt.wantError)
+			}
+			if (result != nil) != tt.wantResult {
+				t.Errorf("result = %+v, want one: %v", result, tt.wantResult)
+			}
+			if code := err.(*HeadlessError).ExitCode; code != tt.wantCode {
+				t.Errorf("exit code = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestHeadlessRunnerRequiresPrompt(t *testing.T) {
+	if _, err := NewHeadlessRunner().Start(context.Background(), HeadlessConfig{}); err == nil {
+		t.Error("Start() without a prompt should fail")
+	}
+}
+
+func TestHeadlessSessionStop(t *testing.T) {
+	// The fake ignores the interrupt, so Stop has to kill it
+	binary, _ := fakeClaude(t, "trap '' INT\n"+`echo '{"type":"system","subtype":"init","session_id":"abc"}'`+"\nexec sleep 30")
+	r := NewHeadlessRunner()
+	r.BinaryPath = binary
+	r.StopTimeout = 100 * time.Millisecond
+
+	started := make(chan struct{})
+	session, err := r.Start(context.Background(), HeadlessConfig{
+		Prompt:  "Do it",
+		OnEvent: func(Event) { close(started) },
+	})
+	if err != nil {
+		t.Fatalf("Start() failed: %v", err)
+	}
+	<-started
+
+	start := time.Now()
+	session.Stop()
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Stop() took %s", elapsed)
+	}
+	select {
+	case <-session.Done():
+	default:
+		t.Fatal("run should be over after Stop()")
+	}
+	if _, err := session.Wait(); !IsHeadlessError(err) {
+		t.Errorf("Wait() error = %v, want a failed run", err)
+	}
+}
@@ -0,0 +1,115 @@
+package claude
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PermissionModes lists the values accepted by Claude's --permission-mode flag.
+var PermissionModes = []string{"default", "acceptEdits", "plan", "bypassPermissions"}
+
+// managedFlags are set by the Runner itself and may not appear in
+// [Profile.ExtraArgs].
+var managedFlags = []string{
+	"--session-id",
+	"--resume", "-r",
+	"--continue", "-c",
+	"--append-system-prompt-file",
+	"--print", "-p",
+	"--output-format", "--input-format",
+	// Set from PermissionMode, so a restricted profile can't be bypassed
+	"--permission-mode",
+	"--dangerously-skip-permissions",
+}
+
+// Profile selects the model, tools, and permissions a Claude instance runs
+// with. The zero value uses Claude's defaults.
+type Profile struct {
+	// Model is passed as --model, e.g. "sonnet", "opus", or a full model name.
+	Model string
+
+	// AllowedTools is passed as --allowedTools, e.g. "Read", "Bash(git log:*)".
+	AllowedTools []string
+
+	// DisallowedTools is passed as --disallowedTools.
+	DisallowedTools []string
+
+	// PermissionMode is passed as --permission-mode (see [PermissionModes]).
+	// When set it replaces --dangerously-skip-permissions.
+	PermissionMode string
+
+	// ExtraArgs are appended to the command line as-is.
+	ExtraArgs []string
+}
+
+// IsZero reports whether the profile leaves everything at Claude's defaults.
+func (p Profile) IsZero() bool {
+	return p.Model == "" && len(p.AllowedTools) == 0 && len(p.DisallowedTools) == 0 &&
+		p.PermissionMode == "" && len(p.ExtraArgs) == 0
+}
+
+// Validate checks the permission mode and that ExtraArgs don't override
+// flags the Runner manages.
+func (p Profile) Validate() error {
+	if p.PermissionMode != "" && !validPermissionMode(p.PermissionMode) {
+		return fmt.Errorf("unknown permission mode %q (use %s)", p.PermissionMode, strings.Join(PermissionModes, ", "))
+	}
+	for _, arg := range p.ExtraArgs {
+		name, _, _ := strings.Cut(arg, "=")
+		for _, flag := range managedFlags {
+			if name == flag {
+				return fmt.Errorf("%s is set by multiclaude and can't be passed as an extra argument", flag)
+			}
+		}
+	}
+	return nil
+}
+
+// Args returns the command line flags for the profile.
+func (p Profile) Args() []string {
+	var args []string
+	if p.Model != "" {
+		args = append(args, "--model", p.Model)
+	}
+	if len(p.AllowedTools) > 0 {
+		args = append(args, "--allowedTools", strings.Join(p.AllowedTools, ","))
+	}
+	if len(p.DisallowedTools) > 0 {
+		args = append(args, "--disallowedTools", strings.Join(p.DisallowedTools, ","))
+	}
+	if p.PermissionMode != "" {
+		args = append(args, "--permission-mode", p.PermissionMode)
+	}
+	return append(args, p.ExtraArgs...)
+}
+
+// QuoteArgs joins arguments into a shell command line, single-quoting those
+// that contain anything other than letters, digits, and -_./:=,@+.
+func QuoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = quoteArg(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func quoteArg(arg string) string {
+	if arg == "" {
+		return "''"
+	}
+	for _, r := range arg {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=,@+", r)) {
+			return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return arg
+}
+
+func validPermissionMode(mode string) bool {
+	for _, m := range PermissionModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,264 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultReadyTimeout is how long WaitForReady waits for Claude's prompt.
+	// Startup is usually a few seconds, but a loaded machine or a slow
+	// network on first run can take much longer.
+	DefaultReadyTimeout = 90 * time.Second
+
+	// DefaultDeliveryTimeout is how long ConfirmDelivery waits for a sent
+	// message to show up in the pane.
+	DefaultDeliveryTimeout = 10 * time.Second
+
+	// pollInterval is how often the pane is inspected while waiting.
+	pollInterval = 250 * time.Millisecond
+
+	// readyCaptureLines and deliveryCaptureLines are how many lines of
+	// scrollback are inspected. The prompt sits at the bottom of the pane; a
+	// submitted message may already have scrolled up under Claude's reply.
+	readyCaptureLines    = 40
+	deliveryCaptureLines = 200
+
+	// deliverySnippetLength is how much of a message must be found in the
+	// pane. Short enough not to be wrapped across lines.
+	deliverySnippetLength = 30
+)
+
+// PaneInspector lets the Runner see what a terminal pane is showing.
+// The tmux.Client implements this interface. When the Runner's Terminal
+// implements it, Start waits for Claude's prompt instead of fixed delays and
+// messages are confirmed to have arrived.
+type PaneInspector interface {
+	// CapturePane returns the text in the pane, with lines of scrollback.
+	CapturePane(ctx context.Context, session, window string, lines int) (string, error)
+
+	// GetPaneCommand returns the name of the pane's foreground process.
+	GetPaneCommand(ctx context.Context, session, window string) (string, error)
+}
+
+// inputPromptPattern matches Claude's empty input prompt ("> " or "❯ "),
+// optionally inside the input box border.
+var inputPromptPattern = regexp.MustCompile(`^\s*[│|]?\s*[>❯](\s|$)`)
+
+// dialogMarkers appear while Claude shows a dialog, such as the folder trust
+// or a permission prompt, whose options look like the input prompt.
+var dialogMarkers = []string{"Enter to confirm", "Do you trust", "Do you want to"}
+
+// dialogOptionPattern matches a numbered dialog option, e.g. "❯ 1. Yes".
+var dialogOptionPattern = regexp.MustCompile(`^\s*[│|]?\s*[>❯]?\s*\d+\.\s`)
+
+// dialogTailLines is how many non-empty lines at the bottom of the pane an
+// open dialog spans: its question, options, border, and footer.
+const dialogTailLines = 15
+
+// shells are foreground commands that mean Claude is not (or no longer) running.
+var shells = map[string]bool{
+	"bash": true, "zsh": true, "sh": true, "dash": true, "fish": true,
+	"ksh": true, "tcsh": true, "csh": true,
+}
+
+// HasInputPrompt reports whether the pane text shows Claude's input prompt.
+func HasInputPrompt(pane string) bool {
+	for _, line := range strings.Split(pane, "\n") {
+		if inputPromptPattern.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// ShowsDialog reports whether the bottom of the pane shows an open Claude
+// dialog: a dialog marker among the last lines, with no input prompt below
+// it. Dialogs further up the scrollback have been answered.
+func ShowsDialog(pane string) bool {
+	var lines []string
+	for _, line := range strings.Split(pane, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	for i := len(lines) - 1; i >= 0 && i >= len(lines)-dialogTailLines; i-- {
+		for _, marker := range dialogMarkers {
+			if strings.Contains(lines[i], marker) {
+				return true
+			}
+		}
+		if inputPromptPattern.MatchString(lines[i]) && !dialogOptionPattern.MatchString(lines[i]) {
+			return false
+		}
+	}
+	return false
+}
+
+// isShell reports whether a pane's foreground command is a shell.
+func isShell(command string) bool {
+	return shells[strings.TrimPrefix(command, "-")]
+}
+
+// StartupTimeoutError indicates Claude did not show its input prompt in time.
+type StartupTimeoutError struct {
+	Session  string
+	Window   string
+	Waited   time.Duration
+	Command  string // Foreground command of the pane when the wait gave up
+	LastLine string // Last non-empty line of the pane
+	Exited   bool   // Claude started and then exited back to the shell
+}
+
+func (e *StartupTimeoutError) Error() string {
+	what := fmt.Sprintf("Claude did not become ready in %s:%s within %s", e.Session, e.Window, e.Waited.Round(time.Second))
+	if e.Exited {
+		what = fmt.Sprintf("Claude exited during startup in %s:%s", e.Session, e.Window)
+	}
+	if e.Command != "" {
+		what += fmt.Sprintf(" (pane is running %s", e.Command)
+		if e.LastLine != "" {
+			what += fmt.Sprintf(", last line: %q", e.LastLine)
+		}
+		what += ")"
+	}
+	return what
+}
+
+// DeliveryError indicates a message sent to Claude did not show up in the pane.
+type DeliveryError struct {
+	Session string
+	Window  string
+	Waited  time.Duration
+}
+
+func (e *DeliveryError) Error() string {
+	return fmt.Sprintf("message to %s:%s did not appear in the pane within %s", e.Session, e.Window, e.Waited.Round(time.Second))
+}
+
+// IsStartupTimeout returns true if the error indicates Claude did not start.
+func IsStartupTimeout(err error) bool {
+	var timeout *StartupTimeoutError
+	return errors.As(err, &timeout)
+}
+
+// IsDeliveryError returns true if the error indicates a message was not seen
+// in the pane.
+func IsDeliveryError(err error) bool {
+	var delivery *DeliveryError
+	return errors.As(err, &delivery)
+}
+
+// WaitForReady waits until Claude is running in the pane and showing its
+// input prompt. A pane whose foreground process is still a shell is not
+// ready, which keeps a shell prompt from being mistaken for Claude's, and
+// neither is one showing a dialog such as the folder trust prompt.
+// Returns a *StartupTimeoutError if the prompt doesn't appear within timeout,
+// or as soon as Claude is seen to exit back to the shell.
+func WaitForReady(ctx context.Context, pane PaneInspector, session, window string, timeout time.Duration) error {
+	start := time.Now()
+	deadline := start.Add(timeout)
+	started := false
+	var command, text string
+
+	for {
+		var err error
+		command, err = pane.GetPaneCommand(ctx, session, window)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			if !isShell(command) {
+				started = true
+				text, _ = pane.CapturePane(ctx, session, window, readyCaptureLines)
+				if HasInputPrompt(text) && !ShowsDialog(text) {
+					return nil
+				}
+			} else if started {
+				text, _ = pane.CapturePane(ctx, session, window, readyCaptureLines)
+				return &StartupTimeoutError{Session: session, Window: window, Waited: time.Since(start), Command: command, LastLine: lastLine(text), Exited: true}
+			}
+		}
+
+		if !time.Now().Before(deadline) {
+			if text == "" {
+				text, _ = pane.CapturePane(ctx, session, window, readyCaptureLines)
+			}
+			return &StartupTimeoutError{Session: session, Window: window, Waited: timeout, Command: command, LastLine: lastLine(text)}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// ConfirmDelivery waits until a message sent to Claude shows up in the pane:
+// the start of its first line in the transcript, a collapsed paste, or Claude
+// working on it. Returns a *DeliveryError if none appears within timeout.
+func ConfirmDelivery(ctx context.Context, pane PaneInspector, session, window, message string, timeout time.Duration) error {
+	snippet := deliverySnippet(message)
+	deadline := time.Now().Add(timeout)
+
+	for {
+		text, err := pane.CapturePane(ctx, session, window, deliveryCaptureLines)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil && showsDelivery(text, snippet) {
+			return nil
+		}
+
+		if !time.Now().Before(deadline) {
+			return &DeliveryError{Session: session, Window: window, Waited: timeout}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// showsDelivery reports whether pane text shows that a message starting with
+// snippet was received.
+func showsDelivery(pane, snippet string) bool {
+	if strings.Contains(pane, "[Pasted text") || strings.Contains(pane, "esc to interrupt") {
+		return true
+	}
+	return snippet != "" && strings.Contains(strings.Join(strings.Fields(pane), " "), snippet)
+}
+
+// deliverySnippet returns the start of a message's first non-empty line,
+// with whitespace collapsed.
+func deliverySnippet(message string) string {
+	for _, line := range strings.Split(message, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			continue
+		}
+		if runes := []rune(line); len(runes) > deliverySnippetLength {
+			line = strings.TrimSpace(string(runes[:deliverySnippetLength]))
+		}
+		return line
+	}
+	return ""
+}
+
+// lastLine returns the last non-empty line of pane (or stderr) text.
+func lastLine(text string) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if line := strings.TrimSpace(lines[i]); line != "" {
+			return line
+		}
+	}
+	return ""
+}
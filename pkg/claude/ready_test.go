@@ -0,0 +1,183 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// inspectingTerminal is a mockTerminal whose pane can be inspected. Each call
+// advances through the scripted commands or pane texts, staying on the last.
+type inspectingTerminal struct {
+	mockTerminal
+	commands []string
+	panes    []string
+	polls    int
+	captures int
+}
+
+func (m *inspectingTerminal) GetPaneCommand(ctx context.Context, session, window string) (string, error) {
+	command := m.commands[min(m.polls, len(m.commands)-1)]
+	m.polls++
+	return command, nil
+}
+
+func (m *inspectingTerminal) CapturePane(ctx context.Context, session, window string, lines int) (string, error) {
+	pane := m.panes[min(m.captures, len(m.panes)-1)]
+	m.captures++
+	return pane, nil
+}
+
+const claudePrompt = "╭──────────────╮\n│ >            │\n╰──────────────╯\n  ? for shortcuts"
+
+func TestHasInputPrompt(t *testing.T) {
+	tests := []struct {
+		pane string
+		want bool
+	}{
+		{claudePrompt, true},
+		{"Welcome to Claude Code\n❯ ", true},
+		{"user@host:~/repo$ ", false},
+		{"Loading...", false},
+	}
+	for _, tt := range tests {
+		if got := HasInputPrompt(tt.pane); got != tt.want {
+			t.Errorf("HasInputPrompt(%q) = %v, want %v", tt.pane, got, tt.want)
+		}
+	}
+}
+
+func TestShowsDialog(t *testing.T) {
+	permission := "● Bash(rm -rf build)\n╭──────────────────────────╮\n│ Bash command             │\n│   rm -rf build           │\n│ Do you want to proceed?  │\n│ ❯ 1. Yes                 │\n│   2. No                  │\n╰──────────────────────────╯"
+	tests := []struct {
+		name string
+		pane string
+		want bool
+	}{
+		{"permission prompt", permission, true},
+		{"trust dialog", "Do you trust the files in this folder?\n\n ❯ 1. Yes, proceed\n   2. No, exit\n\n Enter to confirm · Esc to exit\n", true},
+		{"answered dialog above the prompt", permission + "\n● Removed build/\n" + claudePrompt, false},
+		{"dialog scrolled out of the tail", "Do you want to proceed?\n" + strings.Repeat("output\n", dialogTailLines), false},
+		{"quoted in output", "● The docs say \"Do you want to\" appears in dialogs\n" + claudePrompt, false},
+		{"prompt only", claudePrompt, false},
+	}
+	for _, tt := range tests {
+		if got := ShowsDialog(tt.pane); got != tt.want {
+			t.Errorf("%s: ShowsDialog() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWaitForReady(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("ready once Claude shows its prompt", func(t *testing.T) {
+		pane := &inspectingTerminal{
+			commands: []string{"bash", "claude", "claude", "claude"},
+			panes:    []string{"Loading...", "Do you trust the files in this folder?\n ❯ 1. Yes, proceed\n Enter to confirm", claudePrompt},
+		}
+		if err := WaitForReady(ctx, pane, "s", "w", 5*time.Second); err != nil {
+			t.Fatalf("WaitForReady() failed: %v", err)
+		}
+		if pane.polls != 4 {
+			t.Errorf("polls = %d, want 4 (the trust dialog is not the prompt)", pane.polls)
+		}
+	})
+
+	t.Run("a shell prompt is not Claude's", func(t *testing.T) {
+		pane := &inspectingTerminal{commands: []string{"zsh"}, panes: []string{"❯ claude --session-id abc"}}
+		err := WaitForReady(ctx, pane, "s", "w", 300*time.Millisecond)
+		var timeout *StartupTimeoutError
+		if !errors.As(err, &timeout) || timeout.Exited {
+			t.Fatalf("WaitForReady() = %v, want a startup timeout", err)
+		}
+		if timeout.Command != "zsh" || timeout.LastLine != "❯ claude --session-id abc" {
+			t.Errorf("timeout = %+v", timeout)
+		}
+		if !strings.Contains(err.Error(), "did not become ready in s:w") {
+			t.Errorf("error = %q", err)
+		}
+	})
+
+	t.Run("Claude exiting fails fast", func(t *testing.T) {
+		pane := &inspectingTerminal{
+			commands: []string{"claude", "bash"},
+			panes:    []string{"Loading...", "Error: invalid API key\n$ "},
+		}
+		err := WaitForReady(ctx, pane, "s", "w", time.Minute)
+		var timeout *StartupTimeoutError
+		if !errors.As(err, &timeout) || !timeout.Exited {
+			t.Fatalf("WaitForReady() = %v, want Claude to have exited", err)
+		}
+		if !IsStartupTimeout(err) {
+			t.Error("IsStartupTimeout() should recognize the error")
+		}
+	})
+
+	t.Run("context cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		pane := &inspectingTerminal{commands: []string{"bash"}, panes: []string{"$ "}}
+		if err := WaitForReady(ctx, pane, "s", "w", time.Minute); !errors.Is(err, context.Canceled) {
+			t.Errorf("WaitForReady() = %v, want context.Canceled", err)
+		}
+	})
+}
+
+func TestConfirmDelivery(t *testing.T) {
+	ctx := context.Background()
+	message := "Fix the   flaky TestDaemonRestart test in internal/daemon\nand add a regression test"
+
+	tests := []struct {
+		name string
+		pane string
+		want bool
+	}{
+		{"echoed in the transcript", "> Fix the flaky TestDaemonRestart test in\n  internal/daemon", true},
+		{"collapsed paste", "> [Pasted text #1 +2 lines]", true},
+		{"Claude working on it", "✻ Thinking… (esc to interrupt)", true},
+		{"not there", claudePrompt, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pane := &inspectingTerminal{panes: []string{tt.pane}}
+			err := ConfirmDelivery(ctx, pane, "s", "w", message, 300*time.Millisecond)
+			if tt.want && err != nil {
+				t.Errorf("ConfirmDelivery() failed: %v", err)
+			}
+			if !tt.want && !IsDeliveryError(err) {
+				t.Errorf("ConfirmDelivery() = %v, want a delivery error", err)
+			}
+		})
+	}
+}
+
+func TestStartWaitsForPrompt(t *testing.T) {
+	terminal := &inspectingTerminal{
+		mockTerminal: mockTerminal{getPanePIDReturn: 12345},
+		commands:     []string{"bash", "claude"},
+		panes:        []string{claudePrompt, claudePrompt + "\n> Hello, Claude!"},
+	}
+	// Delays that would fail the test if they were still used
+	runner := NewRunner(WithTerminal(terminal), WithStartupDelay(time.Hour), WithMessageDelay(time.Hour))
+
+	if _, err := runner.Start(context.Background(), "session", "window", Config{InitialMessage: "Hello, Claude!"}); err != nil {
+		t.Fatalf("Start() failed: %v", err)
+	}
+	if len(terminal.sendKeysLiteralWithEnterCalls) != 1 {
+		t.Fatalf("expected the initial message to be sent once, got %d", len(terminal.sendKeysLiteralWithEnterCalls))
+	}
+
+	// Claude never comes up
+	terminal = &inspectingTerminal{commands: []string{"bash"}, panes: []string{"$ "}}
+	runner = NewRunner(WithTerminal(terminal), WithReadyTimeout(300*time.Millisecond))
+	_, err := runner.Start(context.Background(), "session", "window", Config{InitialMessage: "Hello"})
+	if !IsStartupTimeout(err) {
+		t.Fatalf("Start() = %v, want a startup timeout", err)
+	}
+	if len(terminal.sendKeysLiteralWithEnterCalls) != 0 {
+		t.Error("the initial message must not be typed into the shell")
+	}
+}
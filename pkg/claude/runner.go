@@ -5,7 +5,7 @@
 //
 //   - CLI flag construction
 //   - Session ID generation
-//   - Startup timing quirks
+//   - Waiting for Claude's prompt before sending messages
 //   - Terminal integration via the TerminalRunner interface
 //   - Context support for cancellation and timeouts
 //
@@ -79,13 +79,25 @@ type Runner struct {
 	Terminal TerminalRunner
 
 	// StartupDelay is how long to wait after starting Claude before
-	// attempting to get the PID. Defaults to 500ms.
+	// attempting to get the PID. Defaults to 500ms. Only used when Terminal
+	// does not implement PaneInspector.
 	StartupDelay time.Duration
 
 	// MessageDelay is how long to wait after startup before sending
-	// the first message. Defaults to 1s.
+	// the first message. Defaults to 1s. Only used when Terminal does not
+	// implement PaneInspector.
 	MessageDelay time.Duration
 
+	// ReadyTimeout is how long to wait for Claude's input prompt when
+	// Terminal implements PaneInspector. Defaults to DefaultReadyTimeout;
+	// zero falls back to StartupDelay and MessageDelay.
+	ReadyTimeout time.Duration
+
+	// DeliveryTimeout is how long to wait for a sent message to show up in
+	// the pane when Terminal implements PaneInspector. Defaults to
+	// DefaultDeliveryTimeout; zero skips the check.
+	DeliveryTimeout time.Duration
+
 	// SkipPermissions controls whether to pass --dangerously-skip-permissions.
 	// This is required for non-interactive use. Defaults to true.
 	SkipPermissions bool
@@ -122,6 +134,20 @@ func WithMessageDelay(d time.Duration) RunnerOption {
 	}
 }
 
+// WithReadyTimeout sets how long to wait for Claude's input prompt.
+func WithReadyTimeout(d time.Duration) RunnerOption {
+	return func(r *Runner) {
+		r.ReadyTimeout = d
+	}
+}
+
+// WithDeliveryTimeout sets how long to wait for a sent message to show up.
+func WithDeliveryTimeout(d time.Duration) RunnerOption {
+	return func(r *Runner) {
+		r.DeliveryTimeout = d
+	}
+}
+
 // WithPermissions controls whether to skip permission checks.
 // Set to false to require interactive permission prompts.
 func WithPermissions(skip bool) RunnerOption {
@@ -136,6 +162,8 @@ func NewRunner(opts ...RunnerOption) *Runner {
 		BinaryPath:      "claude",
 		StartupDelay:    500 * time.Millisecond,
 		MessageDelay:    1 * time.Second,
+		ReadyTimeout:    DefaultReadyTimeout,
+		DeliveryTimeout: DefaultDeliveryTimeout,
 		SkipPermissions: true,
 	}
 	for _, opt := range opts {
@@ -192,7 +220,8 @@ type Config struct {
 	SystemPromptFile string
 
 	// InitialMessage is an optional message to send to Claude after startup.
-	// If non-empty, sent after MessageDelay.
+	// If non-empty, sent once Claude shows its prompt (or after MessageDelay
+	// if the terminal can't be inspected).
 	InitialMessage string
 
 	// OutputFile is the path to capture Claude's output.
@@ -203,6 +232,10 @@ type Config struct {
 	// This is useful for showing restart instructions or other information.
 	// If empty, no MOTD is displayed.
 	MOTD string
+
+	// Profile selects the model, tools, and permission mode.
+	// The zero value uses Claude's defaults.
+	Profile Profile
 }
 
 // StartResult contains information about a started Claude instance.
@@ -256,11 +289,19 @@ func (r *Runner) Start(ctx context.Context, session, window string, cfg Config)
 		return nil, fmt.Errorf("failed to send claude command: %w", err)
 	}
 
-	// Wait for Claude to start (respecting context)
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	case <-time.After(r.StartupDelay):
+	// Wait for Claude to show its prompt, or a fixed delay if the terminal
+	// can't be inspected (respecting context)
+	pane, canInspect := r.Terminal.(PaneInspector)
+	if canInspect = canInspect && r.ReadyTimeout > 0; canInspect {
+		if err := WaitForReady(ctx, pane, session, window, r.ReadyTimeout); err != nil {
+			return nil, err
+		}
+	} else {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(r.StartupDelay):
+		}
 	}
 
 	// Get the PID
@@ -271,12 +312,14 @@ func (r *Runner) Start(ctx context.Context, session, window string, cfg Config)
 
 	// Send initial message if configured
 	if cfg.InitialMessage != "" {
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		case <-time.After(r.MessageDelay):
+		if !canInspect {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(r.MessageDelay):
+			}
 		}
-		if err := r.Terminal.SendKeysLiteralWithEnter(ctx, session, window, cfg.InitialMessage); err != nil {
+		if err := r.SendMessage(ctx, session, window, cfg.InitialMessage); err != nil {
 			return nil, fmt.Errorf("failed to send initial message: %w", err)
 		}
 	}
@@ -310,8 +353,8 @@ func (r *Runner) buildCommand(sessionID string, cfg Config) string {
 		cmd += fmt.Sprintf(" --session-id %s", sessionID)
 	}
 
-	// Add skip permissions flag
-	if r.SkipPermissions {
+	// Add skip permissions flag, unless the profile picks a permission mode
+	if r.SkipPermissions && cfg.Profile.PermissionMode == "" {
 		cmd += " --dangerously-skip-permissions"
 	}
 
@@ -320,12 +363,19 @@ func (r *Runner) buildCommand(sessionID string, cfg Config) string {
 		cmd += fmt.Sprintf(" --append-system-prompt-file %s", cfg.SystemPromptFile)
 	}
 
+	// Add model, tool, and permission flags
+	if args := cfg.Profile.Args(); len(args) > 0 {
+		cmd += " " + QuoteArgs(args)
+	}
+
 	return cmd
 }
 
 // SendMessage sends a message to a running Claude instance.
 // This properly handles multiline messages using paste-buffer and sends
-// text + Enter atomically to prevent race conditions.
+// text + Enter atomically to prevent race conditions. If the terminal
+// implements PaneInspector, it then waits for the message to show up in the
+// pane and returns a *DeliveryError if it doesn't.
 func (r *Runner) SendMessage(ctx context.Context, session, window, message string) error {
 	if r.Terminal == nil {
 		return fmt.Errorf("terminal runner not configured")
@@ -336,6 +386,9 @@ func (r *Runner) SendMessage(ctx context.Context, session, window, message strin
 		return fmt.Errorf("failed to send message: %w", err)
 	}
 
+	if pane, ok := r.Terminal.(PaneInspector); ok && r.DeliveryTimeout > 0 {
+		return ConfirmDelivery(ctx, pane, session, window, message, r.DeliveryTimeout)
+	}
 	return nil
 }
 
@@ -514,6 +514,28 @@ func TestBuildCommand(t *testing.T) {
 				"/path/to/claude",
 			},
 		},
+		{
+			name: "with profile",
+			config: Config{
+				SessionID: "test-session",
+				Profile: Profile{
+					Model:           "haiku",
+					AllowedTools:    []string{"Read", "Bash(gh pr:*)"},
+					DisallowedTools: []string{"WebFetch"},
+					PermissionMode:  "acceptEdits",
+					ExtraArgs:       []string{"--verbose"},
+				},
+			},
+			contains: []string{
+				"--model haiku",
+				"--allowedTools 'Read,Bash(gh pr:*)'",
+				"--disallowedTools WebFetch",
+				"--permission-mode acceptEdits --verbose",
+			},
+			excludes: []string{
+				"--dangerously-skip-permissions",
+			},
+		},
 		{
 			name: "with workdir excludes CLAUDE_CONFIG_DIR",
 			config: Config{
@@ -611,3 +633,37 @@ func TestIsBinaryAvailable(t *testing.T) {
 // were removed because CLAUDE_CONFIG_DIR is no longer used. Claude Code only reads
 // credentials from ~/.claude/.credentials.json regardless of CLAUDE_CONFIG_DIR,
 // and slash commands are now embedded directly in agent prompts.
+
+func TestProfileValidate(t *testing.T) {
+	valid := []Profile{
+		{},
+		{Model: "opus", PermissionMode: "plan"},
+		{ExtraArgs: []string{"--verbose", "--add-dir=/tmp/shared"}},
+	}
+	for _, p := range valid {
+		if err := p.Validate(); err != nil {
+			t.Errorf("Validate(%+v) = %v, want nil", p, err)
+		}
+	}
+
+	invalid := []Profile{
+		{PermissionMode: "yolo"},
+		{ExtraArgs: []string{"--resume", "abc"}},
+		{ExtraArgs: []string{"--session-id=abc"}},
+		{ExtraArgs: []string{"--permission-mode", "bypassPermissions"}},
+		{ExtraArgs: []string{"--dangerously-skip-permissions"}},
+	}
+	for _, p := range invalid {
+		if err := p.Validate(); err == nil {
+			t.Errorf("Validate(%+v) should fail", p)
+		}
+	}
+}
+
+func TestQuoteArgs(t *testing.T) {
+	got := QuoteArgs([]string{"--model", "claude-sonnet-4", "Bash(git log:*)", "it's", ""})
+	want := `--model claude-sonnet-4 'Bash(git log:*)' 'it'\''s' ''`
+	if got != want {
+		t.Errorf("QuoteArgs() = %s, want %s", got, want)
+	}
+}
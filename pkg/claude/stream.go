@@ -0,0 +1,229 @@
+package claude
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// maxStreamLine is the longest line of stream-json output the decoder
+// accepts. A single event carries a whole tool result or file write.
+const maxStreamLine = 16 * 1024 * 1024
+
+// Event is one event of Claude's stream-json output: an [InitEvent],
+// [TextEvent], [ToolUseEvent], [ToolResultEvent], [UsageEvent], or
+// [ResultEvent].
+type Event interface {
+	// Session returns the ID of the session the event belongs to.
+	Session() string
+}
+
+// InitEvent starts the stream, once Claude has loaded its configuration.
+type InitEvent struct {
+	SessionID string
+	Model     string
+	WorkDir   string
+	Tools     []string
+}
+
+// TextEvent is text written by the assistant.
+type TextEvent struct {
+	SessionID string
+	Text      string
+}
+
+// ToolUseEvent is a tool call made by the assistant.
+type ToolUseEvent struct {
+	SessionID string
+	ID        string
+	Name      string
+	Input     json.RawMessage
+}
+
+// ToolResultEvent is the result of a tool call, sent back to the assistant.
+type ToolResultEvent struct {
+	SessionID string
+	ToolUseID string
+	Content   string
+	IsError   bool
+}
+
+// UsageEvent reports the tokens used by one assistant message.
+type UsageEvent struct {
+	SessionID string
+	Usage     Usage
+}
+
+// ResultEvent ends the stream with the outcome of the run.
+type ResultEvent struct {
+	SessionID string
+	Subtype   string // "success", or why the run failed, e.g. "error_max_turns"
+	IsError   bool
+	Result    string // The assistant's final message
+	NumTurns  int
+	Duration  time.Duration
+	CostUSD   float64
+	Usage     Usage // Tokens used by the whole run
+}
+
+// Usage counts tokens.
+type Usage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+func (e *InitEvent) Session() string       { return e.SessionID }
+func (e *TextEvent) Session() string       { return e.SessionID }
+func (e *ToolUseEvent) Session() string    { return e.SessionID }
+func (e *ToolResultEvent) Session() string { return e.SessionID }
+func (e *UsageEvent) Session() string      { return e.SessionID }
+func (e *ResultEvent) Session() string     { return e.SessionID }
+
+// streamMessage is one line of stream-json output. Only the fields the
+// typed events need are decoded.
+type streamMessage struct {
+	Type       string   `json:"type"`
+	Subtype    string   `json:"subtype"`
+	SessionID  string   `json:"session_id"`
+	Model      string   `json:"model"`
+	CWD        string   `json:"cwd"`
+	Tools      []string `json:"tools"`
+	IsError    bool     `json:"is_error"`
+	Result     string   `json:"result"`
+	NumTurns   int      `json:"num_turns"`
+	DurationMS int64    `json:"duration_ms"`
+	CostUSD    float64  `json:"total_cost_usd"`
+	Usage      *Usage   `json:"usage"`
+	Message    struct {
+		Content []contentBlock `json:"content"`
+		Usage   *Usage         `json:"usage"`
+	} `json:"message"`
+}
+
+// contentBlock is a block of an assistant or user message.
+type contentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text"`
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`
+	ToolUseID string          `json:"tool_use_id"`
+	Content   json.RawMessage `json:"content"`
+	IsError   bool            `json:"is_error"`
+}
+
+// EventDecoder reads typed events from Claude's stream-json output, as
+// written by `claude -p --output-format stream-json --verbose`.
+type EventDecoder struct {
+	scanner *bufio.Scanner
+	pending []Event
+}
+
+// NewEventDecoder returns a decoder reading stream-json from r.
+func NewEventDecoder(r io.Reader) *EventDecoder {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxStreamLine)
+	return &EventDecoder{scanner: scanner}
+}
+
+// Next returns the next event, or io.EOF at the end of the stream. Lines that
+// are not JSON and message types it doesn't know are skipped, so newer
+// versions of Claude don't break the decoder.
+func (d *EventDecoder) Next() (Event, error) {
+	for len(d.pending) == 0 {
+		if !d.scanner.Scan() {
+			if err := d.scanner.Err(); err != nil {
+				return nil, fmt.Errorf("failed to read stream: %w", err)
+			}
+			return nil, io.EOF
+		}
+		var msg streamMessage
+		if err := json.Unmarshal(d.scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		d.pending = msg.events()
+	}
+
+	event := d.pending[0]
+	d.pending = d.pending[1:]
+	return event, nil
+}
+
+// events converts a stream message into its typed events; an assistant
+// message can hold several.
+func (m *streamMessage) events() []Event {
+	var events []Event
+	switch m.Type {
+	case "system":
+		if m.Subtype == "init" {
+			events = append(events, &InitEvent{SessionID: m.SessionID, Model: m.Model, WorkDir: m.CWD, Tools: m.Tools})
+		}
+
+	case "assistant":
+		for _, block := range m.Message.Content {
+			switch block.Type {
+			case "text":
+				events = append(events, &TextEvent{SessionID: m.SessionID, Text: block.Text})
+			case "tool_use":
+				events = append(events, &ToolUseEvent{SessionID: m.SessionID, ID: block.ID, Name: block.Name, Input: block.Input})
+			}
+		}
+		if m.Message.Usage != nil {
+			events = append(events, &UsageEvent{SessionID: m.SessionID, Usage: *m.Message.Usage})
+		}
+
+	case "user":
+		for _, block := range m.Message.Content {
+			if block.Type == "tool_result" {
+				events = append(events, &ToolResultEvent{
+					SessionID: m.SessionID,
+					ToolUseID: block.ToolUseID,
+					Content:   toolResultText(block.Content),
+					IsError:   block.IsError,
+				})
+			}
+		}
+
+	case "result":
+		result := &ResultEvent{
+			SessionID: m.SessionID,
+			Subtype:   m.Subtype,
+			IsError:   m.IsError,
+			Result:    m.Result,
+			NumTurns:  m.NumTurns,
+			Duration:  time.Duration(m.DurationMS) * time.Millisecond,
+			CostUSD:   m.CostUSD,
+		}
+		if m.Usage != nil {
+			result.Usage = *m.Usage
+		}
+		events = append(events, result)
+	}
+	return events
+}
+
+// toolResultText returns the text of a tool result, which is either a string
+// or a list of content blocks.
+func toolResultText(raw json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+	var blocks []contentBlock
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return ""
+	}
+	for _, block := range blocks {
+		if block.Type == "text" {
+			if text != "" {
+				text += "\n"
+			}
+			text += block.Text
+		}
+	}
+	return text
+}
@@ -0,0 +1,72 @@
+package claude
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sampleStream is stream-json output of a short run, trimmed to the fields
+// the decoder reads
+const sampleStream = `{"type":"system","subtype":"init","session_id":"abc","cwd":"/work","model":"claude-sonnet","tools":["Bash","Read"]}
+{"type":"assistant","session_id":"abc","message":{"content":[{"type":"text","text":"Looking at the PR."},{"type":"tool_use","id":"toolu_1","name":"Bash","input":{"command":"gh pr diff 42"}}],"usage":{"input_tokens":120,"output_tokens":30}}}
+{"type":"user","session_id":"abc","message":{"content":[{"type":"tool_result","tool_use_id":"toolu_1","content":[{"type":"text","text":"diff --git a/x b/x"}]}]}}
+not json at all
+{"type":"stream_event","session_id":"abc"}
+{"type":"user","session_id":"abc","message":{"content":[{"type":"tool_result","tool_use_id":"toolu_2","content":"permission denied","is_error":true}]}}
+{"type":"result","subtype":"success","is_error":false,"session_id":"abc","result":"LGTM","num_turns":3,"duration_ms":1500,"total_cost_usd":0.02,"usage":{"input_tokens":400,"output_tokens":90,"cache_read_input_tokens":1000}}
+`
+
+func TestEventDecoder(t *testing.T) {
+	decoder := NewEventDecoder(strings.NewReader(sampleStream))
+
+	var got []Event
+	for {
+		event, err := decoder.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next() failed: %v", err)
+		}
+		if event.Session() != "abc" {
+			t.Errorf("%T session = %q, want abc", event, event.Session())
+		}
+		got = append(got, event)
+	}
+
+	if len(got) != 7 {
+		t.Fatalf("decoded %d events, want 7: %+v", len(got), got)
+	}
+	if init, ok := got[0].(*InitEvent); !ok || init.Model != "claude-sonnet" || init.WorkDir != "/work" || len(init.Tools) != 2 {
+		t.Errorf("event 0 = %+v, want init", got[0])
+	}
+	if text, ok := got[1].(*TextEvent); !ok || text.Text != "Looking at the PR." {
+		t.Errorf("event 1 = %+v, want the assistant's text", got[1])
+	}
+	if tool, ok := got[2].(*ToolUseEvent); !ok || tool.Name != "Bash" || tool.ID != "toolu_1" || !strings.Contains(string(tool.Input), "gh pr diff") {
+		t.Errorf("event 2 = %+v, want the Bash call", got[2])
+	}
+	if usage, ok := got[3].(*UsageEvent); !ok || usage.Usage.InputTokens != 120 || usage.Usage.OutputTokens != 30 {
+		t.Errorf("event 3 = %+v, want the message's usage", got[3])
+	}
+	if result, ok := got[4].(*ToolResultEvent); !ok || result.ToolUseID != "toolu_1" || result.Content != "diff --git a/x b/x" || result.IsError {
+		t.Errorf("event 4 = %+v, want the tool result from content blocks", got[4])
+	}
+	if result, ok := got[5].(*ToolResultEvent); !ok || result.Content != "permission denied" || !result.IsError {
+		t.Errorf("event 5 = %+v, want the failed tool result", got[5])
+	}
+	result, ok := got[6].(*ResultEvent)
+	if !ok {
+		t.Fatalf("event 6 = %+v, want the result", got[6])
+	}
+	if result.Subtype != "success" || result.IsError || result.Result != "LGTM" || result.NumTurns != 3 ||
+		result.Duration != 1500*time.Millisecond || result.CostUSD != 0.02 || result.Usage.CacheReadInputTokens != 1000 {
+		t.Errorf("result = %+v", result)
+	}
+
+	if _, err := decoder.Next(); err != io.EOF {
+		t.Errorf("Next() after the end = %v, want io.EOF", err)
+	}
+}
@@ -122,6 +122,23 @@ func (p *Paths) AgentClaudeConfigDir(repoName, agentName string) string {
 	return filepath.Join(p.ClaudeConfigDir, repoName, agentName)
 }
 
+// AgentSettingsFile returns the path to the Claude settings file holding the
+// permission rules of an agent that shares the repository checkout
+func (p *Paths) AgentSettingsFile(repoName, agentName string) string {
+	return filepath.Join(p.AgentClaudeConfigDir(repoName, agentName), "settings.json")
+}
+
+// PromptsDir returns the path to the agents' prompt files, kept per
+// repository and agent by prompts.Store
+func (p *Paths) PromptsDir() string {
+	return filepath.Join(p.Root, "prompts")
+}
+
+// SpawnJournalFile returns the path to the journal of agent spawns in flight
+func (p *Paths) SpawnJournalFile() string {
+	return filepath.Join(p.Root, "spawns.json")
+}
+
 // AgentCommandsDir returns the path for a specific agent's slash commands directory
 func (p *Paths) AgentCommandsDir(repoName, agentName string) string {
 	return filepath.Join(p.AgentClaudeConfigDir(repoName, agentName), "commands")
@@ -149,3 +166,9 @@ func NewTestPaths(tmpDir string) *Paths {
 func (p *Paths) RepoArchiveDir(repoName string) string {
 	return filepath.Join(p.ArchiveDir, repoName)
 }
+
+// MessageArchiveDir returns the path where the mailboxes of a repository's
+// finished agents are archived
+func (p *Paths) MessageArchiveDir(repoName string) string {
+	return filepath.Join(p.RepoArchiveDir(repoName), "messages")
+}
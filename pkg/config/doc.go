@@ -34,7 +34,19 @@ func DirectoryDocs() []PathDoc {
 			Path:        "state.json",
 			Description: "Central state file containing all tracked repositories and agents",
 			Type:        "file",
-			Notes:       "Written atomically via temp file + rename. See StateDoc() for format details.",
+			Notes:       "Snapshot of the state, rewritten atomically via temp file + rename at most once a minute. Read-only for external tools. See StateDoc() for format details.",
+		},
+		{
+			Path:        "state.journal",
+			Description: "Write-ahead journal of state changes since the last snapshot",
+			Type:        "file",
+			Notes:       "One JSON record per line. Replayed on top of state.json at load and removed when the daemon snapshots.",
+		},
+		{
+			Path:        "spawns.json",
+			Description: "Journal of agent spawns in flight",
+			Type:        "file",
+			Notes:       "Lists the worktree, branch, prompt file, and tmux window of each spawn before they are created. The daemon rolls back what's listed here when it starts, so a spawn cut short by a crash leaves nothing behind. Removed when no spawn is in flight.",
 		},
 		{
 			Path:        "repos/",
@@ -84,11 +96,35 @@ func DirectoryDocs() []PathDoc {
 			Type:        "directory",
 			Notes:       "Contains msg-<uuid>.json files addressed to this agent.",
 		},
+		{
+			Path:        "archive/<repo-name>/",
+			Description: "Work set aside for a repository",
+			Type:        "directory",
+			Notes:       "Timestamped directories of uncommitted changes from paused or removed workers.",
+		},
+		{
+			Path:        "archive/<repo-name>/messages/<agent-name>_<timestamp>/",
+			Description: "Archived mailbox of a finished agent",
+			Type:        "directory",
+			Notes:       "Moved here from messages/ when the agent is cleaned up, and linked from its task history entry.",
+		},
 		{
 			Path:        "prompts/",
 			Description: "Generated prompt files for agents",
 			Type:        "directory",
-			Notes:       "Created on-demand. Contains <agent-name>.md prompt files.",
+			Notes:       "Created on-demand. Holds a directory per repository and agent.",
+		},
+		{
+			Path:        "prompts/<repo-name>/<agent-name>/v<N>.md",
+			Description: "Versions of an agent's system prompt",
+			Type:        "file",
+			Notes:       "A prompt that changed is saved as a new version. The agent's prompt_file in state.json is the version its session was started with, reused on restart. Show it with 'multiclaude agent prompt <name>'.",
+		},
+		{
+			Path:        "claude-config/<repo-name>/<agent-name>/settings.json",
+			Description: "Permission rules for an agent that shares the repository checkout",
+			Type:        "file",
+			Notes:       "Written when the agent's type has a restricted permission profile and passed to Claude with --settings. Agents with their own worktree get the rules in the worktree's .claude/settings.json instead.",
 		},
 	}
 }
@@ -104,12 +140,26 @@ type StateFieldDoc struct {
 func StateDocs() []StateFieldDoc {
 	return []StateFieldDoc{
 		// Top level
+		{Field: "version", Type: "int", Description: "Schema version of the file; older files are migrated (with a backup) on load"},
 		{Field: "repos", Type: "map[string]*Repository", Description: "Map of repository name to repository state"},
+		{Field: "global_budget", Type: "TokenBudget", Description: "Daily token warning threshold and cap across all repositories (omitempty)"},
 
 		// Repository fields
 		{Field: "repos.<name>.github_url", Type: "string", Description: "GitHub URL of the repository"},
 		{Field: "repos.<name>.tmux_session", Type: "string", Description: "Name of the tmux session for this repo"},
 		{Field: "repos.<name>.agents", Type: "map[string]Agent", Description: "Map of agent name to agent state"},
+		{Field: "repos.<name>.pending_tasks", Type: "[]PendingTask", Description: "Worker tasks waiting for their dependencies to merge (omitempty)"},
+		{Field: "repos.<name>.worker_queue", Type: "[]QueuedTask", Description: "Worker tasks waiting for a free slot, in spawn order (omitempty)"},
+		{Field: "repos.<name>.pull_requests", Type: "map[string]PullRequestStatus", Description: "PRs tracked by the daemon, keyed by head branch: state, CI status, review decision, mergeability (omitempty)"},
+		{Field: "repos.<name>.ci_fix_config", Type: "CIFixConfig", Description: "Whether failing PRs of finished workers get fix-up workers, and how many per PR (omitempty)"},
+		{Field: "repos.<name>.worker_resume_config", Type: "WorkerResumeConfig", Description: "Whether crashed workers are resumed with --resume, and how many times before the task fails (omitempty)"},
+		{Field: "repos.<name>.refresh_config", Type: "RefreshConfig", Description: "Whether a conflicting refresh onto main is left in progress for the worker to resolve (omitempty)"},
+		{Field: "repos.<name>.budget_config", Type: "BudgetConfig", Description: "Daily token warning thresholds and caps for the repository and per agent type (omitempty)"},
+		{Field: "repos.<name>.task_history", Type: "[]TaskHistoryEntry", Description: "Finished worker tasks with their PR, status, and token usage (omitempty)"},
+		{Field: "repos.<name>.max_workers", Type: "int", Description: "Maximum concurrent workers; 0 means unlimited (omitempty)"},
+		{Field: "repos.<name>.message_retention", Type: "MessageRetentionConfig", Description: "How long, and how many, delivered messages each mailbox keeps (omitempty, 7 days and 200 messages if unset)"},
+		{Field: "repos.<name>.message_groups", Type: "map[string][]string", Description: "Named message groups addressed as @<name>; members are agent names or group addresses (omitempty)"},
+		{Field: "repos.<name>.permission_profiles", Type: "map[string]string", Description: "Permission profile each agent type runs under, keyed by agent type; unlisted types run unrestricted (omitempty)"},
 
 		// Agent fields
 		{Field: "repos.<name>.agents.<name>.type", Type: "string", Description: "Agent type: supervisor, worker, merge-queue, or workspace"},
@@ -121,6 +171,16 @@ func StateDocs() []StateFieldDoc {
 		{Field: "repos.<name>.agents.<name>.created_at", Type: "time.Time", Description: "When the agent was created"},
 		{Field: "repos.<name>.agents.<name>.last_nudge", Type: "time.Time", Description: "Last time agent was nudged (omitempty)"},
 		{Field: "repos.<name>.agents.<name>.ready_for_cleanup", Type: "bool", Description: "Whether worker is ready to be cleaned up (workers only, omitempty)"},
+		{Field: "repos.<name>.agents.<name>.depends_on", Type: "[]string", Description: "Worker names or PR numbers that merged before this worker started (workers only, omitempty)"},
+		{Field: "repos.<name>.agents.<name>.resume_count", Type: "int", Description: "Times in a row the worker was resumed after crashing; reset once it runs stably (workers only, omitempty)"},
+		{Field: "repos.<name>.agents.<name>.last_resumed_at", Type: "time.Time", Description: "When the worker was last resumed (workers only, omitempty)"},
+		{Field: "repos.<name>.agents.<name>.activity", Type: "string", Description: "Activity detected from the tmux pane: busy, idle, waiting_permission, crashed (omitempty when unknown)"},
+		{Field: "repos.<name>.agents.<name>.activity_changed_at", Type: "time.Time", Description: "When the detected activity last changed (omitempty)"},
+		{Field: "repos.<name>.agents.<name>.refresh_disabled", Type: "bool", Description: "Agent opted out of having its worktree synced with main (omitempty)"},
+		{Field: "repos.<name>.agents.<name>.needs_rebase", Type: "bool", Description: "Refreshing onto main hit conflicts the agent must resolve (omitempty)"},
+		{Field: "repos.<name>.agents.<name>.rebase_conflicts", Type: "[]string", Description: "Files that conflicted on the last refresh (omitempty)"},
+		{Field: "repos.<name>.agents.<name>.needs_rebase_since", Type: "time.Time", Description: "When the conflicts were first detected (omitempty)"},
+		{Field: "repos.<name>.agents.<name>.prompt_file", Type: "string", Description: "Prompt version the agent's session was started with, under prompts/ (omitempty)"},
 	}
 }
 
@@ -141,5 +201,10 @@ func MessageDocs() []MessageFieldDoc {
 		{Field: "body", Type: "string", Description: "Message content (markdown text)"},
 		{Field: "status", Type: "string", Description: "Message status: pending, delivered, read, or acked"},
 		{Field: "acked_at", Type: "time.Time", Description: "When the message was acknowledged (omitempty)"},
+		{Field: "reply_to", Type: "string", Description: "ID of the message this one answers (omitempty)"},
+		{Field: "thread_id", Type: "string", Description: "ID of the message that started the thread; messages without one start their own (omitempty)"},
+		{Field: "priority", Type: "string", Description: "Delivery priority: low, normal, or urgent; urgent messages are delivered first (omitempty, normal if unset)"},
+		{Field: "group", Type: "string", Description: "Group address the message was sent to, such as @workers (omitempty)"},
+		{Field: "broadcast_id", Type: "string", Description: "ID shared by every recipient's copy of a group message, in format bc-<uuid> (omitempty)"},
 	}
 }
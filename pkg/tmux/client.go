@@ -359,10 +359,46 @@ func (c *Client) GetPanePID(ctx context.Context, session, windowName string) (in
 	return pid, nil
 }
 
+// GetPaneCommand returns the name of the foreground process in the first pane
+// of a window, e.g. "bash" while the shell is waiting or "claude" once Claude
+// has started.
+func (c *Client) GetPaneCommand(ctx context.Context, session, windowName string) (string, error) {
+	target := fmt.Sprintf("%s:%s", session, windowName)
+	// list-panes fails for a missing window, where display-message would
+	// silently report the current pane instead
+	output, err := c.tmuxCmd(ctx, "list-panes", "-t", target, "-F", "#{pane_current_command}").Output()
+	if err != nil {
+		return "", c.wrapCommandError(ctx, err, "list-panes", session, windowName)
+	}
+	first, _, _ := strings.Cut(string(output), "\n")
+	return strings.TrimSpace(first), nil
+}
+
 // =============================================================================
 // Output Capture - Third Differentiator
 // =============================================================================
 
+// CapturePane returns the text currently shown in the first pane of a window.
+// If lines is greater than zero, that many lines of scrollback above the visible
+// area are included as well. Trailing blank lines are trimmed.
+//
+// This is useful for inspecting what an interactive program is doing, e.g.
+// whether it is working, waiting at a prompt, or asking a question.
+func (c *Client) CapturePane(ctx context.Context, session, windowName string, lines int) (string, error) {
+	target := fmt.Sprintf("%s:%s", session, windowName)
+	args := []string{"capture-pane", "-p", "-t", target}
+	if lines > 0 {
+		args = append(args, "-S", fmt.Sprintf("-%d", lines))
+	}
+
+	output, err := c.tmuxCmd(ctx, args...).Output()
+	if err != nil {
+		return "", c.wrapCommandError(ctx, err, "capture-pane", session, windowName)
+	}
+
+	return strings.TrimRight(string(output), "\n"), nil
+}
+
 // StartPipePane starts capturing pane output to a file.
 // The output is appended to the file, so it persists across restarts.
 //
@@ -658,6 +658,74 @@ func TestGetPanePID(t *testing.T) {
 	}
 }
 
+func TestGetPaneCommand(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient()
+	sessionName := createTestSessionOrSkip(t, ctx, client)
+	defer client.KillSession(ctx, sessionName)
+
+	windowName := "test-window"
+	if err := client.CreateWindow(ctx, sessionName, windowName); err != nil {
+		t.Fatalf("Failed to create window: %v", err)
+	}
+
+	command, err := client.GetPaneCommand(ctx, sessionName, windowName)
+	if err != nil {
+		t.Fatalf("Failed to get pane command: %v", err)
+	}
+	if command == "" {
+		t.Error("Expected the pane's shell, got an empty command")
+	}
+
+	if _, err := client.GetPaneCommand(ctx, sessionName, "no-such-window"); err == nil {
+		t.Error("Expected an error for a missing window")
+	}
+}
+
+func TestCapturePane(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient()
+	sessionName := createTestSessionOrSkip(t, ctx, client)
+	defer client.KillSession(ctx, sessionName)
+
+	windowName := "test-window"
+	if err := client.CreateWindow(ctx, sessionName, windowName); err != nil {
+		t.Fatalf("Failed to create window: %v", err)
+	}
+
+	// Type without pressing Enter so the result doesn't depend on shell startup
+	if err := client.SendKeysLiteral(ctx, sessionName, windowName, "capture-marker-42"); err != nil {
+		t.Fatalf("Failed to send keys: %v", err)
+	}
+
+	// Poll until the typed text shows up in the pane
+	var text string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		var err error
+		text, err = client.CapturePane(ctx, sessionName, windowName, 50)
+		if err != nil {
+			t.Fatalf("Failed to capture pane: %v", err)
+		}
+		if strings.Contains(text, "capture-marker-42") {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Errorf("Expected pane to contain typed text, got: %q", text)
+}
+
+func TestCapturePaneNonExistentWindow(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient()
+	sessionName := createTestSessionOrSkip(t, ctx, client)
+	defer client.KillSession(ctx, sessionName)
+
+	if _, err := client.CapturePane(ctx, sessionName, "does-not-exist", 0); err == nil {
+		t.Error("Expected error capturing non-existent window")
+	}
+}
+
 func TestMultipleSessions(t *testing.T) {
 	skipIfCannotCreateSessions(t)
 	ctx := context.Background()
@@ -1250,6 +1318,18 @@ func TestGetPanePIDContextCancellation(t *testing.T) {
 	}
 }
 
+func TestCapturePaneContextCancellation(t *testing.T) {
+	client := NewClient()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := client.CapturePane(ctx, "session", "window", 0)
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
 func TestStartPipePaneContextCancellation(t *testing.T) {
 	client := NewClient()
 
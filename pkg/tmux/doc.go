@@ -6,6 +6,7 @@
 //   - Multiline text input using paste-buffer (see [Client.SendKeysLiteral])
 //   - Process PID extraction from panes (see [Client.GetPanePID])
 //   - Output capture via pipe-pane (see [Client.StartPipePane], [Client.StopPipePane])
+//   - Pane snapshots for inspecting what an application is showing (see [Client.CapturePane])
 //
 // # Installation
 //